@@ -13,6 +13,7 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/api"
 	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/config"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
 )
 
 func main() {
@@ -35,8 +36,33 @@ func main() {
 		sugar.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Connect to the database
+	db, err := repository.NewDatabase(cfg, sugar)
+	if err != nil {
+		sugar.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.AutoMigrate(); err != nil {
+		sugar.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	if err := db.Seed(context.Background()); err != nil {
+		sugar.Fatalf("Failed to seed database: %v", err)
+	}
+
 	// Initialize router
-	router := api.SetupRouter(cfg, sugar)
+	router, err := api.SetupRouter(cfg, db, sugar)
+	if err != nil {
+		sugar.Fatalf("Failed to initialize router: %v", err)
+	}
+
+	// Remind members of their tasks in the background
+	reminders, err := api.NewReminderScheduler(cfg, db, sugar)
+	if err != nil {
+		sugar.Fatalf("Failed to initialize reminder scheduler: %v", err)
+	}
+	reminders.Start()
 
 	// Configure server
 	server := &http.Server{
@@ -71,5 +97,10 @@ func main() {
 		sugar.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Let reminders being sent finish
+	if err := reminders.Stop(ctx); err != nil {
+		sugar.Errorf("Reminder scheduler forced to stop: %v", err)
+	}
+
 	sugar.Info("Server exiting")
 }
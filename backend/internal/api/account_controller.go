@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type emailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+// AccountController handles password resets and email verification
+type AccountController struct {
+	accountService *services.AccountService
+	logger         *zap.SugaredLogger
+}
+
+// NewAccountController creates a new account controller
+func NewAccountController(accountService *services.AccountService, logger *zap.SugaredLogger) *AccountController {
+	return &AccountController{
+		accountService: accountService,
+		logger:         logger,
+	}
+}
+
+// RequestPasswordReset emails a password reset link. The response is the same
+// whether or not the address is registered.
+func (ctrl *AccountController) RequestPasswordReset(c *gin.Context) {
+	var req emailRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := ctrl.accountService.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusAccepted, messageResponse{
+		Message: "If the address belongs to an account, a password reset link has been sent to it",
+	})
+}
+
+// ResetPassword sets a new password with an emailed reset token
+func (ctrl *AccountController) ResetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := ctrl.accountService.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RequestEmailVerification emails a new verification link. The response is
+// the same whether or not the address is registered or already verified.
+func (ctrl *AccountController) RequestEmailVerification(c *gin.Context) {
+	var req emailRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := ctrl.accountService.RequestEmailVerification(c.Request.Context(), req.Email); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusAccepted, messageResponse{
+		Message: "If the address belongs to an unverified account, a verification link has been sent to it",
+	})
+}
+
+// VerifyEmail marks the user's email address as verified with an emailed token
+func (ctrl *AccountController) VerifyEmail(c *gin.Context) {
+	var req verifyEmailRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := ctrl.accountService.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type activityQuery struct {
+	RecordType string `form:"record_type" binding:"omitempty,oneof=contact company deal"`
+	RecordID   int    `form:"record_id" binding:"omitempty,min=1"`
+	Type       string `form:"type" binding:"omitempty,oneof=note call meeting email task"`
+	AuthorID   int    `form:"author_id" binding:"omitempty,min=1"`
+	Segment    int    `form:"segment" binding:"omitempty,min=1"`
+}
+
+type activityRequest struct {
+	Type       string     `json:"type" binding:"required,oneof=note call meeting email task"`
+	RecordType string     `json:"record_type" binding:"required,oneof=contact company deal"`
+	RecordID   int        `json:"record_id" binding:"required,min=1"`
+	Subject    string     `json:"subject" binding:"required,max=255"`
+	Body       string     `json:"body" binding:"max=10000"`
+	OccurredAt *time.Time `json:"occurred_at"`                           // defaults to now on create
+	Duration   int        `json:"duration" binding:"min=0,max=31536000"` // in seconds
+	Outcome    string     `json:"outcome" binding:"max=100"`
+}
+
+type activityResponse struct {
+	ID         int           `json:"id"`
+	Type       string        `json:"type"`
+	RecordType string        `json:"record_type"`
+	RecordID   int           `json:"record_id"`
+	AuthorID   *int          `json:"author_id"`
+	Author     *userResponse `json:"author,omitempty"`
+	Subject    string        `json:"subject"`
+	Body       string        `json:"body"`
+	OccurredAt time.Time     `json:"occurred_at"`
+	Duration   int64         `json:"duration"` // in seconds
+	Outcome    string        `json:"outcome"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+// timelineStageChangeResponse describes a stage change of a deal on a timeline
+type timelineStageChangeResponse struct {
+	DealID    int    `json:"deal_id"`
+	DealTitle string `json:"deal_title"`
+	dealStageChangeResponse
+}
+
+// timelineEntryResponse is an event of a record's timeline. Type tells which
+// of activity and stage_change is set.
+type timelineEntryResponse struct {
+	Type        string                       `json:"type"` // "activity" or "stage_change"
+	OccurredAt  time.Time                    `json:"occurred_at"`
+	Activity    *activityResponse            `json:"activity,omitempty"`
+	StageChange *timelineStageChangeResponse `json:"stage_change,omitempty"`
+}
+
+func (req activityRequest) input() services.ActivityInput {
+	return services.ActivityInput{
+		Type:       req.Type,
+		RecordType: req.RecordType,
+		RecordID:   req.RecordID,
+		Subject:    req.Subject,
+		Body:       req.Body,
+		OccurredAt: req.OccurredAt,
+		Duration:   time.Duration(req.Duration) * time.Second,
+		Outcome:    req.Outcome,
+	}
+}
+
+func newActivityResponse(activity *models.Activity) activityResponse {
+	response := activityResponse{
+		ID:         activity.ID,
+		Type:       activity.Type,
+		RecordType: activity.RecordType,
+		RecordID:   activity.RecordID,
+		AuthorID:   activity.AuthorID,
+		Subject:    activity.Subject,
+		Body:       activity.Body,
+		OccurredAt: activity.OccurredAt,
+		Duration:   int64(activity.Duration.Seconds()),
+		Outcome:    activity.Outcome,
+		CreatedAt:  activity.CreatedAt,
+		UpdatedAt:  activity.UpdatedAt,
+	}
+	if activity.Author != nil {
+		author := newUserResponse(activity.Author)
+		response.Author = &author
+	}
+	return response
+}
+
+func newActivityListResponse(activities []models.Activity) []activityResponse {
+	response := make([]activityResponse, len(activities))
+	for i := range activities {
+		response[i] = newActivityResponse(&activities[i])
+	}
+	return response
+}
+
+func newTimelineResponse(entries []services.TimelineEntry) []timelineEntryResponse {
+	response := make([]timelineEntryResponse, len(entries))
+	for i, entry := range entries {
+		response[i] = timelineEntryResponse{OccurredAt: entry.At}
+		switch {
+		case entry.Activity != nil:
+			activity := newActivityResponse(entry.Activity)
+			response[i].Type, response[i].Activity = "activity", &activity
+		case entry.StageChange != nil:
+			change := &timelineStageChangeResponse{
+				DealID:                  entry.StageChange.DealID,
+				dealStageChangeResponse: newDealStageChangeResponse(entry.StageChange),
+			}
+			if entry.StageChange.Deal != nil {
+				change.DealTitle = entry.StageChange.Deal.Title
+			}
+			response[i].Type, response[i].StageChange = "stage_change", change
+		}
+	}
+	return response
+}
+
+// ActivityController handles the activities logged against the records of the
+// current organization and the timelines of those records
+type ActivityController struct {
+	activityService *services.ActivityService
+	logger          *zap.SugaredLogger
+}
+
+// NewActivityController creates a new activity controller
+func NewActivityController(activityService *services.ActivityService, logger *zap.SugaredLogger) *ActivityController {
+	return &ActivityController{
+		activityService: activityService,
+		logger:          logger,
+	}
+}
+
+// List returns a page of activities, filtered and sorted by the query
+func (ctrl *ActivityController) List(c *gin.Context) {
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	var query activityQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(middleware.NewBadRequestError("Invalid query", err.Error()))
+		return
+	}
+	filters, ok := listFilters(c, repository.ActivityFields, false)
+	if !ok {
+		return
+	}
+
+	activities, total, err := ctrl.activityService.List(c.Request.Context(), repository.ActivityFilter{
+		RecordType: query.RecordType,
+		RecordID:   query.RecordID,
+		Type:       query.Type,
+		AuthorID:   query.AuthorID,
+		Segment:    query.Segment,
+		Filters:    filters,
+	}, page, pageSize)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.PaginationResponse(c, http.StatusOK, newActivityListResponse(activities), page, pageSize, int(total))
+}
+
+// Create logs an activity authored by the current user
+func (ctrl *ActivityController) Create(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req activityRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	activity, err := ctrl.activityService.Create(c.Request.Context(), userID, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newActivityResponse(activity))
+}
+
+// Get returns a single activity
+func (ctrl *ActivityController) Get(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	activity, err := ctrl.activityService.Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newActivityResponse(activity))
+}
+
+// Update replaces an activity's details
+func (ctrl *ActivityController) Update(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req activityRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	activity, err := ctrl.activityService.Update(c.Request.Context(), id, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newActivityResponse(activity))
+}
+
+// Delete removes an activity
+func (ctrl *ActivityController) Delete(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.activityService.Delete(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ContactTimeline returns a page of a contact's timeline
+func (ctrl *ActivityController) ContactTimeline(c *gin.Context) {
+	ctrl.timeline(c, models.RecordContact)
+}
+
+// CompanyTimeline returns a page of a company's timeline
+func (ctrl *ActivityController) CompanyTimeline(c *gin.Context) {
+	ctrl.timeline(c, models.RecordCompany)
+}
+
+// DealTimeline returns a page of a deal's timeline
+func (ctrl *ActivityController) DealTimeline(c *gin.Context) {
+	ctrl.timeline(c, models.RecordDeal)
+}
+
+// timeline returns a page of the timeline of the record of the given type
+// named by the id path parameter
+func (ctrl *ActivityController) timeline(c *gin.Context, recordType string) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	entries, total, err := ctrl.activityService.Timeline(c.Request.Context(), recordType, id, page, pageSize)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.PaginationResponse(c, http.StatusOK, newTimelineResponse(entries), page, pageSize, int(total))
+}
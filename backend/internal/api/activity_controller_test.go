@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// activityControllers returns controllers serving contact 1, company 1,
+// deal 1 of contact 1 with a stage change two hours ago and a call with
+// contact 1 an hour ago
+func activityControllers() *controllers {
+	now := time.Now()
+	owned := models.TenantOwned{OrganizationID: testOrganizationID}
+	activities := repotest.NewActivities(nil, models.Activity{
+		ID: 1, TenantOwned: owned, Type: models.ActivityCall, RecordType: models.RecordContact, RecordID: 1, Subject: "Intro call",
+		OccurredAt: now.Add(-time.Hour),
+	})
+	contacts := repotest.NewContacts(models.Contact{ID: 1, TenantOwned: owned, FirstName: "Ada"})
+	companies := repotest.NewCompanies(contacts, models.Company{ID: 1, TenantOwned: owned, Name: "Acme"})
+	deals := repotest.NewDeals(companies, models.Deal{
+		ID: 1, TenantOwned: owned, Title: "Big sale", Status: models.DealOpen, PipelineID: 1, StageID: 1,
+		Contacts: []models.DealContact{{ContactID: 1}},
+	})
+	ctx := tenant.WithOrganization(context.Background(), testOrganizationID)
+	err := deals.RecordStageChange(ctx, &models.DealStageChange{
+		DealID: 1, ToStageID: 1, Status: models.DealOpen, CreatedAt: now.Add(-2 * time.Hour),
+	})
+	if err != nil {
+		panic(err)
+	}
+	service := services.NewActivityService(activities, contacts, companies, deals, nil, zap.NewNop().Sugar())
+	return &controllers{activities: NewActivityController(service, zap.NewNop().Sugar())}
+}
+
+func TestActivityRoutesRequirePermissions(t *testing.T) {
+	read := []string{models.PermissionActivitiesRead}
+	write := []string{models.PermissionActivitiesWrite}
+	activity := map[string]interface{}{"type": "note", "record_type": "deal", "record_id": 1, "subject": "Follow up"}
+
+	checkRoutePermissions(t, activityControllers, []protectedRoute{
+		{http.MethodGet, "/activities", nil, read, http.StatusOK},
+		{http.MethodGet, "/activities/1", nil, read, http.StatusOK},
+		{http.MethodPost, "/activities", activity, write, http.StatusCreated},
+		{http.MethodPut, "/activities/1", activity, write, http.StatusOK},
+		{http.MethodDelete, "/activities/1", nil, write, http.StatusNoContent},
+		{http.MethodGet, "/contacts/1/timeline", nil, []string{models.PermissionContactsRead, models.PermissionActivitiesRead}, http.StatusOK},
+		{http.MethodGet, "/companies/1/timeline", nil, []string{models.PermissionCompaniesRead, models.PermissionActivitiesRead}, http.StatusOK},
+		{http.MethodGet, "/deals/1/timeline", nil, []string{models.PermissionDealsRead, models.PermissionActivitiesRead}, http.StatusOK},
+	})
+}
+
+func TestActivityControllerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    interface{}
+		status  int
+		message string
+	}{
+		{"unknown type", http.MethodPost, "/activities", map[string]interface{}{
+			"type": "fax", "record_type": "contact", "record_id": 1, "subject": "Hello",
+		}, http.StatusBadRequest, "Invalid request body"},
+		{"unknown record type", http.MethodPost, "/activities", map[string]interface{}{
+			"type": "note", "record_type": "invoice", "record_id": 1, "subject": "Hello",
+		}, http.StatusBadRequest, "Invalid request body"},
+		{"negative duration", http.MethodPost, "/activities", map[string]interface{}{
+			"type": "call", "record_type": "contact", "record_id": 1, "subject": "Hello", "duration": -1,
+		}, http.StatusBadRequest, "Invalid request body"},
+		{"missing record", http.MethodPost, "/activities", map[string]interface{}{
+			"type": "note", "record_type": "company", "record_id": 9, "subject": "Hello",
+		}, http.StatusBadRequest, services.ErrInvalidRecord.Error()},
+		{"moved to a missing record", http.MethodPut, "/activities/1", map[string]interface{}{
+			"type": "note", "record_type": "deal", "record_id": 9, "subject": "Hello",
+		}, http.StatusBadRequest, services.ErrInvalidRecord.Error()},
+		{"missing activity", http.MethodGet, "/activities/9", nil, http.StatusNotFound, "Resource not found"},
+		{"delete of a missing activity", http.MethodDelete, "/activities/9", nil, http.StatusNotFound, "Resource not found"},
+		{"timeline of a missing contact", http.MethodGet, "/contacts/9/timeline", nil, http.StatusNotFound, "Resource not found"},
+		{"timeline of a missing deal", http.MethodGet, "/deals/9/timeline", nil, http.StatusNotFound, "Resource not found"},
+		{"timeline page", http.MethodGet, "/deals/1/timeline?page=-1", nil, http.StatusBadRequest, "Invalid pagination"},
+		{"timeline page too deep", http.MethodGet, "/deals/1/timeline?page=51", nil, http.StatusBadRequest, services.ErrTimelineTooDeep.Error()},
+		{"unknown sort", http.MethodGet, "/activities?sort=subject", nil, http.StatusBadRequest, "Invalid query"},
+		{"filter of the wrong type", http.MethodGet, "/activities?filter[occurred_at][gte]=yesterday", nil, http.StatusBadRequest, "Invalid query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := protectedEngine(activityControllers(), models.PermissionActivitiesRead, models.PermissionActivitiesWrite,
+				models.PermissionContactsRead, models.PermissionDealsRead)
+			status, response := serve(t, engine, tt.method, tt.path, tt.body)
+			if status != tt.status || errorMessage(response) != tt.message {
+				t.Errorf("got %d %q, want %d %q", status, errorMessage(response), tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestActivityControllerTimeline(t *testing.T) {
+	engine := protectedEngine(activityControllers(), models.PermissionContactsRead, models.PermissionActivitiesRead)
+
+	status, response := serve(t, engine, http.MethodGet, "/contacts/1/timeline", nil)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %v", status, response)
+	}
+	entries, _ := response["data"].([]interface{})
+	if len(entries) != 2 {
+		t.Fatalf("timeline = %v, want the call and the stage change", response["data"])
+	}
+
+	call, change := entries[0].(map[string]interface{}), entries[1].(map[string]interface{})
+	if activity, _ := call["activity"].(map[string]interface{}); call["type"] != "activity" || activity["subject"] != "Intro call" {
+		t.Errorf("first entry = %v, want the call", call)
+	}
+	if _, ok := call["stage_change"]; ok {
+		t.Errorf("activity entry has a stage change: %v", call)
+	}
+	stageChange, _ := change["stage_change"].(map[string]interface{})
+	if change["type"] != "stage_change" || stageChange["deal_id"] != float64(1) || stageChange["deal_title"] != "Big sale" {
+		t.Errorf("second entry = %v, want the stage change of deal 1", change)
+	}
+	if meta, _ := response["meta"].(map[string]interface{}); meta["total_rows"] != float64(2) {
+		t.Errorf("meta = %v, want a total of 2", response["meta"])
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type assignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// AdminController handles administrative user operations
+type AdminController struct {
+	authService    *services.AuthService
+	authzService   *services.AuthorizationService
+	lockoutService *services.LockoutService
+	logger         *zap.SugaredLogger
+}
+
+// NewAdminController creates a new admin controller
+func NewAdminController(
+	authService *services.AuthService,
+	authzService *services.AuthorizationService,
+	lockoutService *services.LockoutService,
+	logger *zap.SugaredLogger,
+) *AdminController {
+	return &AdminController{
+		authService:    authService,
+		authzService:   authzService,
+		lockoutService: lockoutService,
+		logger:         logger,
+	}
+}
+
+// ForceLogout revokes every access and refresh token of the given user
+func (ctrl *AdminController) ForceLogout(c *gin.Context) {
+	userID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.authService.ForceLogout(c.Request.Context(), userID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	ctrl.logger.Infow("User force-logged out by admin",
+		"user_id", userID,
+		"admin_id", c.GetString("user_id"),
+	)
+	c.Status(http.StatusNoContent)
+}
+
+// Unlock lifts the sign-in lockout of a member of the current organization
+func (ctrl *AdminController) Unlock(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.lockoutService.Unlock(c.Request.Context(), adminID, userID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AssignRole changes the role of a member of the current organization. The new
+// permissions apply to the member's existing tokens as well. Only roles granting
+// nothing beyond the caller's permissions can be assigned.
+func (ctrl *AdminController) AssignRole(c *gin.Context) {
+	assignerID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req assignRoleRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	membership, err := ctrl.authzService.AssignRoleAs(c.Request.Context(), assignerID, userID, req.Role)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newMemberResponse(membership))
+}
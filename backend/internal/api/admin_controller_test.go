@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"go.uber.org/zap"
+)
+
+func TestAssignRoleCannotEscalatePrivileges(t *testing.T) {
+	const (
+		admin   = 1
+		manager = 2 // holds users:manage through a custom role, without being admin
+		member  = 3
+	)
+
+	tests := []struct {
+		name     string
+		assigner int
+		userID   int
+		role     string
+		status   int
+	}{
+		{"manager makes themselves admin", manager, manager, models.RoleAdmin, http.StatusForbidden},
+		{"manager makes a member admin", manager, member, models.RoleAdmin, http.StatusForbidden},
+		{"manager demotes an admin", manager, admin, models.RoleUser, http.StatusForbidden},
+		{"manager assigns a role within their permissions", manager, member, "manager", http.StatusOK},
+		{"manager demotes themselves", manager, manager, models.RoleUser, http.StatusOK},
+		{"admin makes a manager admin", admin, manager, models.RoleAdmin, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := repotest.NewUsers(
+				models.User{ID: admin, Email: "admin@example.com"},
+				models.User{ID: manager, Email: "manager@example.com"},
+				models.User{ID: member, Email: "member@example.com"},
+			)
+			organizations := repotest.NewOrganizations(users,
+				models.Membership{OrganizationID: testOrganizationID, UserID: admin, Role: models.RoleAdmin},
+				models.Membership{OrganizationID: testOrganizationID, UserID: manager, Role: "manager"},
+				models.Membership{OrganizationID: testOrganizationID, UserID: member, Role: models.RoleUser},
+			)
+			roles := repotest.NewRoles(organizations,
+				repotest.Role(models.RoleAdmin, models.PermissionUsersManage, models.PermissionRolesManage, models.PermissionContactsRead),
+				repotest.CustomRole(testOrganizationID, "manager", models.PermissionUsersManage, models.PermissionContactsRead),
+				repotest.Role(models.RoleUser, models.PermissionContactsRead),
+			)
+			ctx := tenant.WithOrganization(context.Background(), testOrganizationID)
+			previous, err := organizations.FindMember(ctx, tt.userID)
+			if err != nil {
+				t.Fatalf("FindMember: %v", err)
+			}
+			authz := services.NewAuthorizationService(roles, organizations, zap.NewNop().Sugar())
+			ctrl := NewAdminController(nil, authz, nil, zap.NewNop().Sugar())
+
+			engine := testEngine(tt.assigner)
+			engine.PUT("/admin/users/:id/role", ctrl.AssignRole)
+			status, response := serve(t, engine, http.MethodPut, fmt.Sprintf("/admin/users/%d/role", tt.userID),
+				map[string]string{"role": tt.role})
+
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d: %v", status, tt.status, response)
+			}
+			want := tt.role
+			if tt.status != http.StatusOK {
+				want = previous.Role
+			}
+			if membership, _ := organizations.FindMember(ctx, tt.userID); membership.Role != want {
+				t.Errorf("role = %q, want %q", membership.Role, want)
+			}
+		})
+	}
+}
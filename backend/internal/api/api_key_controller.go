@@ -0,0 +1,140 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"` // permission names
+	ExpiresAt *time.Time `json:"expires_at"`                      // never expires when omitted
+}
+
+type apiKeyResponse struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// createdAPIKeyResponse is returned once when a key is created. The key
+// itself is not stored and cannot be retrieved again.
+type createdAPIKeyResponse struct {
+	apiKeyResponse
+	Key string `json:"key"`
+}
+
+func newAPIKeyResponse(key *models.APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+func newAPIKeyListResponse(keys []models.APIKey) []apiKeyResponse {
+	response := make([]apiKeyResponse, len(keys))
+	for i := range keys {
+		response[i] = newAPIKeyResponse(&keys[i])
+	}
+	return response
+}
+
+func newCreatedAPIKeyResponse(created *services.CreatedAPIKey) createdAPIKeyResponse {
+	return createdAPIKeyResponse{
+		apiKeyResponse: newAPIKeyResponse(created.Key),
+		Key:            created.Secret,
+	}
+}
+
+func (req createAPIKeyRequest) input() services.APIKeyInput {
+	return services.APIKeyInput{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+}
+
+// APIKeyController handles the personal API keys of the current user
+type APIKeyController struct {
+	apiKeyService *services.APIKeyService
+	logger        *zap.SugaredLogger
+}
+
+// NewAPIKeyController creates a new API key controller
+func NewAPIKeyController(apiKeyService *services.APIKeyService, logger *zap.SugaredLogger) *APIKeyController {
+	return &APIKeyController{
+		apiKeyService: apiKeyService,
+		logger:        logger,
+	}
+}
+
+// List returns the current user's API keys in the active organization
+func (ctrl *APIKeyController) List(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	keys, err := ctrl.apiKeyService.List(c.Request.Context(), userID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newAPIKeyListResponse(keys))
+}
+
+// Create issues an API key acting as the current user in the active organization
+func (ctrl *APIKeyController) Create(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req createAPIKeyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	created, err := ctrl.apiKeyService.Create(c.Request.Context(), userID, userID, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newCreatedAPIKeyResponse(created))
+}
+
+// Revoke revokes one of the current user's API keys
+func (ctrl *APIKeyController) Revoke(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.apiKeyService.Revoke(c.Request.Context(), userID, id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
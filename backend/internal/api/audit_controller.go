@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type auditEventQuery struct {
+	Action  string `form:"action"`
+	ActorID int    `form:"actor_id" binding:"omitempty,min=1"`
+}
+
+type auditEventResponse struct {
+	ID         int                    `json:"id"`
+	ActorID    *int                   `json:"actor_id"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type,omitempty"`
+	TargetID   *int                   `json:"target_id"`
+	IPAddress  string                 `json:"ip_address"`
+	UserAgent  string                 `json:"user_agent"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+func newAuditEventResponse(event *models.AuditEvent) auditEventResponse {
+	return auditEventResponse{
+		ID:         event.ID,
+		ActorID:    event.ActorID,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		IPAddress:  event.IPAddress,
+		UserAgent:  event.UserAgent,
+		Details:    event.Details,
+		CreatedAt:  event.CreatedAt,
+	}
+}
+
+// AuditController exposes the audit log of the current organization
+type AuditController struct {
+	auditService *services.AuditService
+	logger       *zap.SugaredLogger
+}
+
+// NewAuditController creates a new audit controller
+func NewAuditController(auditService *services.AuditService, logger *zap.SugaredLogger) *AuditController {
+	return &AuditController{
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+// List returns a page of the current organization's audit events, newest first
+func (ctrl *AuditController) List(c *gin.Context) {
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	var query auditEventQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(middleware.NewBadRequestError("Invalid query", err.Error()))
+		return
+	}
+
+	events, total, err := ctrl.auditService.List(c.Request.Context(), repository.AuditFilter{
+		Action:  query.Action,
+		ActorID: query.ActorID,
+	}, page, pageSize)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := make([]auditEventResponse, len(events))
+	for i := range events {
+		response[i] = newAuditEventResponse(&events[i])
+	}
+	utils.PaginationResponse(c, http.StatusOK, response, page, pageSize, int(total))
+}
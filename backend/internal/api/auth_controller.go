@@ -0,0 +1,280 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type registerRequest struct {
+	Email        string `json:"email" binding:"required,email"`
+	Password     string `json:"password" binding:"required,min=8,max=72"`
+	BusinessName string `json:"business_name" binding:"max=255"`
+}
+
+type loginRequest struct {
+	Email          string `json:"email" binding:"required,email"`
+	Password       string `json:"password" binding:"required"`
+	OrganizationID int    `json:"organization_id" binding:"omitempty,min=1"` // defaults to the user's oldest organization
+}
+
+type switchOrganizationRequest struct {
+	OrganizationID int `json:"organization_id" binding:"required,min=1"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type mfaVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"` // TOTP or recovery code
+}
+
+type mfaEnrollRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+type userResponse struct {
+	ID             int    `json:"id"`
+	Email          string `json:"email"`
+	EmailVerified  bool   `json:"email_verified"`
+	BusinessName   string `json:"business_name"`
+	ServiceAccount bool   `json:"service_account"`
+}
+
+type authResponse struct {
+	User           userResponse `json:"user"`
+	OrganizationID int          `json:"organization_id"`
+	Role           string       `json:"role"`
+	AccessToken    string       `json:"access_token"`
+	RefreshToken   string       `json:"refresh_token"`
+	TokenType      string       `json:"token_type"`
+	ExpiresIn      int64        `json:"expires_in"`
+}
+
+// mfaChallengeResponse is returned instead of tokens when a second factor is needed
+type mfaChallengeResponse struct {
+	MFARequired        bool   `json:"mfa_required"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	MFAToken           string `json:"mfa_token"`
+	ExpiresIn          int64  `json:"expires_in"`
+}
+
+// newUserResponse maps a user to its public representation, leaving out the password hash
+func newUserResponse(user *models.User) userResponse {
+	return userResponse{
+		ID:             user.ID,
+		Email:          user.Email,
+		EmailVerified:  user.EmailVerified(),
+		BusinessName:   user.BuisnessName,
+		ServiceAccount: user.ServiceAccount,
+	}
+}
+
+func newAuthResponse(user *models.User, tokens *services.TokenPair) authResponse {
+	return authResponse{
+		User:           newUserResponse(user),
+		OrganizationID: tokens.OrganizationID,
+		Role:           tokens.Role,
+		AccessToken:    tokens.AccessToken,
+		RefreshToken:   tokens.RefreshToken,
+		TokenType:      "Bearer",
+		ExpiresIn:      tokens.ExpiresIn,
+	}
+}
+
+// respondAuthResult writes the tokens of a completed sign-in, or the MFA
+// challenge the user must pass first
+func respondAuthResult(c *gin.Context, result *services.AuthResult) {
+	if result.Challenge != nil {
+		utils.SuccessResponse(c, http.StatusOK, mfaChallengeResponse{
+			MFARequired:        true,
+			EnrollmentRequired: result.Challenge.EnrollmentRequired,
+			MFAToken:           result.Challenge.Token,
+			ExpiresIn:          result.Challenge.ExpiresIn,
+		})
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, newAuthResponse(result.User, result.Tokens))
+}
+
+// AuthController handles registration, login, token refresh and logout
+type AuthController struct {
+	authService    *services.AuthService
+	accountService *services.AccountService
+	logger         *zap.SugaredLogger
+}
+
+// NewAuthController creates a new authentication controller
+func NewAuthController(authService *services.AuthService, accountService *services.AccountService, logger *zap.SugaredLogger) *AuthController {
+	return &AuthController{
+		authService:    authService,
+		accountService: accountService,
+		logger:         logger,
+	}
+}
+
+// Register creates a new user account and emails a link to verify its address
+func (ctrl *AuthController) Register(c *gin.Context) {
+	var req registerRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, tokens, err := ctrl.authService.Register(c.Request.Context(), services.RegisterInput{
+		Email:        req.Email,
+		Password:     req.Password,
+		BusinessName: req.BusinessName,
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	// the account exists either way; the user can ask for another email
+	if err := ctrl.accountService.SendEmailVerification(c.Request.Context(), user); err != nil {
+		ctrl.logger.Errorw("Failed to send verification email", "user_id", user.ID, "error", err)
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newAuthResponse(user, tokens))
+}
+
+// Login authenticates a user with email and password. Users with MFA receive
+// a challenge to complete at /auth/mfa/verify instead of tokens.
+func (ctrl *AuthController) Login(c *gin.Context) {
+	var req loginRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	result, err := ctrl.authService.Login(c.Request.Context(), req.Email, req.Password, req.OrganizationID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	respondAuthResult(c, result)
+}
+
+// VerifyMFA completes a sign-in with a TOTP or recovery code
+func (ctrl *AuthController) VerifyMFA(c *gin.Context) {
+	var req mfaVerifyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	result, err := ctrl.authService.VerifyMFA(c.Request.Context(), req.MFAToken, req.Code)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	respondAuthResult(c, result)
+}
+
+// BeginMFAEnrollment starts authenticator enrollment during sign-in
+func (ctrl *AuthController) BeginMFAEnrollment(c *gin.Context) {
+	var req mfaEnrollRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	enrollment, err := ctrl.authService.BeginMFAEnrollment(c.Request.Context(), req.MFAToken)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newTOTPEnrollmentResponse(enrollment))
+}
+
+// ConfirmMFAEnrollment activates the authenticator enrolled during sign-in and completes the sign-in
+func (ctrl *AuthController) ConfirmMFAEnrollment(c *gin.Context) {
+	var req mfaVerifyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	result, recoveryCodes, err := ctrl.authService.ConfirmMFAEnrollment(c.Request.Context(), req.MFAToken, req.Code)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, enrolledAuthResponse{
+		authResponse:  newAuthResponse(result.User, result.Tokens),
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// SwitchOrganization issues a token pair acting in another organization of the current user
+func (ctrl *AuthController) SwitchOrganization(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req switchOrganizationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	result, err := ctrl.authService.SwitchOrganization(c.Request.Context(), userID, req.OrganizationID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	respondAuthResult(c, result)
+}
+
+// Refresh exchanges a refresh token for a new token pair
+func (ctrl *AuthController) Refresh(c *gin.Context) {
+	var req refreshRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, tokens, err := ctrl.authService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newAuthResponse(user, tokens))
+}
+
+// Logout revokes the refresh token family the given token belongs to
+func (ctrl *AuthController) Logout(c *gin.Context) {
+	var req refreshRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := ctrl.authService.Logout(c.Request.Context(), req.RefreshToken); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// LogoutEverywhere revokes all refresh tokens of the current user
+func (ctrl *AuthController) LogoutEverywhere(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.authService.LogoutEverywhere(c.Request.Context(), userID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type companyQuery struct {
+	Search   string `form:"q"`
+	Industry string `form:"industry"`
+	OwnerID  int    `form:"owner_id" binding:"omitempty,min=1"`
+	Tag      string `form:"tag"`
+	Segment  int    `form:"segment" binding:"omitempty,min=1"`
+	Sort     string `form:"sort"` // checked by listFilters
+}
+
+type companyRequest struct {
+	Name         string                 `json:"name" binding:"required,max=255"`
+	Domain       string                 `json:"domain" binding:"omitempty,fqdn,max=255"`
+	Industry     string                 `json:"industry" binding:"max=100"`
+	Size         string                 `json:"size" binding:"omitempty,oneof=1-10 11-50 51-200 201-500 501-1000 1001-5000 5001+"`
+	Address      addressRequest         `json:"address"`
+	OwnerID      *int                   `json:"owner_id" binding:"omitempty,min=1"` // defaults to the creator on create
+	Tags         []string               `json:"tags" binding:"max=50,dive,max=100"`
+	CustomFields map[string]interface{} `json:"custom_fields"` // values by custom field key
+}
+
+type linkContactRequest struct {
+	Role string `json:"role" binding:"max=100"` // such as "decision maker"
+}
+
+type companyResponse struct {
+	ID           int                      `json:"id"`
+	Name         string                   `json:"name"`
+	Domain       string                   `json:"domain"`
+	Industry     string                   `json:"industry"`
+	Size         string                   `json:"size"`
+	Address      addressResponse          `json:"address"`
+	OwnerID      *int                     `json:"owner_id"`
+	Owner        *userResponse            `json:"owner,omitempty"`
+	Tags         []string                 `json:"tags"`
+	CustomFields models.CustomFieldValues `json:"custom_fields"`
+	Counts       *companyCountsResponse   `json:"counts,omitempty"` // only on single companies
+	CreatedAt    time.Time                `json:"created_at"`
+	UpdatedAt    time.Time                `json:"updated_at"`
+}
+
+type companyCountsResponse struct {
+	Contacts         int64 `json:"contacts"`
+	OpenDeals        int64 `json:"open_deals"`
+	RecentActivities int64 `json:"recent_activities"` // in the last 30 days
+}
+
+// companyContactResponse describes a contact linked to a company
+type companyContactResponse struct {
+	ContactID int       `json:"contact_id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	JobTitle  string    `json:"job_title"`
+	Email     string    `json:"email"` // the contact's primary email address
+	Role      string    `json:"role"`
+	LinkedAt  time.Time `json:"linked_at"`
+}
+
+func (req companyRequest) input() services.CompanyInput {
+	return services.CompanyInput{
+		Name:         req.Name,
+		Domain:       req.Domain,
+		Industry:     req.Industry,
+		Size:         req.Size,
+		Address:      req.Address.address(),
+		OwnerID:      req.OwnerID,
+		Tags:         req.Tags,
+		CustomFields: req.CustomFields,
+	}
+}
+
+func newCompanyResponse(company *models.Company) companyResponse {
+	response := companyResponse{
+		ID:           company.ID,
+		Name:         company.Name,
+		Domain:       company.Domain,
+		Industry:     company.Industry,
+		Size:         company.Size,
+		Address:      newAddressResponse(company.Address),
+		OwnerID:      company.OwnerID,
+		Tags:         company.TagNames(),
+		CustomFields: newCustomValuesResponse(company.CustomFields),
+		CreatedAt:    company.CreatedAt,
+		UpdatedAt:    company.UpdatedAt,
+	}
+	if company.Owner != nil {
+		owner := newUserResponse(company.Owner)
+		response.Owner = &owner
+	}
+	return response
+}
+
+func newCompanyDetailsResponse(details *services.CompanyDetails) companyResponse {
+	response := newCompanyResponse(details.Company)
+	response.Counts = &companyCountsResponse{
+		Contacts:         details.Stats.Contacts,
+		OpenDeals:        details.Stats.OpenDeals,
+		RecentActivities: details.Stats.RecentActivities,
+	}
+	return response
+}
+
+func newCompanyListResponse(companies []models.Company) []companyResponse {
+	response := make([]companyResponse, len(companies))
+	for i := range companies {
+		response[i] = newCompanyResponse(&companies[i])
+	}
+	return response
+}
+
+func newCompanyContactListResponse(links []models.CompanyContact) []companyContactResponse {
+	response := make([]companyContactResponse, len(links))
+	for i, link := range links {
+		response[i] = companyContactResponse{
+			ContactID: link.ContactID,
+			FirstName: link.Contact.FirstName,
+			LastName:  link.Contact.LastName,
+			JobTitle:  link.Contact.JobTitle,
+			Email:     link.Contact.PrimaryEmail(),
+			Role:      link.Role,
+			LinkedAt:  link.CreatedAt,
+		}
+	}
+	return response
+}
+
+// CompanyController handles the companies of the current organization
+type CompanyController struct {
+	companyService *services.CompanyService
+	logger         *zap.SugaredLogger
+}
+
+// NewCompanyController creates a new company controller
+func NewCompanyController(companyService *services.CompanyService, logger *zap.SugaredLogger) *CompanyController {
+	return &CompanyController{
+		companyService: companyService,
+		logger:         logger,
+	}
+}
+
+// List returns a page of companies, filtered and sorted by the query
+func (ctrl *CompanyController) List(c *gin.Context) {
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	var query companyQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(middleware.NewBadRequestError("Invalid query", err.Error()))
+		return
+	}
+	conditions, ok := customFieldConditions(c)
+	if !ok {
+		return
+	}
+	filters, ok := listFilters(c, repository.CompanyFields, true)
+	if !ok {
+		return
+	}
+
+	companies, total, err := ctrl.companyService.List(c.Request.Context(), repository.CompanyFilter{
+		Search:       query.Search,
+		Industry:     query.Industry,
+		OwnerID:      query.OwnerID,
+		Tag:          query.Tag,
+		Sort:         query.Sort,
+		CustomFields: conditions,
+		Segment:      query.Segment,
+		Filters:      filters,
+	}, page, pageSize)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.PaginationResponse(c, http.StatusOK, newCompanyListResponse(companies), page, pageSize, int(total))
+}
+
+// Create adds a company
+func (ctrl *CompanyController) Create(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req companyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	details, err := ctrl.companyService.Create(c.Request.Context(), userID, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newCompanyDetailsResponse(details))
+}
+
+// Get returns a single company with counts of its related records
+func (ctrl *CompanyController) Get(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	details, err := ctrl.companyService.Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newCompanyDetailsResponse(details))
+}
+
+// Update replaces a company's details
+func (ctrl *CompanyController) Update(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req companyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	details, err := ctrl.companyService.Update(c.Request.Context(), id, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newCompanyDetailsResponse(details))
+}
+
+// Delete removes a company
+func (ctrl *CompanyController) Delete(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.companyService.Delete(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListContacts returns the contacts linked to a company with their roles
+func (ctrl *CompanyController) ListContacts(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	links, err := ctrl.companyService.ListContacts(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newCompanyContactListResponse(links))
+}
+
+// LinkContact links a contact to a company, or changes their role there
+func (ctrl *CompanyController) LinkContact(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	contactID, ok := pathID(c, "contactId")
+	if !ok {
+		return
+	}
+
+	var req linkContactRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := ctrl.companyService.LinkContact(c.Request.Context(), id, contactID, req.Role); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UnlinkContact removes a contact from a company
+func (ctrl *CompanyController) UnlinkContact(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	contactID, ok := pathID(c, "contactId")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.companyService.UnlinkContact(c.Request.Context(), id, contactID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
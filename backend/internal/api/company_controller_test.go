@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// companyControllers returns controllers serving company 1, with contact 1
+// linked to it, open deal 1 and a recent call, and contacts 1 and 2
+func companyControllers() *controllers {
+	owned := models.TenantOwned{OrganizationID: testOrganizationID}
+	contacts := repotest.NewContacts(
+		models.Contact{ID: 1, TenantOwned: owned, FirstName: "Ada"},
+		models.Contact{ID: 2, TenantOwned: owned, FirstName: "Grace"},
+	)
+	companies := repotest.NewCompanies(contacts, models.Company{ID: 1, TenantOwned: owned, Name: "Acme"})
+	ctx := tenant.WithOrganization(context.Background(), testOrganizationID)
+	if err := companies.LinkContact(ctx, &models.CompanyContact{CompanyID: 1, ContactID: 1, Role: "champion"}); err != nil {
+		panic(err)
+	}
+	company := 1
+	repotest.NewDeals(companies,
+		models.Deal{ID: 1, TenantOwned: owned, Title: "Big sale", Status: models.DealOpen, CompanyID: &company},
+		models.Deal{ID: 2, TenantOwned: owned, Title: "Lost sale", Status: models.DealLost, CompanyID: &company},
+	)
+	repotest.NewActivities(companies,
+		models.Activity{ID: 1, TenantOwned: owned, Type: models.ActivityCall, RecordType: models.RecordCompany, RecordID: 1, OccurredAt: time.Now()},
+		models.Activity{ID: 2, TenantOwned: owned, Type: models.ActivityCall, RecordType: models.RecordCompany, RecordID: 1, OccurredAt: time.Now().AddDate(-1, 0, 0)},
+	)
+	_, organizations := testMembers()
+	service := services.NewCompanyService(companies, contacts, organizations, repotest.NewCustomFields(), nil, zap.NewNop().Sugar())
+	return &controllers{companies: NewCompanyController(service, zap.NewNop().Sugar())}
+}
+
+func TestCompanyRoutesRequirePermissions(t *testing.T) {
+	read := []string{models.PermissionCompaniesRead}
+	write := []string{models.PermissionCompaniesWrite}
+	company := map[string]interface{}{"name": "Acme"}
+	role := map[string]interface{}{"role": "decision maker"}
+
+	checkRoutePermissions(t, companyControllers, []protectedRoute{
+		{http.MethodGet, "/companies", nil, read, http.StatusOK},
+		{http.MethodGet, "/companies/1", nil, read, http.StatusOK},
+		{http.MethodPost, "/companies", company, write, http.StatusCreated},
+		{http.MethodPut, "/companies/1", company, write, http.StatusOK},
+		{http.MethodDelete, "/companies/1", nil, write, http.StatusNoContent},
+		{http.MethodGet, "/companies/1/contacts", nil, []string{models.PermissionCompaniesRead, models.PermissionContactsRead}, http.StatusOK},
+		{http.MethodPut, "/companies/1/contacts/2", role, []string{models.PermissionCompaniesWrite, models.PermissionContactsRead}, http.StatusNoContent},
+		{http.MethodDelete, "/companies/1/contacts/1", nil, write, http.StatusNoContent},
+	})
+}
+
+func TestCompanyControllerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    interface{}
+		status  int
+		message string
+	}{
+		{"missing name", http.MethodPost, "/companies", map[string]interface{}{"domain": "acme.example"}, http.StatusBadRequest, "Invalid request body"},
+		{"invalid domain", http.MethodPost, "/companies", map[string]interface{}{"name": "Acme", "domain": "not a domain"}, http.StatusBadRequest, "Invalid request body"},
+		{"unknown size", http.MethodPost, "/companies", map[string]interface{}{"name": "Acme", "size": "lots"}, http.StatusBadRequest, "Invalid request body"},
+		{"owner outside the organization", http.MethodPut, "/companies/1", map[string]interface{}{
+			"name": "Acme", "owner_id": 9,
+		}, http.StatusBadRequest, services.ErrInvalidOwner.Error()},
+		{"missing company", http.MethodGet, "/companies/9", nil, http.StatusNotFound, "Resource not found"},
+		{"contacts of a missing company", http.MethodGet, "/companies/9/contacts", nil, http.StatusNotFound, "Resource not found"},
+		{"link to a missing company", http.MethodPut, "/companies/9/contacts/1", map[string]interface{}{}, http.StatusNotFound, "Resource not found"},
+		{"link of a missing contact", http.MethodPut, "/companies/1/contacts/9", map[string]interface{}{}, http.StatusNotFound, "Resource not found"},
+		{"invalid contact ID", http.MethodPut, "/companies/1/contacts/abc", map[string]interface{}{}, http.StatusBadRequest, "Invalid contactId"},
+		{"role too long", http.MethodPut, "/companies/1/contacts/1", map[string]interface{}{"role": strings.Repeat("x", 101)}, http.StatusBadRequest, "Invalid request body"},
+		{"unknown sort", http.MethodGet, "/companies?sort=domain", nil, http.StatusBadRequest, "Invalid query"},
+		{"invalid filter", http.MethodGet, "/companies?filter[size][gt]=large", nil, http.StatusBadRequest, "Invalid query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := protectedEngine(companyControllers(),
+				models.PermissionCompaniesRead, models.PermissionCompaniesWrite, models.PermissionContactsRead)
+			status, response := serve(t, engine, tt.method, tt.path, tt.body)
+			if status != tt.status || errorMessage(response) != tt.message {
+				t.Errorf("got %d %q, want %d %q", status, errorMessage(response), tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestCompanyControllerGetIncludesCounts(t *testing.T) {
+	engine := protectedEngine(companyControllers(), models.PermissionCompaniesRead, models.PermissionContactsRead)
+
+	status, response := serve(t, engine, http.MethodGet, "/companies/1", nil)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %v", status, response)
+	}
+	counts, _ := responseData(response)["counts"].(map[string]interface{})
+	if counts["contacts"] != float64(1) || counts["open_deals"] != float64(1) || counts["recent_activities"] != float64(1) {
+		t.Errorf("counts = %v", counts)
+	}
+
+	// listings leave the counts out
+	status, response = serve(t, engine, http.MethodGet, "/companies", nil)
+	if status != http.StatusOK {
+		t.Fatalf("list status = %d: %v", status, response)
+	}
+	companies, _ := response["data"].([]interface{})
+	if len(companies) != 1 {
+		t.Fatalf("companies = %v", response["data"])
+	}
+	if _, ok := companies[0].(map[string]interface{})["counts"]; ok {
+		t.Error("listed company has counts")
+	}
+
+	status, response = serve(t, engine, http.MethodGet, "/companies/1/contacts", nil)
+	if status != http.StatusOK {
+		t.Fatalf("contacts status = %d: %v", status, response)
+	}
+	links, _ := response["data"].([]interface{})
+	if len(links) != 1 || links[0].(map[string]interface{})["role"] != "champion" {
+		t.Errorf("contacts = %v", response["data"])
+	}
+}
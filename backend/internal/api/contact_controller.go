@@ -0,0 +1,313 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type contactQuery struct {
+	Search    string `form:"q"`
+	OwnerID   int    `form:"owner_id" binding:"omitempty,min=1"`
+	CompanyID int    `form:"company_id" binding:"omitempty,min=1"`
+	Tag       string `form:"tag"`
+	Segment   int    `form:"segment" binding:"omitempty,min=1"`
+	Sort      string `form:"sort"` // checked by listFilters
+}
+
+type contactEmailRequest struct {
+	Email   string `json:"email" binding:"required,email,max=255"`
+	Label   string `json:"label" binding:"max=50"`
+	Primary bool   `json:"primary"`
+}
+
+type contactPhoneRequest struct {
+	Number  string `json:"number" binding:"required,max=50"`
+	Label   string `json:"label" binding:"max=50"`
+	Primary bool   `json:"primary"`
+}
+
+type addressRequest struct {
+	Street     string `json:"street" binding:"max=255"`
+	City       string `json:"city" binding:"max=100"`
+	Region     string `json:"region" binding:"max=100"`
+	PostalCode string `json:"postal_code" binding:"max=20"`
+	Country    string `json:"country" binding:"max=100"`
+}
+
+type contactRequest struct {
+	FirstName    string                 `json:"first_name" binding:"required,max=100"`
+	LastName     string                 `json:"last_name" binding:"max=100"`
+	JobTitle     string                 `json:"job_title" binding:"max=255"`
+	Emails       []contactEmailRequest  `json:"emails" binding:"max=20,dive"`
+	Phones       []contactPhoneRequest  `json:"phones" binding:"max=20,dive"`
+	Address      addressRequest         `json:"address"`
+	OwnerID      *int                   `json:"owner_id" binding:"omitempty,min=1"` // defaults to the creator on create
+	Tags         []string               `json:"tags" binding:"max=50,dive,max=100"`
+	CustomFields map[string]interface{} `json:"custom_fields"` // values by custom field key
+}
+
+type contactEmailResponse struct {
+	Email   string `json:"email"`
+	Label   string `json:"label"`
+	Primary bool   `json:"primary"`
+}
+
+type contactPhoneResponse struct {
+	Number  string `json:"number"`
+	Label   string `json:"label"`
+	Primary bool   `json:"primary"`
+}
+
+type addressResponse struct {
+	Street     string `json:"street"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+}
+
+// contactCompanyResponse describes a company a contact is linked to
+type contactCompanyResponse struct {
+	CompanyID int    `json:"company_id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+}
+
+type contactResponse struct {
+	ID           int                      `json:"id"`
+	FirstName    string                   `json:"first_name"`
+	LastName     string                   `json:"last_name"`
+	JobTitle     string                   `json:"job_title"`
+	Emails       []contactEmailResponse   `json:"emails"`
+	Phones       []contactPhoneResponse   `json:"phones"`
+	Address      addressResponse          `json:"address"`
+	OwnerID      *int                     `json:"owner_id"`
+	Owner        *userResponse            `json:"owner,omitempty"`
+	Companies    []contactCompanyResponse `json:"companies"`
+	Tags         []string                 `json:"tags"`
+	CustomFields models.CustomFieldValues `json:"custom_fields"`
+	CreatedAt    time.Time                `json:"created_at"`
+	UpdatedAt    time.Time                `json:"updated_at"`
+}
+
+func (req addressRequest) address() models.Address {
+	return models.Address{
+		Street:     req.Street,
+		City:       req.City,
+		Region:     req.Region,
+		PostalCode: req.PostalCode,
+		Country:    req.Country,
+	}
+}
+
+func (req contactRequest) input() services.ContactInput {
+	emails := make([]models.ContactEmail, len(req.Emails))
+	for i, email := range req.Emails {
+		emails[i] = models.ContactEmail{Email: email.Email, Label: email.Label, IsPrimary: email.Primary}
+	}
+	phones := make([]models.ContactPhone, len(req.Phones))
+	for i, phone := range req.Phones {
+		phones[i] = models.ContactPhone{Number: phone.Number, Label: phone.Label, IsPrimary: phone.Primary}
+	}
+	return services.ContactInput{
+		FirstName:    req.FirstName,
+		LastName:     req.LastName,
+		JobTitle:     req.JobTitle,
+		Emails:       emails,
+		Phones:       phones,
+		Address:      req.Address.address(),
+		OwnerID:      req.OwnerID,
+		Tags:         req.Tags,
+		CustomFields: req.CustomFields,
+	}
+}
+
+func newAddressResponse(address models.Address) addressResponse {
+	return addressResponse{
+		Street:     address.Street,
+		City:       address.City,
+		Region:     address.Region,
+		PostalCode: address.PostalCode,
+		Country:    address.Country,
+	}
+}
+
+func newContactResponse(contact *models.Contact) contactResponse {
+	emails := make([]contactEmailResponse, len(contact.Emails))
+	for i, email := range contact.Emails {
+		emails[i] = contactEmailResponse{Email: email.Email, Label: email.Label, Primary: email.IsPrimary}
+	}
+	phones := make([]contactPhoneResponse, len(contact.Phones))
+	for i, phone := range contact.Phones {
+		phones[i] = contactPhoneResponse{Number: phone.Number, Label: phone.Label, Primary: phone.IsPrimary}
+	}
+	companies := make([]contactCompanyResponse, len(contact.Companies))
+	for i, link := range contact.Companies {
+		companies[i] = contactCompanyResponse{CompanyID: link.CompanyID, Role: link.Role}
+		if link.Company != nil {
+			companies[i].Name = link.Company.Name
+		}
+	}
+	response := contactResponse{
+		ID:           contact.ID,
+		FirstName:    contact.FirstName,
+		LastName:     contact.LastName,
+		JobTitle:     contact.JobTitle,
+		Emails:       emails,
+		Phones:       phones,
+		Address:      newAddressResponse(contact.Address),
+		OwnerID:      contact.OwnerID,
+		Companies:    companies,
+		Tags:         contact.TagNames(),
+		CustomFields: newCustomValuesResponse(contact.CustomFields),
+		CreatedAt:    contact.CreatedAt,
+		UpdatedAt:    contact.UpdatedAt,
+	}
+	if contact.Owner != nil {
+		owner := newUserResponse(contact.Owner)
+		response.Owner = &owner
+	}
+	return response
+}
+
+func newContactListResponse(contacts []models.Contact) []contactResponse {
+	response := make([]contactResponse, len(contacts))
+	for i := range contacts {
+		response[i] = newContactResponse(&contacts[i])
+	}
+	return response
+}
+
+// ContactController handles the contacts of the current organization
+type ContactController struct {
+	contactService *services.ContactService
+	logger         *zap.SugaredLogger
+}
+
+// NewContactController creates a new contact controller
+func NewContactController(contactService *services.ContactService, logger *zap.SugaredLogger) *ContactController {
+	return &ContactController{
+		contactService: contactService,
+		logger:         logger,
+	}
+}
+
+// List returns a page of contacts, filtered and sorted by the query
+func (ctrl *ContactController) List(c *gin.Context) {
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	var query contactQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(middleware.NewBadRequestError("Invalid query", err.Error()))
+		return
+	}
+	conditions, ok := customFieldConditions(c)
+	if !ok {
+		return
+	}
+	filters, ok := listFilters(c, repository.ContactFields, true)
+	if !ok {
+		return
+	}
+
+	contacts, total, err := ctrl.contactService.List(c.Request.Context(), repository.ContactFilter{
+		Search:       query.Search,
+		OwnerID:      query.OwnerID,
+		CompanyID:    query.CompanyID,
+		Tag:          query.Tag,
+		Sort:         query.Sort,
+		CustomFields: conditions,
+		Segment:      query.Segment,
+		Filters:      filters,
+	}, page, pageSize)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.PaginationResponse(c, http.StatusOK, newContactListResponse(contacts), page, pageSize, int(total))
+}
+
+// Create adds a contact
+func (ctrl *ContactController) Create(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req contactRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	contact, err := ctrl.contactService.Create(c.Request.Context(), userID, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newContactResponse(contact))
+}
+
+// Get returns a single contact
+func (ctrl *ContactController) Get(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	contact, err := ctrl.contactService.Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newContactResponse(contact))
+}
+
+// Update replaces a contact's details
+func (ctrl *ContactController) Update(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req contactRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	contact, err := ctrl.contactService.Update(c.Request.Context(), id, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newContactResponse(contact))
+}
+
+// Delete removes a contact
+func (ctrl *ContactController) Delete(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.contactService.Delete(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
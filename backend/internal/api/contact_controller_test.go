@@ -0,0 +1,154 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"go.uber.org/zap"
+)
+
+// contactControllers returns controllers serving contacts 1 and 2
+func contactControllers() *controllers {
+	contacts := repotest.NewContacts(
+		models.Contact{ID: 1, TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID}, FirstName: "Ada"},
+		models.Contact{ID: 2, TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID}, FirstName: "Grace"},
+	)
+	_, organizations := testMembers()
+	service := services.NewContactService(contacts, organizations, repotest.NewCustomFields(), nil, zap.NewNop().Sugar())
+	return &controllers{contacts: NewContactController(service, zap.NewNop().Sugar())}
+}
+
+func TestContactRoutesRequirePermissions(t *testing.T) {
+	read := []string{models.PermissionContactsRead}
+	write := []string{models.PermissionContactsWrite}
+	contact := map[string]interface{}{"first_name": "Ada"}
+
+	checkRoutePermissions(t, contactControllers, []protectedRoute{
+		{http.MethodGet, "/contacts", nil, read, http.StatusOK},
+		{http.MethodGet, "/contacts/1", nil, read, http.StatusOK},
+		{http.MethodPost, "/contacts", contact, write, http.StatusCreated},
+		{http.MethodPut, "/contacts/1", contact, write, http.StatusOK},
+		{http.MethodDelete, "/contacts/1", nil, write, http.StatusNoContent},
+	})
+}
+
+func TestContactControllerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    interface{}
+		status  int
+		message string
+	}{
+		{"missing first name", http.MethodPost, "/contacts", map[string]interface{}{"last_name": "Lovelace"}, http.StatusBadRequest, "Invalid request body"},
+		{"invalid email", http.MethodPost, "/contacts", map[string]interface{}{
+			"first_name": "Ada", "emails": []map[string]interface{}{{"email": "not an email"}},
+		}, http.StatusBadRequest, "Invalid request body"},
+		{"owner outside the organization", http.MethodPost, "/contacts", map[string]interface{}{
+			"first_name": "Ada", "owner_id": 9,
+		}, http.StatusBadRequest, services.ErrInvalidOwner.Error()},
+		{"invalid ID", http.MethodGet, "/contacts/abc", nil, http.StatusBadRequest, "Invalid id"},
+		{"missing contact", http.MethodGet, "/contacts/9", nil, http.StatusNotFound, "Resource not found"},
+		{"update of a missing contact", http.MethodPut, "/contacts/9", map[string]interface{}{"first_name": "Ada"}, http.StatusNotFound, "Resource not found"},
+		{"delete of a missing contact", http.MethodDelete, "/contacts/9", nil, http.StatusNotFound, "Resource not found"},
+		{"invalid page", http.MethodGet, "/contacts?page=-1", nil, http.StatusBadRequest, "Invalid pagination"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := protectedEngine(contactControllers(), models.PermissionContactsRead, models.PermissionContactsWrite)
+			status, response := serve(t, engine, tt.method, tt.path, tt.body)
+			if status != tt.status || errorMessage(response) != tt.message {
+				t.Errorf("got %d %q, want %d %q", status, errorMessage(response), tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestContactControllerListQueryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		details map[string]interface{}
+	}{
+		{"unknown sort", "/contacts?sort=password", map[string]interface{}{"sort": `cannot sort by "password"`}},
+		{"unsortable field", "/contacts?sort=first_name,-job_title", map[string]interface{}{"sort": `cannot sort by "job_title"`}},
+		{"invalid filters", "/contacts?filter[owner_id][gte]=me&filter[password]=x&sort=-last_name", map[string]interface{}{
+			"filter[owner_id][gte]": "must be a whole number",
+			"filter[password]":      `unknown field "password"`,
+		}},
+		{"invalid filter and sort", "/contacts?filter[email][between]=a&sort=email", map[string]interface{}{
+			"filter[email][between]": `unknown operator "between"`,
+			"sort":                   `cannot sort by "email"`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := protectedEngine(contactControllers(), models.PermissionContactsRead)
+			status, response := serve(t, engine, http.MethodGet, tt.path, nil)
+			if status != http.StatusBadRequest || errorMessage(response) != "Invalid query" {
+				t.Fatalf("got %d %q, want %d %q", status, errorMessage(response), http.StatusBadRequest, "Invalid query")
+			}
+			if details := errorDetails(response); !reflect.DeepEqual(details, tt.details) {
+				t.Errorf("details = %v, want %v", details, tt.details)
+			}
+		})
+	}
+}
+
+func TestContactControllerListSorts(t *testing.T) {
+	owned := models.TenantOwned{OrganizationID: testOrganizationID}
+	contacts := repotest.NewContacts(models.Contact{ID: 1, TenantOwned: owned, FirstName: "Ada"})
+	fields := repotest.NewCustomFields(models.CustomField{
+		ID: 1, OrganizationID: testOrganizationID, RecordType: models.RecordContact, Key: "tier", Label: "Tier",
+		Type: models.CustomFieldSelect, Options: []string{"gold"},
+	})
+	_, organizations := testMembers()
+	service := services.NewContactService(contacts, organizations, fields, nil, zap.NewNop().Sugar())
+	engine := protectedEngine(&controllers{contacts: NewContactController(service, zap.NewNop().Sugar())}, models.PermissionContactsRead)
+
+	// sorts by custom fields are left to the service
+	for _, path := range []string{"/contacts?sort=-last_name,first_name", "/contacts?sort=-cf.tier", "/contacts?sort=last_name,-cf.tier,-created_at"} {
+		status, response := serve(t, engine, http.MethodGet, path, nil)
+		if data, _ := response["data"].([]interface{}); status != http.StatusOK || len(data) != 1 {
+			t.Errorf("%s: got %d %v, want the contact", path, status, response)
+		}
+	}
+
+	// while the other sorts are still checked
+	status, response := serve(t, engine, http.MethodGet, "/contacts?sort=-cf.tier,nickname", nil)
+	if status != http.StatusBadRequest || errorMessage(response) != "Invalid query" {
+		t.Errorf("got %d %v, want an invalid query", status, response)
+	}
+}
+
+func TestContactControllerCreate(t *testing.T) {
+	engine := protectedEngine(contactControllers(), models.PermissionContactsWrite)
+	status, response := serve(t, engine, http.MethodPost, "/contacts", map[string]interface{}{
+		"first_name": "Ada",
+		"emails":     []map[string]interface{}{{"email": "Ada@Example.com", "label": "work"}},
+		"tags":       []string{"VIP"},
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("status = %d: %v", status, response)
+	}
+
+	data := responseData(response)
+	if data["owner_id"] != float64(testUserID) {
+		t.Errorf("owner_id = %v, want the creator", data["owner_id"])
+	}
+	emails, _ := data["emails"].([]interface{})
+	if len(emails) != 1 {
+		t.Fatalf("emails = %v", data["emails"])
+	}
+	if email := emails[0].(map[string]interface{}); email["email"] != "ada@example.com" || email["primary"] != true {
+		t.Errorf("email = %v, want the lower-cased address as primary", email)
+	}
+	if tags, _ := data["tags"].([]interface{}); len(tags) != 1 || tags[0] != "vip" {
+		t.Errorf("tags = %v, want [vip]", data["tags"])
+	}
+}
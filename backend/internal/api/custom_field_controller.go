@@ -0,0 +1,203 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type customFieldQuery struct {
+	RecordType string `form:"record_type" binding:"omitempty,oneof=contact company deal"`
+}
+
+type customFieldRequest struct {
+	Label    string   `json:"label" binding:"required,max=100"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options" binding:"max=100,dive,max=100"` // the choices of select fields
+	Min      *float64 `json:"min"`                                    // the minimum number, length or number of choices
+	Max      *float64 `json:"max"`                                    // the maximum number, length or number of choices
+	Pattern  string   `json:"pattern" binding:"max=255"`              // a regular expression text values must match
+	Position int      `json:"position" binding:"min=0"`
+}
+
+type createCustomFieldRequest struct {
+	customFieldRequest
+	RecordType string `json:"record_type" binding:"required,oneof=contact company deal"`
+	Key        string `json:"key" binding:"required,max=64"` // such as "renewal_date"
+	Type       string `json:"type" binding:"required,oneof=text number date select multi_select boolean url"`
+}
+
+type customFieldResponse struct {
+	ID         int       `json:"id"`
+	RecordType string    `json:"record_type"`
+	Key        string    `json:"key"`
+	Label      string    `json:"label"`
+	Type       string    `json:"type"`
+	Required   bool      `json:"required"`
+	Options    []string  `json:"options"`
+	Min        *float64  `json:"min"`
+	Max        *float64  `json:"max"`
+	Pattern    string    `json:"pattern"`
+	Position   int       `json:"position"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (req customFieldRequest) input() services.CustomFieldInput {
+	return services.CustomFieldInput{
+		Label:    req.Label,
+		Required: req.Required,
+		Options:  req.Options,
+		Min:      req.Min,
+		Max:      req.Max,
+		Pattern:  req.Pattern,
+		Position: req.Position,
+	}
+}
+
+func newCustomFieldResponse(field *models.CustomField) customFieldResponse {
+	options := field.Options
+	if options == nil {
+		options = []string{}
+	}
+	return customFieldResponse{
+		ID:         field.ID,
+		RecordType: field.RecordType,
+		Key:        field.Key,
+		Label:      field.Label,
+		Type:       field.Type,
+		Required:   field.Required,
+		Options:    options,
+		Min:        field.Min,
+		Max:        field.Max,
+		Pattern:    field.Pattern,
+		Position:   field.Position,
+		CreatedAt:  field.CreatedAt,
+		UpdatedAt:  field.UpdatedAt,
+	}
+}
+
+func newCustomFieldListResponse(fields []models.CustomField) []customFieldResponse {
+	response := make([]customFieldResponse, len(fields))
+	for i := range fields {
+		response[i] = newCustomFieldResponse(&fields[i])
+	}
+	return response
+}
+
+// newCustomValuesResponse returns the custom field values of a record,
+// never nil so that they render as an object
+func newCustomValuesResponse(values models.CustomFieldValues) models.CustomFieldValues {
+	if values == nil {
+		return models.CustomFieldValues{}
+	}
+	return values
+}
+
+// CustomFieldController handles the custom fields the current organization
+// defines on its contacts, companies and deals
+type CustomFieldController struct {
+	customFieldService *services.CustomFieldService
+	logger             *zap.SugaredLogger
+}
+
+// NewCustomFieldController creates a new custom field controller
+func NewCustomFieldController(customFieldService *services.CustomFieldService, logger *zap.SugaredLogger) *CustomFieldController {
+	return &CustomFieldController{
+		customFieldService: customFieldService,
+		logger:             logger,
+	}
+}
+
+// List returns the custom fields, optionally of one record type
+func (ctrl *CustomFieldController) List(c *gin.Context) {
+	var query customFieldQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(middleware.NewBadRequestError("Invalid query", err.Error()))
+		return
+	}
+
+	fields, err := ctrl.customFieldService.List(c.Request.Context(), query.RecordType)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newCustomFieldListResponse(fields))
+}
+
+// Create defines a custom field
+func (ctrl *CustomFieldController) Create(c *gin.Context) {
+	var req createCustomFieldRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	input := req.input()
+	input.RecordType, input.Key, input.Type = req.RecordType, req.Key, req.Type
+	field, err := ctrl.customFieldService.Create(c.Request.Context(), input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newCustomFieldResponse(field))
+}
+
+// Get returns a single custom field
+func (ctrl *CustomFieldController) Get(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	field, err := ctrl.customFieldService.Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newCustomFieldResponse(field))
+}
+
+// Update replaces a custom field's label and rules
+func (ctrl *CustomFieldController) Update(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req customFieldRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	field, err := ctrl.customFieldService.Update(c.Request.Context(), id, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newCustomFieldResponse(field))
+}
+
+// Delete removes a custom field and its values
+func (ctrl *CustomFieldController) Delete(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.customFieldService.Delete(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"go.uber.org/zap"
+)
+
+// customFieldControllers returns controllers serving contact 1 and the
+// contact fields tier, a select, and score, a number
+func customFieldControllers() *controllers {
+	owned := models.TenantOwned{OrganizationID: testOrganizationID}
+	fields := repotest.NewCustomFields(
+		models.CustomField{ID: 1, OrganizationID: testOrganizationID, RecordType: models.RecordContact, Key: "tier", Label: "Tier",
+			Type: models.CustomFieldSelect, Options: []string{"gold", "silver"}},
+		models.CustomField{ID: 2, OrganizationID: testOrganizationID, RecordType: models.RecordContact, Key: "score", Label: "Score",
+			Type: models.CustomFieldNumber},
+	)
+	contacts := repotest.NewContacts(models.Contact{ID: 1, TenantOwned: owned, FirstName: "Ada"})
+	_, organizations := testMembers()
+	logger := zap.NewNop().Sugar()
+	return &controllers{
+		customFields: NewCustomFieldController(services.NewCustomFieldService(fields, logger), logger),
+		contacts:     NewContactController(services.NewContactService(contacts, organizations, fields, nil, logger), logger),
+	}
+}
+
+// errorDetails returns the details of an error response
+func errorDetails(response map[string]interface{}) interface{} {
+	errorData, _ := response["error"].(map[string]interface{})
+	return errorData["details"]
+}
+
+func TestCustomFieldRoutesRequirePermissions(t *testing.T) {
+	manage := []string{models.PermissionFieldsManage}
+	field := map[string]interface{}{"label": "Tier", "options": []string{"gold", "silver", "bronze"}}
+	newField := map[string]interface{}{"record_type": "deal", "key": "renewal_date", "label": "Renewal date", "type": "date"}
+
+	checkRoutePermissions(t, customFieldControllers, []protectedRoute{
+		// every member reads the fields, to fill them in
+		{http.MethodGet, "/custom-fields", nil, nil, http.StatusOK},
+		{http.MethodGet, "/custom-fields/1", nil, nil, http.StatusOK},
+		{http.MethodPost, "/custom-fields", newField, manage, http.StatusCreated},
+		{http.MethodPut, "/custom-fields/1", field, manage, http.StatusOK},
+		{http.MethodDelete, "/custom-fields/1", nil, manage, http.StatusNoContent},
+	})
+}
+
+func TestCustomFieldControllerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    interface{}
+		status  int
+		message string
+	}{
+		{"unknown type", http.MethodPost, "/custom-fields", map[string]interface{}{
+			"record_type": "contact", "key": "mood", "label": "Mood", "type": "emoji",
+		}, http.StatusBadRequest, "Invalid request body"},
+		{"unknown record type", http.MethodPost, "/custom-fields", map[string]interface{}{
+			"record_type": "task", "key": "mood", "label": "Mood", "type": "text",
+		}, http.StatusBadRequest, "Invalid request body"},
+		{"invalid key", http.MethodPost, "/custom-fields", map[string]interface{}{
+			"record_type": "contact", "key": "Mood", "label": "Mood", "type": "text",
+		}, http.StatusBadRequest, "invalid custom field: keys must start with a lowercase letter followed by lowercase letters, digits or underscores"},
+		{"select without options", http.MethodPost, "/custom-fields", map[string]interface{}{
+			"record_type": "contact", "key": "mood", "label": "Mood", "type": "select",
+		}, http.StatusBadRequest, "invalid custom field: select fields need options"},
+		{"taken key", http.MethodPost, "/custom-fields", map[string]interface{}{
+			"record_type": "contact", "key": "tier", "label": "Tier", "type": "text",
+		}, http.StatusConflict, services.ErrCustomFieldExists.Error()},
+		{"options on a number", http.MethodPut, "/custom-fields/2", map[string]interface{}{"label": "Score", "options": []string{"1"}},
+			http.StatusBadRequest, "invalid custom field: only select fields have options"},
+		{"missing field", http.MethodGet, "/custom-fields/9", nil, http.StatusNotFound, "Resource not found"},
+		{"delete of a missing field", http.MethodDelete, "/custom-fields/9", nil, http.StatusNotFound, "Resource not found"},
+		{"listing of an unknown record type", http.MethodGet, "/custom-fields?record_type=task", nil, http.StatusBadRequest, "Invalid query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := protectedEngine(customFieldControllers(), models.PermissionFieldsManage)
+			status, response := serve(t, engine, tt.method, tt.path, tt.body)
+			if status != tt.status || errorMessage(response) != tt.message {
+				t.Errorf("got %d %q, want %d %q", status, errorMessage(response), tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestCustomFieldValuesErrorDetails(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    interface{}
+		details map[string]interface{}
+	}{
+		{"invalid values", http.MethodPost, "/contacts", map[string]interface{}{
+			"first_name": "Ada", "custom_fields": map[string]interface{}{"tier": "bronze", "score": "high", "mood": "happy"},
+		}, map[string]interface{}{
+			"tier": "must be one of gold, silver", "score": "must be a number", "mood": "is not a custom field",
+		}},
+		{"invalid conditions", http.MethodGet, "/contacts?cf[score][gte]=high&cf[tier][lte]=gold", nil, map[string]interface{}{
+			"score": "must be compared with a number", "tier": "only numbers and dates can be compared with lte",
+		}},
+		{"sort on an unknown field", http.MethodGet, "/contacts?sort=-cf.mood", nil, map[string]interface{}{
+			"mood": "is not a custom field",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := protectedEngine(customFieldControllers(), models.PermissionContactsRead, models.PermissionContactsWrite)
+			status, response := serve(t, engine, tt.method, tt.path, tt.body)
+			if status != http.StatusBadRequest || errorMessage(response) != services.ErrInvalidCustomValues.Error() {
+				t.Fatalf("got %d %q, want %d %q", status, errorMessage(response), http.StatusBadRequest, services.ErrInvalidCustomValues)
+			}
+			if details := errorDetails(response); !reflect.DeepEqual(details, tt.details) {
+				t.Errorf("details = %v, want %v", details, tt.details)
+			}
+		})
+	}
+}
+
+func TestCustomFieldControllerCreate(t *testing.T) {
+	engine := protectedEngine(customFieldControllers(), models.PermissionFieldsManage, models.PermissionContactsWrite)
+
+	status, response := serve(t, engine, http.MethodPost, "/custom-fields", map[string]interface{}{
+		"record_type": "contact", "key": "topics", "label": "Topics", "type": "multi_select", "options": []string{"a", "b"}, "max": 1,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("status = %d: %v", status, response)
+	}
+	if data := responseData(response); data["key"] != "topics" || data["max"] != float64(1) {
+		t.Errorf("field = %v", data)
+	}
+
+	// the new field is checked on contacts straight away
+	status, response = serve(t, engine, http.MethodPost, "/contacts", map[string]interface{}{
+		"first_name": "Ada", "custom_fields": map[string]interface{}{"topics": []string{"a", "b"}},
+	})
+	if status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %v", status, http.StatusBadRequest, response)
+	}
+	if details, _ := errorDetails(response).(map[string]interface{}); details["topics"] != "must have at most 1 choices" {
+		t.Errorf("details = %v", errorDetails(response))
+	}
+}
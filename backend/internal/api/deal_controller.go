@@ -0,0 +1,443 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// dateLayout is the format of calendar dates in requests and responses
+const dateLayout = "2006-01-02"
+
+type dealQuery struct {
+	Search     string `form:"q"`
+	PipelineID int    `form:"pipeline_id" binding:"omitempty,min=1"`
+	StageID    int    `form:"stage_id" binding:"omitempty,min=1"`
+	Status     string `form:"status" binding:"omitempty,oneof=open won lost"`
+	OwnerID    int    `form:"owner_id" binding:"omitempty,min=1"`
+	CompanyID  int    `form:"company_id" binding:"omitempty,min=1"`
+	ContactID  int    `form:"contact_id" binding:"omitempty,min=1"`
+	Tag        string `form:"tag"`
+	Segment    int    `form:"segment" binding:"omitempty,min=1"`
+	Sort       string `form:"sort"` // checked by listFilters
+}
+
+type dealRequest struct {
+	Title             string                 `json:"title" binding:"required,max=255"`
+	Amount            float64                `json:"amount" binding:"min=0,max=9999999999999"`
+	Currency          string                 `json:"currency" binding:"required,iso4217"` // such as "USD"
+	ExpectedCloseDate string                 `json:"expected_close_date" binding:"omitempty,datetime=2006-01-02"`
+	OwnerID           *int                   `json:"owner_id" binding:"omitempty,min=1"` // defaults to the creator on create
+	CompanyID         *int                   `json:"company_id" binding:"omitempty,min=1"`
+	ContactIDs        []int                  `json:"contact_ids" binding:"max=50,dive,min=1"`
+	Tags              []string               `json:"tags" binding:"max=50,dive,max=100"`
+	CustomFields      map[string]interface{} `json:"custom_fields"` // values by custom field key
+}
+
+type createDealRequest struct {
+	dealRequest
+	PipelineID int `json:"pipeline_id" binding:"required,min=1"`
+	StageID    int `json:"stage_id" binding:"omitempty,min=1"` // defaults to the pipeline's first stage
+}
+
+type moveDealRequest struct {
+	StageID int `json:"stage_id" binding:"required,min=1"`
+}
+
+type winDealRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+type loseDealRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// dealStageResponse describes the stage a deal is in
+type dealStageResponse struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Probability int    `json:"probability"`
+}
+
+// dealCompanyResponse describes the company of a deal
+type dealCompanyResponse struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// dealContactResponse describes a contact linked to a deal
+type dealContactResponse struct {
+	ContactID int    `json:"contact_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+type dealResponse struct {
+	ID                int                      `json:"id"`
+	Title             string                   `json:"title"`
+	Amount            float64                  `json:"amount"`
+	Currency          string                   `json:"currency"`
+	Status            string                   `json:"status"`
+	PipelineID        int                      `json:"pipeline_id"`
+	Stage             dealStageResponse        `json:"stage"`
+	ExpectedCloseDate *string                  `json:"expected_close_date"`
+	OwnerID           *int                     `json:"owner_id"`
+	Owner             *userResponse            `json:"owner,omitempty"`
+	Company           *dealCompanyResponse     `json:"company"`
+	Contacts          []dealContactResponse    `json:"contacts"`
+	Tags              []string                 `json:"tags"`
+	CustomFields      models.CustomFieldValues `json:"custom_fields"`
+	CloseReason       string                   `json:"close_reason"`
+	StageChangedAt    time.Time                `json:"stage_changed_at"`
+	ClosedAt          *time.Time               `json:"closed_at"`
+	CreatedAt         time.Time                `json:"created_at"`
+	UpdatedAt         time.Time                `json:"updated_at"`
+}
+
+// dealStageChangeResponse describes a transition of a deal. Time in the
+// previous stage is in seconds.
+type dealStageChangeResponse struct {
+	FromStageID         *int      `json:"from_stage_id"`
+	ToStageID           int       `json:"to_stage_id"`
+	Status              string    `json:"status"`
+	Reason              string    `json:"reason"`
+	ChangedByID         *int      `json:"changed_by_id"`
+	TimeInPreviousStage int64     `json:"time_in_previous_stage"`
+	ChangedAt           time.Time `json:"changed_at"`
+}
+
+func (req dealRequest) input() services.DealInput {
+	input := services.DealInput{
+		Title:        req.Title,
+		Amount:       req.Amount,
+		Currency:     req.Currency,
+		OwnerID:      req.OwnerID,
+		CompanyID:    req.CompanyID,
+		ContactIDs:   req.ContactIDs,
+		Tags:         req.Tags,
+		CustomFields: req.CustomFields,
+	}
+	if date, err := time.Parse(dateLayout, req.ExpectedCloseDate); err == nil {
+		input.ExpectedCloseDate = &date
+	}
+	return input
+}
+
+func newDealResponse(deal *models.Deal) dealResponse {
+	contacts := make([]dealContactResponse, len(deal.Contacts))
+	for i, link := range deal.Contacts {
+		contacts[i] = dealContactResponse{ContactID: link.ContactID}
+		if link.Contact != nil {
+			contacts[i].FirstName, contacts[i].LastName = link.Contact.FirstName, link.Contact.LastName
+		}
+	}
+	response := dealResponse{
+		ID:             deal.ID,
+		Title:          deal.Title,
+		Amount:         deal.Amount,
+		Currency:       deal.Currency,
+		Status:         deal.Status,
+		PipelineID:     deal.PipelineID,
+		Stage:          dealStageResponse{ID: deal.StageID},
+		OwnerID:        deal.OwnerID,
+		Contacts:       contacts,
+		Tags:           deal.TagNames(),
+		CustomFields:   newCustomValuesResponse(deal.CustomFields),
+		CloseReason:    deal.CloseReason,
+		StageChangedAt: deal.StageChangedAt,
+		ClosedAt:       deal.ClosedAt,
+		CreatedAt:      deal.CreatedAt,
+		UpdatedAt:      deal.UpdatedAt,
+	}
+	if deal.Stage != nil {
+		response.Stage.Name, response.Stage.Probability = deal.Stage.Name, deal.Stage.Probability
+	}
+	if deal.ExpectedCloseDate != nil {
+		date := deal.ExpectedCloseDate.Format(dateLayout)
+		response.ExpectedCloseDate = &date
+	}
+	if deal.Owner != nil {
+		owner := newUserResponse(deal.Owner)
+		response.Owner = &owner
+	}
+	if deal.Company != nil {
+		response.Company = &dealCompanyResponse{ID: deal.Company.ID, Name: deal.Company.Name}
+	}
+	return response
+}
+
+func newDealListResponse(deals []models.Deal) []dealResponse {
+	response := make([]dealResponse, len(deals))
+	for i := range deals {
+		response[i] = newDealResponse(&deals[i])
+	}
+	return response
+}
+
+func newDealStageChangeResponse(change *models.DealStageChange) dealStageChangeResponse {
+	return dealStageChangeResponse{
+		FromStageID:         change.FromStageID,
+		ToStageID:           change.ToStageID,
+		Status:              change.Status,
+		Reason:              change.Reason,
+		ChangedByID:         change.ChangedByID,
+		TimeInPreviousStage: int64(change.TimeInPreviousStage.Seconds()),
+		ChangedAt:           change.CreatedAt,
+	}
+}
+
+func newDealStageChangeListResponse(changes []models.DealStageChange) []dealStageChangeResponse {
+	response := make([]dealStageChangeResponse, len(changes))
+	for i := range changes {
+		response[i] = newDealStageChangeResponse(&changes[i])
+	}
+	return response
+}
+
+// DealController handles the deals of the current organization
+type DealController struct {
+	dealService *services.DealService
+	logger      *zap.SugaredLogger
+}
+
+// NewDealController creates a new deal controller
+func NewDealController(dealService *services.DealService, logger *zap.SugaredLogger) *DealController {
+	return &DealController{
+		dealService: dealService,
+		logger:      logger,
+	}
+}
+
+// List returns a page of deals, filtered and sorted by the query
+func (ctrl *DealController) List(c *gin.Context) {
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	var query dealQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(middleware.NewBadRequestError("Invalid query", err.Error()))
+		return
+	}
+	conditions, ok := customFieldConditions(c)
+	if !ok {
+		return
+	}
+	filters, ok := listFilters(c, repository.DealFields, true)
+	if !ok {
+		return
+	}
+
+	deals, total, err := ctrl.dealService.List(c.Request.Context(), repository.DealFilter{
+		Search:       query.Search,
+		PipelineID:   query.PipelineID,
+		StageID:      query.StageID,
+		Status:       query.Status,
+		OwnerID:      query.OwnerID,
+		CompanyID:    query.CompanyID,
+		ContactID:    query.ContactID,
+		Tag:          query.Tag,
+		Sort:         query.Sort,
+		CustomFields: conditions,
+		Segment:      query.Segment,
+		Filters:      filters,
+	}, page, pageSize)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.PaginationResponse(c, http.StatusOK, newDealListResponse(deals), page, pageSize, int(total))
+}
+
+// Create adds a deal to a pipeline
+func (ctrl *DealController) Create(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req createDealRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	deal, err := ctrl.dealService.Create(c.Request.Context(), userID, req.PipelineID, req.StageID, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newDealResponse(deal))
+}
+
+// Get returns a single deal
+func (ctrl *DealController) Get(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	deal, err := ctrl.dealService.Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newDealResponse(deal))
+}
+
+// Update replaces a deal's details, leaving its stage and status untouched
+func (ctrl *DealController) Update(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req dealRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	deal, err := ctrl.dealService.Update(c.Request.Context(), id, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newDealResponse(deal))
+}
+
+// Delete removes a deal
+func (ctrl *DealController) Delete(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.dealService.Delete(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Move moves an open deal to another stage
+func (ctrl *DealController) Move(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req moveDealRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	deal, err := ctrl.dealService.Move(c.Request.Context(), userID, id, req.StageID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newDealResponse(deal))
+}
+
+// Win marks an open deal as won
+func (ctrl *DealController) Win(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req winDealRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	deal, err := ctrl.dealService.Win(c.Request.Context(), userID, id, req.Reason)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newDealResponse(deal))
+}
+
+// Lose marks an open deal as lost
+func (ctrl *DealController) Lose(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req loseDealRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	deal, err := ctrl.dealService.Lose(c.Request.Context(), userID, id, req.Reason)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newDealResponse(deal))
+}
+
+// Reopen puts a won or lost deal back in its stage
+func (ctrl *DealController) Reopen(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	deal, err := ctrl.dealService.Reopen(c.Request.Context(), userID, id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newDealResponse(deal))
+}
+
+// History returns the stage changes of a deal with the time spent in each stage
+func (ctrl *DealController) History(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	changes, err := ctrl.dealService.History(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newDealStageChangeListResponse(changes))
+}
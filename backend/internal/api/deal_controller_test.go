@@ -0,0 +1,113 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+)
+
+func TestDealRoutesRequirePermissions(t *testing.T) {
+	read := []string{models.PermissionDealsRead}
+	write := []string{models.PermissionDealsWrite}
+	deal := map[string]interface{}{"title": "Big sale", "currency": "USD"}
+	newDeal := map[string]interface{}{"title": "Upsell", "currency": "USD", "pipeline_id": 1}
+
+	// the controllers of pipelineControllers serve the deals as well
+	checkRoutePermissions(t, pipelineControllers, []protectedRoute{
+		{http.MethodGet, "/deals", nil, read, http.StatusOK},
+		{http.MethodGet, "/deals/1", nil, read, http.StatusOK},
+		{http.MethodPost, "/deals", newDeal, write, http.StatusCreated},
+		{http.MethodPut, "/deals/1", deal, write, http.StatusOK},
+		{http.MethodDelete, "/deals/1", nil, write, http.StatusNoContent},
+		{http.MethodPut, "/deals/1/stage", map[string]interface{}{"stage_id": 2}, write, http.StatusOK},
+		{http.MethodPost, "/deals/1/won", map[string]interface{}{}, write, http.StatusOK},
+		{http.MethodPost, "/deals/1/lost", map[string]interface{}{"reason": "Budget"}, write, http.StatusOK},
+		{http.MethodPost, "/deals/2/reopen", nil, write, http.StatusOK},
+		{http.MethodGet, "/deals/1/history", nil, read, http.StatusOK},
+	})
+}
+
+func TestDealControllerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    interface{}
+		status  int
+		message string
+	}{
+		{"missing pipeline ID", http.MethodPost, "/deals", map[string]interface{}{"title": "Deal", "currency": "USD"},
+			http.StatusBadRequest, "Invalid request body"},
+		{"unknown currency", http.MethodPost, "/deals", map[string]interface{}{"title": "Deal", "currency": "ABC", "pipeline_id": 1},
+			http.StatusBadRequest, "Invalid request body"},
+		{"invalid close date", http.MethodPost, "/deals", map[string]interface{}{
+			"title": "Deal", "currency": "USD", "pipeline_id": 1, "expected_close_date": "next week",
+		}, http.StatusBadRequest, "Invalid request body"},
+		{"missing pipeline", http.MethodPost, "/deals", map[string]interface{}{"title": "Deal", "currency": "USD", "pipeline_id": 9},
+			http.StatusBadRequest, services.ErrInvalidPipeline.Error()},
+		{"stage of another pipeline", http.MethodPost, "/deals", map[string]interface{}{
+			"title": "Deal", "currency": "USD", "pipeline_id": 1, "stage_id": 3,
+		}, http.StatusBadRequest, services.ErrInvalidStage.Error()},
+		{"missing company", http.MethodPut, "/deals/1", map[string]interface{}{"title": "Deal", "currency": "USD", "company_id": 9},
+			http.StatusBadRequest, services.ErrInvalidCompany.Error()},
+		{"missing contact", http.MethodPut, "/deals/1", map[string]interface{}{"title": "Deal", "currency": "USD", "contact_ids": []int{1, 9}},
+			http.StatusBadRequest, services.ErrInvalidContacts.Error()},
+		{"move to a missing stage", http.MethodPut, "/deals/1/stage", map[string]interface{}{"stage_id": 9},
+			http.StatusBadRequest, services.ErrInvalidStage.Error()},
+		{"move without a stage", http.MethodPut, "/deals/1/stage", map[string]interface{}{}, http.StatusBadRequest, "Invalid request body"},
+		{"move of a closed deal", http.MethodPut, "/deals/2/stage", map[string]interface{}{"stage_id": 1},
+			http.StatusConflict, services.ErrDealClosed.Error()},
+		{"win of a closed deal", http.MethodPost, "/deals/2/won", map[string]interface{}{}, http.StatusConflict, services.ErrDealClosed.Error()},
+		{"loss without a reason", http.MethodPost, "/deals/1/lost", map[string]interface{}{}, http.StatusBadRequest, "Invalid request body"},
+		{"reopen of an open deal", http.MethodPost, "/deals/1/reopen", nil, http.StatusConflict, services.ErrDealNotClosed.Error()},
+		{"history of a missing deal", http.MethodGet, "/deals/9/history", nil, http.StatusNotFound, "Resource not found"},
+		{"unknown status", http.MethodGet, "/deals?status=pending", nil, http.StatusBadRequest, "Invalid query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := protectedEngine(pipelineControllers(), models.PermissionDealsRead, models.PermissionDealsWrite)
+			status, response := serve(t, engine, tt.method, tt.path, tt.body)
+			if status != tt.status || errorMessage(response) != tt.message {
+				t.Errorf("got %d %q, want %d %q", status, errorMessage(response), tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestDealControllerRecordsHistory(t *testing.T) {
+	engine := protectedEngine(pipelineControllers(), models.PermissionDealsRead, models.PermissionDealsWrite)
+
+	status, response := serve(t, engine, http.MethodPut, "/deals/1/stage", map[string]interface{}{"stage_id": 2})
+	if status != http.StatusOK {
+		t.Fatalf("move status = %d: %v", status, response)
+	}
+	if stage, _ := responseData(response)["stage"].(map[string]interface{}); stage["id"] != float64(2) {
+		t.Errorf("stage = %v, want stage 2", responseData(response)["stage"])
+	}
+
+	status, response = serve(t, engine, http.MethodPost, "/deals/1/won", map[string]interface{}{"reason": "Signed"})
+	if status != http.StatusOK {
+		t.Fatalf("win status = %d: %v", status, response)
+	}
+	if data := responseData(response); data["status"] != models.DealWon || data["close_reason"] != "Signed" {
+		t.Errorf("won deal = %v", data)
+	}
+
+	status, response = serve(t, engine, http.MethodGet, "/deals/1/history", nil)
+	if status != http.StatusOK {
+		t.Fatalf("history status = %d: %v", status, response)
+	}
+	changes, _ := response["data"].([]interface{})
+	if len(changes) != 2 {
+		t.Fatalf("history = %v, want the move and the win", response["data"])
+	}
+	move, win := changes[0].(map[string]interface{}), changes[1].(map[string]interface{})
+	if move["from_stage_id"] != float64(1) || move["to_stage_id"] != float64(2) || move["changed_by_id"] != float64(testUserID) {
+		t.Errorf("move = %v", move)
+	}
+	if win["status"] != models.DealWon || win["reason"] != "Signed" {
+		t.Errorf("win = %v", win)
+	}
+}
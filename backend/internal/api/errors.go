@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/segment"
+)
+
+// handleError converts service errors into API errors picked up by the error handler
+func handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrEmailTaken):
+		_ = c.Error(middleware.NewConflictError(err.Error()))
+	case errors.Is(err, services.ErrInvalidCredentials),
+		errors.Is(err, services.ErrInvalidRefreshToken),
+		errors.Is(err, services.ErrRefreshTokenReused):
+		_ = c.Error(middleware.NewUnauthorizedError(err.Error()))
+	case errors.Is(err, services.ErrRoleExists),
+		errors.Is(err, services.ErrRoleInUse):
+		_ = c.Error(middleware.NewConflictError(err.Error()))
+	case errors.Is(err, services.ErrInvalidInvitation),
+		errors.Is(err, services.ErrUnknownRole),
+		errors.Is(err, services.ErrInvalidResetToken),
+		errors.Is(err, services.ErrInvalidVerificationToken):
+		_ = c.Error(middleware.NewBadRequestError(err.Error(), nil))
+	case errors.Is(err, services.ErrAlreadyMember),
+		errors.Is(err, services.ErrInvitationNotPending),
+		errors.Is(err, services.ErrLastAdmin):
+		_ = c.Error(middleware.NewConflictError(err.Error()))
+	case errors.Is(err, services.ErrLoginThrottled):
+		var throttled *services.LoginThrottledError
+		if errors.As(err, &throttled) {
+			c.Header("Retry-After", fmt.Sprintf("%.0f", math.Ceil(throttled.RetryAfter.Seconds())))
+		}
+		_ = c.Error(middleware.NewTooManyRequestsError(err.Error()))
+	case errors.Is(err, services.ErrInvalidMFAToken),
+		errors.Is(err, services.ErrInvalidMFACode):
+		_ = c.Error(middleware.NewUnauthorizedError(err.Error()))
+	case errors.Is(err, services.ErrMFAAlreadyEnabled),
+		errors.Is(err, services.ErrMFANotEnabled),
+		errors.Is(err, services.ErrMFANotEnrolling):
+		_ = c.Error(middleware.NewConflictError(err.Error()))
+	case errors.Is(err, services.ErrMFARequired):
+		_ = c.Error(middleware.NewForbiddenError(err.Error()))
+	case errors.Is(err, services.ErrNotMember):
+		_ = c.Error(middleware.NewForbiddenError(err.Error()))
+	case errors.Is(err, repository.ErrMissingTenant):
+		_ = c.Error(middleware.NewForbiddenError("No active organization"))
+	case errors.Is(err, services.ErrSystemRole),
+		errors.Is(err, services.ErrCannotAssignRole),
+		errors.Is(err, services.ErrCannotRemoveMember),
+		errors.Is(err, services.ErrPermissionNotHeld):
+		_ = c.Error(middleware.NewForbiddenError(err.Error()))
+	case errors.Is(err, services.ErrInvalidRoleName),
+		errors.Is(err, services.ErrUnknownPermission),
+		errors.Is(err, services.ErrPasswordTooLong),
+		errors.Is(err, services.ErrInvalidExpiry):
+		_ = c.Error(middleware.NewBadRequestError(err.Error(), nil))
+	case errors.Is(err, services.ErrUnknownSSOProvider):
+		_ = c.Error(middleware.NewNotFoundError(err.Error()))
+	case errors.Is(err, services.ErrInvalidSSOState):
+		_ = c.Error(middleware.NewBadRequestError(err.Error(), nil))
+	case errors.Is(err, services.ErrSSOFailed):
+		_ = c.Error(middleware.NewUnauthorizedError(err.Error()))
+	case errors.Is(err, services.ErrSSONotAuthorized):
+		_ = c.Error(middleware.NewForbiddenError(err.Error()))
+	case errors.Is(err, services.ErrSSOAccountNotLinked):
+		_ = c.Error(middleware.NewConflictError(err.Error()))
+	case errors.Is(err, services.ErrCannotImpersonate):
+		_ = c.Error(middleware.NewForbiddenError(err.Error()))
+	case errors.Is(err, services.ErrNotImpersonating):
+		_ = c.Error(middleware.NewBadRequestError(err.Error(), nil))
+	case errors.Is(err, services.ErrInvalidOwner),
+		errors.Is(err, services.ErrInvalidStages),
+		errors.Is(err, services.ErrInvalidPipeline),
+		errors.Is(err, services.ErrInvalidStage),
+		errors.Is(err, services.ErrInvalidCompany),
+		errors.Is(err, services.ErrInvalidContacts),
+		errors.Is(err, services.ErrInvalidRecord),
+		errors.Is(err, services.ErrTimelineTooDeep),
+		errors.Is(err, services.ErrInvalidAssignee),
+		errors.Is(err, services.ErrInvalidReminder),
+		errors.Is(err, services.ErrInvalidCustomField),
+		errors.Is(err, services.ErrInvalidSegment),
+		errors.Is(err, services.ErrNoTagChanges),
+		errors.Is(err, segment.ErrInvalidRules):
+		_ = c.Error(middleware.NewBadRequestError(err.Error(), nil))
+	case errors.Is(err, services.ErrInvalidCustomValues):
+		var details interface{}
+		var invalid *services.CustomValuesError
+		if errors.As(err, &invalid) {
+			details = invalid.Fields
+		}
+		_ = c.Error(middleware.NewBadRequestError(services.ErrInvalidCustomValues.Error(), details))
+	case errors.Is(err, services.ErrStageInUse),
+		errors.Is(err, services.ErrPipelineInUse),
+		errors.Is(err, services.ErrDealClosed),
+		errors.Is(err, services.ErrDealNotClosed),
+		errors.Is(err, services.ErrCustomFieldExists),
+		errors.Is(err, services.ErrSegmentExists):
+		_ = c.Error(middleware.NewConflictError(err.Error()))
+	case errors.Is(err, repository.ErrNotFound):
+		_ = c.Error(middleware.NewNotFoundError("Resource not found"))
+	default:
+		_ = c.Error(err)
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// testOrganizationID is the organization test requests are made in
+const testOrganizationID = 3
+
+// testEngine returns an engine rendering errors the way the API does, where
+// every request is made by the given user in the test organization
+func testEngine(userID int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(middleware.ErrorHandler(zap.NewNop().Sugar()), func(c *gin.Context) {
+		c.Set("user_id", strconv.Itoa(userID))
+		c.Request = c.Request.WithContext(tenant.WithOrganization(c.Request.Context(), testOrganizationID))
+		c.Next()
+	})
+	return engine
+}
+
+// serve makes a request with an optional JSON body and decodes the response
+func serve(t *testing.T, engine *gin.Engine, method, path string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decode response %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, response
+}
+
+// errorMessage returns the message of an error response
+func errorMessage(response map[string]interface{}) string {
+	errorData, _ := response["error"].(map[string]interface{})
+	message, _ := errorData["message"].(string)
+	return message
+}
+
+// testUserID is the member protected routes are requested by
+const testUserID = 1
+
+// testMembers returns the roles and members of the test organization, where
+// the test user holds a role granting the permissions
+func testMembers(permissions ...string) (*repotest.Roles, *repotest.Organizations) {
+	users := repotest.NewUsers(models.User{ID: testUserID, Email: "tester@example.com"})
+	organizations := repotest.NewOrganizations(users,
+		models.Membership{OrganizationID: testOrganizationID, UserID: testUserID, Role: "tester"},
+	)
+	roles := repotest.NewRoles(organizations, repotest.CustomRole(testOrganizationID, "tester", permissions...))
+	return roles, organizations
+}
+
+// protectedEngine serves the protected routes of the controllers to the test
+// user, who holds exactly the given permissions
+func protectedEngine(ctrls *controllers, permissions ...string) *gin.Engine {
+	roles, organizations := testMembers(permissions...)
+	ctrls.authz = services.NewAuthorizationService(roles, organizations, zap.NewNop().Sugar())
+	engine := testEngine(testUserID)
+	SetupProtectedRoutes(engine.Group(""), ctrls)
+	return engine
+}
+
+// protectedRoute is a protected route, the permissions it requires and how a
+// request from a member holding them is answered
+type protectedRoute struct {
+	method      string
+	path        string
+	body        interface{}
+	permissions []string
+	status      int
+}
+
+// checkRoutePermissions checks that every route is refused to members lacking
+// any one of its permissions and served to members holding all of them.
+// newControllers returns fresh controllers for every request.
+func checkRoutePermissions(t *testing.T, newControllers func() *controllers, routes []protectedRoute) {
+	t.Helper()
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			for i, missing := range route.permissions {
+				held := append(append([]string(nil), route.permissions[:i]...), route.permissions[i+1:]...)
+				status, response := serve(t, protectedEngine(newControllers(), held...), route.method, route.path, route.body)
+				if status != http.StatusForbidden {
+					t.Errorf("without %s: status = %d, want %d: %v", missing, status, http.StatusForbidden, response)
+				}
+			}
+
+			status, response := serve(t, protectedEngine(newControllers(), route.permissions...), route.method, route.path, route.body)
+			if status != route.status {
+				t.Errorf("status = %d, want %d: %v", status, route.status, response)
+			}
+		})
+	}
+}
+
+// responseData returns the data of a successful response
+func responseData(response map[string]interface{}) map[string]interface{} {
+	data, _ := response["data"].(map[string]interface{})
+	return data
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// impersonationResponse carries a token acting as another user. It cannot
+// be refreshed; a new impersonation has to be started once it expires.
+type impersonationResponse struct {
+	User           userResponse `json:"user"`
+	OrganizationID int          `json:"organization_id"`
+	Role           string       `json:"role"`
+	ImpersonatorID int          `json:"impersonator_id"`
+	AccessToken    string       `json:"access_token"`
+	TokenType      string       `json:"token_type"`
+	ExpiresIn      int64        `json:"expires_in"`
+}
+
+// ImpersonationController lets admins act as other members of their organization
+type ImpersonationController struct {
+	impersonationService *services.ImpersonationService
+	logger               *zap.SugaredLogger
+}
+
+// NewImpersonationController creates a new impersonation controller
+func NewImpersonationController(impersonationService *services.ImpersonationService, logger *zap.SugaredLogger) *ImpersonationController {
+	return &ImpersonationController{
+		impersonationService: impersonationService,
+		logger:               logger,
+	}
+}
+
+// Start issues a short-lived token acting as a member of the current organization
+func (ctrl *ImpersonationController) Start(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	impersonation, err := ctrl.impersonationService.Start(c.Request.Context(), adminID, userID, c.GetString("session_id"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, impersonationResponse{
+		User:           newUserResponse(impersonation.User),
+		OrganizationID: impersonation.OrganizationID,
+		Role:           impersonation.Role,
+		ImpersonatorID: adminID,
+		AccessToken:    impersonation.AccessToken,
+		TokenType:      "Bearer",
+		ExpiresIn:      impersonation.ExpiresIn,
+	})
+}
+
+// End revokes the impersonation token the request is made with
+func (ctrl *ImpersonationController) End(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	err := ctrl.impersonationService.End(c.Request.Context(), userID, c.GetString("token_id"), c.GetTime("token_expires_at"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AuditRequests is a middleware recording every request made while
+// impersonating a user in the audit log, together with its outcome
+func (ctrl *ImpersonationController) AuditRequests(c *gin.Context) {
+	c.Next()
+
+	if _, ok := c.Get("impersonator_id"); !ok {
+		return
+	}
+	userID, err := strconv.Atoi(c.GetString("user_id"))
+	if err != nil {
+		return
+	}
+	ctrl.impersonationService.RecordRequest(c.Request.Context(), userID, c.Request.Method, c.Request.URL.Path, c.Writer.Status())
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type inviteRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+type acceptInvitationRequest struct {
+	Token        string `json:"token" binding:"required"`
+	Password     string `json:"password" binding:"required,min=8,max=72"`
+	BusinessName string `json:"business_name" binding:"max=255"`
+}
+
+type declineInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type invitationResponse struct {
+	ID        int           `json:"id"`
+	Email     string        `json:"email"`
+	Role      string        `json:"role"`
+	Status    string        `json:"status"`
+	InvitedBy *userResponse `json:"invited_by,omitempty"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+func newInvitationResponse(invitation *models.Invitation) invitationResponse {
+	response := invitationResponse{
+		ID:        invitation.ID,
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		Status:    invitation.Status(),
+		ExpiresAt: invitation.ExpiresAt,
+		CreatedAt: invitation.CreatedAt,
+	}
+	if invitation.InvitedBy != nil {
+		inviter := newUserResponse(invitation.InvitedBy)
+		response.InvitedBy = &inviter
+	}
+	return response
+}
+
+// InvitationController handles invitations to join an organization
+type InvitationController struct {
+	invitationService *services.InvitationService
+	logger            *zap.SugaredLogger
+}
+
+// NewInvitationController creates a new invitation controller
+func NewInvitationController(invitationService *services.InvitationService, logger *zap.SugaredLogger) *InvitationController {
+	return &InvitationController{
+		invitationService: invitationService,
+		logger:            logger,
+	}
+}
+
+// Invite emails an invitation to join the current organization
+func (ctrl *InvitationController) Invite(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req inviteRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	invitation, err := ctrl.invitationService.Invite(c.Request.Context(), userID, services.InviteInput{
+		Email: req.Email,
+		Role:  req.Role,
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newInvitationResponse(invitation))
+}
+
+// ListPending returns the pending invitations of the current organization
+func (ctrl *InvitationController) ListPending(c *gin.Context) {
+	invitations, err := ctrl.invitationService.ListPending(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := make([]invitationResponse, len(invitations))
+	for i := range invitations {
+		response[i] = newInvitationResponse(&invitations[i])
+	}
+	utils.SuccessResponse(c, http.StatusOK, response)
+}
+
+// Revoke cancels a pending invitation
+func (ctrl *InvitationController) Revoke(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.invitationService.Revoke(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Accept joins the organization of an invitation, creating the account if needed
+func (ctrl *InvitationController) Accept(c *gin.Context) {
+	var req acceptInvitationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	result, err := ctrl.invitationService.Accept(c.Request.Context(), services.AcceptInvitationInput{
+		Token:        req.Token,
+		Password:     req.Password,
+		BusinessName: req.BusinessName,
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	respondAuthResult(c, result)
+}
+
+// Decline turns down an invitation
+func (ctrl *InvitationController) Decline(c *gin.Context) {
+	var req declineInvitationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := ctrl.invitationService.Decline(c.Request.Context(), req.Token); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type mfaCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type mfaStatusResponse struct {
+	Enabled                bool  `json:"enabled"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+type totpEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// enrolledAuthResponse completes a sign-in that enrolled an authenticator.
+// The recovery codes are only ever shown here.
+type enrolledAuthResponse struct {
+	authResponse
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func newTOTPEnrollmentResponse(enrollment *services.TOTPEnrollment) totpEnrollmentResponse {
+	return totpEnrollmentResponse{Secret: enrollment.Secret, URI: enrollment.URI}
+}
+
+// MFAController lets the current user manage their second factor
+type MFAController struct {
+	mfaService *services.MFAService
+	logger     *zap.SugaredLogger
+}
+
+// NewMFAController creates a new MFA controller
+func NewMFAController(mfaService *services.MFAService, logger *zap.SugaredLogger) *MFAController {
+	return &MFAController{
+		mfaService: mfaService,
+		logger:     logger,
+	}
+}
+
+// Status reports whether MFA is enabled for the current user
+func (ctrl *MFAController) Status(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	status, err := ctrl.mfaService.Status(c.Request.Context(), userID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, mfaStatusResponse{
+		Enabled:                status.Enabled,
+		RecoveryCodesRemaining: status.RecoveryCodesRemaining,
+	})
+}
+
+// BeginEnrollment generates a TOTP secret and otpauth URI for the current user
+func (ctrl *MFAController) BeginEnrollment(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := ctrl.mfaService.BeginEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newTOTPEnrollmentResponse(enrollment))
+}
+
+// ConfirmEnrollment activates the authenticator and returns recovery codes
+func (ctrl *MFAController) ConfirmEnrollment(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req mfaCodeRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	codes, err := ctrl.mfaService.ConfirmEnrollment(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Disable turns MFA off for the current user
+func (ctrl *MFAController) Disable(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req mfaCodeRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := ctrl.mfaService.Disable(c.Request.Context(), userID, req.Code); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+func (ctrl *MFAController) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req mfaCodeRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	codes, err := ctrl.mfaService.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type updateOrganizationRequest struct {
+	Name       *string `json:"name" binding:"omitempty,min=1,max=255"`
+	RequireMFA *bool   `json:"require_mfa"`
+}
+
+type organizationResponse struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Slug       string    `json:"slug"`
+	RequireMFA bool      `json:"require_mfa"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// membershipResponse describes one of the current user's organizations
+type membershipResponse struct {
+	Organization organizationResponse `json:"organization"`
+	Role         string               `json:"role"`
+	JoinedAt     time.Time            `json:"joined_at"`
+}
+
+// memberResponse describes a member of the current organization
+type memberResponse struct {
+	User     userResponse `json:"user"`
+	Role     string       `json:"role"`
+	JoinedAt time.Time    `json:"joined_at"`
+}
+
+func newOrganizationResponse(organization *models.Organization) organizationResponse {
+	return organizationResponse{
+		ID:         organization.ID,
+		Name:       organization.Name,
+		Slug:       organization.Slug,
+		RequireMFA: organization.RequireMFA,
+		CreatedAt:  organization.CreatedAt,
+		UpdatedAt:  organization.UpdatedAt,
+	}
+}
+
+func newMembershipResponse(membership *models.Membership) membershipResponse {
+	return membershipResponse{
+		Organization: newOrganizationResponse(membership.Organization),
+		Role:         membership.Role,
+		JoinedAt:     membership.CreatedAt,
+	}
+}
+
+func newMemberResponse(membership *models.Membership) memberResponse {
+	return memberResponse{
+		User:     newUserResponse(membership.User),
+		Role:     membership.Role,
+		JoinedAt: membership.CreatedAt,
+	}
+}
+
+// OrganizationController handles organizations and their members
+type OrganizationController struct {
+	orgService *services.OrganizationService
+	logger     *zap.SugaredLogger
+}
+
+// NewOrganizationController creates a new organization controller
+func NewOrganizationController(orgService *services.OrganizationService, logger *zap.SugaredLogger) *OrganizationController {
+	return &OrganizationController{
+		orgService: orgService,
+		logger:     logger,
+	}
+}
+
+// ListMine returns the organizations the current user is a member of
+func (ctrl *OrganizationController) ListMine(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	memberships, err := ctrl.orgService.ListForUser(c.Request.Context(), userID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := make([]membershipResponse, len(memberships))
+	for i := range memberships {
+		response[i] = newMembershipResponse(&memberships[i])
+	}
+	utils.SuccessResponse(c, http.StatusOK, response)
+}
+
+// GetCurrent returns the organization the current token acts in
+func (ctrl *OrganizationController) GetCurrent(c *gin.Context) {
+	organization, err := ctrl.orgService.Current(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newOrganizationResponse(organization))
+}
+
+// UpdateCurrent changes the settings of the current organization
+func (ctrl *OrganizationController) UpdateCurrent(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req updateOrganizationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	organization, err := ctrl.orgService.UpdateCurrent(c.Request.Context(), userID, services.OrganizationInput{
+		Name:       req.Name,
+		RequireMFA: req.RequireMFA,
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newOrganizationResponse(organization))
+}
+
+// ListMembers returns the members of the current organization with their roles
+func (ctrl *OrganizationController) ListMembers(c *gin.Context) {
+	memberships, err := ctrl.orgService.ListMembers(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := make([]memberResponse, len(memberships))
+	for i := range memberships {
+		response[i] = newMemberResponse(&memberships[i])
+	}
+	utils.SuccessResponse(c, http.StatusOK, response)
+}
+
+// RemoveMember removes a user from the current organization
+func (ctrl *OrganizationController) RemoveMember(c *gin.Context) {
+	removerID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.orgService.RemoveMember(c.Request.Context(), removerID, userID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	ctrl.logger.Infow("Member removed from organization",
+		"user_id", userID,
+		"organization_id", c.GetString("org_id"),
+		"removed_by", removerID,
+	)
+	c.Status(http.StatusNoContent)
+}
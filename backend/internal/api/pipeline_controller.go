@@ -0,0 +1,170 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type stageRequest struct {
+	ID          int    `json:"id" binding:"omitempty,min=1"` // omitted for new stages
+	Name        string `json:"name" binding:"required,max=100"`
+	Probability int    `json:"probability" binding:"min=0,max=100"`
+}
+
+type pipelineRequest struct {
+	Name   string         `json:"name" binding:"required,max=100"`
+	Stages []stageRequest `json:"stages" binding:"required,min=1,max=50,dive"` // in the order deals move through them
+}
+
+type stageResponse struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Position    int    `json:"position"`
+	Probability int    `json:"probability"`
+}
+
+type pipelineResponse struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Stages    []stageResponse `json:"stages"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func (req pipelineRequest) input() services.PipelineInput {
+	stages := make([]services.StageInput, len(req.Stages))
+	for i, stage := range req.Stages {
+		stages[i] = services.StageInput{ID: stage.ID, Name: stage.Name, Probability: stage.Probability}
+	}
+	return services.PipelineInput{Name: req.Name, Stages: stages}
+}
+
+func newStageResponse(stage *models.Stage) stageResponse {
+	return stageResponse{
+		ID:          stage.ID,
+		Name:        stage.Name,
+		Position:    stage.Position,
+		Probability: stage.Probability,
+	}
+}
+
+func newPipelineResponse(pipeline *models.Pipeline) pipelineResponse {
+	stages := make([]stageResponse, len(pipeline.Stages))
+	for i := range pipeline.Stages {
+		stages[i] = newStageResponse(&pipeline.Stages[i])
+	}
+	return pipelineResponse{
+		ID:        pipeline.ID,
+		Name:      pipeline.Name,
+		Stages:    stages,
+		CreatedAt: pipeline.CreatedAt,
+		UpdatedAt: pipeline.UpdatedAt,
+	}
+}
+
+func newPipelineListResponse(pipelines []models.Pipeline) []pipelineResponse {
+	response := make([]pipelineResponse, len(pipelines))
+	for i := range pipelines {
+		response[i] = newPipelineResponse(&pipelines[i])
+	}
+	return response
+}
+
+// PipelineController handles the sales pipelines of the current organization
+type PipelineController struct {
+	pipelineService *services.PipelineService
+	logger          *zap.SugaredLogger
+}
+
+// NewPipelineController creates a new pipeline controller
+func NewPipelineController(pipelineService *services.PipelineService, logger *zap.SugaredLogger) *PipelineController {
+	return &PipelineController{
+		pipelineService: pipelineService,
+		logger:          logger,
+	}
+}
+
+// List returns the pipelines with their stages
+func (ctrl *PipelineController) List(c *gin.Context) {
+	pipelines, err := ctrl.pipelineService.List(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newPipelineListResponse(pipelines))
+}
+
+// Create adds a pipeline with its stages
+func (ctrl *PipelineController) Create(c *gin.Context) {
+	var req pipelineRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	pipeline, err := ctrl.pipelineService.Create(c.Request.Context(), req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newPipelineResponse(pipeline))
+}
+
+// Get returns a single pipeline with its stages
+func (ctrl *PipelineController) Get(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	pipeline, err := ctrl.pipelineService.Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newPipelineResponse(pipeline))
+}
+
+// Update renames a pipeline and replaces its stages
+func (ctrl *PipelineController) Update(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req pipelineRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	pipeline, err := ctrl.pipelineService.Update(c.Request.Context(), id, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newPipelineResponse(pipeline))
+}
+
+// Delete removes a pipeline without deals
+func (ctrl *PipelineController) Delete(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.pipelineService.Delete(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
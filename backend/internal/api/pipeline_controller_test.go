@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"go.uber.org/zap"
+)
+
+// pipelineControllers returns controllers serving pipeline 1 with stages 1
+// and 2, pipeline 2 with stage 3, open deal 1 in stage 1 and lost deal 2 in
+// stage 2
+func pipelineControllers() *controllers {
+	owned := models.TenantOwned{OrganizationID: testOrganizationID}
+	pipelines := repotest.NewPipelines(
+		models.Pipeline{ID: 1, TenantOwned: owned, Name: "Sales", Stages: []models.Stage{
+			{ID: 1, Name: "Lead"},
+			{ID: 2, Name: "Proposal", Position: 1},
+		}},
+		models.Pipeline{ID: 2, TenantOwned: owned, Name: "Renewals", Stages: []models.Stage{{ID: 3, Name: "Due"}}},
+	)
+	contacts := repotest.NewContacts(models.Contact{ID: 1, TenantOwned: owned, FirstName: "Ada"})
+	companies := repotest.NewCompanies(contacts, models.Company{ID: 1, TenantOwned: owned, Name: "Acme"})
+	deals := repotest.NewDeals(companies,
+		models.Deal{ID: 1, TenantOwned: owned, Title: "Big sale", Status: models.DealOpen, PipelineID: 1, StageID: 1},
+		models.Deal{ID: 2, TenantOwned: owned, Title: "Lost sale", Status: models.DealLost, PipelineID: 1, StageID: 2, CloseReason: "Budget"},
+	)
+	_, organizations := testMembers()
+	logger := zap.NewNop().Sugar()
+
+	pipelineService := services.NewPipelineService(pipelines, deals, repotest.Transactor{}, logger)
+	dealService := services.NewDealService(deals, pipelines, companies, contacts, organizations, repotest.NewCustomFields(), nil, repotest.Transactor{}, logger)
+	return &controllers{
+		pipelines: NewPipelineController(pipelineService, logger),
+		deals:     NewDealController(dealService, logger),
+	}
+}
+
+func TestPipelineRoutesRequirePermissions(t *testing.T) {
+	read := []string{models.PermissionDealsRead}
+	write := []string{models.PermissionDealsWrite}
+	pipeline := map[string]interface{}{
+		"name":   "Sales",
+		"stages": []map[string]interface{}{{"id": 1, "name": "Lead"}, {"id": 2, "name": "Proposal"}},
+	}
+	newPipeline := map[string]interface{}{"name": "Partners", "stages": []map[string]interface{}{{"name": "Lead"}}}
+
+	checkRoutePermissions(t, pipelineControllers, []protectedRoute{
+		{http.MethodGet, "/pipelines", nil, read, http.StatusOK},
+		{http.MethodGet, "/pipelines/1", nil, read, http.StatusOK},
+		{http.MethodPost, "/pipelines", newPipeline, write, http.StatusCreated},
+		{http.MethodPut, "/pipelines/1", pipeline, write, http.StatusOK},
+		{http.MethodDelete, "/pipelines/2", nil, write, http.StatusNoContent},
+	})
+}
+
+func TestPipelineControllerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    interface{}
+		status  int
+		message string
+	}{
+		{"no stages", http.MethodPost, "/pipelines", map[string]interface{}{"name": "Sales", "stages": []interface{}{}},
+			http.StatusBadRequest, "Invalid request body"},
+		{"probability over 100", http.MethodPost, "/pipelines", map[string]interface{}{
+			"name": "Sales", "stages": []map[string]interface{}{{"name": "Lead", "probability": 101}},
+		}, http.StatusBadRequest, "Invalid request body"},
+		{"repeated stage names", http.MethodPost, "/pipelines", map[string]interface{}{
+			"name": "Sales", "stages": []map[string]interface{}{{"name": "Lead"}, {"name": "lead"}},
+		}, http.StatusBadRequest, services.ErrInvalidStages.Error()},
+		{"stage of another pipeline", http.MethodPut, "/pipelines/1", map[string]interface{}{
+			"name": "Sales", "stages": []map[string]interface{}{{"id": 3, "name": "Due"}},
+		}, http.StatusBadRequest, services.ErrInvalidStages.Error()},
+		{"removed stage with deals", http.MethodPut, "/pipelines/1", map[string]interface{}{
+			"name": "Sales", "stages": []map[string]interface{}{{"id": 2, "name": "Proposal"}},
+		}, http.StatusConflict, services.ErrStageInUse.Error()},
+		{"pipeline with deals", http.MethodDelete, "/pipelines/1", nil, http.StatusConflict, services.ErrPipelineInUse.Error()},
+		{"missing pipeline", http.MethodGet, "/pipelines/9", nil, http.StatusNotFound, "Resource not found"},
+		{"invalid ID", http.MethodDelete, "/pipelines/abc", nil, http.StatusBadRequest, "Invalid id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := protectedEngine(pipelineControllers(), models.PermissionDealsRead, models.PermissionDealsWrite)
+			status, response := serve(t, engine, tt.method, tt.path, tt.body)
+			if status != tt.status || errorMessage(response) != tt.message {
+				t.Errorf("got %d %q, want %d %q", status, errorMessage(response), tt.status, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/listquery"
+)
+
+// currentUserID returns the authenticated user's ID set by the JWT middleware
+func currentUserID(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.GetString("user_id"))
+	if err != nil {
+		_ = c.Error(middleware.NewUnauthorizedError("Invalid user in token"))
+		return 0, false
+	}
+	return userID, true
+}
+
+// bindJSON binds the request body and reports validation failures as a bad request
+func bindJSON(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		_ = c.Error(middleware.NewBadRequestError("Invalid request body", err.Error()))
+		return false
+	}
+	return true
+}
+
+// Page sizes accepted by listing endpoints
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type pageQuery struct {
+	Page     int `form:"page" binding:"omitempty,min=1"`
+	PageSize int `form:"page_size" binding:"omitempty,min=1"`
+}
+
+// pagination parses the page and page_size query parameters, applying the
+// defaults and capping the page size
+func pagination(c *gin.Context) (page, pageSize int, ok bool) {
+	var query pageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(middleware.NewBadRequestError("Invalid pagination", err.Error()))
+		return 0, 0, false
+	}
+
+	page, pageSize = query.Page, query.PageSize
+	if page == 0 {
+		page = 1
+	}
+	switch {
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+	return page, pageSize, true
+}
+
+// pathID parses a numeric path parameter
+func pathID(c *gin.Context, name string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id <= 0 {
+		_ = c.Error(middleware.NewBadRequestError("Invalid "+name, nil))
+		return 0, false
+	}
+	return id, true
+}
+
+// customFieldConditions parses the conditions on custom fields of a listing
+// query, given as cf[<key>]=<value> or cf[<key>][<op>]=<value> where op is
+// eq, gte or lte. Values are left as text for the service to convert.
+func customFieldConditions(c *gin.Context) ([]repository.CustomFieldCondition, bool) {
+	var conditions []repository.CustomFieldCondition
+	for param, values := range c.Request.URL.Query() {
+		rest, ok := strings.CutPrefix(param, "cf[")
+		if !ok {
+			continue
+		}
+		key, rest, ok := strings.Cut(rest, "]")
+		op := repository.CustomFieldEq
+		if ok && rest != "" {
+			ok = len(rest) > 2 && rest[0] == '[' && rest[len(rest)-1] == ']'
+			op = strings.TrimSuffix(strings.TrimPrefix(rest, "["), "]")
+		}
+		switch {
+		case !ok || key == "":
+			_ = c.Error(middleware.NewBadRequestError("Invalid query", "malformed custom field condition "+param))
+			return nil, false
+		case op != repository.CustomFieldEq && op != repository.CustomFieldGte && op != repository.CustomFieldLte:
+			_ = c.Error(middleware.NewBadRequestError("Invalid query", "unknown custom field operator "+op))
+			return nil, false
+		}
+		for _, value := range values {
+			conditions = append(conditions, repository.CustomFieldCondition{Key: key, Op: op, Value: value})
+		}
+	}
+	return conditions, true
+}
+
+// listFilters parses the filter[<field>] and filter[<field>][<op>] parameters
+// and the sort of a listing query against the fields of a schema, reporting
+// each invalid parameter in the details of a bad request. With customSorts,
+// the custom fields among the sorts, such as "-cf.tier", are left to the
+// service and the other sorts are kept.
+func listFilters(c *gin.Context, schema *listquery.Schema, customSorts bool) (*listquery.Query, bool) {
+	values := c.Request.URL.Query()
+	if sorts, ok := values["sort"]; ok && customSorts {
+		var kept []string
+		for _, name := range strings.Split(strings.Join(sorts, ","), ",") {
+			if !strings.HasPrefix(strings.TrimPrefix(strings.TrimSpace(name), "-"), "cf.") {
+				kept = append(kept, name)
+			}
+		}
+		values.Del("sort")
+		if len(kept) > 0 {
+			values.Set("sort", strings.Join(kept, ","))
+		}
+	}
+	filters, err := schema.Parse(values)
+	if err != nil {
+		var invalid *listquery.Error
+		if errors.As(err, &invalid) {
+			_ = c.Error(middleware.NewBadRequestError("Invalid query", invalid.Fields))
+		} else {
+			_ = c.Error(middleware.NewBadRequestError("Invalid query", err.Error()))
+		}
+		return nil, false
+	}
+	return filters, true
+}
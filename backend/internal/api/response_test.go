@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+)
+
+// Values stored in persistence-only fields. None of them may appear in a
+// response body.
+const (
+	passwordHash = "$2a$10$secret-password-hash"
+	keyHash      = "secret-api-key-hash"
+	tokenHash    = "secret-scim-token-hash"
+	familyID     = "secret-refresh-family"
+)
+
+func testUser() *models.User {
+	verifiedAt := time.Now()
+	return &models.User{
+		ID:              7,
+		Email:           "alice@example.com",
+		Password:        passwordHash,
+		BuisnessName:    "Alice Ltd",
+		EmailVerifiedAt: &verifiedAt,
+	}
+}
+
+func testMembership() *models.Membership {
+	return &models.Membership{
+		UserID:         7,
+		User:           testUser(),
+		OrganizationID: 3,
+		Organization:   &models.Organization{ID: 3, Name: "Acme", Slug: "acme"},
+		Role:           models.RoleAdmin,
+	}
+}
+
+func testContext() *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "http://crm.example.com/scim/v2/Users", nil)
+	return c
+}
+
+// render writes the response the way the handlers do and returns the body
+func render(t *testing.T, response interface{}) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	utils.SuccessResponse(c, http.StatusOK, response)
+	if !json.Valid(w.Body.Bytes()) {
+		t.Fatalf("response is not valid JSON: %s", w.Body.String())
+	}
+	return w.Body.String()
+}
+
+func TestResponsesDoNotLeakSecrets(t *testing.T) {
+	user := testUser()
+	membership := testMembership()
+
+	tests := []struct {
+		name     string
+		response interface{}
+	}{
+		{"user", newUserResponse(user)},
+		{"auth", newAuthResponse(user, &services.TokenPair{AccessToken: "access", RefreshToken: "refresh"})},
+		{"membership", newMembershipResponse(membership)},
+		{"member", newMemberResponse(membership)},
+		{"invitation", newInvitationResponse(&models.Invitation{ID: 1, Email: "bob@example.com", InvitedBy: user})},
+		{"service account", newServiceAccountResponse(&services.ServiceAccountDetails{
+			Account: &models.ServiceAccount{ID: 2, UserID: 8, User: &models.User{ID: 8, Password: passwordHash}, Name: "ci"},
+			Role:    models.RoleUser,
+		})},
+		{"api keys", newAPIKeyListResponse([]models.APIKey{{ID: 4, Name: "ci", Prefix: "lcrm_abcd", KeyHash: keyHash}})},
+		{"created api key", newCreatedAPIKeyResponse(&services.CreatedAPIKey{
+			Key:    &models.APIKey{ID: 4, Prefix: "lcrm_abcd", KeyHash: keyHash},
+			Secret: "lcrm_abcd-shown-once",
+		})},
+		{"scim tokens", newSCIMTokenListResponse([]models.SCIMToken{{ID: 5, Prefix: "lcrm_scim_ab", TokenHash: tokenHash}})},
+		{"sessions", newSessionListResponse([]models.Session{{ID: 6, UserID: 7, FamilyID: familyID}}, "6")},
+		{"contacts", newContactListResponse([]models.Contact{{ID: 10, FirstName: "Carol", Owner: user}})},
+		{"companies", newCompanyListResponse([]models.Company{{ID: 11, Name: "Acme", Owner: user}})},
+		{"deals", newDealListResponse([]models.Deal{{ID: 12, Title: "Renewal", Owner: user}})},
+		{"activities", newActivityListResponse([]models.Activity{{ID: 13, Type: models.ActivityCall, Author: user}})},
+		{"tasks", newTaskListResponse([]models.Task{{ID: 14, Title: "Follow up", Assignee: user, CreatedBy: user}})},
+		{"custom fields", newCustomFieldListResponse([]models.CustomField{{ID: 15, RecordType: models.RecordContact, Key: "tier", Type: models.CustomFieldSelect, Options: []string{"gold"}}})},
+		{"segments", newSegmentListResponse([]models.Segment{{ID: 16, RecordType: models.RecordContact, Name: "VIPs", Rules: "tag = vip"}})},
+		{"tags", newTagListResponse([]repository.TagCount{{Name: "vip", Count: 2}})},
+		{"scim users", newSCIMUserListResponse(testContext(), []models.Membership{*membership})},
+		{"scim groups", newSCIMGroupListResponse(testContext(), []services.SCIMGroup{{
+			Role:    &models.Role{ID: 9, Name: models.RoleAdmin},
+			Members: []models.Membership{*membership},
+		}})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := render(t, tt.response)
+			for _, secret := range []string{passwordHash, keyHash, tokenHash, familyID, `"password"`} {
+				if strings.Contains(body, secret) {
+					t.Errorf("response contains %q: %s", secret, body)
+				}
+			}
+		})
+	}
+}
+
+func TestUserResponseFields(t *testing.T) {
+	body := render(t, newUserResponse(testUser()))
+
+	var envelope struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"id", "email", "email_verified", "business_name", "service_account"}
+	if len(envelope.Data) != len(want) {
+		t.Errorf("user response has fields %v, want %v", envelope.Data, want)
+	}
+	for _, field := range want {
+		if _, ok := envelope.Data[field]; !ok {
+			t.Errorf("user response is missing %q", field)
+		}
+	}
+}
+
+// TestModelsHideSecrets guards against a model being serialized by mistake
+func TestModelsHideSecrets(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  interface{}
+		secret string
+	}{
+		{"user", testUser(), passwordHash},
+		{"api key", &models.APIKey{KeyHash: keyHash}, keyHash},
+		{"scim token", &models.SCIMToken{TokenHash: tokenHash}, tokenHash},
+		{"session", &models.Session{FamilyID: familyID}, familyID},
+		{"totp device", &models.TOTPDevice{Secret: "JBSWY3DPEHPK3PXP"}, "JBSWY3DPEHPK3PXP"},
+		{"recovery code", &models.RecoveryCode{CodeHash: keyHash}, keyHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(body), tt.secret) {
+				t.Errorf("model serializes its secret: %s", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type createRoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=100"`
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type updateRoleRequest struct {
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type permissionResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type roleResponse struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	IsSystem    bool      `json:"is_system"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func newRoleResponse(role *models.Role) roleResponse {
+	permissions := make([]string, len(role.Permissions))
+	for i, p := range role.Permissions {
+		permissions[i] = p.Name
+	}
+	return roleResponse{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		IsSystem:    role.IsSystem,
+		Permissions: permissions,
+		CreatedAt:   role.CreatedAt,
+		UpdatedAt:   role.UpdatedAt,
+	}
+}
+
+// RoleController handles role and permission management
+type RoleController struct {
+	authzService *services.AuthorizationService
+	logger       *zap.SugaredLogger
+}
+
+// NewRoleController creates a new role controller
+func NewRoleController(authzService *services.AuthorizationService, logger *zap.SugaredLogger) *RoleController {
+	return &RoleController{
+		authzService: authzService,
+		logger:       logger,
+	}
+}
+
+// ListPermissions returns the permission catalog
+func (ctrl *RoleController) ListPermissions(c *gin.Context) {
+	permissions, err := ctrl.authzService.ListPermissions(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := make([]permissionResponse, len(permissions))
+	for i, p := range permissions {
+		response[i] = permissionResponse{Name: p.Name, Description: p.Description}
+	}
+	utils.SuccessResponse(c, http.StatusOK, response)
+}
+
+// ListRoles returns every role
+func (ctrl *RoleController) ListRoles(c *gin.Context) {
+	roles, err := ctrl.authzService.ListRoles(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := make([]roleResponse, len(roles))
+	for i := range roles {
+		response[i] = newRoleResponse(&roles[i])
+	}
+	utils.SuccessResponse(c, http.StatusOK, response)
+}
+
+// GetRole returns a single role
+func (ctrl *RoleController) GetRole(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	role, err := ctrl.authzService.GetRole(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newRoleResponse(role))
+}
+
+// CreateRole creates a custom role. The role can only grant permissions the
+// caller holds.
+func (ctrl *RoleController) CreateRole(c *gin.Context) {
+	creatorID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req createRoleRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	role, err := ctrl.authzService.CreateRole(c.Request.Context(), creatorID, services.RoleInput{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newRoleResponse(role))
+}
+
+// UpdateRole replaces the description and permissions of a custom role. The
+// role can only grant permissions the caller holds.
+func (ctrl *RoleController) UpdateRole(c *gin.Context) {
+	editorID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req updateRoleRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	role, err := ctrl.authzService.UpdateRole(c.Request.Context(), editorID, id, services.RoleInput{
+		Description: req.Description,
+		Permissions: req.Permissions,
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newRoleResponse(role))
+}
+
+// DeleteRole deletes a custom role
+func (ctrl *RoleController) DeleteRole(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.authzService.DeleteRole(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -1,15 +1,252 @@
 package api
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/config"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/mailer"
 	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/notifier"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/oidc"
 	"go.uber.org/zap"
 )
 
-func SetupRouter(cfg *config.Config, logger *zap.SugaredLogger) *gin.Engine {
+// controllers groups the HTTP handlers registered by the router
+type controllers struct {
+	auth            *AuthController
+	admin           *AdminController
+	roles           *RoleController
+	organizations   *OrganizationController
+	invitations     *InvitationController
+	mfa             *MFAController
+	accounts        *AccountController
+	apiKeys         *APIKeyController
+	serviceAccounts *ServiceAccountController
+	sso             *SSOController
+	sessions        *SessionController
+	impersonation   *ImpersonationController
+	audit           *AuditController
+	scim            *SCIMController
+	scimTokens      *SCIMTokenController
+	contacts        *ContactController
+	companies       *CompanyController
+	pipelines       *PipelineController
+	deals           *DealController
+	activities      *ActivityController
+	tasks           *TaskController
+	customFields    *CustomFieldController
+	segments        *SegmentController
+	tags            *TagController
+	authz           *services.AuthorizationService
+	apiKeyAuth      middleware.APIKeyAuthenticator
+	scimAuth        middleware.SCIMAuthenticator
+}
+
+// newControllers wires repositories, services and controllers together
+func newControllers(cfg *config.Config, db *repository.Database, jwtConfig middleware.JWTConfig, logger *zap.SugaredLogger) (*controllers, error) {
+	mail, err := newMailer(cfg.Mail)
+	if err != nil {
+		return nil, err
+	}
+
+	userRepo := repository.NewUserRepository(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	roleRepo := repository.NewRoleRepository(db)
+	orgRepo := repository.NewOrganizationRepository(db)
+	invitationRepo := repository.NewInvitationRepository(db)
+	mfaRepo := repository.NewMFARepository(db)
+	userTokenRepo := repository.NewUserTokenRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	serviceAccountRepo := repository.NewServiceAccountRepository(db)
+	ssoRepo := repository.NewSSORepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	loginThrottleRepo := repository.NewLoginThrottleRepository(db)
+	scimRepo := repository.NewSCIMRepository(db)
+	contactRepo := repository.NewContactRepository(db)
+	companyRepo := repository.NewCompanyRepository(db)
+	pipelineRepo := repository.NewPipelineRepository(db)
+	dealRepo := repository.NewDealRepository(db)
+	activityRepo := repository.NewActivityRepository(db)
+	taskRepo := repository.NewTaskRepository(db)
+	customFieldRepo := repository.NewCustomFieldRepository(db)
+	segmentRepo := repository.NewSegmentRepository(db)
+	tagRepo := repository.NewTagRepository(db)
+
+	auditService := services.NewAuditService(auditRepo, logger)
+	lockoutService := services.NewLockoutService(loginThrottleRepo, userRepo, orgRepo, auditService, services.LockoutPolicy{
+		BackoffAfter: cfg.Auth.LoginBackoffAfter,
+		Threshold:    cfg.Auth.LoginLockoutThreshold,
+		Duration:     time.Duration(cfg.Auth.LoginLockoutDuration) * time.Minute,
+	}, logger)
+	mfaService := services.NewMFAService(mfaRepo, userRepo, orgRepo, cfg.Auth.MFAIssuer, logger)
+	sessionService := services.NewSessionService(sessionRepo, refreshTokenRepo, orgRepo, db, auditService, jwtConfig, logger)
+	authService := services.NewAuthService(
+		userRepo, orgRepo, refreshTokenRepo, db, mfaService, lockoutService, sessionService, jwtConfig, logger,
+	)
+	accountService := services.NewAccountService(
+		userRepo, userTokenRepo, db, authService, mail,
+		time.Duration(cfg.Auth.PasswordResetTTL)*time.Minute,
+		time.Duration(cfg.Auth.EmailVerificationTTL)*time.Hour,
+		cfg.Mail.AppURL, logger,
+	)
+	authzService := services.NewAuthorizationService(roleRepo, orgRepo, logger)
+	orgService := services.NewOrganizationService(orgRepo, roleRepo, authzService, mfaService, logger)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, orgRepo, logger)
+	serviceAccountService := services.NewServiceAccountService(
+		serviceAccountRepo, userRepo, orgRepo, roleRepo, db, apiKeyService, authzService, logger,
+	)
+	impersonationService := services.NewImpersonationService(
+		orgRepo, authzService, auditService, jwtConfig,
+		time.Duration(cfg.Auth.ImpersonationTTL)*time.Minute, logger,
+	)
+	ssoService := services.NewSSOService(
+		newSSOProviders(cfg.SSO), ssoRepo, userRepo, orgRepo, roleRepo, db, authService, authzService, logger,
+	)
+	scimTokenService := services.NewSCIMTokenService(scimRepo, logger)
+	scimService := services.NewSCIMService(
+		scimRepo, userRepo, orgRepo, roleRepo, db, authzService, sessionService, apiKeyService, auditService, logger,
+	)
+	segmentService := services.NewSegmentService(segmentRepo, customFieldRepo, logger)
+	contactService := services.NewContactService(contactRepo, orgRepo, customFieldRepo, segmentService, logger)
+	companyService := services.NewCompanyService(companyRepo, contactRepo, orgRepo, customFieldRepo, segmentService, logger)
+	pipelineService := services.NewPipelineService(pipelineRepo, dealRepo, db, logger)
+	dealService := services.NewDealService(
+		dealRepo, pipelineRepo, companyRepo, contactRepo, orgRepo, customFieldRepo, segmentService, db, logger,
+	)
+	activityService := services.NewActivityService(activityRepo, contactRepo, companyRepo, dealRepo, segmentService, logger)
+	customFieldService := services.NewCustomFieldService(customFieldRepo, logger)
+	taskService := services.NewTaskService(taskRepo, contactRepo, companyRepo, dealRepo, orgRepo, segmentService, logger)
+	tagService := services.NewTagService(tagRepo, contactRepo, companyRepo, dealRepo, segmentService, db, logger)
+	invitationService := services.NewInvitationService(
+		invitationRepo, orgRepo, userRepo, roleRepo, db, authService, authzService, mail, jwtConfig,
+		time.Duration(cfg.Auth.InvitationTTL)*time.Hour, cfg.Mail.AppURL, logger,
+	)
+
+	return &controllers{
+		auth:            NewAuthController(authService, accountService, logger),
+		admin:           NewAdminController(authService, authzService, lockoutService, logger),
+		roles:           NewRoleController(authzService, logger),
+		organizations:   NewOrganizationController(orgService, logger),
+		invitations:     NewInvitationController(invitationService, logger),
+		mfa:             NewMFAController(mfaService, logger),
+		accounts:        NewAccountController(accountService, logger),
+		apiKeys:         NewAPIKeyController(apiKeyService, logger),
+		serviceAccounts: NewServiceAccountController(serviceAccountService, logger),
+		sso:             NewSSOController(ssoService, logger),
+		sessions:        NewSessionController(sessionService, logger),
+		impersonation:   NewImpersonationController(impersonationService, logger),
+		audit:           NewAuditController(auditService, logger),
+		scim:            NewSCIMController(scimService, logger),
+		scimTokens:      NewSCIMTokenController(scimTokenService, logger),
+		contacts:        NewContactController(contactService, logger),
+		companies:       NewCompanyController(companyService, logger),
+		pipelines:       NewPipelineController(pipelineService, logger),
+		deals:           NewDealController(dealService, logger),
+		activities:      NewActivityController(activityService, logger),
+		tasks:           NewTaskController(taskService, logger),
+		customFields:    NewCustomFieldController(customFieldService, logger),
+		segments:        NewSegmentController(segmentService, logger),
+		tags:            NewTagController(tagService, logger),
+		authz:           authzService,
+		apiKeyAuth:      apiKeyService,
+		scimAuth:        scimTokenService,
+	}, nil
+}
+
+// newMailer creates the mailer selected by the configuration
+func newMailer(cfg config.MailConfig) (mailer.Mailer, error) {
+	switch cfg.Driver {
+	case "file":
+		return mailer.NewFileMailer(cfg.From, cfg.Dir)
+	default:
+		return mailer.NewStdoutMailer(cfg.From), nil
+	}
+}
+
+// NewReminderScheduler creates the scheduler reminding members of their tasks
+// through the notifier selected by the configuration
+func NewReminderScheduler(cfg *config.Config, db *repository.Database, logger *zap.SugaredLogger) (*services.ReminderScheduler, error) {
+	var notify notifier.Notifier
+	switch cfg.Reminder.Notifier {
+	case "log":
+		notify = notifier.NewLogNotifier(logger)
+	default:
+		mail, err := newMailer(cfg.Mail)
+		if err != nil {
+			return nil, err
+		}
+		notify = notifier.NewMailNotifier(mail, cfg.Mail.AppURL)
+	}
+
+	return services.NewReminderScheduler(
+		repository.NewTaskRepository(db), notify,
+		time.Duration(cfg.Reminder.Interval)*time.Second, time.Duration(cfg.Reminder.DefaultLead)*time.Minute, logger,
+	), nil
+}
+
+// newSSOProviders creates the OpenID providers from the configuration
+func newSSOProviders(cfg config.SSOConfig) []*services.SSOProvider {
+	providers := make([]*services.SSOProvider, 0, len(cfg.Providers))
+	for _, provider := range cfg.Providers {
+		groupRoles := make([]services.SSOGroupRole, len(provider.GroupRoles))
+		for i, mapping := range provider.GroupRoles {
+			groupRoles[i] = services.SSOGroupRole{Group: mapping.Group, Role: mapping.Role}
+		}
+
+		providers = append(providers, &services.SSOProvider{
+			Name: provider.Name,
+			Client: oidc.NewProvider(oidc.Config{
+				Issuer:       provider.Issuer,
+				ClientID:     provider.ClientID,
+				ClientSecret: provider.ClientSecret,
+				RedirectURL:  provider.RedirectURL,
+				Scopes:       provider.Scopes,
+			}),
+			GroupsClaim:    provider.GroupsClaim,
+			GroupRoles:     groupRoles,
+			DefaultRole:    provider.DefaultRole,
+			Organization:   provider.Organization,
+			AllowedDomains: provider.AllowedDomains,
+		})
+	}
+	return providers
+}
+
+// newJWTConfig builds the JWT configuration from the application config
+func newJWTConfig(cfg *config.Config, db *repository.Database) (middleware.JWTConfig, error) {
+	jwtConfig := middleware.DefaultJWTConfig()
+	jwtConfig.Secret = cfg.Auth.JWTSecret
+	jwtConfig.TokenExpiration = time.Duration(cfg.Auth.TokenDuration) * time.Hour
+	jwtConfig.Issuer = cfg.Auth.JWTIssuer
+	jwtConfig.Audience = cfg.Auth.JWTAudience
+	jwtConfig.Leeway = time.Duration(cfg.Auth.JWTLeeway) * time.Second
+	jwtConfig.RequireVerifiedEmail = cfg.Auth.RequireVerifiedEmail
+
+	if len(cfg.Auth.JWTKeyFiles) > 0 {
+		keys, err := middleware.LoadKeySet(cfg.Auth.JWTKeyFiles, cfg.Auth.JWTActiveKeyID)
+		if err != nil {
+			return jwtConfig, err
+		}
+		jwtConfig.Keys = keys
+	}
+
+	switch cfg.Auth.RevocationStore {
+	case "memory":
+		jwtConfig.Revocations = middleware.NewMemoryRevocationStore()
+	default:
+		jwtConfig.Revocations = repository.NewRevocationStore(db)
+	}
+	return jwtConfig, nil
+}
+
+func SetupRouter(cfg *config.Config, db *repository.Database, logger *zap.SugaredLogger) (*gin.Engine, error) {
 	// Set Gin mode
 	gin.SetMode(cfg.Server.Mode)
 
@@ -19,45 +256,253 @@ func SetupRouter(cfg *config.Config, logger *zap.SugaredLogger) *gin.Engine {
 	// Add middlewares
 	router.Use(gin.Recovery())
 	router.Use(middleware.Logger(logger))
+	router.Use(middleware.ClientInfo())
 	router.Use(middleware.ErrorHandler(logger))
 	router.Use(middleware.NewRateLimiter(logger))
 	router.Use(middleware.CORS())
 
+	// Create JWT config
+	jwtConfig, err := newJWTConfig(cfg, db)
+	if err != nil {
+		return nil, err
+	}
+
+	ctrls, err := newControllers(cfg, db, jwtConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+
 	// API v1 routes
 	v1 := router.Group("/api/v1")
 	{
 		// Public routes
 		public := v1.Group("/")
-		SetupPublicRoutes(public, cfg, logger)
-
-		// Create JWT config
-		jwtConfig := middleware.DefaultJWTConfig()
-		jwtConfig.Secret = cfg.Auth.JWTSecret
+		SetupPublicRoutes(public, ctrls)
 
 		// Protected routes
 		protected := v1.Group("/")
-		protected.Use(middleware.JWT(jwtConfig, logger))
-		SetupProtectedRoutes(protected, cfg, logger)
+		protected.Use(middleware.Authenticate(jwtConfig, ctrls.apiKeyAuth, logger))
+		protected.Use(ctrls.impersonation.AuditRequests)
+		SetupProtectedRoutes(protected, ctrls)
 	}
 
+	// SCIM provisioning, authenticated with an organization's SCIM token
+	scimRoutes := router.Group(scimBasePath, middleware.SCIMAuth(ctrls.scimAuth, logger))
+	SetupSCIMRoutes(scimRoutes, ctrls)
+
+	// Public keys for verifying tokens issued by this service
+	router.GET("/.well-known/jwks.json", middleware.JWKSHandler(jwtConfig))
+
 	// Swagger documentation
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	return router
+	return router, nil
 }
 
 // SetupPublicRoutes configures the public routes
-func SetupPublicRoutes(router *gin.RouterGroup, cfg *config.Config, logger *zap.SugaredLogger) {
-	// // Add auth controller routes (login, register)
-	// authController := NewAuthController(cfg, logger)
-	// router.POST("/auth/login", authController.Login)
-	// router.POST("/auth/register", authController.Register)
+func SetupPublicRoutes(router *gin.RouterGroup, ctrls *controllers) {
+	// Add auth controller routes (login, register, refresh, logout)
+	router.POST("/auth/login", ctrls.auth.Login)
+	router.POST("/auth/register", ctrls.auth.Register)
+	router.POST("/auth/refresh", ctrls.auth.Refresh)
+	router.POST("/auth/logout", ctrls.auth.Logout)
+
+	// Second sign-in step, authenticated with the MFA challenge token
+	router.POST("/auth/mfa/verify", ctrls.auth.VerifyMFA)
+	router.POST("/auth/mfa/enroll", ctrls.auth.BeginMFAEnrollment)
+	router.POST("/auth/mfa/enroll/confirm", ctrls.auth.ConfirmMFAEnrollment)
+
+	// Single sign-on through OpenID providers
+	router.GET("/auth/sso", ctrls.sso.ListProviders)
+	router.GET("/auth/sso/:provider/authorize", ctrls.sso.Authorize)
+	router.POST("/auth/sso/:provider/callback", ctrls.sso.Callback)
+
+	// Account recovery and email verification authenticate with the emailed token
+	router.POST("/auth/password-reset/request", ctrls.accounts.RequestPasswordReset)
+	router.POST("/auth/password-reset/confirm", ctrls.accounts.ResetPassword)
+	router.POST("/auth/email-verification/request", ctrls.accounts.RequestEmailVerification)
+	router.POST("/auth/email-verification/confirm", ctrls.accounts.VerifyEmail)
+
+	// Invitation answers authenticate with the emailed invitation token
+	router.POST("/invitations/accept", ctrls.invitations.Accept)
+	router.POST("/invitations/decline", ctrls.invitations.Decline)
 }
 
-func SetupProtectedRoutes(router *gin.RouterGroup, cfg *config.Config, logger *zap.SugaredLogger) {
+func SetupProtectedRoutes(router *gin.RouterGroup, ctrls *controllers) {
+	// Account routes are only available to signed-in users, not API keys,
+	// so that a key cannot mint credentials beyond its scopes. Admins
+	// impersonating a user cannot use them either.
+	account := router.Group("/", middleware.DenyAPIKeys(), middleware.DenyImpersonation())
+	account.POST("/auth/logout-all", ctrls.auth.LogoutEverywhere)
+	account.POST("/auth/switch-organization", ctrls.auth.SwitchOrganization)
+
+	account.GET("/users/me/mfa", ctrls.mfa.Status)
+	account.POST("/users/me/mfa/totp", ctrls.mfa.BeginEnrollment)
+	account.POST("/users/me/mfa/totp/confirm", ctrls.mfa.ConfirmEnrollment)
+	account.DELETE("/users/me/mfa/totp", ctrls.mfa.Disable)
+	account.POST("/users/me/mfa/recovery-codes", ctrls.mfa.RegenerateRecoveryCodes)
+
+	account.GET("/users/me/sessions", ctrls.sessions.List)
+	account.DELETE("/users/me/sessions/:id", ctrls.sessions.Revoke)
+
+	account.GET("/users/me/api-keys", ctrls.apiKeys.List)
+	account.POST("/users/me/api-keys", ctrls.apiKeys.Create)
+	account.DELETE("/users/me/api-keys/:id", ctrls.apiKeys.Revoke)
+
+	requireUsersRead := middleware.RequirePermission(ctrls.authz, models.PermissionUsersRead)
+	requireUsersManage := middleware.RequirePermission(ctrls.authz, models.PermissionUsersManage)
+	requireRolesManage := middleware.RequirePermission(ctrls.authz, models.PermissionRolesManage)
+	requireOrgManage := middleware.RequirePermission(ctrls.authz, models.PermissionOrgManage)
+	requireAuditRead := middleware.RequirePermission(ctrls.authz, models.PermissionAuditRead)
+	requireImpersonate := middleware.RequirePermission(ctrls.authz, models.PermissionImpersonate)
+
+	router.POST("/auth/impersonation/end", ctrls.impersonation.End)
+
+	// Organization routes
+	router.GET("/organizations", ctrls.organizations.ListMine)
+	router.GET("/organizations/current", ctrls.organizations.GetCurrent)
+	router.PUT("/organizations/current", requireOrgManage, ctrls.organizations.UpdateCurrent)
+	router.GET("/organizations/current/members", requireUsersRead, ctrls.organizations.ListMembers)
+	router.DELETE("/organizations/current/members/:id", requireUsersManage, ctrls.organizations.RemoveMember)
+	router.GET("/organizations/current/invitations", requireUsersManage, ctrls.invitations.ListPending)
+	router.POST("/organizations/current/invitations", requireUsersManage, ctrls.invitations.Invite)
+	router.DELETE("/organizations/current/invitations/:id", requireUsersManage, ctrls.invitations.Revoke)
+	account.GET("/organizations/current/service-accounts", requireUsersManage, ctrls.serviceAccounts.List)
+	account.POST("/organizations/current/service-accounts", requireUsersManage, ctrls.serviceAccounts.Create)
+	account.DELETE("/organizations/current/service-accounts/:id", requireUsersManage, ctrls.serviceAccounts.Delete)
+	account.GET("/organizations/current/service-accounts/:id/api-keys", requireUsersManage, ctrls.serviceAccounts.ListKeys)
+	account.POST("/organizations/current/service-accounts/:id/api-keys", requireUsersManage, ctrls.serviceAccounts.CreateKey)
+	account.DELETE("/organizations/current/service-accounts/:id/api-keys/:keyId", requireUsersManage, ctrls.serviceAccounts.RevokeKey)
+	account.GET("/organizations/current/scim-tokens", requireUsersManage, ctrls.scimTokens.List)
+	account.POST("/organizations/current/scim-tokens", requireUsersManage, ctrls.scimTokens.Create)
+	account.DELETE("/organizations/current/scim-tokens/:id", requireUsersManage, ctrls.scimTokens.Revoke)
+
+	// Admin routes
+
+	admin := router.Group("/admin")
+	admin.POST("/users/:id/force-logout", requireUsersManage, ctrls.admin.ForceLogout)
+	admin.PUT("/users/:id/role", requireUsersManage, ctrls.admin.AssignRole)
+	admin.POST("/users/:id/unlock", requireUsersManage, ctrls.admin.Unlock)
+	admin.GET("/users/:id/sessions", requireUsersManage, ctrls.sessions.ListForUser)
+	admin.DELETE("/users/:id/sessions/:sessionId", requireUsersManage, ctrls.sessions.RevokeForUser)
+	account.POST("/admin/users/:id/impersonate", requireImpersonate, ctrls.impersonation.Start)
+	admin.GET("/audit-events", requireAuditRead, ctrls.audit.List)
+	admin.GET("/permissions", requireRolesManage, ctrls.roles.ListPermissions)
+	admin.GET("/roles", requireRolesManage, ctrls.roles.ListRoles)
+	admin.POST("/roles", requireRolesManage, ctrls.roles.CreateRole)
+	admin.GET("/roles/:id", requireRolesManage, ctrls.roles.GetRole)
+	admin.PUT("/roles/:id", requireRolesManage, ctrls.roles.UpdateRole)
+	admin.DELETE("/roles/:id", requireRolesManage, ctrls.roles.DeleteRole)
+
+	// CRM routes
+	requireContactsRead := middleware.RequirePermission(ctrls.authz, models.PermissionContactsRead)
+	requireContactsWrite := middleware.RequirePermission(ctrls.authz, models.PermissionContactsWrite)
+
+	router.GET("/contacts", requireContactsRead, ctrls.contacts.List)
+	router.POST("/contacts", requireContactsWrite, ctrls.contacts.Create)
+	router.GET("/contacts/:id", requireContactsRead, ctrls.contacts.Get)
+	router.PUT("/contacts/:id", requireContactsWrite, ctrls.contacts.Update)
+	router.DELETE("/contacts/:id", requireContactsWrite, ctrls.contacts.Delete)
+	router.POST("/contacts/tags", requireContactsWrite, ctrls.tags.ChangeContacts)
+
+	requireCompaniesRead := middleware.RequirePermission(ctrls.authz, models.PermissionCompaniesRead)
+	requireCompaniesWrite := middleware.RequirePermission(ctrls.authz, models.PermissionCompaniesWrite)
+
+	router.GET("/companies", requireCompaniesRead, ctrls.companies.List)
+	router.POST("/companies", requireCompaniesWrite, ctrls.companies.Create)
+	router.GET("/companies/:id", requireCompaniesRead, ctrls.companies.Get)
+	router.PUT("/companies/:id", requireCompaniesWrite, ctrls.companies.Update)
+	router.DELETE("/companies/:id", requireCompaniesWrite, ctrls.companies.Delete)
+	router.POST("/companies/tags", requireCompaniesWrite, ctrls.tags.ChangeCompanies)
+	router.GET("/companies/:id/contacts", requireCompaniesRead, requireContactsRead, ctrls.companies.ListContacts)
+	router.PUT("/companies/:id/contacts/:contactId", requireCompaniesWrite, requireContactsRead, ctrls.companies.LinkContact)
+	router.DELETE("/companies/:id/contacts/:contactId", requireCompaniesWrite, ctrls.companies.UnlinkContact)
+
+	requireDealsRead := middleware.RequirePermission(ctrls.authz, models.PermissionDealsRead)
+	requireDealsWrite := middleware.RequirePermission(ctrls.authz, models.PermissionDealsWrite)
+
+	router.GET("/pipelines", requireDealsRead, ctrls.pipelines.List)
+	router.POST("/pipelines", requireDealsWrite, ctrls.pipelines.Create)
+	router.GET("/pipelines/:id", requireDealsRead, ctrls.pipelines.Get)
+	router.PUT("/pipelines/:id", requireDealsWrite, ctrls.pipelines.Update)
+	router.DELETE("/pipelines/:id", requireDealsWrite, ctrls.pipelines.Delete)
+	router.GET("/deals", requireDealsRead, ctrls.deals.List)
+	router.POST("/deals", requireDealsWrite, ctrls.deals.Create)
+	router.GET("/deals/:id", requireDealsRead, ctrls.deals.Get)
+	router.PUT("/deals/:id", requireDealsWrite, ctrls.deals.Update)
+	router.DELETE("/deals/:id", requireDealsWrite, ctrls.deals.Delete)
+	router.POST("/deals/tags", requireDealsWrite, ctrls.tags.ChangeDeals)
+	router.PUT("/deals/:id/stage", requireDealsWrite, ctrls.deals.Move)
+	router.POST("/deals/:id/won", requireDealsWrite, ctrls.deals.Win)
+	router.POST("/deals/:id/lost", requireDealsWrite, ctrls.deals.Lose)
+	router.POST("/deals/:id/reopen", requireDealsWrite, ctrls.deals.Reopen)
+	router.GET("/deals/:id/history", requireDealsRead, ctrls.deals.History)
+
+	requireActivitiesRead := middleware.RequirePermission(ctrls.authz, models.PermissionActivitiesRead)
+	requireActivitiesWrite := middleware.RequirePermission(ctrls.authz, models.PermissionActivitiesWrite)
+
+	router.GET("/activities", requireActivitiesRead, ctrls.activities.List)
+	router.POST("/activities", requireActivitiesWrite, ctrls.activities.Create)
+	router.GET("/activities/:id", requireActivitiesRead, ctrls.activities.Get)
+	router.PUT("/activities/:id", requireActivitiesWrite, ctrls.activities.Update)
+	router.DELETE("/activities/:id", requireActivitiesWrite, ctrls.activities.Delete)
+	router.GET("/contacts/:id/timeline", requireContactsRead, requireActivitiesRead, ctrls.activities.ContactTimeline)
+	router.GET("/companies/:id/timeline", requireCompaniesRead, requireActivitiesRead, ctrls.activities.CompanyTimeline)
+	router.GET("/deals/:id/timeline", requireDealsRead, requireActivitiesRead, ctrls.activities.DealTimeline)
+
+	requireTasksRead := middleware.RequirePermission(ctrls.authz, models.PermissionTasksRead)
+	requireTasksWrite := middleware.RequirePermission(ctrls.authz, models.PermissionTasksWrite)
+
+	router.GET("/tasks", requireTasksRead, ctrls.tasks.List)
+	router.GET("/tasks/mine", requireTasksRead, ctrls.tasks.Mine)
+	router.POST("/tasks", requireTasksWrite, ctrls.tasks.Create)
+	router.GET("/tasks/:id", requireTasksRead, ctrls.tasks.Get)
+	router.PUT("/tasks/:id", requireTasksWrite, ctrls.tasks.Update)
+	router.DELETE("/tasks/:id", requireTasksWrite, ctrls.tasks.Delete)
+
+	// Every member sees the custom fields, which describe the records they work with
+	requireFieldsManage := middleware.RequirePermission(ctrls.authz, models.PermissionFieldsManage)
+
+	router.GET("/custom-fields", ctrls.customFields.List)
+	router.POST("/custom-fields", requireFieldsManage, ctrls.customFields.Create)
+	router.GET("/custom-fields/:id", ctrls.customFields.Get)
+	router.PUT("/custom-fields/:id", requireFieldsManage, ctrls.customFields.Update)
+	router.DELETE("/custom-fields/:id", requireFieldsManage, ctrls.customFields.Delete)
+
+	// Every member sees the tags in use, like the custom fields
+	router.GET("/tags", ctrls.tags.List)
+
+	requireSegmentsRead := middleware.RequirePermission(ctrls.authz, models.PermissionSegmentsRead)
+	requireSegmentsWrite := middleware.RequirePermission(ctrls.authz, models.PermissionSegmentsWrite)
+
+	router.GET("/segments", requireSegmentsRead, ctrls.segments.List)
+	router.POST("/segments", requireSegmentsWrite, ctrls.segments.Create)
+	router.GET("/segments/:id", requireSegmentsRead, ctrls.segments.Get)
+	router.PUT("/segments/:id", requireSegmentsWrite, ctrls.segments.Update)
+	router.DELETE("/segments/:id", requireSegmentsWrite, ctrls.segments.Delete)
+
 	// // Add user controller routes
 	//
 	//	userController := NewUserController(cfg, logger)
 	//	router.GET("/users/me", userController.GetCurrentUser)
 	//	router.PUT("/users/me", userController.UpdateCurrentUser)
 }
+
+// SetupSCIMRoutes configures the SCIM 2.0 provisioning routes
+func SetupSCIMRoutes(router *gin.RouterGroup, ctrls *controllers) {
+	router.GET("/ServiceProviderConfig", ctrls.scim.ServiceProviderConfig)
+
+	router.GET("/Users", ctrls.scim.ListUsers)
+	router.POST("/Users", ctrls.scim.CreateUser)
+	router.GET("/Users/:id", ctrls.scim.GetUser)
+	router.PUT("/Users/:id", ctrls.scim.ReplaceUser)
+	router.PATCH("/Users/:id", ctrls.scim.PatchUser)
+	router.DELETE("/Users/:id", ctrls.scim.DeleteUser)
+
+	router.GET("/Groups", ctrls.scim.ListGroups)
+	router.POST("/Groups", ctrls.scim.CreateGroup)
+	router.GET("/Groups/:id", ctrls.scim.GetGroup)
+	router.PUT("/Groups/:id", ctrls.scim.ReplaceGroup)
+	router.PATCH("/Groups/:id", ctrls.scim.PatchGroup)
+	router.DELETE("/Groups/:id", ctrls.scim.DeleteGroup)
+}
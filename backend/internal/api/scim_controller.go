@@ -0,0 +1,502 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/scim"
+	"go.uber.org/zap"
+)
+
+// scimBasePath is where the SCIM endpoints are mounted
+const scimBasePath = "/scim/v2"
+
+type scimUserRequest struct {
+	UserName    string          `json:"userName" binding:"required,email"`
+	ExternalID  string          `json:"externalId"`
+	DisplayName string          `json:"displayName"`
+	Active      json.RawMessage `json:"active"` // some clients send "True" and "False"
+}
+
+type scimGroupRequest struct {
+	DisplayName string               `json:"displayName" binding:"required"`
+	Members     []scimMemberResource `json:"members"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type"`
+	Primary bool   `json:"primary"`
+}
+
+type scimUserResource struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []scimEmail `json:"emails"`
+	Active      bool        `json:"active"`
+	Meta        scim.Meta   `json:"meta"`
+}
+
+type scimMemberResource struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type scimGroupResource struct {
+	Schemas     []string             `json:"schemas"`
+	ID          string               `json:"id"`
+	DisplayName string               `json:"displayName"`
+	Members     []scimMemberResource `json:"members,omitempty"`
+	Meta        scim.Meta            `json:"meta"`
+}
+
+func (req scimUserRequest) input() (services.SCIMUserInput, bool) {
+	input := services.SCIMUserInput{
+		UserName:    req.UserName,
+		ExternalID:  req.ExternalID,
+		DisplayName: req.DisplayName,
+	}
+	if len(req.Active) > 0 {
+		active, ok := scim.Bool(req.Active)
+		if !ok {
+			return input, false
+		}
+		input.Active = &active
+	}
+	return input, true
+}
+
+func (req scimGroupRequest) memberIDs() []string {
+	ids := make([]string, len(req.Members))
+	for i, member := range req.Members {
+		ids[i] = member.Value
+	}
+	return ids
+}
+
+func newSCIMUserResource(c *gin.Context, membership *models.Membership) scimUserResource {
+	id := strconv.Itoa(membership.UserID)
+	return scimUserResource{
+		Schemas:     []string{scim.SchemaUser},
+		ID:          id,
+		ExternalID:  membership.ExternalID,
+		UserName:    membership.User.Email,
+		DisplayName: membership.User.BuisnessName,
+		Emails:      []scimEmail{{Value: membership.User.Email, Type: "work", Primary: true}},
+		Active:      membership.Active(),
+		Meta:        newSCIMMeta(c, "User", "Users", id, membership.CreatedAt, membership.UpdatedAt),
+	}
+}
+
+func newSCIMUserListResponse(c *gin.Context, memberships []models.Membership) []scimUserResource {
+	response := make([]scimUserResource, len(memberships))
+	for i := range memberships {
+		response[i] = newSCIMUserResource(c, &memberships[i])
+	}
+	return response
+}
+
+func newSCIMGroupResource(c *gin.Context, group *services.SCIMGroup) scimGroupResource {
+	id := strconv.Itoa(group.Role.ID)
+	members := make([]scimMemberResource, len(group.Members))
+	for i, membership := range group.Members {
+		userID := strconv.Itoa(membership.UserID)
+		members[i] = scimMemberResource{
+			Value:   userID,
+			Ref:     scimLocation(c, "Users", userID),
+			Display: membership.User.Email,
+		}
+	}
+	return scimGroupResource{
+		Schemas:     []string{scim.SchemaGroup},
+		ID:          id,
+		DisplayName: group.Role.Name,
+		Members:     members,
+		Meta:        newSCIMMeta(c, "Group", "Groups", id, group.Role.CreatedAt, group.Role.UpdatedAt),
+	}
+}
+
+func newSCIMGroupListResponse(c *gin.Context, groups []services.SCIMGroup) []scimGroupResource {
+	response := make([]scimGroupResource, len(groups))
+	for i := range groups {
+		response[i] = newSCIMGroupResource(c, &groups[i])
+	}
+	return response
+}
+
+func newSCIMMeta(c *gin.Context, resourceType, endpoint, id string, created, lastModified time.Time) scim.Meta {
+	return scim.Meta{
+		ResourceType: resourceType,
+		Created:      created.UTC().Format(time.RFC3339),
+		LastModified: lastModified.UTC().Format(time.RFC3339),
+		Location:     scimLocation(c, endpoint, id),
+	}
+}
+
+// scimLocation returns the absolute URL of a resource, or of the endpoint
+// when id is empty
+func scimLocation(c *gin.Context, endpoint, id string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	location := scheme + "://" + c.Request.Host + scimBasePath + "/" + endpoint
+	if id != "" {
+		location += "/" + id
+	}
+	return location
+}
+
+// SCIMController serves the SCIM 2.0 Users and Groups endpoints an identity
+// provider provisions the organization of its SCIM token with. Requests and
+// responses follow RFC 7644 rather than the API's response envelope.
+type SCIMController struct {
+	scimService *services.SCIMService
+	logger      *zap.SugaredLogger
+}
+
+// NewSCIMController creates a new SCIM controller
+func NewSCIMController(scimService *services.SCIMService, logger *zap.SugaredLogger) *SCIMController {
+	return &SCIMController{
+		scimService: scimService,
+		logger:      logger,
+	}
+}
+
+// ServiceProviderConfig describes the supported SCIM features
+func (ctrl *SCIMController) ServiceProviderConfig(c *gin.Context) {
+	supported := func(supported bool) gin.H { return gin.H{"supported": supported} }
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{scim.SchemaServiceProviderConfig},
+		"patch":          supported(true),
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scim.MaxCount},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "SCIM token",
+			"description": "Bearer token created by an organization admin",
+			"primary":     true,
+		}},
+		"meta": gin.H{"resourceType": "ServiceProviderConfig", "location": scimLocation(c, "ServiceProviderConfig", "")},
+	})
+}
+
+// ListUsers returns a page of the organization's users matching the filter
+func (ctrl *SCIMController) ListUsers(c *gin.Context) {
+	startIndex, count := scim.Pagination(c.Query("startIndex"), c.Query("count"))
+
+	memberships, total, err := ctrl.scimService.ListUsers(c.Request.Context(), c.Query("filter"), startIndex, count)
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	resources := newSCIMUserListResponse(c, memberships)
+	scimJSON(c, http.StatusOK, scim.NewListResponse(resources, len(resources), total, startIndex))
+}
+
+// GetUser returns a user of the organization
+func (ctrl *SCIMController) GetUser(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+
+	membership, err := ctrl.scimService.GetUser(c.Request.Context(), id)
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, newSCIMUserResource(c, membership))
+}
+
+// CreateUser adds a user to the organization
+func (ctrl *SCIMController) CreateUser(c *gin.Context) {
+	input, ok := bindSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	membership, err := ctrl.scimService.CreateUser(c.Request.Context(), input)
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	resource := newSCIMUserResource(c, membership)
+	c.Header("Location", resource.Meta.Location)
+	scimJSON(c, http.StatusCreated, resource)
+}
+
+// ReplaceUser replaces the attributes of a user
+func (ctrl *SCIMController) ReplaceUser(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	input, ok := bindSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	membership, err := ctrl.scimService.ReplaceUser(c.Request.Context(), id, input)
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, newSCIMUserResource(c, membership))
+}
+
+// PatchUser changes attributes of a user; setting active to false
+// deactivates them and ends their sessions
+func (ctrl *SCIMController) PatchUser(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var req scim.PatchRequest
+	if !bindSCIM(c, &req) {
+		return
+	}
+
+	membership, err := ctrl.scimService.PatchUser(c.Request.Context(), id, req.Operations)
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, newSCIMUserResource(c, membership))
+}
+
+// DeleteUser removes a user from the organization
+func (ctrl *SCIMController) DeleteUser(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.scimService.DeleteUser(c.Request.Context(), id); err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroups returns a page of the roles matching the filter
+func (ctrl *SCIMController) ListGroups(c *gin.Context) {
+	startIndex, count := scim.Pagination(c.Query("startIndex"), c.Query("count"))
+
+	groups, total, err := ctrl.scimService.ListGroups(
+		c.Request.Context(), c.Query("filter"), startIndex, count, !membersExcluded(c),
+	)
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	resources := newSCIMGroupListResponse(c, groups)
+	scimJSON(c, http.StatusOK, scim.NewListResponse(resources, len(resources), total, startIndex))
+}
+
+// GetGroup returns a role with its members
+func (ctrl *SCIMController) GetGroup(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+
+	group, err := ctrl.scimService.GetGroup(c.Request.Context(), id)
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	resource := newSCIMGroupResource(c, group)
+	if membersExcluded(c) {
+		resource.Members = nil
+	}
+	scimJSON(c, http.StatusOK, resource)
+}
+
+// CreateGroup creates a custom role
+func (ctrl *SCIMController) CreateGroup(c *gin.Context) {
+	var req scimGroupRequest
+	if !bindSCIM(c, &req) {
+		return
+	}
+
+	group, err := ctrl.scimService.CreateGroup(c.Request.Context(), req.DisplayName, req.memberIDs())
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	resource := newSCIMGroupResource(c, group)
+	c.Header("Location", resource.Meta.Location)
+	scimJSON(c, http.StatusCreated, resource)
+}
+
+// ReplaceGroup sets the members of a role
+func (ctrl *SCIMController) ReplaceGroup(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var req scimGroupRequest
+	if !bindSCIM(c, &req) {
+		return
+	}
+
+	group, err := ctrl.scimService.ReplaceGroup(c.Request.Context(), id, req.DisplayName, req.memberIDs())
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, newSCIMGroupResource(c, group))
+}
+
+// PatchGroup adds and removes members of a role
+func (ctrl *SCIMController) PatchGroup(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+	var req scim.PatchRequest
+	if !bindSCIM(c, &req) {
+		return
+	}
+
+	group, err := ctrl.scimService.PatchGroup(c.Request.Context(), id, req.Operations)
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	scimJSON(c, http.StatusOK, newSCIMGroupResource(c, group))
+}
+
+// DeleteGroup deletes a custom role, moving its members to the user role
+func (ctrl *SCIMController) DeleteGroup(c *gin.Context) {
+	id, ok := scimID(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.scimService.DeleteGroup(c.Request.Context(), id); err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// handleError converts service errors into SCIM error responses
+func (ctrl *SCIMController) handleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		middleware.AbortSCIM(c, http.StatusNotFound, "", "Resource not found")
+	case errors.Is(err, services.ErrAlreadyMember),
+		errors.Is(err, services.ErrEmailTaken),
+		errors.Is(err, services.ErrRoleExists):
+		middleware.AbortSCIM(c, http.StatusConflict, scim.ErrorUniqueness, err.Error())
+	case errors.Is(err, services.ErrLastAdmin),
+		errors.Is(err, services.ErrRoleInUse):
+		middleware.AbortSCIM(c, http.StatusConflict, "", err.Error())
+	case errors.Is(err, services.ErrSystemRole):
+		middleware.AbortSCIM(c, http.StatusForbidden, "", err.Error())
+	case errors.Is(err, scim.ErrInvalidFilter):
+		middleware.AbortSCIM(c, http.StatusBadRequest, scim.ErrorInvalidFilter, err.Error())
+	case errors.Is(err, scim.ErrInvalidPath):
+		middleware.AbortSCIM(c, http.StatusBadRequest, scim.ErrorInvalidPath, err.Error())
+	case errors.Is(err, services.ErrSCIMInvalidValue),
+		errors.Is(err, services.ErrInvalidRoleName):
+		middleware.AbortSCIM(c, http.StatusBadRequest, scim.ErrorInvalidValue, err.Error())
+	case errors.Is(err, services.ErrSCIMMutability):
+		middleware.AbortSCIM(c, http.StatusBadRequest, scim.ErrorMutability, err.Error())
+	case errors.Is(err, services.ErrSCIMNoTarget):
+		middleware.AbortSCIM(c, http.StatusBadRequest, scim.ErrorNoTarget, err.Error())
+	default:
+		ctrl.logger.Errorw("SCIM request failed",
+			"error", err,
+			"path", c.Request.URL.Path,
+			"method", c.Request.Method,
+		)
+		middleware.AbortSCIM(c, http.StatusInternalServerError, "", "An internal server error occurred")
+	}
+}
+
+// scimJSON writes a SCIM response
+func scimJSON(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", scim.ContentType)
+	c.JSON(status, body)
+}
+
+// bindSCIM binds a SCIM request body, reporting failures as SCIM errors
+func bindSCIM(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		var syntaxError *json.SyntaxError
+		var typeError *json.UnmarshalTypeError
+		if errors.As(err, &syntaxError) || errors.As(err, &typeError) {
+			middleware.AbortSCIM(c, http.StatusBadRequest, scim.ErrorInvalidSyntax, err.Error())
+		} else {
+			middleware.AbortSCIM(c, http.StatusBadRequest, scim.ErrorInvalidValue, err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+// bindSCIMUser binds the body of a user creation or replacement
+func bindSCIMUser(c *gin.Context) (services.SCIMUserInput, bool) {
+	var req scimUserRequest
+	if !bindSCIM(c, &req) {
+		return services.SCIMUserInput{}, false
+	}
+	input, ok := req.input()
+	if !ok {
+		middleware.AbortSCIM(c, http.StatusBadRequest, scim.ErrorInvalidValue, "active must be a boolean")
+	}
+	return input, ok
+}
+
+// scimID parses the resource ID of the path. IDs are opaque to clients, so
+// one that is not a number is a resource that does not exist.
+func scimID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		middleware.AbortSCIM(c, http.StatusNotFound, "", "Resource not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// membersExcluded reports whether the client asked for groups without their
+// members, which can be large
+func membersExcluded(c *gin.Context) bool {
+	for _, attribute := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type createSCIMTokenRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type scimTokenResponse struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	CreatedByID int        `json:"created_by_id"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// createdSCIMTokenResponse is returned once when a token is created. The
+// token itself is not stored and cannot be retrieved again.
+type createdSCIMTokenResponse struct {
+	scimTokenResponse
+	Token string `json:"token"`
+}
+
+func newSCIMTokenResponse(token *models.SCIMToken) scimTokenResponse {
+	return scimTokenResponse{
+		ID:          token.ID,
+		Name:        token.Name,
+		Prefix:      token.Prefix,
+		CreatedByID: token.CreatedByID,
+		LastUsedAt:  token.LastUsedAt,
+		CreatedAt:   token.CreatedAt,
+	}
+}
+
+func newSCIMTokenListResponse(tokens []models.SCIMToken) []scimTokenResponse {
+	response := make([]scimTokenResponse, len(tokens))
+	for i := range tokens {
+		response[i] = newSCIMTokenResponse(&tokens[i])
+	}
+	return response
+}
+
+// SCIMTokenController handles the SCIM tokens of the active organization
+type SCIMTokenController struct {
+	scimTokenService *services.SCIMTokenService
+	logger           *zap.SugaredLogger
+}
+
+// NewSCIMTokenController creates a new SCIM token controller
+func NewSCIMTokenController(scimTokenService *services.SCIMTokenService, logger *zap.SugaredLogger) *SCIMTokenController {
+	return &SCIMTokenController{
+		scimTokenService: scimTokenService,
+		logger:           logger,
+	}
+}
+
+// List returns the SCIM tokens of the active organization
+func (ctrl *SCIMTokenController) List(c *gin.Context) {
+	tokens, err := ctrl.scimTokenService.List(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newSCIMTokenListResponse(tokens))
+}
+
+// Create issues a SCIM token provisioning the active organization
+func (ctrl *SCIMTokenController) Create(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req createSCIMTokenRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	created, err := ctrl.scimTokenService.Create(c.Request.Context(), userID, req.Name)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, createdSCIMTokenResponse{
+		scimTokenResponse: newSCIMTokenResponse(created.Token),
+		Token:             created.Secret,
+	})
+}
+
+// Revoke revokes a SCIM token of the active organization
+func (ctrl *SCIMTokenController) Revoke(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.scimTokenService.Revoke(c.Request.Context(), userID, id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
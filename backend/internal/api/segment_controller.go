@@ -0,0 +1,176 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type segmentQuery struct {
+	RecordType string `form:"record_type" binding:"omitempty,oneof=contact company deal"`
+}
+
+type segmentRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=1000"`
+	Rules       string `json:"rules" binding:"required,max=2000"` // such as "tag = vip AND last_activity < 30d"
+}
+
+type createSegmentRequest struct {
+	segmentRequest
+	RecordType string `json:"record_type" binding:"required,oneof=contact company deal"`
+}
+
+type segmentResponse struct {
+	ID          int        `json:"id"`
+	RecordType  string     `json:"record_type"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Rules       string     `json:"rules"`
+	MemberCount *int64     `json:"member_count,omitempty"` // only when the segment is fetched alone
+	EvaluatedAt *time.Time `json:"evaluated_at,omitempty"` // when the members were counted
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (req segmentRequest) input() services.SegmentInput {
+	return services.SegmentInput{
+		Name:        req.Name,
+		Description: req.Description,
+		Rules:       req.Rules,
+	}
+}
+
+func newSegmentResponse(segment *models.Segment) segmentResponse {
+	return segmentResponse{
+		ID:          segment.ID,
+		RecordType:  segment.RecordType,
+		Name:        segment.Name,
+		Description: segment.Description,
+		Rules:       segment.Rules,
+		CreatedAt:   segment.CreatedAt,
+		UpdatedAt:   segment.UpdatedAt,
+	}
+}
+
+func newSegmentMembersResponse(members *services.SegmentMembers) segmentResponse {
+	response := newSegmentResponse(members.Segment)
+	count, evaluatedAt := members.Count, members.EvaluatedAt
+	response.MemberCount, response.EvaluatedAt = &count, &evaluatedAt
+	return response
+}
+
+func newSegmentListResponse(segments []models.Segment) []segmentResponse {
+	response := make([]segmentResponse, len(segments))
+	for i := range segments {
+		response[i] = newSegmentResponse(&segments[i])
+	}
+	return response
+}
+
+// SegmentController handles the saved segments of the current organization
+type SegmentController struct {
+	segmentService *services.SegmentService
+	logger         *zap.SugaredLogger
+}
+
+// NewSegmentController creates a new segment controller
+func NewSegmentController(segmentService *services.SegmentService, logger *zap.SugaredLogger) *SegmentController {
+	return &SegmentController{
+		segmentService: segmentService,
+		logger:         logger,
+	}
+}
+
+// List returns the segments, optionally of one record type
+func (ctrl *SegmentController) List(c *gin.Context) {
+	var query segmentQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(middleware.NewBadRequestError("Invalid query", err.Error()))
+		return
+	}
+
+	segments, err := ctrl.segmentService.List(c.Request.Context(), query.RecordType)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newSegmentListResponse(segments))
+}
+
+// Create saves a segment
+func (ctrl *SegmentController) Create(c *gin.Context) {
+	var req createSegmentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	input := req.input()
+	input.RecordType = req.RecordType
+	segment, err := ctrl.segmentService.Create(c.Request.Context(), input)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newSegmentResponse(segment))
+}
+
+// Get returns a single segment with the number of its members
+func (ctrl *SegmentController) Get(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	members, err := ctrl.segmentService.Members(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newSegmentMembersResponse(members))
+}
+
+// Update replaces a segment's name, description and rules
+func (ctrl *SegmentController) Update(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req segmentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	segment, err := ctrl.segmentService.Update(c.Request.Context(), id, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newSegmentResponse(segment))
+}
+
+// Delete removes a segment
+func (ctrl *SegmentController) Delete(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.segmentService.Delete(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"go.uber.org/zap"
+)
+
+// segmentControllers returns controllers serving segment 1 of contacts and
+// segment 2 of companies, and contacts 1, tagged vip, and 2
+func segmentControllers() *controllers {
+	owned := models.TenantOwned{OrganizationID: testOrganizationID}
+	contacts := repotest.NewContacts(
+		models.Contact{ID: 1, TenantOwned: owned, FirstName: "Ada", Tags: []models.Tagging{{RecordType: models.RecordContact, RecordID: 1, Name: "vip"}}},
+		models.Contact{ID: 2, TenantOwned: owned, FirstName: "Grace"},
+	)
+	segments := repotest.NewSegments(contacts, repotest.NewCompanies(contacts), nil, nil,
+		models.Segment{ID: 1, OrganizationID: testOrganizationID, RecordType: models.RecordContact, Name: "VIPs", Rules: "tag = vip"},
+		models.Segment{ID: 2, OrganizationID: testOrganizationID, RecordType: models.RecordCompany, Name: "Partners", Rules: "tag = partner"},
+	)
+	fields := repotest.NewCustomFields()
+	_, organizations := testMembers()
+	logger := zap.NewNop().Sugar()
+	segmentService := services.NewSegmentService(segments, fields, logger)
+	return &controllers{
+		segments: NewSegmentController(segmentService, logger),
+		contacts: NewContactController(services.NewContactService(contacts, organizations, fields, segmentService, logger), logger),
+	}
+}
+
+func TestSegmentRoutesRequirePermissions(t *testing.T) {
+	read := []string{models.PermissionSegmentsRead}
+	write := []string{models.PermissionSegmentsWrite}
+	segment := map[string]interface{}{"name": "Key accounts", "rules": "tag = vip and last_activity < 30d"}
+	newSegment := map[string]interface{}{"record_type": "deal", "name": "Stale", "rules": "updated_at > 2w"}
+
+	checkRoutePermissions(t, segmentControllers, []protectedRoute{
+		{http.MethodGet, "/segments", nil, read, http.StatusOK},
+		{http.MethodGet, "/segments/1", nil, read, http.StatusOK},
+		{http.MethodPost, "/segments", newSegment, write, http.StatusCreated},
+		{http.MethodPut, "/segments/1", segment, write, http.StatusOK},
+		{http.MethodDelete, "/segments/1", nil, write, http.StatusNoContent},
+		// listing the members of a segment takes the permission on its records
+		{http.MethodGet, "/contacts?segment=1", nil, []string{models.PermissionContactsRead}, http.StatusOK},
+	})
+}
+
+func TestSegmentControllerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    interface{}
+		status  int
+		message string
+	}{
+		{"missing rules", http.MethodPost, "/segments", map[string]interface{}{"record_type": "contact", "name": "VIPs"},
+			http.StatusBadRequest, "Invalid request body"},
+		{"unknown record type", http.MethodPost, "/segments", map[string]interface{}{"record_type": "task", "name": "Mine", "rules": "tag = a"},
+			http.StatusBadRequest, "Invalid request body"},
+		{"rules too long for the request", http.MethodPut, "/segments/1", map[string]interface{}{"name": "VIPs", "rules": "tag = " + strings.Repeat("a", 2000)},
+			http.StatusBadRequest, "Invalid request body"},
+		{"invalid rules", http.MethodPut, "/segments/1", map[string]interface{}{"name": "VIPs", "rules": "tag = vip or"},
+			http.StatusBadRequest, `invalid segment rules: expected a field, got "end of rules"`},
+		{"unknown field", http.MethodPut, "/segments/1", map[string]interface{}{"name": "VIPs", "rules": "stage = won"},
+			http.StatusBadRequest, `invalid segment rules: unknown field "stage"`},
+		{"taken name", http.MethodPost, "/segments", map[string]interface{}{"record_type": "contact", "name": "VIPs", "rules": "tag = vip"},
+			http.StatusConflict, services.ErrSegmentExists.Error()},
+		{"missing segment", http.MethodGet, "/segments/9", nil, http.StatusNotFound, "Resource not found"},
+		{"delete of a missing segment", http.MethodDelete, "/segments/9", nil, http.StatusNotFound, "Resource not found"},
+		{"invalid ID", http.MethodGet, "/segments/abc", nil, http.StatusBadRequest, "Invalid id"},
+		{"listing of an unknown record type", http.MethodGet, "/segments?record_type=task", nil, http.StatusBadRequest, "Invalid query"},
+		{"listing of contacts in a company segment", http.MethodGet, "/contacts?segment=2", nil,
+			http.StatusBadRequest, services.ErrInvalidSegment.Error()},
+		{"listing of contacts in a missing segment", http.MethodGet, "/contacts?segment=9", nil,
+			http.StatusBadRequest, services.ErrInvalidSegment.Error()},
+		{"listing of contacts in an invalid segment", http.MethodGet, "/contacts?segment=-1", nil, http.StatusBadRequest, "Invalid query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := protectedEngine(segmentControllers(),
+				models.PermissionSegmentsRead, models.PermissionSegmentsWrite, models.PermissionContactsRead)
+			status, response := serve(t, engine, tt.method, tt.path, tt.body)
+			if status != tt.status || errorMessage(response) != tt.message {
+				t.Errorf("got %d %q, want %d %q", status, errorMessage(response), tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestSegmentControllerGetCountsMembers(t *testing.T) {
+	engine := protectedEngine(segmentControllers(), models.PermissionSegmentsRead)
+
+	status, response := serve(t, engine, http.MethodGet, "/segments/1", nil)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %v", status, response)
+	}
+	if data := responseData(response); data["member_count"] != float64(1) || data["evaluated_at"] == nil {
+		t.Errorf("segment = %v, want its member count", data)
+	}
+
+	engine = protectedEngine(segmentControllers(), models.PermissionSegmentsRead, models.PermissionContactsRead)
+	status, response = serve(t, engine, http.MethodGet, "/contacts?segment=1", nil)
+	contacts, _ := response["data"].([]interface{})
+	if status != http.StatusOK || len(contacts) != 1 || contacts[0].(map[string]interface{})["first_name"] != "Ada" {
+		t.Errorf("got %d %v, want the VIP contact", status, response)
+	}
+
+	// listings of segments do not count their members
+	status, response = serve(t, engine, http.MethodGet, "/segments?record_type=company", nil)
+	segments, _ := response["data"].([]interface{})
+	if status != http.StatusOK || len(segments) != 1 {
+		t.Fatalf("got %d %v, want the company segment", status, response)
+	}
+	if segment := segments[0].(map[string]interface{}); segment["name"] != "Partners" || segment["member_count"] != nil {
+		t.Errorf("segment = %v", segment)
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type createServiceAccountRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=1000"`
+	Role        string `json:"role" binding:"required"`
+}
+
+type serviceAccountResponse struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newServiceAccountResponse(details *services.ServiceAccountDetails) serviceAccountResponse {
+	return serviceAccountResponse{
+		ID:          details.Account.ID,
+		UserID:      details.Account.UserID,
+		Name:        details.Account.Name,
+		Description: details.Account.Description,
+		Role:        details.Role,
+		CreatedAt:   details.Account.CreatedAt,
+	}
+}
+
+// ServiceAccountController handles the service accounts of the current
+// organization and their API keys
+type ServiceAccountController struct {
+	serviceAccountService *services.ServiceAccountService
+	logger                *zap.SugaredLogger
+}
+
+// NewServiceAccountController creates a new service account controller
+func NewServiceAccountController(serviceAccountService *services.ServiceAccountService, logger *zap.SugaredLogger) *ServiceAccountController {
+	return &ServiceAccountController{
+		serviceAccountService: serviceAccountService,
+		logger:                logger,
+	}
+}
+
+// List returns the service accounts of the current organization
+func (ctrl *ServiceAccountController) List(c *gin.Context) {
+	accounts, err := ctrl.serviceAccountService.List(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := make([]serviceAccountResponse, len(accounts))
+	for i := range accounts {
+		response[i] = newServiceAccountResponse(&accounts[i])
+	}
+	utils.SuccessResponse(c, http.StatusOK, response)
+}
+
+// Create adds a service account to the current organization
+func (ctrl *ServiceAccountController) Create(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req createServiceAccountRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	account, err := ctrl.serviceAccountService.Create(c.Request.Context(), userID, services.ServiceAccountInput{
+		Name:        req.Name,
+		Description: req.Description,
+		Role:        req.Role,
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newServiceAccountResponse(account))
+}
+
+// Delete removes a service account and revokes its API keys
+func (ctrl *ServiceAccountController) Delete(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.serviceAccountService.Delete(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListKeys returns the API keys of a service account
+func (ctrl *ServiceAccountController) ListKeys(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	keys, err := ctrl.serviceAccountService.ListKeys(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newAPIKeyListResponse(keys))
+}
+
+// CreateKey issues an API key acting as a service account
+func (ctrl *ServiceAccountController) CreateKey(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req createAPIKeyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	created, err := ctrl.serviceAccountService.CreateKey(c.Request.Context(), id, userID, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newCreatedAPIKeyResponse(created))
+}
+
+// RevokeKey revokes an API key of a service account
+func (ctrl *ServiceAccountController) RevokeKey(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	keyID, ok := pathID(c, "keyId")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.serviceAccountService.RevokeKey(c.Request.Context(), id, keyID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
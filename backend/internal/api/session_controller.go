@@ -0,0 +1,130 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type sessionResponse struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	UserAgent      string    `json:"user_agent"`
+	IPAddress      string    `json:"ip_address"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastActiveAt   time.Time `json:"last_active_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	Current        bool      `json:"current"` // the session of the token making the request
+}
+
+func newSessionListResponse(sessions []models.Session, currentSessionID string) []sessionResponse {
+	response := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = sessionResponse{
+			ID:             session.ID,
+			OrganizationID: session.OrganizationID,
+			UserAgent:      session.UserAgent,
+			IPAddress:      session.IPAddress,
+			CreatedAt:      session.CreatedAt,
+			LastActiveAt:   session.LastActiveAt,
+			ExpiresAt:      session.ExpiresAt,
+			Current:        strconv.Itoa(session.ID) == currentSessionID,
+		}
+	}
+	return response
+}
+
+// SessionController handles the sign-in sessions of the current user and,
+// for admins, of the members of their organization
+type SessionController struct {
+	sessionService *services.SessionService
+	logger         *zap.SugaredLogger
+}
+
+// NewSessionController creates a new session controller
+func NewSessionController(sessionService *services.SessionService, logger *zap.SugaredLogger) *SessionController {
+	return &SessionController{
+		sessionService: sessionService,
+		logger:         logger,
+	}
+}
+
+// List returns the current user's active sessions
+func (ctrl *SessionController) List(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := ctrl.sessionService.List(c.Request.Context(), userID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newSessionListResponse(sessions, c.GetString("session_id")))
+}
+
+// Revoke signs the current user out of one of their sessions
+func (ctrl *SessionController) Revoke(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.sessionService.Revoke(c.Request.Context(), userID, id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListForUser returns the active sessions of a member of the current organization
+func (ctrl *SessionController) ListForUser(c *gin.Context) {
+	userID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	sessions, err := ctrl.sessionService.ListForMember(c.Request.Context(), userID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newSessionListResponse(sessions, c.GetString("session_id")))
+}
+
+// RevokeForUser signs a member of the current organization out of one of their sessions
+func (ctrl *SessionController) RevokeForUser(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	userID, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	sessionID, ok := pathID(c, "sessionId")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.sessionService.RevokeForMember(c.Request.Context(), adminID, userID, sessionID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
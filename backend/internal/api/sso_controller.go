@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type ssoCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+type ssoProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+type ssoAuthorizationResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+	ExpiresIn        int64  `json:"expires_in"`
+}
+
+// SSOController handles sign-in through OpenID providers
+type SSOController struct {
+	ssoService *services.SSOService
+	logger     *zap.SugaredLogger
+}
+
+// NewSSOController creates a new single sign-on controller
+func NewSSOController(ssoService *services.SSOService, logger *zap.SugaredLogger) *SSOController {
+	return &SSOController{
+		ssoService: ssoService,
+		logger:     logger,
+	}
+}
+
+// ListProviders returns the names of the providers users can sign in with
+func (ctrl *SSOController) ListProviders(c *gin.Context) {
+	utils.SuccessResponse(c, http.StatusOK, ssoProvidersResponse{Providers: ctrl.ssoService.Providers()})
+}
+
+// Authorize starts a sign-in and returns the provider URL to send the user
+// to. The client keeps the state to check it when the user comes back.
+func (ctrl *SSOController) Authorize(c *gin.Context) {
+	authorization, err := ctrl.ssoService.Authorize(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, ssoAuthorizationResponse{
+		AuthorizationURL: authorization.URL,
+		State:            authorization.State,
+		ExpiresIn:        authorization.ExpiresIn,
+	})
+}
+
+// Callback completes a sign-in with the code and state the provider
+// redirected back with. Like a password login it may return an MFA challenge.
+func (ctrl *SSOController) Callback(c *gin.Context) {
+	var req ssoCallbackRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	result, err := ctrl.ssoService.Callback(c.Request.Context(), c.Param("provider"), req.Code, req.State)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	respondAuthResult(c, result)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type tagQuery struct {
+	RecordType string `form:"record_type" binding:"omitempty,oneof=contact company deal"`
+}
+
+type bulkTagRequest struct {
+	IDs    []int    `json:"ids" binding:"required,min=1,max=500,dive,min=1"`
+	Add    []string `json:"add" binding:"max=50,dive,max=100"`
+	Remove []string `json:"remove" binding:"max=50,dive,max=100"`
+}
+
+type tagResponse struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"` // the number of records carrying the tag
+}
+
+type tagChangesResponse struct {
+	Added   int64 `json:"added"`
+	Removed int64 `json:"removed"`
+}
+
+func newTagListResponse(tags []repository.TagCount) []tagResponse {
+	response := make([]tagResponse, len(tags))
+	for i, tag := range tags {
+		response[i] = tagResponse{Name: tag.Name, Count: tag.Count}
+	}
+	return response
+}
+
+// TagController handles the tags of the current organization's records
+type TagController struct {
+	tagService *services.TagService
+	logger     *zap.SugaredLogger
+}
+
+// NewTagController creates a new tag controller
+func NewTagController(tagService *services.TagService, logger *zap.SugaredLogger) *TagController {
+	return &TagController{
+		tagService: tagService,
+		logger:     logger,
+	}
+}
+
+// List returns the tags in use, optionally on one record type
+func (ctrl *TagController) List(c *gin.Context) {
+	var query tagQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(middleware.NewBadRequestError("Invalid query", err.Error()))
+		return
+	}
+
+	tags, err := ctrl.tagService.List(c.Request.Context(), query.RecordType)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newTagListResponse(tags))
+}
+
+// ChangeContacts adds and removes tags on many contacts
+func (ctrl *TagController) ChangeContacts(c *gin.Context) {
+	ctrl.change(c, models.RecordContact)
+}
+
+// ChangeCompanies adds and removes tags on many companies
+func (ctrl *TagController) ChangeCompanies(c *gin.Context) {
+	ctrl.change(c, models.RecordCompany)
+}
+
+// ChangeDeals adds and removes tags on many deals
+func (ctrl *TagController) ChangeDeals(c *gin.Context) {
+	ctrl.change(c, models.RecordDeal)
+}
+
+// change adds and removes tags on many records of a type
+func (ctrl *TagController) change(c *gin.Context, recordType string) {
+	var req bulkTagRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	changes, err := ctrl.tagService.Change(c.Request.Context(), recordType, req.IDs, req.Add, req.Remove)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, tagChangesResponse{Added: changes.Added, Removed: changes.Removed})
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"go.uber.org/zap"
+)
+
+// tagControllers returns controllers serving contact, company and deal 1
+func tagControllers() *controllers {
+	owned := models.TenantOwned{OrganizationID: testOrganizationID}
+	contacts := repotest.NewContacts(models.Contact{ID: 1, TenantOwned: owned, FirstName: "Ada"})
+	companies := repotest.NewCompanies(contacts, models.Company{ID: 1, TenantOwned: owned, Name: "Acme"})
+	deals := repotest.NewDeals(companies, models.Deal{ID: 1, TenantOwned: owned, Title: "Renewal"})
+	logger := zap.NewNop().Sugar()
+	segments := services.NewSegmentService(repotest.NewSegments(contacts, companies, deals, nil), repotest.NewCustomFields(), logger)
+	service := services.NewTagService(
+		repotest.NewTags(contacts, companies, deals), contacts, companies, deals, segments, repotest.Transactor{}, logger,
+	)
+	return &controllers{tags: NewTagController(service, logger)}
+}
+
+func TestTagRoutesRequirePermissions(t *testing.T) {
+	change := map[string]interface{}{"ids": []int{1}, "add": []string{"vip"}}
+
+	checkRoutePermissions(t, tagControllers, []protectedRoute{
+		// every member sees the tags in use
+		{http.MethodGet, "/tags", nil, nil, http.StatusOK},
+		{http.MethodPost, "/contacts/tags", change, []string{models.PermissionContactsWrite}, http.StatusOK},
+		{http.MethodPost, "/companies/tags", change, []string{models.PermissionCompaniesWrite}, http.StatusOK},
+		{http.MethodPost, "/deals/tags", change, []string{models.PermissionDealsWrite}, http.StatusOK},
+	})
+}
+
+func TestTagControllerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		body    interface{}
+		status  int
+		message string
+	}{
+		{"no records", "/contacts/tags", map[string]interface{}{"ids": []int{}, "add": []string{"vip"}},
+			http.StatusBadRequest, "Invalid request body"},
+		{"invalid record ID", "/contacts/tags", map[string]interface{}{"ids": []int{0}, "add": []string{"vip"}},
+			http.StatusBadRequest, "Invalid request body"},
+		{"too many records", "/contacts/tags", map[string]interface{}{"ids": make([]int, 501), "add": []string{"vip"}},
+			http.StatusBadRequest, "Invalid request body"},
+		{"tag too long", "/contacts/tags", map[string]interface{}{"ids": []int{1}, "add": []string{strings.Repeat("a", 101)}},
+			http.StatusBadRequest, "Invalid request body"},
+		{"no tags", "/contacts/tags", map[string]interface{}{"ids": []int{1}, "add": []string{" "}},
+			http.StatusBadRequest, services.ErrNoTagChanges.Error()},
+		{"missing record", "/deals/tags", map[string]interface{}{"ids": []int{1, 2}, "remove": []string{"vip"}},
+			http.StatusBadRequest, services.ErrInvalidRecord.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := protectedEngine(tagControllers(), models.PermissionContactsWrite, models.PermissionDealsWrite)
+			status, response := serve(t, engine, http.MethodPost, tt.path, tt.body)
+			if status != tt.status || errorMessage(response) != tt.message {
+				t.Errorf("got %d %q, want %d %q", status, errorMessage(response), tt.status, tt.message)
+			}
+		})
+	}
+
+	engine := protectedEngine(tagControllers())
+	if status, response := serve(t, engine, http.MethodGet, "/tags?record_type=task", nil); status != http.StatusBadRequest || errorMessage(response) != "Invalid query" {
+		t.Errorf("listing of an unknown record type: got %d %q", status, errorMessage(response))
+	}
+}
+
+func TestTagControllerChange(t *testing.T) {
+	engine := protectedEngine(tagControllers(), models.PermissionCompaniesWrite)
+
+	status, response := serve(t, engine, http.MethodPost, "/companies/tags", map[string]interface{}{
+		"ids": []int{1, 1}, "add": []string{"VIP", "partner"}, "remove": []string{"lead"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %v", status, response)
+	}
+	if data := responseData(response); data["added"] != float64(2) || data["removed"] != float64(0) {
+		t.Errorf("changes = %v, want two tags added to the company", data)
+	}
+}
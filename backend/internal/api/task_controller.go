@@ -0,0 +1,261 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+type taskQuery struct {
+	AssigneeID int    `form:"assignee_id" binding:"omitempty,min=1"`
+	Status     string `form:"status" binding:"omitempty,oneof=open in_progress done cancelled"`
+	Priority   string `form:"priority" binding:"omitempty,oneof=low medium high"`
+	RecordType string `form:"record_type" binding:"omitempty,oneof=contact company deal"`
+	RecordID   int    `form:"record_id" binding:"omitempty,min=1"`
+	Segment    int    `form:"segment" binding:"omitempty,min=1"`
+}
+
+type myTasksQuery struct {
+	View     string `form:"view" binding:"required,oneof=overdue today upcoming"`
+	Timezone string `form:"timezone" binding:"omitempty,timezone"` // such as "Asia/Vientiane", defaults to UTC
+}
+
+type taskRequest struct {
+	Title       string     `json:"title" binding:"required,max=255"`
+	Description string     `json:"description" binding:"max=10000"`
+	AssigneeID  *int       `json:"assignee_id" binding:"omitempty,min=1"` // defaults to the creator on create
+	DueAt       *time.Time `json:"due_at"`
+	RemindAt    *time.Time `json:"remind_at"` // defaults to the due time
+	Priority    string     `json:"priority" binding:"omitempty,oneof=low medium high"`
+	Status      string     `json:"status" binding:"omitempty,oneof=open in_progress done cancelled"`
+	RecordType  string     `json:"record_type" binding:"omitempty,oneof=contact company deal"`
+	RecordID    *int       `json:"record_id" binding:"omitempty,min=1"`
+}
+
+type taskResponse struct {
+	ID          int           `json:"id"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	AssigneeID  *int          `json:"assignee_id"`
+	Assignee    *userResponse `json:"assignee,omitempty"`
+	CreatedByID *int          `json:"created_by_id"`
+	DueAt       *time.Time    `json:"due_at"`
+	RemindAt    *time.Time    `json:"remind_at"`
+	RemindedAt  *time.Time    `json:"reminded_at"`
+	Priority    string        `json:"priority"`
+	Status      string        `json:"status"`
+	RecordType  string        `json:"record_type,omitempty"`
+	RecordID    *int          `json:"record_id,omitempty"`
+	CompletedAt *time.Time    `json:"completed_at"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+func (req taskRequest) input() services.TaskInput {
+	return services.TaskInput{
+		Title:       req.Title,
+		Description: req.Description,
+		AssigneeID:  req.AssigneeID,
+		DueAt:       req.DueAt,
+		RemindAt:    req.RemindAt,
+		Priority:    req.Priority,
+		Status:      req.Status,
+		RecordType:  req.RecordType,
+		RecordID:    req.RecordID,
+	}
+}
+
+func newTaskResponse(task *models.Task) taskResponse {
+	response := taskResponse{
+		ID:          task.ID,
+		Title:       task.Title,
+		Description: task.Description,
+		AssigneeID:  task.AssigneeID,
+		CreatedByID: task.CreatedByID,
+		DueAt:       task.DueAt,
+		RemindAt:    task.RemindAt,
+		RemindedAt:  task.RemindedAt,
+		Priority:    task.Priority,
+		Status:      task.Status,
+		RecordType:  task.RecordType,
+		RecordID:    task.RecordID,
+		CompletedAt: task.CompletedAt,
+		CreatedAt:   task.CreatedAt,
+		UpdatedAt:   task.UpdatedAt,
+	}
+	if task.Assignee != nil {
+		assignee := newUserResponse(task.Assignee)
+		response.Assignee = &assignee
+	}
+	return response
+}
+
+func newTaskListResponse(tasks []models.Task) []taskResponse {
+	response := make([]taskResponse, len(tasks))
+	for i := range tasks {
+		response[i] = newTaskResponse(&tasks[i])
+	}
+	return response
+}
+
+// TaskController handles the tasks of the current organization
+type TaskController struct {
+	taskService *services.TaskService
+	logger      *zap.SugaredLogger
+}
+
+// NewTaskController creates a new task controller
+func NewTaskController(taskService *services.TaskService, logger *zap.SugaredLogger) *TaskController {
+	return &TaskController{
+		taskService: taskService,
+		logger:      logger,
+	}
+}
+
+// List returns a page of tasks, filtered and sorted by the query
+func (ctrl *TaskController) List(c *gin.Context) {
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	var query taskQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(middleware.NewBadRequestError("Invalid query", err.Error()))
+		return
+	}
+	filters, ok := listFilters(c, repository.TaskFields, false)
+	if !ok {
+		return
+	}
+
+	tasks, total, err := ctrl.taskService.List(c.Request.Context(), repository.TaskFilter{
+		AssigneeID: query.AssigneeID,
+		Status:     query.Status,
+		Priority:   query.Priority,
+		RecordType: query.RecordType,
+		RecordID:   query.RecordID,
+		Segment:    query.Segment,
+		Filters:    filters,
+	}, page, pageSize)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.PaginationResponse(c, http.StatusOK, newTaskListResponse(tasks), page, pageSize, int(total))
+}
+
+// Mine returns a page of the current user's overdue, today's or upcoming tasks
+func (ctrl *TaskController) Mine(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	var query myTasksQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		_ = c.Error(middleware.NewBadRequestError("Invalid query", err.Error()))
+		return
+	}
+	loc := time.UTC
+	if query.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(query.Timezone); err != nil {
+			_ = c.Error(middleware.NewBadRequestError("Invalid query", err.Error()))
+			return
+		}
+	}
+
+	tasks, total, err := ctrl.taskService.Mine(c.Request.Context(), userID, query.View, loc, page, pageSize)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.PaginationResponse(c, http.StatusOK, newTaskListResponse(tasks), page, pageSize, int(total))
+}
+
+// Create adds a task created by the current user
+func (ctrl *TaskController) Create(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req taskRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	task, err := ctrl.taskService.Create(c.Request.Context(), userID, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, newTaskResponse(task))
+}
+
+// Get returns a single task
+func (ctrl *TaskController) Get(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	task, err := ctrl.taskService.Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newTaskResponse(task))
+}
+
+// Update replaces a task's details
+func (ctrl *TaskController) Update(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req taskRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	task, err := ctrl.taskService.Update(c.Request.Context(), id, req.input())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, newTaskResponse(task))
+}
+
+// Delete removes a task
+func (ctrl *TaskController) Delete(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := ctrl.taskService.Delete(c.Request.Context(), id); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/services"
+	"go.uber.org/zap"
+)
+
+// taskControllers returns controllers serving contact 1 and task 1 with the
+// given tasks, assigned to the test user
+func taskControllers(tasks ...models.Task) *controllers {
+	owned := models.TenantOwned{OrganizationID: testOrganizationID}
+	assignee := testUserID
+	tasks = append([]models.Task{{
+		ID: 1, TenantOwned: owned, Title: "Call back", AssigneeID: &assignee, Priority: models.TaskMedium, Status: models.TaskOpen,
+	}}, tasks...)
+	contacts := repotest.NewContacts(models.Contact{ID: 1, TenantOwned: owned, FirstName: "Ada"})
+	companies := repotest.NewCompanies(contacts)
+	_, organizations := testMembers()
+	service := services.NewTaskService(
+		repotest.NewTasks(repotest.NewUsers(models.User{ID: testUserID, Email: "tester@example.com"}), tasks...),
+		contacts, companies, repotest.NewDeals(companies), organizations, nil, zap.NewNop().Sugar(),
+	)
+	return &controllers{tasks: NewTaskController(service, zap.NewNop().Sugar())}
+}
+
+func TestTaskRoutesRequirePermissions(t *testing.T) {
+	read := []string{models.PermissionTasksRead}
+	write := []string{models.PermissionTasksWrite}
+	task := map[string]interface{}{"title": "Send quote", "record_type": "contact", "record_id": 1}
+
+	checkRoutePermissions(t, func() *controllers { return taskControllers() }, []protectedRoute{
+		{http.MethodGet, "/tasks", nil, read, http.StatusOK},
+		{http.MethodGet, "/tasks/mine?view=today", nil, read, http.StatusOK},
+		{http.MethodGet, "/tasks/1", nil, read, http.StatusOK},
+		{http.MethodPost, "/tasks", task, write, http.StatusCreated},
+		{http.MethodPut, "/tasks/1", task, write, http.StatusOK},
+		{http.MethodDelete, "/tasks/1", nil, write, http.StatusNoContent},
+	})
+}
+
+func TestTaskControllerErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    interface{}
+		status  int
+		message string
+	}{
+		{"missing title", http.MethodPost, "/tasks", map[string]interface{}{"priority": "high"}, http.StatusBadRequest, "Invalid request body"},
+		{"unknown priority", http.MethodPost, "/tasks", map[string]interface{}{"title": "Call", "priority": "urgent"},
+			http.StatusBadRequest, "Invalid request body"},
+		{"unknown status", http.MethodPut, "/tasks/1", map[string]interface{}{"title": "Call", "status": "blocked"},
+			http.StatusBadRequest, "Invalid request body"},
+		{"assignee outside the organization", http.MethodPost, "/tasks", map[string]interface{}{"title": "Call", "assignee_id": 9},
+			http.StatusBadRequest, services.ErrInvalidAssignee.Error()},
+		{"record type without an ID", http.MethodPost, "/tasks", map[string]interface{}{"title": "Call", "record_type": "contact"},
+			http.StatusBadRequest, services.ErrInvalidRecord.Error()},
+		{"missing record", http.MethodPut, "/tasks/1", map[string]interface{}{"title": "Call", "record_type": "deal", "record_id": 1},
+			http.StatusBadRequest, services.ErrInvalidRecord.Error()},
+		{"reminder after the due date", http.MethodPost, "/tasks", map[string]interface{}{
+			"title": "Call", "due_at": "2026-10-20T09:00:00Z", "remind_at": "2026-10-20T10:00:00Z",
+		}, http.StatusBadRequest, services.ErrInvalidReminder.Error()},
+		{"missing task", http.MethodGet, "/tasks/9", nil, http.StatusNotFound, "Resource not found"},
+		{"update of a missing task", http.MethodPut, "/tasks/9", map[string]interface{}{"title": "Call"}, http.StatusNotFound, "Resource not found"},
+		{"view missing", http.MethodGet, "/tasks/mine", nil, http.StatusBadRequest, "Invalid query"},
+		{"unknown view", http.MethodGet, "/tasks/mine?view=someday", nil, http.StatusBadRequest, "Invalid query"},
+		{"unknown timezone", http.MethodGet, "/tasks/mine?view=today&timezone=Mars/Olympus", nil, http.StatusBadRequest, "Invalid query"},
+		{"unknown sort", http.MethodGet, "/tasks?sort=title", nil, http.StatusBadRequest, "Invalid query"},
+		{"sort by a custom field", http.MethodGet, "/tasks?sort=-cf.tier", nil, http.StatusBadRequest, "Invalid query"},
+		{"unknown filter", http.MethodGet, "/tasks?filter[description][like]=call", nil, http.StatusBadRequest, "Invalid query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := protectedEngine(taskControllers(), models.PermissionTasksRead, models.PermissionTasksWrite)
+			status, response := serve(t, engine, tt.method, tt.path, tt.body)
+			if status != tt.status || errorMessage(response) != tt.message {
+				t.Errorf("got %d %q, want %d %q", status, errorMessage(response), tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestTaskControllerMine(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Vientiane")
+	if err != nil {
+		t.Skipf("no timezone database: %v", err)
+	}
+	now := time.Now()
+	year, month, day := now.In(loc).Date()
+	midnight := time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+	later := now.Add(midnight.Sub(now) / 2)
+
+	// task returns a task due at a time, assigned to the test user
+	task := func(id int, dueAt time.Time) models.Task {
+		assignee := testUserID
+		return models.Task{
+			ID: id, TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID}, Title: "Call",
+			AssigneeID: &assignee, DueAt: &dueAt, Priority: models.TaskMedium, Status: models.TaskOpen,
+		}
+	}
+	engine := protectedEngine(taskControllers(task(2, later), task(3, midnight)), models.PermissionTasksRead)
+
+	// tasks are due today until midnight in the given timezone
+	tests := []struct {
+		view string
+		want float64
+	}{
+		{"today", 2},
+		{"upcoming", 3},
+	}
+	for _, tt := range tests {
+		status, response := serve(t, engine, http.MethodGet, "/tasks/mine?timezone=Asia/Vientiane&view="+tt.view, nil)
+		if status != http.StatusOK {
+			t.Fatalf("%s: status = %d: %v", tt.view, status, response)
+		}
+		tasks, _ := response["data"].([]interface{})
+		if len(tasks) != 1 || tasks[0].(map[string]interface{})["id"] != tt.want {
+			t.Errorf("%s: tasks = %v, want task %v", tt.view, response["data"], tt.want)
+		}
+	}
+}
+
+func TestTaskControllerCreate(t *testing.T) {
+	engine := protectedEngine(taskControllers(), models.PermissionTasksWrite)
+
+	status, response := serve(t, engine, http.MethodPost, "/tasks", map[string]interface{}{
+		"title": "Send quote", "status": "done", "record_type": "contact", "record_id": 1,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("status = %d: %v", status, response)
+	}
+	data := responseData(response)
+	if data["assignee_id"] != float64(testUserID) || data["created_by_id"] != float64(testUserID) {
+		t.Errorf("assignee %v, creator %v, want the current user", data["assignee_id"], data["created_by_id"])
+	}
+	if data["priority"] != models.TaskMedium || data["completed_at"] == nil {
+		t.Errorf("task = %v, want a medium priority task completed now", data)
+	}
+}
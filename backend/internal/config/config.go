@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config holds all configuration for the application
@@ -11,6 +12,9 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	Auth     AuthConfig
+	Mail     MailConfig
+	SSO      SSOConfig
+	Reminder ReminderConfig
 }
 
 // ServerConfig holds server-specific configuration
@@ -31,8 +35,85 @@ type DatabaseConfig struct {
 
 // AuthConfig holds authentication-specific configuration
 type AuthConfig struct {
-	JWTSecret     string
-	TokenDuration int // in hours
+	JWTSecret       string
+	TokenDuration   int    // in hours
+	RevocationStore string // "postgres" or "memory"
+	JWTIssuer       string
+	JWTAudience     []string
+	JWTLeeway       int // allowed clock skew in seconds
+	// JWTKeyFiles maps key IDs to PEM files. When set, tokens are signed with
+	// the JWTActiveKeyID key instead of JWTSecret.
+	JWTKeyFiles    map[string]string
+	JWTActiveKeyID string
+	InvitationTTL  int    // in hours
+	MFAIssuer      string // application name shown in authenticator apps
+	// PasswordResetTTL (in minutes) and EmailVerificationTTL (in hours) bound
+	// how long emailed links work
+	PasswordResetTTL     int
+	EmailVerificationTTL int
+	// RequireVerifiedEmail keeps users who have not verified their email
+	// address out of protected routes
+	RequireVerifiedEmail bool
+	// After LoginBackoffAfter consecutive failed sign-ins the wait before the
+	// next attempt doubles with every failure; after LoginLockoutThreshold
+	// the account is locked for LoginLockoutDuration minutes
+	LoginBackoffAfter     int
+	LoginLockoutThreshold int
+	LoginLockoutDuration  int
+	// ImpersonationTTL (in minutes) bounds how long an admin can act as
+	// another user with one impersonation token
+	ImpersonationTTL int
+}
+
+// MailConfig holds outgoing email configuration
+type MailConfig struct {
+	Driver string // "stdout" or "file"
+	Dir    string // where the file driver stores messages
+	From   string
+	// AppURL is the base URL of the web app, used to build links in emails
+	AppURL string
+}
+
+// ReminderConfig holds the configuration of task reminders
+type ReminderConfig struct {
+	Notifier    string // "mail" or "log"
+	Interval    int    // how often due reminders are looked for, in seconds
+	DefaultLead int    // how long before it is due a task without a reminder time is reminded of, in minutes
+}
+
+// SSOConfig holds the OpenID Connect providers users can sign in with
+type SSOConfig struct {
+	Providers []OIDCProviderConfig
+}
+
+// OIDCProviderConfig describes a client registered with an OpenID provider.
+// Users signing in through it are provisioned into Organization.
+type OIDCProviderConfig struct {
+	Name         string // used in the SSO URLs
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// GroupsClaim names the ID token claim listing the user's groups
+	GroupsClaim string
+	// GroupRoles maps identity provider groups to CRM roles. The first
+	// mapping whose group the user is in wins.
+	GroupRoles []GroupRole
+	// DefaultRole is given to users in none of the mapped groups. When empty,
+	// such users cannot sign in.
+	DefaultRole string
+	// Organization is the slug of the organization users are provisioned into
+	Organization string
+	// AllowedDomains restricts sign-ins to users with a verified email in one
+	// of the domains. Any user of the provider may sign in when empty.
+	AllowedDomains []string
+}
+
+// GroupRole maps an identity provider group to a CRM role
+type GroupRole struct {
+	Group string
+	Role  string
 }
 
 // Load loads configuration from environment variables
@@ -52,6 +133,99 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("invalid token duration: %w", err)
 	}
 
+	revocationStore := getEnv("TOKEN_REVOCATION_STORE", "postgres")
+	if revocationStore != "postgres" && revocationStore != "memory" {
+		return nil, fmt.Errorf("invalid token revocation store: %q", revocationStore)
+	}
+
+	jwtLeeway, err := strconv.Atoi(getEnv("JWT_LEEWAY_SECONDS", "30"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT leeway: %w", err)
+	}
+
+	// JWT_KEYS has the form "kid1=/path/to/key1.pem,kid2=/path/to/key2.pem"
+	jwtKeyFiles, err := parseKeyValueList(getEnv("JWT_KEYS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT keys: %w", err)
+	}
+	jwtActiveKeyID := getEnv("JWT_ACTIVE_KEY", "")
+	if len(jwtKeyFiles) > 0 {
+		if _, ok := jwtKeyFiles[jwtActiveKeyID]; !ok {
+			return nil, fmt.Errorf("JWT_ACTIVE_KEY %q must be one of JWT_KEYS", jwtActiveKeyID)
+		}
+	}
+
+	invitationTTL, err := strconv.Atoi(getEnv("INVITATION_TTL_HOURS", "72"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid invitation TTL: %w", err)
+	}
+
+	passwordResetTTL, err := strconv.Atoi(getEnv("PASSWORD_RESET_TTL_MINUTES", "60"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid password reset TTL: %w", err)
+	}
+
+	emailVerificationTTL, err := strconv.Atoi(getEnv("EMAIL_VERIFICATION_TTL_HOURS", "48"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid email verification TTL: %w", err)
+	}
+
+	requireVerifiedEmail, err := strconv.ParseBool(getEnv("REQUIRE_VERIFIED_EMAIL", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid REQUIRE_VERIFIED_EMAIL: %w", err)
+	}
+
+	loginBackoffAfter, err := strconv.Atoi(getEnv("LOGIN_BACKOFF_AFTER", "3"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_BACKOFF_AFTER: %w", err)
+	}
+
+	loginLockoutThreshold, err := strconv.Atoi(getEnv("LOGIN_LOCKOUT_THRESHOLD", "10"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_LOCKOUT_THRESHOLD: %w", err)
+	}
+
+	loginLockoutDuration, err := strconv.Atoi(getEnv("LOGIN_LOCKOUT_MINUTES", "15"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOGIN_LOCKOUT_MINUTES: %w", err)
+	}
+
+	impersonationTTL, err := strconv.Atoi(getEnv("IMPERSONATION_TTL_MINUTES", "15"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid IMPERSONATION_TTL_MINUTES: %w", err)
+	}
+
+	ssoProviders, err := loadOIDCProviders()
+	if err != nil {
+		return nil, err
+	}
+
+	mailDriver := getEnv("MAIL_DRIVER", "stdout")
+	if mailDriver != "stdout" && mailDriver != "file" {
+		return nil, fmt.Errorf("invalid mail driver: %q", mailDriver)
+	}
+
+	reminderNotifier := getEnv("REMINDER_NOTIFIER", "mail")
+	if reminderNotifier != "mail" && reminderNotifier != "log" {
+		return nil, fmt.Errorf("invalid reminder notifier: %q", reminderNotifier)
+	}
+
+	reminderInterval, err := strconv.Atoi(getEnv("REMINDER_INTERVAL_SECONDS", "60"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid REMINDER_INTERVAL_SECONDS: %w", err)
+	}
+	if reminderInterval < 1 {
+		return nil, fmt.Errorf("REMINDER_INTERVAL_SECONDS must be positive, got %d", reminderInterval)
+	}
+
+	reminderLead, err := strconv.Atoi(getEnv("REMINDER_DEFAULT_LEAD_MINUTES", "60"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid REMINDER_DEFAULT_LEAD_MINUTES: %w", err)
+	}
+	if reminderLead < 0 {
+		return nil, fmt.Errorf("REMINDER_DEFAULT_LEAD_MINUTES must not be negative, got %d", reminderLead)
+	}
+
 	return &Config{
 		Server: ServerConfig{
 			Port: port,
@@ -66,12 +240,82 @@ func Load() (*Config, error) {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		Auth: AuthConfig{
-			JWTSecret:     getEnv("JWT_SECRET", "your-secret-key"),
-			TokenDuration: tokenDuration,
+			JWTSecret:       getEnv("JWT_SECRET", "your-secret-key"),
+			TokenDuration:   tokenDuration,
+			RevocationStore: revocationStore,
+			JWTIssuer:       getEnv("JWT_ISSUER", "lightweight-crm"),
+			JWTAudience:     splitList(getEnv("JWT_AUDIENCE", "api")),
+			JWTLeeway:       jwtLeeway,
+			JWTKeyFiles:     jwtKeyFiles,
+			JWTActiveKeyID:  jwtActiveKeyID,
+			InvitationTTL:   invitationTTL,
+			MFAIssuer:       getEnv("MFA_ISSUER", "Lightweight CRM"),
+
+			PasswordResetTTL:     passwordResetTTL,
+			EmailVerificationTTL: emailVerificationTTL,
+			RequireVerifiedEmail: requireVerifiedEmail,
+
+			LoginBackoffAfter:     loginBackoffAfter,
+			LoginLockoutThreshold: loginLockoutThreshold,
+			LoginLockoutDuration:  loginLockoutDuration,
+
+			ImpersonationTTL: impersonationTTL,
+		},
+		Mail: MailConfig{
+			Driver: mailDriver,
+			Dir:    getEnv("MAIL_DIR", "tmp/mail"),
+			From:   getEnv("MAIL_FROM", "Lightweight CRM <no-reply@localhost>"),
+			AppURL: strings.TrimSuffix(getEnv("APP_URL", "http://localhost:3000"), "/"),
+		},
+		SSO: SSOConfig{
+			Providers: ssoProviders,
+		},
+		Reminder: ReminderConfig{
+			Notifier:    reminderNotifier,
+			Interval:    reminderInterval,
+			DefaultLead: reminderLead,
 		},
 	}, nil
 }
 
+// loadOIDCProviders reads the providers listed in OIDC_PROVIDERS. Each
+// provider is configured with OIDC_<NAME>_* variables.
+func loadOIDCProviders() ([]OIDCProviderConfig, error) {
+	var providers []OIDCProviderConfig
+	for _, name := range splitList(getEnv("OIDC_PROVIDERS", "")) {
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		// OIDC_<NAME>_GROUP_ROLES has the form "group1=role1,group2=role2"
+		var groupRoles []GroupRole
+		for _, pair := range splitList(getEnv(prefix+"GROUP_ROLES", "")) {
+			group, role, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(group) == "" || strings.TrimSpace(role) == "" {
+				return nil, fmt.Errorf("invalid %sGROUP_ROLES: expected group=role, got %q", prefix, pair)
+			}
+			groupRoles = append(groupRoles, GroupRole{Group: strings.TrimSpace(group), Role: strings.TrimSpace(role)})
+		}
+
+		provider := OIDCProviderConfig{
+			Name:           name,
+			Issuer:         getEnv(prefix+"ISSUER", ""),
+			ClientID:       getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret:   getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:    getEnv(prefix+"REDIRECT_URL", ""),
+			Scopes:         splitList(getEnv(prefix+"SCOPES", "openid,email,profile")),
+			GroupsClaim:    getEnv(prefix+"GROUPS_CLAIM", "groups"),
+			GroupRoles:     groupRoles,
+			DefaultRole:    getEnv(prefix+"DEFAULT_ROLE", ""),
+			Organization:   getEnv(prefix+"ORGANIZATION", ""),
+			AllowedDomains: splitList(getEnv(prefix+"ALLOWED_DOMAINS", "")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" || provider.Organization == "" {
+			return nil, fmt.Errorf("OIDC provider %q needs %sISSUER, %sCLIENT_ID, %sREDIRECT_URL and %sORGANIZATION", name, prefix, prefix, prefix, prefix)
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
 // getEnv retrieves an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -80,3 +324,31 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// parseKeyValueList parses a comma separated list of key=value pairs
+func parseKeyValueList(value string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		result[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return result, nil
+}
+
+// splitList parses a comma separated list, dropping empty entries
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+// Package mailer sends transactional emails such as invitations. Delivery is
+// pluggable; the built-in mailers write messages to stdout or to files so the
+// application works without an SMTP server.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// WriterMailer writes messages in RFC 5322 format to a writer
+type WriterMailer struct {
+	from string
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+// NewStdoutMailer creates a mailer that prints messages to stdout
+func NewStdoutMailer(from string) *WriterMailer {
+	return NewWriterMailer(from, os.Stdout)
+}
+
+// NewWriterMailer creates a mailer that writes messages to w
+func NewWriterMailer(from string, w io.Writer) *WriterMailer {
+	return &WriterMailer{from: from, w: w}
+}
+
+// Send implements Mailer
+func (m *WriterMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := io.WriteString(m.w, format(m.from, msg)+"\n")
+	return err
+}
+
+// FileMailer stores every message as a .eml file in a directory
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+// NewFileMailer creates a mailer that writes messages to dir, creating it if needed
+func NewFileMailer(from, dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{from: from, dir: dir}, nil
+}
+
+// Send implements Mailer
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	suffix, err := utils.RandomToken(4)
+	if err != nil {
+		return err
+	}
+
+	// timestamped names keep the directory listing in delivery order
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + suffix + ".eml"
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(format(m.from, msg)), 0o600)
+}
+
+// headerSanitizer keeps user supplied values from injecting extra headers
+var headerSanitizer = strings.NewReplacer("\r", "", "\n", " ")
+
+// format renders the message with its headers
+func format(from string, msg Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerSanitizer.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerSanitizer.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerSanitizer.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	return b.String()
+}
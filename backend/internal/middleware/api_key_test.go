@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// stubAPIKeys authenticates the keys it holds
+type stubAPIKeys map[string]*APIKeyPrincipal
+
+func (s stubAPIKeys) AuthenticateAPIKey(ctx context.Context, key string) (*APIKeyPrincipal, error) {
+	principal, ok := s[key]
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	return principal, nil
+}
+
+// stubPermissions grants each user the permissions listed for them
+type stubPermissions map[string][]string
+
+func (s stubPermissions) HasPermissions(ctx context.Context, userId string, permissions ...string) (bool, error) {
+	for _, permission := range permissions {
+		granted := false
+		for _, held := range s[userId] {
+			granted = granted || held == permission
+		}
+		if !granted {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func TestAPIKeyScopesLimitPermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := testTokenConfig()
+	keys := stubAPIKeys{
+		"lcrm_reader": {KeyID: "1", UserId: "1", OrgId: "3", Role: "user", Scopes: []string{"contacts:read"}},
+		"lcrm_writer": {KeyID: "2", UserId: "2", OrgId: "3", Role: "user", Scopes: []string{"contacts:read", "contacts:write"}},
+		"lcrm_empty":  {KeyID: "3", UserId: "1", OrgId: "3", Role: "user", Scopes: []string{}},
+	}
+	// user 1 holds both permissions through their role, user 2 can only read
+	permissions := stubPermissions{
+		"1": {"contacts:read", "contacts:write"},
+		"2": {"contacts:read"},
+	}
+	token, err := GenerateToken("1", "3", "user", config)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	engine := gin.New()
+	authenticated := engine.Group("/", Authenticate(config, keys, zap.NewNop().Sugar()))
+	authenticated.GET("/read", RequirePermission(permissions, "contacts:read"), respondOK)
+	authenticated.GET("/write", RequirePermission(permissions, "contacts:write"), respondOK)
+	authenticated.GET("/account", DenyAPIKeys(), respondOK)
+
+	tests := []struct {
+		name   string
+		path   string
+		key    string
+		bearer string
+		status int
+		code   string
+	}{
+		{"scope and role grant the permission", "/read", "lcrm_reader", "", http.StatusOK, ""},
+		{"role grants the permission outside the scopes", "/write", "lcrm_reader", "", http.StatusForbidden, CodeForbidden},
+		{"key without scopes", "/read", "lcrm_empty", "", http.StatusForbidden, CodeForbidden},
+		{"scope without the role permission", "/write", "lcrm_writer", "", http.StatusForbidden, CodeForbidden},
+		{"access token is limited by the role alone", "/write", "", token, http.StatusOK, ""},
+		{"bearer token takes precedence over a key", "/write", "lcrm_reader", token, http.StatusOK, ""},
+		{"unknown key", "/read", "lcrm_unknown", "", http.StatusUnauthorized, CodeAPIKeyInvalid},
+		{"account routes deny keys", "/account", "lcrm_writer", "", http.StatusForbidden, CodeForbidden},
+		{"account routes allow access tokens", "/account", "", token, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.code == "" {
+				return
+			}
+			var response ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if response.Error == nil || response.Error.Code != tt.code {
+				t.Errorf("error = %+v, want code %s", response.Error, tt.code)
+			}
+		})
+	}
+}
+
+func respondOK(c *gin.Context) {
+	c.Status(http.StatusOK)
+}
@@ -1,13 +1,15 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
 	"go.uber.org/zap"
 )
 
@@ -15,8 +17,19 @@ type JWTConfig struct {
 	Secret            string
 	TokenExpiration   time.Duration
 	RefreshExpiration time.Duration
+	MFAExpiration     time.Duration // lifetime of MFA challenge tokens
 	Issuer            string
-	Audience          []string
+	Audience          []string      // tokens must be issued for at least one of these audiences
+	Leeway            time.Duration // allowed clock skew when validating token times
+	// Keys signs and verifies tokens with asymmetric keys. When nil, tokens
+	// are signed with Secret using HS256.
+	Keys *KeySet
+	// Revocations is consulted on every request when set, so that tokens
+	// revoked before they expire are rejected
+	Revocations RevocationStore
+	// RequireVerifiedEmail rejects access tokens of users who have not
+	// verified their email address
+	RequireVerifiedEmail bool
 }
 
 // DefaultJWTConfig returns a default JWT configuration
@@ -25,119 +38,230 @@ func DefaultJWTConfig() JWTConfig {
 		Secret:            "your-secret-key",  // This should be overridden with a real secret
 		TokenExpiration:   time.Hour * 24,     // 24 hours
 		RefreshExpiration: time.Hour * 24 * 7, // 7 days
+		MFAExpiration:     time.Minute * 5,
 		Issuer:            "lightweight-crm",
 		Audience:          []string{"api"},
+		Leeway:            time.Second * 30,
 	}
 }
 
 // JWTClaims represents custom JWT claims
 type JWTClaims struct {
-	UserId string `json:"user_id"`
-	Role   string `json:"role"`
+	UserId        string `json:"user_id"`
+	OrgId         string `json:"org_id,omitempty"` // active organization
+	Role          string `json:"role,omitempty"`   // role in the active organization
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	SessionId     string `json:"sid,omitempty"`             // sign-in session the access token was issued to
+	Impersonator  string `json:"impersonator_id,omitempty"` // admin acting as the user
+	TokenType     string `json:"token_type"`
 	jwt.RegisteredClaims
 }
 
 func JWT(config JWTConfig, logger *zap.SugaredLogger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.Request.Header.Get("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
-				Success: false,
-				Error: &ErrorData{
-					Code:    CodeUnauthorized,
-					Message: "Authorization header is missing",
-				},
-			})
-			return
+		if authenticateBearer(c, config, logger) {
+			c.Next()
 		}
+	}
+}
 
-		// validate the authorization format
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
-				Success: false,
-				Error: &ErrorData{
-					Code:    CodeUnauthorized,
-					Message: "Invalid authorization header format",
-				},
-			})
-			return
-		}
+// authenticateBearer validates the access token in the Authorization header
+// and stores the identity it carries in the request context. It aborts the
+// request and returns false when the token is missing or rejected.
+func authenticateBearer(c *gin.Context, config JWTConfig, logger *zap.SugaredLogger) bool {
+	authHeader := c.Request.Header.Get("Authorization")
+	if authHeader == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
+			Success: false,
+			Error: &ErrorData{
+				Code:    CodeUnauthorized,
+				Message: "Authorization header is missing",
+			},
+		})
+		return false
+	}
 
-		tokenString := parts[1]
-		claims := &JWTClaims{}
+	// validate the authorization format
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
+			Success: false,
+			Error: &ErrorData{
+				Code:    CodeUnauthorized,
+				Message: "Invalid authorization header format",
+			},
+		})
+		return false
+	}
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			// validate the token signature
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(config.Secret), nil
+	claims, err := ParseToken(parts[1], TokenTypeAccess, config)
+	if err != nil {
+		tokenErr := newTokenError(err)
+		logger.Debugw("Token rejected", "code", tokenErr.Code, "error", tokenErr.Err)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
+			Success: false,
+			Error: &ErrorData{
+				Code:    tokenErr.Code,
+				Message: tokenErr.Message,
+			},
 		})
+		return false
+	}
 
+	if config.Revocations != nil {
+		revoked, err := config.Revocations.IsRevoked(c.Request.Context(), claims)
 		if err != nil {
-			logger.Error(err)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
+			logger.Errorw("Failed to check token revocation", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{
 				Success: false,
 				Error: &ErrorData{
-					Code:    CodeUnauthorized,
-					Message: "Invalid token",
+					Code:    CodeInternalServerError,
+					Message: "An internal server error occurred",
 				},
 			})
-			return
+			return false
 		}
-
-		if !token.Valid {
+		if revoked {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
 				Success: false,
 				Error: &ErrorData{
-					Code:    CodeUnauthorized,
-					Message: "Invalid token",
+					Code:    CodeTokenRevoked,
+					Message: "Token has been revoked",
 				},
 			})
-			return
+			return false
 		}
+	}
 
-		c.Set("user_id", claims.UserId)
-		c.Set("role", claims.Role)
-		c.Next()
+	if config.RequireVerifiedEmail && !claims.EmailVerified {
+		c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+			Success: false,
+			Error: &ErrorData{
+				Code:    CodeEmailNotVerified,
+				Message: "Email address has not been verified",
+			},
+		})
+		return false
 	}
+
+	if !setIdentity(c, claims.UserId, claims.OrgId, claims.Role) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{
+			Success: false,
+			Error: &ErrorData{
+				Code:    CodeTokenInvalid,
+				Message: "Invalid token",
+			},
+		})
+		return false
+	}
+
+	c.Set("token_id", claims.ID)
+	c.Set("session_id", claims.SessionId)
+	if claims.Impersonator != "" {
+		setImpersonator(c, claims.Impersonator)
+	}
+	if claims.ExpiresAt != nil {
+		c.Set("token_expires_at", claims.ExpiresAt.Time)
+	}
+	return true
 }
 
-func GenerateToken(userId, role string, config JWTConfig) (string, error) {
-	now := time.Now()
-	claims := &JWTClaims{
+// setIdentity stores the authenticated user, organization and role in the
+// request context and scopes the request to the organization. It returns
+// false when the organization ID is malformed.
+func setIdentity(c *gin.Context, userId, orgId, role string) bool {
+	if orgId != "" {
+		organizationID, err := strconv.Atoi(orgId)
+		if err != nil {
+			return false
+		}
+		c.Request = c.Request.WithContext(tenant.WithOrganization(c.Request.Context(), organizationID))
+	}
+
+	c.Set("user_id", userId)
+	c.Set("org_id", orgId)
+	c.Set("role", role)
+	return true
+}
+
+// keySet returns the configured keys, falling back to the shared HMAC secret
+func (config JWTConfig) keySet() *KeySet {
+	if config.Keys != nil {
+		return config.Keys
+	}
+	return NewHMACKeySet(config.Secret)
+}
+
+// keyFunc returns the key used to validate a token signature
+func keyFunc(config JWTConfig) jwt.Keyfunc {
+	return config.keySet().Keyfunc
+}
+
+// GenerateToken signs an access token for the user acting in the given organization
+func GenerateToken(userId, orgId, role string, config JWTConfig) (string, error) {
+	return SignAccessToken(&JWTClaims{
 		UserId: userId,
+		OrgId:  orgId,
 		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    config.Issuer,
-			Audience:  config.Audience,
-			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(config.TokenExpiration)),
-			Subject:   userId,
-		},
+	}, config, config.TokenExpiration)
+}
+
+// SignAccessToken fills in the registered claims and signs an access token
+// that expires after ttl
+func SignAccessToken(claims *JWTClaims, config JWTConfig, ttl time.Duration) (string, error) {
+	return signToken(claims, TokenTypeAccess, config, ttl)
+}
+
+// GenerateMFAChallengeToken signs the short-lived token a user exchanges for
+// an access token once they pass the second factor
+func GenerateMFAChallengeToken(userId, orgId string, config JWTConfig) (string, error) {
+	return signToken(&JWTClaims{UserId: userId, OrgId: orgId}, TokenTypeMFAChallenge, config, config.MFAExpiration)
+}
+
+// signToken fills in the registered claims and signs a token of the given type
+func signToken(claims *JWTClaims, tokenType string, config JWTConfig, ttl time.Duration) (string, error) {
+	// a unique ID lets a single token be revoked before it expires
+	tokenId, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.TokenType = tokenType
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    config.Issuer,
+		Audience:  config.Audience,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		Subject:   claims.UserId,
+		ID:        tokenId,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.Secret))
+	tokenString, err := config.keySet().Sign(claims)
 	if err != nil {
 		return "", err
 	}
 	return tokenString, nil
 }
 
-func GenerateRefreshToken(userId string, config JWTConfig) (string, error) {
+// GenerateRefreshToken signs a refresh token for the user. The token ID must be
+// unique and is expected to be persisted so the token can be rotated or revoked.
+func GenerateRefreshToken(userId, tokenId string, config JWTConfig) (string, error) {
 	now := time.Now()
-	claims := jwt.RegisteredClaims{
-		Issuer:    config.Issuer,
-		Subject:   userId,
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(config.RefreshExpiration)),
-		ID:        fmt.Sprintf("refresh_%d", now.Unix()),
+	claims := &JWTClaims{
+		UserId:    userId,
+		TokenType: TokenTypeRefresh,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Issuer,
+			Audience:  config.Audience,
+			Subject:   userId,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(config.RefreshExpiration)),
+			ID:        tokenId,
+		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.Secret))
+	tokenString, err := config.keySet().Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+type clientKey struct{}
+
+// Client describes where a request came from
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// ClientInfo stores the client's IP address and user agent in the request
+// context, so that services can record them without depending on gin
+func ClientInfo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := context.WithValue(c.Request.Context(), clientKey{}, Client{
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// ClientFromContext returns the client stored by ClientInfo, or an empty
+// Client outside of requests
+func ClientFromContext(ctx context.Context) Client {
+	client, _ := ctx.Value(clientKey{}).(Client)
+	return client
+}
@@ -88,6 +88,8 @@ const (
 	CodeConflict            = "CONFLICT"
 	CodeValidationFailed    = "VALIDATION_FAILED"
 	CodeInternalServerError = "INTERNAL_SERVER_ERROR"
+	CodeEmailNotVerified    = "EMAIL_NOT_VERIFIED"
+	CodeTooManyRequests     = "TOO_MANY_REQUESTS"
 )
 
 // NewBadRequestError creates a bad request error
@@ -127,6 +129,24 @@ func NewNotFoundError(message string) *CustomError {
 	}
 }
 
+// NewConflictError creates a conflict error
+func NewConflictError(message string) *CustomError {
+	return &CustomError{
+		Code:       CodeConflict,
+		Message:    message,
+		StatusCode: http.StatusConflict,
+	}
+}
+
+// NewTooManyRequestsError creates a too many requests error
+func NewTooManyRequestsError(message string) *CustomError {
+	return &CustomError{
+		Code:       CodeTooManyRequests,
+		Message:    message,
+		StatusCode: http.StatusTooManyRequests,
+	}
+}
+
 // NewInternalServerError creates an internal server error
 func NewInternalServerError(message string) *CustomError {
 	return &CustomError{
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CodeImpersonationForbidden is returned for actions that are not allowed
+// while impersonating a user
+const CodeImpersonationForbidden = "IMPERSONATION_FORBIDDEN"
+
+type impersonatorKey struct{}
+
+// setImpersonator stores the ID of the admin acting as the authenticated user
+// in the gin context, as "impersonator_id", and in the request context
+func setImpersonator(c *gin.Context, impersonatorId string) {
+	c.Set("impersonator_id", impersonatorId)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), impersonatorKey{}, impersonatorId))
+}
+
+// ImpersonatorFromContext returns the ID of the admin impersonating the
+// authenticated user, if the request is made with an impersonation token
+func ImpersonatorFromContext(ctx context.Context) (string, bool) {
+	impersonatorId, ok := ctx.Value(impersonatorKey{}).(string)
+	return impersonatorId, ok
+}
+
+// DenyImpersonation rejects requests made while impersonating a user, for
+// routes that manage the account's credentials and security settings
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("impersonator_id"); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+				Success: false,
+				Error: &ErrorData{
+					Code:    CodeImpersonationForbidden,
+					Message: "This action is not allowed while impersonating a user",
+				},
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestDenyImpersonation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := testTokenConfig()
+	own, err := SignAccessToken(&JWTClaims{UserId: "3", OrgId: "3", Role: "user"}, config, time.Hour)
+	if err != nil {
+		t.Fatalf("SignAccessToken: %v", err)
+	}
+	impersonating, err := SignAccessToken(&JWTClaims{UserId: "3", OrgId: "3", Role: "user", Impersonator: "1"}, config, time.Hour)
+	if err != nil {
+		t.Fatalf("SignAccessToken: %v", err)
+	}
+
+	engine := gin.New()
+	authenticated := engine.Group("/", Authenticate(config, stubAPIKeys{}, zap.NewNop().Sugar()))
+	authenticated.GET("/contacts", func(c *gin.Context) {
+		impersonator, _ := ImpersonatorFromContext(c.Request.Context())
+		c.String(http.StatusOK, impersonator)
+	})
+	authenticated.GET("/account", DenyImpersonation(), respondOK)
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+		body   string
+	}{
+		{"impersonation reaches other routes", "/contacts", impersonating, http.StatusOK, "1"},
+		{"own token reaches other routes", "/contacts", own, http.StatusOK, ""},
+		{"impersonation is denied account routes", "/account", impersonating, http.StatusForbidden, ""},
+		{"own token reaches account routes", "/account", own, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != tt.body {
+				t.Errorf("impersonator = %q, want %q", rec.Body.String(), tt.body)
+			}
+		})
+	}
+}
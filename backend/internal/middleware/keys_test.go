@@ -0,0 +1,269 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeys are generated once, as RSA keys take a while to generate
+var testKeys = struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	ed  ed25519.PrivateKey
+}{}
+
+func init() {
+	var err error
+	if testKeys.rsa, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+	if testKeys.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		panic(err)
+	}
+	if _, testKeys.ed, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		panic(err)
+	}
+}
+
+// writePEM writes a key to a PEM file in the test's directory and returns its path
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func writePrivateKey(t *testing.T, name string, key crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal %s: %v", name, err)
+	}
+	return writePEM(t, name, "PRIVATE KEY", der)
+}
+
+func writePublicKey(t *testing.T, name string, key crypto.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("marshal %s: %v", name, err)
+	}
+	return writePEM(t, name, "PUBLIC KEY", der)
+}
+
+// loadTestKeySet loads a set that signs with the EC key "current" and also
+// verifies with the RSA key "retired", of which only the public key is kept
+func loadTestKeySet(t *testing.T) *KeySet {
+	t.Helper()
+	keys, err := LoadKeySet(map[string]string{
+		"current": writePrivateKey(t, "current", testKeys.ec),
+		"retired": writePublicKey(t, "retired", testKeys.rsa.Public()),
+		"edge":    writePrivateKey(t, "edge", testKeys.ed),
+	}, "current")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	return keys
+}
+
+// signWith signs test claims with a method and key, setting kid when not empty
+func signWith(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.RegisteredClaims{
+		Subject:   "1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestKeySetKeyfunc(t *testing.T) {
+	keys := loadTestKeySet(t)
+	signedByActive, err := keys.Sign(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(testKeys.ec.Public())
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error // nil when the token is valid
+	}{
+		{"signed by the active key", signedByActive, nil},
+		{"signed by a retired key", signWith(t, jwt.SigningMethodRS256, "retired", testKeys.rsa), nil},
+		{"signed by another active key", signWith(t, jwt.SigningMethodEdDSA, "edge", testKeys.ed), nil},
+		{"without a kid, checked against the active key", signWith(t, jwt.SigningMethodES256, "", testKeys.ec), nil},
+		{"unknown kid", signWith(t, jwt.SigningMethodES256, "unknown", testKeys.ec), jwt.ErrTokenUnverifiable},
+		{"algorithm of another key", signWith(t, jwt.SigningMethodEdDSA, "current", testKeys.ed), jwt.ErrSignatureInvalid},
+		// the public key must not be accepted as an HMAC secret
+		{"HMAC with the public key", signWith(t, jwt.SigningMethodHS256, "current", publicDER), jwt.ErrSignatureInvalid},
+		{"signed by a key outside the set", signWith(t, jwt.SigningMethodRS256, "retired", mustRSAKey(t)), jwt.ErrTokenSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(tt.token, keys.Keyfunc)
+			if tt.err == nil && err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("Parse = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func mustRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return key
+}
+
+func TestHMACKeySetRejectsAsymmetricTokens(t *testing.T) {
+	keys := NewHMACKeySet("secret")
+
+	if _, err := jwt.Parse(signWith(t, jwt.SigningMethodHS256, "", []byte("secret")), keys.Keyfunc); err != nil {
+		t.Fatalf("Parse of an HS256 token: %v", err)
+	}
+	if _, err := jwt.Parse(signWith(t, jwt.SigningMethodES256, "", testKeys.ec), keys.Keyfunc); !errors.Is(err, jwt.ErrSignatureInvalid) {
+		t.Fatalf("Parse of an ES256 token = %v, want %v", err, jwt.ErrSignatureInvalid)
+	}
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  func(t *testing.T) map[string]string
+		active string
+	}{
+		{"missing active key", func(t *testing.T) map[string]string {
+			return map[string]string{"current": writePrivateKey(t, "current", testKeys.ec)}
+		}, "other"},
+		{"active key without a private key", func(t *testing.T) map[string]string {
+			return map[string]string{"current": writePublicKey(t, "current", testKeys.ec.Public())}
+		}, "current"},
+		{"missing file", func(t *testing.T) map[string]string {
+			return map[string]string{"current": filepath.Join(t.TempDir(), "missing.pem")}
+		}, "current"},
+		{"not PEM", func(t *testing.T) map[string]string {
+			path := filepath.Join(t.TempDir(), "current.pem")
+			if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			return map[string]string{"current": path}
+		}, "current"},
+		{"unsupported curve", func(t *testing.T) map[string]string {
+			key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			der, err := x509.MarshalECPrivateKey(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return map[string]string{"current": writePEM(t, "current", "EC PRIVATE KEY", der)}
+		}, "current"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadKeySet(tt.files(t), tt.active); err == nil {
+				t.Fatal("LoadKeySet succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestKeySetJWKS(t *testing.T) {
+	keys := loadTestKeySet(t)
+
+	jwks := keys.JWKS()
+	var kids []string
+	for _, key := range jwks.Keys {
+		kids = append(kids, key.Kid)
+	}
+	if want := []string{"current", "edge", "retired"}; !reflect.DeepEqual(kids, want) {
+		t.Fatalf("published keys %v, want %v", kids, want)
+	}
+
+	// each published key is the public key of its kid
+	current := jwks.Keys[0]
+	if current.Kty != "EC" || current.Crv != "P-256" || current.Alg != "ES256" || current.Use != "sig" {
+		t.Errorf("current = %+v, want a P-256 signing key", current)
+	}
+	if x := decodeBigInt(t, current.X); x.Cmp(testKeys.ec.X) != 0 {
+		t.Error("current has the wrong x coordinate")
+	}
+	if y := decodeBigInt(t, current.Y); y.Cmp(testKeys.ec.Y) != 0 {
+		t.Error("current has the wrong y coordinate")
+	}
+
+	edge := jwks.Keys[1]
+	if edge.Kty != "OKP" || edge.Crv != "Ed25519" || edge.Alg != "EdDSA" {
+		t.Errorf("edge = %+v, want an Ed25519 key", edge)
+	}
+	if x, _ := base64.RawURLEncoding.DecodeString(edge.X); !reflect.DeepEqual(x, []byte(testKeys.ed.Public().(ed25519.PublicKey))) {
+		t.Error("edge has the wrong public key")
+	}
+
+	retired := jwks.Keys[2]
+	if retired.Kty != "RSA" || retired.Alg != "RS256" {
+		t.Errorf("retired = %+v, want an RSA key", retired)
+	}
+	if n := decodeBigInt(t, retired.N); n.Cmp(testKeys.rsa.N) != 0 {
+		t.Error("retired has the wrong modulus")
+	}
+	if e := decodeBigInt(t, retired.E); e.Int64() != int64(testKeys.rsa.E) {
+		t.Error("retired has the wrong exponent")
+	}
+}
+
+func TestHMACKeySetJWKSIsEmpty(t *testing.T) {
+	body, err := json.Marshal(NewHMACKeySet("secret").JWKS())
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	// the shared secret is never published, and the list is empty rather than null
+	if string(body) != `{"keys":[]}` {
+		t.Errorf("JWKS = %s, want no keys", body)
+	}
+}
+
+func decodeBigInt(t *testing.T, value string) *big.Int {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatalf("decode %q: %v", value, err)
+	}
+	return new(big.Int).SetBytes(b)
+}
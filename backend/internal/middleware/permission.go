@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PermissionChecker resolves the permissions currently granted to a user.
+// Permissions are looked up on every request rather than read from the token,
+// so changes to a role take effect without reissuing tokens.
+type PermissionChecker interface {
+	HasPermissions(ctx context.Context, userId string, permissions ...string) (bool, error)
+}
+
+// RequirePermission allows the request only if the authenticated user holds
+// every given permission and, for requests made with an API key, the key's
+// scopes include them
+func RequirePermission(checker PermissionChecker, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId := c.GetString("user_id")
+		if userId == "" || !scopesAllow(c, permissions) {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+				Success: false,
+				Error: &ErrorData{
+					Code:    CodeForbidden,
+					Message: "You do not have permission to access this resource",
+				},
+			})
+			return
+		}
+
+		allowed, err := checker.HasPermissions(c.Request.Context(), userId, permissions...)
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{
+				Success: false,
+				Error: &ErrorData{
+					Code:    CodeForbidden,
+					Message: "You do not have permission to access this resource",
+				},
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
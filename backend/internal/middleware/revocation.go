@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RevocationStore tracks access tokens that were revoked before they expired.
+// Tokens can be revoked one at a time by their ID (jti), per sign-in session
+// (sid) or all at once for a user, in which case every token issued before
+// the cut-off time is rejected.
+type RevocationStore interface {
+	// RevokeToken denylists a single token until the time it would have expired anyway
+	RevokeToken(ctx context.Context, tokenId string, expiresAt time.Time) error
+	// RevokeSession denylists every token of a session until the time the last of them expires
+	RevokeSession(ctx context.Context, sessionId string, expiresAt time.Time) error
+	// RevokeUser rejects every token issued to the user before the given time
+	RevokeUser(ctx context.Context, userId string, before time.Time) error
+	// IsRevoked reports whether the token described by the claims has been revoked
+	IsRevoked(ctx context.Context, claims *JWTClaims) (bool, error)
+}
+
+// SessionRevocationID is the denylist entry of a revoked session. Sessions
+// share the denylist with tokens, prefixed so that the IDs cannot collide.
+func SessionRevocationID(sessionId string) string {
+	return "session:" + sessionId
+}
+
+// MemoryRevocationStore is an in-process RevocationStore. Revocations are lost
+// on restart and are not shared between instances, so it is best suited to
+// development and single-instance deployments.
+type MemoryRevocationStore struct {
+	mu      sync.RWMutex
+	tokens  map[string]time.Time // token ID -> token expiry
+	cutoffs map[string]time.Time // user ID -> tokens issued before this time are revoked
+}
+
+// NewMemoryRevocationStore creates an empty in-memory revocation store
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens:  make(map[string]time.Time),
+		cutoffs: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryRevocationStore) RevokeToken(ctx context.Context, tokenId string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// drop entries for tokens that have expired on their own
+	now := time.Now()
+	for id, exp := range s.tokens {
+		if now.After(exp) {
+			delete(s.tokens, id)
+		}
+	}
+
+	s.tokens[tokenId] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeSession(ctx context.Context, sessionId string, expiresAt time.Time) error {
+	return s.RevokeToken(ctx, SessionRevocationID(sessionId), expiresAt)
+}
+
+func (s *MemoryRevocationStore) RevokeUser(ctx context.Context, userId string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.cutoffs[userId]; !ok || before.After(current) {
+		s.cutoffs[userId] = before
+	}
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, claims *JWTClaims) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.tokens[claims.ID]; ok && claims.ID != "" {
+		return true, nil
+	}
+	if _, ok := s.tokens[SessionRevocationID(claims.SessionId)]; ok && claims.SessionId != "" {
+		return true, nil
+	}
+
+	// signing the impersonator out everywhere ends their impersonations as well
+	for _, userId := range []string{claims.UserId, claims.Impersonator} {
+		if cutoff, ok := s.cutoffs[userId]; ok && userId != "" {
+			if claims.IssuedAt == nil || claims.IssuedAt.Time.Before(cutoff) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
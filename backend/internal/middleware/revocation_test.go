@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// claimsIssuedAt returns the claims of a token of the user issued at a time,
+// rounded to whole seconds like every issued token
+func claimsIssuedAt(userId string, issuedAt time.Time) *JWTClaims {
+	return &JWTClaims{
+		UserId:           userId,
+		RegisteredClaims: jwt.RegisteredClaims{ID: "jti-" + userId, IssuedAt: jwt.NewNumericDate(issuedAt)},
+	}
+}
+
+func TestMemoryRevocationStoreRevokeUser(t *testing.T) {
+	// a cut-off well into a second, like time.Now() almost always is
+	cutoff := time.Date(2026, 10, 17, 12, 0, 30, 700_000_000, time.UTC)
+
+	// iat only has whole seconds, so a token issued within the second of the
+	// cut-off may have been issued before it and is revoked either way
+	tests := []struct {
+		name    string
+		claims  *JWTClaims
+		revoked bool
+	}{
+		{"issued a second before", claimsIssuedAt("1", cutoff.Add(-time.Second)), true},
+		{"issued within the same second before", claimsIssuedAt("1", cutoff.Add(-100*time.Millisecond)), true},
+		{"issued within the same second after", claimsIssuedAt("1", cutoff.Add(200*time.Millisecond)), true},
+		{"issued a second after", claimsIssuedAt("1", cutoff.Add(time.Second)), false},
+		{"without an issue time", &JWTClaims{UserId: "1"}, true},
+		{"of another user", claimsIssuedAt("2", cutoff.Add(-time.Hour)), false},
+	}
+
+	store := NewMemoryRevocationStore()
+	if err := store.RevokeUser(context.Background(), "1", cutoff); err != nil {
+		t.Fatalf("RevokeUser: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked, err := store.IsRevoked(context.Background(), tt.claims)
+			if err != nil {
+				t.Fatalf("IsRevoked: %v", err)
+			}
+			if revoked != tt.revoked {
+				t.Errorf("IsRevoked = %v, want %v", revoked, tt.revoked)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationStoreKeepsLatestCutoff(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	later := time.Date(2026, 10, 17, 12, 0, 30, 0, time.UTC)
+	_ = store.RevokeUser(context.Background(), "1", later)
+	_ = store.RevokeUser(context.Background(), "1", later.Add(-time.Minute))
+
+	revoked, _ := store.IsRevoked(context.Background(), claimsIssuedAt("1", later.Add(-time.Second)))
+	if !revoked {
+		t.Error("an earlier cut-off replaced a later one")
+	}
+}
+
+func TestMemoryRevocationStoreRevokeToken(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	_ = store.RevokeToken(context.Background(), "jti-1", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		claims  *JWTClaims
+		revoked bool
+	}{
+		{"revoked token", &JWTClaims{RegisteredClaims: jwt.RegisteredClaims{ID: "jti-1"}}, true},
+		{"other token", &JWTClaims{RegisteredClaims: jwt.RegisteredClaims{ID: "jti-2"}}, false},
+		{"token without an ID", &JWTClaims{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked, err := store.IsRevoked(context.Background(), tt.claims)
+			if err != nil {
+				t.Fatalf("IsRevoked: %v", err)
+			}
+			if revoked != tt.revoked {
+				t.Errorf("IsRevoked = %v, want %v", revoked, tt.revoked)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationStoreRevokeSession(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	_ = store.RevokeSession(context.Background(), "7", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		claims  *JWTClaims
+		revoked bool
+	}{
+		{"token of the session", &JWTClaims{SessionId: "7", RegisteredClaims: jwt.RegisteredClaims{ID: "jti-1"}}, true},
+		{"token of another session", &JWTClaims{SessionId: "8", RegisteredClaims: jwt.RegisteredClaims{ID: "jti-2"}}, false},
+		{"token without a session", &JWTClaims{RegisteredClaims: jwt.RegisteredClaims{ID: "jti-3"}}, false},
+		{"token ID equal to the session ID", &JWTClaims{RegisteredClaims: jwt.RegisteredClaims{ID: "7"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked, err := store.IsRevoked(context.Background(), tt.claims)
+			if err != nil {
+				t.Fatalf("IsRevoked: %v", err)
+			}
+			if revoked != tt.revoked {
+				t.Errorf("IsRevoked = %v, want %v", revoked, tt.revoked)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationStoreRevokeImpersonator(t *testing.T) {
+	cutoff := time.Now()
+	store := NewMemoryRevocationStore()
+	_ = store.RevokeUser(context.Background(), "1", cutoff)
+
+	impersonating := func(issuedAt time.Time) *JWTClaims {
+		claims := claimsIssuedAt("3", issuedAt)
+		claims.Impersonator = "1"
+		return claims
+	}
+	tests := []struct {
+		name    string
+		claims  *JWTClaims
+		revoked bool
+	}{
+		{"impersonation issued before", impersonating(cutoff.Add(-time.Minute)), true},
+		{"impersonation issued after", impersonating(cutoff.Add(time.Minute)), false},
+		{"own token of the impersonated user", claimsIssuedAt("3", cutoff.Add(-time.Minute)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked, err := store.IsRevoked(context.Background(), tt.claims)
+			if err != nil {
+				t.Fatalf("IsRevoked: %v", err)
+			}
+			if revoked != tt.revoked {
+				t.Errorf("IsRevoked = %v, want %v", revoked, tt.revoked)
+			}
+		})
+	}
+}
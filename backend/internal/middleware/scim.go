@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/scim"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidSCIMToken is returned by a SCIMAuthenticator for tokens that must be rejected
+var ErrInvalidSCIMToken = errors.New("invalid SCIM token")
+
+// SCIMPrincipal is the organization a SCIM token provisions
+type SCIMPrincipal struct {
+	TokenID string
+	OrgId   string
+}
+
+// SCIMAuthenticator resolves SCIM bearer tokens to the organization they provision
+type SCIMAuthenticator interface {
+	AuthenticateSCIM(ctx context.Context, token string) (*SCIMPrincipal, error)
+}
+
+type scimTokenKey struct{}
+
+// SCIMTokenFromContext returns the ID of the SCIM token the request was made
+// with, if any
+func SCIMTokenFromContext(ctx context.Context) (string, bool) {
+	tokenId, ok := ctx.Value(scimTokenKey{}).(string)
+	return tokenId, ok
+}
+
+// SCIMAuth authenticates SCIM requests with a SCIM token in the Authorization
+// header. User access tokens and API keys are not accepted. The request
+// context is scoped to the token's organization and carries the token ID,
+// which is also set as "scim_token_id". Errors are SCIM error responses.
+func SCIMAuth(tokens SCIMAuthenticator, logger *zap.SugaredLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			AbortSCIM(c, http.StatusUnauthorized, "", "Authorization header with a SCIM bearer token is required")
+			return
+		}
+
+		principal, err := tokens.AuthenticateSCIM(c.Request.Context(), token)
+		if err != nil {
+			if errors.Is(err, ErrInvalidSCIMToken) {
+				c.Header("WWW-Authenticate", `Bearer realm="scim", error="invalid_token"`)
+				AbortSCIM(c, http.StatusUnauthorized, "", "Invalid or revoked SCIM token")
+				return
+			}
+			logger.Errorw("Failed to authenticate SCIM token", "error", err)
+			AbortSCIM(c, http.StatusInternalServerError, "", "An internal server error occurred")
+			return
+		}
+
+		organizationID, err := strconv.Atoi(principal.OrgId)
+		if err != nil {
+			AbortSCIM(c, http.StatusUnauthorized, "", "Invalid or revoked SCIM token")
+			return
+		}
+		ctx := tenant.WithOrganization(c.Request.Context(), organizationID)
+		c.Request = c.Request.WithContext(context.WithValue(ctx, scimTokenKey{}, principal.TokenID))
+		c.Set("org_id", principal.OrgId)
+		c.Set("scim_token_id", principal.TokenID)
+		c.Next()
+	}
+}
+
+// AbortSCIM aborts the request with a SCIM error response
+func AbortSCIM(c *gin.Context, status int, scimType, detail string) {
+	c.Header("Content-Type", scim.ContentType)
+	c.AbortWithStatusJSON(status, scim.NewError(status, scimType, detail))
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token types carried in the token_type claim
+const (
+	TokenTypeAccess       = "access"
+	TokenTypeRefresh      = "refresh"
+	TokenTypeInvitation   = "invitation"
+	TokenTypeMFAChallenge = "mfa_challenge"
+)
+
+// Token validation error codes
+const (
+	CodeTokenMalformed        = "TOKEN_MALFORMED"
+	CodeTokenInvalidSignature = "TOKEN_INVALID_SIGNATURE"
+	CodeTokenExpired          = "TOKEN_EXPIRED"
+	CodeTokenNotYetValid      = "TOKEN_NOT_YET_VALID"
+	CodeTokenInvalidIssuer    = "TOKEN_INVALID_ISSUER"
+	CodeTokenInvalidAudience  = "TOKEN_INVALID_AUDIENCE"
+	CodeTokenInvalidType      = "TOKEN_INVALID_TYPE"
+	CodeTokenRevoked          = "TOKEN_REVOKED"
+	CodeTokenInvalid          = "TOKEN_INVALID"
+)
+
+// ErrTokenInvalidType is returned when a token is presented where another kind of token is expected
+var ErrTokenInvalidType = errors.New("token has invalid type")
+
+// TokenError describes why a token was rejected
+type TokenError struct {
+	Code    string
+	Message string
+	Err     error
+}
+
+// Error implements the error interface
+func (e *TokenError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the underlying validation error
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+// newTokenError classifies a validation error into a TokenError
+func newTokenError(err error) *TokenError {
+	var tokenErr *TokenError
+	if errors.As(err, &tokenErr) {
+		return tokenErr
+	}
+
+	code, message := CodeTokenInvalid, "Invalid token"
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		code, message = CodeTokenMalformed, "Token is malformed"
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		code, message = CodeTokenInvalidSignature, "Token signature is invalid"
+	case errors.Is(err, jwt.ErrTokenExpired):
+		code, message = CodeTokenExpired, "Token has expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		code, message = CodeTokenNotYetValid, "Token is not valid yet"
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		code, message = CodeTokenInvalidIssuer, "Token was issued by an unexpected issuer"
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		code, message = CodeTokenInvalidAudience, "Token is not intended for this audience"
+	case errors.Is(err, ErrTokenInvalidType):
+		code, message = CodeTokenInvalidType, "Token cannot be used for this purpose"
+	}
+
+	return &TokenError{Code: code, Message: message, Err: err}
+}
+
+// ParseToken verifies the token signature and validates its issuer, audience,
+// lifetime and token type. Failures are returned as a *TokenError.
+func ParseToken(tokenString, tokenType string, config JWTConfig) (*JWTClaims, error) {
+	claims := &JWTClaims{}
+	if err := parseClaims(tokenString, claims, config); err != nil {
+		return nil, err
+	}
+
+	if claims.TokenType != tokenType {
+		return nil, newTokenError(ErrTokenInvalidType)
+	}
+	if claims.Subject == "" || claims.UserId != claims.Subject {
+		return nil, newTokenError(jwt.ErrTokenInvalidClaims)
+	}
+
+	return claims, nil
+}
+
+// parseClaims verifies the token signature and the registered claims shared
+// by every token type
+func parseClaims(tokenString string, claims jwt.Claims, config JWTConfig) error {
+	options := []jwt.ParserOption{
+		jwt.WithLeeway(config.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if len(config.Audience) > 0 {
+		// the token must be meant for at least one of our audiences
+		options = append(options, jwt.WithAudience(config.Audience...))
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc(config), options...)
+	if err != nil {
+		return newTokenError(err)
+	}
+	if !token.Valid {
+		return newTokenError(jwt.ErrTokenInvalidClaims)
+	}
+	return nil
+}
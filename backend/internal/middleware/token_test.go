@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testTokenConfig() JWTConfig {
+	config := DefaultJWTConfig()
+	config.Secret = "test-secret"
+	return config
+}
+
+// signClaims signs claims of the given type for user 1, letting a case change
+// them before they are signed
+func signClaims(t *testing.T, config JWTConfig, tokenType string, change func(*JWTClaims)) string {
+	t.Helper()
+	now := time.Now()
+	claims := &JWTClaims{
+		UserId:    "1",
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Issuer,
+			Audience:  config.Audience,
+			Subject:   "1",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			ID:        "jti",
+		},
+	}
+	if change != nil {
+		change(claims)
+	}
+	token, err := config.keySet().Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return token
+}
+
+func TestParseTokenErrorCodes(t *testing.T) {
+	config := testTokenConfig()
+	otherKey := testTokenConfig()
+	otherKey.Secret = "another-secret"
+
+	tests := []struct {
+		name  string
+		token string
+		code  string // empty when the token is valid
+	}{
+		{"valid", signClaims(t, config, TokenTypeAccess, nil), ""},
+		{"malformed", "not.a.token", CodeTokenMalformed},
+		{"signed with another key", signClaims(t, otherKey, TokenTypeAccess, nil), CodeTokenInvalidSignature},
+		{"expired", signClaims(t, config, TokenTypeAccess, func(c *JWTClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		}), CodeTokenExpired},
+		{"expired within the leeway", signClaims(t, config, TokenTypeAccess, func(c *JWTClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-config.Leeway / 2))
+		}), ""},
+		{"without an expiry", signClaims(t, config, TokenTypeAccess, func(c *JWTClaims) {
+			c.ExpiresAt = nil
+		}), CodeTokenInvalid},
+		{"not valid yet", signClaims(t, config, TokenTypeAccess, func(c *JWTClaims) {
+			c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		}), CodeTokenNotYetValid},
+		{"issued in the future", signClaims(t, config, TokenTypeAccess, func(c *JWTClaims) {
+			c.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		}), CodeTokenNotYetValid},
+		{"another issuer", signClaims(t, config, TokenTypeAccess, func(c *JWTClaims) {
+			c.Issuer = "someone-else"
+		}), CodeTokenInvalidIssuer},
+		{"another audience", signClaims(t, config, TokenTypeAccess, func(c *JWTClaims) {
+			c.Audience = jwt.ClaimStrings{"billing"}
+		}), CodeTokenInvalidAudience},
+		{"one of several audiences", signClaims(t, config, TokenTypeAccess, func(c *JWTClaims) {
+			c.Audience = jwt.ClaimStrings{"billing", "api"}
+		}), ""},
+		{"refresh token", signClaims(t, config, TokenTypeRefresh, nil), CodeTokenInvalidType},
+		{"without a type", signClaims(t, config, "", nil), CodeTokenInvalidType},
+		{"subject of another user", signClaims(t, config, TokenTypeAccess, func(c *JWTClaims) {
+			c.Subject = "2"
+		}), CodeTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(tt.token, TokenTypeAccess, config)
+			if tt.code == "" {
+				if err != nil {
+					t.Fatalf("ParseToken: %v", err)
+				}
+				if claims.UserId != "1" {
+					t.Errorf("user = %q, want 1", claims.UserId)
+				}
+				return
+			}
+
+			var tokenErr *TokenError
+			if !errors.As(err, &tokenErr) {
+				t.Fatalf("ParseToken = %v, want a *TokenError", err)
+			}
+			if tokenErr.Code != tt.code {
+				t.Errorf("code = %s, want %s (%v)", tokenErr.Code, tt.code, tokenErr.Err)
+			}
+		})
+	}
+}
+
+func TestGeneratedTokensParseAsTheirType(t *testing.T) {
+	config := testTokenConfig()
+	access, err := GenerateToken("1", "3", "user", config)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	refresh, err := GenerateRefreshToken("1", "token-id", config)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+
+	if _, err := ParseToken(access, TokenTypeAccess, config); err != nil {
+		t.Errorf("access token as an access token: %v", err)
+	}
+	if claims, err := ParseToken(refresh, TokenTypeRefresh, config); err != nil || claims.ID != "token-id" {
+		t.Errorf("refresh token as a refresh token = %+v, %v", claims, err)
+	}
+	if _, err := ParseToken(access, TokenTypeRefresh, config); !errors.Is(err, ErrTokenInvalidType) {
+		t.Errorf("access token as a refresh token = %v, want %v", err, ErrTokenInvalidType)
+	}
+	if _, err := ParseToken(refresh, TokenTypeAccess, config); !errors.Is(err, ErrTokenInvalidType) {
+		t.Errorf("refresh token as an access token = %v, want %v", err, ErrTokenInvalidType)
+	}
+}
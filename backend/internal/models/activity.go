@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Activity types
+const (
+	ActivityNote    = "note"
+	ActivityCall    = "call"
+	ActivityMeeting = "meeting"
+	ActivityEmail   = "email"
+	ActivityTask    = "task"
+)
+
+// Activity is an interaction logged against a contact, company or deal, such
+// as a call or a meeting. OccurredAt is when the interaction took place, which
+// may be earlier than when it was logged.
+type Activity struct {
+	ID int `json:"id"`
+	TenantOwned
+	Type       string        `json:"type" gorm:"size:20;not null"`
+	RecordType string        `json:"record_type" gorm:"size:32;not null;index:idx_activities_record"`
+	RecordID   int           `json:"record_id" gorm:"not null;index:idx_activities_record"`
+	AuthorID   *int          `json:"author_id" gorm:"index"`
+	Author     *User         `json:"author,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+	Subject    string        `json:"subject" gorm:"size:255;not null"`
+	Body       string        `json:"body" gorm:"type:text"`
+	OccurredAt time.Time     `json:"occurred_at" gorm:"not null;index"`
+	Duration   time.Duration `json:"duration"`
+	Outcome    string        `json:"outcome" gorm:"size:100"` // such as "no answer" for a call
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// APIKey is a long-lived credential for scripts and integrations. It acts as
+// its user, either a person or a service account, in the organization it was
+// created in, limited to its scopes. Only a hash of the key is stored; Prefix
+// keeps enough of it to tell keys apart.
+type APIKey struct {
+	ID int `json:"id"`
+	TenantOwned
+	UserID      int        `json:"user_id" gorm:"not null;index"`
+	Name        string     `json:"name" gorm:"size:100;not null"`
+	Prefix      string     `json:"prefix" gorm:"size:16;not null"`
+	KeyHash     string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Scopes      []string   `json:"scopes" gorm:"serializer:json;type:text;not null"`
+	CreatedByID int        `json:"created_by_id" gorm:"not null"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Active reports whether the key can still be used
+func (k *APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
+
+// ServiceAccount is a non-human member of an organization that integrations
+// authenticate as with API keys. It is backed by a User that cannot sign in,
+// so that roles and permissions apply to it like to any other member.
+type ServiceAccount struct {
+	ID int `json:"id"`
+	TenantOwned
+	UserID      int       `json:"user_id" gorm:"not null;uniqueIndex"`
+	User        *User     `json:"user,omitempty"`
+	Name        string    `json:"name" gorm:"size:100;not null"`
+	Description string    `json:"description"`
+	CreatedByID int       `json:"created_by_id" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Audit event actions, formatted as "<subject>.<event>"
+const (
+	AuditAccountLocked   = "account.locked"
+	AuditAccountUnlocked = "account.unlocked"
+	AuditSessionRevoked  = "session.revoked"
+
+	AuditImpersonationStarted = "impersonation.started"
+	AuditImpersonationEnded   = "impersonation.ended"
+	AuditImpersonationRequest = "impersonation.request"
+
+	AuditUserProvisioned   = "user.provisioned"
+	AuditUserDeprovisioned = "user.deprovisioned"
+	AuditUserDeactivated   = "user.deactivated"
+	AuditUserReactivated   = "user.reactivated"
+)
+
+// AuditEvent records a security-relevant action. Events about an
+// organization's members are recorded once per organization so that each
+// organization's admins see them; events that concern no organization, such
+// as a lockout of an unknown email address, have none.
+type AuditEvent struct {
+	ID             int                    `json:"id"`
+	OrganizationID *int                   `json:"organization_id" gorm:"index"`
+	ActorID        *int                   `json:"actor_id"` // nil for anonymous requests and the system
+	Action         string                 `json:"action" gorm:"size:100;not null;index"`
+	TargetType     string                 `json:"target_type" gorm:"size:50"`
+	TargetID       *int                   `json:"target_id"`
+	IPAddress      string                 `json:"ip_address" gorm:"size:64"`
+	UserAgent      string                 `json:"user_agent"`
+	Details        map[string]interface{} `json:"details" gorm:"serializer:json;type:text"`
+	CreatedAt      time.Time              `json:"created_at" gorm:"index"`
+}
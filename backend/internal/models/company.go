@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Company is an organization the tenant does business with. Contacts are
+// linked to companies with a role they play there, such as "decision maker".
+type Company struct {
+	ID int `json:"id"`
+	TenantOwned
+	Name         string            `json:"name" gorm:"size:255;not null"`
+	Domain       string            `json:"domain" gorm:"size:255;index"`
+	Industry     string            `json:"industry" gorm:"size:100"`
+	Size         string            `json:"size" gorm:"size:20"` // an employee count range such as "51-200"
+	Address      Address           `json:"address" gorm:"embedded;embeddedPrefix:address_"`
+	OwnerID      *int              `json:"owner_id" gorm:"index"`
+	Owner        *User             `json:"owner,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+	Contacts     []CompanyContact  `json:"contacts,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	Tags         []Tagging         `json:"tags" gorm:"polymorphic:Record;polymorphicValue:company"`
+	CustomFields CustomFieldValues `json:"custom_fields" gorm:"serializer:json;type:jsonb;not null;default:'{}'"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// CompanyContact links a contact to a company
+type CompanyContact struct {
+	TenantOwned
+	CompanyID int       `json:"company_id" gorm:"primaryKey;autoIncrement:false"`
+	ContactID int       `json:"contact_id" gorm:"primaryKey;autoIncrement:false;index"`
+	Role      string    `json:"role" gorm:"size:100"`
+	Company   *Company  `json:"company,omitempty"`
+	Contact   *Contact  `json:"contact,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TagNames returns the names of the company's tags
+func (c *Company) TagNames() []string {
+	return tagNames(c.Tags)
+}
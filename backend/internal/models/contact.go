@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Contact is a person the organization does business with
+type Contact struct {
+	ID int `json:"id"`
+	TenantOwned
+	FirstName    string            `json:"first_name" gorm:"size:100;not null"`
+	LastName     string            `json:"last_name" gorm:"size:100"`
+	JobTitle     string            `json:"job_title" gorm:"size:255"`
+	Emails       []ContactEmail    `json:"emails" gorm:"constraint:OnDelete:CASCADE"`
+	Phones       []ContactPhone    `json:"phones" gorm:"constraint:OnDelete:CASCADE"`
+	Address      Address           `json:"address" gorm:"embedded;embeddedPrefix:address_"`
+	OwnerID      *int              `json:"owner_id" gorm:"index"`
+	Owner        *User             `json:"owner,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+	Companies    []CompanyContact  `json:"companies,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	Deals        []DealContact     `json:"deals,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	Tags         []Tagging         `json:"tags" gorm:"polymorphic:Record;polymorphicValue:contact"`
+	CustomFields CustomFieldValues `json:"custom_fields" gorm:"serializer:json;type:jsonb;not null;default:'{}'"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+// ContactEmail is one of a contact's email addresses
+type ContactEmail struct {
+	ID        int    `json:"id"`
+	ContactID int    `json:"contact_id" gorm:"not null;index"`
+	Email     string `json:"email" gorm:"size:255;not null;index"`
+	Label     string `json:"label" gorm:"size:50"` // such as "work" or "home"
+	IsPrimary bool   `json:"is_primary" gorm:"not null;default:false"`
+}
+
+// ContactPhone is one of a contact's phone numbers
+type ContactPhone struct {
+	ID        int    `json:"id"`
+	ContactID int    `json:"contact_id" gorm:"not null;index"`
+	Number    string `json:"number" gorm:"size:50;not null"`
+	Label     string `json:"label" gorm:"size:50"` // such as "mobile" or "office"
+	IsPrimary bool   `json:"is_primary" gorm:"not null;default:false"`
+}
+
+// Address is a postal address embedded in the records that have one
+type Address struct {
+	Street     string `json:"street" gorm:"size:255"`
+	City       string `json:"city" gorm:"size:100"`
+	Region     string `json:"region" gorm:"size:100"`
+	PostalCode string `json:"postal_code" gorm:"size:20"`
+	Country    string `json:"country" gorm:"size:100"`
+}
+
+// PrimaryEmail returns the contact's primary email address, if any
+func (c *Contact) PrimaryEmail() string {
+	for _, email := range c.Emails {
+		if email.IsPrimary {
+			return email.Email
+		}
+	}
+	return ""
+}
+
+// TagNames returns the names of the contact's tags
+func (c *Contact) TagNames() []string {
+	return tagNames(c.Tags)
+}
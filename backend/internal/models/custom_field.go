@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Custom field types
+const (
+	CustomFieldText        = "text"
+	CustomFieldNumber      = "number"
+	CustomFieldDate        = "date" // a calendar date formatted as 2006-01-02
+	CustomFieldSelect      = "select"
+	CustomFieldMultiSelect = "multi_select"
+	CustomFieldBoolean     = "boolean"
+	CustomFieldURL         = "url"
+)
+
+// CustomFieldValues holds the custom field values of a record by field key
+type CustomFieldValues map[string]interface{}
+
+// CustomField is an attribute an organization adds to one type of CRM record.
+// Values live in the custom_fields column of the records, keyed by Key.
+//
+// Min and Max bound the value of numbers, the length of text and URLs, and
+// the number of choices of multi-selects. Text values must also match
+// Pattern, when set.
+type CustomField struct {
+	ID int `json:"id"`
+	// OrganizationID is declared rather than embedded through TenantOwned so
+	// that keys can be unique per organization and record type
+	OrganizationID int       `json:"organization_id" gorm:"not null;uniqueIndex:idx_custom_fields_key"`
+	RecordType     string    `json:"record_type" gorm:"size:32;not null;uniqueIndex:idx_custom_fields_key"`
+	Key            string    `json:"key" gorm:"size:64;not null;uniqueIndex:idx_custom_fields_key"`
+	Label          string    `json:"label" gorm:"size:100;not null"`
+	Type           string    `json:"type" gorm:"size:20;not null"`
+	Required       bool      `json:"required" gorm:"not null;default:false"`
+	Options        []string  `json:"options" gorm:"serializer:json;type:text"` // the choices of selects
+	Min            *float64  `json:"min"`
+	Max            *float64  `json:"max"`
+	Pattern        string    `json:"pattern" gorm:"size:255"` // a regular expression
+	Position       int       `json:"position" gorm:"not null;default:0"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SetOrganizationID implements Tenanted
+func (f *CustomField) SetOrganizationID(id int) {
+	f.OrganizationID = id
+}
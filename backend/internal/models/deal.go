@@ -0,0 +1,108 @@
+package models
+
+import "time"
+
+// Deal statuses
+const (
+	DealOpen = "open"
+	DealWon  = "won"
+	DealLost = "lost"
+)
+
+// Pipeline is a sales process made of ordered stages that deals move through
+type Pipeline struct {
+	ID int `json:"id"`
+	TenantOwned
+	Name      string    `json:"name" gorm:"size:100;not null"`
+	Stages    []Stage   `json:"stages" gorm:"constraint:OnDelete:CASCADE"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Stage is a step of a pipeline. Probability is the chance, in percent, that
+// a deal in the stage is won.
+type Stage struct {
+	ID int `json:"id"`
+	TenantOwned
+	PipelineID  int       `json:"pipeline_id" gorm:"not null;index"`
+	Name        string    `json:"name" gorm:"size:100;not null"`
+	Position    int       `json:"position" gorm:"not null"`
+	Probability int       `json:"probability" gorm:"not null;default:0"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Deal is a potential sale moving through the stages of a pipeline until it
+// is won or lost. StageChangedAt is when the deal entered its current stage
+// or status, so that the time spent there can be measured.
+type Deal struct {
+	ID int `json:"id"`
+	TenantOwned
+	Title             string            `json:"title" gorm:"size:255;not null"`
+	Amount            float64           `json:"amount" gorm:"type:numeric(15,2);not null;default:0"`
+	Currency          string            `json:"currency" gorm:"size:3;not null"`
+	Status            string            `json:"status" gorm:"size:10;not null;default:open;index"`
+	PipelineID        int               `json:"pipeline_id" gorm:"not null;index"`
+	StageID           int               `json:"stage_id" gorm:"not null;index"`
+	Stage             *Stage            `json:"stage,omitempty"`
+	ExpectedCloseDate *time.Time        `json:"expected_close_date" gorm:"type:date"`
+	OwnerID           *int              `json:"owner_id" gorm:"index"`
+	Owner             *User             `json:"owner,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+	CompanyID         *int              `json:"company_id" gorm:"index"`
+	Company           *Company          `json:"company,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+	Contacts          []DealContact     `json:"contacts,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	Tags              []Tagging         `json:"tags" gorm:"polymorphic:Record;polymorphicValue:deal"`
+	CustomFields      CustomFieldValues `json:"custom_fields" gorm:"serializer:json;type:jsonb;not null;default:'{}'"`
+	CloseReason       string            `json:"close_reason"` // why the deal was won or lost
+	StageChangedAt    time.Time         `json:"stage_changed_at" gorm:"not null"`
+	ClosedAt          *time.Time        `json:"closed_at"`
+	CreatedAt         time.Time         `json:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+}
+
+// DealContact links a contact to a deal
+type DealContact struct {
+	TenantOwned
+	DealID    int       `json:"deal_id" gorm:"primaryKey;autoIncrement:false"`
+	ContactID int       `json:"contact_id" gorm:"primaryKey;autoIncrement:false;index"`
+	Contact   *Contact  `json:"contact,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DealStageChange records a deal entering a stage or status. The first change
+// of a deal has no previous stage; closing and reopening a deal keep its
+// stage and change its status, with the reason given for closing it.
+// TimeInPreviousStage is how long the deal had spent in the stage and status
+// it left.
+type DealStageChange struct {
+	ID int `json:"id"`
+	TenantOwned
+	DealID              int           `json:"deal_id" gorm:"not null;index"`
+	Deal                *Deal         `json:"deal,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+	FromStageID         *int          `json:"from_stage_id"`
+	ToStageID           int           `json:"to_stage_id" gorm:"not null;index"`
+	Status              string        `json:"status" gorm:"size:10;not null"`
+	Reason              string        `json:"reason"`
+	ChangedByID         *int          `json:"changed_by_id"`
+	TimeInPreviousStage time.Duration `json:"time_in_previous_stage"`
+	CreatedAt           time.Time     `json:"created_at"`
+}
+
+// Open reports whether the deal is neither won nor lost
+func (d *Deal) Open() bool {
+	return d.Status == DealOpen
+}
+
+// ContactIDs returns the IDs of the deal's contacts
+func (d *Deal) ContactIDs() []int {
+	ids := make([]int, len(d.Contacts))
+	for i, link := range d.Contacts {
+		ids[i] = link.ContactID
+	}
+	return ids
+}
+
+// TagNames returns the names of the deal's tags
+func (d *Deal) TagNames() []string {
+	return tagNames(d.Tags)
+}
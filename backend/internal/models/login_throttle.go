@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// LoginThrottle counts consecutive failed sign-ins for an email address. It
+// is keyed by the address rather than the user so that unknown addresses are
+// throttled the same way and cannot be told apart.
+type LoginThrottle struct {
+	Email          string     `json:"email" gorm:"primaryKey;size:255"`
+	FailedAttempts int        `json:"failed_attempts" gorm:"not null;default:0"`
+	LastFailedAt   time.Time  `json:"last_failed_at" gorm:"not null"`
+	LockedUntil    *time.Time `json:"locked_until"`
+}
+
+// Locked reports whether the address is locked at the given time
+func (t *LoginThrottle) Locked(now time.Time) bool {
+	return t.LockedUntil != nil && now.Before(*t.LockedUntil)
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// TOTPDevice is a user's authenticator app. It only protects sign-ins once
+// the user has confirmed it with a valid code. Unlike passwords the secret
+// cannot be hashed, since codes are computed from it.
+type TOTPDevice struct {
+	UserID       int        `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Secret       string     `json:"-" gorm:"not null"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	LastUsedStep int64      `json:"-" gorm:"not null;default:0"` // rejects replayed codes
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Confirmed reports whether the device is active
+func (d *TOTPDevice) Confirmed() bool {
+	return d.ConfirmedAt != nil
+}
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the user
+// has lost their device. Only a hash of the code is stored.
+type RecoveryCode struct {
+	ID       int        `json:"id"`
+	UserID   int        `json:"user_id" gorm:"not null;index"`
+	CodeHash string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	UsedAt   *time.Time `json:"used_at"`
+}
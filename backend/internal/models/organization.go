@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Organization is a tenant. Every CRM record belongs to exactly one organization.
+// When RequireMFA is set, members must sign in with a second factor.
+type Organization struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name" gorm:"not null"`
+	Slug       string    `json:"slug" gorm:"size:100;not null;uniqueIndex"`
+	RequireMFA bool      `json:"require_mfa" gorm:"not null;default:false"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// TenantOwned is embedded by models whose rows belong to a single organization.
+// Queries on such models are scoped to the organization of the request context.
+type TenantOwned struct {
+	OrganizationID int `json:"organization_id" gorm:"not null;index"`
+}
+
+// SetOrganizationID implements Tenanted
+func (t *TenantOwned) SetOrganizationID(id int) {
+	t.OrganizationID = id
+}
+
+// Tenanted is implemented by models that are scoped to an organization
+type Tenanted interface {
+	SetOrganizationID(id int)
+}
+
+// Membership links a user to an organization with a role in that organization.
+// A deactivated membership is kept for provisioning but grants no access;
+// ExternalID is the identifier the provisioning client knows the user by.
+type Membership struct {
+	ID             int           `json:"id"`
+	OrganizationID int           `json:"organization_id" gorm:"not null;uniqueIndex:idx_memberships_org_user"`
+	UserID         int           `json:"user_id" gorm:"not null;uniqueIndex:idx_memberships_org_user;index"`
+	Role           string        `json:"role" gorm:"not null;default:user"`
+	ExternalID     string        `json:"external_id,omitempty" gorm:"size:255"`
+	DeactivatedAt  *time.Time    `json:"deactivated_at,omitempty"`
+	User           *User         `json:"user,omitempty"`
+	Organization   *Organization `json:"organization,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// Active reports whether the membership grants access to the organization
+func (m *Membership) Active() bool {
+	return m.DeactivatedAt == nil
+}
+
+// SetOrganizationID implements Tenanted
+func (m *Membership) SetOrganizationID(id int) {
+	m.OrganizationID = id
+}
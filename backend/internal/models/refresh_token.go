@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// RefreshToken is the server-side record of an issued refresh token.
+// Tokens issued from the same login share a FamilyID so that the whole
+// chain can be revoked when a rotated token is replayed.
+// Every token of a family acts in the same organization.
+type RefreshToken struct {
+	ID             string     `json:"id" gorm:"primaryKey;size:64"`
+	UserID         int        `json:"user_id" gorm:"not null;index"`
+	FamilyID       string     `json:"family_id" gorm:"not null;index;size:64"`
+	OrganizationID int        `json:"organization_id" gorm:"not null;default:0"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"`
+	RotatedAt      *time.Time `json:"rotated_at"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
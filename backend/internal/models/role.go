@@ -0,0 +1,92 @@
+package models
+
+import "time"
+
+// Permission names, formatted as "<resource>:<action>"
+const (
+	PermissionContactsRead    = "contacts:read"
+	PermissionContactsWrite   = "contacts:write"
+	PermissionCompaniesRead   = "companies:read"
+	PermissionCompaniesWrite  = "companies:write"
+	PermissionDealsRead       = "deals:read"
+	PermissionDealsWrite      = "deals:write"
+	PermissionActivitiesRead  = "activities:read"
+	PermissionActivitiesWrite = "activities:write"
+	PermissionTasksRead       = "tasks:read"
+	PermissionTasksWrite      = "tasks:write"
+	PermissionSegmentsRead    = "segments:read"
+	PermissionSegmentsWrite   = "segments:write"
+	PermissionFieldsManage    = "custom_fields:manage"
+	PermissionUsersRead       = "users:read"
+	PermissionUsersManage     = "users:manage"
+	PermissionImpersonate     = "users:impersonate"
+	PermissionRolesManage     = "roles:manage"
+	PermissionOrgManage       = "organization:manage"
+	PermissionAuditRead       = "audit:read"
+)
+
+// Permission is a single capability that can be granted to a role
+type Permission struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name" gorm:"size:100;not null;uniqueIndex"`
+	Description string `json:"description"`
+}
+
+// Role is a named set of permissions. System roles are seeded on startup, are
+// shared by every organization and cannot be modified or deleted through the
+// API. Custom roles belong to the organization that created them.
+type Role struct {
+	ID             int          `json:"id"`
+	OrganizationID *int         `json:"organization_id" gorm:"uniqueIndex:idx_roles_org_name"`
+	Name           string       `json:"name" gorm:"size:100;not null;uniqueIndex:idx_roles_org_name"`
+	Description    string       `json:"description"`
+	IsSystem       bool         `json:"is_system" gorm:"not null;default:false"`
+	Permissions    []Permission `json:"permissions" gorm:"many2many:role_permissions"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// PermissionCatalog lists every permission known to the application
+var PermissionCatalog = []Permission{
+	{Name: PermissionContactsRead, Description: "View contacts"},
+	{Name: PermissionContactsWrite, Description: "Create, update and delete contacts"},
+	{Name: PermissionCompaniesRead, Description: "View companies"},
+	{Name: PermissionCompaniesWrite, Description: "Create, update and delete companies"},
+	{Name: PermissionDealsRead, Description: "View deals and pipelines"},
+	{Name: PermissionDealsWrite, Description: "Create, update and delete deals and pipelines"},
+	{Name: PermissionActivitiesRead, Description: "View activities"},
+	{Name: PermissionActivitiesWrite, Description: "Create, update and delete activities"},
+	{Name: PermissionTasksRead, Description: "View tasks"},
+	{Name: PermissionTasksWrite, Description: "Create, update and delete tasks"},
+	{Name: PermissionSegmentsRead, Description: "View segments and their members"},
+	{Name: PermissionSegmentsWrite, Description: "Create, update and delete segments"},
+	{Name: PermissionFieldsManage, Description: "Define the custom fields of contacts, companies and deals"},
+	{Name: PermissionUsersRead, Description: "View users"},
+	{Name: PermissionUsersManage, Description: "Manage users, their roles and sessions"},
+	{Name: PermissionImpersonate, Description: "Act as another user to see what they see"},
+	{Name: PermissionRolesManage, Description: "Manage roles and their permissions"},
+	{Name: PermissionOrgManage, Description: "Manage organization settings"},
+	{Name: PermissionAuditRead, Description: "View the audit log"},
+}
+
+// SystemRoles are the built-in roles and the permissions they grant
+var SystemRoles = map[string][]string{
+	RoleAdmin: permissionNames(PermissionCatalog),
+	RoleUser: {
+		PermissionContactsRead, PermissionContactsWrite,
+		PermissionCompaniesRead, PermissionCompaniesWrite,
+		PermissionDealsRead, PermissionDealsWrite,
+		PermissionActivitiesRead, PermissionActivitiesWrite,
+		PermissionTasksRead, PermissionTasksWrite,
+		PermissionSegmentsRead, PermissionSegmentsWrite,
+		PermissionUsersRead,
+	},
+}
+
+func permissionNames(permissions []Permission) []string {
+	names := make([]string, len(permissions))
+	for i, p := range permissions {
+		names[i] = p.Name
+	}
+	return names
+}
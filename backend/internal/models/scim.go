@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// SCIMToken is a bearer token an identity provider provisions the users and
+// groups of an organization with over SCIM. Only a hash of the token is
+// stored; Prefix keeps enough of it to tell tokens apart.
+type SCIMToken struct {
+	ID int `json:"id"`
+	TenantOwned
+	Name        string     `json:"name" gorm:"size:100;not null"`
+	Prefix      string     `json:"prefix" gorm:"size:16;not null"`
+	TokenHash   string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	CreatedByID int        `json:"created_by_id" gorm:"not null"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Active reports whether the token can still be used
+func (t *SCIMToken) Active() bool {
+	return t.RevokedAt == nil
+}
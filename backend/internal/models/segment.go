@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Segment is a saved set of records of one type, defined by rules such as
+// `tag = vip AND last_activity < 30d`. Its members are found by evaluating
+// the rules, so records join and leave the segment as they change.
+type Segment struct {
+	ID int `json:"id"`
+	// OrganizationID is declared rather than embedded through TenantOwned so
+	// that names can be unique per organization and record type
+	OrganizationID int       `json:"organization_id" gorm:"not null;uniqueIndex:idx_segments_name"`
+	RecordType     string    `json:"record_type" gorm:"size:32;not null;uniqueIndex:idx_segments_name"`
+	Name           string    `json:"name" gorm:"size:100;not null;uniqueIndex:idx_segments_name"`
+	Description    string    `json:"description" gorm:"type:text"`
+	Rules          string    `json:"rules" gorm:"type:text;not null"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SetOrganizationID implements Tenanted
+func (s *Segment) SetOrganizationID(id int) {
+	s.OrganizationID = id
+}
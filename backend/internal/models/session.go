@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Session is a sign-in on one device. It is created with the refresh token
+// family at login and follows the family's rotations, recording the client
+// that last refreshed it. Revoking a session revokes its family and every
+// access token issued to it.
+type Session struct {
+	ID             int        `json:"id"`
+	UserID         int        `json:"user_id" gorm:"not null;index"`
+	OrganizationID int        `json:"organization_id" gorm:"not null;index"`
+	FamilyID       string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	UserAgent      string     `json:"user_agent"`
+	IPAddress      string     `json:"ip_address" gorm:"size:64"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastActiveAt   time.Time  `json:"last_active_at"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"` // when the latest refresh token expires
+	RevokedAt      *time.Time `json:"revoked_at"`
+}
+
+// Active reports whether the session can still be refreshed
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
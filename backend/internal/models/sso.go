@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to their account at an OpenID provider. Users are
+// matched by the provider's subject, which unlike the email never changes.
+type UserIdentity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id" gorm:"not null;index"`
+	Provider  string    `json:"provider" gorm:"size:100;not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Subject   string    `json:"subject" gorm:"size:255;not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SSOLoginAttempt remembers a sign-in sent to an OpenID provider until the
+// user comes back with a code. Only a hash of the state is stored; the nonce
+// and PKCE verifier never leave the server.
+type SSOLoginAttempt struct {
+	ID           int        `json:"id"`
+	Provider     string     `json:"provider" gorm:"size:100;not null"`
+	StateHash    string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Nonce        string     `json:"-" gorm:"not null"`
+	CodeVerifier string     `json:"-" gorm:"not null"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt       *time.Time `json:"used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Usable reports whether the attempt has been neither used nor expired
+func (a *SSOLoginAttempt) Usable() bool {
+	return a.UsedAt == nil && time.Now().Before(a.ExpiresAt)
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Types of CRM records that tags, activities and tasks can be attached to
+const (
+	RecordContact = "contact"
+	RecordCompany = "company"
+	RecordDeal    = "deal"
+)
+
+// Tagging attaches a free-form tag to a CRM record. Tags are stored in lower
+// case so that "VIP" and "vip" are the same tag.
+type Tagging struct {
+	ID int `json:"id"`
+	TenantOwned
+	RecordType string    `json:"record_type" gorm:"size:32;not null;uniqueIndex:idx_taggings_record_name"`
+	RecordID   int       `json:"record_id" gorm:"not null;uniqueIndex:idx_taggings_record_name"`
+	Name       string    `json:"name" gorm:"size:100;not null;uniqueIndex:idx_taggings_record_name;index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func tagNames(tags []Tagging) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
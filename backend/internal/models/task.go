@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Task statuses
+const (
+	TaskOpen       = "open"
+	TaskInProgress = "in_progress"
+	TaskDone       = "done"
+	TaskCancelled  = "cancelled"
+)
+
+// Task priorities
+const (
+	TaskLow    = "low"
+	TaskMedium = "medium"
+	TaskHigh   = "high"
+)
+
+// Task is a piece of work assigned to a member, optionally about a CRM record.
+// The assignee is reminded at RemindAt, which cannot be after DueAt, or a
+// default lead time before DueAt when no reminder time is set; RemindedAt
+// records that the reminder went out.
+type Task struct {
+	ID int `json:"id"`
+	TenantOwned
+	Title       string     `json:"title" gorm:"size:255;not null"`
+	Description string     `json:"description" gorm:"type:text"`
+	AssigneeID  *int       `json:"assignee_id" gorm:"index"`
+	Assignee    *User      `json:"assignee,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+	CreatedByID *int       `json:"created_by_id"`
+	CreatedBy   *User      `json:"created_by,omitempty" gorm:"constraint:OnDelete:SET NULL"`
+	DueAt       *time.Time `json:"due_at" gorm:"index"`
+	Priority    string     `json:"priority" gorm:"size:10;not null;default:medium"`
+	Status      string     `json:"status" gorm:"size:20;not null;default:open;index"`
+	RecordType  string     `json:"record_type" gorm:"size:32;index:idx_tasks_record"` // empty when the task is not about a record
+	RecordID    *int       `json:"record_id" gorm:"index:idx_tasks_record"`
+	RemindAt    *time.Time `json:"remind_at"`
+	RemindedAt  *time.Time `json:"reminded_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Pending reports whether the task still has to be done
+func (t *Task) Pending() bool {
+	return t.Status == TaskOpen || t.Status == TaskInProgress
+}
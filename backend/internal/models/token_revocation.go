@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// RevokedToken is a denylisted access token, kept until the token expires
+type RevokedToken struct {
+	TokenID   string    `json:"token_id" gorm:"primaryKey;size:64"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TokenCutoff revokes every access token issued to a user before RevokedBefore
+type TokenCutoff struct {
+	UserID        int       `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	RevokedBefore time.Time `json:"revoked_before" gorm:"not null"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
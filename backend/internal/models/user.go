@@ -1,8 +1,28 @@
 package models
 
+import "time"
+
+// Built-in roles a user can hold in an organization
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// User is an account. API responses never serialize it directly; handlers map
+// it to a response type so that persistence-only fields such as the password
+// hash cannot leak.
 type User struct {
-	ID           int    `json:"id"`
-	Email        string `json:"email" gorm:"unique"`
-	Password     string `json:"password"`
-	BuisnessName string `json:"buisness_name"`
+	ID              int        `json:"id"`
+	Email           string     `json:"email" gorm:"unique"`
+	Password        string     `json:"-"` // bcrypt hash
+	BuisnessName    string     `json:"buisness_name"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	ServiceAccount  bool       `json:"service_account" gorm:"not null;default:false"` // cannot sign in
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// EmailVerified reports whether the user has proven they own their email address
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Purposes a user token can be issued for
+const (
+	UserTokenPasswordReset     = "password_reset"
+	UserTokenEmailVerification = "email_verification"
+)
+
+// UserToken is a single-use token emailed to a user to prove they own their
+// email address, for example to reset their password. Only a hash of the
+// token is stored.
+type UserToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id" gorm:"not null;index"`
+	Purpose   string     `json:"purpose" gorm:"size:32;not null"`
+	TokenHash string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Usable reports whether the token has been neither used nor expired
+func (t *UserToken) Usable() bool {
+	return t.UsedAt == nil && time.Now().Before(t.ExpiresAt)
+}
@@ -0,0 +1,81 @@
+// Package notifier tells users about things that need their attention, such
+// as tasks coming due. Delivery is pluggable; the built-in notifiers send an
+// email through a mailer or only write a log entry.
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/mailer"
+	"go.uber.org/zap"
+)
+
+// Reminder tells a user that a task is due
+type Reminder struct {
+	OrganizationID int
+	UserID         int
+	Email          string
+	TaskID         int
+	Title          string
+	DueAt          *time.Time // nil when the task has a reminder but no due date
+}
+
+// Notifier delivers reminders
+type Notifier interface {
+	Remind(ctx context.Context, reminder Reminder) error
+}
+
+// LogNotifier writes reminders to the log
+type LogNotifier struct {
+	logger *zap.SugaredLogger
+}
+
+// NewLogNotifier creates a notifier that logs reminders
+func NewLogNotifier(logger *zap.SugaredLogger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+// Remind implements Notifier
+func (n *LogNotifier) Remind(ctx context.Context, reminder Reminder) error {
+	n.logger.Infow("Task reminder",
+		"organization_id", reminder.OrganizationID,
+		"user_id", reminder.UserID,
+		"task_id", reminder.TaskID,
+		"due_at", reminder.DueAt,
+	)
+	return nil
+}
+
+// MailNotifier emails reminders to the user, linking to the task in the web app
+type MailNotifier struct {
+	mailer mailer.Mailer
+	appURL string
+}
+
+// NewMailNotifier creates a notifier that emails reminders
+func NewMailNotifier(m mailer.Mailer, appURL string) *MailNotifier {
+	return &MailNotifier{mailer: m, appURL: appURL}
+}
+
+// Remind implements Notifier
+func (n *MailNotifier) Remind(ctx context.Context, reminder Reminder) error {
+	due := "It has no due date."
+	if reminder.DueAt != nil {
+		due = "It is due " + reminder.DueAt.UTC().Format("Mon, 02 Jan 2006 15:04 MST") + "."
+	}
+
+	return n.mailer.Send(ctx, mailer.Message{
+		To:      reminder.Email,
+		Subject: "Reminder: " + reminder.Title,
+		Body: fmt.Sprintf(
+			"This is a reminder about your task \"%s\". %s\n\n"+
+				"Open the task:\n%s\n",
+			reminder.Title,
+			due,
+			n.appURL+"/tasks/"+strconv.Itoa(reminder.TaskID),
+		),
+	})
+}
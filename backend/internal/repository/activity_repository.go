@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/listquery"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ActivityFilter narrows down and orders a listing of activities
+type ActivityFilter struct {
+	RecordType string
+	RecordID   int
+	Segment    int           // a segment, resolved into InSegment by the service
+	InSegment  *SegmentMatch // when set, only activities on the members of the segment
+	Type       string
+	AuthorID   int
+	Filters    *listquery.Query // conditions on and sorts by ActivityFields
+}
+
+// ActivityFields lists the fields activities can be filtered on with filter[...] and sorted by
+var ActivityFields = &listquery.Schema{Fields: map[string]listquery.Field{
+	"type":         {Column: "activities.type", Type: listquery.String},
+	"record_type":  {Column: "activities.record_type", Type: listquery.String},
+	"record_id":    {Column: "activities.record_id", Type: listquery.Int},
+	"author_id":    {Column: "activities.author_id", Type: listquery.Int},
+	"subject":      {Column: "activities.subject", Type: listquery.String},
+	"outcome":      {Column: "activities.outcome", Type: listquery.String},
+	"occurred_at":  {Column: "activities.occurred_at", Type: listquery.Time, Sortable: true},
+	"created_at":   {Column: "activities.created_at", Type: listquery.Time, Sortable: true},
+	"updated_at":   {Column: "activities.updated_at", Type: listquery.Time},
+	"author.email": {Column: "users.email", Type: listquery.String, Through: "SELECT 1 FROM users WHERE users.id = activities.author_id"},
+}}
+
+// ActivityRepository defines data access operations for activities
+type ActivityRepository interface {
+	Create(ctx context.Context, activity *models.Activity) error
+	FindByID(ctx context.Context, id int) (*models.Activity, error)
+	// List returns a page of the context organization's activities together
+	// with the number of activities matching the filter, newest first unless
+	// sorted otherwise
+	List(ctx context.Context, filter ActivityFilter, offset, limit int) ([]models.Activity, int64, error)
+	Update(ctx context.Context, activity *models.Activity) error
+	Delete(ctx context.Context, id int) error
+}
+
+type activityRepository struct {
+	db *gorm.DB
+}
+
+// NewActivityRepository creates a new GORM-backed activity repository
+func NewActivityRepository(database *Database) ActivityRepository {
+	return &activityRepository{db: database.DB}
+}
+
+func (r *activityRepository) Create(ctx context.Context, activity *models.Activity) error {
+	return translateError(conn(ctx, r.db).Omit("Author").Create(activity).Error)
+}
+
+func (r *activityRepository) FindByID(ctx context.Context, id int) (*models.Activity, error) {
+	var activity models.Activity
+	if err := conn(ctx, r.db).Preload("Author").First(&activity, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &activity, nil
+}
+
+func (r *activityRepository) List(ctx context.Context, filter ActivityFilter, offset, limit int) ([]models.Activity, int64, error) {
+	query := conn(ctx, r.db).Model(&models.Activity{})
+	if filter.RecordType != "" {
+		query = query.Where("activities.record_type = ?", filter.RecordType)
+	}
+	if filter.RecordID != 0 {
+		query = query.Where("activities.record_id = ?", filter.RecordID)
+	}
+	if filter.InSegment != nil {
+		query = filter.InSegment.whereAbout(query, "activities")
+	}
+	if filter.Type != "" {
+		query = query.Where("activities.type = ?", filter.Type)
+	}
+	if filter.AuthorID != 0 {
+		query = query.Where("activities.author_id = ?", filter.AuthorID)
+	}
+	query = filter.Filters.Where(query)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, translateError(err)
+	}
+
+	var activities []models.Activity
+	err := orderRecords(query.Preload("Author"), "activities", nil, filter.Filters, "activities.occurred_at DESC").Order("activities.id DESC").
+		Offset(offset).Limit(limit).Find(&activities).Error
+	return activities, total, translateError(err)
+}
+
+func (r *activityRepository) Update(ctx context.Context, activity *models.Activity) error {
+	return translateError(conn(ctx, r.db).Omit(clause.Associations).Save(activity).Error)
+}
+
+func (r *activityRepository) Delete(ctx context.Context, id int) error {
+	result := conn(ctx, r.db).Delete(&models.Activity{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// APIKeyRepository defines data access operations for API keys
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey) error
+	FindByID(ctx context.Context, id int) (*models.APIKey, error)
+	// FindByHash looks a key up across all organizations, since the
+	// organization is only known once the key is found
+	FindByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	// ListForUser returns the user's unrevoked keys in the context organization
+	ListForUser(ctx context.Context, userID int) ([]models.APIKey, error)
+	Revoke(ctx context.Context, id int) error
+	// RevokeAllForUser revokes the user's keys in the context organization
+	RevokeAllForUser(ctx context.Context, userID int) error
+	TouchLastUsed(ctx context.Context, id int, at time.Time) error
+}
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository creates a new GORM-backed API key repository
+func NewAPIKeyRepository(database *Database) APIKeyRepository {
+	return &apiKeyRepository{db: database.DB}
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	return translateError(conn(ctx, r.db).Create(key).Error)
+}
+
+func (r *apiKeyRepository) FindByID(ctx context.Context, id int) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := conn(ctx, r.db).First(&key, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) FindByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := conn(tenant.Unscoped(ctx), r.db).Where("key_hash = ?", hash).First(&key).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) ListForUser(ctx context.Context, userID int) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := conn(ctx, r.db).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at, id").
+		Find(&keys).Error
+	return keys, translateError(err)
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, id int) error {
+	return translateError(conn(ctx, r.db).
+		Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now().UTC()).Error)
+}
+
+func (r *apiKeyRepository) RevokeAllForUser(ctx context.Context, userID int) error {
+	return translateError(conn(ctx, r.db).
+		Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now().UTC()).Error)
+}
+
+func (r *apiKeyRepository) TouchLastUsed(ctx context.Context, id int, at time.Time) error {
+	return translateError(conn(tenant.Unscoped(ctx), r.db).
+		Model(&models.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", at.UTC()).Error)
+}
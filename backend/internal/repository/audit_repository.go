@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// AuditFilter narrows down a listing of audit events
+type AuditFilter struct {
+	Action  string
+	ActorID int
+}
+
+// AuditRepository defines data access operations for the audit log
+type AuditRepository interface {
+	Create(ctx context.Context, event *models.AuditEvent) error
+	// List returns a page of the organization's events, newest first, together
+	// with the number of events matching the filter
+	List(ctx context.Context, organizationID int, filter AuditFilter, offset, limit int) ([]models.AuditEvent, int64, error)
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditRepository creates a new GORM-backed audit repository
+func NewAuditRepository(database *Database) AuditRepository {
+	return &auditRepository{db: database.DB}
+}
+
+func (r *auditRepository) Create(ctx context.Context, event *models.AuditEvent) error {
+	return translateError(conn(ctx, r.db).Create(event).Error)
+}
+
+func (r *auditRepository) List(ctx context.Context, organizationID int, filter AuditFilter, offset, limit int) ([]models.AuditEvent, int64, error) {
+	query := conn(ctx, r.db).Model(&models.AuditEvent{}).Where("organization_id = ?", organizationID)
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, translateError(err)
+	}
+
+	var events []models.AuditEvent
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&events).Error
+	return events, total, translateError(err)
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/listquery"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CompanyFilter narrows down and orders a listing of companies
+type CompanyFilter struct {
+	Search       string // matches names and domains
+	Industry     string
+	OwnerID      int
+	Tag          string
+	Sort         string // the sort parameter, read by the service for sorts by custom fields
+	CustomFields []CustomFieldCondition
+	CustomSort   *CustomFieldSort // ordered among the sorts of Filters
+	Segment      int              // a segment, resolved into InSegment by the service
+	InSegment    *SegmentMatch    // when set, only the members of the segment are listed
+	Filters      *listquery.Query // conditions on and sorts by CompanyFields
+}
+
+// CompanyFields lists the fields companies can be filtered on with filter[...] and sorted by
+var CompanyFields = &listquery.Schema{Fields: map[string]listquery.Field{
+	"name":               {Column: "companies.name", Type: listquery.String, Sortable: true},
+	"domain":             {Column: "companies.domain", Type: listquery.String},
+	"industry":           {Column: "companies.industry", Type: listquery.String},
+	"size":               {Column: "companies.size", Type: listquery.String},
+	"owner_id":           {Column: "companies.owner_id", Type: listquery.Int},
+	"address.city":       {Column: "companies.address_city", Type: listquery.String},
+	"address.region":     {Column: "companies.address_region", Type: listquery.String},
+	"address.country":    {Column: "companies.address_country", Type: listquery.String},
+	"created_at":         {Column: "companies.created_at", Type: listquery.Time, Sortable: true},
+	"updated_at":         {Column: "companies.updated_at", Type: listquery.Time, Sortable: true},
+	"owner.email":        {Column: "users.email", Type: listquery.String, Through: "SELECT 1 FROM users WHERE users.id = companies.owner_id"},
+	"contact.first_name": {Column: "contacts.first_name", Type: listquery.String, Through: companyContacts},
+	"contact.last_name":  {Column: "contacts.last_name", Type: listquery.String, Through: companyContacts},
+	"contact.role":       {Column: "company_contacts.role", Type: listquery.String, Through: companyContacts},
+}}
+
+// companyContacts selects the contacts linked to a company
+const companyContacts = "SELECT 1 FROM company_contacts JOIN contacts ON contacts.id = company_contacts.contact_id " +
+	"WHERE company_contacts.company_id = companies.id"
+
+// CompanyStats summarizes the records related to a company
+type CompanyStats struct {
+	Contacts         int64
+	OpenDeals        int64
+	RecentActivities int64 // activities on the company since the time given to Stats
+}
+
+// CompanyRepository defines data access operations for companies and their contacts
+type CompanyRepository interface {
+	Create(ctx context.Context, company *models.Company) error
+	FindByID(ctx context.Context, id int) (*models.Company, error)
+	// List returns a page of the context organization's companies together
+	// with the number of companies matching the filter
+	List(ctx context.Context, filter CompanyFilter, offset, limit int) ([]models.Company, int64, error)
+	// Update saves the company, replacing its tags
+	Update(ctx context.Context, company *models.Company) error
+	Delete(ctx context.Context, id int) error
+	// CountByIDs returns how many of the given companies exist
+	CountByIDs(ctx context.Context, ids []int) (int64, error)
+	Stats(ctx context.Context, id int, activitySince time.Time) (*CompanyStats, error)
+	// ListContacts returns the links of a company to its contacts, oldest first
+	ListContacts(ctx context.Context, companyID int) ([]models.CompanyContact, error)
+	// LinkContact links a contact to a company, or changes the role of an
+	// existing link
+	LinkContact(ctx context.Context, link *models.CompanyContact) error
+	UnlinkContact(ctx context.Context, companyID, contactID int) error
+}
+
+type companyRepository struct {
+	db *gorm.DB
+}
+
+// NewCompanyRepository creates a new GORM-backed company repository
+func NewCompanyRepository(database *Database) CompanyRepository {
+	return &companyRepository{db: database.DB}
+}
+
+// preload loads the associations of companies
+func (r *companyRepository) preload(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("name") }).
+		Preload("Owner")
+}
+
+func (r *companyRepository) Create(ctx context.Context, company *models.Company) error {
+	return translateError(conn(ctx, r.db).Omit("Owner", "Contacts").Create(company).Error)
+}
+
+func (r *companyRepository) FindByID(ctx context.Context, id int) (*models.Company, error) {
+	var company models.Company
+	if err := r.preload(conn(ctx, r.db)).First(&company, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &company, nil
+}
+
+func (r *companyRepository) List(ctx context.Context, filter CompanyFilter, offset, limit int) ([]models.Company, int64, error) {
+	query := conn(ctx, r.db).Model(&models.Company{})
+	if search := strings.ToLower(strings.TrimSpace(filter.Search)); search != "" {
+		pattern := "%" + escapeLike(search) + "%"
+		query = query.Where(`LOWER(companies.name) LIKE ? ESCAPE '\' OR companies.domain LIKE ? ESCAPE '\'`, pattern, pattern)
+	}
+	if filter.Industry != "" {
+		query = query.Where("LOWER(companies.industry) = ?", strings.ToLower(strings.TrimSpace(filter.Industry)))
+	}
+	if filter.OwnerID != 0 {
+		query = query.Where("companies.owner_id = ?", filter.OwnerID)
+	}
+	if filter.Tag != "" {
+		condition, args := taggedWith("companies", models.RecordCompany, filter.Tag)
+		query = query.Where(condition, args...)
+	}
+
+	if filter.InSegment != nil {
+		query = filter.InSegment.where(query)
+	}
+	query = filter.Filters.Where(query)
+
+	query = whereCustomFields(query, "companies", filter.CustomFields)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, translateError(err)
+	}
+
+	var companies []models.Company
+	err := orderRecords(r.preload(query), "companies", filter.CustomSort, filter.Filters, "companies.created_at DESC").Order("companies.id").
+		Offset(offset).Limit(limit).Find(&companies).Error
+	return companies, total, translateError(err)
+}
+
+func (r *companyRepository) Update(ctx context.Context, company *models.Company) error {
+	return translateError(conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(company).Error; err != nil {
+			return err
+		}
+		return replaceTaggings(tx, models.RecordCompany, company.ID, company.Tags)
+	}))
+}
+
+func (r *companyRepository) Delete(ctx context.Context, id int) error {
+	return translateError(conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Company{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return deleteRecordData(tx, models.RecordCompany, id)
+	}))
+}
+
+func (r *companyRepository) Stats(ctx context.Context, id int, activitySince time.Time) (*CompanyStats, error) {
+	var stats CompanyStats
+	db := conn(ctx, r.db)
+	if err := db.Model(&models.CompanyContact{}).Where("company_id = ?", id).Count(&stats.Contacts).Error; err != nil {
+		return nil, translateError(err)
+	}
+	if err := db.Model(&models.Deal{}).Where("company_id = ? AND status = ?", id, models.DealOpen).Count(&stats.OpenDeals).Error; err != nil {
+		return nil, translateError(err)
+	}
+	err := db.Model(&models.Activity{}).
+		Where("record_type = ? AND record_id = ? AND occurred_at >= ?", models.RecordCompany, id, activitySince).
+		Count(&stats.RecentActivities).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &stats, nil
+}
+
+func (r *companyRepository) ListContacts(ctx context.Context, companyID int) ([]models.CompanyContact, error) {
+	var links []models.CompanyContact
+	err := conn(ctx, r.db).
+		Preload("Contact").
+		Preload("Contact.Emails", func(db *gorm.DB) *gorm.DB { return db.Order("is_primary DESC, id") }).
+		Where("company_id = ?", companyID).
+		Order("created_at, contact_id").
+		Find(&links).Error
+	return links, translateError(err)
+}
+
+func (r *companyRepository) LinkContact(ctx context.Context, link *models.CompanyContact) error {
+	err := conn(ctx, r.db).Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "company_id"}, {Name: "contact_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+	}).Create(link).Error
+	return translateError(err)
+}
+
+func (r *companyRepository) UnlinkContact(ctx context.Context, companyID, contactID int) error {
+	result := conn(ctx, r.db).Where("company_id = ? AND contact_id = ?", companyID, contactID).Delete(&models.CompanyContact{})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *companyRepository) CountByIDs(ctx context.Context, ids []int) (int64, error) {
+	var count int64
+	err := conn(ctx, r.db).Model(&models.Company{}).Where("id IN ?", ids).Count(&count).Error
+	return count, translateError(err)
+}
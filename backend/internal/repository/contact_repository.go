@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/listquery"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ContactFilter narrows down and orders a listing of contacts
+type ContactFilter struct {
+	Search       string // matches names and email addresses
+	OwnerID      int
+	CompanyID    int
+	Tag          string
+	Sort         string // the sort parameter, read by the service for sorts by custom fields
+	CustomFields []CustomFieldCondition
+	CustomSort   *CustomFieldSort // ordered among the sorts of Filters
+	Segment      int              // a segment, resolved into InSegment by the service
+	InSegment    *SegmentMatch    // when set, only the members of the segment are listed
+	Filters      *listquery.Query // conditions on and sorts by ContactFields
+}
+
+// ContactFields lists the fields contacts can be filtered on with filter[...] and sorted by
+var ContactFields = &listquery.Schema{Fields: map[string]listquery.Field{
+	"first_name":       {Column: "contacts.first_name", Type: listquery.String, Sortable: true},
+	"last_name":        {Column: "contacts.last_name", Type: listquery.String, Sortable: true},
+	"job_title":        {Column: "contacts.job_title", Type: listquery.String},
+	"owner_id":         {Column: "contacts.owner_id", Type: listquery.Int},
+	"address.city":     {Column: "contacts.address_city", Type: listquery.String},
+	"address.region":   {Column: "contacts.address_region", Type: listquery.String},
+	"address.country":  {Column: "contacts.address_country", Type: listquery.String},
+	"created_at":       {Column: "contacts.created_at", Type: listquery.Time, Sortable: true},
+	"updated_at":       {Column: "contacts.updated_at", Type: listquery.Time, Sortable: true},
+	"email":            {Column: "contact_emails.email", Type: listquery.String, Through: contactEmails},
+	"phone":            {Column: "contact_phones.number", Type: listquery.String, Through: contactPhones},
+	"owner.email":      {Column: "users.email", Type: listquery.String, Through: "SELECT 1 FROM users WHERE users.id = contacts.owner_id"},
+	"company.name":     {Column: "companies.name", Type: listquery.String, Through: contactCompanies},
+	"company.industry": {Column: "companies.industry", Type: listquery.String, Through: contactCompanies},
+	"company.role":     {Column: "company_contacts.role", Type: listquery.String, Through: contactCompanies},
+}}
+
+// Subqueries selecting the related records of a contact
+const (
+	contactEmails    = "SELECT 1 FROM contact_emails WHERE contact_emails.contact_id = contacts.id"
+	contactPhones    = "SELECT 1 FROM contact_phones WHERE contact_phones.contact_id = contacts.id"
+	contactCompanies = "SELECT 1 FROM company_contacts JOIN companies ON companies.id = company_contacts.company_id " +
+		"WHERE company_contacts.contact_id = contacts.id"
+)
+
+// ContactRepository defines data access operations for contacts
+type ContactRepository interface {
+	Create(ctx context.Context, contact *models.Contact) error
+	FindByID(ctx context.Context, id int) (*models.Contact, error)
+	// List returns a page of the context organization's contacts together
+	// with the number of contacts matching the filter
+	List(ctx context.Context, filter ContactFilter, offset, limit int) ([]models.Contact, int64, error)
+	// Update saves the contact, replacing its emails, phones and tags
+	Update(ctx context.Context, contact *models.Contact) error
+	Delete(ctx context.Context, id int) error
+	// CountByIDs returns how many of the given contacts exist
+	CountByIDs(ctx context.Context, ids []int) (int64, error)
+}
+
+type contactRepository struct {
+	db *gorm.DB
+}
+
+// NewContactRepository creates a new GORM-backed contact repository
+func NewContactRepository(database *Database) ContactRepository {
+	return &contactRepository{db: database.DB}
+}
+
+// preload loads the associations of contacts
+func (r *contactRepository) preload(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Emails", func(db *gorm.DB) *gorm.DB { return db.Order("is_primary DESC, id") }).
+		Preload("Phones", func(db *gorm.DB) *gorm.DB { return db.Order("is_primary DESC, id") }).
+		Preload("Companies", func(db *gorm.DB) *gorm.DB { return db.Order("created_at, company_id") }).
+		Preload("Companies.Company").
+		Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("name") }).
+		Preload("Owner")
+}
+
+func (r *contactRepository) Create(ctx context.Context, contact *models.Contact) error {
+	return translateError(conn(ctx, r.db).Omit("Owner").Create(contact).Error)
+}
+
+func (r *contactRepository) FindByID(ctx context.Context, id int) (*models.Contact, error) {
+	var contact models.Contact
+	if err := r.preload(conn(ctx, r.db)).First(&contact, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &contact, nil
+}
+
+func (r *contactRepository) List(ctx context.Context, filter ContactFilter, offset, limit int) ([]models.Contact, int64, error) {
+	query := conn(ctx, r.db).Model(&models.Contact{})
+	if search := strings.ToLower(strings.TrimSpace(filter.Search)); search != "" {
+		pattern := "%" + escapeLike(search) + "%"
+		query = query.Where(
+			`LOWER(contacts.first_name) LIKE ? ESCAPE '\' OR LOWER(contacts.last_name) LIKE ? ESCAPE '\' OR EXISTS (`+
+				`SELECT 1 FROM contact_emails WHERE contact_emails.contact_id = contacts.id AND LOWER(contact_emails.email) LIKE ? ESCAPE '\')`,
+			pattern, pattern, pattern,
+		)
+	}
+	if filter.OwnerID != 0 {
+		query = query.Where("contacts.owner_id = ?", filter.OwnerID)
+	}
+	if filter.CompanyID != 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM company_contacts WHERE company_contacts.contact_id = contacts.id AND company_contacts.company_id = ?)", filter.CompanyID)
+	}
+	if filter.Tag != "" {
+		condition, args := taggedWith("contacts", models.RecordContact, filter.Tag)
+		query = query.Where(condition, args...)
+	}
+
+	if filter.InSegment != nil {
+		query = filter.InSegment.where(query)
+	}
+	query = filter.Filters.Where(query)
+
+	query = whereCustomFields(query, "contacts", filter.CustomFields)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, translateError(err)
+	}
+
+	var contacts []models.Contact
+	err := orderRecords(r.preload(query), "contacts", filter.CustomSort, filter.Filters, "contacts.created_at DESC").Order("contacts.id").
+		Offset(offset).Limit(limit).Find(&contacts).Error
+	return contacts, total, translateError(err)
+}
+
+func (r *contactRepository) Update(ctx context.Context, contact *models.Contact) error {
+	return translateError(conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(contact).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("contact_id = ?", contact.ID).Delete(&models.ContactEmail{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("contact_id = ?", contact.ID).Delete(&models.ContactPhone{}).Error; err != nil {
+			return err
+		}
+
+		for i := range contact.Emails {
+			contact.Emails[i].ID, contact.Emails[i].ContactID = 0, contact.ID
+		}
+		for i := range contact.Phones {
+			contact.Phones[i].ID, contact.Phones[i].ContactID = 0, contact.ID
+		}
+		if len(contact.Emails) > 0 {
+			if err := tx.Create(&contact.Emails).Error; err != nil {
+				return err
+			}
+		}
+		if len(contact.Phones) > 0 {
+			if err := tx.Create(&contact.Phones).Error; err != nil {
+				return err
+			}
+		}
+		return replaceTaggings(tx, models.RecordContact, contact.ID, contact.Tags)
+	}))
+}
+
+func (r *contactRepository) Delete(ctx context.Context, id int) error {
+	return translateError(conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Contact{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return deleteRecordData(tx, models.RecordContact, id)
+	}))
+}
+
+func (r *contactRepository) CountByIDs(ctx context.Context, ids []int) (int64, error) {
+	var count int64
+	err := conn(ctx, r.db).Model(&models.Contact{}).Where("id IN ?", ids).Count(&count).Error
+	return count, translateError(err)
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Custom field comparison operators
+const (
+	CustomFieldEq  = "eq"  // equal to, or containing the choice for multi-selects
+	CustomFieldGte = "gte" // greater than or equal to
+	CustomFieldLte = "lte" // less than or equal to
+)
+
+// CustomFieldCondition matches records on the value of one of their custom
+// fields. Value has the Go type of the field's values: float64 for numbers,
+// bool for booleans and string otherwise.
+type CustomFieldCondition struct {
+	Key   string
+	Type  string
+	Op    string
+	Value interface{}
+}
+
+// CustomFieldSort orders records by the value of one of their custom fields
+type CustomFieldSort struct {
+	Key  string
+	Type string
+	Desc bool
+	// Position is the number of sorts of the listing query coming before it
+	Position int
+}
+
+// recordModels maps the record types that can have custom fields to their models
+var recordModels = map[string]interface{}{
+	models.RecordContact: &models.Contact{},
+	models.RecordCompany: &models.Company{},
+	models.RecordDeal:    &models.Deal{},
+}
+
+// CustomFieldRepository defines data access operations for custom field definitions
+type CustomFieldRepository interface {
+	Create(ctx context.Context, field *models.CustomField) error
+	FindByID(ctx context.Context, id int) (*models.CustomField, error)
+	// List returns the context organization's custom fields of a record type,
+	// or of every type when recordType is empty, in position order
+	List(ctx context.Context, recordType string) ([]models.CustomField, error)
+	Update(ctx context.Context, field *models.CustomField) error
+	// Delete removes a custom field together with its values on the records
+	Delete(ctx context.Context, field *models.CustomField) error
+}
+
+type customFieldRepository struct {
+	db *gorm.DB
+}
+
+// NewCustomFieldRepository creates a new GORM-backed custom field repository
+func NewCustomFieldRepository(database *Database) CustomFieldRepository {
+	return &customFieldRepository{db: database.DB}
+}
+
+func (r *customFieldRepository) Create(ctx context.Context, field *models.CustomField) error {
+	return translateError(conn(ctx, r.db).Create(field).Error)
+}
+
+func (r *customFieldRepository) FindByID(ctx context.Context, id int) (*models.CustomField, error) {
+	var field models.CustomField
+	if err := conn(ctx, r.db).First(&field, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &field, nil
+}
+
+func (r *customFieldRepository) List(ctx context.Context, recordType string) ([]models.CustomField, error) {
+	query := conn(ctx, r.db)
+	if recordType != "" {
+		query = query.Where("record_type = ?", recordType)
+	}
+	var fields []models.CustomField
+	err := query.Order("record_type, position, id").Find(&fields).Error
+	return fields, translateError(err)
+}
+
+func (r *customFieldRepository) Update(ctx context.Context, field *models.CustomField) error {
+	return translateError(conn(ctx, r.db).Save(field).Error)
+}
+
+func (r *customFieldRepository) Delete(ctx context.Context, field *models.CustomField) error {
+	model, ok := recordModels[field.RecordType]
+	if !ok {
+		return fmt.Errorf("custom fields are not supported on %q records", field.RecordType)
+	}
+
+	return translateError(conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.CustomField{}, field.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return tx.Model(model).Where(customFieldValue("custom_fields", field.Key)+" IS NOT NULL").
+			UpdateColumn("custom_fields", gorm.Expr("custom_fields - "+quoteLiteral(field.Key))).Error
+	}))
+}
+
+// customFieldValue returns the SQL expression of a custom field's value as text
+func customFieldValue(column, key string) string {
+	return column + "->>" + quoteLiteral(key)
+}
+
+// whereCustomFields adds the conditions on custom fields of the table's
+// records to a query
+func whereCustomFields(query *gorm.DB, table string, conditions []CustomFieldCondition) *gorm.DB {
+	for _, condition := range conditions {
+		sql, args := customFieldClause(table, condition)
+		query = query.Where(sql, args...)
+	}
+	return query
+}
+
+// customFieldClause returns the SQL condition on a custom field of the
+// table's records. It is NULL for records without a value.
+func customFieldClause(table string, condition CustomFieldCondition) (string, []interface{}) {
+	column := table + ".custom_fields"
+	value := customFieldValue(column, condition.Key)
+	switch condition.Type {
+	case models.CustomFieldNumber:
+		value = "CAST(" + value + " AS numeric)"
+	case models.CustomFieldBoolean:
+		value = "CAST(" + value + " AS boolean)"
+	}
+
+	switch {
+	case condition.Type == models.CustomFieldMultiSelect:
+		choice, _ := json.Marshal([]interface{}{condition.Value})
+		return column + "->" + quoteLiteral(condition.Key) + " @> CAST(? AS jsonb)", []interface{}{string(choice)}
+	case condition.Op == CustomFieldGte:
+		return value + " >= ?", []interface{}{condition.Value}
+	case condition.Op == CustomFieldLte:
+		return value + " <= ?", []interface{}{condition.Value}
+	default:
+		return value + " = ?", []interface{}{condition.Value}
+	}
+}
+
+// customFieldOrder returns the ORDER BY expression sorting the table's
+// records by a custom field, with records without a value last
+func customFieldOrder(table string, sort CustomFieldSort) string {
+	value := customFieldValue(table+".custom_fields", sort.Key)
+	if sort.Type == models.CustomFieldNumber {
+		value = "CAST(" + value + " AS numeric)"
+	}
+	if sort.Desc {
+		return value + " DESC NULLS LAST"
+	}
+	return value + " ASC NULLS LAST"
+}
+
+// quoteLiteral quotes a value as an SQL string literal
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
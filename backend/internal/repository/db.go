@@ -35,7 +35,8 @@ func NewDatabase(cfg *config.Config, zapLogger *zap.SugaredLogger) (*Database, e
 
 	// Connect to the database
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(gormLogLevel),
+		Logger:         logger.Default.LogMode(gormLogLevel),
+		TranslateError: true, // Map driver errors such as unique violations to GORM errors
 		NowFunc: func() time.Time {
 			return time.Now().UTC() // Use UTC for all timestamps
 		},
@@ -44,6 +45,11 @@ func NewDatabase(cfg *config.Config, zapLogger *zap.SugaredLogger) (*Database, e
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// Scope queries on tenant-owned models to the organization in the context
+	if err := registerTenantScope(db); err != nil {
+		return nil, fmt.Errorf("failed to register tenant scope: %w", err)
+	}
+
 	// Configure connection pool
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -65,8 +71,49 @@ func NewDatabase(cfg *config.Config, zapLogger *zap.SugaredLogger) (*Database, e
 func (d *Database) AutoMigrate() error {
 	d.logger.Info("Running database migrations")
 
+	// custom roles are now unique per organization rather than globally
+	if d.DB.Migrator().HasIndex(&models.Role{}, "idx_roles_name") {
+		if err := d.DB.Migrator().DropIndex(&models.Role{}, "idx_roles_name"); err != nil {
+			return fmt.Errorf("failed to drop role name index: %w", err)
+		}
+	}
+
 	err := d.DB.AutoMigrate(
 		&models.User{},
+		&models.RefreshToken{},
+		&models.Session{},
+		&models.RevokedToken{},
+		&models.TokenCutoff{},
+		&models.Permission{},
+		&models.Role{},
+		&models.Organization{},
+		&models.Membership{},
+		&models.Invitation{},
+		&models.TOTPDevice{},
+		&models.RecoveryCode{},
+		&models.UserToken{},
+		&models.APIKey{},
+		&models.ServiceAccount{},
+		&models.UserIdentity{},
+		&models.SSOLoginAttempt{},
+		&models.AuditEvent{},
+		&models.LoginThrottle{},
+		&models.SCIMToken{},
+		&models.Contact{},
+		&models.ContactEmail{},
+		&models.ContactPhone{},
+		&models.Tagging{},
+		&models.Company{},
+		&models.CompanyContact{},
+		&models.Pipeline{},
+		&models.Stage{},
+		&models.Deal{},
+		&models.DealContact{},
+		&models.DealStageChange{},
+		&models.Activity{},
+		&models.Task{},
+		&models.CustomField{},
+		&models.Segment{},
 	)
 
 	if err != nil {
@@ -76,3 +123,12 @@ func (d *Database) AutoMigrate() error {
 	d.logger.Info("Database migrations completed successfully")
 	return nil
 }
+
+// Close closes the underlying database connection pool
+func (d *Database) Close() error {
+	sqlDB, err := d.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/listquery"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DealFilter narrows down and orders a listing of deals
+type DealFilter struct {
+	Search       string // matches titles
+	PipelineID   int
+	StageID      int
+	Status       string
+	OwnerID      int
+	CompanyID    int
+	ContactID    int
+	Tag          string
+	Sort         string // the sort parameter, read by the service for sorts by custom fields
+	CustomFields []CustomFieldCondition
+	CustomSort   *CustomFieldSort // ordered among the sorts of Filters
+	Segment      int              // a segment, resolved into InSegment by the service
+	InSegment    *SegmentMatch    // when set, only the members of the segment are listed
+	Filters      *listquery.Query // conditions on and sorts by DealFields
+}
+
+// DealFields lists the fields deals can be filtered on with filter[...] and sorted by
+var DealFields = &listquery.Schema{Fields: map[string]listquery.Field{
+	"title":               {Column: "deals.title", Type: listquery.String, Sortable: true},
+	"amount":              {Column: "deals.amount", Type: listquery.Number, Sortable: true},
+	"currency":            {Column: "deals.currency", Type: listquery.String},
+	"status":              {Column: "deals.status", Type: listquery.String},
+	"pipeline_id":         {Column: "deals.pipeline_id", Type: listquery.Int},
+	"stage_id":            {Column: "deals.stage_id", Type: listquery.Int},
+	"owner_id":            {Column: "deals.owner_id", Type: listquery.Int},
+	"company_id":          {Column: "deals.company_id", Type: listquery.Int},
+	"expected_close_date": {Column: "deals.expected_close_date", Type: listquery.Date, Sortable: true},
+	"stage_changed_at":    {Column: "deals.stage_changed_at", Type: listquery.Time},
+	"closed_at":           {Column: "deals.closed_at", Type: listquery.Time},
+	"created_at":          {Column: "deals.created_at", Type: listquery.Time, Sortable: true},
+	"updated_at":          {Column: "deals.updated_at", Type: listquery.Time, Sortable: true},
+	"pipeline.name":       {Column: "pipelines.name", Type: listquery.String, Through: "SELECT 1 FROM pipelines WHERE pipelines.id = deals.pipeline_id"},
+	"stage.name":          {Column: "stages.name", Type: listquery.String, Through: dealStage},
+	"stage.probability":   {Column: "stages.probability", Type: listquery.Int, Through: dealStage},
+	"owner.email":         {Column: "users.email", Type: listquery.String, Through: "SELECT 1 FROM users WHERE users.id = deals.owner_id"},
+	"company.name":        {Column: "companies.name", Type: listquery.String, Through: dealCompany},
+	"company.industry":    {Column: "companies.industry", Type: listquery.String, Through: dealCompany},
+	"contact.first_name":  {Column: "contacts.first_name", Type: listquery.String, Through: dealContacts},
+	"contact.last_name":   {Column: "contacts.last_name", Type: listquery.String, Through: dealContacts},
+}}
+
+// Subqueries selecting the related records of a deal
+const (
+	dealStage    = "SELECT 1 FROM stages WHERE stages.id = deals.stage_id"
+	dealCompany  = "SELECT 1 FROM companies WHERE companies.id = deals.company_id"
+	dealContacts = "SELECT 1 FROM deal_contacts JOIN contacts ON contacts.id = deal_contacts.contact_id " +
+		"WHERE deal_contacts.deal_id = deals.id"
+)
+
+// StageChangeFilter selects the stage changes of a deal, or of the deals of a
+// company or contact
+type StageChangeFilter struct {
+	DealID    int
+	CompanyID int
+	ContactID int
+}
+
+// DealRepository defines data access operations for deals and their stage history
+type DealRepository interface {
+	// Create stores a deal together with its contacts and tags
+	Create(ctx context.Context, deal *models.Deal) error
+	FindByID(ctx context.Context, id int) (*models.Deal, error)
+	// List returns a page of the context organization's deals together with
+	// the number of deals matching the filter
+	List(ctx context.Context, filter DealFilter, offset, limit int) ([]models.Deal, int64, error)
+	// Update saves the deal, replacing its contacts and tags
+	Update(ctx context.Context, deal *models.Deal) error
+	Delete(ctx context.Context, id int) error
+	// CountByIDs returns how many of the given deals exist
+	CountByIDs(ctx context.Context, ids []int) (int64, error)
+	// UpdateStatus saves the stage and status of the deal, leaving its other
+	// details untouched
+	UpdateStatus(ctx context.Context, deal *models.Deal) error
+	// CountByStage returns the number of deals in a stage
+	CountByStage(ctx context.Context, stageID int) (int64, error)
+	// CountByPipeline returns the number of deals in a pipeline
+	CountByPipeline(ctx context.Context, pipelineID int) (int64, error)
+	RecordStageChange(ctx context.Context, change *models.DealStageChange) error
+	// ListStageChanges returns the stage history of a deal, oldest first
+	ListStageChanges(ctx context.Context, dealID int) ([]models.DealStageChange, error)
+	// ListRecentStageChanges returns the newest stage changes matching the
+	// filter with their deals, together with the number of matching changes
+	ListRecentStageChanges(ctx context.Context, filter StageChangeFilter, limit int) ([]models.DealStageChange, int64, error)
+}
+
+type dealRepository struct {
+	db *gorm.DB
+}
+
+// NewDealRepository creates a new GORM-backed deal repository
+func NewDealRepository(database *Database) DealRepository {
+	return &dealRepository{db: database.DB}
+}
+
+// preload loads the associations of deals
+func (r *dealRepository) preload(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Stage").
+		Preload("Company").
+		Preload("Contacts", func(db *gorm.DB) *gorm.DB { return db.Order("created_at, contact_id") }).
+		Preload("Contacts.Contact").
+		Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("name") }).
+		Preload("Owner")
+}
+
+func (r *dealRepository) Create(ctx context.Context, deal *models.Deal) error {
+	return translateError(conn(ctx, r.db).Omit("Stage", "Owner", "Company", "Contacts.Contact").Create(deal).Error)
+}
+
+func (r *dealRepository) FindByID(ctx context.Context, id int) (*models.Deal, error) {
+	var deal models.Deal
+	if err := r.preload(conn(ctx, r.db)).First(&deal, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &deal, nil
+}
+
+func (r *dealRepository) List(ctx context.Context, filter DealFilter, offset, limit int) ([]models.Deal, int64, error) {
+	query := conn(ctx, r.db).Model(&models.Deal{})
+	if search := strings.ToLower(strings.TrimSpace(filter.Search)); search != "" {
+		query = query.Where(`LOWER(deals.title) LIKE ? ESCAPE '\'`, "%"+escapeLike(search)+"%")
+	}
+	if filter.PipelineID != 0 {
+		query = query.Where("deals.pipeline_id = ?", filter.PipelineID)
+	}
+	if filter.StageID != 0 {
+		query = query.Where("deals.stage_id = ?", filter.StageID)
+	}
+	if filter.Status != "" {
+		query = query.Where("deals.status = ?", filter.Status)
+	}
+	if filter.OwnerID != 0 {
+		query = query.Where("deals.owner_id = ?", filter.OwnerID)
+	}
+	if filter.CompanyID != 0 {
+		query = query.Where("deals.company_id = ?", filter.CompanyID)
+	}
+	if filter.ContactID != 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM deal_contacts WHERE deal_contacts.deal_id = deals.id AND deal_contacts.contact_id = ?)", filter.ContactID)
+	}
+	if filter.Tag != "" {
+		condition, args := taggedWith("deals", models.RecordDeal, filter.Tag)
+		query = query.Where(condition, args...)
+	}
+
+	if filter.InSegment != nil {
+		query = filter.InSegment.where(query)
+	}
+	query = filter.Filters.Where(query)
+
+	query = whereCustomFields(query, "deals", filter.CustomFields)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, translateError(err)
+	}
+
+	var deals []models.Deal
+	err := orderRecords(r.preload(query), "deals", filter.CustomSort, filter.Filters, "deals.created_at DESC").Order("deals.id").
+		Offset(offset).Limit(limit).Find(&deals).Error
+	return deals, total, translateError(err)
+}
+
+func (r *dealRepository) Update(ctx context.Context, deal *models.Deal) error {
+	return translateError(conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(deal).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("deal_id = ?", deal.ID).Delete(&models.DealContact{}).Error; err != nil {
+			return err
+		}
+		for i := range deal.Contacts {
+			deal.Contacts[i].DealID, deal.Contacts[i].Contact = deal.ID, nil
+		}
+		if len(deal.Contacts) > 0 {
+			if err := tx.Create(&deal.Contacts).Error; err != nil {
+				return err
+			}
+		}
+		return replaceTaggings(tx, models.RecordDeal, deal.ID, deal.Tags)
+	}))
+}
+
+func (r *dealRepository) UpdateStatus(ctx context.Context, deal *models.Deal) error {
+	err := conn(ctx, r.db).Model(deal).
+		Select("pipeline_id", "stage_id", "status", "close_reason", "stage_changed_at", "closed_at", "updated_at").
+		Updates(deal).Error
+	return translateError(err)
+}
+
+func (r *dealRepository) Delete(ctx context.Context, id int) error {
+	return translateError(conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Deal{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return deleteRecordData(tx, models.RecordDeal, id)
+	}))
+}
+
+func (r *dealRepository) CountByStage(ctx context.Context, stageID int) (int64, error) {
+	var count int64
+	err := conn(ctx, r.db).Model(&models.Deal{}).Where("stage_id = ?", stageID).Count(&count).Error
+	return count, translateError(err)
+}
+
+func (r *dealRepository) CountByPipeline(ctx context.Context, pipelineID int) (int64, error) {
+	var count int64
+	err := conn(ctx, r.db).Model(&models.Deal{}).Where("pipeline_id = ?", pipelineID).Count(&count).Error
+	return count, translateError(err)
+}
+
+func (r *dealRepository) RecordStageChange(ctx context.Context, change *models.DealStageChange) error {
+	return translateError(conn(ctx, r.db).Create(change).Error)
+}
+
+func (r *dealRepository) ListStageChanges(ctx context.Context, dealID int) ([]models.DealStageChange, error) {
+	var changes []models.DealStageChange
+	err := conn(ctx, r.db).Where("deal_id = ?", dealID).Order("created_at, id").Find(&changes).Error
+	return changes, translateError(err)
+}
+
+func (r *dealRepository) ListRecentStageChanges(ctx context.Context, filter StageChangeFilter, limit int) ([]models.DealStageChange, int64, error) {
+	query := conn(ctx, r.db).Model(&models.DealStageChange{})
+	if filter.DealID != 0 {
+		query = query.Where("deal_stage_changes.deal_id = ?", filter.DealID)
+	}
+	if filter.CompanyID != 0 {
+		query = query.Where("deal_stage_changes.deal_id IN (SELECT id FROM deals WHERE deals.company_id = ?)", filter.CompanyID)
+	}
+	if filter.ContactID != 0 {
+		query = query.Where("deal_stage_changes.deal_id IN (SELECT deal_id FROM deal_contacts WHERE deal_contacts.contact_id = ?)", filter.ContactID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, translateError(err)
+	}
+
+	var changes []models.DealStageChange
+	err := query.Preload("Deal").Order("deal_stage_changes.created_at DESC, deal_stage_changes.id DESC").
+		Limit(limit).Find(&changes).Error
+	return changes, total, translateError(err)
+}
+
+func (r *dealRepository) CountByIDs(ctx context.Context, ids []int) (int64, error) {
+	var count int64
+	err := conn(ctx, r.db).Model(&models.Deal{}).Where("id IN ?", ids).Count(&count).Error
+	return count, translateError(err)
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+)
+
+func TestDealListingOrder(t *testing.T) {
+	ctx := tenant.WithOrganization(context.Background(), 3)
+	count := func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "SELECT count(*)") {
+			return []string{"count"}, [][]driver.Value{{int64(1)}}
+		}
+		return nil, nil
+	}
+	query, err := DealFields.Parse(url.Values{"sort": {"-amount,title"}, "filter[stage.name]": {"Demo"}})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter DealFilter
+		order  string
+	}{
+		{"newest first by default", DealFilter{}, "ORDER BY deals.created_at DESC,deals.id LIMIT"},
+		{"sorts of the query", DealFilter{Filters: query}, "ORDER BY deals.amount DESC,deals.title,deals.id LIMIT"},
+		{"custom field first", DealFilter{Filters: query, CustomSort: &CustomFieldSort{Key: "score", Type: models.CustomFieldNumber, Desc: true}},
+			"ORDER BY CAST(deals.custom_fields->>'score' AS numeric) DESC NULLS LAST,deals.amount DESC,deals.title,deals.id LIMIT"},
+		{"custom field among the sorts of the query", DealFilter{Filters: query, CustomSort: &CustomFieldSort{Key: "score", Position: 1}},
+			"ORDER BY deals.amount DESC,deals.custom_fields->>'score' ASC NULLS LAST,deals.title,deals.id LIMIT"},
+		{"custom field alone", DealFilter{CustomSort: &CustomFieldSort{Key: "score", Position: 2}},
+			"ORDER BY deals.custom_fields->>'score' ASC NULLS LAST,deals.id LIMIT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database, fake := newFakeDatabase(t, count)
+			if _, _, err := NewDealRepository(database).List(ctx, tt.filter, 0, 20); err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			statements := fake.Statements()
+			if len(statements) != 2 || !strings.Contains(statements[1].Query, tt.order) {
+				t.Fatalf("statements = %+v, want a page ordered with %s", statements, tt.order)
+			}
+			if tt.filter.Filters != nil {
+				where := `WHERE (EXISTS (SELECT 1 FROM stages WHERE stages.id = deals.stage_id AND stages.name = $1))`
+				if !strings.Contains(statements[1].Query, where) || statements[1].Args[0] != "Demo" {
+					t.Errorf("page = %+v, want the stage filter", statements[1])
+				}
+			}
+		})
+	}
+}
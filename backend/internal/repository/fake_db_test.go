@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeDB is a database/sql driver standing in for Postgres. It records the
+// statements repositories run and answers them with a handler, so that
+// repositories can be tested without a database.
+type fakeDB struct {
+	mu         sync.Mutex
+	statements []fakeStatement
+	// answer returns the columns and rows of a statement; for statements that
+	// do not return rows, the number of rows is the number of rows affected
+	answer func(query string, args []driver.Value) ([]string, [][]driver.Value)
+}
+
+// fakeStatement is a statement run on a fakeDB
+type fakeStatement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// newFakeDatabase returns a Database running its statements on a fakeDB
+func newFakeDatabase(t *testing.T, answer func(query string, args []driver.Value) ([]string, [][]driver.Value)) (*Database, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{answer: answer}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(fake)}), &gorm.Config{
+		Logger:               logger.Discard,
+		TranslateError:       true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("open fake database: %v", err)
+	}
+	if err := registerTenantScope(db); err != nil {
+		t.Fatalf("register tenant scope: %v", err)
+	}
+	return &Database{DB: db}, fake
+}
+
+// Statements returns the statements run so far
+func (f *fakeDB) Statements() []fakeStatement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeStatement(nil), f.statements...)
+}
+
+func (f *fakeDB) run(query string, named []driver.NamedValue) ([]string, [][]driver.Value) {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+	f.mu.Lock()
+	f.statements = append(f.statements, fakeStatement{Query: query, Args: args})
+	f.mu.Unlock()
+	if f.answer == nil {
+		return nil, nil
+	}
+	return f.answer(query, args)
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake database: prepared statements are not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, rows := c.db.run(query, args)
+	return driver.RowsAffected(len(rows)), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	columns, rows := c.db.run(query, args)
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// InvitationRepository defines data access operations for invitations of the context organization
+type InvitationRepository interface {
+	Create(ctx context.Context, invitation *models.Invitation) error
+	FindByID(ctx context.Context, id int) (*models.Invitation, error)
+	// ListPending returns the invitations that can still be accepted, newest first
+	ListPending(ctx context.Context) ([]models.Invitation, error)
+	// Resolve moves a pending invitation to the accepted, declined or revoked
+	// status and reports whether this call did so
+	Resolve(ctx context.Context, id int, status string) (bool, error)
+	// RevokePendingForEmail revokes every pending invitation sent to the email
+	RevokePendingForEmail(ctx context.Context, email string) error
+}
+
+type invitationRepository struct {
+	db *gorm.DB
+}
+
+// NewInvitationRepository creates a new GORM-backed invitation repository
+func NewInvitationRepository(database *Database) InvitationRepository {
+	return &invitationRepository{db: database.DB}
+}
+
+// pendingInvitations matches invitations that were neither resolved nor expired
+const pendingInvitations = "accepted_at IS NULL AND declined_at IS NULL AND revoked_at IS NULL AND expires_at > ?"
+
+// invitationStatusColumns maps resolved statuses to the column recording them
+var invitationStatusColumns = map[string]string{
+	models.InvitationAccepted: "accepted_at",
+	models.InvitationDeclined: "declined_at",
+	models.InvitationRevoked:  "revoked_at",
+}
+
+func (r *invitationRepository) Create(ctx context.Context, invitation *models.Invitation) error {
+	return translateError(conn(ctx, r.db).Create(invitation).Error)
+}
+
+func (r *invitationRepository) FindByID(ctx context.Context, id int) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := conn(ctx, r.db).Preload("InvitedBy").First(&invitation, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &invitation, nil
+}
+
+func (r *invitationRepository) ListPending(ctx context.Context) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	err := conn(ctx, r.db).
+		Preload("InvitedBy").
+		Where(pendingInvitations, time.Now().UTC()).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	return invitations, translateError(err)
+}
+
+func (r *invitationRepository) Resolve(ctx context.Context, id int, status string) (bool, error) {
+	column, ok := invitationStatusColumns[status]
+	if !ok {
+		return false, fmt.Errorf("cannot resolve invitation as %q", status)
+	}
+
+	// a conditional update keeps an invitation from being used twice
+	now := time.Now().UTC()
+	result := conn(ctx, r.db).
+		Model(&models.Invitation{}).
+		Where("id = ?", id).
+		Where(pendingInvitations, now).
+		Update(column, now)
+	if result.Error != nil {
+		return false, translateError(result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *invitationRepository) RevokePendingForEmail(ctx context.Context, email string) error {
+	now := time.Now().UTC()
+	return translateError(conn(ctx, r.db).
+		Model(&models.Invitation{}).
+		Where("email = ?", email).
+		Where(pendingInvitations, now).
+		Update("revoked_at", now).Error)
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginThrottleRepository defines data access operations for failed sign-in tracking
+type LoginThrottleRepository interface {
+	Find(ctx context.Context, email string) (*models.LoginThrottle, error)
+	// RecordFailure counts a failed sign-in and returns the updated record.
+	// Failures before forgetBefore are forgotten, starting a new count.
+	RecordFailure(ctx context.Context, email string, at, forgetBefore time.Time) (*models.LoginThrottle, error)
+	Lock(ctx context.Context, email string, until time.Time) error
+	// Reset forgets every failure of the address and lifts its lock
+	Reset(ctx context.Context, email string) error
+}
+
+type loginThrottleRepository struct {
+	db *gorm.DB
+}
+
+// NewLoginThrottleRepository creates a new GORM-backed login throttle repository
+func NewLoginThrottleRepository(database *Database) LoginThrottleRepository {
+	return &loginThrottleRepository{db: database.DB}
+}
+
+func (r *loginThrottleRepository) Find(ctx context.Context, email string) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	if err := conn(ctx, r.db).Where("email = ?", email).First(&throttle).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &throttle, nil
+}
+
+func (r *loginThrottleRepository) RecordFailure(ctx context.Context, email string, at, forgetBefore time.Time) (*models.LoginThrottle, error) {
+	// a single upsert, so that concurrent attempts cannot lose a count
+	err := conn(ctx, r.db).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "email"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failed_attempts": gorm.Expr(
+				"CASE WHEN login_throttles.last_failed_at < ? THEN 1 ELSE login_throttles.failed_attempts + 1 END",
+				forgetBefore.UTC(),
+			),
+			"last_failed_at": at.UTC(),
+		}),
+	}).Create(&models.LoginThrottle{Email: email, FailedAttempts: 1, LastFailedAt: at.UTC()}).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return r.Find(ctx, email)
+}
+
+func (r *loginThrottleRepository) Lock(ctx context.Context, email string, until time.Time) error {
+	return translateError(conn(ctx, r.db).
+		Model(&models.LoginThrottle{}).
+		Where("email = ?", email).
+		Update("locked_until", until.UTC()).Error)
+}
+
+func (r *loginThrottleRepository) Reset(ctx context.Context, email string) error {
+	return translateError(conn(ctx, r.db).Where("email = ?", email).Delete(&models.LoginThrottle{}).Error)
+}
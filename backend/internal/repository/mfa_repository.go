@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// MFARepository defines data access operations for TOTP devices and recovery codes
+type MFARepository interface {
+	FindDevice(ctx context.Context, userID int) (*models.TOTPDevice, error)
+	// SaveDevice creates or replaces the user's device
+	SaveDevice(ctx context.Context, device *models.TOTPDevice) error
+	// DeleteDevice removes the user's device and recovery codes
+	DeleteDevice(ctx context.Context, userID int) error
+	// UseStep records a verified time step and reports whether it was newer
+	// than the last one used, so that each code is accepted only once
+	UseStep(ctx context.Context, userID int, step int64) (bool, error)
+
+	// ReplaceRecoveryCodes discards the user's recovery codes and stores the given hashes
+	ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error
+	// UseRecoveryCode marks an unused recovery code as used and reports whether it existed
+	UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error)
+	CountUnusedRecoveryCodes(ctx context.Context, userID int) (int64, error)
+}
+
+type mfaRepository struct {
+	db *gorm.DB
+}
+
+// NewMFARepository creates a new GORM-backed MFA repository
+func NewMFARepository(database *Database) MFARepository {
+	return &mfaRepository{db: database.DB}
+}
+
+func (r *mfaRepository) FindDevice(ctx context.Context, userID int) (*models.TOTPDevice, error) {
+	var device models.TOTPDevice
+	if err := conn(ctx, r.db).Where("user_id = ?", userID).First(&device).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &device, nil
+}
+
+func (r *mfaRepository) SaveDevice(ctx context.Context, device *models.TOTPDevice) error {
+	return translateError(conn(ctx, r.db).Save(device).Error)
+}
+
+func (r *mfaRepository) DeleteDevice(ctx context.Context, userID int) error {
+	return translateError(conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.TOTPDevice{}).Error
+	}))
+}
+
+func (r *mfaRepository) UseStep(ctx context.Context, userID int, step int64) (bool, error) {
+	result := conn(ctx, r.db).
+		Model(&models.TOTPDevice{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return false, translateError(result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *mfaRepository) ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error {
+	return translateError(conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.RecoveryCode, len(hashes))
+		for i, hash := range hashes {
+			codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	}))
+}
+
+func (r *mfaRepository) UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error) {
+	result := conn(ctx, r.db).
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now().UTC())
+	if result.Error != nil {
+		return false, translateError(result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *mfaRepository) CountUnusedRecoveryCodes(ctx context.Context, userID int) (int64, error) {
+	var count int64
+	err := conn(ctx, r.db).
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, translateError(err)
+}
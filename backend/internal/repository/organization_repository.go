@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// OrganizationRepository defines data access operations for organizations and their members
+type OrganizationRepository interface {
+	Create(ctx context.Context, organization *models.Organization) error
+	FindByID(ctx context.Context, id int) (*models.Organization, error)
+	FindBySlug(ctx context.Context, slug string) (*models.Organization, error)
+	Update(ctx context.Context, organization *models.Organization) error
+
+	// AddMember creates a membership in the context organization
+	AddMember(ctx context.Context, membership *models.Membership) error
+	// FindMember returns the user's active membership in the context organization
+	FindMember(ctx context.Context, userID int) (*models.Membership, error)
+	// ListMembers returns the active members of the context organization with their users
+	ListMembers(ctx context.Context) ([]models.Membership, error)
+	UpdateMember(ctx context.Context, membership *models.Membership) error
+	RemoveMember(ctx context.Context, userID int) error
+	// ListMembershipsForUser returns every active membership of the user across
+	// all organizations, oldest first. It deliberately bypasses tenant scoping.
+	ListMembershipsForUser(ctx context.Context, userID int) ([]models.Membership, error)
+}
+
+type organizationRepository struct {
+	db *gorm.DB
+}
+
+// NewOrganizationRepository creates a new GORM-backed organization repository
+func NewOrganizationRepository(database *Database) OrganizationRepository {
+	return &organizationRepository{db: database.DB}
+}
+
+func (r *organizationRepository) Create(ctx context.Context, organization *models.Organization) error {
+	return translateError(conn(ctx, r.db).Create(organization).Error)
+}
+
+func (r *organizationRepository) FindByID(ctx context.Context, id int) (*models.Organization, error) {
+	var organization models.Organization
+	if err := conn(ctx, r.db).First(&organization, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &organization, nil
+}
+
+func (r *organizationRepository) FindBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	var organization models.Organization
+	if err := conn(ctx, r.db).Where("slug = ?", slug).First(&organization).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &organization, nil
+}
+
+func (r *organizationRepository) Update(ctx context.Context, organization *models.Organization) error {
+	return translateError(conn(ctx, r.db).Save(organization).Error)
+}
+
+func (r *organizationRepository) AddMember(ctx context.Context, membership *models.Membership) error {
+	return translateError(conn(ctx, r.db).Create(membership).Error)
+}
+
+func (r *organizationRepository) FindMember(ctx context.Context, userID int) (*models.Membership, error) {
+	var membership models.Membership
+	if err := conn(ctx, r.db).Preload("User").Where("user_id = ? AND deactivated_at IS NULL", userID).First(&membership).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &membership, nil
+}
+
+func (r *organizationRepository) ListMembers(ctx context.Context) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := conn(ctx, r.db).Preload("User").Where("deactivated_at IS NULL").Order("created_at").Find(&memberships).Error
+	return memberships, translateError(err)
+}
+
+func (r *organizationRepository) UpdateMember(ctx context.Context, membership *models.Membership) error {
+	return translateError(conn(ctx, r.db).Omit("User", "Organization").Save(membership).Error)
+}
+
+func (r *organizationRepository) RemoveMember(ctx context.Context, userID int) error {
+	result := conn(ctx, r.db).Where("user_id = ?", userID).Delete(&models.Membership{})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *organizationRepository) ListMembershipsForUser(ctx context.Context, userID int) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := conn(tenant.Unscoped(ctx), r.db).
+		Preload("Organization").
+		Where("user_id = ? AND deactivated_at IS NULL", userID).
+		Order("created_at, id").
+		Find(&memberships).Error
+	return memberships, translateError(err)
+}
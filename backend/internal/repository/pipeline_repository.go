@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PipelineRepository defines data access operations for pipelines and their stages
+type PipelineRepository interface {
+	// Create stores a pipeline together with its stages
+	Create(ctx context.Context, pipeline *models.Pipeline) error
+	FindByID(ctx context.Context, id int) (*models.Pipeline, error)
+	// List returns the pipelines of the context organization, oldest first
+	List(ctx context.Context) ([]models.Pipeline, error)
+	// Update saves the pipeline without touching its stages
+	Update(ctx context.Context, pipeline *models.Pipeline) error
+	Delete(ctx context.Context, id int) error
+	FindStage(ctx context.Context, id int) (*models.Stage, error)
+	// SaveStage creates the stage, or updates it when it has an ID
+	SaveStage(ctx context.Context, stage *models.Stage) error
+	DeleteStage(ctx context.Context, id int) error
+}
+
+type pipelineRepository struct {
+	db *gorm.DB
+}
+
+// NewPipelineRepository creates a new GORM-backed pipeline repository
+func NewPipelineRepository(database *Database) PipelineRepository {
+	return &pipelineRepository{db: database.DB}
+}
+
+// withStages loads the stages of pipelines in order
+func withStages(db *gorm.DB) *gorm.DB {
+	return db.Preload("Stages", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") })
+}
+
+func (r *pipelineRepository) Create(ctx context.Context, pipeline *models.Pipeline) error {
+	return translateError(conn(ctx, r.db).Create(pipeline).Error)
+}
+
+func (r *pipelineRepository) FindByID(ctx context.Context, id int) (*models.Pipeline, error) {
+	var pipeline models.Pipeline
+	if err := withStages(conn(ctx, r.db)).First(&pipeline, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &pipeline, nil
+}
+
+func (r *pipelineRepository) List(ctx context.Context) ([]models.Pipeline, error) {
+	var pipelines []models.Pipeline
+	err := withStages(conn(ctx, r.db)).Order("created_at, id").Find(&pipelines).Error
+	return pipelines, translateError(err)
+}
+
+func (r *pipelineRepository) Update(ctx context.Context, pipeline *models.Pipeline) error {
+	return translateError(conn(ctx, r.db).Omit(clause.Associations).Save(pipeline).Error)
+}
+
+func (r *pipelineRepository) Delete(ctx context.Context, id int) error {
+	result := conn(ctx, r.db).Delete(&models.Pipeline{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pipelineRepository) FindStage(ctx context.Context, id int) (*models.Stage, error) {
+	var stage models.Stage
+	if err := conn(ctx, r.db).First(&stage, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &stage, nil
+}
+
+func (r *pipelineRepository) SaveStage(ctx context.Context, stage *models.Stage) error {
+	if stage.ID == 0 {
+		return translateError(conn(ctx, r.db).Create(stage).Error)
+	}
+	return translateError(conn(ctx, r.db).Save(stage).Error)
+}
+
+func (r *pipelineRepository) DeleteStage(ctx context.Context, id int) error {
+	result := conn(ctx, r.db).Delete(&models.Stage{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
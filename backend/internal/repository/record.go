@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/listquery"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// deleteRecordData removes the tags and activities of a record being deleted
+// and detaches the tasks about it
+func deleteRecordData(tx *gorm.DB, recordType string, recordID int) error {
+	if err := deleteTaggings(tx, recordType, recordID); err != nil {
+		return err
+	}
+	if err := deleteActivities(tx, recordType, recordID); err != nil {
+		return err
+	}
+	return tx.Model(&models.Task{}).Where("record_type = ? AND record_id = ?", recordType, recordID).
+		Updates(map[string]interface{}{"record_type": "", "record_id": nil}).Error
+}
+
+// deleteTaggings removes the tags of a record
+func deleteTaggings(tx *gorm.DB, recordType string, recordID int) error {
+	return tx.Where("record_type = ? AND record_id = ?", recordType, recordID).Delete(&models.Tagging{}).Error
+}
+
+// replaceTaggings replaces the tags of a record
+func replaceTaggings(tx *gorm.DB, recordType string, recordID int, taggings []models.Tagging) error {
+	if err := deleteTaggings(tx, recordType, recordID); err != nil {
+		return err
+	}
+	if len(taggings) == 0 {
+		return nil
+	}
+	for i := range taggings {
+		taggings[i].ID, taggings[i].RecordType, taggings[i].RecordID = 0, recordType, recordID
+	}
+	return tx.Create(&taggings).Error
+}
+
+// deleteActivities removes the activities logged against a record
+func deleteActivities(tx *gorm.DB, recordType string, recordID int) error {
+	return tx.Where("record_type = ? AND record_id = ?", recordType, recordID).Delete(&models.Activity{}).Error
+}
+
+// taggedWith returns the condition matching records of the table with a tag
+func taggedWith(table, recordType, tag string) (string, []interface{}) {
+	return "EXISTS (SELECT 1 FROM taggings WHERE taggings.record_type = ? AND taggings.record_id = " + table + ".id AND taggings.name = ?)",
+		[]interface{}{recordType, strings.ToLower(strings.TrimSpace(tag))}
+}
+
+// orderRecords orders a listing of the table's records by the sorts of the
+// query with the custom field sort, if any, at its position among them, or by
+// fallback when there are none
+func orderRecords(db *gorm.DB, table string, custom *CustomFieldSort, query *listquery.Query, fallback string) *gorm.DB {
+	columns := query.Columns()
+	if custom != nil {
+		position := min(custom.Position, len(columns))
+		columns = append(columns[:position:position], append([]clause.OrderByColumn{{
+			Column: clause.Column{Name: customFieldOrder(table, *custom), Raw: true},
+		}}, columns[position:]...)...)
+	}
+	if len(columns) == 0 {
+		return db.Order(fallback)
+	}
+	return db.Order(clause.OrderBy{Columns: columns})
+}
+
+// escapeLike escapes the LIKE wildcards in a value, to be used with ESCAPE '\'
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
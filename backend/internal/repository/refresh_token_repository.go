@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// RefreshTokenRepository defines data access operations for refresh tokens
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *models.RefreshToken) error
+	FindByID(ctx context.Context, id string) (*models.RefreshToken, error)
+	// MarkRotated flags an active token as used and reports whether this call did so.
+	// It returns false when the token was already rotated or revoked.
+	MarkRotated(ctx context.Context, id string) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeAllForUser(ctx context.Context, userID int) error
+}
+
+type refreshTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewRefreshTokenRepository creates a new GORM-backed refresh token repository
+func NewRefreshTokenRepository(database *Database) RefreshTokenRepository {
+	return &refreshTokenRepository{db: database.DB}
+}
+
+func (r *refreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	return translateError(conn(ctx, r.db).Create(token).Error)
+}
+
+func (r *refreshTokenRepository) FindByID(ctx context.Context, id string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := conn(ctx, r.db).Where("id = ?", id).First(&token).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+func (r *refreshTokenRepository) MarkRotated(ctx context.Context, id string) (bool, error) {
+	// a conditional update keeps two concurrent refreshes from both succeeding
+	result := conn(ctx, r.db).
+		Model(&models.RefreshToken{}).
+		Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", id).
+		Update("rotated_at", time.Now().UTC())
+	if result.Error != nil {
+		return false, translateError(result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *refreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	return translateError(conn(ctx, r.db).
+		Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now().UTC()).Error)
+}
+
+func (r *refreshTokenRepository) RevokeAllForUser(ctx context.Context, userID int) error {
+	return translateError(conn(ctx, r.db).
+		Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now().UTC()).Error)
+}
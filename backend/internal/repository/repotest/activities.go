@@ -0,0 +1,186 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.ActivityRepository = (*Activities)(nil)
+
+// Activities is an in-memory activity repository scoped to the organization
+// of the context. Listings apply the filters of the database repository but
+// the conditions of Filters, and are ordered by time, newest first, whatever
+// the sort. Deleting a record in
+// another fake leaves its activities behind.
+type Activities struct {
+	mu         sync.Mutex
+	ids        sequence
+	activities map[int]*models.Activity
+	segments   *Segments
+}
+
+// NewActivities returns an activity repository holding the given activities.
+// When companies is not nil, the recent activities are counted in the
+// company stats.
+func NewActivities(companies *Companies, activities ...models.Activity) *Activities {
+	r := &Activities{activities: make(map[int]*models.Activity)}
+	for i := range activities {
+		activity := copyActivity(&activities[i])
+		r.ids.see(activity.ID)
+		r.activities[activity.ID] = activity
+	}
+	if companies != nil {
+		companies.mu.Lock()
+		companies.activities = r
+		companies.mu.Unlock()
+	}
+	return r
+}
+
+func (r *Activities) Create(ctx context.Context, activity *models.Activity) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if organizationID != 0 {
+		activity.OrganizationID = organizationID
+	}
+	activity.ID = r.ids.next()
+	activity.CreatedAt = time.Now()
+	activity.UpdatedAt = activity.CreatedAt
+	r.activities[activity.ID] = copyActivity(activity)
+	return nil
+}
+
+func (r *Activities) FindByID(ctx context.Context, id int) (*models.Activity, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	activity, ok := r.activities[id]
+	if !ok || !inScope(organizationID, activity.OrganizationID) {
+		return nil, repository.ErrNotFound
+	}
+	return copyActivity(activity), nil
+}
+
+func (r *Activities) List(ctx context.Context, filter repository.ActivityFilter, offset, limit int) ([]models.Activity, int64, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.mu.Lock()
+	segments := r.segments
+	r.mu.Unlock()
+	members, err := segmentMembers(ctx, segments, filter.InSegment)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var activities []models.Activity
+	for _, activity := range r.activities {
+		if inScope(organizationID, activity.OrganizationID) && activityMatches(activity, filter, members) {
+			activities = append(activities, *copyActivity(activity))
+		}
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		if !activities[i].OccurredAt.Equal(activities[j].OccurredAt) {
+			return activities[i].OccurredAt.After(activities[j].OccurredAt)
+		}
+		return activities[i].ID > activities[j].ID
+	})
+	return page(activities, offset, limit), int64(len(activities)), nil
+}
+
+func (r *Activities) Update(ctx context.Context, activity *models.Activity) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.activities[activity.ID]
+	if !ok || !inScope(organizationID, stored.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	activity.OrganizationID, activity.CreatedAt = stored.OrganizationID, stored.CreatedAt
+	activity.UpdatedAt = time.Now()
+	r.activities[activity.ID] = copyActivity(activity)
+	return nil
+}
+
+func (r *Activities) Delete(ctx context.Context, id int) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	activity, ok := r.activities[id]
+	if !ok || !inScope(organizationID, activity.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	delete(r.activities, id)
+	return nil
+}
+
+// countSince returns the number of activities on a record since a time
+func (r *Activities) countSince(recordType string, recordID int, since time.Time) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for _, activity := range r.activities {
+		if activity.RecordType == recordType && activity.RecordID == recordID && !activity.OccurredAt.Before(since) {
+			count++
+		}
+	}
+	return count
+}
+
+// lastOn returns the time of the last activity on a record
+func (r *Activities) lastOn(recordType string, recordID int) *time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var last *time.Time
+	for _, activity := range r.activities {
+		if activity.RecordType == recordType && activity.RecordID == recordID &&
+			(last == nil || activity.OccurredAt.After(*last)) {
+			last = copyTime(&activity.OccurredAt)
+		}
+	}
+	return last
+}
+
+// activityMatches reports whether an activity passes the filter, given the
+// members of its segment
+func activityMatches(activity *models.Activity, filter repository.ActivityFilter, members []int) bool {
+	switch {
+	case filter.RecordType != "" && activity.RecordType != filter.RecordType,
+		filter.RecordID != 0 && activity.RecordID != filter.RecordID,
+		members != nil && (activity.RecordType != filter.InSegment.RecordType || !containsID(members, activity.RecordID)),
+		filter.Type != "" && activity.Type != filter.Type,
+		filter.AuthorID != 0 && (activity.AuthorID == nil || *activity.AuthorID != filter.AuthorID):
+		return false
+	}
+	return true
+}
+
+func copyActivity(activity *models.Activity) *models.Activity {
+	copied := *activity
+	if activity.AuthorID != nil {
+		authorID := *activity.AuthorID
+		copied.AuthorID = &authorID
+	}
+	copied.Author = nil
+	return &copied
+}
@@ -0,0 +1,137 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.APIKeyRepository = (*APIKeys)(nil)
+
+// APIKeys is an in-memory API key repository scoped to the organization of
+// the context, except for the lookups the database repository runs unscoped
+type APIKeys struct {
+	mu   sync.Mutex
+	ids  sequence
+	keys map[int]*models.APIKey
+}
+
+// NewAPIKeys returns an API key repository holding the given keys
+func NewAPIKeys(keys ...models.APIKey) *APIKeys {
+	r := &APIKeys{keys: make(map[int]*models.APIKey)}
+	for i := range keys {
+		key := keys[i]
+		r.ids.see(key.ID)
+		r.keys[key.ID] = &key
+	}
+	return r
+}
+
+func (r *APIKeys) Create(ctx context.Context, key *models.APIKey) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.keys {
+		if existing.KeyHash == key.KeyHash {
+			return repository.ErrDuplicate
+		}
+	}
+	if organizationID != 0 {
+		key.OrganizationID = organizationID
+	}
+	key.ID = r.ids.next()
+	key.CreatedAt = time.Now()
+	stored := *key
+	stored.Scopes = append([]string(nil), key.Scopes...)
+	r.keys[key.ID] = &stored
+	return nil
+}
+
+func (r *APIKeys) FindByID(ctx context.Context, id int) (*models.APIKey, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, ok := r.keys[id]
+	if !ok || !inScope(organizationID, key.OrganizationID) {
+		return nil, repository.ErrNotFound
+	}
+	return copyAPIKey(key), nil
+}
+
+func (r *APIKeys) FindByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range r.keys {
+		if key.KeyHash == hash {
+			return copyAPIKey(key), nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *APIKeys) ListForUser(ctx context.Context, userID int) ([]models.APIKey, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []models.APIKey
+	for _, key := range r.keys {
+		if key.UserID == userID && key.RevokedAt == nil && inScope(organizationID, key.OrganizationID) {
+			keys = append(keys, *copyAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (r *APIKeys) Revoke(ctx context.Context, id int) error {
+	return r.revoke(ctx, func(key *models.APIKey) bool { return key.ID == id })
+}
+
+func (r *APIKeys) RevokeAllForUser(ctx context.Context, userID int) error {
+	return r.revoke(ctx, func(key *models.APIKey) bool { return key.UserID == userID })
+}
+
+func (r *APIKeys) TouchLastUsed(ctx context.Context, id int, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key, ok := r.keys[id]; ok {
+		key.LastUsedAt = &at
+	}
+	return nil
+}
+
+// revoke revokes the unrevoked keys in the context organization that match
+func (r *APIKeys) revoke(ctx context.Context, match func(*models.APIKey) bool) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, key := range r.keys {
+		if match(key) && key.RevokedAt == nil && inScope(organizationID, key.OrganizationID) {
+			key.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func copyAPIKey(key *models.APIKey) *models.APIKey {
+	copied := *key
+	copied.Scopes = append([]string(nil), key.Scopes...)
+	return &copied
+}
@@ -0,0 +1,69 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.AuditRepository = (*Audit)(nil)
+
+// Audit is an in-memory audit log
+type Audit struct {
+	mu     sync.Mutex
+	ids    sequence
+	events []models.AuditEvent
+}
+
+// NewAudit returns an audit log holding the given events
+func NewAudit(events ...models.AuditEvent) *Audit {
+	r := &Audit{}
+	for _, event := range events {
+		r.ids.see(event.ID)
+		r.events = append(r.events, event)
+	}
+	return r
+}
+
+func (r *Audit) Create(ctx context.Context, event *models.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event.ID = r.ids.next()
+	event.CreatedAt = time.Now()
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *Audit) List(ctx context.Context, organizationID int, filter repository.AuditFilter, offset, limit int) ([]models.AuditEvent, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matching []models.AuditEvent
+	for _, event := range r.events {
+		if event.OrganizationID == nil || *event.OrganizationID != organizationID ||
+			filter.Action != "" && event.Action != filter.Action ||
+			filter.ActorID != 0 && (event.ActorID == nil || *event.ActorID != filter.ActorID) {
+			continue
+		}
+		matching = append(matching, event)
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		if !matching[i].CreatedAt.Equal(matching[j].CreatedAt) {
+			return matching[i].CreatedAt.After(matching[j].CreatedAt)
+		}
+		return matching[i].ID > matching[j].ID
+	})
+
+	total := int64(len(matching))
+	if offset >= len(matching) {
+		return nil, total, nil
+	}
+	matching = matching[offset:]
+	if limit < len(matching) {
+		matching = matching[:limit]
+	}
+	return matching, total, nil
+}
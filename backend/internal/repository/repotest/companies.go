@@ -0,0 +1,334 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.CompanyRepository = (*Companies)(nil)
+
+// Companies is an in-memory company repository scoped to the organization
+// of the context. Companies are linked to the contacts of the contact
+// repository given to NewCompanies, which sees the links as well, and their
+// stats count the open deals and recent activities of the deal and activity
+// repositories created over them. Listings apply the search, industry, owner,
+// tag, segment and custom field filters like the database repository and are
+// ordered newest first whatever the sort.
+type Companies struct {
+	mu         sync.Mutex
+	ids        sequence
+	companies  map[int]*models.Company
+	links      map[[2]int]*models.CompanyContact // keyed by company and contact ID
+	contacts   *Contacts
+	deals      *Deals
+	activities *Activities
+	segments   *Segments
+}
+
+// NewCompanies returns a company repository holding the given companies,
+// linking them to contacts
+func NewCompanies(contacts *Contacts, companies ...models.Company) *Companies {
+	r := &Companies{
+		companies: make(map[int]*models.Company),
+		links:     make(map[[2]int]*models.CompanyContact),
+		contacts:  contacts,
+	}
+	for i := range companies {
+		company := copyCompany(&companies[i])
+		r.ids.see(company.ID)
+		r.companies[company.ID] = company
+	}
+	contacts.mu.Lock()
+	contacts.companies = r
+	contacts.mu.Unlock()
+	return r
+}
+
+func (r *Companies) Create(ctx context.Context, company *models.Company) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if organizationID != 0 {
+		company.OrganizationID = organizationID
+	}
+	company.ID = r.ids.next()
+	company.CreatedAt = time.Now()
+	company.UpdatedAt = company.CreatedAt
+	r.companies[company.ID] = copyCompany(company)
+	return nil
+}
+
+func (r *Companies) FindByID(ctx context.Context, id int) (*models.Company, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	company, ok := r.companies[id]
+	if !ok || !inScope(organizationID, company.OrganizationID) {
+		return nil, repository.ErrNotFound
+	}
+	return copyCompany(company), nil
+}
+
+func (r *Companies) List(ctx context.Context, filter repository.CompanyFilter, offset, limit int) ([]models.Company, int64, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.mu.Lock()
+	segments := r.segments
+	r.mu.Unlock()
+	members, err := segmentMembers(ctx, segments, filter.InSegment)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var companies []models.Company
+	for _, company := range r.companies {
+		if inScope(organizationID, company.OrganizationID) && companyMatches(company, filter, members) {
+			companies = append(companies, *copyCompany(company))
+		}
+	}
+	sort.Slice(companies, func(i, j int) bool { return companies[i].ID > companies[j].ID })
+	return page(companies, offset, limit), int64(len(companies)), nil
+}
+
+func (r *Companies) Update(ctx context.Context, company *models.Company) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.companies[company.ID]
+	if !ok || !inScope(organizationID, stored.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	company.OrganizationID, company.CreatedAt = stored.OrganizationID, stored.CreatedAt
+	company.UpdatedAt = time.Now()
+	r.companies[company.ID] = copyCompany(company)
+	return nil
+}
+
+func (r *Companies) Delete(ctx context.Context, id int) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	company, ok := r.companies[id]
+	if !ok || !inScope(organizationID, company.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	delete(r.companies, id)
+	for key := range r.links {
+		if key[0] == id {
+			delete(r.links, key)
+		}
+	}
+	return nil
+}
+
+func (r *Companies) CountByIDs(ctx context.Context, ids []int) (int64, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for id := range distinct(ids) {
+		if company, ok := r.companies[id]; ok && inScope(organizationID, company.OrganizationID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *Companies) Stats(ctx context.Context, id int, activitySince time.Time) (*repository.CompanyStats, error) {
+	if _, err := scope(ctx); err != nil {
+		return nil, err
+	}
+	stats := &repository.CompanyStats{Contacts: int64(len(r.linksOfCompany(id)))}
+	r.mu.Lock()
+	deals, activities := r.deals, r.activities
+	r.mu.Unlock()
+	if deals != nil {
+		stats.OpenDeals = deals.openDealsOf(id)
+	}
+	if activities != nil {
+		stats.RecentActivities = activities.countSince(models.RecordCompany, id, activitySince)
+	}
+	return stats, nil
+}
+
+func (r *Companies) ListContacts(ctx context.Context, companyID int) ([]models.CompanyContact, error) {
+	if _, err := scope(ctx); err != nil {
+		return nil, err
+	}
+	links := r.linksOfCompany(companyID)
+	for i := range links {
+		if contact, err := r.contacts.FindByID(ctx, links[i].ContactID); err == nil {
+			contact.Companies = nil
+			links[i].Contact = contact
+		}
+	}
+	return links, nil
+}
+
+func (r *Companies) LinkContact(ctx context.Context, link *models.CompanyContact) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := [2]int{link.CompanyID, link.ContactID}
+	now := time.Now()
+	if organizationID != 0 {
+		link.OrganizationID = organizationID
+	}
+	link.CreatedAt, link.UpdatedAt = now, now
+	if existing, ok := r.links[key]; ok {
+		link.CreatedAt = existing.CreatedAt
+	}
+	stored := *link
+	stored.Company, stored.Contact = nil, nil
+	r.links[key] = &stored
+	return nil
+}
+
+func (r *Companies) UnlinkContact(ctx context.Context, companyID, contactID int) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := [2]int{companyID, contactID}
+	if link, ok := r.links[key]; !ok || !inScope(organizationID, link.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	delete(r.links, key)
+	return nil
+}
+
+// linksOfCompany returns the links of a company to its contacts, oldest first
+func (r *Companies) linksOfCompany(companyID int) []models.CompanyContact {
+	return r.listLinks(func(link *models.CompanyContact) bool { return link.CompanyID == companyID }, false)
+}
+
+// linksOfContact returns the links of a contact to its companies with the
+// companies, oldest first
+func (r *Companies) linksOfContact(contactID int) []models.CompanyContact {
+	return r.listLinks(func(link *models.CompanyContact) bool { return link.ContactID == contactID }, true)
+}
+
+// listLinks returns copies of the matching links, oldest first
+func (r *Companies) listLinks(match func(*models.CompanyContact) bool, withCompany bool) []models.CompanyContact {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var links []models.CompanyContact
+	for _, link := range r.links {
+		if !match(link) {
+			continue
+		}
+		copied := *link
+		if company, ok := r.companies[link.CompanyID]; ok && withCompany {
+			copied.Company = copyCompany(company)
+		}
+		links = append(links, copied)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if !links[i].CreatedAt.Equal(links[j].CreatedAt) {
+			return links[i].CreatedAt.Before(links[j].CreatedAt)
+		}
+		return links[i].ContactID < links[j].ContactID
+	})
+	return links
+}
+
+// unlinkContact removes the links of a deleted contact
+func (r *Companies) unlinkContact(contactID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.links {
+		if key[1] == contactID {
+			delete(r.links, key)
+		}
+	}
+}
+
+// retag calls change with the taggings of the companies in scope among ids
+func (r *Companies) retag(organizationID int, ids []int, change func(organizationID, id int, taggings *[]models.Tagging)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := range distinct(ids) {
+		if company, ok := r.companies[id]; ok && inScope(organizationID, company.OrganizationID) {
+			change(company.OrganizationID, id, &company.Tags)
+		}
+	}
+}
+
+// tagNames returns the names of the tags on the companies in scope, once
+// per company carrying them
+func (r *Companies) tagNames(organizationID int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for _, company := range r.companies {
+		if inScope(organizationID, company.OrganizationID) {
+			for _, tagging := range company.Tags {
+				names = append(names, tagging.Name)
+			}
+		}
+	}
+	return names
+}
+
+// companyMatches reports whether a company passes the filter, given the
+// members of its segment
+func companyMatches(company *models.Company, filter repository.CompanyFilter, members []int) bool {
+	if search := strings.ToLower(strings.TrimSpace(filter.Search)); search != "" &&
+		!strings.Contains(strings.ToLower(company.Name), search) && !strings.Contains(company.Domain, search) {
+		return false
+	}
+	if filter.Industry != "" && !strings.EqualFold(company.Industry, strings.TrimSpace(filter.Industry)) {
+		return false
+	}
+	if filter.OwnerID != 0 && (company.OwnerID == nil || *company.OwnerID != filter.OwnerID) {
+		return false
+	}
+	if members != nil && !containsID(members, company.ID) {
+		return false
+	}
+	if filter.Tag != "" && !tagged(company.Tags, filter.Tag) {
+		return false
+	}
+	return customFieldsMatch(company.CustomFields, filter.CustomFields)
+}
+
+func copyCompany(company *models.Company) *models.Company {
+	copied := *company
+	copied.Tags = append([]models.Tagging(nil), company.Tags...)
+	copied.CustomFields = copyCustomValues(company.CustomFields)
+	if company.OwnerID != nil {
+		ownerID := *company.OwnerID
+		copied.OwnerID = &ownerID
+	}
+	copied.Owner, copied.Contacts = nil, nil
+	return &copied
+}
@@ -0,0 +1,272 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.ContactRepository = (*Contacts)(nil)
+
+// Contacts is an in-memory contact repository scoped to the organization of
+// the context. Listings apply the search, owner, company, tag, segment and
+// custom field filters like the database repository and are ordered newest
+// first whatever the sort. Contacts are loaded with their links to the
+// companies of the company repository created over them, if any.
+type Contacts struct {
+	mu        sync.Mutex
+	ids       sequence
+	contacts  map[int]*models.Contact
+	companies *Companies
+	segments  *Segments
+}
+
+// NewContacts returns a contact repository holding the given contacts
+func NewContacts(contacts ...models.Contact) *Contacts {
+	r := &Contacts{contacts: make(map[int]*models.Contact)}
+	for i := range contacts {
+		contact := copyContact(&contacts[i])
+		r.ids.see(contact.ID)
+		r.contacts[contact.ID] = contact
+	}
+	return r
+}
+
+func (r *Contacts) Create(ctx context.Context, contact *models.Contact) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if organizationID != 0 {
+		contact.OrganizationID = organizationID
+	}
+	contact.ID = r.ids.next()
+	contact.CreatedAt = time.Now()
+	contact.UpdatedAt = contact.CreatedAt
+	r.contacts[contact.ID] = copyContact(contact)
+	return nil
+}
+
+func (r *Contacts) FindByID(ctx context.Context, id int) (*models.Contact, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	contact, ok := r.contacts[id]
+	if ok && inScope(organizationID, contact.OrganizationID) {
+		contact = copyContact(contact)
+	} else {
+		contact = nil
+	}
+	companies := r.companies
+	r.mu.Unlock()
+	if contact == nil {
+		return nil, repository.ErrNotFound
+	}
+	if companies != nil {
+		contact.Companies = companies.linksOfContact(id)
+	}
+	return contact, nil
+}
+
+func (r *Contacts) List(ctx context.Context, filter repository.ContactFilter, offset, limit int) ([]models.Contact, int64, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	var linked map[int]bool
+	if filter.CompanyID != 0 {
+		linked = r.linkedTo(filter.CompanyID)
+	}
+	r.mu.Lock()
+	segments := r.segments
+	r.mu.Unlock()
+	members, err := segmentMembers(ctx, segments, filter.InSegment)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.mu.Lock()
+	var contacts []models.Contact
+	for _, contact := range r.contacts {
+		if inScope(organizationID, contact.OrganizationID) && contactMatches(contact, filter, members) &&
+			(linked == nil || linked[contact.ID]) {
+			contacts = append(contacts, *copyContact(contact))
+		}
+	}
+	companies := r.companies
+	r.mu.Unlock()
+
+	sort.Slice(contacts, func(i, j int) bool { return contacts[i].ID > contacts[j].ID })
+	listed := page(contacts, offset, limit)
+	if companies != nil {
+		for i := range listed {
+			listed[i].Companies = companies.linksOfContact(listed[i].ID)
+		}
+	}
+	return listed, int64(len(contacts)), nil
+}
+
+func (r *Contacts) Update(ctx context.Context, contact *models.Contact) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.contacts[contact.ID]
+	if !ok || !inScope(organizationID, stored.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	contact.OrganizationID, contact.CreatedAt = stored.OrganizationID, stored.CreatedAt
+	contact.UpdatedAt = time.Now()
+	r.contacts[contact.ID] = copyContact(contact)
+	return nil
+}
+
+func (r *Contacts) Delete(ctx context.Context, id int) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	contact, ok := r.contacts[id]
+	if ok && inScope(organizationID, contact.OrganizationID) {
+		delete(r.contacts, id)
+	} else {
+		ok = false
+	}
+	companies := r.companies
+	r.mu.Unlock()
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if companies != nil {
+		companies.unlinkContact(id)
+	}
+	return nil
+}
+
+func (r *Contacts) CountByIDs(ctx context.Context, ids []int) (int64, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for id := range distinct(ids) {
+		if contact, ok := r.contacts[id]; ok && inScope(organizationID, contact.OrganizationID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// linkedTo returns the IDs of the contacts linked to the company
+func (r *Contacts) linkedTo(companyID int) map[int]bool {
+	r.mu.Lock()
+	companies := r.companies
+	r.mu.Unlock()
+	linked := make(map[int]bool)
+	if companies != nil {
+		for _, link := range companies.linksOfCompany(companyID) {
+			linked[link.ContactID] = true
+		}
+	}
+	return linked
+}
+
+// retag calls change with the taggings of the contacts in scope among ids
+func (r *Contacts) retag(organizationID int, ids []int, change func(organizationID, id int, taggings *[]models.Tagging)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := range distinct(ids) {
+		if contact, ok := r.contacts[id]; ok && inScope(organizationID, contact.OrganizationID) {
+			change(contact.OrganizationID, id, &contact.Tags)
+		}
+	}
+}
+
+// tagNames returns the names of the tags on the contacts in scope, once
+// per contact carrying them
+func (r *Contacts) tagNames(organizationID int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for _, contact := range r.contacts {
+		if inScope(organizationID, contact.OrganizationID) {
+			for _, tagging := range contact.Tags {
+				names = append(names, tagging.Name)
+			}
+		}
+	}
+	return names
+}
+
+// contactMatches reports whether a contact passes the filter, given the
+// members of its segment
+func contactMatches(contact *models.Contact, filter repository.ContactFilter, members []int) bool {
+	if search := strings.ToLower(strings.TrimSpace(filter.Search)); search != "" {
+		found := strings.Contains(strings.ToLower(contact.FirstName), search) ||
+			strings.Contains(strings.ToLower(contact.LastName), search)
+		for _, email := range contact.Emails {
+			found = found || strings.Contains(strings.ToLower(email.Email), search)
+		}
+		if !found {
+			return false
+		}
+	}
+	if filter.OwnerID != 0 && (contact.OwnerID == nil || *contact.OwnerID != filter.OwnerID) {
+		return false
+	}
+	if members != nil && !containsID(members, contact.ID) {
+		return false
+	}
+	if filter.Tag != "" && !tagged(contact.Tags, filter.Tag) {
+		return false
+	}
+	return customFieldsMatch(contact.CustomFields, filter.CustomFields)
+}
+
+// distinct returns the set of the IDs
+func distinct(ids []int) map[int]bool {
+	set := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// tagged reports whether the taggings include the tag
+func tagged(taggings []models.Tagging, tag string) bool {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	for _, tagging := range taggings {
+		if tagging.Name == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func copyContact(contact *models.Contact) *models.Contact {
+	copied := *contact
+	copied.Emails = append([]models.ContactEmail(nil), contact.Emails...)
+	copied.Phones = append([]models.ContactPhone(nil), contact.Phones...)
+	copied.Tags = append([]models.Tagging(nil), contact.Tags...)
+	copied.CustomFields = copyCustomValues(contact.CustomFields)
+	copied.Companies = nil
+	if contact.OwnerID != nil {
+		ownerID := *contact.OwnerID
+		copied.OwnerID = &ownerID
+	}
+	copied.Owner = nil
+	return &copied
+}
@@ -0,0 +1,240 @@
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.CustomFieldRepository = (*CustomFields)(nil)
+
+// CustomFields is an in-memory custom field repository scoped to the
+// organization of the context, with keys unique per organization and record
+// type. Deleting a field leaves its values on the records of the other fakes.
+type CustomFields struct {
+	mu     sync.Mutex
+	ids    sequence
+	fields map[int]*models.CustomField
+}
+
+// NewCustomFields returns a custom field repository holding the given fields
+func NewCustomFields(fields ...models.CustomField) *CustomFields {
+	r := &CustomFields{fields: make(map[int]*models.CustomField)}
+	for i := range fields {
+		field := copyCustomField(&fields[i])
+		r.ids.see(field.ID)
+		r.fields[field.ID] = field
+	}
+	return r
+}
+
+func (r *CustomFields) Create(ctx context.Context, field *models.CustomField) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if organizationID != 0 {
+		field.OrganizationID = organizationID
+	}
+	if r.keyTaken(field) {
+		return repository.ErrDuplicate
+	}
+	field.ID = r.ids.next()
+	field.CreatedAt = time.Now()
+	field.UpdatedAt = field.CreatedAt
+	r.fields[field.ID] = copyCustomField(field)
+	return nil
+}
+
+func (r *CustomFields) FindByID(ctx context.Context, id int) (*models.CustomField, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	field, ok := r.fields[id]
+	if !ok || !inScope(organizationID, field.OrganizationID) {
+		return nil, repository.ErrNotFound
+	}
+	return copyCustomField(field), nil
+}
+
+func (r *CustomFields) List(ctx context.Context, recordType string) ([]models.CustomField, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var fields []models.CustomField
+	for _, field := range r.fields {
+		if inScope(organizationID, field.OrganizationID) && (recordType == "" || field.RecordType == recordType) {
+			fields = append(fields, *copyCustomField(field))
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i], fields[j]
+		if a.RecordType != b.RecordType {
+			return a.RecordType < b.RecordType
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		return a.ID < b.ID
+	})
+	return fields, nil
+}
+
+func (r *CustomFields) Update(ctx context.Context, field *models.CustomField) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.fields[field.ID]
+	if !ok || !inScope(organizationID, stored.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	field.OrganizationID, field.CreatedAt = stored.OrganizationID, stored.CreatedAt
+	if r.keyTaken(field) {
+		return repository.ErrDuplicate
+	}
+	field.UpdatedAt = time.Now()
+	r.fields[field.ID] = copyCustomField(field)
+	return nil
+}
+
+func (r *CustomFields) Delete(ctx context.Context, field *models.CustomField) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.fields[field.ID]
+	if !ok || !inScope(organizationID, stored.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	delete(r.fields, field.ID)
+	return nil
+}
+
+// keyTaken reports whether another field of the organization and record type
+// has the key of the field. The caller holds the lock.
+func (r *CustomFields) keyTaken(field *models.CustomField) bool {
+	for _, other := range r.fields {
+		if other.ID != field.ID && other.OrganizationID == field.OrganizationID &&
+			other.RecordType == field.RecordType && other.Key == field.Key {
+			return true
+		}
+	}
+	return false
+}
+
+// customFieldsMatch reports whether the custom field values of a record meet
+// every condition, comparing them the way the database repository does
+func customFieldsMatch(values models.CustomFieldValues, conditions []repository.CustomFieldCondition) bool {
+	for _, condition := range conditions {
+		value, ok := values[condition.Key]
+		if !ok {
+			return false
+		}
+		switch {
+		case condition.Type == models.CustomFieldMultiSelect:
+			if !hasChoice(value, condition.Value) {
+				return false
+			}
+		case condition.Type == models.CustomFieldNumber:
+			number, ok := value.(float64)
+			wanted, _ := condition.Value.(float64)
+			if !ok || !compareValues(condition.Op, number-wanted) {
+				return false
+			}
+		case condition.Type == models.CustomFieldBoolean:
+			if value != condition.Value {
+				return false
+			}
+		default:
+			// text and dates compare as strings, like their values as text
+			if !compareValues(condition.Op, float64(strings.Compare(fmt.Sprint(value), fmt.Sprint(condition.Value)))) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compareValues reports whether a value compared with the value of a
+// condition, given as their difference, meets the operator
+func compareValues(op string, difference float64) bool {
+	switch op {
+	case repository.CustomFieldGte:
+		return difference >= 0
+	case repository.CustomFieldLte:
+		return difference <= 0
+	default:
+		return difference == 0
+	}
+}
+
+// hasChoice reports whether the value of a multi-select includes a choice
+func hasChoice(value, choice interface{}) bool {
+	switch choices := value.(type) {
+	case []string:
+		for _, candidate := range choices {
+			if candidate == choice {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, candidate := range choices {
+			if candidate == choice {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// copyCustomValues returns a copy of custom field values, with the choices of
+// multi-selects copied as well
+func copyCustomValues(values models.CustomFieldValues) models.CustomFieldValues {
+	if values == nil {
+		return nil
+	}
+	copied := make(models.CustomFieldValues, len(values))
+	for key, value := range values {
+		switch choices := value.(type) {
+		case []string:
+			value = append([]string(nil), choices...)
+		case []interface{}:
+			value = append([]interface{}(nil), choices...)
+		}
+		copied[key] = value
+	}
+	return copied
+}
+
+func copyCustomField(field *models.CustomField) *models.CustomField {
+	copied := *field
+	copied.Options = append([]string(nil), field.Options...)
+	if field.Min != nil {
+		bound := *field.Min
+		copied.Min = &bound
+	}
+	if field.Max != nil {
+		bound := *field.Max
+		copied.Max = &bound
+	}
+	return &copied
+}
@@ -0,0 +1,390 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.DealRepository = (*Deals)(nil)
+
+// Deals is an in-memory deal repository scoped to the organization of the
+// context. Listings apply every filter of the database repository and are
+// ordered newest first whatever the sort. Deals are loaded without their
+// stage, owner, company and contact details.
+type Deals struct {
+	mu        sync.Mutex
+	ids       sequence
+	changeIDs sequence
+	deals     map[int]*models.Deal
+	changes   map[int]*models.DealStageChange
+	segments  *Segments
+}
+
+// NewDeals returns a deal repository holding the given deals. When companies
+// is not nil, the open deals are counted in the company stats.
+func NewDeals(companies *Companies, deals ...models.Deal) *Deals {
+	r := &Deals{deals: make(map[int]*models.Deal), changes: make(map[int]*models.DealStageChange)}
+	for i := range deals {
+		deal := copyDeal(&deals[i])
+		r.ids.see(deal.ID)
+		r.deals[deal.ID] = deal
+	}
+	if companies != nil {
+		companies.mu.Lock()
+		companies.deals = r
+		companies.mu.Unlock()
+	}
+	return r
+}
+
+func (r *Deals) Create(ctx context.Context, deal *models.Deal) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if organizationID != 0 {
+		deal.OrganizationID = organizationID
+	}
+	deal.ID = r.ids.next()
+	deal.CreatedAt = time.Now()
+	deal.UpdatedAt = deal.CreatedAt
+	for i := range deal.Contacts {
+		deal.Contacts[i].DealID, deal.Contacts[i].OrganizationID = deal.ID, deal.OrganizationID
+		deal.Contacts[i].CreatedAt = deal.CreatedAt
+	}
+	r.deals[deal.ID] = copyDeal(deal)
+	return nil
+}
+
+func (r *Deals) FindByID(ctx context.Context, id int) (*models.Deal, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deal, ok := r.deals[id]
+	if !ok || !inScope(organizationID, deal.OrganizationID) {
+		return nil, repository.ErrNotFound
+	}
+	return copyDeal(deal), nil
+}
+
+func (r *Deals) List(ctx context.Context, filter repository.DealFilter, offset, limit int) ([]models.Deal, int64, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.mu.Lock()
+	segments := r.segments
+	r.mu.Unlock()
+	members, err := segmentMembers(ctx, segments, filter.InSegment)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deals []models.Deal
+	for _, deal := range r.deals {
+		if inScope(organizationID, deal.OrganizationID) && dealMatches(deal, filter, members) {
+			deals = append(deals, *copyDeal(deal))
+		}
+	}
+	sort.Slice(deals, func(i, j int) bool { return deals[i].ID > deals[j].ID })
+	return page(deals, offset, limit), int64(len(deals)), nil
+}
+
+func (r *Deals) Update(ctx context.Context, deal *models.Deal) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.deals[deal.ID]
+	if !ok || !inScope(organizationID, stored.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	deal.OrganizationID, deal.CreatedAt = stored.OrganizationID, stored.CreatedAt
+	deal.UpdatedAt = time.Now()
+	for i := range deal.Contacts {
+		deal.Contacts[i].DealID, deal.Contacts[i].OrganizationID = deal.ID, deal.OrganizationID
+		deal.Contacts[i].CreatedAt = deal.UpdatedAt
+	}
+	r.deals[deal.ID] = copyDeal(deal)
+	return nil
+}
+
+func (r *Deals) Delete(ctx context.Context, id int) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deal, ok := r.deals[id]
+	if !ok || !inScope(organizationID, deal.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	delete(r.deals, id)
+	for changeID, change := range r.changes {
+		if change.DealID == id {
+			delete(r.changes, changeID)
+		}
+	}
+	return nil
+}
+
+func (r *Deals) CountByIDs(ctx context.Context, ids []int) (int64, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for id := range distinct(ids) {
+		if deal, ok := r.deals[id]; ok && inScope(organizationID, deal.OrganizationID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *Deals) UpdateStatus(ctx context.Context, deal *models.Deal) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.deals[deal.ID]
+	if !ok || !inScope(organizationID, stored.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	stored.PipelineID, stored.StageID, stored.Status = deal.PipelineID, deal.StageID, deal.Status
+	stored.CloseReason, stored.StageChangedAt = deal.CloseReason, deal.StageChangedAt
+	stored.ClosedAt = nil
+	if deal.ClosedAt != nil {
+		closedAt := *deal.ClosedAt
+		stored.ClosedAt = &closedAt
+	}
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *Deals) CountByStage(ctx context.Context, stageID int) (int64, error) {
+	return r.count(ctx, func(deal *models.Deal) bool { return deal.StageID == stageID })
+}
+
+func (r *Deals) CountByPipeline(ctx context.Context, pipelineID int) (int64, error) {
+	return r.count(ctx, func(deal *models.Deal) bool { return deal.PipelineID == pipelineID })
+}
+
+func (r *Deals) RecordStageChange(ctx context.Context, change *models.DealStageChange) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if organizationID != 0 {
+		change.OrganizationID = organizationID
+	}
+	change.ID = r.changeIDs.next()
+	if change.CreatedAt.IsZero() {
+		change.CreatedAt = time.Now()
+	}
+	stored := *change
+	r.changes[change.ID] = &stored
+	return nil
+}
+
+func (r *Deals) ListStageChanges(ctx context.Context, dealID int) ([]models.DealStageChange, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var changes []models.DealStageChange
+	for _, change := range r.changes {
+		if change.DealID == dealID && inScope(organizationID, change.OrganizationID) {
+			changes = append(changes, *change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if !changes[i].CreatedAt.Equal(changes[j].CreatedAt) {
+			return changes[i].CreatedAt.Before(changes[j].CreatedAt)
+		}
+		return changes[i].ID < changes[j].ID
+	})
+	return changes, nil
+}
+
+func (r *Deals) ListRecentStageChanges(ctx context.Context, filter repository.StageChangeFilter, limit int) ([]models.DealStageChange, int64, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var changes []models.DealStageChange
+	for _, change := range r.changes {
+		deal, ok := r.deals[change.DealID]
+		if !ok || !inScope(organizationID, change.OrganizationID) || !stageChangeMatches(change, deal, filter) {
+			continue
+		}
+		matched := *change
+		matched.Deal = copyDeal(deal)
+		changes = append(changes, matched)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if !changes[i].CreatedAt.Equal(changes[j].CreatedAt) {
+			return changes[i].CreatedAt.After(changes[j].CreatedAt)
+		}
+		return changes[i].ID > changes[j].ID
+	})
+	return page(changes, 0, limit), int64(len(changes)), nil
+}
+
+// count returns the number of deals in scope passing the test
+func (r *Deals) count(ctx context.Context, test func(*models.Deal) bool) (int64, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for _, deal := range r.deals {
+		if inScope(organizationID, deal.OrganizationID) && test(deal) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// openDealsOf returns the number of open deals of a company
+func (r *Deals) openDealsOf(companyID int) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for _, deal := range r.deals {
+		if deal.Open() && deal.CompanyID != nil && *deal.CompanyID == companyID {
+			count++
+		}
+	}
+	return count
+}
+
+// retag calls change with the taggings of the deals in scope among ids
+func (r *Deals) retag(organizationID int, ids []int, change func(organizationID, id int, taggings *[]models.Tagging)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := range distinct(ids) {
+		if deal, ok := r.deals[id]; ok && inScope(organizationID, deal.OrganizationID) {
+			change(deal.OrganizationID, id, &deal.Tags)
+		}
+	}
+}
+
+// tagNames returns the names of the tags on the deals in scope, once
+// per deal carrying them
+func (r *Deals) tagNames(organizationID int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for _, deal := range r.deals {
+		if inScope(organizationID, deal.OrganizationID) {
+			for _, tagging := range deal.Tags {
+				names = append(names, tagging.Name)
+			}
+		}
+	}
+	return names
+}
+
+// dealMatches reports whether a deal passes the filter, given the members of
+// its segment
+func dealMatches(deal *models.Deal, filter repository.DealFilter, members []int) bool {
+	if search := strings.ToLower(strings.TrimSpace(filter.Search)); search != "" && !strings.Contains(strings.ToLower(deal.Title), search) {
+		return false
+	}
+	switch {
+	case filter.PipelineID != 0 && deal.PipelineID != filter.PipelineID,
+		filter.StageID != 0 && deal.StageID != filter.StageID,
+		filter.Status != "" && deal.Status != filter.Status,
+		filter.OwnerID != 0 && (deal.OwnerID == nil || *deal.OwnerID != filter.OwnerID),
+		filter.CompanyID != 0 && (deal.CompanyID == nil || *deal.CompanyID != filter.CompanyID):
+		return false
+	}
+	if filter.ContactID != 0 && !containsID(deal.ContactIDs(), filter.ContactID) {
+		return false
+	}
+	if members != nil && !containsID(members, deal.ID) {
+		return false
+	}
+	if filter.Tag != "" && !tagged(deal.Tags, filter.Tag) {
+		return false
+	}
+	return customFieldsMatch(deal.CustomFields, filter.CustomFields)
+}
+
+// stageChangeMatches reports whether a change of the deal passes the filter
+func stageChangeMatches(change *models.DealStageChange, deal *models.Deal, filter repository.StageChangeFilter) bool {
+	switch {
+	case filter.DealID != 0 && change.DealID != filter.DealID,
+		filter.CompanyID != 0 && (deal.CompanyID == nil || *deal.CompanyID != filter.CompanyID),
+		filter.ContactID != 0 && !containsID(deal.ContactIDs(), filter.ContactID):
+		return false
+	}
+	return true
+}
+
+// containsID reports whether the IDs include id
+func containsID(ids []int, id int) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func copyDeal(deal *models.Deal) *models.Deal {
+	copied := *deal
+	copied.Contacts = make([]models.DealContact, len(deal.Contacts))
+	for i, link := range deal.Contacts {
+		link.Contact = nil
+		copied.Contacts[i] = link
+	}
+	copied.Tags = append([]models.Tagging(nil), deal.Tags...)
+	copied.CustomFields = copyCustomValues(deal.CustomFields)
+	if deal.OwnerID != nil {
+		ownerID := *deal.OwnerID
+		copied.OwnerID = &ownerID
+	}
+	if deal.CompanyID != nil {
+		companyID := *deal.CompanyID
+		copied.CompanyID = &companyID
+	}
+	if deal.ExpectedCloseDate != nil {
+		date := *deal.ExpectedCloseDate
+		copied.ExpectedCloseDate = &date
+	}
+	if deal.ClosedAt != nil {
+		closedAt := *deal.ClosedAt
+		copied.ClosedAt = &closedAt
+	}
+	copied.Stage, copied.Owner, copied.Company = nil, nil, nil
+	return &copied
+}
@@ -0,0 +1,150 @@
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.InvitationRepository = (*Invitations)(nil)
+
+// Invitations is an in-memory invitation repository scoped to the organization
+// of the context
+type Invitations struct {
+	mu          sync.Mutex
+	ids         sequence
+	users       *Users
+	invitations map[int]*models.Invitation
+}
+
+// NewInvitations returns an invitation repository holding the given
+// invitations. Inviters are loaded from users.
+func NewInvitations(users *Users, invitations ...models.Invitation) *Invitations {
+	r := &Invitations{users: users, invitations: make(map[int]*models.Invitation)}
+	for i := range invitations {
+		invitation := invitations[i]
+		invitation.InvitedBy = nil
+		r.ids.see(invitation.ID)
+		r.invitations[invitation.ID] = &invitation
+	}
+	return r
+}
+
+func (r *Invitations) Create(ctx context.Context, invitation *models.Invitation) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if organizationID != 0 {
+		invitation.OrganizationID = organizationID
+	}
+	invitation.ID = r.ids.next()
+	invitation.CreatedAt = time.Now()
+	invitation.UpdatedAt = invitation.CreatedAt
+	stored := *invitation
+	stored.InvitedBy = nil
+	r.invitations[invitation.ID] = &stored
+	return nil
+}
+
+func (r *Invitations) FindByID(ctx context.Context, id int) (*models.Invitation, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	invitation, ok := r.invitations[id]
+	var found models.Invitation
+	if ok {
+		found = *invitation
+	}
+	r.mu.Unlock()
+	if !ok || !inScope(organizationID, found.OrganizationID) {
+		return nil, repository.ErrNotFound
+	}
+	return r.load(ctx, found), nil
+}
+
+func (r *Invitations) ListPending(ctx context.Context) ([]models.Invitation, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	var pending []models.Invitation
+	for _, invitation := range r.invitations {
+		if inScope(organizationID, invitation.OrganizationID) && invitation.Status() == models.InvitationPending {
+			pending = append(pending, *invitation)
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID > pending[j].ID })
+	for i := range pending {
+		pending[i] = *r.load(ctx, pending[i])
+	}
+	return pending, nil
+}
+
+func (r *Invitations) Resolve(ctx context.Context, id int, status string) (bool, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case models.InvitationAccepted, models.InvitationDeclined, models.InvitationRevoked:
+	default:
+		return false, fmt.Errorf("cannot resolve invitation as %q", status)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	invitation, ok := r.invitations[id]
+	if !ok || !inScope(organizationID, invitation.OrganizationID) || invitation.Status() != models.InvitationPending {
+		return false, nil
+	}
+
+	now := time.Now()
+	switch status {
+	case models.InvitationAccepted:
+		invitation.AcceptedAt = &now
+	case models.InvitationDeclined:
+		invitation.DeclinedAt = &now
+	case models.InvitationRevoked:
+		invitation.RevokedAt = &now
+	}
+	invitation.UpdatedAt = now
+	return true, nil
+}
+
+func (r *Invitations) RevokePendingForEmail(ctx context.Context, email string) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, invitation := range r.invitations {
+		if invitation.Email == email && inScope(organizationID, invitation.OrganizationID) && invitation.Status() == models.InvitationPending {
+			invitation.RevokedAt = &now
+			invitation.UpdatedAt = now
+		}
+	}
+	return nil
+}
+
+// load returns the invitation with its inviter
+func (r *Invitations) load(ctx context.Context, invitation models.Invitation) *models.Invitation {
+	if inviter, err := r.users.FindByID(ctx, invitation.InvitedByID); err == nil {
+		invitation.InvitedBy = inviter
+	}
+	return &invitation
+}
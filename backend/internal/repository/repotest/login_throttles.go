@@ -0,0 +1,73 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.LoginThrottleRepository = (*LoginThrottles)(nil)
+
+// LoginThrottles is an in-memory login throttle repository keyed by email
+type LoginThrottles struct {
+	mu        sync.Mutex
+	throttles map[string]*models.LoginThrottle
+}
+
+// NewLoginThrottles returns a login throttle repository holding the given records
+func NewLoginThrottles(throttles ...models.LoginThrottle) *LoginThrottles {
+	r := &LoginThrottles{throttles: make(map[string]*models.LoginThrottle)}
+	for i := range throttles {
+		throttle := throttles[i]
+		r.throttles[throttle.Email] = &throttle
+	}
+	return r
+}
+
+func (r *LoginThrottles) Find(ctx context.Context, email string) (*models.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	throttle, ok := r.throttles[email]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	found := *throttle
+	return &found, nil
+}
+
+func (r *LoginThrottles) RecordFailure(ctx context.Context, email string, at, forgetBefore time.Time) (*models.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	throttle, ok := r.throttles[email]
+	switch {
+	case !ok:
+		throttle = &models.LoginThrottle{Email: email, FailedAttempts: 1}
+		r.throttles[email] = throttle
+	case throttle.LastFailedAt.Before(forgetBefore):
+		throttle.FailedAttempts = 1
+	default:
+		throttle.FailedAttempts++
+	}
+	throttle.LastFailedAt = at
+	found := *throttle
+	return &found, nil
+}
+
+func (r *LoginThrottles) Lock(ctx context.Context, email string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if throttle, ok := r.throttles[email]; ok {
+		throttle.LockedUntil = &until
+	}
+	return nil
+}
+
+func (r *LoginThrottles) Reset(ctx context.Context, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.throttles, email)
+	return nil
+}
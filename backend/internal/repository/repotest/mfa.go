@@ -0,0 +1,129 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.MFARepository = (*MFA)(nil)
+
+// MFA is an in-memory MFA repository keeping one device per user. Like the
+// database repository it accepts a time step only if it is newer than the
+// last one used and each recovery code only once.
+type MFA struct {
+	mu            sync.Mutex
+	ids           sequence
+	devices       map[int]*models.TOTPDevice // keyed by user ID
+	recoveryCodes map[int]*models.RecoveryCode
+}
+
+// NewMFA returns an MFA repository holding the given devices
+func NewMFA(devices ...models.TOTPDevice) *MFA {
+	r := &MFA{
+		devices:       make(map[int]*models.TOTPDevice),
+		recoveryCodes: make(map[int]*models.RecoveryCode),
+	}
+	for i := range devices {
+		device := devices[i]
+		r.devices[device.UserID] = &device
+	}
+	return r
+}
+
+func (r *MFA) FindDevice(ctx context.Context, userID int) (*models.TOTPDevice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	device, ok := r.devices[userID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	found := *device
+	return &found, nil
+}
+
+func (r *MFA) SaveDevice(ctx context.Context, device *models.TOTPDevice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if existing, ok := r.devices[device.UserID]; ok {
+		device.CreatedAt = existing.CreatedAt
+	} else {
+		device.CreatedAt = now
+	}
+	device.UpdatedAt = now
+	stored := *device
+	r.devices[device.UserID] = &stored
+	return nil
+}
+
+func (r *MFA) DeleteDevice(ctx context.Context, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.devices, userID)
+	for id, code := range r.recoveryCodes {
+		if code.UserID == userID {
+			delete(r.recoveryCodes, id)
+		}
+	}
+	return nil
+}
+
+func (r *MFA) UseStep(ctx context.Context, userID int, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	device, ok := r.devices[userID]
+	if !ok || device.LastUsedStep >= step {
+		return false, nil
+	}
+	device.LastUsedStep = step
+	return true, nil
+}
+
+func (r *MFA) ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, code := range r.recoveryCodes {
+		if code.UserID == userID {
+			delete(r.recoveryCodes, id)
+		}
+	}
+	for _, hash := range hashes {
+		for _, code := range r.recoveryCodes {
+			if code.CodeHash == hash {
+				return repository.ErrDuplicate
+			}
+		}
+		id := r.ids.next()
+		r.recoveryCodes[id] = &models.RecoveryCode{ID: id, UserID: userID, CodeHash: hash}
+	}
+	return nil
+}
+
+func (r *MFA) UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, code := range r.recoveryCodes {
+		if code.UserID == userID && code.CodeHash == hash && code.UsedAt == nil {
+			now := time.Now()
+			code.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MFA) CountUnusedRecoveryCodes(ctx context.Context, userID int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for _, code := range r.recoveryCodes {
+		if code.UserID == userID && code.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,246 @@
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.OrganizationRepository = (*Organizations)(nil)
+
+// Organizations is an in-memory organization repository. Memberships are
+// scoped to the organization of the context like the database repository's.
+type Organizations struct {
+	mu            sync.Mutex
+	ids           sequence
+	memberIDs     sequence
+	users         *Users
+	organizations map[int]*models.Organization
+	members       map[int]*models.Membership // keyed by membership ID
+}
+
+// NewOrganizations returns an organization repository holding the given
+// memberships, creating the organizations they belong to. Members are loaded
+// with their user from users.
+func NewOrganizations(users *Users, memberships ...models.Membership) *Organizations {
+	r := &Organizations{
+		users:         users,
+		organizations: make(map[int]*models.Organization),
+		members:       make(map[int]*models.Membership),
+	}
+	for i := range memberships {
+		membership := memberships[i]
+		if _, ok := r.organizations[membership.OrganizationID]; !ok {
+			r.ids.see(membership.OrganizationID)
+			r.organizations[membership.OrganizationID] = &models.Organization{
+				ID:   membership.OrganizationID,
+				Name: fmt.Sprintf("Organization %d", membership.OrganizationID),
+				Slug: fmt.Sprintf("organization-%d", membership.OrganizationID),
+			}
+		}
+		if membership.ID == 0 {
+			membership.ID = r.memberIDs.next()
+		}
+		r.memberIDs.see(membership.ID)
+		membership.User, membership.Organization = nil, nil
+		r.members[membership.ID] = &membership
+	}
+	return r
+}
+
+func (r *Organizations) Create(ctx context.Context, organization *models.Organization) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.organizations {
+		if existing.Slug == organization.Slug {
+			return repository.ErrDuplicate
+		}
+	}
+	organization.ID = r.ids.next()
+	organization.CreatedAt = time.Now()
+	organization.UpdatedAt = organization.CreatedAt
+	stored := *organization
+	r.organizations[organization.ID] = &stored
+	return nil
+}
+
+func (r *Organizations) FindByID(ctx context.Context, id int) (*models.Organization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	organization, ok := r.organizations[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	found := *organization
+	return &found, nil
+}
+
+func (r *Organizations) FindBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, organization := range r.organizations {
+		if organization.Slug == slug {
+			found := *organization
+			return &found, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *Organizations) Update(ctx context.Context, organization *models.Organization) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.organizations[organization.ID]; !ok {
+		return repository.ErrNotFound
+	}
+	organization.UpdatedAt = time.Now()
+	stored := *organization
+	r.organizations[organization.ID] = &stored
+	return nil
+}
+
+func (r *Organizations) AddMember(ctx context.Context, membership *models.Membership) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if organizationID != 0 {
+		membership.OrganizationID = organizationID
+	}
+	if r.findMember(membership.OrganizationID, membership.UserID) != nil {
+		return repository.ErrDuplicate
+	}
+	membership.ID = r.memberIDs.next()
+	membership.CreatedAt = time.Now()
+	membership.UpdatedAt = membership.CreatedAt
+	stored := *membership
+	stored.User, stored.Organization = nil, nil
+	r.members[membership.ID] = &stored
+	return nil
+}
+
+func (r *Organizations) FindMember(ctx context.Context, userID int) (*models.Membership, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	membership := r.findMember(organizationID, userID)
+	var found models.Membership
+	if membership != nil {
+		found = *membership
+	}
+	r.mu.Unlock()
+	if membership == nil {
+		return nil, repository.ErrNotFound
+	}
+	return r.load(ctx, found, false), nil
+}
+
+func (r *Organizations) ListMembers(ctx context.Context) ([]models.Membership, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	listed := r.list(func(m *models.Membership) bool { return inScope(organizationID, m.OrganizationID) })
+	r.mu.Unlock()
+
+	var memberships []models.Membership
+	for _, membership := range listed {
+		memberships = append(memberships, *r.load(ctx, membership, false))
+	}
+	return memberships, nil
+}
+
+func (r *Organizations) UpdateMember(ctx context.Context, membership *models.Membership) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.members[membership.ID]
+	if !ok || !inScope(organizationID, stored.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	membership.UpdatedAt = time.Now()
+	updated := *membership
+	updated.User, updated.Organization = nil, nil
+	r.members[membership.ID] = &updated
+	return nil
+}
+
+func (r *Organizations) RemoveMember(ctx context.Context, userID int) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	removed := false
+	for id, membership := range r.members {
+		if membership.UserID == userID && inScope(organizationID, membership.OrganizationID) {
+			delete(r.members, id)
+			removed = true
+		}
+	}
+	if !removed {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *Organizations) ListMembershipsForUser(ctx context.Context, userID int) ([]models.Membership, error) {
+	r.mu.Lock()
+	listed := r.list(func(m *models.Membership) bool { return m.UserID == userID })
+	r.mu.Unlock()
+
+	var memberships []models.Membership
+	for _, membership := range listed {
+		memberships = append(memberships, *r.load(ctx, membership, true))
+	}
+	return memberships, nil
+}
+
+// findMember returns the user's membership visible in scope
+func (r *Organizations) findMember(organizationID, userID int) *models.Membership {
+	for _, membership := range r.list(nil) {
+		if membership.UserID == userID && inScope(organizationID, membership.OrganizationID) {
+			return r.members[membership.ID]
+		}
+	}
+	return nil
+}
+
+// list returns copies of the matching memberships, oldest first
+func (r *Organizations) list(match func(*models.Membership) bool) []models.Membership {
+	var memberships []models.Membership
+	for _, membership := range r.members {
+		if match == nil || match(membership) {
+			memberships = append(memberships, *membership)
+		}
+	}
+	sort.Slice(memberships, func(i, j int) bool { return memberships[i].ID < memberships[j].ID })
+	return memberships
+}
+
+// load returns the membership with its user and, when asked, its organization
+func (r *Organizations) load(ctx context.Context, membership models.Membership, withOrganization bool) *models.Membership {
+	if user, err := r.users.FindByID(ctx, membership.UserID); err == nil {
+		membership.User = user
+	}
+	if withOrganization {
+		if organization, err := r.FindByID(ctx, membership.OrganizationID); err == nil {
+			membership.Organization = organization
+		}
+	}
+	return &membership
+}
@@ -0,0 +1,212 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.PipelineRepository = (*Pipelines)(nil)
+
+// Pipelines is an in-memory pipeline repository scoped to the organization of
+// the context. Pipelines are loaded with their stages in order.
+type Pipelines struct {
+	mu        sync.Mutex
+	ids       sequence
+	stageIDs  sequence
+	pipelines map[int]*models.Pipeline // without their stages
+	stages    map[int]*models.Stage
+}
+
+// NewPipelines returns a pipeline repository holding the given pipelines and
+// their stages, which belong to the organization of their pipeline
+func NewPipelines(pipelines ...models.Pipeline) *Pipelines {
+	r := &Pipelines{pipelines: make(map[int]*models.Pipeline), stages: make(map[int]*models.Stage)}
+	for i := range pipelines {
+		pipeline := pipelines[i]
+		r.ids.see(pipeline.ID)
+		for _, stage := range pipeline.Stages {
+			stage.PipelineID, stage.OrganizationID = pipeline.ID, pipeline.OrganizationID
+			r.stageIDs.see(stage.ID)
+			r.stages[stage.ID] = &stage
+		}
+		pipeline.Stages = nil
+		r.pipelines[pipeline.ID] = &pipeline
+	}
+	return r
+}
+
+func (r *Pipelines) Create(ctx context.Context, pipeline *models.Pipeline) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if organizationID != 0 {
+		pipeline.OrganizationID = organizationID
+	}
+	pipeline.ID = r.ids.next()
+	pipeline.CreatedAt = time.Now()
+	pipeline.UpdatedAt = pipeline.CreatedAt
+	for i := range pipeline.Stages {
+		stage := &pipeline.Stages[i]
+		stage.ID, stage.PipelineID, stage.OrganizationID = r.stageIDs.next(), pipeline.ID, pipeline.OrganizationID
+		stage.CreatedAt, stage.UpdatedAt = pipeline.CreatedAt, pipeline.CreatedAt
+		stored := *stage
+		r.stages[stage.ID] = &stored
+	}
+	stored := *pipeline
+	stored.Stages = nil
+	r.pipelines[pipeline.ID] = &stored
+	return nil
+}
+
+func (r *Pipelines) FindByID(ctx context.Context, id int) (*models.Pipeline, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pipeline, ok := r.pipelines[id]
+	if !ok || !inScope(organizationID, pipeline.OrganizationID) {
+		return nil, repository.ErrNotFound
+	}
+	return r.withStages(pipeline), nil
+}
+
+func (r *Pipelines) List(ctx context.Context) ([]models.Pipeline, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var pipelines []models.Pipeline
+	for _, pipeline := range r.pipelines {
+		if inScope(organizationID, pipeline.OrganizationID) {
+			pipelines = append(pipelines, *r.withStages(pipeline))
+		}
+	}
+	sort.Slice(pipelines, func(i, j int) bool { return pipelines[i].ID < pipelines[j].ID })
+	return pipelines, nil
+}
+
+func (r *Pipelines) Update(ctx context.Context, pipeline *models.Pipeline) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.pipelines[pipeline.ID]
+	if !ok || !inScope(organizationID, stored.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	updated := *pipeline
+	updated.OrganizationID, updated.CreatedAt, updated.UpdatedAt = stored.OrganizationID, stored.CreatedAt, time.Now()
+	updated.Stages = nil
+	r.pipelines[pipeline.ID] = &updated
+	return nil
+}
+
+func (r *Pipelines) Delete(ctx context.Context, id int) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pipeline, ok := r.pipelines[id]
+	if !ok || !inScope(organizationID, pipeline.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	delete(r.pipelines, id)
+	for stageID, stage := range r.stages {
+		if stage.PipelineID == id {
+			delete(r.stages, stageID)
+		}
+	}
+	return nil
+}
+
+func (r *Pipelines) FindStage(ctx context.Context, id int) (*models.Stage, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stage, ok := r.stages[id]
+	if !ok || !inScope(organizationID, stage.OrganizationID) {
+		return nil, repository.ErrNotFound
+	}
+	found := *stage
+	return &found, nil
+}
+
+func (r *Pipelines) SaveStage(ctx context.Context, stage *models.Stage) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if stage.ID == 0 {
+		if organizationID != 0 {
+			stage.OrganizationID = organizationID
+		}
+		stage.ID = r.stageIDs.next()
+		stage.CreatedAt = now
+	} else {
+		stored, ok := r.stages[stage.ID]
+		if !ok || !inScope(organizationID, stored.OrganizationID) {
+			return repository.ErrNotFound
+		}
+		stage.OrganizationID, stage.CreatedAt = stored.OrganizationID, stored.CreatedAt
+	}
+	stage.UpdatedAt = now
+	stored := *stage
+	r.stages[stage.ID] = &stored
+	return nil
+}
+
+func (r *Pipelines) DeleteStage(ctx context.Context, id int) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stage, ok := r.stages[id]
+	if !ok || !inScope(organizationID, stage.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	delete(r.stages, id)
+	return nil
+}
+
+// withStages returns a copy of the pipeline with its stages ordered by
+// position. The caller holds the lock.
+func (r *Pipelines) withStages(pipeline *models.Pipeline) *models.Pipeline {
+	copied := *pipeline
+	copied.Stages = nil
+	for _, stage := range r.stages {
+		if stage.PipelineID == pipeline.ID {
+			copied.Stages = append(copied.Stages, *stage)
+		}
+	}
+	sort.Slice(copied.Stages, func(i, j int) bool {
+		if copied.Stages[i].Position != copied.Stages[j].Position {
+			return copied.Stages[i].Position < copied.Stages[j].Position
+		}
+		return copied.Stages[i].ID < copied.Stages[j].ID
+	})
+	return &copied
+}
@@ -0,0 +1,85 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.RefreshTokenRepository = (*RefreshTokens)(nil)
+
+// RefreshTokens is an in-memory refresh token repository
+type RefreshTokens struct {
+	mu     sync.Mutex
+	tokens map[string]*models.RefreshToken
+}
+
+// NewRefreshTokens returns a refresh token repository holding the given tokens
+func NewRefreshTokens(tokens ...models.RefreshToken) *RefreshTokens {
+	r := &RefreshTokens{tokens: make(map[string]*models.RefreshToken)}
+	for i := range tokens {
+		token := tokens[i]
+		r.tokens[token.ID] = &token
+	}
+	return r
+}
+
+func (r *RefreshTokens) Create(ctx context.Context, token *models.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tokens[token.ID]; ok {
+		return repository.ErrDuplicate
+	}
+	token.CreatedAt = time.Now()
+	stored := *token
+	r.tokens[token.ID] = &stored
+	return nil
+}
+
+func (r *RefreshTokens) FindByID(ctx context.Context, id string) (*models.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	found := *token
+	return &found, nil
+}
+
+func (r *RefreshTokens) MarkRotated(ctx context.Context, id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[id]
+	if !ok || token.RotatedAt != nil || token.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.RotatedAt = &now
+	return true, nil
+}
+
+func (r *RefreshTokens) RevokeFamily(ctx context.Context, familyID string) error {
+	r.revoke(func(token *models.RefreshToken) bool { return token.FamilyID == familyID })
+	return nil
+}
+
+func (r *RefreshTokens) RevokeAllForUser(ctx context.Context, userID int) error {
+	r.revoke(func(token *models.RefreshToken) bool { return token.UserID == userID })
+	return nil
+}
+
+// revoke marks the active tokens that match as revoked
+func (r *RefreshTokens) revoke(match func(*models.RefreshToken) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, token := range r.tokens {
+		if token.RevokedAt == nil && match(token) {
+			token.RevokedAt = &now
+		}
+	}
+}
@@ -0,0 +1,24 @@
+// Package repotest provides in-memory implementations of the repository
+// interfaces for the tests of the services and API layers. Every fake
+// implements its interface in full, hands out IDs that are never reused and
+// returns copies, so a caller cannot change stored records by accident.
+package repotest
+
+// sequence hands out increasing IDs. IDs are not reused after a delete, as
+// with a database sequence.
+type sequence struct {
+	last int
+}
+
+// next returns an ID greater than any handed out or seen before
+func (s *sequence) next() int {
+	s.last++
+	return s.last
+}
+
+// see records an ID given to a seeded record
+func (s *sequence) see(id int) {
+	if id > s.last {
+		s.last = id
+	}
+}
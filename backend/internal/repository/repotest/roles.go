@@ -0,0 +1,236 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.RoleRepository = (*Roles)(nil)
+
+// Roles is an in-memory role repository over the permission catalog. Roles
+// without an organization are system roles visible everywhere; custom roles
+// are visible in their organization only. Members are granted the
+// permissions of the role named by their membership.
+type Roles struct {
+	mu            sync.Mutex
+	ids           sequence
+	organizations *Organizations
+	roles         map[int]*models.Role
+}
+
+// NewRoles returns a role repository holding the given roles, resolving the
+// roles of the members of organizations
+func NewRoles(organizations *Organizations, roles ...models.Role) *Roles {
+	r := &Roles{organizations: organizations, roles: make(map[int]*models.Role)}
+	for i := range roles {
+		role := copyRole(&roles[i])
+		if role.ID == 0 {
+			role.ID = r.ids.next()
+		}
+		r.ids.see(role.ID)
+		r.roles[role.ID] = &role
+	}
+	return r
+}
+
+// Role returns a system role granting the named permissions
+func Role(name string, permissions ...string) models.Role {
+	role := models.Role{Name: name, IsSystem: true}
+	for _, permission := range permissions {
+		role.Permissions = append(role.Permissions, models.Permission{Name: permission})
+	}
+	return role
+}
+
+// CustomRole returns a role of the organization granting the named permissions
+func CustomRole(organizationID int, name string, permissions ...string) models.Role {
+	role := Role(name, permissions...)
+	role.IsSystem = false
+	role.OrganizationID = &organizationID
+	return role
+}
+
+func (r *Roles) List(ctx context.Context) ([]models.Role, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	roles := make([]models.Role, 0, len(r.roles))
+	for _, role := range r.roles {
+		if visible(role, organizationID) {
+			roles = append(roles, copyRole(role))
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (r *Roles) FindByID(ctx context.Context, id int) (*models.Role, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	role, ok := r.roles[id]
+	if !ok || !visible(role, organizationID) {
+		return nil, repository.ErrNotFound
+	}
+	found := copyRole(role)
+	return &found, nil
+}
+
+func (r *Roles) FindByName(ctx context.Context, name string) (*models.Role, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	role := r.findByName(organizationID, name)
+	if role == nil {
+		return nil, repository.ErrNotFound
+	}
+	found := copyRole(role)
+	return &found, nil
+}
+
+func (r *Roles) Create(ctx context.Context, role *models.Role) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	if organizationID == 0 {
+		return repository.ErrMissingTenant
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.roles {
+		if existing.Name == role.Name && existing.OrganizationID != nil && *existing.OrganizationID == organizationID {
+			return repository.ErrDuplicate
+		}
+	}
+	role.ID = r.ids.next()
+	role.OrganizationID = &organizationID
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = role.CreatedAt
+	stored := copyRole(role)
+	r.roles[role.ID] = &stored
+	return nil
+}
+
+func (r *Roles) Update(ctx context.Context, role *models.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.roles[role.ID]; !ok {
+		return repository.ErrNotFound
+	}
+	role.UpdatedAt = time.Now()
+	stored := copyRole(role)
+	r.roles[role.ID] = &stored
+	return nil
+}
+
+func (r *Roles) Delete(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.roles[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.roles, id)
+	return nil
+}
+
+func (r *Roles) CountMembers(ctx context.Context, roleName string) (int64, error) {
+	members, err := r.organizations.ListMembers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, member := range members {
+		if member.Role == roleName && member.Active() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *Roles) ListPermissions(ctx context.Context) ([]models.Permission, error) {
+	permissions := append([]models.Permission(nil), models.PermissionCatalog...)
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i].Name < permissions[j].Name })
+	return permissions, nil
+}
+
+func (r *Roles) FindPermissionsByName(ctx context.Context, names []string) ([]models.Permission, error) {
+	var permissions []models.Permission
+	for _, permission := range models.PermissionCatalog {
+		for _, name := range names {
+			if permission.Name == name {
+				permissions = append(permissions, permission)
+				break
+			}
+		}
+	}
+	return permissions, nil
+}
+
+func (r *Roles) PermissionsForMember(ctx context.Context, organizationID, userID int) ([]string, error) {
+	r.organizations.mu.Lock()
+	membership := r.organizations.findMember(organizationID, userID)
+	var roleName string
+	if membership != nil && membership.Active() {
+		roleName = membership.Role
+	}
+	r.organizations.mu.Unlock()
+	if roleName == "" {
+		// like the join it stands in for, a non-member or deactivated member
+		// has no permissions
+		return nil, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	role := r.findByName(organizationID, roleName)
+	if role == nil {
+		return nil, nil
+	}
+	names := make([]string, len(role.Permissions))
+	for i, permission := range role.Permissions {
+		names[i] = permission.Name
+	}
+	return names, nil
+}
+
+// findByName returns the role with the name visible in the organization,
+// preferring the oldest like the database does
+func (r *Roles) findByName(organizationID int, name string) *models.Role {
+	var found *models.Role
+	for _, role := range r.roles {
+		if role.Name == name && visible(role, organizationID) && (found == nil || role.ID < found.ID) {
+			found = role
+		}
+	}
+	return found
+}
+
+// visible reports whether the role can be seen in the organization
+func visible(role *models.Role, organizationID int) bool {
+	return role.OrganizationID == nil || organizationID == 0 || *role.OrganizationID == organizationID
+}
+
+func copyRole(role *models.Role) models.Role {
+	copied := *role
+	copied.Permissions = append([]models.Permission(nil), role.Permissions...)
+	if role.OrganizationID != nil {
+		organizationID := *role.OrganizationID
+		copied.OrganizationID = &organizationID
+	}
+	return copied
+}
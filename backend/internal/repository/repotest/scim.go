@@ -0,0 +1,386 @@
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/scim"
+)
+
+var _ repository.SCIMRepository = (*SCIM)(nil)
+
+// SCIM is an in-memory SCIM repository. Tokens are kept here; users and
+// groups are read from the memberships and roles of the given repositories,
+// so changes made through those show up. Filters are evaluated in memory on
+// the attributes the database repository supports.
+type SCIM struct {
+	mu            sync.Mutex
+	ids           sequence
+	tokens        map[int]*models.SCIMToken
+	organizations *Organizations
+	roles         *Roles
+}
+
+// NewSCIM returns a SCIM repository holding the given tokens, with the
+// members of organizations as users and roles as groups
+func NewSCIM(organizations *Organizations, roles *Roles, tokens ...models.SCIMToken) *SCIM {
+	r := &SCIM{
+		tokens:        make(map[int]*models.SCIMToken),
+		organizations: organizations,
+		roles:         roles,
+	}
+	for i := range tokens {
+		token := tokens[i]
+		r.ids.see(token.ID)
+		r.tokens[token.ID] = &token
+	}
+	return r
+}
+
+func (r *SCIM) CreateToken(ctx context.Context, token *models.SCIMToken) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.tokens {
+		if existing.TokenHash == token.TokenHash {
+			return repository.ErrDuplicate
+		}
+	}
+	if organizationID != 0 {
+		token.OrganizationID = organizationID
+	}
+	token.ID = r.ids.next()
+	token.CreatedAt = time.Now()
+	stored := *token
+	r.tokens[token.ID] = &stored
+	return nil
+}
+
+func (r *SCIM) FindToken(ctx context.Context, id int) (*models.SCIMToken, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[id]
+	if !ok || !inScope(organizationID, token.OrganizationID) {
+		return nil, repository.ErrNotFound
+	}
+	found := *token
+	return &found, nil
+}
+
+func (r *SCIM) FindTokenByHash(ctx context.Context, hash string) (*models.SCIMToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, token := range r.tokens {
+		if token.TokenHash == hash {
+			found := *token
+			return &found, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *SCIM) ListTokens(ctx context.Context) ([]models.SCIMToken, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tokens []models.SCIMToken
+	for _, token := range r.tokens {
+		if token.RevokedAt == nil && inScope(organizationID, token.OrganizationID) {
+			tokens = append(tokens, *token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens, nil
+}
+
+func (r *SCIM) RevokeToken(ctx context.Context, id int) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if token, ok := r.tokens[id]; ok && token.RevokedAt == nil && inScope(organizationID, token.OrganizationID) {
+		now := time.Now()
+		token.RevokedAt = &now
+	}
+	return nil
+}
+
+func (r *SCIM) TouchTokenLastUsed(ctx context.Context, id int, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if token, ok := r.tokens[id]; ok {
+		token.LastUsedAt = &at
+	}
+	return nil
+}
+
+func (r *SCIM) ListUsers(ctx context.Context, filter scim.Filter, offset, limit int) ([]models.Membership, int64, error) {
+	users, err := r.users(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	var matched []models.Membership
+	for _, membership := range users {
+		ok, err := matches(filter, userAttribute(membership))
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			matched = append(matched, membership)
+		}
+	}
+	return page(matched, offset, limit), int64(len(matched)), nil
+}
+
+func (r *SCIM) FindUser(ctx context.Context, userID int) (*models.Membership, error) {
+	membership, err := r.organizations.FindMember(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if membership.User == nil || membership.User.ServiceAccount {
+		return nil, repository.ErrNotFound
+	}
+	return membership, nil
+}
+
+func (r *SCIM) ListGroups(ctx context.Context, filter scim.Filter, offset, limit int) ([]models.Role, int64, error) {
+	roles, err := r.roles.List(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	var matched []models.Role
+	for _, role := range roles {
+		ok, err := matches(filter, groupAttribute(role))
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			matched = append(matched, role)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+	return page(matched, offset, limit), int64(len(matched)), nil
+}
+
+func (r *SCIM) ListGroupMembers(ctx context.Context, roleNames []string) ([]models.Membership, error) {
+	users, err := r.users(ctx)
+	if err != nil {
+		return nil, err
+	}
+	memberships := []models.Membership{}
+	for _, membership := range users {
+		for _, name := range roleNames {
+			if membership.Role == name {
+				memberships = append(memberships, membership)
+				break
+			}
+		}
+	}
+	return memberships, nil
+}
+
+// users returns the memberships of people in the context organization
+func (r *SCIM) users(ctx context.Context) ([]models.Membership, error) {
+	members, err := r.organizations.ListMembers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var users []models.Membership
+	for _, membership := range members {
+		if membership.User != nil && !membership.User.ServiceAccount {
+			users = append(users, membership)
+		}
+	}
+	return users, nil
+}
+
+// page returns the records from offset, at most limit of them
+func page[T any](records []T, offset, limit int) []T {
+	if offset >= len(records) {
+		return nil
+	}
+	records = records[offset:]
+	if limit < len(records) {
+		records = records[:limit]
+	}
+	return records
+}
+
+// userAttribute returns the value of a filterable user attribute, keyed by
+// lowercased name as in the database repository
+func userAttribute(membership models.Membership) func(name string) (interface{}, bool) {
+	return func(name string) (interface{}, bool) {
+		switch name {
+		case "id":
+			return membership.UserID, true
+		case "username", "emails", "emails.value":
+			return strings.ToLower(membership.User.Email), true
+		case "displayname":
+			return strings.ToLower(membership.User.BuisnessName), true
+		case "externalid":
+			return membership.ExternalID, true
+		case "active":
+			return membership.Active(), true
+		case "meta.created":
+			return membership.CreatedAt, true
+		case "meta.lastmodified":
+			return membership.UpdatedAt, true
+		}
+		return nil, false
+	}
+}
+
+// groupAttribute returns the value of a filterable group attribute
+func groupAttribute(role models.Role) func(name string) (interface{}, bool) {
+	return func(name string) (interface{}, bool) {
+		switch name {
+		case "id":
+			return role.ID, true
+		case "displayname":
+			return strings.ToLower(role.Name), true
+		case "meta.created":
+			return role.CreatedAt, true
+		case "meta.lastmodified":
+			return role.UpdatedAt, true
+		}
+		return nil, false
+	}
+}
+
+// matches evaluates a filter against the attributes of a record. Strings
+// are compared case-insensitively except for externalId, as in the
+// database repository. A nil filter matches every record.
+func matches(filter scim.Filter, attribute func(name string) (interface{}, bool)) (bool, error) {
+	switch f := filter.(type) {
+	case nil:
+		return true, nil
+	case *scim.LogicalExpression:
+		left, err := matches(f.Left, attribute)
+		if err != nil {
+			return false, err
+		}
+		right, err := matches(f.Right, attribute)
+		if err != nil {
+			return false, err
+		}
+		if f.Operator == "or" {
+			return left || right, nil
+		}
+		return left && right, nil
+	case *scim.NotExpression:
+		matched, err := matches(f.Filter, attribute)
+		return !matched, err
+	case *scim.AttributeExpression:
+		name := strings.ToLower(f.Attribute)
+		value, ok := attribute(name)
+		if !ok {
+			return false, fmt.Errorf("%w: filtering on %q is not supported", scim.ErrInvalidFilter, f.Attribute)
+		}
+		return compare(name, value, f)
+	default:
+		return false, fmt.Errorf("%w: unsupported expression", scim.ErrInvalidFilter)
+	}
+}
+
+// compare evaluates an expression on a value
+func compare(name string, value interface{}, expression *scim.AttributeExpression) (bool, error) {
+	invalid := fmt.Errorf("%w: %q %s %v is not a valid comparison",
+		scim.ErrInvalidFilter, expression.Attribute, expression.Operator, expression.Value)
+
+	var order int
+	switch v := value.(type) {
+	case bool:
+		active, ok := expression.Value.(bool)
+		switch {
+		case expression.Operator == scim.OpPresent:
+			return true, nil
+		case !ok || (expression.Operator != scim.OpEqual && expression.Operator != scim.OpNotEqual):
+			return false, invalid
+		}
+		return (v == active) == (expression.Operator == scim.OpEqual), nil
+	case string:
+		if expression.Operator == scim.OpPresent {
+			return v != "", nil
+		}
+		text, ok := expression.Value.(string)
+		if !ok {
+			return false, invalid
+		}
+		if name != "externalid" {
+			text = strings.ToLower(text)
+		}
+		switch expression.Operator {
+		case scim.OpContains:
+			return strings.Contains(v, text), nil
+		case scim.OpStartsWith:
+			return strings.HasPrefix(v, text), nil
+		case scim.OpEndsWith:
+			return strings.HasSuffix(v, text), nil
+		}
+		order = strings.Compare(v, text)
+	case int:
+		if expression.Operator == scim.OpPresent {
+			return true, nil
+		}
+		var id int
+		switch want := expression.Value.(type) {
+		case string:
+			parsed, err := strconv.Atoi(want)
+			if err != nil {
+				// ids are opaque to clients, so an id that is not a number matches nothing
+				return false, nil
+			}
+			id = parsed
+		case float64:
+			id = int(want)
+		default:
+			return false, invalid
+		}
+		order = v - id
+	case time.Time:
+		if expression.Operator == scim.OpPresent {
+			return true, nil
+		}
+		text, _ := expression.Value.(string)
+		at, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return false, invalid
+		}
+		order = v.Compare(at)
+	}
+
+	switch expression.Operator {
+	case scim.OpEqual:
+		return order == 0, nil
+	case scim.OpNotEqual:
+		return order != 0, nil
+	case scim.OpGreaterThan:
+		return order > 0, nil
+	case scim.OpGreaterOrEqual:
+		return order >= 0, nil
+	case scim.OpLessThan:
+		return order < 0, nil
+	case scim.OpLessOrEqual:
+		return order <= 0, nil
+	}
+	return false, invalid
+}
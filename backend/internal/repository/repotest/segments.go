@@ -0,0 +1,324 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/segment"
+)
+
+var _ repository.SegmentRepository = (*Segments)(nil)
+
+// Segments is an in-memory segment repository scoped to the organization of
+// the context, with names unique per organization and record type. Segment
+// rules are evaluated over the records of the contact, company and deal
+// repositories given to NewSegments, which list the members of segments
+// evaluated by the listing query through it, and over the activities of the
+// activity repository, if any.
+type Segments struct {
+	mu         sync.Mutex
+	ids        sequence
+	segments   map[int]*models.Segment
+	contacts   *Contacts
+	companies  *Companies
+	deals      *Deals
+	activities *Activities
+}
+
+// segmentRecord holds the fields of a record segment rules compare
+type segmentRecord struct {
+	id           int
+	ownerID      *int
+	tags         []models.Tagging
+	customFields models.CustomFieldValues
+	createdAt    time.Time
+	updatedAt    time.Time
+}
+
+// NewSegments returns a segment repository holding the given segments, whose
+// members are among the contacts, companies and deals. Companies, deals and
+// activities may be nil.
+func NewSegments(contacts *Contacts, companies *Companies, deals *Deals, activities *Activities, segments ...models.Segment) *Segments {
+	r := &Segments{
+		segments:   make(map[int]*models.Segment),
+		contacts:   contacts,
+		companies:  companies,
+		deals:      deals,
+		activities: activities,
+	}
+	for i := range segments {
+		stored := segments[i]
+		r.ids.see(stored.ID)
+		r.segments[stored.ID] = &stored
+	}
+	contacts.mu.Lock()
+	contacts.segments = r
+	contacts.mu.Unlock()
+	if companies != nil {
+		companies.mu.Lock()
+		companies.segments = r
+		companies.mu.Unlock()
+	}
+	if deals != nil {
+		deals.mu.Lock()
+		deals.segments = r
+		deals.mu.Unlock()
+	}
+	if activities != nil {
+		activities.mu.Lock()
+		activities.segments = r
+		activities.mu.Unlock()
+	}
+	return r
+}
+
+func (r *Segments) Create(ctx context.Context, segment *models.Segment) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if organizationID != 0 {
+		segment.OrganizationID = organizationID
+	}
+	if r.nameTaken(segment) {
+		return repository.ErrDuplicate
+	}
+	segment.ID = r.ids.next()
+	segment.CreatedAt = time.Now()
+	segment.UpdatedAt = segment.CreatedAt
+	stored := *segment
+	r.segments[segment.ID] = &stored
+	return nil
+}
+
+func (r *Segments) FindByID(ctx context.Context, id int) (*models.Segment, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	segment, ok := r.segments[id]
+	if !ok || !inScope(organizationID, segment.OrganizationID) {
+		return nil, repository.ErrNotFound
+	}
+	found := *segment
+	return &found, nil
+}
+
+func (r *Segments) List(ctx context.Context, recordType string) ([]models.Segment, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var segments []models.Segment
+	for _, segment := range r.segments {
+		if inScope(organizationID, segment.OrganizationID) && (recordType == "" || segment.RecordType == recordType) {
+			segments = append(segments, *segment)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].Name != segments[j].Name {
+			return segments[i].Name < segments[j].Name
+		}
+		return segments[i].ID < segments[j].ID
+	})
+	return segments, nil
+}
+
+func (r *Segments) Update(ctx context.Context, segment *models.Segment) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.segments[segment.ID]
+	if !ok || !inScope(organizationID, stored.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	segment.OrganizationID, segment.CreatedAt = stored.OrganizationID, stored.CreatedAt
+	if r.nameTaken(segment) {
+		return repository.ErrDuplicate
+	}
+	segment.UpdatedAt = time.Now()
+	updated := *segment
+	r.segments[segment.ID] = &updated
+	return nil
+}
+
+func (r *Segments) Delete(ctx context.Context, id int) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	segment, ok := r.segments[id]
+	if !ok || !inScope(organizationID, segment.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	delete(r.segments, id)
+	return nil
+}
+
+func (r *Segments) Members(ctx context.Context, match repository.SegmentMatch, limit int) ([]int, error) {
+	ids, err := r.members(ctx, match)
+	if err != nil {
+		return nil, err
+	}
+	return page(ids, 0, limit), nil
+}
+
+func (r *Segments) CountMembers(ctx context.Context, match repository.SegmentMatch) (int64, error) {
+	ids, err := r.members(ctx, match)
+	return int64(len(ids)), err
+}
+
+// members returns the IDs of the records in scope in a segment, in ID order
+func (r *Segments) members(ctx context.Context, match repository.SegmentMatch) ([]int, error) {
+	records, err := r.records(ctx, match.RecordType)
+	if err != nil {
+		return nil, err
+	}
+	ids := []int{}
+	for i := range records {
+		member := containsID(match.IDs, records[i].id)
+		if match.IDs == nil {
+			member = r.ruleMatches(match.Rule, match.RecordType, &records[i], match.Now)
+		}
+		if member {
+			ids = append(ids, records[i].id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// records returns the records in scope of a type segments can hold
+func (r *Segments) records(ctx context.Context, recordType string) ([]segmentRecord, error) {
+	var records []segmentRecord
+	switch {
+	case recordType == models.RecordContact:
+		contacts, _, err := r.contacts.List(ctx, repository.ContactFilter{}, 0, math.MaxInt)
+		if err != nil {
+			return nil, err
+		}
+		for _, contact := range contacts {
+			records = append(records, segmentRecord{contact.ID, contact.OwnerID, contact.Tags, contact.CustomFields, contact.CreatedAt, contact.UpdatedAt})
+		}
+	case recordType == models.RecordCompany && r.companies != nil:
+		companies, _, err := r.companies.List(ctx, repository.CompanyFilter{}, 0, math.MaxInt)
+		if err != nil {
+			return nil, err
+		}
+		for _, company := range companies {
+			records = append(records, segmentRecord{company.ID, company.OwnerID, company.Tags, company.CustomFields, company.CreatedAt, company.UpdatedAt})
+		}
+	case recordType == models.RecordDeal && r.deals != nil:
+		deals, _, err := r.deals.List(ctx, repository.DealFilter{}, 0, math.MaxInt)
+		if err != nil {
+			return nil, err
+		}
+		for _, deal := range deals {
+			records = append(records, segmentRecord{deal.ID, deal.OwnerID, deal.Tags, deal.CustomFields, deal.CreatedAt, deal.UpdatedAt})
+		}
+	}
+	return records, nil
+}
+
+// ruleMatches reports whether a record matches a segment rule at a time, the
+// way the database repository evaluates it
+func (r *Segments) ruleMatches(rule repository.SegmentRule, recordType string, record *segmentRecord, now time.Time) bool {
+	switch rule.Operator {
+	case "and":
+		return r.ruleMatches(rule.Rules[0], recordType, record, now) && r.ruleMatches(rule.Rules[1], recordType, record, now)
+	case "or":
+		return r.ruleMatches(rule.Rules[0], recordType, record, now) || r.ruleMatches(rule.Rules[1], recordType, record, now)
+	case "not":
+		return !r.ruleMatches(rule.Rules[0], recordType, record, now)
+	}
+	if rule.Custom != nil {
+		return customFieldsMatch(record.customFields, []repository.CustomFieldCondition{*rule.Custom})
+	}
+
+	switch rule.Field {
+	case repository.SegmentTag:
+		name, _ := rule.Value.(string)
+		return tagged(record.tags, name)
+	case repository.SegmentOwner:
+		if rule.Value == nil {
+			return record.ownerID == nil
+		}
+		return record.ownerID != nil && *record.ownerID == rule.Value
+	case repository.SegmentCreatedAt, repository.SegmentUpdatedAt, repository.SegmentLastActivity:
+		age, _ := rule.Value.(time.Duration)
+		since := now.Add(-age)
+		at := &record.createdAt
+		switch {
+		case rule.Field == repository.SegmentUpdatedAt:
+			at = &record.updatedAt
+		case rule.Field == repository.SegmentLastActivity:
+			if at = r.lastActivity(recordType, record.id); at == nil {
+				// records without activities have been inactive forever
+				return rule.Operator == segment.OpGreater || rule.Operator == segment.OpGreaterOrEqual
+			}
+		}
+		switch rule.Operator {
+		case segment.OpLess:
+			return at.After(since)
+		case segment.OpLessOrEqual:
+			return !at.Before(since)
+		case segment.OpGreater:
+			return at.Before(since)
+		case segment.OpGreaterOrEqual:
+			return !at.After(since)
+		}
+	}
+	return false
+}
+
+// lastActivity returns the time of the last activity on a record
+func (r *Segments) lastActivity(recordType string, recordID int) *time.Time {
+	if r.activities == nil {
+		return nil
+	}
+	return r.activities.lastOn(recordType, recordID)
+}
+
+// nameTaken reports whether another segment of the organization and record
+// type has the name of the segment. The caller holds the lock.
+func (r *Segments) nameTaken(segment *models.Segment) bool {
+	for _, other := range r.segments {
+		if other.ID != segment.ID && other.OrganizationID == segment.OrganizationID &&
+			other.RecordType == segment.RecordType && other.Name == segment.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentMembers returns the IDs of the members of the segment a listing is
+// restricted to, or nil when it is not. Segments evaluated by the listing
+// query are evaluated by the segment repository created over the records.
+func segmentMembers(ctx context.Context, segments *Segments, match *repository.SegmentMatch) ([]int, error) {
+	switch {
+	case match == nil:
+		return nil, nil
+	case match.IDs != nil:
+		return match.IDs, nil
+	case segments == nil:
+		return nil, errors.New("repotest: segment rules are evaluated by the segment repository created over the records")
+	}
+	return segments.members(ctx, *match)
+}
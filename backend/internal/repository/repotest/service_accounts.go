@@ -0,0 +1,121 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.ServiceAccountRepository = (*ServiceAccounts)(nil)
+
+// ServiceAccounts is an in-memory service account repository scoped to the
+// organization of the context
+type ServiceAccounts struct {
+	mu       sync.Mutex
+	ids      sequence
+	users    *Users
+	accounts map[int]*models.ServiceAccount
+}
+
+// NewServiceAccounts returns a service account repository holding the given
+// accounts. Their users are loaded from users.
+func NewServiceAccounts(users *Users, accounts ...models.ServiceAccount) *ServiceAccounts {
+	r := &ServiceAccounts{users: users, accounts: make(map[int]*models.ServiceAccount)}
+	for i := range accounts {
+		account := accounts[i]
+		account.User = nil
+		r.ids.see(account.ID)
+		r.accounts[account.ID] = &account
+	}
+	return r
+}
+
+func (r *ServiceAccounts) Create(ctx context.Context, account *models.ServiceAccount) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.accounts {
+		if existing.UserID == account.UserID {
+			return repository.ErrDuplicate
+		}
+	}
+	if organizationID != 0 {
+		account.OrganizationID = organizationID
+	}
+	account.ID = r.ids.next()
+	account.CreatedAt = time.Now()
+	account.UpdatedAt = account.CreatedAt
+	stored := *account
+	stored.User = nil
+	r.accounts[account.ID] = &stored
+	return nil
+}
+
+func (r *ServiceAccounts) FindByID(ctx context.Context, id int) (*models.ServiceAccount, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	account, ok := r.accounts[id]
+	var found models.ServiceAccount
+	if ok {
+		found = *account
+	}
+	r.mu.Unlock()
+	if !ok || !inScope(organizationID, found.OrganizationID) {
+		return nil, repository.ErrNotFound
+	}
+	return r.load(ctx, found), nil
+}
+
+func (r *ServiceAccounts) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	var accounts []models.ServiceAccount
+	for _, account := range r.accounts {
+		if inScope(organizationID, account.OrganizationID) {
+			accounts = append(accounts, *account)
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	for i := range accounts {
+		accounts[i] = *r.load(ctx, accounts[i])
+	}
+	return accounts, nil
+}
+
+func (r *ServiceAccounts) Delete(ctx context.Context, id int) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	account, ok := r.accounts[id]
+	if !ok || !inScope(organizationID, account.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	delete(r.accounts, id)
+	return nil
+}
+
+// load returns the account with its user
+func (r *ServiceAccounts) load(ctx context.Context, account models.ServiceAccount) *models.ServiceAccount {
+	if user, err := r.users.FindByID(ctx, account.UserID); err == nil {
+		account.User = user
+	}
+	return &account
+}
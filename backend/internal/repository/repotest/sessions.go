@@ -0,0 +1,111 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.SessionRepository = (*Sessions)(nil)
+
+// Sessions is an in-memory session repository with unique families
+type Sessions struct {
+	mu       sync.Mutex
+	ids      sequence
+	sessions map[int]*models.Session
+}
+
+// NewSessions returns a session repository holding the given sessions
+func NewSessions(sessions ...models.Session) *Sessions {
+	r := &Sessions{sessions: make(map[int]*models.Session)}
+	for i := range sessions {
+		session := sessions[i]
+		r.ids.see(session.ID)
+		r.sessions[session.ID] = &session
+	}
+	return r
+}
+
+func (r *Sessions) Create(ctx context.Context, session *models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.sessions {
+		if existing.FamilyID == session.FamilyID {
+			return repository.ErrDuplicate
+		}
+	}
+	session.ID = r.ids.next()
+	session.CreatedAt = time.Now()
+	stored := *session
+	r.sessions[session.ID] = &stored
+	return nil
+}
+
+func (r *Sessions) FindByID(ctx context.Context, id int) (*models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	found := *session
+	return &found, nil
+}
+
+func (r *Sessions) FindByFamily(ctx context.Context, familyID string) (*models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, session := range r.sessions {
+		if session.FamilyID == familyID {
+			found := *session
+			return &found, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *Sessions) ListActive(ctx context.Context, filter repository.SessionFilter) ([]models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sessions []models.Session
+	for _, session := range r.sessions {
+		if !session.Active() ||
+			filter.UserID != 0 && session.UserID != filter.UserID ||
+			filter.OrganizationID != 0 && session.OrganizationID != filter.OrganizationID {
+			continue
+		}
+		sessions = append(sessions, *session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastActiveAt.Equal(sessions[j].LastActiveAt) {
+			return sessions[i].LastActiveAt.After(sessions[j].LastActiveAt)
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+	return sessions, nil
+}
+
+func (r *Sessions) Update(ctx context.Context, session *models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[session.ID]; !ok {
+		return repository.ErrNotFound
+	}
+	stored := *session
+	r.sessions[session.ID] = &stored
+	return nil
+}
+
+func (r *Sessions) Revoke(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if session, ok := r.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.SSORepository = (*SSO)(nil)
+
+// SSO is an in-memory single sign-on repository. Identities are unique by
+// provider and subject, attempts by state hash.
+type SSO struct {
+	mu          sync.Mutex
+	identityIDs sequence
+	attemptIDs  sequence
+	identities  map[int]*models.UserIdentity
+	attempts    map[int]*models.SSOLoginAttempt
+}
+
+// NewSSO returns a single sign-on repository holding the given identities
+func NewSSO(identities ...models.UserIdentity) *SSO {
+	r := &SSO{
+		identities: make(map[int]*models.UserIdentity),
+		attempts:   make(map[int]*models.SSOLoginAttempt),
+	}
+	for i := range identities {
+		identity := identities[i]
+		r.identityIDs.see(identity.ID)
+		r.identities[identity.ID] = &identity
+	}
+	return r
+}
+
+func (r *SSO) FindIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			found := *identity
+			return &found, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *SSO) SaveIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.identities {
+		if existing.ID != identity.ID && existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return repository.ErrDuplicate
+		}
+	}
+	now := time.Now()
+	if identity.ID == 0 {
+		identity.ID = r.identityIDs.next()
+		identity.CreatedAt = now
+	}
+	identity.UpdatedAt = now
+	stored := *identity
+	r.identities[identity.ID] = &stored
+	return nil
+}
+
+func (r *SSO) CreateAttempt(ctx context.Context, attempt *models.SSOLoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.attempts {
+		if existing.StateHash == attempt.StateHash {
+			return repository.ErrDuplicate
+		}
+	}
+	attempt.ID = r.attemptIDs.next()
+	attempt.CreatedAt = time.Now()
+	stored := *attempt
+	r.attempts[attempt.ID] = &stored
+	return nil
+}
+
+func (r *SSO) FindAttempt(ctx context.Context, stateHash string) (*models.SSOLoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, attempt := range r.attempts {
+		if attempt.StateHash == stateHash {
+			found := *attempt
+			return &found, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *SSO) UseAttempt(ctx context.Context, id int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempt, ok := r.attempts[id]
+	if !ok || attempt.UsedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	attempt.UsedAt = &now
+	return true, nil
+}
+
+func (r *SSO) DeleteExpiredAttempts(ctx context.Context, cutoff time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, attempt := range r.attempts {
+		if attempt.ExpiresAt.Before(cutoff) {
+			delete(r.attempts, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.TagRepository = (*Tags)(nil)
+
+// Tags is an in-memory tag repository scoped to the organization of the
+// context, changing the tags on the records of the contact, company and deal
+// repositories given to NewTags without touching the records otherwise
+type Tags struct {
+	mu        sync.Mutex
+	ids       sequence
+	contacts  *Contacts
+	companies *Companies
+	deals     *Deals
+}
+
+// NewTags returns a tag repository over the tags of contacts, companies and
+// deals. Companies and deals may be nil.
+func NewTags(contacts *Contacts, companies *Companies, deals *Deals) *Tags {
+	return &Tags{contacts: contacts, companies: companies, deals: deals}
+}
+
+func (r *Tags) List(ctx context.Context, recordType string) ([]repository.TagCount, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if recordType == "" || recordType == models.RecordContact {
+		names = append(names, r.contacts.tagNames(organizationID)...)
+	}
+	if r.companies != nil && (recordType == "" || recordType == models.RecordCompany) {
+		names = append(names, r.companies.tagNames(organizationID)...)
+	}
+	if r.deals != nil && (recordType == "" || recordType == models.RecordDeal) {
+		names = append(names, r.deals.tagNames(organizationID)...)
+	}
+
+	counts := make(map[string]int64)
+	for _, name := range names {
+		counts[name]++
+	}
+	var tags []repository.TagCount
+	for name, count := range counts {
+		tags = append(tags, repository.TagCount{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+func (r *Tags) Add(ctx context.Context, recordType string, recordIDs []int, names []string) (int64, error) {
+	var added int64
+	err := r.retag(ctx, recordType, recordIDs, func(organizationID, id int, taggings *[]models.Tagging) {
+		for _, name := range names {
+			if tagged(*taggings, name) {
+				continue
+			}
+			*taggings = append(*taggings, models.Tagging{
+				ID:          r.nextID(),
+				TenantOwned: models.TenantOwned{OrganizationID: organizationID},
+				RecordType:  recordType,
+				RecordID:    id,
+				Name:        name,
+				CreatedAt:   time.Now(),
+			})
+			added++
+		}
+	})
+	return added, err
+}
+
+func (r *Tags) Remove(ctx context.Context, recordType string, recordIDs []int, names []string) (int64, error) {
+	var removed int64
+	err := r.retag(ctx, recordType, recordIDs, func(_, _ int, taggings *[]models.Tagging) {
+		kept := (*taggings)[:0]
+		for _, tagging := range *taggings {
+			if containsName(names, tagging.Name) {
+				removed++
+				continue
+			}
+			kept = append(kept, tagging)
+		}
+		*taggings = kept
+	})
+	return removed, err
+}
+
+// retag calls change with the taggings of the records of a type in scope
+// among ids
+func (r *Tags) retag(ctx context.Context, recordType string, ids []int, change func(organizationID, id int, taggings *[]models.Tagging)) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case recordType == models.RecordContact:
+		r.contacts.retag(organizationID, ids, change)
+	case recordType == models.RecordCompany && r.companies != nil:
+		r.companies.retag(organizationID, ids, change)
+	case recordType == models.RecordDeal && r.deals != nil:
+		r.deals.retag(organizationID, ids, change)
+	}
+	return nil
+}
+
+// nextID returns the ID of a new tagging
+func (r *Tags) nextID() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ids.next()
+}
+
+// containsName reports whether the names include name
+func containsName(names []string, name string) bool {
+	for _, candidate := range names {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
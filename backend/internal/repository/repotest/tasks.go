@@ -0,0 +1,276 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/listquery"
+)
+
+var _ repository.TaskRepository = (*Tasks)(nil)
+
+// Tasks is an in-memory task repository scoped to the organization of the
+// context. Listings apply the filters and sorts of the database repository,
+// with tasks that have no due date last when sorted by it, except the
+// conditions of Filters and segments not listing their member IDs. Tasks are loaded with
+// their assignee and creator from the user repository given to NewTasks.
+type Tasks struct {
+	mu    sync.Mutex
+	ids   sequence
+	tasks map[int]*models.Task
+	users *Users
+}
+
+// NewTasks returns a task repository holding the given tasks, assigned to
+// and created by users
+func NewTasks(users *Users, tasks ...models.Task) *Tasks {
+	r := &Tasks{tasks: make(map[int]*models.Task), users: users}
+	for i := range tasks {
+		task := copyTask(&tasks[i])
+		r.ids.see(task.ID)
+		r.tasks[task.ID] = task
+	}
+	return r
+}
+
+func (r *Tasks) Create(ctx context.Context, task *models.Task) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if organizationID != 0 {
+		task.OrganizationID = organizationID
+	}
+	task.ID = r.ids.next()
+	task.CreatedAt = time.Now()
+	task.UpdatedAt = task.CreatedAt
+	r.tasks[task.ID] = copyTask(task)
+	return nil
+}
+
+func (r *Tasks) FindByID(ctx context.Context, id int) (*models.Task, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tasks := r.matching(func(task *models.Task) bool {
+		return task.ID == id && inScope(organizationID, task.OrganizationID)
+	})
+	if len(tasks) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	r.loadUsers(&tasks[0])
+	return &tasks[0], nil
+}
+
+func (r *Tasks) List(ctx context.Context, filter repository.TaskFilter, offset, limit int) ([]models.Task, int64, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	members, err := segmentMembers(ctx, nil, filter.InSegment)
+	if err != nil {
+		return nil, 0, err
+	}
+	tasks := r.matching(func(task *models.Task) bool {
+		return inScope(organizationID, task.OrganizationID) && taskMatches(task, filter, members)
+	})
+	sortTasks(tasks, filter.Filters)
+	found := page(tasks, offset, limit)
+	for i := range found {
+		r.loadUsers(&found[i])
+	}
+	return found, int64(len(tasks)), nil
+}
+
+func (r *Tasks) Update(ctx context.Context, task *models.Task) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.tasks[task.ID]
+	if !ok || !inScope(organizationID, stored.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	task.OrganizationID, task.CreatedAt = stored.OrganizationID, stored.CreatedAt
+	task.UpdatedAt = time.Now()
+	r.tasks[task.ID] = copyTask(task)
+	return nil
+}
+
+func (r *Tasks) Delete(ctx context.Context, id int) error {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[id]
+	if !ok || !inScope(organizationID, task.OrganizationID) {
+		return repository.ErrNotFound
+	}
+	delete(r.tasks, id)
+	return nil
+}
+
+func (r *Tasks) ListDueReminders(ctx context.Context, now time.Time, lead time.Duration, limit int) ([]models.Task, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tasks := r.matching(func(task *models.Task) bool {
+		due := task.RemindAt != nil && !task.RemindAt.After(now) ||
+			task.RemindAt == nil && task.DueAt != nil && !task.DueAt.After(now.Add(lead))
+		return inScope(organizationID, task.OrganizationID) && task.Pending() && task.AssigneeID != nil &&
+			task.RemindedAt == nil && due
+	})
+	sort.Slice(tasks, func(i, j int) bool {
+		a, b := reminderTime(&tasks[i]), reminderTime(&tasks[j])
+		if !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	tasks = page(tasks, 0, limit)
+	for i := range tasks {
+		r.loadUsers(&tasks[i])
+		tasks[i].CreatedBy = nil
+	}
+	return tasks, nil
+}
+
+func (r *Tasks) MarkReminded(ctx context.Context, id int, at time.Time) (bool, error) {
+	organizationID, err := scope(ctx)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[id]
+	if !ok || !inScope(organizationID, task.OrganizationID) || task.RemindedAt != nil {
+		return false, nil
+	}
+	task.RemindedAt = &at
+	return true, nil
+}
+
+// matching returns copies of the tasks passing the test
+func (r *Tasks) matching(test func(*models.Task) bool) []models.Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tasks []models.Task
+	for _, task := range r.tasks {
+		if test(task) {
+			tasks = append(tasks, *copyTask(task))
+		}
+	}
+	return tasks
+}
+
+// loadUsers sets the assignee and creator of a task
+func (r *Tasks) loadUsers(task *models.Task) {
+	if r.users == nil {
+		return
+	}
+	if task.AssigneeID != nil {
+		task.Assignee, _ = r.users.FindByID(context.Background(), *task.AssigneeID)
+	}
+	if task.CreatedByID != nil {
+		task.CreatedBy, _ = r.users.FindByID(context.Background(), *task.CreatedByID)
+	}
+}
+
+// reminderTime returns the time due reminders are ordered by
+func reminderTime(task *models.Task) *time.Time {
+	if task.RemindAt != nil {
+		return task.RemindAt
+	}
+	return task.DueAt
+}
+
+// taskMatches reports whether a task passes the filter, given the members of
+// its segment
+func taskMatches(task *models.Task, filter repository.TaskFilter, members []int) bool {
+	switch {
+	case filter.AssigneeID != 0 && (task.AssigneeID == nil || *task.AssigneeID != filter.AssigneeID),
+		filter.Status != "" && task.Status != filter.Status,
+		filter.Priority != "" && task.Priority != filter.Priority,
+		filter.RecordType != "" && task.RecordType != filter.RecordType,
+		filter.RecordID != 0 && (task.RecordID == nil || *task.RecordID != filter.RecordID),
+		members != nil && (task.RecordType != filter.InSegment.RecordType || task.RecordID == nil || !containsID(members, *task.RecordID)),
+		filter.Pending && !task.Pending(),
+		filter.DueFrom != nil && (task.DueAt == nil || task.DueAt.Before(*filter.DueFrom)),
+		filter.DueBefore != nil && (task.DueAt == nil || !task.DueAt.Before(*filter.DueBefore)):
+		return false
+	}
+	return true
+}
+
+// sortTasks orders tasks by the sorts of a query, then by ID. Without sorts,
+// the newest come first.
+func sortTasks(tasks []models.Task, query *listquery.Query) {
+	sorts := []listquery.Sort{{Field: "created_at", Descending: true}}
+	if query != nil && len(query.Sorts) > 0 {
+		sorts = query.Sorts
+	}
+	key := func(task *models.Task, field string) *time.Time {
+		switch field {
+		case "due_at":
+			return task.DueAt
+		case "updated_at":
+			return &task.UpdatedAt
+		default:
+			return &task.CreatedAt
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		for _, by := range sorts {
+			a, b := key(&tasks[i], by.Field), key(&tasks[j], by.Field)
+			switch {
+			case a == nil && b == nil:
+			case a == nil || b == nil:
+				return (b == nil) != by.Descending // no time sorts as the greatest
+			case !a.Equal(*b):
+				return a.Before(*b) != by.Descending
+			}
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+}
+
+func copyTask(task *models.Task) *models.Task {
+	copied := *task
+	copied.AssigneeID = copyInt(task.AssigneeID)
+	copied.CreatedByID = copyInt(task.CreatedByID)
+	copied.RecordID = copyInt(task.RecordID)
+	copied.DueAt = copyTime(task.DueAt)
+	copied.RemindAt = copyTime(task.RemindAt)
+	copied.RemindedAt = copyTime(task.RemindedAt)
+	copied.CompletedAt = copyTime(task.CompletedAt)
+	copied.Assignee, copied.CreatedBy = nil, nil
+	return &copied
+}
+
+func copyInt(value *int) *int {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+func copyTime(value *time.Time) *time.Time {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
@@ -0,0 +1,38 @@
+package repotest
+
+import (
+	"context"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+)
+
+// Transactor runs functions directly. The fakes have nothing to roll back, so
+// a failing function leaves the changes it made before failing.
+type Transactor struct{}
+
+var _ repository.Transactor = Transactor{}
+
+// WithinTransaction implements repository.Transactor
+func (Transactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// scope returns the organization tenant-owned records are read and written in,
+// the way the repository's tenant scope does: zero for an unscoped context and
+// ErrMissingTenant when the context has no organization.
+func scope(ctx context.Context) (int, error) {
+	if tenant.IsUnscoped(ctx) {
+		return 0, nil
+	}
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return 0, repository.ErrMissingTenant
+	}
+	return organizationID, nil
+}
+
+// inScope reports whether a record of the organization is visible in scope
+func inScope(scope, organizationID int) bool {
+	return scope == 0 || scope == organizationID
+}
@@ -0,0 +1,81 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.UserTokenRepository = (*UserTokens)(nil)
+
+// UserTokens is an in-memory user token repository with unique hashes
+type UserTokens struct {
+	mu     sync.Mutex
+	ids    sequence
+	tokens map[int]*models.UserToken
+}
+
+// NewUserTokens returns a user token repository holding the given tokens
+func NewUserTokens(tokens ...models.UserToken) *UserTokens {
+	r := &UserTokens{tokens: make(map[int]*models.UserToken)}
+	for i := range tokens {
+		token := tokens[i]
+		r.ids.see(token.ID)
+		r.tokens[token.ID] = &token
+	}
+	return r
+}
+
+func (r *UserTokens) Create(ctx context.Context, token *models.UserToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.tokens {
+		if existing.TokenHash == token.TokenHash {
+			return repository.ErrDuplicate
+		}
+	}
+	token.ID = r.ids.next()
+	token.CreatedAt = time.Now()
+	stored := *token
+	r.tokens[token.ID] = &stored
+	return nil
+}
+
+func (r *UserTokens) FindByHash(ctx context.Context, purpose, hash string) (*models.UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, token := range r.tokens {
+		if token.Purpose == purpose && token.TokenHash == hash {
+			found := *token
+			return &found, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *UserTokens) Use(ctx context.Context, id int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, ok := r.tokens[id]
+	if !ok || token.UsedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	return true, nil
+}
+
+func (r *UserTokens) InvalidateForUser(ctx context.Context, userID int, purpose string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.Purpose == purpose && token.UsedAt == nil {
+			token.UsedAt = &now
+		}
+	}
+	return nil
+}
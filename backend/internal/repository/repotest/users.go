@@ -0,0 +1,90 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+var _ repository.UserRepository = (*Users)(nil)
+
+// Users is an in-memory user repository with unique emails
+type Users struct {
+	mu    sync.Mutex
+	ids   sequence
+	users map[int]*models.User
+}
+
+// NewUsers returns a user repository holding the given users
+func NewUsers(users ...models.User) *Users {
+	r := &Users{users: make(map[int]*models.User)}
+	for i := range users {
+		user := users[i]
+		r.ids.see(user.ID)
+		r.users[user.ID] = &user
+	}
+	return r
+}
+
+func (r *Users) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.findByEmail(user.Email) != nil {
+		return repository.ErrDuplicate
+	}
+	user.ID = r.ids.next()
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+func (r *Users) FindByID(ctx context.Context, id int) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r *Users) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user := r.findByEmail(email)
+	if user == nil {
+		return nil, repository.ErrNotFound
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r *Users) Update(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[user.ID]; !ok {
+		return repository.ErrNotFound
+	}
+	if other := r.findByEmail(user.Email); other != nil && other.ID != user.ID {
+		return repository.ErrDuplicate
+	}
+	user.UpdatedAt = time.Now()
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+func (r *Users) findByEmail(email string) *models.User {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+)
+
+// cutoffTable answers the statements of the revocation store from the cut-offs
+// it was given, the way the token_cutoffs table would
+type cutoffTable struct {
+	mu      sync.Mutex
+	cutoffs map[int64]time.Time // user ID -> revoked_before
+}
+
+func (c *cutoffTable) answer(query string, args []driver.Value) ([]string, [][]driver.Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, `INSERT INTO "token_cutoffs" ("user_id","revoked_before","updated_at")`):
+		c.cutoffs[args[0].(int64)] = args[1].(time.Time)
+		return nil, [][]driver.Value{{}}
+	case strings.Contains(query, "FROM token_cutoffs WHERE user_id IN"):
+		// the arguments are the denied token IDs, the user IDs and the issue time
+		issuedAt := args[len(args)-1].(time.Time)
+		revoked := false
+		for _, arg := range args[:len(args)-1] {
+			if userID, ok := arg.(int64); ok {
+				cutoff, ok := c.cutoffs[userID]
+				revoked = revoked || ok && cutoff.After(issuedAt)
+			}
+		}
+		return []string{"exists"}, [][]driver.Value{{revoked}}
+	}
+	return nil, nil
+}
+
+func TestRevocationStoreRevokeUser(t *testing.T) {
+	table := &cutoffTable{cutoffs: map[int64]time.Time{}}
+	database, _ := newFakeDatabase(t, table.answer)
+	store := NewRevocationStore(database)
+
+	// a cut-off well into a second, like time.Now() almost always is
+	cutoff := time.Date(2026, 10, 17, 12, 0, 30, 700_000_000, time.UTC)
+	if err := store.RevokeUser(context.Background(), "1", cutoff); err != nil {
+		t.Fatalf("RevokeUser: %v", err)
+	}
+	if stored := table.cutoffs[1]; !stored.Equal(cutoff) {
+		t.Fatalf("stored cut-off %v, want %v", stored, cutoff)
+	}
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		revoked  bool
+	}{
+		{"issued a second before", cutoff.Add(-time.Second), true},
+		{"issued within the same second before", cutoff.Add(-100 * time.Millisecond), true},
+		{"issued within the same second after", cutoff.Add(200 * time.Millisecond), true},
+		{"issued a second after", cutoff.Add(time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked, err := store.IsRevoked(context.Background(), &middleware.JWTClaims{
+				UserId:           "1",
+				RegisteredClaims: jwt.RegisteredClaims{ID: "jti", IssuedAt: jwt.NewNumericDate(tt.issuedAt)},
+			})
+			if err != nil {
+				t.Fatalf("IsRevoked: %v", err)
+			}
+			if revoked != tt.revoked {
+				t.Errorf("IsRevoked = %v, want %v", revoked, tt.revoked)
+			}
+		})
+	}
+}
+
+func TestRevocationStoreRevokeImpersonator(t *testing.T) {
+	table := &cutoffTable{cutoffs: map[int64]time.Time{}}
+	database, _ := newFakeDatabase(t, table.answer)
+	store := NewRevocationStore(database)
+
+	cutoff := time.Now()
+	if err := store.RevokeUser(context.Background(), "1", cutoff); err != nil {
+		t.Fatalf("RevokeUser: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		impersonator string
+		issuedAt     time.Time
+		revoked      bool
+	}{
+		{"impersonation issued before", "1", cutoff.Add(-time.Minute), true},
+		{"impersonation issued after", "1", cutoff.Add(time.Minute), false},
+		{"own token of the impersonated user", "", cutoff.Add(-time.Minute), false},
+		{"malformed impersonator", "admin", cutoff.Add(time.Minute), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked, err := store.IsRevoked(context.Background(), &middleware.JWTClaims{
+				UserId:           "3",
+				Impersonator:     tt.impersonator,
+				RegisteredClaims: jwt.RegisteredClaims{ID: "jti", IssuedAt: jwt.NewNumericDate(tt.issuedAt)},
+			})
+			if err != nil {
+				t.Fatalf("IsRevoked: %v", err)
+			}
+			if revoked != tt.revoked {
+				t.Errorf("IsRevoked = %v, want %v", revoked, tt.revoked)
+			}
+		})
+	}
+}
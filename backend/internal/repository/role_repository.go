@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// RoleRepository defines data access operations for roles and permissions.
+// Roles are read and written within the organization of the context: the
+// shared system roles are visible everywhere, custom roles only in the
+// organization that owns them.
+type RoleRepository interface {
+	List(ctx context.Context) ([]models.Role, error)
+	FindByID(ctx context.Context, id int) (*models.Role, error)
+	FindByName(ctx context.Context, name string) (*models.Role, error)
+	Create(ctx context.Context, role *models.Role) error
+	// Update saves the role and replaces its permissions
+	Update(ctx context.Context, role *models.Role) error
+	Delete(ctx context.Context, id int) error
+	// CountMembers returns how many active members of the organization hold the role
+	CountMembers(ctx context.Context, roleName string) (int64, error)
+	ListPermissions(ctx context.Context) ([]models.Permission, error)
+	FindPermissionsByName(ctx context.Context, names []string) ([]models.Permission, error)
+	// PermissionsForMember returns the permission names granted by the user's
+	// current role in the organization
+	PermissionsForMember(ctx context.Context, organizationID, userID int) ([]string, error)
+}
+
+type roleRepository struct {
+	db *gorm.DB
+}
+
+// NewRoleRepository creates a new GORM-backed role repository
+func NewRoleRepository(database *Database) RoleRepository {
+	return &roleRepository{db: database.DB}
+}
+
+// visible restricts a role query to the system roles and the context organization's custom roles
+func (r *roleRepository) visible(ctx context.Context) (*gorm.DB, error) {
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return nil, ErrMissingTenant
+	}
+	return conn(ctx, r.db).Where("roles.organization_id IS NULL OR roles.organization_id = ?", organizationID), nil
+}
+
+func (r *roleRepository) List(ctx context.Context) ([]models.Role, error) {
+	db, err := r.visible(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []models.Role
+	err = db.Preload("Permissions").Order("name").Find(&roles).Error
+	return roles, translateError(err)
+}
+
+func (r *roleRepository) FindByID(ctx context.Context, id int) (*models.Role, error) {
+	db, err := r.visible(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var role models.Role
+	if err := db.Preload("Permissions").First(&role, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &role, nil
+}
+
+func (r *roleRepository) FindByName(ctx context.Context, name string) (*models.Role, error) {
+	db, err := r.visible(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var role models.Role
+	if err := db.Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &role, nil
+}
+
+func (r *roleRepository) Create(ctx context.Context, role *models.Role) error {
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return ErrMissingTenant
+	}
+	role.OrganizationID = &organizationID
+	return translateError(conn(ctx, r.db).Create(role).Error)
+}
+
+func (r *roleRepository) Update(ctx context.Context, role *models.Role) error {
+	return translateError(conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Permissions").Save(role).Error; err != nil {
+			return err
+		}
+		return tx.Model(role).Association("Permissions").Replace(role.Permissions)
+	}))
+}
+
+func (r *roleRepository) Delete(ctx context.Context, id int) error {
+	return translateError(conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		role := &models.Role{ID: id}
+		if err := tx.Model(role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	}))
+}
+
+func (r *roleRepository) CountMembers(ctx context.Context, roleName string) (int64, error) {
+	var count int64
+	err := conn(ctx, r.db).Model(&models.Membership{}).Where("role = ? AND deactivated_at IS NULL", roleName).Count(&count).Error
+	return count, translateError(err)
+}
+
+func (r *roleRepository) ListPermissions(ctx context.Context) ([]models.Permission, error) {
+	var permissions []models.Permission
+	err := conn(ctx, r.db).Order("name").Find(&permissions).Error
+	return permissions, translateError(err)
+}
+
+func (r *roleRepository) FindPermissionsByName(ctx context.Context, names []string) ([]models.Permission, error) {
+	var permissions []models.Permission
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	err := conn(ctx, r.db).Where("name IN ?", names).Find(&permissions).Error
+	return permissions, translateError(err)
+}
+
+func (r *roleRepository) PermissionsForMember(ctx context.Context, organizationID, userID int) ([]string, error) {
+	var names []string
+	err := conn(ctx, r.db).
+		Table("memberships").
+		Select("permissions.name").
+		Joins("JOIN roles ON roles.name = memberships.role AND (roles.organization_id IS NULL OR roles.organization_id = memberships.organization_id)").
+		Joins("JOIN role_permissions ON role_permissions.role_id = roles.id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("memberships.organization_id = ? AND memberships.user_id = ? AND memberships.deactivated_at IS NULL", organizationID, userID).
+		Pluck("permissions.name", &names).Error
+	return names, translateError(err)
+}
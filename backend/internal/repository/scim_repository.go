@@ -0,0 +1,344 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/scim"
+	"gorm.io/gorm"
+)
+
+// SCIMRepository defines data access operations for SCIM provisioning: the
+// tokens identity providers authenticate with, and the users and groups
+// they see. SCIM users are the members of the context organization,
+// including deactivated ones but not service accounts; SCIM groups are the
+// roles visible to it.
+type SCIMRepository interface {
+	CreateToken(ctx context.Context, token *models.SCIMToken) error
+	FindToken(ctx context.Context, id int) (*models.SCIMToken, error)
+	// FindTokenByHash looks a token up across all organizations, since the
+	// organization is only known once the token is found
+	FindTokenByHash(ctx context.Context, hash string) (*models.SCIMToken, error)
+	// ListTokens returns the unrevoked tokens of the context organization
+	ListTokens(ctx context.Context) ([]models.SCIMToken, error)
+	RevokeToken(ctx context.Context, id int) error
+	TouchTokenLastUsed(ctx context.Context, id int, at time.Time) error
+
+	// ListUsers returns a page of the memberships matching the filter, with
+	// their users, and the number of matching memberships. A nil filter
+	// matches every membership.
+	ListUsers(ctx context.Context, filter scim.Filter, offset, limit int) ([]models.Membership, int64, error)
+	// FindUser returns the user's membership with their user, even when deactivated
+	FindUser(ctx context.Context, userID int) (*models.Membership, error)
+	// ListGroups returns a page of the roles matching the filter and the
+	// number of matching roles
+	ListGroups(ctx context.Context, filter scim.Filter, offset, limit int) ([]models.Role, int64, error)
+	// ListGroupMembers returns the memberships holding any of the roles, with their users
+	ListGroupMembers(ctx context.Context, roleNames []string) ([]models.Membership, error)
+}
+
+// scimKind is how a filtered attribute is compared
+type scimKind int
+
+const (
+	scimString    scimKind = iota // case-insensitive string
+	scimCaseExact                 // case-sensitive string
+	scimInteger
+	scimTimestamp
+	scimActive // whether a membership is not deactivated
+)
+
+// scimAttribute is a filterable SCIM attribute and the column it maps to
+type scimAttribute struct {
+	column string
+	kind   scimKind
+}
+
+// scimUserAttributes whitelists the filterable attributes of users, keyed
+// by lowercased attribute name
+var scimUserAttributes = map[string]scimAttribute{
+	"id":                {"users.id", scimInteger},
+	"username":          {"users.email", scimString},
+	"emails":            {"users.email", scimString},
+	"emails.value":      {"users.email", scimString},
+	"displayname":       {"users.buisness_name", scimString},
+	"externalid":        {"memberships.external_id", scimCaseExact},
+	"active":            {"memberships.deactivated_at", scimActive},
+	"meta.created":      {"memberships.created_at", scimTimestamp},
+	"meta.lastmodified": {"memberships.updated_at", scimTimestamp},
+}
+
+// scimGroupAttributes whitelists the filterable attributes of groups
+var scimGroupAttributes = map[string]scimAttribute{
+	"id":                {"roles.id", scimInteger},
+	"displayname":       {"roles.name", scimString},
+	"meta.created":      {"roles.created_at", scimTimestamp},
+	"meta.lastmodified": {"roles.updated_at", scimTimestamp},
+}
+
+type scimRepository struct {
+	db *gorm.DB
+}
+
+// NewSCIMRepository creates a new GORM-backed SCIM repository
+func NewSCIMRepository(database *Database) SCIMRepository {
+	return &scimRepository{db: database.DB}
+}
+
+func (r *scimRepository) CreateToken(ctx context.Context, token *models.SCIMToken) error {
+	return translateError(conn(ctx, r.db).Create(token).Error)
+}
+
+func (r *scimRepository) FindToken(ctx context.Context, id int) (*models.SCIMToken, error) {
+	var token models.SCIMToken
+	if err := conn(ctx, r.db).First(&token, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+func (r *scimRepository) FindTokenByHash(ctx context.Context, hash string) (*models.SCIMToken, error) {
+	var token models.SCIMToken
+	if err := conn(tenant.Unscoped(ctx), r.db).Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+func (r *scimRepository) ListTokens(ctx context.Context) ([]models.SCIMToken, error) {
+	var tokens []models.SCIMToken
+	err := conn(ctx, r.db).Where("revoked_at IS NULL").Order("created_at, id").Find(&tokens).Error
+	return tokens, translateError(err)
+}
+
+func (r *scimRepository) RevokeToken(ctx context.Context, id int) error {
+	return translateError(conn(ctx, r.db).
+		Model(&models.SCIMToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now().UTC()).Error)
+}
+
+func (r *scimRepository) TouchTokenLastUsed(ctx context.Context, id int, at time.Time) error {
+	return translateError(conn(tenant.Unscoped(ctx), r.db).
+		Model(&models.SCIMToken{}).
+		Where("id = ?", id).
+		Update("last_used_at", at.UTC()).Error)
+}
+
+// users selects the memberships of people in the context organization
+func (r *scimRepository) users(ctx context.Context) *gorm.DB {
+	return conn(ctx, r.db).
+		Model(&models.Membership{}).
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("users.service_account = ?", false)
+}
+
+func (r *scimRepository) ListUsers(ctx context.Context, filter scim.Filter, offset, limit int) ([]models.Membership, int64, error) {
+	query := r.users(ctx)
+	if filter != nil {
+		condition, args, err := scimCondition(filter, scimUserAttributes)
+		if err != nil {
+			return nil, 0, err
+		}
+		query = query.Where(condition, args...)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, translateError(err)
+	}
+
+	var memberships []models.Membership
+	err := query.Preload("User").Order("memberships.id").Offset(offset).Limit(limit).Find(&memberships).Error
+	return memberships, total, translateError(err)
+}
+
+func (r *scimRepository) FindUser(ctx context.Context, userID int) (*models.Membership, error) {
+	var membership models.Membership
+	err := r.users(ctx).Preload("User").Where("memberships.user_id = ?", userID).First(&membership).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &membership, nil
+}
+
+func (r *scimRepository) ListGroups(ctx context.Context, filter scim.Filter, offset, limit int) ([]models.Role, int64, error) {
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return nil, 0, ErrMissingTenant
+	}
+	query := conn(ctx, r.db).
+		Model(&models.Role{}).
+		Where("roles.organization_id IS NULL OR roles.organization_id = ?", organizationID)
+	if filter != nil {
+		condition, args, err := scimCondition(filter, scimGroupAttributes)
+		if err != nil {
+			return nil, 0, err
+		}
+		query = query.Where(condition, args...)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, translateError(err)
+	}
+
+	var roles []models.Role
+	err := query.Order("roles.id").Offset(offset).Limit(limit).Find(&roles).Error
+	return roles, total, translateError(err)
+}
+
+func (r *scimRepository) ListGroupMembers(ctx context.Context, roleNames []string) ([]models.Membership, error) {
+	var memberships []models.Membership
+	if len(roleNames) == 0 {
+		return memberships, nil
+	}
+	err := r.users(ctx).
+		Preload("User").
+		Where("memberships.role IN ?", roleNames).
+		Order("memberships.id").
+		Find(&memberships).Error
+	return memberships, translateError(err)
+}
+
+// scimCondition translates a filter into a SQL condition over the columns
+// of the whitelisted attributes. Filters on any other attribute, or with a
+// value that does not fit the attribute, are rejected with
+// scim.ErrInvalidFilter.
+func scimCondition(filter scim.Filter, attributes map[string]scimAttribute) (string, []interface{}, error) {
+	switch f := filter.(type) {
+	case *scim.LogicalExpression:
+		left, leftArgs, err := scimCondition(f.Left, attributes)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rightArgs, err := scimCondition(f.Right, attributes)
+		if err != nil {
+			return "", nil, err
+		}
+		operator := "AND"
+		if f.Operator == "or" {
+			operator = "OR"
+		}
+		return fmt.Sprintf("(%s) %s (%s)", left, operator, right), append(leftArgs, rightArgs...), nil
+	case *scim.NotExpression:
+		condition, args, err := scimCondition(f.Filter, attributes)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("NOT (%s)", condition), args, nil
+	case *scim.AttributeExpression:
+		attribute, ok := attributes[strings.ToLower(f.Attribute)]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: filtering on %q is not supported", scim.ErrInvalidFilter, f.Attribute)
+		}
+		return attribute.condition(f)
+	default:
+		return "", nil, fmt.Errorf("%w: unsupported expression", scim.ErrInvalidFilter)
+	}
+}
+
+// scimComparisons maps the ordering operators to SQL
+var scimComparisons = map[string]string{
+	scim.OpEqual:          "=",
+	scim.OpNotEqual:       "<>",
+	scim.OpGreaterThan:    ">",
+	scim.OpGreaterOrEqual: ">=",
+	scim.OpLessThan:       "<",
+	scim.OpLessOrEqual:    "<=",
+}
+
+// condition translates an expression on the attribute
+func (a scimAttribute) condition(expression *scim.AttributeExpression) (string, []interface{}, error) {
+	invalid := func() (string, []interface{}, error) {
+		return "", nil, fmt.Errorf("%w: %q %s %v is not a valid comparison",
+			scim.ErrInvalidFilter, expression.Attribute, expression.Operator, expression.Value)
+	}
+
+	if a.kind == scimActive {
+		active, ok := expression.Value.(bool)
+		switch {
+		case expression.Operator == scim.OpPresent:
+			return "1 = 1", nil, nil
+		case !ok || (expression.Operator != scim.OpEqual && expression.Operator != scim.OpNotEqual):
+			return invalid()
+		case active == (expression.Operator == scim.OpEqual):
+			return a.column + " IS NULL", nil, nil
+		default:
+			return a.column + " IS NOT NULL", nil, nil
+		}
+	}
+
+	if expression.Operator == scim.OpPresent {
+		if a.kind == scimString || a.kind == scimCaseExact {
+			return fmt.Sprintf("%s IS NOT NULL AND %s <> ''", a.column, a.column), nil, nil
+		}
+		return a.column + " IS NOT NULL", nil, nil
+	}
+
+	column := a.column
+	var value interface{}
+	switch a.kind {
+	case scimString, scimCaseExact:
+		text, ok := expression.Value.(string)
+		if !ok {
+			return invalid()
+		}
+		if a.kind == scimString {
+			column, text = "LOWER("+column+")", strings.ToLower(text)
+		}
+		if pattern, ok := likePattern(expression.Operator, text); ok {
+			return column + ` LIKE ? ESCAPE '\'`, []interface{}{pattern}, nil
+		}
+		value = text
+	case scimInteger:
+		var id int
+		var err error
+		switch v := expression.Value.(type) {
+		case string:
+			id, err = strconv.Atoi(v)
+		case float64:
+			id = int(v)
+		default:
+			return invalid()
+		}
+		if err != nil {
+			// ids are opaque to clients, so an id that is not a number matches nothing
+			return "1 = 0", nil, nil
+		}
+		value = id
+	case scimTimestamp:
+		text, _ := expression.Value.(string)
+		at, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return invalid()
+		}
+		value = at.UTC()
+	}
+
+	comparison, ok := scimComparisons[expression.Operator]
+	if !ok {
+		return invalid()
+	}
+	return fmt.Sprintf("%s %s ?", column, comparison), []interface{}{value}, nil
+}
+
+// likePattern returns the LIKE pattern of the substring operators, escaping
+// the wildcards in the value
+func likePattern(operator, value string) (string, bool) {
+	value = escapeLike(value)
+	switch operator {
+	case scim.OpContains:
+		return "%" + value + "%", true
+	case scim.OpStartsWith:
+		return value + "%", true
+	case scim.OpEndsWith:
+		return "%" + value, true
+	}
+	return "", false
+}
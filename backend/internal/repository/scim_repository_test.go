@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/scim"
+)
+
+func TestSCIMCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    string
+		condition string
+		args      []interface{}
+	}{
+		{"case-insensitive eq", `userName eq "Ada@Example.com"`, "LOWER(users.email) = ?", []interface{}{"ada@example.com"}},
+		{"case-exact eq", `externalId eq "AbC"`, "memberships.external_id = ?", []interface{}{"AbC"}},
+		{"co escapes wildcards", `displayName co "50%_\\"`, `LOWER(users.buisness_name) LIKE ? ESCAPE '\'`, []interface{}{`%50\%\_\\%`}},
+		{"sw", `emails.value sw "ada"`, `LOWER(users.email) LIKE ? ESCAPE '\'`, []interface{}{"ada%"}},
+		{"value path", `emails[value ew "@example.com"]`, `LOWER(users.email) LIKE ? ESCAPE '\'`, []interface{}{"%@example.com"}},
+		{"pr on a string", `displayName pr`, "users.buisness_name IS NOT NULL AND users.buisness_name <> ''", nil},
+		{"active", `active eq true`, "memberships.deactivated_at IS NULL", nil},
+		{"inactive", `active ne true`, "memberships.deactivated_at IS NOT NULL", nil},
+		{"id as a string", `id eq "7"`, "users.id = ?", []interface{}{7}},
+		{"id that is not a number", `id eq "abc"`, "1 = 0", nil},
+		{"timestamp", `meta.lastModified gt "2026-10-17T12:00:00+02:00"`, "memberships.updated_at > ?",
+			[]interface{}{time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)}},
+		{"attribute names are case-insensitive", `USERNAME eq "a"`, "LOWER(users.email) = ?", []interface{}{"a"}},
+		{"logical expressions", `not (active eq true) and (userName eq "a" or externalId eq "b")`,
+			"(NOT (memberships.deactivated_at IS NULL)) AND ((LOWER(users.email) = ?) OR (memberships.external_id = ?))",
+			[]interface{}{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := scim.ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseFilter: %v", err)
+			}
+			condition, args, err := scimCondition(filter, scimUserAttributes)
+			if err != nil {
+				t.Fatalf("scimCondition: %v", err)
+			}
+			if condition != tt.condition {
+				t.Errorf("condition = %s, want %s", condition, tt.condition)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %#v, want %#v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestSCIMConditionRejectsUnsupportedFilters(t *testing.T) {
+	tests := []struct {
+		name       string
+		filter     string
+		attributes map[string]scimAttribute
+	}{
+		{"unknown attribute", `title eq "CEO"`, scimUserAttributes},
+		{"unknown sub-attribute", `emails[type eq "work"]`, scimUserAttributes},
+		{"unknown attribute in a logical expression", `userName eq "a" or nickName eq "b"`, scimUserAttributes},
+		{"user attribute on groups", `userName eq "a"`, scimGroupAttributes},
+		{"column name", `users.password eq "x"`, scimUserAttributes},
+		{"string compared with a number", `userName eq 5`, scimUserAttributes},
+		{"active compared with a string", `active eq "true"`, scimUserAttributes},
+		{"active with an ordering operator", `active gt false`, scimUserAttributes},
+		{"id with co", `id co "1"`, scimUserAttributes},
+		{"timestamp that is not RFC 3339", `meta.created gt "yesterday"`, scimUserAttributes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := scim.ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseFilter: %v", err)
+			}
+			condition, _, err := scimCondition(filter, tt.attributes)
+			if !errors.Is(err, scim.ErrInvalidFilter) {
+				t.Errorf("scimCondition = %q, %v, want %v", condition, err, scim.ErrInvalidFilter)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Seed inserts the reference data the application relies on. It is safe to
+// run on every startup: the permission catalog and system roles are brought
+// in line with the code while custom roles are left untouched.
+func (d *Database) Seed(ctx context.Context) error {
+	d.logger.Info("Seeding reference data")
+
+	err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, permission := range models.PermissionCatalog {
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "name"}},
+				DoUpdates: clause.AssignmentColumns([]string{"description"}),
+			}).Create(&permission).Error; err != nil {
+				return err
+			}
+		}
+
+		for name, permissionNames := range models.SystemRoles {
+			role := models.Role{Name: name}
+			if err := tx.Where("name = ? AND organization_id IS NULL", name).Attrs(models.Role{IsSystem: true}).FirstOrCreate(&role).Error; err != nil {
+				return err
+			}
+
+			var permissions []models.Permission
+			if err := tx.Where("name IN ?", permissionNames).Find(&permissions).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&role).Association("Permissions").Replace(permissions); err != nil {
+				return err
+			}
+		}
+
+		return d.backfillOrganizations(ctx, tx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to seed reference data: %w", err)
+	}
+
+	return nil
+}
+
+// backfillOrganizations gives every user that is not a member of any
+// organization a personal one. Accounts created before organizations existed
+// keep the role they held at the time.
+func (d *Database) backfillOrganizations(ctx context.Context, tx *gorm.DB) error {
+	columns := "users.id, users.email, users.buisness_name"
+	if tx.Migrator().HasColumn(&models.User{}, "role") {
+		columns += ", users.role"
+	}
+
+	var users []struct {
+		ID           int
+		Email        string
+		BuisnessName string
+		Role         string
+	}
+	err := tx.Table("users").
+		Select(columns).
+		Where("NOT EXISTS (SELECT 1 FROM memberships WHERE memberships.user_id = users.id)").
+		Scan(&users).Error
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		name := user.BuisnessName
+		if name == "" {
+			name = user.Email
+		}
+		slug, err := utils.UniqueSlug(name)
+		if err != nil {
+			return err
+		}
+
+		organization := models.Organization{Name: name, Slug: slug}
+		if err := tx.Create(&organization).Error; err != nil {
+			return err
+		}
+
+		role := user.Role
+		if role == "" {
+			role = models.RoleAdmin
+		}
+		membership := models.Membership{UserID: user.ID, Role: role}
+		if err := tx.WithContext(tenant.WithOrganization(ctx, organization.ID)).Create(&membership).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(users) > 0 {
+		d.logger.Infow("Created personal organizations for existing users", "count", len(users))
+	}
+	return nil
+}
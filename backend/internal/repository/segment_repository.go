@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/segment"
+	"gorm.io/gorm"
+)
+
+// Fields segment rules can compare, besides custom fields
+const (
+	SegmentTag          = "tag"           // a tag the record carries
+	SegmentOwner        = "owner_id"      // the owner of the record
+	SegmentCreatedAt    = "created_at"    // the age of the record
+	SegmentUpdatedAt    = "updated_at"    // the time since the record last changed
+	SegmentLastActivity = "last_activity" // the time since the last activity on the record
+)
+
+// SegmentRule is a checked segment rule, ready to be evaluated. Operator is
+// "and" or "or" combining Rules, "not" negating its only rule, or the
+// comparison operator of a condition on Field.
+//
+// Conditions on tags and owners compare with "=" and Value is the tag name or
+// the owner ID, nil for no owner. Conditions on ages compare with "<", "<=",
+// ">" or ">=" and Value is a time.Duration: `last_activity < 30d` matches
+// records with an activity in the last 30 days, and records without any
+// activity match `last_activity > 30d`. Conditions on custom fields are given
+// by Custom.
+type SegmentRule struct {
+	Operator string
+	Rules    []SegmentRule
+	Field    string
+	Value    interface{}
+	Custom   *CustomFieldCondition
+}
+
+// SegmentMatch restricts a listing to the members of a segment: the records
+// of RecordType matching Rule at Now. When IDs is not nil, it holds the
+// members as evaluated at Now and the listing selects them by ID; otherwise
+// the listing query evaluates Rule itself.
+type SegmentMatch struct {
+	RecordType string
+	Rule       SegmentRule
+	Now        time.Time
+	IDs        []int
+}
+
+// condition returns the SQL condition matching the members among the records
+// of the segment's table
+func (m *SegmentMatch) condition() (string, []interface{}, error) {
+	table, ok := recordTables[m.RecordType]
+	if !ok {
+		return "", nil, fmt.Errorf("segments are not supported on %q records", m.RecordType)
+	}
+	return segmentCondition(table, m.RecordType, m.Rule, m.Now)
+}
+
+// where restricts a query over the records of the segment's type to its
+// members
+func (m *SegmentMatch) where(query *gorm.DB) *gorm.DB {
+	if m.IDs != nil {
+		return query.Where(recordTables[m.RecordType]+".id IN ?", m.IDs)
+	}
+	condition, args, err := m.condition()
+	if err != nil {
+		_ = query.AddError(err)
+		return query
+	}
+	return query.Where(condition, args...)
+}
+
+// whereAbout restricts a query over the table of activities or tasks to those
+// about the segment's members, selected by a subquery scoped to the context
+// organization like any other query
+func (m *SegmentMatch) whereAbout(query *gorm.DB, table string) *gorm.DB {
+	if m.IDs != nil {
+		return query.Where(table+".record_type = ? AND "+table+".record_id IN ?", m.RecordType, m.IDs)
+	}
+	condition, args, err := m.condition()
+	if err != nil {
+		_ = query.AddError(err)
+		return query
+	}
+	members := query.Session(&gorm.Session{NewDB: true}).Model(recordModels[m.RecordType]).
+		Select(recordTables[m.RecordType]+".id").Where(condition, args...)
+	return query.Where(table+".record_type = ? AND "+table+".record_id IN (?)", m.RecordType, members)
+}
+
+// recordTables maps the record types segments can hold to their tables
+var recordTables = map[string]string{
+	models.RecordContact: "contacts",
+	models.RecordCompany: "companies",
+	models.RecordDeal:    "deals",
+}
+
+// SegmentRepository defines data access operations for segments
+type SegmentRepository interface {
+	Create(ctx context.Context, segment *models.Segment) error
+	FindByID(ctx context.Context, id int) (*models.Segment, error)
+	// List returns the context organization's segments of a record type, or
+	// of every type when recordType is empty, in name order
+	List(ctx context.Context, recordType string) ([]models.Segment, error)
+	Update(ctx context.Context, segment *models.Segment) error
+	Delete(ctx context.Context, id int) error
+	// Members returns the IDs of at most limit of the context organization's
+	// records in a segment, in ID order
+	Members(ctx context.Context, match SegmentMatch, limit int) ([]int, error)
+	// CountMembers returns the number of the context organization's records
+	// in a segment
+	CountMembers(ctx context.Context, match SegmentMatch) (int64, error)
+}
+
+type segmentRepository struct {
+	db *gorm.DB
+}
+
+// NewSegmentRepository creates a new GORM-backed segment repository
+func NewSegmentRepository(database *Database) SegmentRepository {
+	return &segmentRepository{db: database.DB}
+}
+
+func (r *segmentRepository) Create(ctx context.Context, segment *models.Segment) error {
+	return translateError(conn(ctx, r.db).Create(segment).Error)
+}
+
+func (r *segmentRepository) FindByID(ctx context.Context, id int) (*models.Segment, error) {
+	var segment models.Segment
+	if err := conn(ctx, r.db).First(&segment, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &segment, nil
+}
+
+func (r *segmentRepository) List(ctx context.Context, recordType string) ([]models.Segment, error) {
+	query := conn(ctx, r.db)
+	if recordType != "" {
+		query = query.Where("record_type = ?", recordType)
+	}
+	var segments []models.Segment
+	err := query.Order("name, id").Find(&segments).Error
+	return segments, translateError(err)
+}
+
+func (r *segmentRepository) Update(ctx context.Context, segment *models.Segment) error {
+	return translateError(conn(ctx, r.db).Save(segment).Error)
+}
+
+func (r *segmentRepository) Delete(ctx context.Context, id int) error {
+	result := conn(ctx, r.db).Delete(&models.Segment{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *segmentRepository) Members(ctx context.Context, match SegmentMatch, limit int) ([]int, error) {
+	table := recordTables[match.RecordType]
+	var ids []int
+	err := match.where(conn(ctx, r.db).Model(recordModels[match.RecordType])).
+		Order(table+".id").Limit(limit).Pluck(table+".id", &ids).Error
+	if ids == nil {
+		ids = []int{} // an empty segment, rather than no restriction
+	}
+	return ids, translateError(err)
+}
+
+func (r *segmentRepository) CountMembers(ctx context.Context, match SegmentMatch) (int64, error) {
+	var count int64
+	err := match.where(conn(ctx, r.db).Model(recordModels[match.RecordType])).Count(&count).Error
+	return count, translateError(err)
+}
+
+// ageComparisons maps the comparisons of ages to the comparisons of the
+// times they are measured from: an age below 30 days is a time after 30 days ago
+var ageComparisons = map[string]string{
+	segment.OpLess:           ">",
+	segment.OpLessOrEqual:    ">=",
+	segment.OpGreater:        "<",
+	segment.OpGreaterOrEqual: "<=",
+}
+
+// segmentCondition translates a rule into a SQL condition over the table's
+// records. Every condition is either true or false, never NULL, so that
+// negations match the records a condition does not.
+func segmentCondition(table, recordType string, rule SegmentRule, now time.Time) (string, []interface{}, error) {
+	switch rule.Operator {
+	case "and", "or":
+		parts := make([]string, len(rule.Rules))
+		var args []interface{}
+		for i, child := range rule.Rules {
+			condition, childArgs, err := segmentCondition(table, recordType, child, now)
+			if err != nil {
+				return "", nil, err
+			}
+			parts[i] = "(" + condition + ")"
+			args = append(args, childArgs...)
+		}
+		return strings.Join(parts, " "+strings.ToUpper(rule.Operator)+" "), args, nil
+	case "not":
+		if len(rule.Rules) != 1 {
+			return "", nil, fmt.Errorf("segment rule: not takes one rule, got %d", len(rule.Rules))
+		}
+		condition, args, err := segmentCondition(table, recordType, rule.Rules[0], now)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + condition + ")", args, nil
+	}
+
+	if rule.Custom != nil {
+		condition, args := customFieldClause(table, *rule.Custom)
+		return "COALESCE(" + condition + ", FALSE)", args, nil
+	}
+
+	switch rule.Field {
+	case SegmentTag:
+		name, _ := rule.Value.(string)
+		condition, args := taggedWith(table, recordType, name)
+		return condition, args, nil
+	case SegmentOwner:
+		if rule.Value == nil {
+			return table + ".owner_id IS NULL", nil, nil
+		}
+		return "COALESCE(" + table + ".owner_id = ?, FALSE)", []interface{}{rule.Value}, nil
+	case SegmentCreatedAt, SegmentUpdatedAt, SegmentLastActivity:
+		age, ok := rule.Value.(time.Duration)
+		comparison, known := ageComparisons[rule.Operator]
+		if !ok || !known {
+			return "", nil, fmt.Errorf("segment rule: invalid comparison %s %s %v", rule.Field, rule.Operator, rule.Value)
+		}
+		since := now.Add(-age)
+		if rule.Field != SegmentLastActivity {
+			return table + "." + rule.Field + " " + comparison + " ?", []interface{}{since}, nil
+		}
+
+		// records without activities have been inactive forever, so that
+		// "an activity in the last 30 days" exists and "inactive for more
+		// than 30 days" is the absence of one
+		activity := "EXISTS (SELECT 1 FROM activities WHERE activities.record_type = ? AND activities.record_id = " +
+			table + ".id AND activities.occurred_at "
+		switch rule.Operator {
+		case segment.OpLess, segment.OpLessOrEqual:
+			return activity + comparison + " ?)", []interface{}{recordType, since}, nil
+		case segment.OpGreater:
+			return "NOT " + activity + ">= ?)", []interface{}{recordType, since}, nil
+		default:
+			return "NOT " + activity + "> ?)", []interface{}{recordType, since}, nil
+		}
+	default:
+		return "", nil, fmt.Errorf("segment rule: unknown field %q", rule.Field)
+	}
+}
@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+)
+
+func TestSegmentCondition(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	monthAgo := now.Add(-30 * 24 * time.Hour)
+	tag := SegmentRule{Operator: "=", Field: SegmentTag, Value: "vip"}
+	owner := SegmentRule{Operator: "=", Field: SegmentOwner, Value: 4}
+
+	tests := []struct {
+		name      string
+		rule      SegmentRule
+		condition string
+		args      []interface{}
+	}{
+		{"tag", tag,
+			"EXISTS (SELECT 1 FROM taggings WHERE taggings.record_type = ? AND taggings.record_id = contacts.id AND taggings.name = ?)",
+			[]interface{}{models.RecordContact, "vip"}},
+		{"owner", owner, "COALESCE(contacts.owner_id = ?, FALSE)", []interface{}{4}},
+		{"no owner", SegmentRule{Operator: "=", Field: SegmentOwner}, "contacts.owner_id IS NULL", nil},
+		{"created recently", SegmentRule{Operator: "<", Field: SegmentCreatedAt, Value: 30 * 24 * time.Hour},
+			"contacts.created_at > ?", []interface{}{monthAgo}},
+		{"unchanged for a while", SegmentRule{Operator: ">=", Field: SegmentUpdatedAt, Value: 30 * 24 * time.Hour},
+			"contacts.updated_at <= ?", []interface{}{monthAgo}},
+		{"recent activity", SegmentRule{Operator: "<", Field: SegmentLastActivity, Value: 30 * 24 * time.Hour},
+			"EXISTS (SELECT 1 FROM activities WHERE activities.record_type = ? AND activities.record_id = contacts.id AND activities.occurred_at > ?)",
+			[]interface{}{models.RecordContact, monthAgo}},
+		{"activity at most 30 days ago", SegmentRule{Operator: "<=", Field: SegmentLastActivity, Value: 30 * 24 * time.Hour},
+			"EXISTS (SELECT 1 FROM activities WHERE activities.record_type = ? AND activities.record_id = contacts.id AND activities.occurred_at >= ?)",
+			[]interface{}{models.RecordContact, monthAgo}},
+		{"inactive", SegmentRule{Operator: ">", Field: SegmentLastActivity, Value: 30 * 24 * time.Hour},
+			"NOT EXISTS (SELECT 1 FROM activities WHERE activities.record_type = ? AND activities.record_id = contacts.id AND activities.occurred_at >= ?)",
+			[]interface{}{models.RecordContact, monthAgo}},
+		{"inactive for at least 30 days", SegmentRule{Operator: ">=", Field: SegmentLastActivity, Value: 30 * 24 * time.Hour},
+			"NOT EXISTS (SELECT 1 FROM activities WHERE activities.record_type = ? AND activities.record_id = contacts.id AND activities.occurred_at > ?)",
+			[]interface{}{models.RecordContact, monthAgo}},
+		{"custom select", SegmentRule{Operator: "=", Field: "cf.tier", Custom: &CustomFieldCondition{
+			Key: "tier", Type: models.CustomFieldSelect, Op: CustomFieldEq, Value: "gold",
+		}}, "COALESCE(contacts.custom_fields->>'tier' = ?, FALSE)", []interface{}{"gold"}},
+		{"custom number", SegmentRule{Operator: ">=", Field: "cf.score", Custom: &CustomFieldCondition{
+			Key: "score", Type: models.CustomFieldNumber, Op: CustomFieldGte, Value: 7.5,
+		}}, "COALESCE(CAST(contacts.custom_fields->>'score' AS numeric) >= ?, FALSE)", []interface{}{7.5}},
+		{"custom multi select", SegmentRule{Operator: "=", Field: "cf.topics", Custom: &CustomFieldCondition{
+			Key: "topics", Type: models.CustomFieldMultiSelect, Op: CustomFieldEq, Value: "a",
+		}}, "COALESCE(contacts.custom_fields->'topics' @> CAST(? AS jsonb), FALSE)", []interface{}{`["a"]`}},
+		{"custom key with a quote", SegmentRule{Operator: "=", Field: "cf.o'neil", Custom: &CustomFieldCondition{
+			Key: "o'neil", Type: models.CustomFieldText, Op: CustomFieldEq, Value: "x",
+		}}, "COALESCE(contacts.custom_fields->>'o''neil' = ?, FALSE)", []interface{}{"x"}},
+
+		{"and", SegmentRule{Operator: "and", Rules: []SegmentRule{tag, owner}},
+			"(EXISTS (SELECT 1 FROM taggings WHERE taggings.record_type = ? AND taggings.record_id = contacts.id AND taggings.name = ?)) AND " +
+				"(COALESCE(contacts.owner_id = ?, FALSE))",
+			[]interface{}{models.RecordContact, "vip", 4}},
+		{"or of a negation", SegmentRule{Operator: "or", Rules: []SegmentRule{
+			{Operator: "not", Rules: []SegmentRule{tag}},
+			{Operator: "and", Rules: []SegmentRule{owner, {Operator: "=", Field: SegmentOwner}}},
+		}},
+			"(NOT (EXISTS (SELECT 1 FROM taggings WHERE taggings.record_type = ? AND taggings.record_id = contacts.id AND taggings.name = ?))) OR " +
+				"((COALESCE(contacts.owner_id = ?, FALSE)) AND (contacts.owner_id IS NULL))",
+			[]interface{}{models.RecordContact, "vip", 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, args, err := segmentCondition("contacts", models.RecordContact, tt.rule, now)
+			if err != nil {
+				t.Fatalf("segmentCondition: %v", err)
+			}
+			if condition != tt.condition {
+				t.Errorf("condition = %s, want %s", condition, tt.condition)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %#v, want %#v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestSegmentConditionRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule SegmentRule
+	}{
+		{"unknown field", SegmentRule{Operator: "=", Field: "email", Value: "a@example.com"}},
+		{"age compared for equality", SegmentRule{Operator: "=", Field: SegmentCreatedAt, Value: time.Hour}},
+		{"age without a duration", SegmentRule{Operator: "<", Field: SegmentLastActivity, Value: "30d"}},
+		{"negation of two rules", SegmentRule{Operator: "not", Rules: []SegmentRule{{}, {}}}},
+		{"unknown field in a group", SegmentRule{Operator: "and", Rules: []SegmentRule{
+			{Operator: "=", Field: SegmentOwner, Value: 1}, {Operator: "=", Field: "email"},
+		}}},
+	}
+	for _, tt := range tests {
+		if condition, _, err := segmentCondition("contacts", models.RecordContact, tt.rule, time.Now()); err == nil {
+			t.Errorf("%s: segmentCondition = %s, want an error", tt.name, condition)
+		}
+	}
+}
+
+func TestSegmentListings(t *testing.T) {
+	match := &SegmentMatch{RecordType: models.RecordCompany, Rule: SegmentRule{Operator: "=", Field: SegmentOwner, Value: 4}}
+	cached := &SegmentMatch{RecordType: models.RecordCompany, Rule: match.Rule, IDs: []int{5, 7}}
+	ctx := tenant.WithOrganization(context.Background(), 3)
+	count := func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "SELECT count(*)") {
+			return []string{"count"}, [][]driver.Value{{int64(1)}}
+		}
+		return nil, nil
+	}
+
+	tests := []struct {
+		name  string
+		list  func(database *Database) error
+		where string         // the conditions of the count and the page
+		args  []driver.Value // the arguments of the segment's conditions
+	}{
+		{"companies", func(database *Database) error {
+			_, _, err := NewCompanyRepository(database).List(ctx, CompanyFilter{InSegment: match}, 0, 20)
+			return err
+		}, `WHERE COALESCE(companies.owner_id = $1, FALSE) AND "companies"."organization_id" = $2`, []driver.Value{int64(4)}},
+		{"companies by member IDs", func(database *Database) error {
+			_, _, err := NewCompanyRepository(database).List(ctx, CompanyFilter{InSegment: cached}, 0, 20)
+			return err
+		}, `WHERE companies.id IN ($1,$2) AND "companies"."organization_id" = $3`, []driver.Value{int64(5), int64(7)}},
+		{"activities", func(database *Database) error {
+			_, _, err := NewActivityRepository(database).List(ctx, ActivityFilter{InSegment: match}, 0, 20)
+			return err
+		}, `WHERE (activities.record_type = $1 AND activities.record_id IN (SELECT companies.id FROM "companies" ` +
+			`WHERE COALESCE(companies.owner_id = $2, FALSE) AND "companies"."organization_id" = $3)) AND "activities"."organization_id" = $4`,
+			[]driver.Value{models.RecordCompany, int64(4), int64(3)}},
+		{"tasks", func(database *Database) error {
+			_, _, err := NewTaskRepository(database).List(ctx, TaskFilter{InSegment: match}, 0, 20)
+			return err
+		}, `WHERE (tasks.record_type = $1 AND tasks.record_id IN (SELECT companies.id FROM "companies" ` +
+			`WHERE COALESCE(companies.owner_id = $2, FALSE) AND "companies"."organization_id" = $3)) AND "tasks"."organization_id" = $4`,
+			[]driver.Value{models.RecordCompany, int64(4), int64(3)}},
+		{"tasks by member IDs", func(database *Database) error {
+			_, _, err := NewTaskRepository(database).List(ctx, TaskFilter{InSegment: cached}, 0, 20)
+			return err
+		}, `WHERE (tasks.record_type = $1 AND tasks.record_id IN ($2,$3)) AND "tasks"."organization_id" = $4`,
+			[]driver.Value{models.RecordCompany, int64(5), int64(7)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database, fake := newFakeDatabase(t, count)
+			if err := tt.list(database); err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			// the count and the page select the members themselves, without
+			// loading them first
+			statements := fake.Statements()
+			if len(statements) != 2 {
+				t.Fatalf("ran %d statements, want the count and the page: %+v", len(statements), statements)
+			}
+			for _, statement := range statements {
+				if !strings.Contains(statement.Query, tt.where) {
+					t.Errorf("query = %s, want %s", statement.Query, tt.where)
+				}
+				if len(statement.Args) < len(tt.args) || !reflect.DeepEqual(statement.Args[:len(tt.args)], tt.args) {
+					t.Errorf("args = %#v, want them to start with %#v", statement.Args, tt.args)
+				}
+			}
+		})
+	}
+}
+
+func TestSegmentCountMembers(t *testing.T) {
+	database, fake := newFakeDatabase(t, func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"count"}, [][]driver.Value{{int64(70000)}}
+	})
+	match := SegmentMatch{RecordType: models.RecordDeal, Rule: SegmentRule{Operator: "=", Field: SegmentOwner}}
+
+	count, err := NewSegmentRepository(database).CountMembers(tenant.WithOrganization(context.Background(), 3), match)
+	if err != nil {
+		t.Fatalf("CountMembers: %v", err)
+	}
+	if count != 70000 {
+		t.Errorf("count = %d, want 70000", count)
+	}
+	want := `SELECT count(*) FROM "deals" WHERE deals.owner_id IS NULL AND "deals"."organization_id" = $1`
+	if statements := fake.Statements(); len(statements) != 1 || statements[0].Query != want {
+		t.Errorf("statements = %+v, want %s", statements, want)
+	}
+
+	_, err = NewSegmentRepository(database).CountMembers(context.Background(), match)
+	if err != ErrMissingTenant {
+		t.Errorf("CountMembers without an organization = %v, want %v", err, ErrMissingTenant)
+	}
+}
+
+func TestSegmentMembers(t *testing.T) {
+	database, fake := newFakeDatabase(t, func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id"}, [][]driver.Value{{int64(2)}, {int64(5)}}
+	})
+	match := SegmentMatch{RecordType: models.RecordDeal, Rule: SegmentRule{Operator: "=", Field: SegmentOwner}}
+
+	ids, err := NewSegmentRepository(database).Members(tenant.WithOrganization(context.Background(), 3), match, 5001)
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []int{2, 5}) {
+		t.Errorf("ids = %v, want [2 5]", ids)
+	}
+	want := `SELECT "deals"."id" FROM "deals" WHERE deals.owner_id IS NULL AND "deals"."organization_id" = $1 ORDER BY deals.id LIMIT $2`
+	if statements := fake.Statements(); len(statements) != 1 || statements[0].Query != want {
+		t.Errorf("statements = %+v, want %s", statements, want)
+	}
+}
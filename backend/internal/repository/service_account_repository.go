@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// ServiceAccountRepository defines data access operations for service accounts
+type ServiceAccountRepository interface {
+	Create(ctx context.Context, account *models.ServiceAccount) error
+	FindByID(ctx context.Context, id int) (*models.ServiceAccount, error)
+	// List returns the service accounts of the context organization
+	List(ctx context.Context) ([]models.ServiceAccount, error)
+	Delete(ctx context.Context, id int) error
+}
+
+type serviceAccountRepository struct {
+	db *gorm.DB
+}
+
+// NewServiceAccountRepository creates a new GORM-backed service account repository
+func NewServiceAccountRepository(database *Database) ServiceAccountRepository {
+	return &serviceAccountRepository{db: database.DB}
+}
+
+func (r *serviceAccountRepository) Create(ctx context.Context, account *models.ServiceAccount) error {
+	return translateError(conn(ctx, r.db).Omit("User").Create(account).Error)
+}
+
+func (r *serviceAccountRepository) FindByID(ctx context.Context, id int) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	if err := conn(ctx, r.db).Preload("User").First(&account, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &account, nil
+}
+
+func (r *serviceAccountRepository) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	var accounts []models.ServiceAccount
+	err := conn(ctx, r.db).Preload("User").Order("created_at, id").Find(&accounts).Error
+	return accounts, translateError(err)
+}
+
+func (r *serviceAccountRepository) Delete(ctx context.Context, id int) error {
+	result := conn(ctx, r.db).Delete(&models.ServiceAccount{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
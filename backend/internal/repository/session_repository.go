@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// SessionFilter narrows down a listing of sessions
+type SessionFilter struct {
+	UserID         int
+	OrganizationID int // any organization when zero
+}
+
+// SessionRepository defines data access operations for sign-in sessions
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session) error
+	FindByID(ctx context.Context, id int) (*models.Session, error)
+	FindByFamily(ctx context.Context, familyID string) (*models.Session, error)
+	// ListActive returns the sessions matching the filter that are neither
+	// revoked nor expired, most recently active first
+	ListActive(ctx context.Context, filter SessionFilter) ([]models.Session, error)
+	Update(ctx context.Context, session *models.Session) error
+	Revoke(ctx context.Context, id int) error
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+// NewSessionRepository creates a new GORM-backed session repository
+func NewSessionRepository(database *Database) SessionRepository {
+	return &sessionRepository{db: database.DB}
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session *models.Session) error {
+	return translateError(conn(ctx, r.db).Create(session).Error)
+}
+
+func (r *sessionRepository) FindByID(ctx context.Context, id int) (*models.Session, error) {
+	var session models.Session
+	if err := conn(ctx, r.db).Where("id = ?", id).First(&session).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) FindByFamily(ctx context.Context, familyID string) (*models.Session, error) {
+	var session models.Session
+	if err := conn(ctx, r.db).Where("family_id = ?", familyID).First(&session).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) ListActive(ctx context.Context, filter SessionFilter) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.filtered(ctx, filter).
+		Where("revoked_at IS NULL AND expires_at > ?", time.Now().UTC()).
+		Order("last_active_at DESC, id DESC").
+		Find(&sessions).Error
+	return sessions, translateError(err)
+}
+
+func (r *sessionRepository) Update(ctx context.Context, session *models.Session) error {
+	return translateError(conn(ctx, r.db).Save(session).Error)
+}
+
+func (r *sessionRepository) Revoke(ctx context.Context, id int) error {
+	return translateError(conn(ctx, r.db).
+		Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now().UTC()).Error)
+}
+
+// filtered starts a query for the sessions matching the filter
+func (r *sessionRepository) filtered(ctx context.Context, filter SessionFilter) *gorm.DB {
+	query := conn(ctx, r.db).Model(&models.Session{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.OrganizationID != 0 {
+		query = query.Where("organization_id = ?", filter.OrganizationID)
+	}
+	return query
+}
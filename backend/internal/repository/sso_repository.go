@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// SSORepository defines data access operations for single sign-on identities
+// and the sign-ins in progress
+type SSORepository interface {
+	FindIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	// SaveIdentity creates or updates an identity
+	SaveIdentity(ctx context.Context, identity *models.UserIdentity) error
+
+	CreateAttempt(ctx context.Context, attempt *models.SSOLoginAttempt) error
+	FindAttempt(ctx context.Context, stateHash string) (*models.SSOLoginAttempt, error)
+	// UseAttempt marks an unused attempt as used and reports whether it was still unused
+	UseAttempt(ctx context.Context, id int) (bool, error)
+	// DeleteExpiredAttempts removes attempts that expired before the cutoff
+	DeleteExpiredAttempts(ctx context.Context, cutoff time.Time) error
+}
+
+type ssoRepository struct {
+	db *gorm.DB
+}
+
+// NewSSORepository creates a new GORM-backed single sign-on repository
+func NewSSORepository(database *Database) SSORepository {
+	return &ssoRepository{db: database.DB}
+}
+
+func (r *ssoRepository) FindIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := conn(ctx, r.db).
+		Where("provider = ? AND subject = ?", provider, subject).
+		First(&identity).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &identity, nil
+}
+
+func (r *ssoRepository) SaveIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	return translateError(conn(ctx, r.db).Save(identity).Error)
+}
+
+func (r *ssoRepository) CreateAttempt(ctx context.Context, attempt *models.SSOLoginAttempt) error {
+	return translateError(conn(ctx, r.db).Create(attempt).Error)
+}
+
+func (r *ssoRepository) FindAttempt(ctx context.Context, stateHash string) (*models.SSOLoginAttempt, error) {
+	var attempt models.SSOLoginAttempt
+	if err := conn(ctx, r.db).Where("state_hash = ?", stateHash).First(&attempt).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &attempt, nil
+}
+
+func (r *ssoRepository) UseAttempt(ctx context.Context, id int) (bool, error) {
+	result := conn(ctx, r.db).
+		Model(&models.SSOLoginAttempt{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now().UTC())
+	if result.Error != nil {
+		return false, translateError(result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *ssoRepository) DeleteExpiredAttempts(ctx context.Context, cutoff time.Time) error {
+	return translateError(conn(ctx, r.db).
+		Where("expires_at < ?", cutoff).
+		Delete(&models.SSOLoginAttempt{}).Error)
+}
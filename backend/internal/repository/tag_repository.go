@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tagBatchSize bounds the number of taggings inserted per statement
+const tagBatchSize = 1000
+
+// TagCount is a tag in use and the number of records carrying it
+type TagCount struct {
+	Name  string
+	Count int64
+}
+
+// TagRepository defines data access operations for the tags of many records
+// at once. The tags of a single record are saved with the record.
+type TagRepository interface {
+	// List returns the context organization's tags on records of a type, or
+	// of every type when recordType is empty, in name order
+	List(ctx context.Context, recordType string) ([]TagCount, error)
+	// Add tags records with every name they do not carry yet and returns the
+	// number of tags added
+	Add(ctx context.Context, recordType string, recordIDs []int, names []string) (int64, error)
+	// Remove removes the named tags from records and returns the number of
+	// tags removed
+	Remove(ctx context.Context, recordType string, recordIDs []int, names []string) (int64, error)
+}
+
+type tagRepository struct {
+	db *gorm.DB
+}
+
+// NewTagRepository creates a new GORM-backed tag repository
+func NewTagRepository(database *Database) TagRepository {
+	return &tagRepository{db: database.DB}
+}
+
+func (r *tagRepository) List(ctx context.Context, recordType string) ([]TagCount, error) {
+	query := conn(ctx, r.db).Model(&models.Tagging{})
+	if recordType != "" {
+		query = query.Where("record_type = ?", recordType)
+	}
+	var tags []TagCount
+	err := query.Select("name, COUNT(*) AS count").Group("name").Order("name").Scan(&tags).Error
+	return tags, translateError(err)
+}
+
+func (r *tagRepository) Add(ctx context.Context, recordType string, recordIDs []int, names []string) (int64, error) {
+	taggings := make([]models.Tagging, 0, len(recordIDs)*len(names))
+	for _, recordID := range recordIDs {
+		for _, name := range names {
+			taggings = append(taggings, models.Tagging{RecordType: recordType, RecordID: recordID, Name: name})
+		}
+	}
+	if len(taggings) == 0 {
+		return 0, nil
+	}
+
+	result := conn(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&taggings, tagBatchSize)
+	return result.RowsAffected, translateError(result.Error)
+}
+
+func (r *tagRepository) Remove(ctx context.Context, recordType string, recordIDs []int, names []string) (int64, error) {
+	if len(recordIDs) == 0 || len(names) == 0 {
+		return 0, nil
+	}
+	result := conn(ctx, r.db).
+		Where("record_type = ? AND record_id IN ? AND name IN ?", recordType, recordIDs, names).
+		Delete(&models.Tagging{})
+	return result.RowsAffected, translateError(result.Error)
+}
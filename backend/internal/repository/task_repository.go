@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/listquery"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TaskFilter narrows down and orders a listing of tasks
+type TaskFilter struct {
+	AssigneeID int
+	Status     string
+	Priority   string
+	RecordType string
+	RecordID   int
+	Segment    int              // a segment, resolved into InSegment by the service
+	InSegment  *SegmentMatch    // when set, only tasks about the members of the segment
+	Pending    bool             // only tasks that are open or in progress
+	DueFrom    *time.Time       // only tasks due at or after this time
+	DueBefore  *time.Time       // only tasks due before this time
+	Filters    *listquery.Query // conditions on and sorts by TaskFields
+}
+
+// TaskFields lists the fields tasks can be filtered on with filter[...] and sorted by
+var TaskFields = &listquery.Schema{Fields: map[string]listquery.Field{
+	"title":          {Column: "tasks.title", Type: listquery.String},
+	"status":         {Column: "tasks.status", Type: listquery.String},
+	"priority":       {Column: "tasks.priority", Type: listquery.String},
+	"assignee_id":    {Column: "tasks.assignee_id", Type: listquery.Int},
+	"created_by_id":  {Column: "tasks.created_by_id", Type: listquery.Int},
+	"record_type":    {Column: "tasks.record_type", Type: listquery.String},
+	"record_id":      {Column: "tasks.record_id", Type: listquery.Int},
+	"due_at":         {Column: "tasks.due_at", Type: listquery.Time, Sortable: true},
+	"remind_at":      {Column: "tasks.remind_at", Type: listquery.Time},
+	"completed_at":   {Column: "tasks.completed_at", Type: listquery.Time},
+	"created_at":     {Column: "tasks.created_at", Type: listquery.Time, Sortable: true},
+	"updated_at":     {Column: "tasks.updated_at", Type: listquery.Time, Sortable: true},
+	"assignee.email": {Column: "users.email", Type: listquery.String, Through: "SELECT 1 FROM users WHERE users.id = tasks.assignee_id"},
+}}
+
+// TaskRepository defines data access operations for tasks
+type TaskRepository interface {
+	Create(ctx context.Context, task *models.Task) error
+	FindByID(ctx context.Context, id int) (*models.Task, error)
+	// List returns a page of the context organization's tasks together with
+	// the number of tasks matching the filter
+	List(ctx context.Context, filter TaskFilter, offset, limit int) ([]models.Task, int64, error)
+	Update(ctx context.Context, task *models.Task) error
+	Delete(ctx context.Context, id int) error
+	// ListDueReminders returns up to limit pending, assigned tasks whose
+	// reminder is due at now and has not been sent, by reminder time or, for
+	// tasks without one, due date. Those are reminded lead before they are due.
+	ListDueReminders(ctx context.Context, now time.Time, lead time.Duration, limit int) ([]models.Task, error)
+	// MarkReminded records that the reminder of a task was sent, reporting
+	// false when another worker had already claimed it
+	MarkReminded(ctx context.Context, id int, at time.Time) (bool, error)
+}
+
+type taskRepository struct {
+	db *gorm.DB
+}
+
+// NewTaskRepository creates a new GORM-backed task repository
+func NewTaskRepository(database *Database) TaskRepository {
+	return &taskRepository{db: database.DB}
+}
+
+// preload loads the associations of tasks
+func (r *taskRepository) preload(db *gorm.DB) *gorm.DB {
+	return db.Preload("Assignee").Preload("CreatedBy")
+}
+
+func (r *taskRepository) Create(ctx context.Context, task *models.Task) error {
+	return translateError(conn(ctx, r.db).Omit(clause.Associations).Create(task).Error)
+}
+
+func (r *taskRepository) FindByID(ctx context.Context, id int) (*models.Task, error) {
+	var task models.Task
+	if err := r.preload(conn(ctx, r.db)).First(&task, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &task, nil
+}
+
+func (r *taskRepository) List(ctx context.Context, filter TaskFilter, offset, limit int) ([]models.Task, int64, error) {
+	query := conn(ctx, r.db).Model(&models.Task{})
+	if filter.AssigneeID != 0 {
+		query = query.Where("tasks.assignee_id = ?", filter.AssigneeID)
+	}
+	if filter.Status != "" {
+		query = query.Where("tasks.status = ?", filter.Status)
+	}
+	if filter.Priority != "" {
+		query = query.Where("tasks.priority = ?", filter.Priority)
+	}
+	if filter.RecordType != "" {
+		query = query.Where("tasks.record_type = ?", filter.RecordType)
+	}
+	if filter.RecordID != 0 {
+		query = query.Where("tasks.record_id = ?", filter.RecordID)
+	}
+	if filter.InSegment != nil {
+		query = filter.InSegment.whereAbout(query, "tasks")
+	}
+	if filter.Pending {
+		query = query.Where("tasks.status IN ?", []string{models.TaskOpen, models.TaskInProgress})
+	}
+	if filter.DueFrom != nil {
+		query = query.Where("tasks.due_at >= ?", *filter.DueFrom)
+	}
+	if filter.DueBefore != nil {
+		query = query.Where("tasks.due_at < ?", *filter.DueBefore)
+	}
+	query = filter.Filters.Where(query)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, translateError(err)
+	}
+
+	var tasks []models.Task
+	err := orderRecords(r.preload(query), "tasks", nil, filter.Filters, "tasks.created_at DESC").Order("tasks.id").
+		Offset(offset).Limit(limit).Find(&tasks).Error
+	return tasks, total, translateError(err)
+}
+
+func (r *taskRepository) Update(ctx context.Context, task *models.Task) error {
+	return translateError(conn(ctx, r.db).Omit(clause.Associations).Save(task).Error)
+}
+
+func (r *taskRepository) Delete(ctx context.Context, id int) error {
+	result := conn(ctx, r.db).Delete(&models.Task{}, id)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *taskRepository) ListDueReminders(ctx context.Context, now time.Time, lead time.Duration, limit int) ([]models.Task, error) {
+	// due_at is compared with now plus the lead to keep interval arithmetic,
+	// which differs between databases, out of the query
+	var tasks []models.Task
+	err := conn(ctx, r.db).Preload("Assignee").
+		Where("reminded_at IS NULL AND assignee_id IS NOT NULL AND status IN ?", []string{models.TaskOpen, models.TaskInProgress}).
+		Where("(remind_at IS NOT NULL AND remind_at <= ?) OR (remind_at IS NULL AND due_at <= ?)", now, now.Add(lead)).
+		Order("COALESCE(remind_at, due_at), id").
+		Limit(limit).Find(&tasks).Error
+	return tasks, translateError(err)
+}
+
+func (r *taskRepository) MarkReminded(ctx context.Context, id int, at time.Time) (bool, error) {
+	result := conn(ctx, r.db).Model(&models.Task{}).Where("id = ? AND reminded_at IS NULL", id).UpdateColumn("reminded_at", at)
+	if result.Error != nil {
+		return false, translateError(result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/listquery"
+)
+
+func TestTaskListingQuery(t *testing.T) {
+	ctx := tenant.WithOrganization(context.Background(), 3)
+	count := func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "SELECT count(*)") {
+			return []string{"count"}, [][]driver.Value{{int64(1)}}
+		}
+		return nil, nil
+	}
+	query, err := TaskFields.Parse(url.Values{"sort": {"-updated_at"}, "filter[assignee.email]": {"ada@example.com"}})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter TaskFilter
+		where  string
+		order  string
+	}{
+		{"newest first by default", TaskFilter{Status: "open"},
+			"WHERE tasks.status = $1", "ORDER BY tasks.created_at DESC,tasks.id LIMIT"},
+		{"filters and sorts of the query", TaskFilter{Filters: query},
+			"WHERE (EXISTS (SELECT 1 FROM users WHERE users.id = tasks.assignee_id AND users.email = $1))", "ORDER BY tasks.updated_at DESC,tasks.id LIMIT"},
+		{"order chosen by the service", TaskFilter{Pending: true, Filters: TaskFields.Sorted(listquery.Sort{Field: "due_at"})},
+			"WHERE tasks.status IN ($1,$2)", "ORDER BY tasks.due_at,tasks.id LIMIT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database, fake := newFakeDatabase(t, count)
+			if _, _, err := NewTaskRepository(database).List(ctx, tt.filter, 0, 20); err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			statements := fake.Statements()
+			if len(statements) != 2 || !strings.Contains(statements[1].Query, tt.where) || !strings.Contains(statements[1].Query, tt.order) {
+				t.Fatalf("statements = %+v, want a page %s %s", statements, tt.where, tt.order)
+			}
+		})
+	}
+}
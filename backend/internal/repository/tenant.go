@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrMissingTenant is returned when a tenant-owned model is accessed without an organization in the context
+var ErrMissingTenant = errors.New("no organization in context")
+
+var tenantedType = reflect.TypeOf((*models.Tenanted)(nil)).Elem()
+
+// registerTenantScope installs callbacks that scope every query on a
+// models.Tenanted model to the organization found in the statement context.
+// Reads, updates and deletes get an organization_id condition and creates
+// have the organization stamped on the new rows, so repository code cannot
+// accidentally reach across tenants. Contexts marked with tenant.Unscoped
+// bypass the scope.
+func registerTenantScope(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("tenant:create", stampTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("tenant:query", scopeTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenant:update", scopeTenant); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("tenant:delete", scopeTenant); err != nil {
+		return err
+	}
+	return callbacks.Row().Before("gorm:row").Register("tenant:row", scopeTenant)
+}
+
+// isTenanted reports whether the statement operates on a tenant-owned model
+func isTenanted(db *gorm.DB) bool {
+	if db.Statement.Schema == nil {
+		return false
+	}
+	return reflect.PointerTo(db.Statement.Schema.ModelType).Implements(tenantedType)
+}
+
+// scopeTenant restricts a statement to the context's organization
+func scopeTenant(db *gorm.DB) {
+	if db.Error != nil || !isTenanted(db) || tenant.IsUnscoped(db.Statement.Context) {
+		return
+	}
+
+	organizationID, ok := tenant.OrganizationID(db.Statement.Context)
+	if !ok {
+		_ = db.AddError(ErrMissingTenant)
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: "organization_id"},
+			Value:  organizationID,
+		},
+	}})
+}
+
+// stampTenant assigns the context's organization to rows being created
+func stampTenant(db *gorm.DB) {
+	if db.Error != nil || !isTenanted(db) || tenant.IsUnscoped(db.Statement.Context) {
+		return
+	}
+
+	organizationID, ok := tenant.OrganizationID(db.Statement.Context)
+	if !ok {
+		_ = db.AddError(ErrMissingTenant)
+		return
+	}
+
+	stamp := func(rv reflect.Value) {
+		if rv.Kind() != reflect.Pointer {
+			rv = rv.Addr()
+		}
+		if record, ok := rv.Interface().(models.Tenanted); ok {
+			record.SetOrganizationID(organizationID)
+		}
+	}
+
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			stamp(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		stamp(rv)
+	}
+}
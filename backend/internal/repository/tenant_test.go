@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+)
+
+const testOrganizationID = 3
+
+// answerWrites reports one affected row for statements that do not return rows
+// and answers queries with no rows
+func answerWrites(query string, _ []driver.Value) ([]string, [][]driver.Value) {
+	if strings.HasPrefix(query, "SELECT") {
+		return nil, nil
+	}
+	return nil, [][]driver.Value{{}}
+}
+
+// scopedTo reports whether a statement is restricted to an organization
+func scopedTo(statement fakeStatement, organizationID int64) bool {
+	if !strings.Contains(statement.Query, `"memberships"."organization_id" = `) {
+		return false
+	}
+	for _, arg := range statement.Args {
+		if arg == organizationID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTenantScope(t *testing.T) {
+	scoped := tenant.WithOrganization(context.Background(), testOrganizationID)
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		run    func(ctx context.Context, repo OrganizationRepository) error
+		err    error
+		scoped bool
+	}{
+		{
+			name: "query",
+			ctx:  scoped,
+			run: func(ctx context.Context, repo OrganizationRepository) error {
+				_, err := repo.ListMembers(ctx)
+				return err
+			},
+			scoped: true,
+		},
+		{
+			name: "update",
+			ctx:  scoped,
+			run: func(ctx context.Context, repo OrganizationRepository) error {
+				return repo.UpdateMember(ctx, &models.Membership{ID: 1, OrganizationID: testOrganizationID, UserID: 1, Role: models.RoleUser})
+			},
+			scoped: true,
+		},
+		{
+			name: "delete",
+			ctx:  scoped,
+			run: func(ctx context.Context, repo OrganizationRepository) error {
+				return repo.RemoveMember(ctx, 1)
+			},
+			scoped: true,
+		},
+		{
+			name: "query without an organization",
+			ctx:  context.Background(),
+			run: func(ctx context.Context, repo OrganizationRepository) error {
+				_, err := repo.ListMembers(ctx)
+				return err
+			},
+			err: ErrMissingTenant,
+		},
+		{
+			name: "delete without an organization",
+			ctx:  context.Background(),
+			run: func(ctx context.Context, repo OrganizationRepository) error {
+				return repo.RemoveMember(ctx, 1)
+			},
+			err: ErrMissingTenant,
+		},
+		{
+			name: "unscoped query",
+			ctx:  tenant.Unscoped(scoped),
+			run: func(ctx context.Context, repo OrganizationRepository) error {
+				_, err := repo.ListMembers(ctx)
+				return err
+			},
+		},
+		{
+			name: "model without a tenant",
+			ctx:  context.Background(),
+			run: func(ctx context.Context, repo OrganizationRepository) error {
+				if _, err := repo.FindByID(ctx, testOrganizationID); !errors.Is(err, ErrNotFound) {
+					return err
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database, fake := newFakeDatabase(t, answerWrites)
+			repo := NewOrganizationRepository(database)
+
+			if err := tt.run(tt.ctx, repo); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			statements := fake.Statements()
+			if tt.err != nil {
+				if len(statements) != 0 {
+					t.Errorf("ran %q without an organization", statements[0].Query)
+				}
+				return
+			}
+			if len(statements) != 1 {
+				t.Fatalf("ran %d statements, want 1", len(statements))
+			}
+			if got := scopedTo(statements[0], testOrganizationID); got != tt.scoped {
+				t.Errorf("scoped = %v, want %v: %q %v", got, tt.scoped, statements[0].Query, statements[0].Args)
+			}
+		})
+	}
+}
+
+func TestTenantScopeStampsCreates(t *testing.T) {
+	scoped := tenant.WithOrganization(context.Background(), testOrganizationID)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want int
+	}{
+		{"organization from the context", scoped, nil, testOrganizationID},
+		{"unscoped keeps the given organization", tenant.Unscoped(scoped), nil, 7},
+		{"no organization", context.Background(), ErrMissingTenant, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database, fake := newFakeDatabase(t, answerWrites)
+			membership := &models.Membership{OrganizationID: 7, UserID: 1, Role: models.RoleUser}
+
+			if err := NewOrganizationRepository(database).AddMember(tt.ctx, membership); !errors.Is(err, tt.err) {
+				t.Fatalf("AddMember = %v, want %v", err, tt.err)
+			}
+			if membership.OrganizationID != tt.want {
+				t.Errorf("organization = %d, want %d", membership.OrganizationID, tt.want)
+			}
+			if tt.err != nil {
+				if statements := fake.Statements(); len(statements) != 0 {
+					t.Errorf("ran %q without an organization", statements[0].Query)
+				}
+				return
+			}
+			statements := fake.Statements()
+			if len(statements) != 1 || !strings.HasPrefix(statements[0].Query, `INSERT INTO "memberships"`) {
+				t.Fatalf("statements = %v, want one insert", statements)
+			}
+			if statements[0].Args[0] != int64(tt.want) {
+				t.Errorf("inserted organization = %v, want %d", statements[0].Args[0], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// UserRepository defines data access operations for users
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) error
+	FindByID(ctx context.Context, id int) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	Update(ctx context.Context, user *models.User) error
+}
+
+type userRepository struct {
+	db *gorm.DB
+}
+
+// NewUserRepository creates a new GORM-backed user repository
+func NewUserRepository(database *Database) UserRepository {
+	return &userRepository{db: database.DB}
+}
+
+func (r *userRepository) Create(ctx context.Context, user *models.User) error {
+	return translateError(conn(ctx, r.db).Create(user).Error)
+}
+
+func (r *userRepository) FindByID(ctx context.Context, id int) (*models.User, error) {
+	var user models.User
+	if err := conn(ctx, r.db).First(&user, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := conn(ctx, r.db).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) Update(ctx context.Context, user *models.User) error {
+	return translateError(conn(ctx, r.db).Save(user).Error)
+}
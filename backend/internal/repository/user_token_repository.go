@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// UserTokenRepository defines data access operations for emailed user tokens
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *models.UserToken) error
+	FindByHash(ctx context.Context, purpose, hash string) (*models.UserToken, error)
+	// Use marks an unused token as used and reports whether it was still unused
+	Use(ctx context.Context, id int) (bool, error)
+	// InvalidateForUser marks every unused token of the user for the purpose as used
+	InvalidateForUser(ctx context.Context, userID int, purpose string) error
+}
+
+type userTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewUserTokenRepository creates a new GORM-backed user token repository
+func NewUserTokenRepository(database *Database) UserTokenRepository {
+	return &userTokenRepository{db: database.DB}
+}
+
+func (r *userTokenRepository) Create(ctx context.Context, token *models.UserToken) error {
+	return translateError(conn(ctx, r.db).Create(token).Error)
+}
+
+func (r *userTokenRepository) FindByHash(ctx context.Context, purpose, hash string) (*models.UserToken, error) {
+	var token models.UserToken
+	err := conn(ctx, r.db).
+		Where("purpose = ? AND token_hash = ?", purpose, hash).
+		First(&token).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+func (r *userTokenRepository) Use(ctx context.Context, id int) (bool, error) {
+	result := conn(ctx, r.db).
+		Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now().UTC())
+	if result.Error != nil {
+		return false, translateError(result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *userTokenRepository) InvalidateForUser(ctx context.Context, userID int, purpose string) error {
+	return translateError(conn(ctx, r.db).
+		Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now().UTC()).Error)
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/mailer"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidResetToken        = errors.New("invalid or expired password reset token")
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+)
+
+// AccountService handles password resets and email verification. Both flows
+// email the user a single-use token that expires.
+type AccountService struct {
+	users           repository.UserRepository
+	userTokens      repository.UserTokenRepository
+	transactor      repository.Transactor
+	authService     *AuthService
+	mailer          mailer.Mailer
+	resetTTL        time.Duration
+	verificationTTL time.Duration
+	appURL          string
+	logger          *zap.SugaredLogger
+}
+
+// NewAccountService creates a new account service. Password reset tokens
+// expire after resetTTL and email verification tokens after verificationTTL;
+// links in the emails point to appURL.
+func NewAccountService(
+	users repository.UserRepository,
+	userTokens repository.UserTokenRepository,
+	transactor repository.Transactor,
+	authService *AuthService,
+	mailer mailer.Mailer,
+	resetTTL time.Duration,
+	verificationTTL time.Duration,
+	appURL string,
+	logger *zap.SugaredLogger,
+) *AccountService {
+	return &AccountService{
+		users:           users,
+		userTokens:      userTokens,
+		transactor:      transactor,
+		authService:     authService,
+		mailer:          mailer,
+		resetTTL:        resetTTL,
+		verificationTTL: verificationTTL,
+		appURL:          appURL,
+		logger:          logger,
+	}
+}
+
+// RequestPasswordReset emails a password reset link to the address if it
+// belongs to a user. It succeeds either way, so that callers cannot find out
+// which addresses are registered.
+func (s *AccountService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.users.FindByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			s.logger.Debugw("Password reset requested for unknown email")
+			return nil
+		}
+		return err
+	}
+	if user.ServiceAccount {
+		return nil
+	}
+
+	token, err := s.issue(ctx, user.ID, models.UserTokenPasswordReset, s.resetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.appURL + "/reset-password?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of your account.\n\n"+
+				"Choose a new password:\n%s\n\n"+
+				"This link expires in %s and can be used once. If you did not ask for it, you can ignore this email.\n",
+			link,
+			formatDuration(s.resetTTL),
+		),
+	})
+}
+
+// ResetPassword sets a new password with a password reset token and signs
+// the user out of every session. Following the emailed link also proves the
+// user owns the address, so it is marked as verified.
+func (s *AccountService) ResetPassword(ctx context.Context, token, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	var user *models.User
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = s.consume(ctx, models.UserTokenPasswordReset, token, ErrInvalidResetToken)
+		if err != nil {
+			return err
+		}
+		if err := s.userTokens.InvalidateForUser(ctx, user.ID, models.UserTokenPasswordReset); err != nil {
+			return err
+		}
+
+		user.Password = hash
+		if user.EmailVerifiedAt == nil {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+		}
+		return s.users.Update(ctx, user)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Infow("Password reset", "user_id", user.ID)
+	return s.authService.LogoutEverywhere(ctx, user.ID)
+}
+
+// RequestEmailVerification emails a verification link to the address if it
+// belongs to a user who has not verified it yet. Like RequestPasswordReset it
+// does not reveal whether the address is registered.
+func (s *AccountService) RequestEmailVerification(ctx context.Context, email string) error {
+	user, err := s.users.FindByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			s.logger.Debugw("Email verification requested for unknown email")
+			return nil
+		}
+		return err
+	}
+	return s.SendEmailVerification(ctx, user)
+}
+
+// SendEmailVerification emails the user a link to verify their address,
+// unless they already did or are a service account
+func (s *AccountService) SendEmailVerification(ctx context.Context, user *models.User) error {
+	if user.EmailVerified() || user.ServiceAccount {
+		return nil
+	}
+
+	token, err := s.issue(ctx, user.ID, models.UserTokenEmailVerification, s.verificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.appURL + "/verify-email?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Confirm that this is your email address:\n%s\n\n"+
+				"This link expires in %s. If you did not create an account, you can ignore this email.\n",
+			link,
+			formatDuration(s.verificationTTL),
+		),
+	})
+}
+
+// VerifyEmail marks the user's email address as verified with a verification token
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	return s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		user, err := s.consume(ctx, models.UserTokenEmailVerification, token, ErrInvalidVerificationToken)
+		if err != nil {
+			return err
+		}
+		if err := s.userTokens.InvalidateForUser(ctx, user.ID, models.UserTokenEmailVerification); err != nil {
+			return err
+		}
+		if user.EmailVerified() {
+			return nil
+		}
+
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		if err := s.users.Update(ctx, user); err != nil {
+			return err
+		}
+
+		s.logger.Infow("Email verified", "user_id", user.ID)
+		return nil
+	})
+}
+
+// issue creates a token for the purpose and returns its plain value, which
+// is only ever sent to the user. Earlier tokens for the same purpose stop
+// working, so only the most recent email is valid.
+func (s *AccountService) issue(ctx context.Context, userID int, purpose string, ttl time.Duration) (string, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userTokens.InvalidateForUser(ctx, userID, purpose); err != nil {
+			return err
+		}
+		return s.userTokens.Create(ctx, &models.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(ttl),
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consume marks a usable token as used and loads the user it was issued to.
+// invalid is returned when the token is unknown, used or expired.
+func (s *AccountService) consume(ctx context.Context, purpose, token string, invalid error) (*models.User, error) {
+	stored, err := s.userTokens.FindByHash(ctx, purpose, utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, invalid
+		}
+		return nil, err
+	}
+	if !stored.Usable() {
+		return nil, invalid
+	}
+
+	used, err := s.userTokens.Use(ctx, stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, invalid
+	}
+
+	user, err := s.users.FindByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, invalid
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// formatDuration describes a token lifetime in whole hours or minutes
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return pluralize(int(d/time.Hour), "hour")
+	default:
+		return pluralize(int(d/time.Minute), "minute")
+	}
+}
+
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/mailer"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// emailedToken finds the token in the links of emailed messages
+var emailedToken = regexp.MustCompile(`\?token=(\S+)`)
+
+// accountFixture holds the AccountService under test and its repositories
+type accountFixture struct {
+	*authFixture
+	userTokens *repotest.UserTokens
+	mail       *bytes.Buffer
+	accounts   *AccountService
+}
+
+// newAccountFixture returns an AccountService for the test user holding the
+// given user tokens. The user has a refresh token "session".
+func newAccountFixture(tokens ...models.UserToken) *accountFixture {
+	fixture := &accountFixture{
+		authFixture: newAuthFixture(activeToken("session", "session")),
+		userTokens:  repotest.NewUserTokens(tokens...),
+		mail:        &bytes.Buffer{},
+	}
+	fixture.accounts = NewAccountService(
+		fixture.users, fixture.userTokens, repotest.Transactor{}, fixture.service(),
+		mailer.NewWriterMailer("crm@example.com", fixture.mail),
+		time.Hour, 24*time.Hour, "https://crm.example.com", zap.NewNop().Sugar(),
+	)
+	return fixture
+}
+
+// lastToken returns the token of the last emailed link
+func (f *accountFixture) lastToken(t *testing.T) string {
+	t.Helper()
+	matches := emailedToken.FindAllStringSubmatch(f.mail.String(), -1)
+	if len(matches) == 0 {
+		t.Fatalf("no token was emailed:\n%s", f.mail.String())
+	}
+	token, err := url.QueryUnescape(matches[len(matches)-1][1])
+	if err != nil {
+		t.Fatalf("QueryUnescape: %v", err)
+	}
+	return token
+}
+
+// userToken returns a stored token of the test user with the plain value "token"
+func userToken(purpose string, change func(token *models.UserToken)) models.UserToken {
+	token := models.UserToken{
+		ID:        1,
+		UserID:    testUser.ID,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken("token"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if change != nil {
+		change(&token)
+	}
+	return token
+}
+
+// userTokenCases are the stored tokens the password reset and email
+// verification flows must accept or reject
+func userTokenCases(purpose, otherPurpose string) []struct {
+	name  string
+	token models.UserToken
+	valid bool
+} {
+	used := time.Now().Add(-time.Minute)
+	return []struct {
+		name  string
+		token models.UserToken
+		valid bool
+	}{
+		{"usable token", userToken(purpose, nil), true},
+		{"expired token", userToken(purpose, func(token *models.UserToken) { token.ExpiresAt = time.Now().Add(-time.Second) }), false},
+		{"used token", userToken(purpose, func(token *models.UserToken) { token.UsedAt = &used }), false},
+		{"token issued for another purpose", userToken(otherPurpose, nil), false},
+		{"token of a deleted user", userToken(purpose, func(token *models.UserToken) { token.UserID = 42 }), false},
+	}
+}
+
+func TestAccountServiceResetPassword(t *testing.T) {
+	for _, tt := range userTokenCases(models.UserTokenPasswordReset, models.UserTokenEmailVerification) {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := newAccountFixture(tt.token)
+
+			err := fixture.accounts.ResetPassword(context.Background(), "token", "a new password")
+			if tt.valid != (err == nil) || (err != nil && !errors.Is(err, ErrInvalidResetToken)) {
+				t.Fatalf("ResetPassword = %v, want valid %v", err, tt.valid)
+			}
+
+			user, err := fixture.users.FindByID(context.Background(), testUser.ID)
+			if err != nil {
+				t.Fatalf("FindByID: %v", err)
+			}
+			if checkPassword(user.Password, "a new password") != tt.valid || user.EmailVerified() != tt.valid {
+				t.Errorf("password changed and email verified = %v, %v, want %v",
+					checkPassword(user.Password, "a new password"), user.EmailVerified(), tt.valid)
+			}
+			session, err := fixture.refreshTokens.FindByID(context.Background(), "session")
+			if err != nil {
+				t.Fatalf("FindByID: %v", err)
+			}
+			if (session.RevokedAt != nil) != tt.valid {
+				t.Errorf("session revoked = %v, want %v", session.RevokedAt != nil, tt.valid)
+			}
+		})
+	}
+}
+
+func TestAccountServiceVerifyEmail(t *testing.T) {
+	for _, tt := range userTokenCases(models.UserTokenEmailVerification, models.UserTokenPasswordReset) {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := newAccountFixture(tt.token)
+
+			err := fixture.accounts.VerifyEmail(context.Background(), "token")
+			if tt.valid != (err == nil) || (err != nil && !errors.Is(err, ErrInvalidVerificationToken)) {
+				t.Fatalf("VerifyEmail = %v, want valid %v", err, tt.valid)
+			}
+
+			user, err := fixture.users.FindByID(context.Background(), testUser.ID)
+			if err != nil {
+				t.Fatalf("FindByID: %v", err)
+			}
+			if user.EmailVerified() != tt.valid {
+				t.Errorf("email verified = %v, want %v", user.EmailVerified(), tt.valid)
+			}
+		})
+	}
+}
+
+func TestAccountServiceTokensAreSingleUse(t *testing.T) {
+	tests := []struct {
+		name    string
+		request func(ctx context.Context, service *AccountService) error
+		use     func(ctx context.Context, service *AccountService, token string) error
+		invalid error
+	}{
+		{
+			name: "password reset",
+			request: func(ctx context.Context, service *AccountService) error {
+				return service.RequestPasswordReset(ctx, " ADA@example.com")
+			},
+			use: func(ctx context.Context, service *AccountService, token string) error {
+				return service.ResetPassword(ctx, token, "a new password")
+			},
+			invalid: ErrInvalidResetToken,
+		},
+		{
+			name: "email verification",
+			request: func(ctx context.Context, service *AccountService) error {
+				return service.RequestEmailVerification(ctx, testUser.Email)
+			},
+			use: func(ctx context.Context, service *AccountService, token string) error {
+				return service.VerifyEmail(ctx, token)
+			},
+			invalid: ErrInvalidVerificationToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := newAccountFixture()
+			ctx := context.Background()
+
+			if err := tt.request(ctx, fixture.accounts); err != nil {
+				t.Fatalf("first request: %v", err)
+			}
+			first := fixture.lastToken(t)
+			if err := tt.request(ctx, fixture.accounts); err != nil {
+				t.Fatalf("second request: %v", err)
+			}
+			second := fixture.lastToken(t)
+
+			// only the most recently emailed token works, and only once
+			if err := tt.use(ctx, fixture.accounts, first); !errors.Is(err, tt.invalid) {
+				t.Errorf("earlier token = %v, want %v", err, tt.invalid)
+			}
+			if err := tt.use(ctx, fixture.accounts, second); err != nil {
+				t.Fatalf("latest token: %v", err)
+			}
+			if err := tt.use(ctx, fixture.accounts, second); !errors.Is(err, tt.invalid) {
+				t.Errorf("reused token = %v, want %v", err, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestAccountServiceRequestsDoNotRevealAccounts(t *testing.T) {
+	fixture := newAccountFixture()
+
+	if err := fixture.accounts.RequestPasswordReset(context.Background(), "nobody@example.com"); err != nil {
+		t.Errorf("RequestPasswordReset: %v", err)
+	}
+	if err := fixture.accounts.RequestEmailVerification(context.Background(), "nobody@example.com"); err != nil {
+		t.Errorf("RequestEmailVerification: %v", err)
+	}
+	if fixture.mail.Len() != 0 {
+		t.Errorf("emailed an unknown address:\n%s", fixture.mail.String())
+	}
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidRecord   = errors.New("record not found")
+	ErrTimelineTooDeep = errors.New("timeline can only be paged through its first 1000 entries")
+)
+
+// maxTimelineEntries bounds how far a timeline can be paged, as every page
+// reads all the entries before it from both of its sources
+const maxTimelineEntries = 1000
+
+// ActivityInput holds the data of an activity to create or replace. Without
+// OccurredAt a new activity is taken to happen when it is created, and an
+// existing one keeps its time.
+type ActivityInput struct {
+	Type       string
+	RecordType string
+	RecordID   int
+	Subject    string
+	Body       string
+	OccurredAt *time.Time
+	Duration   time.Duration
+	Outcome    string
+}
+
+// TimelineEntry is an event in the timeline of a record: either an activity
+// logged against it or a change of stage of one of its deals
+type TimelineEntry struct {
+	At          time.Time
+	Activity    *models.Activity
+	StageChange *models.DealStageChange
+}
+
+// ActivityService manages the activities logged against CRM records and
+// builds the timelines of those records
+type ActivityService struct {
+	activities repository.ActivityRepository
+	contacts   repository.ContactRepository
+	companies  repository.CompanyRepository
+	deals      repository.DealRepository
+	segments   *SegmentService
+	logger     *zap.SugaredLogger
+}
+
+// NewActivityService creates a new activity service
+func NewActivityService(
+	activities repository.ActivityRepository,
+	contacts repository.ContactRepository,
+	companies repository.CompanyRepository,
+	deals repository.DealRepository,
+	segments *SegmentService,
+	logger *zap.SugaredLogger,
+) *ActivityService {
+	return &ActivityService{
+		activities: activities,
+		contacts:   contacts,
+		companies:  companies,
+		deals:      deals,
+		segments:   segments,
+		logger:     logger,
+	}
+}
+
+// Create logs an activity against a record of the context organization
+func (s *ActivityService) Create(ctx context.Context, authorID int, input ActivityInput) (*models.Activity, error) {
+	activity := &models.Activity{AuthorID: &authorID}
+	if err := s.apply(ctx, activity, input); err != nil {
+		return nil, err
+	}
+	if err := s.activities.Create(ctx, activity); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("Activity created", "activity_id", activity.ID, "record_type", activity.RecordType, "record_id", activity.RecordID, "author_id", authorID)
+	return s.activities.FindByID(ctx, activity.ID)
+}
+
+// Get returns an activity of the context organization
+func (s *ActivityService) Get(ctx context.Context, id int) (*models.Activity, error) {
+	return s.activities.FindByID(ctx, id)
+}
+
+// List returns a page of the context organization's activities and the
+// number of matching activities
+func (s *ActivityService) List(ctx context.Context, filter repository.ActivityFilter, page, pageSize int) ([]models.Activity, int64, error) {
+	if filter.Segment != 0 {
+		var err error
+		if filter.InSegment, err = s.segments.match(ctx, filter.Segment, filter.RecordType); err != nil {
+			return nil, 0, err
+		}
+	}
+	return s.activities.List(ctx, filter, (page-1)*pageSize, pageSize)
+}
+
+// Update replaces the details of an activity of the context organization,
+// keeping its author
+func (s *ActivityService) Update(ctx context.Context, id int, input ActivityInput) (*models.Activity, error) {
+	activity, err := s.activities.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(ctx, activity, input); err != nil {
+		return nil, err
+	}
+	if err := s.activities.Update(ctx, activity); err != nil {
+		return nil, err
+	}
+	return s.activities.FindByID(ctx, id)
+}
+
+// Delete removes an activity of the context organization
+func (s *ActivityService) Delete(ctx context.Context, id int) error {
+	if err := s.activities.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.logger.Infow("Activity deleted", "activity_id", id)
+	return nil
+}
+
+// Timeline returns a page of the events of a record, newest first, and the
+// number of events. Activities logged against the record are interleaved
+// with the stage changes of its deals, or of the deal itself. Pages ending
+// past the first maxTimelineEntries events are refused.
+func (s *ActivityService) Timeline(ctx context.Context, recordType string, recordID, page, pageSize int) ([]TimelineEntry, int64, error) {
+	if page > maxTimelineEntries/pageSize {
+		return nil, 0, ErrTimelineTooDeep
+	}
+	if err := checkRecord(ctx, s.contacts, s.companies, s.deals, recordType, recordID); err != nil {
+		return nil, 0, err
+	}
+
+	// both sources are sorted newest first, so the entries of the page are
+	// among the first page*pageSize of each
+	limit := page * pageSize
+	activities, activityTotal, err := s.activities.List(ctx, repository.ActivityFilter{
+		RecordType: recordType,
+		RecordID:   recordID,
+	}, 0, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter := repository.StageChangeFilter{}
+	switch recordType {
+	case models.RecordContact:
+		filter.ContactID = recordID
+	case models.RecordCompany:
+		filter.CompanyID = recordID
+	case models.RecordDeal:
+		filter.DealID = recordID
+	}
+	changes, changeTotal, err := s.deals.ListRecentStageChanges(ctx, filter, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]TimelineEntry, 0, len(activities)+len(changes))
+	for len(activities) > 0 || len(changes) > 0 {
+		if len(changes) == 0 || (len(activities) > 0 && !activities[0].OccurredAt.Before(changes[0].CreatedAt)) {
+			entries = append(entries, TimelineEntry{At: activities[0].OccurredAt, Activity: &activities[0]})
+			activities = activities[1:]
+		} else {
+			entries = append(entries, TimelineEntry{At: changes[0].CreatedAt, StageChange: &changes[0]})
+			changes = changes[1:]
+		}
+	}
+
+	offset := (page - 1) * pageSize
+	if offset > len(entries) {
+		offset = len(entries)
+	}
+	end := offset + pageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+	return entries[offset:end], activityTotal + changeTotal, nil
+}
+
+// apply copies the input onto the activity after checking its record
+func (s *ActivityService) apply(ctx context.Context, activity *models.Activity, input ActivityInput) error {
+	if err := checkRecord(ctx, s.contacts, s.companies, s.deals, input.RecordType, input.RecordID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidRecord
+		}
+		return err
+	}
+
+	activity.Type = input.Type
+	activity.RecordType = input.RecordType
+	activity.RecordID = input.RecordID
+	activity.Subject = strings.TrimSpace(input.Subject)
+	activity.Body = strings.TrimSpace(input.Body)
+	switch {
+	case input.OccurredAt != nil:
+		activity.OccurredAt = *input.OccurredAt
+	case activity.OccurredAt.IsZero():
+		activity.OccurredAt = time.Now()
+	}
+	activity.Duration = input.Duration
+	activity.Outcome = strings.TrimSpace(input.Outcome)
+	activity.Author = nil
+	return nil
+}
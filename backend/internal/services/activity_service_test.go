@@ -0,0 +1,231 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+// testActivity returns an activity of the test organization on a record
+func testActivity(id int, recordType string, recordID int, subject string, occurredAt time.Time) models.Activity {
+	return models.Activity{
+		ID:          id,
+		TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID},
+		Type:        models.ActivityNote,
+		RecordType:  recordType,
+		RecordID:    recordID,
+		Subject:     subject,
+		OccurredAt:  occurredAt,
+	}
+}
+
+// newTestActivityService returns an ActivityService over the activities and
+// deals, with contact 1 and company 1 in the test organization
+func newTestActivityService(activities *repotest.Activities, deals *repotest.Deals) *ActivityService {
+	contacts := repotest.NewContacts(testContact(1, "Ada"))
+	companies := repotest.NewCompanies(contacts, testCompany(1, "Acme"))
+	return NewActivityService(activities, contacts, companies, deals, nil, zap.NewNop().Sugar())
+}
+
+// recordStageChanges records stage changes of deals at given times
+func recordStageChanges(t *testing.T, deals *repotest.Deals, changes ...models.DealStageChange) {
+	t.Helper()
+	for i := range changes {
+		if err := deals.RecordStageChange(testContext(), &changes[i]); err != nil {
+			t.Fatalf("RecordStageChange: %v", err)
+		}
+	}
+}
+
+func TestActivityServiceCreate(t *testing.T) {
+	service := newTestActivityService(repotest.NewActivities(nil), repotest.NewDeals(nil))
+
+	before := time.Now()
+	activity, err := service.Create(testContext(), testManagerID, ActivityInput{
+		Type:       models.ActivityCall,
+		RecordType: models.RecordContact,
+		RecordID:   1,
+		Subject:    " Intro call ",
+		Outcome:    "no answer ",
+		Duration:   5 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if activity.Subject != "Intro call" || activity.Outcome != "no answer" || activity.Duration != 5*time.Minute {
+		t.Errorf("activity = %+v", activity)
+	}
+	if activity.AuthorID == nil || *activity.AuthorID != testManagerID {
+		t.Errorf("author = %v, want the creator", activity.AuthorID)
+	}
+	if activity.OccurredAt.Before(before) || activity.OccurredAt.After(time.Now()) {
+		t.Errorf("occurred at %v, want now", activity.OccurredAt)
+	}
+}
+
+func TestActivityServiceRejectsUnknownRecords(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordType string
+		recordID   int
+	}{
+		{"missing contact", models.RecordContact, 2},
+		{"missing company", models.RecordCompany, 2},
+		{"missing deal", models.RecordDeal, 1},
+		{"unknown record type", "invoice", 1},
+		{"no record", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			activities := repotest.NewActivities(nil, testActivity(1, models.RecordContact, 1, "Note", time.Now()))
+			service := newTestActivityService(activities, repotest.NewDeals(nil))
+			input := ActivityInput{Type: models.ActivityNote, RecordType: tt.recordType, RecordID: tt.recordID, Subject: "Note"}
+			if _, err := service.Create(testContext(), testAdminID, input); !errors.Is(err, ErrInvalidRecord) {
+				t.Errorf("Create = %v, want %v", err, ErrInvalidRecord)
+			}
+			if _, err := service.Update(testContext(), 1, input); !errors.Is(err, ErrInvalidRecord) {
+				t.Errorf("Update = %v, want %v", err, ErrInvalidRecord)
+			}
+			listed, total, err := activities.List(testContext(), repository.ActivityFilter{}, 0, 10)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if total != 1 || listed[0].RecordType != models.RecordContact || listed[0].RecordID != 1 {
+				t.Errorf("activities = %+v, want the seeded activity unchanged", listed)
+			}
+		})
+	}
+}
+
+func TestActivityServiceUpdateKeepsTimeAndAuthor(t *testing.T) {
+	author := testManagerID
+	occurred := time.Date(2026, 10, 1, 9, 30, 0, 0, time.UTC)
+	seeded := testActivity(1, models.RecordContact, 1, "Note", occurred)
+	seeded.AuthorID = &author
+	service := newTestActivityService(repotest.NewActivities(nil, seeded), repotest.NewDeals(nil))
+
+	activity, err := service.Update(testContext(), 1, ActivityInput{
+		Type: models.ActivityMeeting, RecordType: models.RecordCompany, RecordID: 1, Subject: "Kick-off",
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if activity.Type != models.ActivityMeeting || activity.RecordType != models.RecordCompany || activity.Subject != "Kick-off" {
+		t.Errorf("activity = %+v", activity)
+	}
+	if !activity.OccurredAt.Equal(occurred) || activity.AuthorID == nil || *activity.AuthorID != author {
+		t.Errorf("occurred at %v by %v, want %v by %d", activity.OccurredAt, activity.AuthorID, occurred, author)
+	}
+
+	moved := occurred.Add(time.Hour)
+	activity, err = service.Update(testContext(), 1, ActivityInput{
+		Type: models.ActivityMeeting, RecordType: models.RecordCompany, RecordID: 1, Subject: "Kick-off", OccurredAt: &moved,
+	})
+	if err != nil {
+		t.Fatalf("Update with a time: %v", err)
+	}
+	if !activity.OccurredAt.Equal(moved) {
+		t.Errorf("occurred at %v, want %v", activity.OccurredAt, moved)
+	}
+
+	if _, err := service.Update(testContext(), 2, ActivityInput{RecordType: models.RecordContact, RecordID: 1}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Update of a missing activity = %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func TestActivityServiceTimeline(t *testing.T) {
+	now := time.Now()
+	hoursAgo := func(hours int) time.Time { return now.Add(-time.Duration(hours) * time.Hour) }
+	company := 1
+	activities := repotest.NewActivities(nil,
+		testActivity(1, models.RecordCompany, 1, "1h", hoursAgo(1)),
+		testActivity(2, models.RecordCompany, 1, "3h", hoursAgo(3)),
+		testActivity(3, models.RecordCompany, 1, "5h", hoursAgo(5)),
+		testActivity(4, models.RecordContact, 1, "other record", hoursAgo(2)),
+	)
+	companyDeal := testDeal(1, "Big sale")
+	companyDeal.CompanyID = &company
+	deals := repotest.NewDeals(nil, companyDeal, testDeal(2, "Other sale"))
+	recordStageChanges(t, deals,
+		models.DealStageChange{DealID: 1, ToStageID: 1, CreatedAt: hoursAgo(4)},
+		models.DealStageChange{DealID: 1, ToStageID: 2, CreatedAt: hoursAgo(2)},
+		models.DealStageChange{DealID: 2, ToStageID: 2, CreatedAt: hoursAgo(1)}, // a deal of another company
+	)
+	service := newTestActivityService(activities, deals)
+
+	// describe names the entries of a page by activity subject or stage
+	describe := func(entries []TimelineEntry) []string {
+		var names []string
+		for _, entry := range entries {
+			if entry.Activity != nil {
+				names = append(names, entry.Activity.Subject)
+			} else {
+				names = append(names, fmt.Sprintf("stage %d", entry.StageChange.ToStageID))
+			}
+		}
+		return names
+	}
+
+	pages := [][]string{
+		{"1h", "stage 2"},
+		{"3h", "stage 1"},
+		{"5h"},
+		nil,
+	}
+	for i, want := range pages {
+		entries, total, err := service.Timeline(testContext(), models.RecordCompany, 1, i+1, 2)
+		if err != nil {
+			t.Fatalf("Timeline page %d: %v", i+1, err)
+		}
+		if got := describe(entries); !reflect.DeepEqual(got, want) {
+			t.Errorf("page %d = %v, want %v", i+1, got, want)
+		}
+		if total != 5 {
+			t.Errorf("page %d: total = %d, want 5", i+1, total)
+		}
+	}
+
+	if _, _, err := service.Timeline(testContext(), models.RecordCompany, 2, 1, 20); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Timeline of a missing company = %v, want %v", err, repository.ErrNotFound)
+	}
+
+	tests := []struct {
+		page, pageSize int
+		err            error
+	}{
+		{page: 10, pageSize: 100},
+		{page: 11, pageSize: 100, err: ErrTimelineTooDeep},
+		{page: 33, pageSize: 30},
+		{page: 34, pageSize: 30, err: ErrTimelineTooDeep},
+		{page: math.MaxInt / 2, pageSize: 20, err: ErrTimelineTooDeep},
+	}
+	for _, tt := range tests {
+		if _, _, err := service.Timeline(testContext(), models.RecordCompany, 1, tt.page, tt.pageSize); !errors.Is(err, tt.err) {
+			t.Errorf("Timeline page %d of %d = %v, want %v", tt.page, tt.pageSize, err, tt.err)
+		}
+	}
+}
+
+func TestActivityServiceTimelinePutsActivitiesFirstOnTies(t *testing.T) {
+	at := time.Now().Add(-time.Hour)
+	activities := repotest.NewActivities(nil, testActivity(1, models.RecordDeal, 1, "Call", at))
+	deals := repotest.NewDeals(nil, testDeal(1, "Big sale"))
+	recordStageChanges(t, deals, models.DealStageChange{DealID: 1, ToStageID: 1, CreatedAt: at})
+	service := newTestActivityService(activities, deals)
+
+	entries, _, err := service.Timeline(testContext(), models.RecordDeal, 1, 1, 20)
+	if err != nil {
+		t.Fatalf("Timeline: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Activity == nil || entries[1].StageChange == nil || !entries[1].At.Equal(at) {
+		t.Errorf("entries = %+v, want the activity then the stage change", entries)
+	}
+}
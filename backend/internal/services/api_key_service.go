@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidExpiry = errors.New("expiry must be in the future")
+
+const (
+	// apiKeyPrefix starts every key so that leaked keys are easy to recognize
+	apiKeyPrefix = "lcrm_"
+	// apiKeyDisplayLength is how much of a key is kept to tell keys apart
+	apiKeyDisplayLength = 12
+	// lastUsedInterval throttles last-used updates to one write per interval
+	lastUsedInterval = time.Minute
+)
+
+// APIKeyInput holds the data required to create an API key
+type APIKeyInput struct {
+	Name      string
+	Scopes    []string // permission names
+	ExpiresAt *time.Time
+}
+
+// CreatedAPIKey is a newly created key together with its secret, which is
+// only available at creation
+type CreatedAPIKey struct {
+	Key    *models.APIKey
+	Secret string
+}
+
+// APIKeyService manages API keys and authenticates requests made with them
+type APIKeyService struct {
+	apiKeys       repository.APIKeyRepository
+	organizations repository.OrganizationRepository
+	logger        *zap.SugaredLogger
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(apiKeys repository.APIKeyRepository, organizations repository.OrganizationRepository, logger *zap.SugaredLogger) *APIKeyService {
+	return &APIKeyService{
+		apiKeys:       apiKeys,
+		organizations: organizations,
+		logger:        logger,
+	}
+}
+
+// Create issues a key acting as the user in the context organization
+func (s *APIKeyService) Create(ctx context.Context, userID, creatorID int, input APIKeyInput) (*CreatedAPIKey, error) {
+	scopes, err := validateScopes(input.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	random, err := utils.RandomToken(24)
+	if err != nil {
+		return nil, err
+	}
+	secret := apiKeyPrefix + random
+
+	key := &models.APIKey{
+		UserID:      userID,
+		Name:        strings.TrimSpace(input.Name),
+		Prefix:      secret[:apiKeyDisplayLength],
+		KeyHash:     utils.HashToken(secret),
+		Scopes:      scopes,
+		CreatedByID: creatorID,
+		ExpiresAt:   input.ExpiresAt,
+	}
+	if err := s.apiKeys.Create(ctx, key); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("API key created",
+		"api_key_id", key.ID,
+		"user_id", userID,
+		"organization_id", key.OrganizationID,
+		"created_by", creatorID,
+	)
+	return &CreatedAPIKey{Key: key, Secret: secret}, nil
+}
+
+// List returns the user's unrevoked keys in the context organization
+func (s *APIKeyService) List(ctx context.Context, userID int) ([]models.APIKey, error) {
+	return s.apiKeys.ListForUser(ctx, userID)
+}
+
+// Revoke revokes one of the user's keys in the context organization
+func (s *APIKeyService) Revoke(ctx context.Context, userID, id int) error {
+	key, err := s.apiKeys.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key.UserID != userID {
+		return repository.ErrNotFound
+	}
+
+	s.logger.Infow("API key revoked", "api_key_id", id, "user_id", userID)
+	return s.apiKeys.Revoke(ctx, id)
+}
+
+// RevokeAllForUser revokes every key of the user in the context organization
+func (s *APIKeyService) RevokeAllForUser(ctx context.Context, userID int) error {
+	return s.apiKeys.RevokeAllForUser(ctx, userID)
+}
+
+// AuthenticateAPIKey implements middleware.APIKeyAuthenticator. The key acts
+// with its user's current role, so removing the user from the organization
+// disables their keys as well.
+func (s *APIKeyService) AuthenticateAPIKey(ctx context.Context, secret string) (*middleware.APIKeyPrincipal, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return nil, middleware.ErrInvalidAPIKey
+	}
+
+	key, err := s.apiKeys.FindByHash(ctx, utils.HashToken(secret))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, middleware.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if !key.Active() {
+		return nil, middleware.ErrInvalidAPIKey
+	}
+
+	membership, err := s.organizations.FindMember(tenant.WithOrganization(ctx, key.OrganizationID), key.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, middleware.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedInterval {
+		if err := s.apiKeys.TouchLastUsed(ctx, key.ID, now); err != nil {
+			// a stale timestamp should not fail the request
+			s.logger.Warnw("Failed to record API key use", "api_key_id", key.ID, "error", err)
+		}
+	}
+
+	return &middleware.APIKeyPrincipal{
+		KeyID:  strconv.Itoa(key.ID),
+		UserId: strconv.Itoa(key.UserID),
+		OrgId:  strconv.Itoa(key.OrganizationID),
+		Role:   membership.Role,
+		Scopes: key.Scopes,
+	}, nil
+}
+
+// validateScopes rejects unknown permission names and drops duplicates
+func validateScopes(scopes []string) ([]string, error) {
+	known := make(map[string]bool, len(models.PermissionCatalog))
+	for _, permission := range models.PermissionCatalog {
+		known[permission.Name] = true
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	result := make([]string, 0, len(scopes))
+	var unknown []string
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		switch {
+		case !known[scope]:
+			unknown = append(unknown, scope)
+		case !seen[scope]:
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, strings.Join(unknown, ", "))
+	}
+	return result, nil
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// testAPIKey is the secret of the key seeded by storedAPIKey
+const testAPIKey = apiKeyPrefix + "test-secret-value"
+
+// storedAPIKey returns the stored form of testAPIKey, a key of the test member
+func storedAPIKey(change func(key *models.APIKey)) models.APIKey {
+	key := models.APIKey{
+		ID:          1,
+		TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID},
+		UserID:      testMemberID,
+		Name:        "ci",
+		Prefix:      testAPIKey[:apiKeyDisplayLength],
+		KeyHash:     utils.HashToken(testAPIKey),
+		Scopes:      []string{models.PermissionContactsRead},
+		CreatedByID: testMemberID,
+	}
+	if change != nil {
+		change(&key)
+	}
+	return key
+}
+
+func newTestAPIKeyService(keys ...models.APIKey) (*APIKeyService, *repotest.APIKeys, *repotest.Organizations) {
+	_, organizations := newTestRoles(newTestUsers())
+	apiKeys := repotest.NewAPIKeys(keys...)
+	return NewAPIKeyService(apiKeys, organizations, zap.NewNop().Sugar()), apiKeys, organizations
+}
+
+func TestAPIKeyServiceCreateStoresOnlyAHash(t *testing.T) {
+	service, apiKeys, _ := newTestAPIKeyService()
+
+	created, err := service.Create(testContext(), testMemberID, testMemberID, APIKeyInput{
+		Name:   " ci ",
+		Scopes: []string{models.PermissionContactsRead, " " + models.PermissionContactsRead},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !strings.HasPrefix(created.Secret, apiKeyPrefix) {
+		t.Errorf("secret %q does not start with %q", created.Secret, apiKeyPrefix)
+	}
+
+	stored, err := apiKeys.FindByID(testContext(), created.Key.ID)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if stored.KeyHash != utils.HashToken(created.Secret) || strings.Contains(stored.KeyHash, created.Secret) {
+		t.Errorf("stored hash %q is not the hash of the secret", stored.KeyHash)
+	}
+	if stored.Prefix != created.Secret[:apiKeyDisplayLength] {
+		t.Errorf("prefix = %q, want the first %d characters of the secret", stored.Prefix, apiKeyDisplayLength)
+	}
+	want := models.APIKey{
+		ID:          created.Key.ID,
+		TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID},
+		UserID:      testMemberID,
+		Name:        "ci",
+		Scopes:      []string{models.PermissionContactsRead},
+		CreatedByID: testMemberID,
+	}
+	got := *stored
+	got.Prefix, got.KeyHash, got.CreatedAt = "", "", time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stored key = %+v, want %+v", got, want)
+	}
+}
+
+func TestAPIKeyServiceCreateRejects(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name  string
+		input APIKeyInput
+		err   error
+	}{
+		{"unknown scope", APIKeyInput{Name: "ci", Scopes: []string{"contacts:delete"}}, ErrUnknownPermission},
+		{"expiry in the past", APIKeyInput{Name: "ci", ExpiresAt: &past}, ErrInvalidExpiry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, apiKeys, _ := newTestAPIKeyService()
+
+			if _, err := service.Create(testContext(), testMemberID, testMemberID, tt.input); !errors.Is(err, tt.err) {
+				t.Fatalf("Create = %v, want %v", err, tt.err)
+			}
+			if keys, _ := apiKeys.ListForUser(testContext(), testMemberID); len(keys) != 0 {
+				t.Errorf("stored %d keys", len(keys))
+			}
+		})
+	}
+}
+
+func TestAPIKeyServiceAuthenticate(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		stored models.APIKey
+		setup  func(t *testing.T, organizations *repotest.Organizations)
+		secret string
+		valid  bool
+	}{
+		{name: "active key", stored: storedAPIKey(nil), secret: testAPIKey, valid: true},
+		{name: "key expiring later", stored: storedAPIKey(func(key *models.APIKey) { key.ExpiresAt = &future }), secret: testAPIKey, valid: true},
+		{name: "expired key", stored: storedAPIKey(func(key *models.APIKey) { key.ExpiresAt = &past }), secret: testAPIKey},
+		{name: "revoked key", stored: storedAPIKey(func(key *models.APIKey) { key.RevokedAt = &past }), secret: testAPIKey},
+		{name: "unknown key", stored: storedAPIKey(nil), secret: apiKeyPrefix + "other"},
+		{name: "missing prefix", stored: storedAPIKey(nil), secret: strings.TrimPrefix(testAPIKey, apiKeyPrefix)},
+		{name: "the stored hash", stored: storedAPIKey(nil), secret: utils.HashToken(testAPIKey)},
+		{
+			name:   "user removed from the organization",
+			stored: storedAPIKey(nil),
+			setup: func(t *testing.T, organizations *repotest.Organizations) {
+				if err := organizations.RemoveMember(testContext(), testMemberID); err != nil {
+					t.Fatalf("RemoveMember: %v", err)
+				}
+			},
+			secret: testAPIKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, apiKeys, organizations := newTestAPIKeyService(tt.stored)
+			if tt.setup != nil {
+				tt.setup(t, organizations)
+			}
+
+			// the key is looked up before the organization of the request is known
+			principal, err := service.AuthenticateAPIKey(context.Background(), tt.secret)
+			if !tt.valid {
+				if !errors.Is(err, middleware.ErrInvalidAPIKey) {
+					t.Fatalf("AuthenticateAPIKey = %v, want %v", err, middleware.ErrInvalidAPIKey)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AuthenticateAPIKey: %v", err)
+			}
+
+			want := &middleware.APIKeyPrincipal{
+				KeyID:  "1",
+				UserId: "3",
+				OrgId:  "3",
+				Role:   models.RoleUser,
+				Scopes: []string{models.PermissionContactsRead},
+			}
+			if !reflect.DeepEqual(principal, want) {
+				t.Errorf("principal = %+v, want %+v", principal, want)
+			}
+			if key, _ := apiKeys.FindByID(testContext(), 1); key.LastUsedAt == nil {
+				t.Error("the key use was not recorded")
+			}
+		})
+	}
+}
+
+func TestAPIKeyServiceRevokeOnlyOwnKeys(t *testing.T) {
+	service, _, _ := newTestAPIKeyService(storedAPIKey(nil))
+
+	if err := service.Revoke(testContext(), testManagerID, 1); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("Revoke of another user's key = %v, want %v", err, repository.ErrNotFound)
+	}
+	if _, err := service.AuthenticateAPIKey(context.Background(), testAPIKey); err != nil {
+		t.Fatalf("AuthenticateAPIKey after a rejected Revoke: %v", err)
+	}
+
+	if err := service.Revoke(testContext(), testMemberID, 1); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := service.AuthenticateAPIKey(context.Background(), testAPIKey); !errors.Is(err, middleware.ErrInvalidAPIKey) {
+		t.Fatalf("AuthenticateAPIKey after Revoke = %v, want %v", err, middleware.ErrInvalidAPIKey)
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// AuditService records security-relevant events and lists them for admins
+type AuditService struct {
+	events repository.AuditRepository
+	logger *zap.SugaredLogger
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(events repository.AuditRepository, logger *zap.SugaredLogger) *AuditService {
+	return &AuditService{
+		events: events,
+		logger: logger,
+	}
+}
+
+// Record stores an event, filling in the client of the request and, unless
+// set, the context organization. Events caused while impersonating a user
+// name the impersonator in their details. Failures are logged rather than
+// returned: a broken audit log must not keep users from signing in.
+func (s *AuditService) Record(ctx context.Context, event *models.AuditEvent) {
+	client := middleware.ClientFromContext(ctx)
+	event.IPAddress = client.IP
+	event.UserAgent = client.UserAgent
+	if impersonator, ok := middleware.ImpersonatorFromContext(ctx); ok {
+		if event.Details == nil {
+			event.Details = map[string]interface{}{}
+		}
+		event.Details["impersonator_id"] = impersonator
+	}
+	if event.OrganizationID == nil {
+		if organizationID, ok := tenant.OrganizationID(ctx); ok {
+			event.OrganizationID = &organizationID
+		}
+	}
+
+	if err := s.events.Create(ctx, event); err != nil {
+		s.logger.Errorw("Failed to record audit event", "action", event.Action, "error", err)
+	}
+}
+
+// List returns a page of the context organization's events, newest first,
+// and the number of matching events
+func (s *AuditService) List(ctx context.Context, filter repository.AuditFilter, page, pageSize int) ([]models.AuditEvent, int64, error) {
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return nil, 0, repository.ErrMissingTenant
+	}
+	return s.events.List(ctx, organizationID, filter, (page-1)*pageSize, pageSize)
+}
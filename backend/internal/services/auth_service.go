@@ -0,0 +1,605 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrEmailTaken          = errors.New("email is already registered")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrPasswordTooLong     = errors.New("password must be at most 72 bytes long")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+	ErrNotMember           = errors.New("user is not a member of the organization")
+	ErrInvalidMFAToken     = errors.New("invalid or expired MFA token")
+)
+
+// TokenPair holds the tokens issued to an authenticated user
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // access token lifetime in seconds
+	// OrganizationID and Role describe the tenant the tokens act in
+	OrganizationID int
+	Role           string
+}
+
+// MFAChallenge is issued instead of tokens when a sign-in needs a second
+// factor. Its token is exchanged for a token pair by passing the challenge,
+// or, when EnrollmentRequired is set, by enrolling an authenticator first.
+type MFAChallenge struct {
+	Token              string
+	ExpiresIn          int64 // challenge lifetime in seconds
+	EnrollmentRequired bool
+}
+
+// AuthResult is the outcome of a sign-in: either the user's tokens or a
+// challenge they must pass first
+type AuthResult struct {
+	User      *models.User
+	Tokens    *TokenPair
+	Challenge *MFAChallenge
+}
+
+// RegisterInput holds the data required to register a new user
+type RegisterInput struct {
+	Email        string
+	Password     string
+	BusinessName string
+}
+
+// AuthService implements registration, login, token refresh and logout
+type AuthService struct {
+	users         repository.UserRepository
+	organizations repository.OrganizationRepository
+	refreshTokens repository.RefreshTokenRepository
+	transactor    repository.Transactor
+	mfaService    *MFAService
+	lockout       *LockoutService
+	sessions      *SessionService
+	jwtConfig     middleware.JWTConfig
+	logger        *zap.SugaredLogger
+}
+
+// NewAuthService creates a new authentication service
+func NewAuthService(
+	users repository.UserRepository,
+	organizations repository.OrganizationRepository,
+	refreshTokens repository.RefreshTokenRepository,
+	transactor repository.Transactor,
+	mfaService *MFAService,
+	lockout *LockoutService,
+	sessions *SessionService,
+	jwtConfig middleware.JWTConfig,
+	logger *zap.SugaredLogger,
+) *AuthService {
+	return &AuthService{
+		users:         users,
+		organizations: organizations,
+		refreshTokens: refreshTokens,
+		transactor:    transactor,
+		mfaService:    mfaService,
+		lockout:       lockout,
+		sessions:      sessions,
+		jwtConfig:     jwtConfig,
+		logger:        logger,
+	}
+}
+
+// Register creates a new user account together with an organization the user
+// administers, and issues a token pair acting in that organization
+func (s *AuthService) Register(ctx context.Context, input RegisterInput) (*models.User, *TokenPair, error) {
+	hash, err := hashPassword(input.Password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user := &models.User{
+		Email:        normalizeEmail(input.Email),
+		Password:     hash,
+		BuisnessName: strings.TrimSpace(input.BusinessName),
+	}
+	membership := &models.Membership{Role: models.RoleAdmin}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.users.Create(ctx, user); err != nil {
+			if errors.Is(err, repository.ErrDuplicate) {
+				return ErrEmailTaken
+			}
+			return err
+		}
+
+		organization, err := newOrganization(user.BuisnessName, user.Email)
+		if err != nil {
+			return err
+		}
+		if err := s.organizations.Create(ctx, organization); err != nil {
+			return err
+		}
+
+		membership.UserID = user.ID
+		return s.organizations.AddMember(tenant.WithOrganization(ctx, organization.ID), membership)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.issueTokens(ctx, user, membership, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// Login verifies the user's credentials and signs them in to the given
+// organization, or to their oldest membership when organizationID is zero.
+// Users with MFA get a challenge instead of tokens. Repeated failures slow
+// down and eventually lock further attempts for the address, whether or not
+// it is registered.
+func (s *AuthService) Login(ctx context.Context, email, password string, organizationID int) (*AuthResult, error) {
+	email = normalizeEmail(email)
+	if err := s.lockout.Check(ctx, email); err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.FindByEmail(ctx, email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if user == nil {
+		// take as long as a real check, so that timing does not reveal the address is unknown
+		checkPassword(dummyPasswordHash(), password)
+		return nil, s.loginFailed(ctx, email)
+	}
+	if !checkPassword(user.Password, password) {
+		return nil, s.loginFailed(ctx, email)
+	}
+
+	result, err := s.signIn(ctx, user, organizationID, false)
+	if err != nil {
+		return nil, err
+	}
+	// with MFA the sign-in is only complete once the challenge is passed
+	if result.Tokens != nil {
+		if err := s.lockout.RecordSuccess(ctx, email); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// SwitchOrganization signs the user in to another organization they are a
+// member of. The user already passed MFA when signing in, if they have it.
+func (s *AuthService) SwitchOrganization(ctx context.Context, userID, organizationID int) (*AuthResult, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.signIn(ctx, user, organizationID, true)
+}
+
+// VerifyMFA exchanges a challenge token and a TOTP or recovery code for a token pair
+func (s *AuthService) VerifyMFA(ctx context.Context, challengeToken, code string) (*AuthResult, error) {
+	claims, user, membership, err := s.findChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// codes count towards the lockout like passwords, so that a leaked
+	// password does not allow unlimited guessing of codes
+	if err := s.lockout.Check(ctx, user.Email); err != nil {
+		return nil, err
+	}
+	if err := s.mfaService.Verify(ctx, user.ID, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			if err := s.lockout.RecordFailure(ctx, user.Email); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+	if err := s.lockout.RecordSuccess(ctx, user.Email); err != nil {
+		return nil, err
+	}
+
+	return s.completeChallenge(ctx, claims, user, membership)
+}
+
+// BeginMFAEnrollment starts TOTP enrollment for a user holding a challenge,
+// so that members of organizations requiring MFA can enroll before their
+// first sign-in completes
+func (s *AuthService) BeginMFAEnrollment(ctx context.Context, challengeToken string) (*TOTPEnrollment, error) {
+	_, user, _, err := s.findChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.mfaService.BeginEnrollment(ctx, user.ID)
+}
+
+// ConfirmMFAEnrollment activates the authenticator enrolled with a challenge
+// and completes the sign-in. It returns the new recovery codes.
+func (s *AuthService) ConfirmMFAEnrollment(ctx context.Context, challengeToken, code string) (*AuthResult, []string, error) {
+	claims, user, membership, err := s.findChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recoveryCodes, err := s.mfaService.ConfirmEnrollment(ctx, user.ID, code)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := s.completeChallenge(ctx, claims, user, membership)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, recoveryCodes, nil
+}
+
+// Refresh rotates a refresh token: the presented token is marked as used and a
+// new token pair in the same family is issued. Presenting a token that was
+// already rotated revokes the whole family, since it means the token leaked.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*models.User, *TokenPair, error) {
+	stored, err := s.findRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	rotated := false
+	if stored.RotatedAt == nil {
+		if rotated, err = s.refreshTokens.MarkRotated(ctx, stored.ID); err != nil {
+			return nil, nil, err
+		}
+	}
+	if !rotated {
+		s.logger.Warnw("Refresh token reuse detected, revoking token family",
+			"user_id", stored.UserID,
+			"family_id", stored.FamilyID,
+		)
+		if err := s.sessions.endFamily(ctx, stored.FamilyID); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	// the user may have been deleted since the token was issued
+	user, err := s.users.FindByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, err
+	}
+
+	// the membership may have been removed or its role changed since
+	membership, err := s.organizations.FindMember(tenant.WithOrganization(ctx, stored.OrganizationID), user.ID)
+	if err != nil {
+		// tokens issued before organizations existed carry no organization
+		if errors.Is(err, repository.ErrNotFound) || errors.Is(err, repository.ErrMissingTenant) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, err
+	}
+
+	// the organization may have started requiring MFA since
+	satisfied, err := s.mfaSatisfied(ctx, user.ID, membership.OrganizationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !satisfied {
+		return nil, nil, ErrMFARequired
+	}
+
+	tokens, err := s.issueTokens(ctx, user, membership, stored.FamilyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// Logout ends the session of the given refresh token, revoking its token family
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	stored, err := s.findRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	return s.sessions.endFamily(ctx, stored.FamilyID)
+}
+
+// LogoutEverywhere ends every session of the user and revokes every refresh
+// and access token issued to them
+func (s *AuthService) LogoutEverywhere(ctx context.Context, userID int) error {
+	if err := s.sessions.endAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	if s.jwtConfig.Revocations == nil {
+		return nil
+	}
+	return s.jwtConfig.Revocations.RevokeUser(ctx, strconv.Itoa(userID), time.Now())
+}
+
+// ForceLogout signs a member of the context organization out of every session,
+// for example after a password change or a suspected account compromise
+func (s *AuthService) ForceLogout(ctx context.Context, userID int) error {
+	if _, err := s.organizations.FindMember(ctx, userID); err != nil {
+		return err
+	}
+
+	s.logger.Infow("Forcing logout for user", "user_id", userID)
+	return s.LogoutEverywhere(ctx, userID)
+}
+
+// RevokeAccessToken denylists a single access token until it expires
+func (s *AuthService) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if s.jwtConfig.Revocations == nil || tokenID == "" {
+		return nil
+	}
+	return s.jwtConfig.Revocations.RevokeToken(ctx, tokenID, expiresAt)
+}
+
+// findRefreshToken validates a refresh token and loads its server-side record
+func (s *AuthService) findRefreshToken(ctx context.Context, refreshToken string) (*models.RefreshToken, error) {
+	claims, err := middleware.ParseToken(refreshToken, middleware.TokenTypeRefresh, s.jwtConfig)
+	if err != nil {
+		s.logger.Debugw("Refresh token rejected", "error", err)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	stored, err := s.refreshTokens.FindByID(ctx, claims.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if strconv.Itoa(stored.UserID) != claims.Subject {
+		return nil, ErrInvalidRefreshToken
+	}
+	return stored, nil
+}
+
+// loginFailed counts a failed password check and returns the error to report
+func (s *AuthService) loginFailed(ctx context.Context, email string) error {
+	if err := s.lockout.RecordFailure(ctx, email); err != nil {
+		return err
+	}
+	return ErrInvalidCredentials
+}
+
+// signIn completes a sign-in into the organization. Users with MFA who have
+// not passed it yet, and users without MFA whose organization requires it,
+// get a challenge instead of tokens.
+func (s *AuthService) signIn(ctx context.Context, user *models.User, organizationID int, mfaVerified bool) (*AuthResult, error) {
+	membership, err := s.selectMembership(ctx, user.ID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled, err := s.mfaService.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled && !mfaVerified {
+		return s.challenge(user, membership, false)
+	}
+
+	satisfied, err := s.mfaSatisfied(ctx, user.ID, membership.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	if !satisfied {
+		return s.challenge(user, membership, true)
+	}
+
+	tokens, err := s.issueTokens(ctx, user, membership, "")
+	if err != nil {
+		return nil, err
+	}
+	return &AuthResult{User: user, Tokens: tokens}, nil
+}
+
+// mfaSatisfied reports whether the user meets the organization's MFA requirement
+func (s *AuthService) mfaSatisfied(ctx context.Context, userID, organizationID int) (bool, error) {
+	required, err := s.mfaService.RequiredByOrganization(tenant.WithOrganization(ctx, organizationID))
+	if err != nil || !required {
+		return !required, err
+	}
+	return s.mfaService.Enabled(ctx, userID)
+}
+
+// challenge issues an MFA challenge for signing in to the membership's organization
+func (s *AuthService) challenge(user *models.User, membership *models.Membership, enrollmentRequired bool) (*AuthResult, error) {
+	token, err := middleware.GenerateMFAChallengeToken(
+		strconv.Itoa(user.ID),
+		strconv.Itoa(membership.OrganizationID),
+		s.jwtConfig,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthResult{
+		User: user,
+		Challenge: &MFAChallenge{
+			Token:              token,
+			ExpiresIn:          int64(s.jwtConfig.MFAExpiration.Seconds()),
+			EnrollmentRequired: enrollmentRequired,
+		},
+	}, nil
+}
+
+// findChallenge validates a challenge token and loads the user and the
+// membership it signs in to
+func (s *AuthService) findChallenge(ctx context.Context, challengeToken string) (*middleware.JWTClaims, *models.User, *models.Membership, error) {
+	claims, err := middleware.ParseToken(challengeToken, middleware.TokenTypeMFAChallenge, s.jwtConfig)
+	if err != nil {
+		s.logger.Debugw("MFA challenge token rejected", "error", err)
+		return nil, nil, nil, ErrInvalidMFAToken
+	}
+
+	if s.jwtConfig.Revocations != nil {
+		revoked, err := s.jwtConfig.Revocations.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if revoked {
+			return nil, nil, nil, ErrInvalidMFAToken
+		}
+	}
+
+	userID, err := strconv.Atoi(claims.UserId)
+	if err != nil {
+		return nil, nil, nil, ErrInvalidMFAToken
+	}
+	organizationID, err := strconv.Atoi(claims.OrgId)
+	if err != nil {
+		return nil, nil, nil, ErrInvalidMFAToken
+	}
+
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, nil, ErrInvalidMFAToken
+		}
+		return nil, nil, nil, err
+	}
+
+	membership, err := s.organizations.FindMember(tenant.WithOrganization(ctx, organizationID), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, nil, ErrInvalidMFAToken
+		}
+		return nil, nil, nil, err
+	}
+
+	return claims, user, membership, nil
+}
+
+// completeChallenge revokes a passed challenge so it cannot be replayed and issues the user's tokens
+func (s *AuthService) completeChallenge(ctx context.Context, claims *middleware.JWTClaims, user *models.User, membership *models.Membership) (*AuthResult, error) {
+	if err := s.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.issueTokens(ctx, user, membership, "")
+	if err != nil {
+		return nil, err
+	}
+	return &AuthResult{User: user, Tokens: tokens}, nil
+}
+
+// selectMembership returns the user's membership in the organization, or the
+// oldest membership when organizationID is zero
+func (s *AuthService) selectMembership(ctx context.Context, userID, organizationID int) (*models.Membership, error) {
+	memberships, err := s.organizations.ListMembershipsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range memberships {
+		if organizationID == 0 || memberships[i].OrganizationID == organizationID {
+			return &memberships[i], nil
+		}
+	}
+	return nil, ErrNotMember
+}
+
+// newOrganization builds the organization created for a new user, named after
+// their business or, failing that, their email address
+func newOrganization(businessName, email string) (*models.Organization, error) {
+	name := businessName
+	if name == "" {
+		name = email
+	}
+
+	slug, err := utils.UniqueSlug(name)
+	if err != nil {
+		return nil, err
+	}
+	return &models.Organization{Name: name, Slug: slug}, nil
+}
+
+// issueTokens generates an access and refresh token for the user acting in the
+// membership's organization. An empty familyID starts a new token family and
+// session, as happens on login; otherwise activity on the family's session is
+// recorded.
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, membership *models.Membership, familyID string) (*TokenPair, error) {
+	userID := strconv.Itoa(user.ID)
+	orgID := strconv.Itoa(membership.OrganizationID)
+
+	tokenID, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	newFamily := familyID == ""
+	if newFamily {
+		familyID = tokenID
+	}
+	expiresAt := time.Now().Add(s.jwtConfig.RefreshExpiration)
+
+	var session *models.Session
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if newFamily {
+			session, err = s.sessions.start(ctx, user.ID, membership.OrganizationID, familyID, expiresAt)
+		} else {
+			session, err = s.sessions.touch(ctx, user.ID, membership.OrganizationID, familyID, expiresAt)
+		}
+		if err != nil {
+			return err
+		}
+
+		return s.refreshTokens.Create(ctx, &models.RefreshToken{
+			ID:             tokenID,
+			UserID:         user.ID,
+			FamilyID:       familyID,
+			OrganizationID: membership.OrganizationID,
+			ExpiresAt:      expiresAt,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := middleware.SignAccessToken(&middleware.JWTClaims{
+		UserId:        userID,
+		OrgId:         orgID,
+		Role:          membership.Role,
+		EmailVerified: user.EmailVerified(),
+		SessionId:     strconv.Itoa(session.ID),
+	}, s.jwtConfig, s.jwtConfig.TokenExpiration)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := middleware.GenerateRefreshToken(userID, tokenID, s.jwtConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.jwtConfig.TokenExpiration.Seconds()),
+
+		OrganizationID: membership.OrganizationID,
+		Role:           membership.Role,
+	}, nil
+}
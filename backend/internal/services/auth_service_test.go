@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// testUser is the account the auth tests sign in as, a member of the test organization
+var testUser = models.User{ID: 1, Email: "ada@example.com"}
+
+func testJWTConfig() middleware.JWTConfig {
+	config := middleware.DefaultJWTConfig()
+	config.Secret = "test-secret"
+	return config
+}
+
+// authFixture holds the repositories behind the AuthService under test
+type authFixture struct {
+	users         *repotest.Users
+	organizations *repotest.Organizations
+	refreshTokens *repotest.RefreshTokens
+	throttles     *repotest.LoginThrottles
+	sessions      *repotest.Sessions
+}
+
+// newAuthFixture returns repositories holding the test user, their membership
+// and the given refresh tokens
+func newAuthFixture(tokens ...models.RefreshToken) *authFixture {
+	users := repotest.NewUsers(testUser)
+	return &authFixture{
+		users: users,
+		organizations: repotest.NewOrganizations(users,
+			models.Membership{OrganizationID: testOrganizationID, UserID: testUser.ID, Role: models.RoleUser},
+		),
+		refreshTokens: repotest.NewRefreshTokens(tokens...),
+		throttles:     repotest.NewLoginThrottles(),
+		sessions:      repotest.NewSessions(),
+	}
+}
+
+func (f *authFixture) service() *AuthService {
+	logger := zap.NewNop().Sugar()
+	mfaService := NewMFAService(repotest.NewMFA(), f.users, f.organizations, "CRM", logger)
+	lockoutService := newTestLockoutService(f.throttles, f.users, f.organizations)
+	sessionService := newTestSessionService(f.sessions, f.refreshTokens, f.organizations)
+	return NewAuthService(f.users, f.organizations, f.refreshTokens, repotest.Transactor{}, mfaService, lockoutService, sessionService, testJWTConfig(), logger)
+}
+
+// testLockoutPolicy is the default lockout policy
+var testLockoutPolicy = LockoutPolicy{BackoffAfter: 3, Threshold: 10, Duration: 15 * time.Minute}
+
+// newTestLockoutService returns a LockoutService with testLockoutPolicy
+// recording to an audit log of its own
+func newTestLockoutService(throttles *repotest.LoginThrottles, users *repotest.Users, organizations *repotest.Organizations) *LockoutService {
+	logger := zap.NewNop().Sugar()
+	return NewLockoutService(throttles, users, organizations, NewAuditService(repotest.NewAudit(), logger), testLockoutPolicy, logger)
+}
+
+// newTestSessionService returns a SessionService recording to an audit log of its own
+func newTestSessionService(sessions *repotest.Sessions, refreshTokens *repotest.RefreshTokens, organizations *repotest.Organizations) *SessionService {
+	logger := zap.NewNop().Sugar()
+	return NewSessionService(sessions, refreshTokens, organizations, repotest.Transactor{}, NewAuditService(repotest.NewAudit(), logger), testJWTConfig(), logger)
+}
+
+// activeToken returns a refresh token of the test user that is valid for an hour
+func activeToken(id, familyID string) models.RefreshToken {
+	return models.RefreshToken{
+		ID:             id,
+		UserID:         testUser.ID,
+		FamilyID:       familyID,
+		OrganizationID: testOrganizationID,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}
+}
+
+// signRefreshToken signs a refresh token for a stored token record
+func signRefreshToken(t *testing.T, userID int, tokenID string, config middleware.JWTConfig) string {
+	t.Helper()
+	token, err := middleware.GenerateRefreshToken(strconv.Itoa(userID), tokenID, config)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+	return token
+}
+
+func TestAuthServiceRefreshRotates(t *testing.T) {
+	fixture := newAuthFixture(activeToken("first", "family"))
+	service := fixture.service()
+
+	user, tokens, err := service.Refresh(context.Background(), signRefreshToken(t, testUser.ID, "first", testJWTConfig()))
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if user.ID != testUser.ID || tokens.OrganizationID != testOrganizationID {
+		t.Errorf("refreshed user %d in organization %d, want %d in %d", user.ID, tokens.OrganizationID, testUser.ID, testOrganizationID)
+	}
+
+	first, err := fixture.refreshTokens.FindByID(context.Background(), "first")
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if first.RotatedAt == nil {
+		t.Error("the presented token was not marked as rotated")
+	}
+
+	// the new token continues the family and can be rotated in turn
+	claims, err := middleware.ParseToken(tokens.RefreshToken, middleware.TokenTypeRefresh, testJWTConfig())
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	second, err := fixture.refreshTokens.FindByID(context.Background(), claims.ID)
+	if err != nil {
+		t.Fatalf("FindByID of the new token: %v", err)
+	}
+	if second.FamilyID != "family" || second.ID == "first" || second.OrganizationID != testOrganizationID {
+		t.Errorf("new token = %+v, want a new token in the same family and organization", second)
+	}
+	if _, _, err := service.Refresh(context.Background(), tokens.RefreshToken); err != nil {
+		t.Fatalf("Refresh with the new token: %v", err)
+	}
+}
+
+func TestAuthServiceRefreshReuseRevokesFamily(t *testing.T) {
+	fixture := newAuthFixture(activeToken("first", "family"), activeToken("other", "other"))
+	service := fixture.service()
+	first := signRefreshToken(t, testUser.ID, "first", testJWTConfig())
+
+	_, tokens, err := service.Refresh(context.Background(), first)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if _, _, err := service.Refresh(context.Background(), first); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replayed Refresh = %v, want %v", err, ErrRefreshTokenReused)
+	}
+
+	// the replay revokes the token issued by the rotation but not other sessions
+	if _, _, err := service.Refresh(context.Background(), tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh with the rotated token = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	other, err := fixture.refreshTokens.FindByID(context.Background(), "other")
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if other.RevokedAt != nil {
+		t.Error("a token of another family was revoked")
+	}
+}
+
+func TestAuthServiceRefreshRejects(t *testing.T) {
+	revoked := time.Now().Add(-time.Minute)
+	otherKey := testJWTConfig()
+	otherKey.Secret = "another-secret"
+	config := testJWTConfig()
+	valid := func(t *testing.T) string { return signRefreshToken(t, testUser.ID, "token", config) }
+
+	tests := []struct {
+		name   string
+		stored func(token *models.RefreshToken)
+		setup  func(t *testing.T, fixture *authFixture)
+		token  func(t *testing.T) string
+	}{
+		{
+			name:   "expired record",
+			stored: func(token *models.RefreshToken) { token.ExpiresAt = time.Now().Add(-time.Minute) },
+			token:  valid,
+		},
+		{
+			name:   "revoked record",
+			stored: func(token *models.RefreshToken) { token.RevokedAt = &revoked },
+			token:  valid,
+		},
+		{
+			name:  "unknown token",
+			token: func(t *testing.T) string { return signRefreshToken(t, testUser.ID, "unknown", config) },
+		},
+		{
+			name:  "another user's token",
+			token: func(t *testing.T) string { return signRefreshToken(t, testUser.ID+1, "token", config) },
+		},
+		{
+			name:  "signed with another key",
+			token: func(t *testing.T) string { return signRefreshToken(t, testUser.ID, "token", otherKey) },
+		},
+		{
+			name: "access token",
+			token: func(t *testing.T) string {
+				token, err := middleware.GenerateToken(strconv.Itoa(testUser.ID), strconv.Itoa(testOrganizationID), models.RoleUser, config)
+				if err != nil {
+					t.Fatalf("GenerateToken: %v", err)
+				}
+				return token
+			},
+		},
+		{
+			name:   "token without an organization",
+			stored: func(token *models.RefreshToken) { token.OrganizationID = 0 },
+			token:  valid,
+		},
+		{
+			name: "member removed from the organization",
+			setup: func(t *testing.T, fixture *authFixture) {
+				if err := fixture.organizations.RemoveMember(tenant.WithOrganization(context.Background(), testOrganizationID), testUser.ID); err != nil {
+					t.Fatalf("RemoveMember: %v", err)
+				}
+			},
+			token: valid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := activeToken("token", "token")
+			if tt.stored != nil {
+				tt.stored(&stored)
+			}
+			fixture := newAuthFixture(stored)
+			if tt.setup != nil {
+				tt.setup(t, fixture)
+			}
+
+			if _, _, err := fixture.service().Refresh(context.Background(), tt.token(t)); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Fatalf("Refresh = %v, want %v", err, ErrInvalidRefreshToken)
+			}
+		})
+	}
+}
+
+func TestAuthServiceLogoutRevokesFamily(t *testing.T) {
+	fixture := newAuthFixture(activeToken("first", "family"), activeToken("other", "other"))
+	service := fixture.service()
+
+	if err := service.Logout(context.Background(), signRefreshToken(t, testUser.ID, "first", testJWTConfig())); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, _, err := service.Refresh(context.Background(), signRefreshToken(t, testUser.ID, "first", testJWTConfig())); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh after Logout = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if _, _, err := service.Refresh(context.Background(), signRefreshToken(t, testUser.ID, "other", testJWTConfig())); err != nil {
+		t.Errorf("Refresh of another session after Logout: %v", err)
+	}
+}
+
+func TestAuthServiceLoginLockout(t *testing.T) {
+	now := time.Now()
+	lockedUntil := now.Add(time.Minute)
+	tests := []struct {
+		name     string
+		throttle *models.LoginThrottle
+		email    string
+		password string
+		err      error
+		failures int // recorded for the address afterwards
+	}{
+		{
+			name:     "wrong password counts a failure",
+			email:    testUser.Email,
+			password: "wrong password",
+			err:      ErrInvalidCredentials,
+			failures: 1,
+		},
+		{
+			name:     "unknown address counts a failure",
+			email:    "nobody@example.com",
+			password: testPassword,
+			err:      ErrInvalidCredentials,
+			failures: 1,
+		},
+		{
+			name:     "success forgets earlier failures",
+			throttle: &models.LoginThrottle{FailedAttempts: 3, LastFailedAt: now.Add(-time.Minute)},
+			email:    " ADA@example.com",
+			password: testPassword,
+		},
+		{
+			name:     "locked address is refused the right password",
+			throttle: &models.LoginThrottle{FailedAttempts: 10, LastFailedAt: now, LockedUntil: &lockedUntil},
+			email:    testUser.Email,
+			password: testPassword,
+			err:      ErrLoginThrottled,
+			failures: 10,
+		},
+		{
+			name:     "backoff refuses before checking the password",
+			throttle: &models.LoginThrottle{FailedAttempts: 5, LastFailedAt: now},
+			email:    testUser.Email,
+			password: "wrong password",
+			err:      ErrLoginThrottled,
+			failures: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := newAuthFixture()
+			user := testUser
+			hash, err := hashPassword(testPassword)
+			if err != nil {
+				t.Fatalf("hashPassword: %v", err)
+			}
+			user.Password = hash
+			if err := fixture.users.Update(context.Background(), &user); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			email := normalizeEmail(tt.email)
+			if tt.throttle != nil {
+				tt.throttle.Email = email
+				fixture.throttles = repotest.NewLoginThrottles(*tt.throttle)
+			}
+
+			result, err := fixture.service().Login(context.Background(), tt.email, tt.password, 0)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Login = %v, want %v", err, tt.err)
+			}
+			if err == nil && result.Tokens == nil {
+				t.Error("no tokens issued")
+			}
+
+			throttle, err := fixture.throttles.Find(context.Background(), email)
+			failures := 0
+			if err == nil {
+				failures = throttle.FailedAttempts
+			}
+			if failures != tt.failures {
+				t.Errorf("failures = %d, want %d", failures, tt.failures)
+			}
+		})
+	}
+}
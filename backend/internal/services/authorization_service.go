@@ -0,0 +1,373 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrSystemRole        = errors.New("system roles cannot be modified")
+	ErrRoleExists        = errors.New("a role with this name already exists")
+	ErrRoleInUse         = errors.New("role is still assigned to users")
+	ErrInvalidRoleName   = errors.New("role name must start with a letter and contain only lowercase letters, digits, '-' or '_'")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrCannotAssignRole  = errors.New("cannot assign this role")
+	ErrPermissionNotHeld = errors.New("cannot grant permissions you do not hold")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,99}$`)
+
+// permissionCacheTTL bounds how long a user's resolved permissions are reused.
+// Changes made on this instance clear the cache immediately; other instances
+// pick them up once their entries expire.
+const permissionCacheTTL = 30 * time.Second
+
+// RoleInput holds the editable fields of a role
+type RoleInput struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+type cachedPermissions struct {
+	permissions map[string]bool
+	expiresAt   time.Time
+}
+
+// AuthorizationService manages roles and resolves user permissions. A user's
+// permissions come from their role in the organization of the request context.
+type AuthorizationService struct {
+	roles         repository.RoleRepository
+	organizations repository.OrganizationRepository
+	logger        *zap.SugaredLogger
+
+	mu    sync.RWMutex
+	cache map[string]cachedPermissions // keyed by organization and user ID
+}
+
+// NewAuthorizationService creates a new authorization service
+func NewAuthorizationService(roles repository.RoleRepository, organizations repository.OrganizationRepository, logger *zap.SugaredLogger) *AuthorizationService {
+	return &AuthorizationService{
+		roles:         roles,
+		organizations: organizations,
+		logger:        logger,
+		cache:         make(map[string]cachedPermissions),
+	}
+}
+
+// HasPermissions reports whether the user's current role in the context
+// organization grants every given permission
+func (s *AuthorizationService) HasPermissions(ctx context.Context, userId string, permissions ...string) (bool, error) {
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return false, nil
+	}
+
+	granted, err := s.memberPermissions(ctx, organizationID, userId)
+	if err != nil {
+		return false, err
+	}
+
+	for _, permission := range permissions {
+		if !granted[permission] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// HasPermissionsOf reports whether the user's current role in the context
+// organization grants every permission that other's role grants there
+func (s *AuthorizationService) HasPermissionsOf(ctx context.Context, userId, otherUserId string) (bool, error) {
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return false, nil
+	}
+
+	granted, err := s.memberPermissions(ctx, organizationID, userId)
+	if err != nil {
+		return false, err
+	}
+	other, err := s.memberPermissions(ctx, organizationID, otherUserId)
+	if err != nil {
+		return false, err
+	}
+
+	for permission := range other {
+		if !granted[permission] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// CheckGrantable returns ErrPermissionNotHeld unless the user holds every given
+// permission in the context organization. Granting permissions through a role,
+// whether by defining it or by handing it to someone, is limited to the
+// granter's own permissions so that it never escalates their privileges.
+func (s *AuthorizationService) CheckGrantable(ctx context.Context, userId string, permissions []models.Permission) error {
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return repository.ErrMissingTenant
+	}
+
+	granted, err := s.memberPermissions(ctx, organizationID, userId)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, permission := range permissions {
+		if !granted[permission.Name] {
+			missing = append(missing, permission.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrPermissionNotHeld, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// memberPermissions returns the user's permissions in the organization, served
+// from the cache when fresh
+func (s *AuthorizationService) memberPermissions(ctx context.Context, organizationID int, userId string) (map[string]bool, error) {
+	key := strconv.Itoa(organizationID) + ":" + userId
+
+	s.mu.RLock()
+	entry, ok := s.cache[key]
+	s.mu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.permissions, nil
+	}
+
+	id, err := strconv.Atoi(userId)
+	if err != nil {
+		return map[string]bool{}, nil
+	}
+
+	names, err := s.roles.PermissionsForMember(ctx, organizationID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := make(map[string]bool, len(names))
+	for _, name := range names {
+		permissions[name] = true
+	}
+
+	s.mu.Lock()
+	s.cache[key] = cachedPermissions{permissions: permissions, expiresAt: time.Now().Add(permissionCacheTTL)}
+	s.mu.Unlock()
+
+	return permissions, nil
+}
+
+// invalidate drops every cached permission set
+func (s *AuthorizationService) invalidate() {
+	s.mu.Lock()
+	s.cache = make(map[string]cachedPermissions)
+	s.mu.Unlock()
+}
+
+// ListPermissions returns the permission catalog
+func (s *AuthorizationService) ListPermissions(ctx context.Context) ([]models.Permission, error) {
+	return s.roles.ListPermissions(ctx)
+}
+
+// ListRoles returns the system roles and the organization's custom roles with their permissions
+func (s *AuthorizationService) ListRoles(ctx context.Context) ([]models.Role, error) {
+	return s.roles.List(ctx)
+}
+
+// GetRole returns a single role with its permissions
+func (s *AuthorizationService) GetRole(ctx context.Context, id int) (*models.Role, error) {
+	return s.roles.FindByID(ctx, id)
+}
+
+// CreateRole creates a custom role in the context organization on behalf of a
+// member, granting only permissions the member holds
+func (s *AuthorizationService) CreateRole(ctx context.Context, creatorID int, input RoleInput) (*models.Role, error) {
+	permissions, err := s.resolvePermissions(ctx, input.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.CheckGrantable(ctx, strconv.Itoa(creatorID), permissions); err != nil {
+		return nil, err
+	}
+	return s.createRole(ctx, input.Name, input.Description, permissions)
+}
+
+// createRole creates a custom role in the context organization without
+// checking who grants its permissions
+func (s *AuthorizationService) createRole(ctx context.Context, name, description string, permissions []models.Permission) (*models.Role, error) {
+	name = strings.TrimSpace(name)
+	if !roleNamePattern.MatchString(name) {
+		return nil, ErrInvalidRoleName
+	}
+	// the unique index does not cover system roles, whose organization is NULL
+	if _, ok := models.SystemRoles[name]; ok {
+		return nil, ErrRoleExists
+	}
+
+	role := &models.Role{
+		Name:        name,
+		Description: strings.TrimSpace(description),
+		Permissions: permissions,
+	}
+	if err := s.roles.Create(ctx, role); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, ErrRoleExists
+		}
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// UpdateRole changes the description and permissions of a custom role on
+// behalf of a member. The name is immutable because memberships reference their
+// role by name. Like CreateRole, the role can only grant permissions the member
+// holds.
+func (s *AuthorizationService) UpdateRole(ctx context.Context, editorID, id int, input RoleInput) (*models.Role, error) {
+	role, err := s.roles.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if role.IsSystem {
+		return nil, ErrSystemRole
+	}
+
+	permissions, err := s.resolvePermissions(ctx, input.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.CheckGrantable(ctx, strconv.Itoa(editorID), permissions); err != nil {
+		return nil, err
+	}
+
+	role.Description = strings.TrimSpace(input.Description)
+	role.Permissions = permissions
+	if err := s.roles.Update(ctx, role); err != nil {
+		return nil, err
+	}
+
+	s.invalidate()
+	return role, nil
+}
+
+// DeleteRole deletes a custom role that is no longer assigned to any member
+func (s *AuthorizationService) DeleteRole(ctx context.Context, id int) error {
+	role, err := s.roles.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if role.IsSystem {
+		return ErrSystemRole
+	}
+
+	count, err := s.roles.CountMembers(ctx, role.Name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+
+	if err := s.roles.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.invalidate()
+	return nil
+}
+
+// AssignRoleAs changes the role of a member of the context organization on
+// behalf of another member. Members can only assign roles granting nothing
+// beyond their own permissions, and only to members whose permissions they
+// hold, so that managing users never lets them escalate their own privileges.
+func (s *AuthorizationService) AssignRoleAs(ctx context.Context, assignerID, userID int, roleName string) (*models.Membership, error) {
+	role, err := s.roles.FindByName(ctx, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.CheckGrantable(ctx, strconv.Itoa(assignerID), role.Permissions); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCannotAssignRole, err)
+	}
+
+	covered, err := s.HasPermissionsOf(ctx, strconv.Itoa(assignerID), strconv.Itoa(userID))
+	if err != nil {
+		return nil, err
+	}
+	if !covered {
+		return nil, fmt.Errorf("%w: the member holds permissions you do not", ErrCannotAssignRole)
+	}
+
+	return s.AssignRole(ctx, userID, roleName)
+}
+
+// AssignRole changes the role of a member of the context organization. It is
+// meant for provisioning flows; requests made by members go through AssignRoleAs.
+func (s *AuthorizationService) AssignRole(ctx context.Context, userID int, roleName string) (*models.Membership, error) {
+	role, err := s.roles.FindByName(ctx, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	membership, err := s.organizations.FindMember(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if membership.Role == models.RoleAdmin && role.Name != models.RoleAdmin {
+		admins, err := s.roles.CountMembers(ctx, models.RoleAdmin)
+		if err != nil {
+			return nil, err
+		}
+		if admins <= 1 {
+			return nil, ErrLastAdmin
+		}
+	}
+
+	membership.Role = role.Name
+	if err := s.organizations.UpdateMember(ctx, membership); err != nil {
+		return nil, err
+	}
+
+	s.invalidate()
+	return membership, nil
+}
+
+// resolvePermissions loads the permissions with the given names, rejecting unknown names
+func (s *AuthorizationService) resolvePermissions(ctx context.Context, names []string) ([]models.Permission, error) {
+	permissions, err := s.roles.FindPermissionsByName(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		found[p.Name] = true
+	}
+	var unknown []string
+	for _, name := range names {
+		if !found[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, strings.Join(unknown, ", "))
+	}
+
+	return permissions, nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// Members of the authorization tests, with the roles of newTestRoles
+const (
+	testAdminID   = 1
+	testManagerID = 2 // manages roles and users without being admin
+	testMemberID  = 3
+)
+
+// testOrganizationID is the organization the services are tested in
+const testOrganizationID = 3
+
+// testContext returns a context scoped to the test organization
+func testContext() context.Context {
+	return tenant.WithOrganization(context.Background(), testOrganizationID)
+}
+
+// newTestUsers returns the accounts of the members of the test organization
+func newTestUsers() *repotest.Users {
+	return repotest.NewUsers(
+		models.User{ID: testAdminID, Email: "admin@example.com"},
+		models.User{ID: testManagerID, Email: "manager@example.com"},
+		models.User{ID: testMemberID, Email: "member@example.com"},
+	)
+}
+
+// newTestRoles returns the roles and memberships the authorization tests run against
+func newTestRoles(users *repotest.Users) (*repotest.Roles, *repotest.Organizations) {
+	organizations := repotest.NewOrganizations(users,
+		models.Membership{OrganizationID: testOrganizationID, UserID: testAdminID, Role: models.RoleAdmin},
+		models.Membership{OrganizationID: testOrganizationID, UserID: testManagerID, Role: "manager"},
+		models.Membership{OrganizationID: testOrganizationID, UserID: testMemberID, Role: models.RoleUser},
+	)
+	roles := repotest.NewRoles(organizations,
+		repotest.Role(models.RoleAdmin, models.SystemRoles[models.RoleAdmin]...),
+		repotest.CustomRole(testOrganizationID, "manager", models.PermissionRolesManage, models.PermissionUsersManage, models.PermissionContactsRead),
+		repotest.Role(models.RoleUser, models.PermissionContactsRead),
+	)
+	return roles, organizations
+}
+
+func newTestAuthorizationService(roles *repotest.Roles, organizations *repotest.Organizations) *AuthorizationService {
+	return NewAuthorizationService(roles, organizations, zap.NewNop().Sugar())
+}
+
+func TestAuthorizationServiceCreateRoleWithinOwnPermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		creator     int
+		permissions []string
+		err         error
+	}{
+		{"manager grants their own permissions", testManagerID, []string{models.PermissionContactsRead, models.PermissionUsersManage}, nil},
+		{"manager grants a permission they lack", testManagerID, []string{models.PermissionContactsRead, models.PermissionDealsWrite}, ErrPermissionNotHeld},
+		{"admin grants any permission", testAdminID, []string{models.PermissionDealsWrite, models.PermissionRolesManage}, nil},
+		{"member without permissions to grant", testMemberID, []string{models.PermissionRolesManage}, ErrPermissionNotHeld},
+		{"unknown permission", testAdminID, []string{"contacts:delete"}, ErrUnknownPermission},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles, organizations := newTestRoles(newTestUsers())
+			service := newTestAuthorizationService(roles, organizations)
+
+			_, err := service.CreateRole(testContext(), tt.creator, RoleInput{Name: "custom", Permissions: tt.permissions})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("CreateRole = %v, want %v", err, tt.err)
+			}
+			_, err = roles.FindByName(testContext(), "custom")
+			if created := err == nil; created != (tt.err == nil) {
+				t.Errorf("role created = %v, want %v", created, tt.err == nil)
+			}
+		})
+	}
+}
+
+func TestAuthorizationServiceUpdateRoleWithinOwnPermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		editor      int
+		permissions []string
+		err         error
+	}{
+		{"manager narrows the role", testManagerID, []string{models.PermissionContactsRead}, nil},
+		{"manager extends the role beyond their permissions", testManagerID, []string{models.PermissionContactsRead, models.PermissionDealsWrite}, ErrPermissionNotHeld},
+		{"admin extends the role", testAdminID, []string{models.PermissionContactsRead, models.PermissionDealsWrite}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles, organizations := newTestRoles(newTestUsers())
+			service := newTestAuthorizationService(roles, organizations)
+			custom, err := service.CreateRole(testContext(), testAdminID, RoleInput{
+				Name:        "custom",
+				Permissions: []string{models.PermissionContactsRead},
+			})
+			if err != nil {
+				t.Fatalf("CreateRole: %v", err)
+			}
+
+			_, err = service.UpdateRole(testContext(), tt.editor, custom.ID, RoleInput{Permissions: tt.permissions})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("UpdateRole = %v, want %v", err, tt.err)
+			}
+			stored, err := roles.FindByID(testContext(), custom.ID)
+			if err != nil {
+				t.Fatalf("FindByID: %v", err)
+			}
+			want := len(tt.permissions)
+			if tt.err != nil {
+				want = 1
+			}
+			if len(stored.Permissions) != want {
+				t.Errorf("role has %d permissions, want %d", len(stored.Permissions), want)
+			}
+		})
+	}
+}
+
+func TestAuthorizationServiceAssignRoleAs(t *testing.T) {
+	tests := []struct {
+		name     string
+		assigner int
+		userID   int
+		role     string
+		err      error
+	}{
+		{"manager makes a member admin", testManagerID, testMemberID, models.RoleAdmin, ErrCannotAssignRole},
+		{"manager demotes an admin", testManagerID, testAdminID, models.RoleUser, ErrCannotAssignRole},
+		{"manager makes a member a manager", testManagerID, testMemberID, "manager", nil},
+		{"admin makes a member admin", testAdminID, testMemberID, models.RoleAdmin, nil},
+		{"unknown role", testAdminID, testMemberID, "owner", repository.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles, organizations := newTestRoles(newTestUsers())
+			service := newTestAuthorizationService(roles, organizations)
+
+			_, err := service.AssignRoleAs(testContext(), tt.assigner, tt.userID, tt.role)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("AssignRoleAs = %v, want %v", err, tt.err)
+			}
+			// the assignment takes effect at once despite the permission cache
+			ok, err := service.HasPermissions(testContext(), strconv.Itoa(testMemberID), models.PermissionUsersManage)
+			if err != nil {
+				t.Fatalf("HasPermissions: %v", err)
+			}
+			if want := tt.err == nil && tt.userID == testMemberID; ok != want {
+				t.Errorf("member can manage users = %v, want %v", ok, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"go.uber.org/zap"
+)
+
+// recentActivityWindow is how far back activities count as recent in the
+// company counts
+const recentActivityWindow = 30 * 24 * time.Hour
+
+// CompanyInput holds the data of a company to create or replace
+type CompanyInput struct {
+	Name     string
+	Domain   string
+	Industry string
+	Size     string
+	Address  models.Address
+	OwnerID  *int
+	Tags     []string
+	// CustomFields holds the values of the company's custom fields by key
+	CustomFields map[string]interface{}
+}
+
+// CompanyDetails is a company with a summary of its related records
+type CompanyDetails struct {
+	Company *models.Company
+	Stats   *repository.CompanyStats
+}
+
+// CompanyService manages the companies of an organization and the contacts
+// linked to them
+type CompanyService struct {
+	companies     repository.CompanyRepository
+	contacts      repository.ContactRepository
+	organizations repository.OrganizationRepository
+	fields        repository.CustomFieldRepository
+	segments      *SegmentService
+	logger        *zap.SugaredLogger
+}
+
+// NewCompanyService creates a new company service
+func NewCompanyService(
+	companies repository.CompanyRepository,
+	contacts repository.ContactRepository,
+	organizations repository.OrganizationRepository,
+	fields repository.CustomFieldRepository,
+	segments *SegmentService,
+	logger *zap.SugaredLogger,
+) *CompanyService {
+	return &CompanyService{
+		companies:     companies,
+		contacts:      contacts,
+		organizations: organizations,
+		fields:        fields,
+		segments:      segments,
+		logger:        logger,
+	}
+}
+
+// Create adds a company to the context organization. Without an owner the
+// company is owned by its creator.
+func (s *CompanyService) Create(ctx context.Context, creatorID int, input CompanyInput) (*CompanyDetails, error) {
+	if input.OwnerID == nil {
+		input.OwnerID = &creatorID
+	}
+
+	company := &models.Company{}
+	if err := s.apply(ctx, company, input); err != nil {
+		return nil, err
+	}
+	if err := s.companies.Create(ctx, company); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("Company created", "company_id", company.ID, "organization_id", company.OrganizationID, "created_by", creatorID)
+	return s.Get(ctx, company.ID)
+}
+
+// Get returns a company of the context organization with a summary of its
+// related records
+func (s *CompanyService) Get(ctx context.Context, id int) (*CompanyDetails, error) {
+	company, err := s.companies.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.companies.Stats(ctx, id, time.Now().Add(-recentActivityWindow))
+	if err != nil {
+		return nil, err
+	}
+	return &CompanyDetails{Company: company, Stats: stats}, nil
+}
+
+// List returns a page of the context organization's companies and the number
+// of matching companies. Conditions on custom fields have their values as
+// given in query strings.
+func (s *CompanyService) List(ctx context.Context, filter repository.CompanyFilter, page, pageSize int) ([]models.Company, int64, error) {
+	conditions, customSort, err := customFieldFilter(ctx, s.fields, models.RecordCompany, filter.CustomFields, filter.Sort)
+	if err != nil {
+		return nil, 0, err
+	}
+	filter.CustomFields, filter.CustomSort = conditions, customSort
+	if filter.Segment != 0 {
+		if filter.InSegment, err = s.segments.match(ctx, filter.Segment, models.RecordCompany); err != nil {
+			return nil, 0, err
+		}
+	}
+	return s.companies.List(ctx, filter, (page-1)*pageSize, pageSize)
+}
+
+// Update replaces the details of a company of the context organization
+func (s *CompanyService) Update(ctx context.Context, id int, input CompanyInput) (*CompanyDetails, error) {
+	company, err := s.companies.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(ctx, company, input); err != nil {
+		return nil, err
+	}
+	if err := s.companies.Update(ctx, company); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+// Delete removes a company of the context organization. Its contacts are
+// kept and only unlinked.
+func (s *CompanyService) Delete(ctx context.Context, id int) error {
+	if err := s.companies.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.logger.Infow("Company deleted", "company_id", id)
+	return nil
+}
+
+// ListContacts returns the contacts linked to a company with their roles
+func (s *CompanyService) ListContacts(ctx context.Context, companyID int) ([]models.CompanyContact, error) {
+	if _, err := s.companies.FindByID(ctx, companyID); err != nil {
+		return nil, err
+	}
+	return s.companies.ListContacts(ctx, companyID)
+}
+
+// LinkContact links a contact to a company with the role they play there,
+// replacing the role if they are already linked
+func (s *CompanyService) LinkContact(ctx context.Context, companyID, contactID int, role string) error {
+	if _, err := s.companies.FindByID(ctx, companyID); err != nil {
+		return err
+	}
+	if _, err := s.contacts.FindByID(ctx, contactID); err != nil {
+		return err
+	}
+
+	return s.companies.LinkContact(ctx, &models.CompanyContact{
+		CompanyID: companyID,
+		ContactID: contactID,
+		Role:      strings.TrimSpace(role),
+	})
+}
+
+// UnlinkContact removes a contact from a company
+func (s *CompanyService) UnlinkContact(ctx context.Context, companyID, contactID int) error {
+	return s.companies.UnlinkContact(ctx, companyID, contactID)
+}
+
+// apply copies the input onto the company after checking the owner
+func (s *CompanyService) apply(ctx context.Context, company *models.Company, input CompanyInput) error {
+	if err := checkOwner(ctx, s.organizations, input.OwnerID); err != nil {
+		return err
+	}
+	values, err := customFieldValues(ctx, s.fields, models.RecordCompany, input.CustomFields)
+	if err != nil {
+		return err
+	}
+
+	company.Name = strings.TrimSpace(input.Name)
+	company.Domain = strings.ToLower(strings.TrimSpace(input.Domain))
+	company.Industry = strings.TrimSpace(input.Industry)
+	company.Size = input.Size
+	company.Address = normalizeAddress(input.Address)
+	company.OwnerID = input.OwnerID
+	company.Owner = nil
+	company.Tags = newTaggings(input.Tags)
+	company.CustomFields = values
+	return nil
+}
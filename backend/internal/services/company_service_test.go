@@ -0,0 +1,183 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+// testCompany returns a company of the test organization
+func testCompany(id int, name string) models.Company {
+	return models.Company{ID: id, TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID}, Name: name}
+}
+
+// newTestCompanyService returns a CompanyService over the companies, owned
+// by the members of the test organization
+func newTestCompanyService(companies *repotest.Companies, contacts *repotest.Contacts) *CompanyService {
+	_, organizations := newTestRoles(newTestUsers())
+	return NewCompanyService(companies, contacts, organizations, repotest.NewCustomFields(), nil, zap.NewNop().Sugar())
+}
+
+func TestCompanyServiceCreate(t *testing.T) {
+	contacts := repotest.NewContacts()
+	service := newTestCompanyService(repotest.NewCompanies(contacts), contacts)
+
+	details, err := service.Create(testContext(), testManagerID, CompanyInput{
+		Name:     " Acme ",
+		Domain:   " Acme.Example ",
+		Industry: "Manufacturing ",
+		Size:     "51-200",
+		Tags:     []string{"Key Account", "key account"},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	company := details.Company
+	if company.Name != "Acme" || company.Domain != "acme.example" || company.Industry != "Manufacturing" || company.Size != "51-200" {
+		t.Errorf("company = %+v", company)
+	}
+	if company.OwnerID == nil || *company.OwnerID != testManagerID {
+		t.Errorf("owner = %v, want the creator", company.OwnerID)
+	}
+	if tags := company.TagNames(); len(tags) != 1 || tags[0] != "key account" {
+		t.Errorf("tags = %v, want [key account]", tags)
+	}
+	if details.Stats == nil || details.Stats.Contacts != 0 {
+		t.Errorf("stats = %+v, want no contacts", details.Stats)
+	}
+
+	outsider := testOutsider.ID
+	if _, err := service.Create(testContext(), testAdminID, CompanyInput{Name: "Globex", OwnerID: &outsider}); !errors.Is(err, ErrInvalidOwner) {
+		t.Errorf("Create with an owner outside the organization = %v, want %v", err, ErrInvalidOwner)
+	}
+}
+
+func TestCompanyServiceGetCountsContacts(t *testing.T) {
+	contacts := repotest.NewContacts(testContact(1, "Ada"), testContact(2, "Grace"))
+	companies := repotest.NewCompanies(contacts, testCompany(1, "Acme"), testCompany(2, "Globex"))
+	service := newTestCompanyService(companies, contacts)
+	for _, contactID := range []int{1, 2} {
+		if err := service.LinkContact(testContext(), 1, contactID, ""); err != nil {
+			t.Fatalf("LinkContact: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		companyID int
+		contacts  int64
+		err       error
+	}{
+		{name: "linked contacts", companyID: 1, contacts: 2},
+		{name: "no contacts", companyID: 2},
+		{name: "missing company", companyID: 3, err: repository.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details, err := service.Get(testContext(), tt.companyID)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Get = %v, want %v", err, tt.err)
+			}
+			if err == nil && details.Stats.Contacts != tt.contacts {
+				t.Errorf("contacts = %d, want %d", details.Stats.Contacts, tt.contacts)
+			}
+		})
+	}
+}
+
+func TestCompanyServiceLinkContact(t *testing.T) {
+	contacts := repotest.NewContacts(testContact(1, "Ada"))
+	companies := repotest.NewCompanies(contacts, testCompany(1, "Acme"))
+	service := newTestCompanyService(companies, contacts)
+	ctx := testContext()
+
+	if err := service.LinkContact(ctx, 1, 1, " decision maker "); err != nil {
+		t.Fatalf("LinkContact: %v", err)
+	}
+	contact, err := contacts.FindByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if len(contact.Companies) != 1 || contact.Companies[0].Role != "decision maker" {
+		t.Errorf("companies of the contact = %+v, want Acme with the role trimmed", contact.Companies)
+	}
+	if err := service.LinkContact(ctx, 1, 1, "champion"); err != nil {
+		t.Fatalf("LinkContact again: %v", err)
+	}
+	links, err := service.ListContacts(ctx, 1)
+	if err != nil {
+		t.Fatalf("ListContacts: %v", err)
+	}
+	if len(links) != 1 || links[0].Role != "champion" || links[0].Contact == nil || links[0].Contact.FirstName != "Ada" {
+		t.Errorf("links = %+v, want the contact linked once as champion", links)
+	}
+
+	tests := []struct {
+		name                 string
+		companyID, contactID int
+	}{
+		{"missing company", 2, 1},
+		{"missing contact", 1, 2},
+	}
+	for _, tt := range tests {
+		if err := service.LinkContact(ctx, tt.companyID, tt.contactID, ""); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("%s: LinkContact = %v, want %v", tt.name, err, repository.ErrNotFound)
+		}
+	}
+	if _, err := service.ListContacts(ctx, 2); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("ListContacts of a missing company = %v, want %v", err, repository.ErrNotFound)
+	}
+
+	if err := service.UnlinkContact(ctx, 1, 1); err != nil {
+		t.Fatalf("UnlinkContact: %v", err)
+	}
+	if links, _ := service.ListContacts(ctx, 1); len(links) != 0 {
+		t.Errorf("links after unlinking = %+v", links)
+	}
+	if err := service.UnlinkContact(ctx, 1, 1); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("second UnlinkContact = %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func TestCompanyServiceDeleteKeepsContacts(t *testing.T) {
+	contacts := repotest.NewContacts(testContact(1, "Ada"))
+	companies := repotest.NewCompanies(contacts, testCompany(1, "Acme"))
+	service := newTestCompanyService(companies, contacts)
+	if err := service.LinkContact(testContext(), 1, 1, ""); err != nil {
+		t.Fatalf("LinkContact: %v", err)
+	}
+
+	if err := service.Delete(testContext(), 1); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	contact, err := contacts.FindByID(testContext(), 1)
+	if err != nil {
+		t.Fatalf("the contact of a deleted company is gone: %v", err)
+	}
+	if len(contact.Companies) != 0 {
+		t.Errorf("companies of the contact = %+v, want none", contact.Companies)
+	}
+}
+
+func TestCompanyServiceUpdate(t *testing.T) {
+	seeded := testCompany(1, "Acme")
+	seeded.Domain = "acme.example"
+	contacts := repotest.NewContacts()
+	service := newTestCompanyService(repotest.NewCompanies(contacts, seeded), contacts)
+
+	details, err := service.Update(testContext(), 1, CompanyInput{Name: "Acme Corp"})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if details.Company.Name != "Acme Corp" || details.Company.Domain != "" {
+		t.Errorf("company = %+v, want every detail replaced", details.Company)
+	}
+	if _, err := service.Update(testContext(), 2, CompanyInput{Name: "Globex"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Update of a missing company = %v, want %v", err, repository.ErrNotFound)
+	}
+}
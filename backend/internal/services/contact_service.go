@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidOwner = errors.New("owner must be a member of the organization")
+
+// ContactInput holds the data of a contact to create or replace
+type ContactInput struct {
+	FirstName string
+	LastName  string
+	JobTitle  string
+	Emails    []models.ContactEmail
+	Phones    []models.ContactPhone
+	Address   models.Address
+	OwnerID   *int
+	Tags      []string
+	// CustomFields holds the values of the contact's custom fields by key
+	CustomFields map[string]interface{}
+}
+
+// ContactService manages the contacts of an organization
+type ContactService struct {
+	contacts      repository.ContactRepository
+	organizations repository.OrganizationRepository
+	fields        repository.CustomFieldRepository
+	segments      *SegmentService
+	logger        *zap.SugaredLogger
+}
+
+// NewContactService creates a new contact service
+func NewContactService(
+	contacts repository.ContactRepository,
+	organizations repository.OrganizationRepository,
+	fields repository.CustomFieldRepository,
+	segments *SegmentService,
+	logger *zap.SugaredLogger,
+) *ContactService {
+	return &ContactService{
+		contacts:      contacts,
+		organizations: organizations,
+		fields:        fields,
+		segments:      segments,
+		logger:        logger,
+	}
+}
+
+// Create adds a contact to the context organization. Without an owner the
+// contact is owned by its creator.
+func (s *ContactService) Create(ctx context.Context, creatorID int, input ContactInput) (*models.Contact, error) {
+	if input.OwnerID == nil {
+		input.OwnerID = &creatorID
+	}
+
+	contact := &models.Contact{}
+	if err := s.apply(ctx, contact, input); err != nil {
+		return nil, err
+	}
+	if err := s.contacts.Create(ctx, contact); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("Contact created", "contact_id", contact.ID, "organization_id", contact.OrganizationID, "created_by", creatorID)
+	return s.contacts.FindByID(ctx, contact.ID)
+}
+
+// Get returns a contact of the context organization
+func (s *ContactService) Get(ctx context.Context, id int) (*models.Contact, error) {
+	return s.contacts.FindByID(ctx, id)
+}
+
+// List returns a page of the context organization's contacts and the number
+// of matching contacts. Conditions on custom fields have their values as
+// given in query strings.
+func (s *ContactService) List(ctx context.Context, filter repository.ContactFilter, page, pageSize int) ([]models.Contact, int64, error) {
+	conditions, customSort, err := customFieldFilter(ctx, s.fields, models.RecordContact, filter.CustomFields, filter.Sort)
+	if err != nil {
+		return nil, 0, err
+	}
+	filter.CustomFields, filter.CustomSort = conditions, customSort
+	if filter.Segment != 0 {
+		if filter.InSegment, err = s.segments.match(ctx, filter.Segment, models.RecordContact); err != nil {
+			return nil, 0, err
+		}
+	}
+	return s.contacts.List(ctx, filter, (page-1)*pageSize, pageSize)
+}
+
+// Update replaces the details of a contact of the context organization
+func (s *ContactService) Update(ctx context.Context, id int, input ContactInput) (*models.Contact, error) {
+	contact, err := s.contacts.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(ctx, contact, input); err != nil {
+		return nil, err
+	}
+	if err := s.contacts.Update(ctx, contact); err != nil {
+		return nil, err
+	}
+	return s.contacts.FindByID(ctx, id)
+}
+
+// Delete removes a contact of the context organization
+func (s *ContactService) Delete(ctx context.Context, id int) error {
+	if err := s.contacts.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.logger.Infow("Contact deleted", "contact_id", id)
+	return nil
+}
+
+// apply copies the input onto the contact after checking the owner and the
+// custom field values
+func (s *ContactService) apply(ctx context.Context, contact *models.Contact, input ContactInput) error {
+	if err := checkOwner(ctx, s.organizations, input.OwnerID); err != nil {
+		return err
+	}
+	values, err := customFieldValues(ctx, s.fields, models.RecordContact, input.CustomFields)
+	if err != nil {
+		return err
+	}
+
+	contact.FirstName = strings.TrimSpace(input.FirstName)
+	contact.LastName = strings.TrimSpace(input.LastName)
+	contact.JobTitle = strings.TrimSpace(input.JobTitle)
+	contact.Address = normalizeAddress(input.Address)
+	contact.OwnerID = input.OwnerID
+	contact.Owner = nil
+
+	contact.Emails = make([]models.ContactEmail, 0, len(input.Emails))
+	seen := make(map[string]bool)
+	for _, email := range input.Emails {
+		address := strings.ToLower(strings.TrimSpace(email.Email))
+		if seen[address] {
+			continue
+		}
+		seen[address] = true
+		contact.Emails = append(contact.Emails, models.ContactEmail{
+			Email:     address,
+			Label:     strings.TrimSpace(email.Label),
+			IsPrimary: email.IsPrimary,
+		})
+	}
+	onePrimary(len(contact.Emails), func(i int) *bool { return &contact.Emails[i].IsPrimary })
+
+	contact.Phones = make([]models.ContactPhone, 0, len(input.Phones))
+	for _, phone := range input.Phones {
+		contact.Phones = append(contact.Phones, models.ContactPhone{
+			Number:    strings.TrimSpace(phone.Number),
+			Label:     strings.TrimSpace(phone.Label),
+			IsPrimary: phone.IsPrimary,
+		})
+	}
+	onePrimary(len(contact.Phones), func(i int) *bool { return &contact.Phones[i].IsPrimary })
+
+	contact.Tags = newTaggings(input.Tags)
+	contact.CustomFields = values
+	return nil
+}
+
+// onePrimary leaves exactly one of n entries flagged as primary: the first
+// flagged one, or the first entry when none is
+func onePrimary(n int, primary func(i int) *bool) {
+	found := false
+	for i := 0; i < n; i++ {
+		if *primary(i) && !found {
+			found = true
+			continue
+		}
+		*primary(i) = false
+	}
+	if !found && n > 0 {
+		*primary(0) = true
+	}
+}
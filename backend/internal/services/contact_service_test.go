@@ -0,0 +1,208 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+// testContact returns a contact of the test organization
+func testContact(id int, firstName string) models.Contact {
+	return models.Contact{ID: id, TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID}, FirstName: firstName}
+}
+
+// newTestContactService returns a ContactService over the contacts, owned by
+// the members of the test organization
+func newTestContactService(contacts *repotest.Contacts) *ContactService {
+	_, organizations := newTestRoles(newTestUsers())
+	return NewContactService(contacts, organizations, repotest.NewCustomFields(), nil, zap.NewNop().Sugar())
+}
+
+func TestContactServiceCreate(t *testing.T) {
+	service := newTestContactService(repotest.NewContacts())
+
+	contact, err := service.Create(testContext(), testAdminID, ContactInput{
+		FirstName: "  Ada ",
+		LastName:  "Lovelace ",
+		Emails: []models.ContactEmail{
+			{Email: "Ada@Example.com ", Label: " work"},
+			{Email: "ada@example.com", IsPrimary: true}, // the same address again
+			{Email: "ada@home.example", IsPrimary: true},
+		},
+		Phones: []models.ContactPhone{
+			{Number: "+1 555 0100", IsPrimary: true},
+			{Number: "+1 555 0101", IsPrimary: true},
+		},
+		Address: models.Address{City: " London "},
+		Tags:    []string{"VIP", " vip", "", "Lead"},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if contact.FirstName != "Ada" || contact.LastName != "Lovelace" || contact.Address.City != "London" {
+		t.Errorf("details were not trimmed: %q %q %q", contact.FirstName, contact.LastName, contact.Address.City)
+	}
+	if contact.OrganizationID != testOrganizationID {
+		t.Errorf("organization = %d, want %d", contact.OrganizationID, testOrganizationID)
+	}
+	if contact.OwnerID == nil || *contact.OwnerID != testAdminID {
+		t.Errorf("owner = %v, want the creator", contact.OwnerID)
+	}
+	wantEmails := []models.ContactEmail{
+		{Email: "ada@example.com", Label: "work", IsPrimary: false},
+		{Email: "ada@home.example", IsPrimary: true},
+	}
+	if !reflect.DeepEqual(contact.Emails, wantEmails) {
+		t.Errorf("emails = %+v, want %+v", contact.Emails, wantEmails)
+	}
+	if !contact.Phones[0].IsPrimary || contact.Phones[1].IsPrimary {
+		t.Errorf("phones = %+v, want only the first primary", contact.Phones)
+	}
+	if tags := contact.TagNames(); !reflect.DeepEqual(tags, []string{"vip", "lead"}) {
+		t.Errorf("tags = %v, want [vip lead]", tags)
+	}
+}
+
+func TestContactServiceCreateMakesFirstEntryPrimary(t *testing.T) {
+	service := newTestContactService(repotest.NewContacts())
+
+	contact, err := service.Create(testContext(), testAdminID, ContactInput{
+		FirstName: "Ada",
+		Emails:    []models.ContactEmail{{Email: "a@example.com"}, {Email: "b@example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !contact.Emails[0].IsPrimary || contact.Emails[1].IsPrimary {
+		t.Errorf("emails = %+v, want the first primary", contact.Emails)
+	}
+}
+
+func TestContactServiceRejectsOwnerOutsideOrganization(t *testing.T) {
+	outsider := testOutsider.ID
+	tests := []struct {
+		name string
+		save func(service *ContactService) error
+	}{
+		{
+			name: "create with an outside owner",
+			save: func(service *ContactService) error {
+				_, err := service.Create(testContext(), testAdminID, ContactInput{FirstName: "Grace", OwnerID: &outsider})
+				return err
+			},
+		},
+		{
+			name: "create by a non-member without an owner",
+			save: func(service *ContactService) error {
+				_, err := service.Create(testContext(), outsider, ContactInput{FirstName: "Grace"})
+				return err
+			},
+		},
+		{
+			name: "update to an outside owner",
+			save: func(service *ContactService) error {
+				_, err := service.Update(testContext(), 1, ContactInput{FirstName: "Ada", OwnerID: &outsider})
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contacts := repotest.NewContacts(testContact(1, "Ada"))
+			if err := tt.save(newTestContactService(contacts)); !errors.Is(err, ErrInvalidOwner) {
+				t.Fatalf("save = %v, want %v", err, ErrInvalidOwner)
+			}
+			listed, total, err := contacts.List(testContext(), repository.ContactFilter{}, 0, 10)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if total != 1 || listed[0].OwnerID != nil {
+				t.Errorf("contacts = %+v, want the seeded contact unchanged", listed)
+			}
+		})
+	}
+}
+
+func TestContactServiceUpdate(t *testing.T) {
+	owner := testAdminID
+	seeded := testContact(1, "Ada")
+	seeded.OwnerID = &owner
+	seeded.Emails = []models.ContactEmail{{Email: "old@example.com", IsPrimary: true}}
+	seeded.Tags = []models.Tagging{{Name: "old"}}
+	service := newTestContactService(repotest.NewContacts(seeded))
+
+	// the update replaces every detail, including clearing the owner
+	contact, err := service.Update(testContext(), 1, ContactInput{
+		FirstName: "Augusta",
+		Emails:    []models.ContactEmail{{Email: "new@example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if contact.FirstName != "Augusta" || contact.OwnerID != nil ||
+		len(contact.Emails) != 1 || !contact.Emails[0].IsPrimary || len(contact.Tags) != 0 {
+		t.Errorf("updated contact = %+v", contact)
+	}
+
+	if _, err := service.Update(testContext(), 2, ContactInput{FirstName: "Nobody"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Update of a missing contact = %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func TestContactServiceDelete(t *testing.T) {
+	service := newTestContactService(repotest.NewContacts(testContact(1, "Ada")))
+
+	if err := service.Delete(testContext(), 1); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := service.Get(testContext(), 1); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want %v", err, repository.ErrNotFound)
+	}
+	if err := service.Delete(testContext(), 1); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("second Delete = %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func TestContactServiceList(t *testing.T) {
+	other := testContact(6, "Ada")
+	other.OrganizationID = testOrganizationID + 1
+	contacts := repotest.NewContacts(
+		testContact(1, "Ada"), testContact(2, "Grace"), testContact(3, "Adele"),
+		testContact(4, "Alan"), testContact(5, "Adam"), other,
+	)
+	service := newTestContactService(contacts)
+
+	tests := []struct {
+		name           string
+		filter         repository.ContactFilter
+		page, pageSize int
+		ids            []int
+		total          int64
+	}{
+		{name: "first page", page: 1, pageSize: 2, ids: []int{5, 4}, total: 5},
+		{name: "later page", page: 3, pageSize: 2, ids: []int{1}, total: 5},
+		{name: "past the end", page: 4, pageSize: 2, total: 5},
+		{name: "search", filter: repository.ContactFilter{Search: "ad"}, page: 1, pageSize: 20, ids: []int{5, 3, 1}, total: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listed, total, err := service.List(testContext(), tt.filter, tt.page, tt.pageSize)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var ids []int
+			for _, contact := range listed {
+				ids = append(ids, contact.ID)
+			}
+			if !equalIDs(ids, tt.ids) || total != tt.total {
+				t.Errorf("listed %v of %d, want %v of %d", ids, total, tt.ids, tt.total)
+			}
+		})
+	}
+}
@@ -0,0 +1,461 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidCustomField  = errors.New("invalid custom field")
+	ErrCustomFieldExists   = errors.New("a custom field with this key already exists")
+	ErrInvalidCustomValues = errors.New("invalid custom field values")
+)
+
+// customFieldKeyPattern is the format of custom field keys, which name the
+// fields in requests, responses and query strings
+var customFieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// customFieldPrefix marks a sort parameter or segment rule naming a custom
+// field, as in "-cf.renewal_date" or "cf.tier = gold"
+const customFieldPrefix = "cf."
+
+// CustomValuesError lists what is wrong with custom field values or
+// conditions, by field key. It matches ErrInvalidCustomValues.
+type CustomValuesError struct {
+	Fields map[string]string
+}
+
+func (e *CustomValuesError) Error() string {
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("%s: %s", ErrInvalidCustomValues, strings.Join(keys, ", "))
+}
+
+// Is makes errors.Is match ErrInvalidCustomValues
+func (e *CustomValuesError) Is(target error) bool {
+	return target == ErrInvalidCustomValues
+}
+
+// CustomFieldInput holds the definition of a custom field. The record type,
+// key and type of a field cannot change once it is created.
+type CustomFieldInput struct {
+	RecordType string
+	Key        string
+	Label      string
+	Type       string
+	Required   bool
+	Options    []string
+	Min        *float64
+	Max        *float64
+	Pattern    string
+	Position   int
+}
+
+// CustomFieldService manages the custom fields organizations add to their
+// contacts, companies and deals
+type CustomFieldService struct {
+	fields repository.CustomFieldRepository
+	logger *zap.SugaredLogger
+}
+
+// NewCustomFieldService creates a new custom field service
+func NewCustomFieldService(fields repository.CustomFieldRepository, logger *zap.SugaredLogger) *CustomFieldService {
+	return &CustomFieldService{
+		fields: fields,
+		logger: logger,
+	}
+}
+
+// Create defines a custom field on a type of record of the context organization
+func (s *CustomFieldService) Create(ctx context.Context, input CustomFieldInput) (*models.CustomField, error) {
+	key := strings.TrimSpace(input.Key)
+	if !customFieldKeyPattern.MatchString(key) {
+		return nil, fmt.Errorf("%w: keys must start with a lowercase letter followed by lowercase letters, digits or underscores", ErrInvalidCustomField)
+	}
+
+	field := &models.CustomField{RecordType: input.RecordType, Key: key, Type: input.Type}
+	if err := s.apply(field, input); err != nil {
+		return nil, err
+	}
+	if err := s.fields.Create(ctx, field); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, ErrCustomFieldExists
+		}
+		return nil, err
+	}
+
+	s.logger.Infow("Custom field created", "custom_field_id", field.ID, "organization_id", field.OrganizationID, "record_type", field.RecordType, "key", field.Key)
+	return field, nil
+}
+
+// Get returns a custom field of the context organization
+func (s *CustomFieldService) Get(ctx context.Context, id int) (*models.CustomField, error) {
+	return s.fields.FindByID(ctx, id)
+}
+
+// List returns the context organization's custom fields of a record type, or
+// of every type when recordType is empty
+func (s *CustomFieldService) List(ctx context.Context, recordType string) ([]models.CustomField, error) {
+	return s.fields.List(ctx, recordType)
+}
+
+// Update replaces the definition of a custom field, keeping its record type,
+// key and type. Values already stored are checked against the new rules the
+// next time their record is saved.
+func (s *CustomFieldService) Update(ctx context.Context, id int, input CustomFieldInput) (*models.CustomField, error) {
+	field, err := s.fields.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(field, input); err != nil {
+		return nil, err
+	}
+	if err := s.fields.Update(ctx, field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// Delete removes a custom field and its values from the records
+func (s *CustomFieldService) Delete(ctx context.Context, id int) error {
+	field, err := s.fields.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.fields.Delete(ctx, field); err != nil {
+		return err
+	}
+	s.logger.Infow("Custom field deleted", "custom_field_id", id, "record_type", field.RecordType, "key", field.Key)
+	return nil
+}
+
+// apply copies the input onto the field after checking that its rules fit
+// the field's type
+func (s *CustomFieldService) apply(field *models.CustomField, input CustomFieldInput) error {
+	options := make([]string, 0, len(input.Options))
+	seen := make(map[string]bool, len(input.Options))
+	for _, option := range input.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || seen[option] {
+			continue
+		}
+		seen[option] = true
+		options = append(options, option)
+	}
+
+	isSelect := field.Type == models.CustomFieldSelect || field.Type == models.CustomFieldMultiSelect
+	switch {
+	case isSelect && len(options) == 0:
+		return fmt.Errorf("%w: select fields need options", ErrInvalidCustomField)
+	case !isSelect && len(options) > 0:
+		return fmt.Errorf("%w: only select fields have options", ErrInvalidCustomField)
+	}
+
+	bounded := field.Type == models.CustomFieldText || field.Type == models.CustomFieldNumber ||
+		field.Type == models.CustomFieldURL || field.Type == models.CustomFieldMultiSelect
+	switch {
+	case !bounded && (input.Min != nil || input.Max != nil):
+		return fmt.Errorf("%w: %s fields cannot have a minimum or maximum", ErrInvalidCustomField, field.Type)
+	case input.Min != nil && input.Max != nil && *input.Min > *input.Max:
+		return fmt.Errorf("%w: the minimum is greater than the maximum", ErrInvalidCustomField)
+	}
+
+	pattern := strings.TrimSpace(input.Pattern)
+	if pattern != "" {
+		if field.Type != models.CustomFieldText {
+			return fmt.Errorf("%w: only text fields have a pattern", ErrInvalidCustomField)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("%w: the pattern is not a valid regular expression", ErrInvalidCustomField)
+		}
+	}
+
+	field.Label = strings.TrimSpace(input.Label)
+	field.Required = input.Required
+	field.Options = options
+	field.Min = input.Min
+	field.Max = input.Max
+	field.Pattern = pattern
+	field.Position = input.Position
+	return nil
+}
+
+// customFieldValues checks the custom field values of a record against the
+// fields defined on its type and returns them normalized. Empty values are
+// dropped.
+func customFieldValues(
+	ctx context.Context,
+	fields repository.CustomFieldRepository,
+	recordType string,
+	values map[string]interface{},
+) (models.CustomFieldValues, error) {
+	definitions, err := fields.List(ctx, recordType)
+	if err != nil {
+		return nil, err
+	}
+
+	result := models.CustomFieldValues{}
+	problems := make(map[string]string)
+	defined := make(map[string]bool, len(definitions))
+	for i := range definitions {
+		field := &definitions[i]
+		defined[field.Key] = true
+
+		value, problem := customFieldValue(field, values[field.Key])
+		switch {
+		case problem != "":
+			problems[field.Key] = problem
+		case value != nil:
+			result[field.Key] = value
+		case field.Required:
+			problems[field.Key] = "is required"
+		}
+	}
+	for key := range values {
+		if !defined[key] {
+			problems[key] = "is not a custom field"
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &CustomValuesError{Fields: problems}
+	}
+	return result, nil
+}
+
+// customFieldValue checks a value decoded from JSON against a field's type
+// and rules. It returns the normalized value, nil for an empty value, or what
+// is wrong with the value.
+func customFieldValue(field *models.CustomField, value interface{}) (interface{}, string) {
+	if value == nil {
+		return nil, ""
+	}
+
+	switch field.Type {
+	case models.CustomFieldNumber:
+		number, ok := value.(float64)
+		if !ok {
+			return nil, "must be a number"
+		}
+		if problem := checkBounds(field, number, "must be %s %s"); problem != "" {
+			return nil, problem
+		}
+		return number, ""
+
+	case models.CustomFieldBoolean:
+		if _, ok := value.(bool); !ok {
+			return nil, "must be true or false"
+		}
+		return value, ""
+
+	case models.CustomFieldMultiSelect:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, "must be a list of options"
+		}
+		choices := make([]string, 0, len(items))
+		seen := make(map[string]bool, len(items))
+		for _, item := range items {
+			choice, ok := item.(string)
+			if !ok || !hasOption(field, choice) {
+				return nil, "must be a list of " + strings.Join(field.Options, ", ")
+			}
+			if !seen[choice] {
+				seen[choice] = true
+				choices = append(choices, choice)
+			}
+		}
+		if len(choices) == 0 {
+			return nil, ""
+		}
+		if problem := checkBounds(field, float64(len(choices)), "must have %s %s choices"); problem != "" {
+			return nil, problem
+		}
+		return choices, ""
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return nil, "must be a string"
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ""
+	}
+
+	switch field.Type {
+	case models.CustomFieldDate:
+		if _, err := time.Parse("2006-01-02", text); err != nil {
+			return nil, "must be a date formatted as YYYY-MM-DD"
+		}
+	case models.CustomFieldSelect:
+		if !hasOption(field, text) {
+			return nil, "must be one of " + strings.Join(field.Options, ", ")
+		}
+	case models.CustomFieldURL:
+		link, err := url.Parse(text)
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+			return nil, "must be an http or https URL"
+		}
+		fallthrough
+	default:
+		if problem := checkBounds(field, float64(utf8.RuneCountInString(text)), "must be %s %s characters long"); problem != "" {
+			return nil, problem
+		}
+		if field.Pattern != "" && !regexp.MustCompile(field.Pattern).MatchString(text) {
+			return nil, "must match " + field.Pattern
+		}
+	}
+	return text, ""
+}
+
+// checkBounds checks a measure of a value against the minimum and maximum of
+// its field. What is wrong with the value is described by the format, given
+// "at least" or "at most" and the bound.
+func checkBounds(field *models.CustomField, measure float64, format string) string {
+	if field.Min != nil && measure < *field.Min {
+		return fmt.Sprintf(format, "at least", formatBound(*field.Min))
+	}
+	if field.Max != nil && measure > *field.Max {
+		return fmt.Sprintf(format, "at most", formatBound(*field.Max))
+	}
+	return ""
+}
+
+func formatBound(bound float64) string {
+	return strconv.FormatFloat(bound, 'f', -1, 64)
+}
+
+// hasOption reports whether a choice is one of the options of a select field
+func hasOption(field *models.CustomField, choice string) bool {
+	for _, option := range field.Options {
+		if option == choice {
+			return true
+		}
+	}
+	return false
+}
+
+// customFieldFilter checks conditions on custom fields, with values as given
+// in query strings, against the fields defined on a record type and converts
+// their values. A custom field named in the sort parameter is returned as a
+// custom sort placed among the other sorts.
+func customFieldFilter(
+	ctx context.Context,
+	fields repository.CustomFieldRepository,
+	recordType string,
+	conditions []repository.CustomFieldCondition,
+	sortParam string,
+) ([]repository.CustomFieldCondition, *repository.CustomFieldSort, error) {
+	sortKeys, desc, position := customSorts(sortParam)
+	if len(conditions) == 0 && len(sortKeys) == 0 {
+		return nil, nil, nil
+	}
+
+	definitions, err := fields.List(ctx, recordType)
+	if err != nil {
+		return nil, nil, err
+	}
+	byKey := make(map[string]*models.CustomField, len(definitions))
+	for i := range definitions {
+		byKey[definitions[i].Key] = &definitions[i]
+	}
+
+	problems := make(map[string]string)
+	resolved := make([]repository.CustomFieldCondition, 0, len(conditions))
+	for _, condition := range conditions {
+		field, ok := byKey[condition.Key]
+		if !ok {
+			problems[condition.Key] = "is not a custom field"
+			continue
+		}
+		value, problem := customFieldCondition(field, condition.Op, fmt.Sprint(condition.Value))
+		if problem != "" {
+			problems[condition.Key] = problem
+			continue
+		}
+		resolved = append(resolved, repository.CustomFieldCondition{Key: field.Key, Type: field.Type, Op: condition.Op, Value: value})
+	}
+
+	var order *repository.CustomFieldSort
+	if len(sortKeys) > 1 {
+		problems["sort"] = "can name only one custom field"
+	} else if len(sortKeys) == 1 {
+		field, ok := byKey[sortKeys[0]]
+		switch {
+		case !ok:
+			problems[sortKeys[0]] = "is not a custom field"
+		case field.Type == models.CustomFieldMultiSelect:
+			problems[sortKeys[0]] = "cannot be sorted on"
+		default:
+			order = &repository.CustomFieldSort{Key: field.Key, Type: field.Type, Desc: desc, Position: position}
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, nil, &CustomValuesError{Fields: problems}
+	}
+	return resolved, order, nil
+}
+
+// customSorts returns the keys of the custom fields named in a sort
+// parameter such as "-cf.tier,last_name", whether the last of them is sorted
+// in descending order and the number of other distinct fields before it
+func customSorts(sortParam string) (keys []string, desc bool, position int) {
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(sortParam, ",") {
+		name = strings.TrimSpace(name)
+		field := strings.TrimPrefix(name, "-")
+		if key, ok := strings.CutPrefix(field, customFieldPrefix); ok {
+			keys, desc = append(keys, key), field != name
+		} else if field != "" && !seen[field] && len(keys) == 0 {
+			seen[field] = true
+			position++
+		}
+	}
+	return keys, desc, position
+}
+
+// customFieldCondition converts the text value of a condition on a field,
+// returning what is wrong with the condition if anything
+func customFieldCondition(field *models.CustomField, op, text string) (interface{}, string) {
+	ranged := field.Type == models.CustomFieldNumber || field.Type == models.CustomFieldDate
+	if op != repository.CustomFieldEq && !ranged {
+		return nil, "only numbers and dates can be compared with " + op
+	}
+
+	switch field.Type {
+	case models.CustomFieldNumber:
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, "must be compared with a number"
+		}
+		return number, ""
+	case models.CustomFieldBoolean:
+		value, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, "must be compared with true or false"
+		}
+		return value, ""
+	case models.CustomFieldDate:
+		if _, err := time.Parse("2006-01-02", text); err != nil {
+			return nil, "must be compared with a date formatted as YYYY-MM-DD"
+		}
+	}
+	return text, ""
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+func bound(value float64) *float64 {
+	return &value
+}
+
+// testFields returns contact fields of every type and a required company
+// field of the test organization
+func testFields() []models.CustomField {
+	fields := []models.CustomField{
+		{ID: 1, RecordType: models.RecordContact, Key: "nickname", Type: models.CustomFieldText, Min: bound(2), Max: bound(5), Pattern: "^[a-z]+$"},
+		{ID: 2, RecordType: models.RecordContact, Key: "score", Type: models.CustomFieldNumber, Min: bound(0), Max: bound(10)},
+		{ID: 3, RecordType: models.RecordContact, Key: "birthday", Type: models.CustomFieldDate},
+		{ID: 4, RecordType: models.RecordContact, Key: "tier", Type: models.CustomFieldSelect, Options: []string{"gold", "silver"}},
+		{ID: 5, RecordType: models.RecordContact, Key: "topics", Type: models.CustomFieldMultiSelect, Options: []string{"a", "b", "c"}, Max: bound(2)},
+		{ID: 6, RecordType: models.RecordContact, Key: "vip", Type: models.CustomFieldBoolean},
+		{ID: 7, RecordType: models.RecordContact, Key: "website", Type: models.CustomFieldURL},
+		{ID: 8, RecordType: models.RecordCompany, Key: "region", Type: models.CustomFieldText, Required: true},
+	}
+	for i := range fields {
+		fields[i].OrganizationID = testOrganizationID
+	}
+	return fields
+}
+
+func TestCustomFieldServiceCreate(t *testing.T) {
+	fields := repotest.NewCustomFields()
+	service := NewCustomFieldService(fields, zap.NewNop().Sugar())
+
+	field, err := service.Create(testContext(), CustomFieldInput{
+		RecordType: models.RecordDeal,
+		Key:        " renewal_tier ",
+		Label:      " Renewal tier ",
+		Type:       models.CustomFieldSelect,
+		Options:    []string{" gold", "silver", "gold", ""},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if field.Key != "renewal_tier" || field.Label != "Renewal tier" || !reflect.DeepEqual(field.Options, []string{"gold", "silver"}) {
+		t.Errorf("field = %+v", field)
+	}
+
+	_, err = service.Create(testContext(), CustomFieldInput{
+		RecordType: models.RecordDeal, Key: "renewal_tier", Label: "Tier", Type: models.CustomFieldText,
+	})
+	if !errors.Is(err, ErrCustomFieldExists) {
+		t.Errorf("Create with a taken key = %v, want %v", err, ErrCustomFieldExists)
+	}
+	if _, err := service.Create(testContext(), CustomFieldInput{
+		RecordType: models.RecordContact, Key: "renewal_tier", Label: "Tier", Type: models.CustomFieldText,
+	}); err != nil {
+		t.Errorf("Create with a key taken on another record type: %v", err)
+	}
+}
+
+func TestCustomFieldServiceRejectsInvalidDefinitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		input CustomFieldInput
+	}{
+		{"upper-case key", CustomFieldInput{Key: "Tier", Type: models.CustomFieldText}},
+		{"key starting with a digit", CustomFieldInput{Key: "1st_contact", Type: models.CustomFieldText}},
+		{"key with a hyphen", CustomFieldInput{Key: "renewal-date", Type: models.CustomFieldDate}},
+		{"key that is too long", CustomFieldInput{Key: "k" + strings.Repeat("x", 64), Type: models.CustomFieldText}},
+		{"select without options", CustomFieldInput{Key: "tier", Type: models.CustomFieldSelect, Options: []string{" "}}},
+		{"text with options", CustomFieldInput{Key: "tier", Type: models.CustomFieldText, Options: []string{"gold"}}},
+		{"boolean with a minimum", CustomFieldInput{Key: "vip", Type: models.CustomFieldBoolean, Min: bound(0)}},
+		{"date with a maximum", CustomFieldInput{Key: "birthday", Type: models.CustomFieldDate, Max: bound(1)}},
+		{"minimum above the maximum", CustomFieldInput{Key: "score", Type: models.CustomFieldNumber, Min: bound(5), Max: bound(1)}},
+		{"pattern on a number", CustomFieldInput{Key: "score", Type: models.CustomFieldNumber, Pattern: "^[0-9]+$"}},
+		{"invalid pattern", CustomFieldInput{Key: "nickname", Type: models.CustomFieldText, Pattern: "(unclosed"}},
+	}
+	for _, tt := range tests {
+		fields := repotest.NewCustomFields()
+		service := NewCustomFieldService(fields, zap.NewNop().Sugar())
+		tt.input.RecordType, tt.input.Label = models.RecordContact, "Field"
+		if _, err := service.Create(testContext(), tt.input); !errors.Is(err, ErrInvalidCustomField) {
+			t.Errorf("%s: Create = %v, want %v", tt.name, err, ErrInvalidCustomField)
+		}
+		if saved, err := fields.List(testContext(), ""); err != nil || len(saved) != 0 {
+			t.Errorf("%s: List = %+v, %v, want the field not saved", tt.name, saved, err)
+		}
+	}
+}
+
+func TestCustomFieldServiceUpdateKeepsKeyAndType(t *testing.T) {
+	fields := repotest.NewCustomFields(testFields()...)
+	service := NewCustomFieldService(fields, zap.NewNop().Sugar())
+
+	field, err := service.Update(testContext(), 4, CustomFieldInput{
+		Key: "rank", Type: models.CustomFieldText, Label: "Tier", Options: []string{"gold", "silver", "bronze"}, Required: true,
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if field.Key != "tier" || field.Type != models.CustomFieldSelect || !field.Required || len(field.Options) != 3 {
+		t.Errorf("field = %+v, want new rules on the same key and type", field)
+	}
+
+	// the rules are checked against the stored type
+	if _, err := service.Update(testContext(), 4, CustomFieldInput{Label: "Tier"}); !errors.Is(err, ErrInvalidCustomField) {
+		t.Errorf("Update of a select without options = %v, want %v", err, ErrInvalidCustomField)
+	}
+	if _, err := service.Update(testContext(), 9, CustomFieldInput{Label: "Tier"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Update of a missing field = %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func TestCustomFieldValues(t *testing.T) {
+	tests := []struct {
+		key     string
+		value   interface{}
+		want    interface{} // the normalized value, when valid
+		problem string
+	}{
+		{"nickname", " ada ", "ada", ""},
+		{"nickname", "a", nil, "must be at least 2 characters long"},
+		{"nickname", "adalovelace", nil, "must be at most 5 characters long"},
+		{"nickname", "Ada", nil, "must match ^[a-z]+$"},
+		{"nickname", 5.0, nil, "must be a string"},
+		{"nickname", "  ", nil, ""}, // empty values are dropped
+		{"score", 7.5, 7.5, ""},
+		{"score", 11.0, nil, "must be at most 10"},
+		{"score", -1.0, nil, "must be at least 0"},
+		{"score", "7", nil, "must be a number"},
+		{"birthday", "1815-12-10", "1815-12-10", ""},
+		{"birthday", "10/12/1815", nil, "must be a date formatted as YYYY-MM-DD"},
+		{"tier", "gold", "gold", ""},
+		{"tier", "bronze", nil, "must be one of gold, silver"},
+		{"topics", []interface{}{"a", "b", "a"}, []string{"a", "b"}, ""},
+		{"topics", []interface{}{"a", "b", "c"}, nil, "must have at most 2 choices"},
+		{"topics", []interface{}{"d"}, nil, "must be a list of a, b, c"},
+		{"topics", "a", nil, "must be a list of options"},
+		{"topics", []interface{}{}, nil, ""},
+		{"vip", true, true, ""},
+		{"vip", "yes", nil, "must be true or false"},
+		{"website", "https://example.com/ada", "https://example.com/ada", ""},
+		{"website", "ftp://example.com", nil, "must be an http or https URL"},
+		{"website", "example.com", nil, "must be an http or https URL"},
+	}
+	fields := repotest.NewCustomFields(testFields()...)
+	for _, tt := range tests {
+		values, err := customFieldValues(testContext(), fields, models.RecordContact, map[string]interface{}{tt.key: tt.value})
+		if tt.problem != "" {
+			var invalid *CustomValuesError
+			if !errors.As(err, &invalid) || invalid.Fields[tt.key] != tt.problem {
+				t.Errorf("%s = %#v: error %v, want %q", tt.key, tt.value, err, tt.problem)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s = %#v: %v", tt.key, tt.value, err)
+			continue
+		}
+		if got, ok := values[tt.key]; (tt.want == nil && ok) || (tt.want != nil && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("%s = %#v: stored %#v, want %#v", tt.key, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCustomFieldValuesReportsEveryProblem(t *testing.T) {
+	fields := repotest.NewCustomFields(testFields()...)
+
+	_, err := customFieldValues(testContext(), fields, models.RecordCompany, map[string]interface{}{
+		"tier":   "gold", // a contact field
+		"region": nil,
+	})
+	if !errors.Is(err, ErrInvalidCustomValues) {
+		t.Fatalf("customFieldValues = %v, want %v", err, ErrInvalidCustomValues)
+	}
+	var invalid *CustomValuesError
+	errors.As(err, &invalid)
+	want := map[string]string{"tier": "is not a custom field", "region": "is required"}
+	if !reflect.DeepEqual(invalid.Fields, want) {
+		t.Errorf("problems = %v, want %v", invalid.Fields, want)
+	}
+	if err.Error() != "invalid custom field values: region, tier" {
+		t.Errorf("error = %q", err)
+	}
+}
+
+func TestCustomFieldFilter(t *testing.T) {
+	fields := repotest.NewCustomFields(testFields()...)
+
+	conditions, order, err := customFieldFilter(testContext(), fields, models.RecordContact, []repository.CustomFieldCondition{
+		{Key: "score", Op: repository.CustomFieldGte, Value: "2.5"},
+		{Key: "vip", Op: repository.CustomFieldEq, Value: "true"},
+		{Key: "birthday", Op: repository.CustomFieldLte, Value: "2000-01-01"},
+		{Key: "tier", Op: repository.CustomFieldEq, Value: "gold"},
+	}, "-cf.birthday")
+	if err != nil {
+		t.Fatalf("customFieldFilter: %v", err)
+	}
+	want := []repository.CustomFieldCondition{
+		{Key: "score", Type: models.CustomFieldNumber, Op: repository.CustomFieldGte, Value: 2.5},
+		{Key: "vip", Type: models.CustomFieldBoolean, Op: repository.CustomFieldEq, Value: true},
+		{Key: "birthday", Type: models.CustomFieldDate, Op: repository.CustomFieldLte, Value: "2000-01-01"},
+		{Key: "tier", Type: models.CustomFieldSelect, Op: repository.CustomFieldEq, Value: "gold"},
+	}
+	if !reflect.DeepEqual(conditions, want) {
+		t.Errorf("conditions = %+v, want %+v", conditions, want)
+	}
+	if order == nil || *order != (repository.CustomFieldSort{Key: "birthday", Type: models.CustomFieldDate, Desc: true}) {
+		t.Errorf("order = %+v, want birthday descending", order)
+	}
+
+	// the custom field sort keeps its place among the other sorts
+	_, order, err = customFieldFilter(testContext(), fields, models.RecordContact, nil, "last_name,last_name,cf.score,-created_at")
+	if err != nil || order == nil || *order != (repository.CustomFieldSort{Key: "score", Type: models.CustomFieldNumber, Position: 1}) {
+		t.Errorf("order = %+v, %v, want score after last_name", order, err)
+	}
+
+	// sorting on a built-in field needs no custom field
+	if conditions, order, err := customFieldFilter(testContext(), fields, models.RecordContact, nil, "-created_at"); err != nil || conditions != nil || order != nil {
+		t.Errorf("customFieldFilter without custom fields = %v, %v, %v", conditions, order, err)
+	}
+}
+
+func TestCustomFieldFilterRejectsInvalidConditions(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition repository.CustomFieldCondition
+		sort      string
+		key       string
+		problem   string
+	}{
+		{"unknown field", repository.CustomFieldCondition{Key: "region", Op: repository.CustomFieldEq, Value: "EU"}, "",
+			"region", "is not a custom field"},
+		{"range on text", repository.CustomFieldCondition{Key: "nickname", Op: repository.CustomFieldGte, Value: "a"}, "",
+			"nickname", "only numbers and dates can be compared with gte"},
+		{"number that is not one", repository.CustomFieldCondition{Key: "score", Op: repository.CustomFieldEq, Value: "high"}, "",
+			"score", "must be compared with a number"},
+		{"boolean that is not one", repository.CustomFieldCondition{Key: "vip", Op: repository.CustomFieldEq, Value: "maybe"}, "",
+			"vip", "must be compared with true or false"},
+		{"date that is not one", repository.CustomFieldCondition{Key: "birthday", Op: repository.CustomFieldEq, Value: "yesterday"}, "",
+			"birthday", "must be compared with a date formatted as YYYY-MM-DD"},
+		{"sort on a multi-select", repository.CustomFieldCondition{Key: "tier", Op: repository.CustomFieldEq, Value: "gold"}, "cf.topics",
+			"topics", "cannot be sorted on"},
+		{"sort on an unknown field", repository.CustomFieldCondition{Key: "tier", Op: repository.CustomFieldEq, Value: "gold"}, "-cf.region",
+			"region", "is not a custom field"},
+		{"sort on two custom fields", repository.CustomFieldCondition{Key: "tier", Op: repository.CustomFieldEq, Value: "gold"}, "cf.score,-cf.birthday",
+			"sort", "can name only one custom field"},
+	}
+	fields := repotest.NewCustomFields(testFields()...)
+	for _, tt := range tests {
+		_, _, err := customFieldFilter(testContext(), fields, models.RecordContact, []repository.CustomFieldCondition{tt.condition}, tt.sort)
+		var invalid *CustomValuesError
+		if !errors.As(err, &invalid) || len(invalid.Fields) != 1 || invalid.Fields[tt.key] != tt.problem {
+			t.Errorf("%s: customFieldFilter = %v, want %s %q", tt.name, err, tt.key, tt.problem)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidPipeline = errors.New("pipeline not found")
+	ErrInvalidStage    = errors.New("stage must belong to the pipeline")
+	ErrInvalidCompany  = errors.New("company not found")
+	ErrInvalidContacts = errors.New("contacts not found")
+	ErrDealClosed      = errors.New("deal is already won or lost")
+	ErrDealNotClosed   = errors.New("deal is still open")
+)
+
+// DealInput holds the data of a deal to create or replace. Deals change stage
+// and status through Move, Win, Lose and Reopen only.
+type DealInput struct {
+	Title             string
+	Amount            float64
+	Currency          string
+	ExpectedCloseDate *time.Time
+	OwnerID           *int
+	CompanyID         *int
+	ContactIDs        []int
+	Tags              []string
+	// CustomFields holds the values of the deal's custom fields by key
+	CustomFields map[string]interface{}
+}
+
+// DealService manages the deals of an organization as they move through the
+// stages of its pipelines, recording every transition
+type DealService struct {
+	deals         repository.DealRepository
+	pipelines     repository.PipelineRepository
+	companies     repository.CompanyRepository
+	contacts      repository.ContactRepository
+	organizations repository.OrganizationRepository
+	fields        repository.CustomFieldRepository
+	segments      *SegmentService
+	transactor    repository.Transactor
+	logger        *zap.SugaredLogger
+}
+
+// NewDealService creates a new deal service
+func NewDealService(
+	deals repository.DealRepository,
+	pipelines repository.PipelineRepository,
+	companies repository.CompanyRepository,
+	contacts repository.ContactRepository,
+	organizations repository.OrganizationRepository,
+	fields repository.CustomFieldRepository,
+	segments *SegmentService,
+	transactor repository.Transactor,
+	logger *zap.SugaredLogger,
+) *DealService {
+	return &DealService{
+		deals:         deals,
+		pipelines:     pipelines,
+		companies:     companies,
+		contacts:      contacts,
+		organizations: organizations,
+		fields:        fields,
+		segments:      segments,
+		transactor:    transactor,
+		logger:        logger,
+	}
+}
+
+// Create adds an open deal to a pipeline of the context organization, in the
+// given stage or else the pipeline's first stage. Without an owner the deal is
+// owned by its creator.
+func (s *DealService) Create(ctx context.Context, creatorID, pipelineID, stageID int, input DealInput) (*models.Deal, error) {
+	if input.OwnerID == nil {
+		input.OwnerID = &creatorID
+	}
+
+	pipeline, err := s.pipelines.FindByID(ctx, pipelineID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidPipeline
+		}
+		return nil, err
+	}
+	stage, err := pipelineStage(pipeline, stageID)
+	if err != nil {
+		return nil, err
+	}
+
+	deal := &models.Deal{
+		Status:         models.DealOpen,
+		PipelineID:     pipeline.ID,
+		StageID:        stage.ID,
+		StageChangedAt: time.Now(),
+	}
+	if err := s.apply(ctx, deal, input); err != nil {
+		return nil, err
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.deals.Create(ctx, deal); err != nil {
+			return err
+		}
+		return s.deals.RecordStageChange(ctx, &models.DealStageChange{
+			DealID:      deal.ID,
+			ToStageID:   deal.StageID,
+			Status:      deal.Status,
+			ChangedByID: &creatorID,
+			CreatedAt:   deal.StageChangedAt,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("Deal created", "deal_id", deal.ID, "organization_id", deal.OrganizationID, "created_by", creatorID)
+	return s.deals.FindByID(ctx, deal.ID)
+}
+
+// Get returns a deal of the context organization
+func (s *DealService) Get(ctx context.Context, id int) (*models.Deal, error) {
+	return s.deals.FindByID(ctx, id)
+}
+
+// List returns a page of the context organization's deals and the number of
+// matching deals. Conditions on custom fields have their values as given in
+// query strings.
+func (s *DealService) List(ctx context.Context, filter repository.DealFilter, page, pageSize int) ([]models.Deal, int64, error) {
+	conditions, customSort, err := customFieldFilter(ctx, s.fields, models.RecordDeal, filter.CustomFields, filter.Sort)
+	if err != nil {
+		return nil, 0, err
+	}
+	filter.CustomFields, filter.CustomSort = conditions, customSort
+	if filter.Segment != 0 {
+		if filter.InSegment, err = s.segments.match(ctx, filter.Segment, models.RecordDeal); err != nil {
+			return nil, 0, err
+		}
+	}
+	return s.deals.List(ctx, filter, (page-1)*pageSize, pageSize)
+}
+
+// Update replaces the details of a deal of the context organization
+func (s *DealService) Update(ctx context.Context, id int, input DealInput) (*models.Deal, error) {
+	deal, err := s.deals.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(ctx, deal, input); err != nil {
+		return nil, err
+	}
+	if err := s.deals.Update(ctx, deal); err != nil {
+		return nil, err
+	}
+	return s.deals.FindByID(ctx, id)
+}
+
+// Delete removes a deal of the context organization with its stage history
+func (s *DealService) Delete(ctx context.Context, id int) error {
+	if err := s.deals.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.logger.Infow("Deal deleted", "deal_id", id)
+	return nil
+}
+
+// Move moves an open deal to another stage, which may belong to another
+// pipeline
+func (s *DealService) Move(ctx context.Context, actorID, id, stageID int) (*models.Deal, error) {
+	return s.transition(ctx, actorID, id, func(ctx context.Context, deal *models.Deal) (string, error) {
+		if !deal.Open() {
+			return "", ErrDealClosed
+		}
+		stage, err := s.pipelines.FindStage(ctx, stageID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return "", ErrInvalidStage
+			}
+			return "", err
+		}
+		deal.PipelineID, deal.StageID = stage.PipelineID, stage.ID
+		return "", nil
+	})
+}
+
+// Win marks an open deal as won, for an optional reason
+func (s *DealService) Win(ctx context.Context, actorID, id int, reason string) (*models.Deal, error) {
+	return s.close(ctx, actorID, id, models.DealWon, reason)
+}
+
+// Lose marks an open deal as lost for a reason
+func (s *DealService) Lose(ctx context.Context, actorID, id int, reason string) (*models.Deal, error) {
+	return s.close(ctx, actorID, id, models.DealLost, reason)
+}
+
+// Reopen puts a won or lost deal back in its stage
+func (s *DealService) Reopen(ctx context.Context, actorID, id int) (*models.Deal, error) {
+	return s.transition(ctx, actorID, id, func(ctx context.Context, deal *models.Deal) (string, error) {
+		if deal.Open() {
+			return "", ErrDealNotClosed
+		}
+		deal.Status, deal.CloseReason, deal.ClosedAt = models.DealOpen, "", nil
+		return "", nil
+	})
+}
+
+// History returns the stage changes of a deal, oldest first
+func (s *DealService) History(ctx context.Context, id int) ([]models.DealStageChange, error) {
+	if _, err := s.deals.FindByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.deals.ListStageChanges(ctx, id)
+}
+
+// close marks an open deal as won or lost
+func (s *DealService) close(ctx context.Context, actorID, id int, status, reason string) (*models.Deal, error) {
+	return s.transition(ctx, actorID, id, func(ctx context.Context, deal *models.Deal) (string, error) {
+		if !deal.Open() {
+			return "", ErrDealClosed
+		}
+		now := time.Now()
+		deal.Status, deal.CloseReason, deal.ClosedAt = status, strings.TrimSpace(reason), &now
+		return deal.CloseReason, nil
+	})
+}
+
+// transition applies a change of stage or status to a deal and records it
+// together with the time the deal had spent in its previous stage and status
+func (s *DealService) transition(
+	ctx context.Context,
+	actorID, id int,
+	change func(ctx context.Context, deal *models.Deal) (reason string, err error),
+) (*models.Deal, error) {
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		deal, err := s.deals.FindByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		fromStageID, fromStatus, entered := deal.StageID, deal.Status, deal.StageChangedAt
+
+		reason, err := change(ctx, deal)
+		if err != nil {
+			return err
+		}
+		if deal.StageID == fromStageID && deal.Status == fromStatus {
+			return nil // moved to the stage it is in
+		}
+		now := time.Now()
+		deal.StageChangedAt = now
+		if err := s.deals.UpdateStatus(ctx, deal); err != nil {
+			return err
+		}
+		return s.deals.RecordStageChange(ctx, &models.DealStageChange{
+			DealID:              deal.ID,
+			FromStageID:         &fromStageID,
+			ToStageID:           deal.StageID,
+			Status:              deal.Status,
+			Reason:              reason,
+			ChangedByID:         &actorID,
+			TimeInPreviousStage: now.Sub(entered),
+			CreatedAt:           now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("Deal stage changed", "deal_id", id, "changed_by", actorID)
+	return s.deals.FindByID(ctx, id)
+}
+
+// apply copies the input onto the deal after checking the owner, company,
+// contacts and custom field values
+func (s *DealService) apply(ctx context.Context, deal *models.Deal, input DealInput) error {
+	if err := checkOwner(ctx, s.organizations, input.OwnerID); err != nil {
+		return err
+	}
+	values, err := customFieldValues(ctx, s.fields, models.RecordDeal, input.CustomFields)
+	if err != nil {
+		return err
+	}
+	if input.CompanyID != nil {
+		if _, err := s.companies.FindByID(ctx, *input.CompanyID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrInvalidCompany
+			}
+			return err
+		}
+	}
+
+	contactIDs := uniqueIDs(input.ContactIDs)
+	if len(contactIDs) > 0 {
+		count, err := s.contacts.CountByIDs(ctx, contactIDs)
+		if err != nil {
+			return err
+		}
+		if count != int64(len(contactIDs)) {
+			return ErrInvalidContacts
+		}
+	}
+
+	deal.Title = strings.TrimSpace(input.Title)
+	deal.Amount = input.Amount
+	deal.Currency = strings.ToUpper(input.Currency)
+	deal.ExpectedCloseDate = input.ExpectedCloseDate
+	deal.OwnerID = input.OwnerID
+	deal.Owner = nil
+	deal.CompanyID = input.CompanyID
+	deal.Company = nil
+	deal.Contacts = make([]models.DealContact, len(contactIDs))
+	for i, contactID := range contactIDs {
+		deal.Contacts[i] = models.DealContact{ContactID: contactID}
+	}
+	deal.Tags = newTaggings(input.Tags)
+	deal.CustomFields = values
+	return nil
+}
+
+// pipelineStage returns the stage of a pipeline with the given ID, or the
+// pipeline's first stage when the ID is zero
+func pipelineStage(pipeline *models.Pipeline, stageID int) (*models.Stage, error) {
+	for i := range pipeline.Stages {
+		if stageID == 0 || pipeline.Stages[i].ID == stageID {
+			return &pipeline.Stages[i], nil
+		}
+	}
+	return nil, ErrInvalidStage
+}
+
+// uniqueIDs returns the IDs without repetitions, in their original order
+func uniqueIDs(ids []int) []int {
+	unique := make([]int, 0, len(ids))
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+// dealFixture holds the DealService under test and the repositories behind
+// it, with contacts 1 and 2 and company 1 in the test organization
+type dealFixture struct {
+	companies *repotest.Companies
+	deals     *repotest.Deals
+	service   *DealService
+}
+
+func newDealFixture(pipelines *repotest.Pipelines, deals ...models.Deal) *dealFixture {
+	owned := models.TenantOwned{OrganizationID: testOrganizationID}
+	contacts := repotest.NewContacts(testContact(1, "Ada"), testContact(2, "Grace"))
+	companies := repotest.NewCompanies(contacts, models.Company{ID: 1, TenantOwned: owned, Name: "Acme"})
+	_, organizations := newTestRoles(newTestUsers())
+	f := &dealFixture{companies: companies, deals: repotest.NewDeals(companies, deals...)}
+	f.service = NewDealService(f.deals, pipelines, companies, contacts, organizations, repotest.NewCustomFields(), nil, repotest.Transactor{}, zap.NewNop().Sugar())
+	return f
+}
+
+// history returns the stage changes of a deal
+func (f *dealFixture) history(t *testing.T, dealID int) []models.DealStageChange {
+	t.Helper()
+	changes, err := f.deals.ListStageChanges(testContext(), dealID)
+	if err != nil {
+		t.Fatalf("ListStageChanges: %v", err)
+	}
+	return changes
+}
+
+func TestDealServiceCreate(t *testing.T) {
+	f := newDealFixture(repotest.NewPipelines(salesPipeline()))
+	company := 1
+
+	deal, err := f.service.Create(testContext(), testManagerID, 1, 0, DealInput{
+		Title:      " Big sale ",
+		Amount:     1200,
+		Currency:   "eur",
+		CompanyID:  &company,
+		ContactIDs: []int{2, 1, 2},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if deal.Title != "Big sale" || deal.Currency != "EUR" || deal.Status != models.DealOpen {
+		t.Errorf("deal = %+v", deal)
+	}
+	if deal.StageID != 1 {
+		t.Errorf("stage = %d, want the pipeline's first stage", deal.StageID)
+	}
+	if deal.OwnerID == nil || *deal.OwnerID != testManagerID {
+		t.Errorf("owner = %v, want the creator", deal.OwnerID)
+	}
+	if ids := deal.ContactIDs(); !reflect.DeepEqual(ids, []int{2, 1}) {
+		t.Errorf("contacts = %v, want [2 1]", ids)
+	}
+
+	changes := f.history(t, deal.ID)
+	if len(changes) != 1 {
+		t.Fatalf("changes = %+v, want the initial stage recorded", changes)
+	}
+	change := changes[0]
+	if change.FromStageID != nil || change.ToStageID != 1 || change.Status != models.DealOpen ||
+		change.ChangedByID == nil || *change.ChangedByID != testManagerID {
+		t.Errorf("change = %+v", change)
+	}
+	stats, err := f.companies.Stats(testContext(), company, time.Now())
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.OpenDeals != 1 {
+		t.Errorf("open deals of the company = %d, want 1", stats.OpenDeals)
+	}
+
+	deal, err = f.service.Create(testContext(), testAdminID, 1, 2, DealInput{Title: "Upsell", Currency: "USD"})
+	if err != nil {
+		t.Fatalf("Create in a stage: %v", err)
+	}
+	if deal.StageID != 2 {
+		t.Errorf("stage = %d, want 2", deal.StageID)
+	}
+}
+
+func TestDealServiceCreateRejectsInvalidReferences(t *testing.T) {
+	missing, outsider := 9, testOutsider.ID
+	tests := []struct {
+		name                string
+		pipelineID, stageID int
+		input               DealInput
+		want                error
+	}{
+		{"missing pipeline", 9, 0, DealInput{}, ErrInvalidPipeline},
+		{"stage of another pipeline", 1, 4, DealInput{}, ErrInvalidStage},
+		{"pipeline of another organization", 3, 0, DealInput{}, ErrInvalidPipeline},
+		{"missing company", 1, 0, DealInput{CompanyID: &missing}, ErrInvalidCompany},
+		{"missing contact", 1, 0, DealInput{ContactIDs: []int{1, missing}}, ErrInvalidContacts},
+		{"owner outside the organization", 1, 0, DealInput{OwnerID: &outsider}, ErrInvalidOwner},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newDealFixture(repotest.NewPipelines(salesPipeline(), renewalsPipeline(), models.Pipeline{
+				ID:          3,
+				TenantOwned: models.TenantOwned{OrganizationID: testOtherOrganizationID},
+				Name:        "Other",
+				Stages:      []models.Stage{{ID: 5, Name: "Lead"}},
+			}))
+			tt.input.Title, tt.input.Currency = "Deal", "USD"
+			if _, err := f.service.Create(testContext(), testAdminID, tt.pipelineID, tt.stageID, tt.input); !errors.Is(err, tt.want) {
+				t.Fatalf("Create = %v, want %v", err, tt.want)
+			}
+			if _, total, _ := f.deals.List(testContext(), repository.DealFilter{}, 0, 10); total != 0 {
+				t.Errorf("the deal was saved")
+			}
+			if changes := f.history(t, 1); len(changes) != 0 {
+				t.Errorf("changes = %+v, want none", changes)
+			}
+		})
+	}
+}
+
+func TestDealServiceTransitions(t *testing.T) {
+	entered := time.Now().Add(-time.Hour)
+	seeded := testDeal(1, "Big sale")
+	seeded.StageChangedAt = entered
+	f := newDealFixture(repotest.NewPipelines(salesPipeline(), renewalsPipeline()), seeded)
+	service := f.service
+	ctx := testContext()
+
+	deal, err := service.Move(ctx, 2, 1, 4)
+	if err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if deal.PipelineID != 2 || deal.StageID != 4 || !deal.StageChangedAt.After(entered) {
+		t.Errorf("moved deal = %+v, want it in stage 4 of pipeline 2", deal)
+	}
+	change := f.history(t, 1)[0]
+	if *change.FromStageID != 1 || change.ToStageID != 4 || change.Status != models.DealOpen || *change.ChangedByID != 2 {
+		t.Errorf("move recorded as %+v", change)
+	}
+	if change.TimeInPreviousStage < time.Hour || change.TimeInPreviousStage > time.Hour+time.Minute {
+		t.Errorf("time in previous stage = %v, want about an hour", change.TimeInPreviousStage)
+	}
+
+	// moving a deal to its stage records nothing
+	if _, err := service.Move(ctx, 2, 1, 4); err != nil {
+		t.Fatalf("Move to the same stage: %v", err)
+	}
+	if changes := f.history(t, 1); len(changes) != 1 {
+		t.Errorf("changes = %+v, want the no-op move left out", changes)
+	}
+
+	deal, err = service.Lose(ctx, 1, 1, " Too expensive ")
+	if err != nil {
+		t.Fatalf("Lose: %v", err)
+	}
+	if deal.Status != models.DealLost || deal.CloseReason != "Too expensive" || deal.ClosedAt == nil || deal.StageID != 4 {
+		t.Errorf("lost deal = %+v", deal)
+	}
+	if change := f.history(t, 1)[1]; change.Status != models.DealLost || change.Reason != "Too expensive" || change.ToStageID != 4 {
+		t.Errorf("loss recorded as %+v", change)
+	}
+
+	if _, err := service.Move(ctx, 1, 1, 1); !errors.Is(err, ErrDealClosed) {
+		t.Errorf("Move of a closed deal = %v, want %v", err, ErrDealClosed)
+	}
+	if _, err := service.Win(ctx, 1, 1, ""); !errors.Is(err, ErrDealClosed) {
+		t.Errorf("Win of a lost deal = %v, want %v", err, ErrDealClosed)
+	}
+
+	deal, err = service.Reopen(ctx, 1, 1)
+	if err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	if deal.Status != models.DealOpen || deal.CloseReason != "" || deal.ClosedAt != nil {
+		t.Errorf("reopened deal = %+v", deal)
+	}
+	if _, err := service.Reopen(ctx, 1, 1); !errors.Is(err, ErrDealNotClosed) {
+		t.Errorf("Reopen of an open deal = %v, want %v", err, ErrDealNotClosed)
+	}
+	if _, err := service.Move(ctx, 1, 1, 9); !errors.Is(err, ErrInvalidStage) {
+		t.Errorf("Move to a missing stage = %v, want %v", err, ErrInvalidStage)
+	}
+
+	history, err := service.History(ctx, 1)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	var statuses []string
+	for _, change := range history {
+		statuses = append(statuses, change.Status)
+	}
+	if want := []string{models.DealOpen, models.DealLost, models.DealOpen}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("history = %v, want %v", statuses, want)
+	}
+	if _, err := service.History(ctx, 2); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("History of a missing deal = %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func TestDealServiceUpdateKeepsStage(t *testing.T) {
+	seeded := testDeal(1, "Old")
+	seeded.Status, seeded.StageID = models.DealWon, 3
+	f := newDealFixture(repotest.NewPipelines(salesPipeline()), seeded)
+
+	deal, err := f.service.Update(testContext(), 1, DealInput{Title: "New", Currency: "gbp"})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if deal.Title != "New" || deal.Currency != "GBP" || deal.Status != models.DealWon || deal.StageID != 3 {
+		t.Errorf("updated deal = %+v", deal)
+	}
+	if changes := f.history(t, 1); len(changes) != 0 {
+		t.Errorf("changes = %+v, want none", changes)
+	}
+}
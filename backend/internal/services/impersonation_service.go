@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrCannotImpersonate = errors.New("this user cannot be impersonated")
+	ErrNotImpersonating  = errors.New("not impersonating a user")
+)
+
+// Impersonation is an access token an admin acts as another member with
+type Impersonation struct {
+	AccessToken    string
+	ExpiresIn      int64 // token lifetime in seconds
+	User           *models.User
+	OrganizationID int
+	Role           string
+}
+
+// ImpersonationService lets admins act as another member of their
+// organization, for example to see exactly what a customer sees. The tokens
+// cannot be refreshed, and everything done with them is audited.
+type ImpersonationService struct {
+	organizations repository.OrganizationRepository
+	authzService  *AuthorizationService
+	auditService  *AuditService
+	jwtConfig     middleware.JWTConfig
+	ttl           time.Duration
+	logger        *zap.SugaredLogger
+}
+
+// NewImpersonationService creates a new impersonation service
+func NewImpersonationService(
+	organizations repository.OrganizationRepository,
+	authzService *AuthorizationService,
+	auditService *AuditService,
+	jwtConfig middleware.JWTConfig,
+	ttl time.Duration,
+	logger *zap.SugaredLogger,
+) *ImpersonationService {
+	return &ImpersonationService{
+		organizations: organizations,
+		authzService:  authzService,
+		auditService:  auditService,
+		jwtConfig:     jwtConfig,
+		ttl:           ttl,
+		logger:        logger,
+	}
+}
+
+// Start issues a token acting as a member of the context organization. Only
+// members whose role grants nothing the impersonator's role does not can be
+// impersonated. The token belongs to the impersonator's session, so it ends
+// with that session.
+func (s *ImpersonationService) Start(ctx context.Context, impersonatorID, userID int, sessionID string) (*Impersonation, error) {
+	if userID == impersonatorID {
+		return nil, ErrCannotImpersonate
+	}
+
+	membership, err := s.organizations.FindMember(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if membership.User == nil || membership.User.ServiceAccount {
+		return nil, ErrCannotImpersonate
+	}
+
+	covered, err := s.authzService.HasPermissionsOf(ctx, strconv.Itoa(impersonatorID), strconv.Itoa(userID))
+	if err != nil {
+		return nil, err
+	}
+	if !covered {
+		return nil, ErrCannotImpersonate
+	}
+
+	accessToken, err := middleware.SignAccessToken(&middleware.JWTClaims{
+		UserId:        strconv.Itoa(userID),
+		OrgId:         strconv.Itoa(membership.OrganizationID),
+		Role:          membership.Role,
+		EmailVerified: membership.User.EmailVerified(),
+		SessionId:     sessionID,
+		Impersonator:  strconv.Itoa(impersonatorID),
+	}, s.jwtConfig, s.ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("Impersonation started", "user_id", userID, "impersonator_id", impersonatorID)
+	s.record(ctx, impersonatorID, userID, models.AuditImpersonationStarted, map[string]interface{}{
+		"expires_at": time.Now().Add(s.ttl).UTC(),
+	})
+
+	return &Impersonation{
+		AccessToken:    accessToken,
+		ExpiresIn:      int64(s.ttl.Seconds()),
+		User:           membership.User,
+		OrganizationID: membership.OrganizationID,
+		Role:           membership.Role,
+	}, nil
+}
+
+// End revokes the impersonation token the request was made with
+func (s *ImpersonationService) End(ctx context.Context, userID int, tokenID string, expiresAt time.Time) error {
+	impersonator, ok := middleware.ImpersonatorFromContext(ctx)
+	if !ok {
+		return ErrNotImpersonating
+	}
+	impersonatorID, err := strconv.Atoi(impersonator)
+	if err != nil {
+		return ErrNotImpersonating
+	}
+
+	if s.jwtConfig.Revocations != nil && tokenID != "" {
+		if err := s.jwtConfig.Revocations.RevokeToken(ctx, tokenID, expiresAt); err != nil {
+			return err
+		}
+	}
+
+	s.logger.Infow("Impersonation ended", "user_id", userID, "impersonator_id", impersonatorID)
+	s.record(ctx, impersonatorID, userID, models.AuditImpersonationEnded, nil)
+	return nil
+}
+
+// RecordRequest adds a request made while impersonating the user to the
+// audit log of the context organization
+func (s *ImpersonationService) RecordRequest(ctx context.Context, userID int, method, path string, status int) {
+	impersonator, ok := middleware.ImpersonatorFromContext(ctx)
+	if !ok {
+		return
+	}
+	impersonatorID, err := strconv.Atoi(impersonator)
+	if err != nil {
+		return
+	}
+
+	s.record(ctx, impersonatorID, userID, models.AuditImpersonationRequest, map[string]interface{}{
+		"method": method,
+		"path":   path,
+		"status": status,
+	})
+}
+
+// record adds an event about impersonating the user to the audit log
+func (s *ImpersonationService) record(ctx context.Context, impersonatorID, userID int, action string, details map[string]interface{}) {
+	s.auditService.Record(ctx, &models.AuditEvent{
+		ActorID:    &impersonatorID,
+		Action:     action,
+		TargetType: "user",
+		TargetID:   &userID,
+		Details:    details,
+	})
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+// testImpersonationTTL is the lifetime of impersonation tokens in the tests
+const testImpersonationTTL = 15 * time.Minute
+
+// testServiceAccountID is a service account member of the test organization
+const testServiceAccountID = 5
+
+// impersonationFixture holds the ImpersonationService under test, its audit
+// log and the store its tokens are revoked in
+type impersonationFixture struct {
+	audit       *repotest.Audit
+	revocations *middleware.MemoryRevocationStore
+	jwtConfig   middleware.JWTConfig
+	service     *ImpersonationService
+}
+
+func newImpersonationFixture(t *testing.T) *impersonationFixture {
+	t.Helper()
+	users := newTestUsers()
+	roles, organizations := newTestRoles(users)
+	ctx := testContext()
+	if err := users.Create(ctx, &models.User{ID: testServiceAccountID, Email: "bot@example.com", ServiceAccount: true}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := organizations.AddMember(ctx, &models.Membership{UserID: testServiceAccountID, Role: models.RoleUser}); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+
+	fixture := &impersonationFixture{
+		audit:       repotest.NewAudit(),
+		revocations: middleware.NewMemoryRevocationStore(),
+		jwtConfig:   testJWTConfig(),
+	}
+	fixture.jwtConfig.Revocations = fixture.revocations
+	logger := zap.NewNop().Sugar()
+	fixture.service = NewImpersonationService(
+		organizations, NewAuthorizationService(roles, organizations, logger),
+		NewAuditService(fixture.audit, logger), fixture.jwtConfig, testImpersonationTTL, logger,
+	)
+	return fixture
+}
+
+// events returns the test organization's audit events with the action
+func (f *impersonationFixture) events(t *testing.T, action string) []models.AuditEvent {
+	t.Helper()
+	events, _, err := f.audit.List(context.Background(), testOrganizationID, repository.AuditFilter{Action: action}, 0, 100)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return events
+}
+
+// impersonatingContext returns the request context the JWT middleware sets
+// up for a request made while impersonating the user
+func impersonatingContext(t *testing.T, impersonatorID, userID int) context.Context {
+	t.Helper()
+	token, err := middleware.SignAccessToken(&middleware.JWTClaims{
+		UserId:       strconv.Itoa(userID),
+		OrgId:        strconv.Itoa(testOrganizationID),
+		Role:         models.RoleUser,
+		Impersonator: strconv.Itoa(impersonatorID),
+	}, testJWTConfig(), time.Minute)
+	if err != nil {
+		t.Fatalf("SignAccessToken: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	var ctx context.Context
+	engine := gin.New()
+	engine.GET("/", middleware.JWT(testJWTConfig(), zap.NewNop().Sugar()), func(c *gin.Context) {
+		ctx = c.Request.Context()
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+	if ctx == nil {
+		t.Fatal("the impersonation token was rejected")
+	}
+	return ctx
+}
+
+func TestImpersonationServiceStart(t *testing.T) {
+	tests := []struct {
+		name         string
+		impersonator int
+		userID       int
+		err          error
+	}{
+		{name: "admin impersonates a member", impersonator: testAdminID, userID: testMemberID},
+		{name: "admin impersonates a manager", impersonator: testAdminID, userID: testManagerID},
+		{name: "manager impersonates a member with fewer permissions", impersonator: testManagerID, userID: testMemberID},
+		{name: "manager cannot impersonate an admin", impersonator: testManagerID, userID: testAdminID, err: ErrCannotImpersonate},
+		{name: "member cannot impersonate a manager", impersonator: testMemberID, userID: testManagerID, err: ErrCannotImpersonate},
+		{name: "nobody impersonates themselves", impersonator: testAdminID, userID: testAdminID, err: ErrCannotImpersonate},
+		{name: "service accounts cannot be impersonated", impersonator: testAdminID, userID: testServiceAccountID, err: ErrCannotImpersonate},
+		{name: "not a member", impersonator: testAdminID, userID: testOutsider.ID, err: repository.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newImpersonationFixture(t)
+			impersonation, err := f.service.Start(testContext(), tt.impersonator, tt.userID, "session-1")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Start = %v, want %v", err, tt.err)
+			}
+			started := f.events(t, models.AuditImpersonationStarted)
+			if err != nil {
+				if len(started) != 0 {
+					t.Errorf("recorded %d start events for a refused impersonation", len(started))
+				}
+				return
+			}
+
+			claims, err := middleware.ParseToken(impersonation.AccessToken, middleware.TokenTypeAccess, f.jwtConfig)
+			if err != nil {
+				t.Fatalf("ParseToken: %v", err)
+			}
+			if claims.UserId != strconv.Itoa(tt.userID) || claims.Impersonator != strconv.Itoa(tt.impersonator) ||
+				claims.SessionId != "session-1" || claims.OrgId != strconv.Itoa(testOrganizationID) {
+				t.Errorf("claims = %+v", claims)
+			}
+			if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != testImpersonationTTL {
+				t.Errorf("token lifetime = %s, want %s", lifetime, testImpersonationTTL)
+			}
+			if len(started) != 1 || *started[0].ActorID != tt.impersonator || *started[0].TargetID != tt.userID {
+				t.Errorf("start events = %+v", started)
+			}
+		})
+	}
+}
+
+func TestImpersonationServiceStartEndsWithImpersonator(t *testing.T) {
+	f := newImpersonationFixture(t)
+	impersonation, err := f.service.Start(testContext(), testAdminID, testMemberID, "session-1")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	claims, err := middleware.ParseToken(impersonation.AccessToken, middleware.TokenTypeAccess, f.jwtConfig)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+
+	// ending the impersonator's session ends the impersonation
+	if err := f.revocations.RevokeSession(context.Background(), "session-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if revoked, _ := f.revocations.IsRevoked(context.Background(), claims); !revoked {
+		t.Error("the impersonation outlived the impersonator's session")
+	}
+}
+
+func TestImpersonationServiceEnd(t *testing.T) {
+	f := newImpersonationFixture(t)
+	expiresAt := time.Now().Add(testImpersonationTTL)
+
+	if err := f.service.End(testContext(), testMemberID, "jti-1", expiresAt); !errors.Is(err, ErrNotImpersonating) {
+		t.Fatalf("End without impersonating = %v, want %v", err, ErrNotImpersonating)
+	}
+
+	ctx := impersonatingContext(t, testAdminID, testMemberID)
+	if err := f.service.End(ctx, testMemberID, "jti-1", expiresAt); err != nil {
+		t.Fatalf("End: %v", err)
+	}
+	for tokenID, want := range map[string]bool{"jti-1": true, "jti-2": false} {
+		claims := &middleware.JWTClaims{UserId: strconv.Itoa(testMemberID), RegisteredClaims: jwt.RegisteredClaims{ID: tokenID}}
+		if revoked, err := f.revocations.IsRevoked(context.Background(), claims); err != nil || revoked != want {
+			t.Errorf("IsRevoked(%s) = %v, %v, want %v", tokenID, revoked, err, want)
+		}
+	}
+	if ended := f.events(t, models.AuditImpersonationEnded); len(ended) != 1 || *ended[0].ActorID != testAdminID {
+		t.Errorf("end events = %+v", ended)
+	}
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/mailer"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidInvitation    = errors.New("invalid or expired invitation")
+	ErrInvitationNotPending = errors.New("invitation is no longer pending")
+	ErrAlreadyMember        = errors.New("user is already a member of the organization")
+	ErrUnknownRole          = errors.New("unknown role")
+)
+
+// InviteInput holds the data required to invite someone to an organization
+type InviteInput struct {
+	Email string
+	Role  string
+}
+
+// AcceptInvitationInput holds the data required to accept an invitation.
+// Invitees without an account choose their password here; existing users
+// confirm theirs.
+type AcceptInvitationInput struct {
+	Token        string
+	Password     string
+	BusinessName string
+}
+
+// InvitationService invites people to organizations and handles their answers
+type InvitationService struct {
+	invitations   repository.InvitationRepository
+	organizations repository.OrganizationRepository
+	users         repository.UserRepository
+	roles         repository.RoleRepository
+	transactor    repository.Transactor
+	authService   *AuthService
+	authz         *AuthorizationService
+	mailer        mailer.Mailer
+	jwtConfig     middleware.JWTConfig
+	ttl           time.Duration
+	appURL        string
+	logger        *zap.SugaredLogger
+}
+
+// NewInvitationService creates a new invitation service. Invitations expire
+// after ttl; links in invitation emails point to appURL.
+func NewInvitationService(
+	invitations repository.InvitationRepository,
+	organizations repository.OrganizationRepository,
+	users repository.UserRepository,
+	roles repository.RoleRepository,
+	transactor repository.Transactor,
+	authService *AuthService,
+	authz *AuthorizationService,
+	mailer mailer.Mailer,
+	jwtConfig middleware.JWTConfig,
+	ttl time.Duration,
+	appURL string,
+	logger *zap.SugaredLogger,
+) *InvitationService {
+	return &InvitationService{
+		invitations:   invitations,
+		organizations: organizations,
+		users:         users,
+		roles:         roles,
+		transactor:    transactor,
+		authService:   authService,
+		authz:         authz,
+		mailer:        mailer,
+		jwtConfig:     jwtConfig,
+		ttl:           ttl,
+		appURL:        appURL,
+		logger:        logger,
+	}
+}
+
+// Invite invites the email address to the context organization with the given
+// role and emails them a link to accept. Like assigning it, inviting someone
+// with a role requires holding every permission it grants. Earlier pending
+// invitations to the same address are revoked, so inviting again resends the
+// invitation.
+func (s *InvitationService) Invite(ctx context.Context, inviterID int, input InviteInput) (*models.Invitation, error) {
+	email := normalizeEmail(input.Email)
+
+	role, err := s.roles.FindByName(ctx, strings.TrimSpace(input.Role))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUnknownRole
+		}
+		return nil, err
+	}
+	if err := s.authz.CheckGrantable(ctx, strconv.Itoa(inviterID), role.Permissions); err != nil {
+		return nil, err
+	}
+
+	if user, err := s.users.FindByEmail(ctx, email); err == nil {
+		if _, err := s.organizations.FindMember(ctx, user.ID); err == nil {
+			return nil, ErrAlreadyMember
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	invitation := &models.Invitation{
+		Email:       email,
+		Role:        role.Name,
+		InvitedByID: inviterID,
+		ExpiresAt:   time.Now().Add(s.ttl),
+	}
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.invitations.RevokePendingForEmail(ctx, email); err != nil {
+			return err
+		}
+		return s.invitations.Create(ctx, invitation)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.send(ctx, invitation); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("Invitation sent",
+		"invitation_id", invitation.ID,
+		"organization_id", invitation.OrganizationID,
+		"invited_by", inviterID,
+	)
+	return s.invitations.FindByID(ctx, invitation.ID)
+}
+
+// ListPending returns the pending invitations of the context organization
+func (s *InvitationService) ListPending(ctx context.Context) ([]models.Invitation, error) {
+	return s.invitations.ListPending(ctx)
+}
+
+// Revoke cancels a pending invitation of the context organization
+func (s *InvitationService) Revoke(ctx context.Context, id int) error {
+	if _, err := s.invitations.FindByID(ctx, id); err != nil {
+		return err
+	}
+
+	revoked, err := s.invitations.Resolve(ctx, id, models.InvitationRevoked)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrInvitationNotPending
+	}
+	return nil
+}
+
+// Accept adds the invitee to the organization, creating their account if they
+// do not have one yet, and signs them in to that organization
+func (s *InvitationService) Accept(ctx context.Context, input AcceptInvitationInput) (*AuthResult, error) {
+	ctx, invitation, err := s.findByToken(ctx, input.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	// the invitation was emailed to the address, so following it proves ownership
+	now := time.Now()
+
+	user, err := s.users.FindByEmail(ctx, invitation.Email)
+	switch {
+	case err == nil:
+		if !checkPassword(user.Password, input.Password) {
+			return nil, ErrInvalidCredentials
+		}
+	case errors.Is(err, repository.ErrNotFound):
+		hash, err := hashPassword(input.Password)
+		if err != nil {
+			return nil, err
+		}
+		user = &models.User{
+			Email:           invitation.Email,
+			Password:        hash,
+			BuisnessName:    strings.TrimSpace(input.BusinessName),
+			EmailVerifiedAt: &now,
+		}
+	default:
+		return nil, err
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		accepted, err := s.invitations.Resolve(ctx, invitation.ID, models.InvitationAccepted)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return ErrInvalidInvitation
+		}
+
+		switch {
+		case user.ID == 0:
+			if err := s.users.Create(ctx, user); err != nil {
+				return err
+			}
+		case !user.EmailVerified():
+			user.EmailVerifiedAt = &now
+			if err := s.users.Update(ctx, user); err != nil {
+				return err
+			}
+		}
+
+		err = s.organizations.AddMember(ctx, &models.Membership{UserID: user.ID, Role: invitation.Role})
+		if errors.Is(err, repository.ErrDuplicate) {
+			return ErrAlreadyMember
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("Invitation accepted",
+		"invitation_id", invitation.ID,
+		"organization_id", invitation.OrganizationID,
+		"user_id", user.ID,
+	)
+	return s.authService.signIn(ctx, user, invitation.OrganizationID, false)
+}
+
+// Decline marks the invitation as declined
+func (s *InvitationService) Decline(ctx context.Context, token string) error {
+	ctx, invitation, err := s.findByToken(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	declined, err := s.invitations.Resolve(ctx, invitation.ID, models.InvitationDeclined)
+	if err != nil {
+		return err
+	}
+	if !declined {
+		return ErrInvalidInvitation
+	}
+	return nil
+}
+
+// findByToken verifies an invitation token and loads the pending invitation it
+// refers to. The returned context is scoped to the invitation's organization.
+func (s *InvitationService) findByToken(ctx context.Context, token string) (context.Context, *models.Invitation, error) {
+	claims, err := middleware.ParseInvitationToken(token, s.jwtConfig)
+	if err != nil {
+		s.logger.Debugw("Invitation token rejected", "error", err)
+		return nil, nil, ErrInvalidInvitation
+	}
+
+	organizationID, err := strconv.Atoi(claims.OrgId)
+	if err != nil {
+		return nil, nil, ErrInvalidInvitation
+	}
+	invitationID, err := strconv.Atoi(claims.ID)
+	if err != nil {
+		return nil, nil, ErrInvalidInvitation
+	}
+
+	ctx = tenant.WithOrganization(ctx, organizationID)
+	invitation, err := s.invitations.FindByID(ctx, invitationID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrInvalidInvitation
+		}
+		return nil, nil, err
+	}
+
+	if invitation.Email != claims.Subject || invitation.Status() != models.InvitationPending {
+		return nil, nil, ErrInvalidInvitation
+	}
+	return ctx, invitation, nil
+}
+
+// send emails the invitation link to the invitee
+func (s *InvitationService) send(ctx context.Context, invitation *models.Invitation) error {
+	organization, err := s.organizations.FindByID(ctx, invitation.OrganizationID)
+	if err != nil {
+		return err
+	}
+	inviter, err := s.users.FindByID(ctx, invitation.InvitedByID)
+	if err != nil {
+		return err
+	}
+
+	token, err := middleware.GenerateInvitationToken(
+		strconv.Itoa(invitation.ID),
+		strconv.Itoa(invitation.OrganizationID),
+		invitation.Email,
+		invitation.ExpiresAt,
+		s.jwtConfig,
+	)
+	if err != nil {
+		return err
+	}
+
+	link := s.appURL + "/invitations/accept?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf(
+		"%s invited you to join %s as %s.\n\n"+
+			"Accept the invitation:\n%s\n\n"+
+			"This invitation expires on %s. If you were not expecting it, you can ignore this email.\n",
+		inviter.Email,
+		organization.Name,
+		invitation.Role,
+		link,
+		invitation.ExpiresAt.UTC().Format("January 2, 2006 15:04 MST"),
+	)
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You have been invited to join %s", organization.Name),
+		Body:    body,
+	})
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/mailer"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+// testPassword is the password of testOutsider, who has an account but is not
+// a member of the test organization
+const testPassword = "correct horse battery"
+
+var testOutsider = models.User{ID: 4, Email: "grace@example.com"}
+
+// invitationFixture holds the InvitationService under test and its repositories
+type invitationFixture struct {
+	users         *repotest.Users
+	organizations *repotest.Organizations
+	invitations   *repotest.Invitations
+	mail          *bytes.Buffer
+	service       *InvitationService
+}
+
+// newInvitationFixture returns an InvitationService for the test organization
+// holding the given invitations
+func newInvitationFixture(t *testing.T, invitations ...models.Invitation) *invitationFixture {
+	t.Helper()
+	hash, err := hashPassword(testPassword)
+	if err != nil {
+		t.Fatalf("hashPassword: %v", err)
+	}
+	outsider := testOutsider
+	outsider.Password = hash
+
+	users := newTestUsers()
+	if err := users.Create(context.Background(), &outsider); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	roles, organizations := newTestRoles(users)
+	fixture := &invitationFixture{
+		users:         users,
+		organizations: organizations,
+		invitations:   repotest.NewInvitations(users, invitations...),
+		mail:          &bytes.Buffer{},
+	}
+
+	logger := zap.NewNop().Sugar()
+	mfaService := NewMFAService(repotest.NewMFA(), users, organizations, "CRM", logger)
+	lockoutService := newTestLockoutService(repotest.NewLoginThrottles(), users, organizations)
+	refreshTokens := repotest.NewRefreshTokens()
+	sessionService := newTestSessionService(repotest.NewSessions(), refreshTokens, organizations)
+	authService := NewAuthService(users, organizations, refreshTokens, repotest.Transactor{}, mfaService, lockoutService, sessionService, testJWTConfig(), logger)
+	fixture.service = NewInvitationService(
+		fixture.invitations, organizations, users, roles, repotest.Transactor{}, authService,
+		NewAuthorizationService(roles, organizations, logger),
+		mailer.NewWriterMailer("crm@example.com", fixture.mail), testJWTConfig(),
+		time.Hour, "https://crm.example.com", logger,
+	)
+	return fixture
+}
+
+// pendingInvitation returns an invitation of the test organization that can be accepted
+func pendingInvitation(id int, email, role string) models.Invitation {
+	return models.Invitation{
+		ID:          id,
+		TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID},
+		Email:       email,
+		Role:        role,
+		InvitedByID: testAdminID,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+}
+
+// invitationToken signs the token emailed for an invitation
+func invitationToken(t *testing.T, invitation models.Invitation) string {
+	t.Helper()
+	token, err := middleware.GenerateInvitationToken(
+		strconv.Itoa(invitation.ID),
+		strconv.Itoa(invitation.OrganizationID),
+		invitation.Email,
+		invitation.ExpiresAt,
+		testJWTConfig(),
+	)
+	if err != nil {
+		t.Fatalf("GenerateInvitationToken: %v", err)
+	}
+	return token
+}
+
+func TestInvitationServiceInvite(t *testing.T) {
+	tests := []struct {
+		name    string
+		inviter int
+		input   InviteInput
+		err     error
+	}{
+		{"manager invites a user", testManagerID, InviteInput{Email: "new@example.com", Role: models.RoleUser}, nil},
+		{"manager invites a manager", testManagerID, InviteInput{Email: "new@example.com", Role: "manager"}, nil},
+		{"manager invites an admin", testManagerID, InviteInput{Email: "new@example.com", Role: models.RoleAdmin}, ErrPermissionNotHeld},
+		{"admin invites an admin", testAdminID, InviteInput{Email: " New@Example.com ", Role: models.RoleAdmin}, nil},
+		{"unknown role", testAdminID, InviteInput{Email: "new@example.com", Role: "owner"}, ErrUnknownRole},
+		{"existing member", testAdminID, InviteInput{Email: "member@example.com", Role: models.RoleUser}, ErrAlreadyMember},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := newInvitationFixture(t)
+
+			invitation, err := fixture.service.Invite(testContext(), tt.inviter, tt.input)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Invite = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if fixture.mail.Len() != 0 {
+					t.Error("a rejected invitation was emailed")
+				}
+				return
+			}
+
+			if invitation.Email != "new@example.com" || invitation.OrganizationID != testOrganizationID || invitation.Status() != models.InvitationPending {
+				t.Errorf("invitation = %+v", invitation)
+			}
+			if !strings.Contains(fixture.mail.String(), "https://crm.example.com/invitations/accept?token=") {
+				t.Errorf("the email has no acceptance link:\n%s", fixture.mail.String())
+			}
+		})
+	}
+}
+
+func TestInvitationServiceInviteAgainRevokesEarlierInvitation(t *testing.T) {
+	fixture := newInvitationFixture(t, pendingInvitation(1, "new@example.com", models.RoleUser))
+
+	if _, err := fixture.service.Invite(testContext(), testAdminID, InviteInput{Email: "new@example.com", Role: models.RoleUser}); err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+
+	earlier, err := fixture.invitations.FindByID(testContext(), 1)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if earlier.Status() != models.InvitationRevoked {
+		t.Errorf("earlier invitation is %s, want %s", earlier.Status(), models.InvitationRevoked)
+	}
+	if pending, _ := fixture.invitations.ListPending(testContext()); len(pending) != 1 {
+		t.Errorf("%d pending invitations, want 1", len(pending))
+	}
+}
+
+func TestInvitationServiceAccept(t *testing.T) {
+	revoked := time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name       string
+		invitation models.Invitation
+		token      func(t *testing.T, invitation models.Invitation) string
+		password   string
+		err        error
+	}{
+		{
+			name:       "new account",
+			invitation: pendingInvitation(1, "new@example.com", "manager"),
+			password:   "a new password",
+		},
+		{
+			name:       "existing account",
+			invitation: pendingInvitation(1, testOutsider.Email, models.RoleUser),
+			password:   testPassword,
+		},
+		{
+			name:       "existing account with a wrong password",
+			invitation: pendingInvitation(1, testOutsider.Email, models.RoleUser),
+			password:   "wrong password",
+			err:        ErrInvalidCredentials,
+		},
+		{
+			name: "expired invitation",
+			invitation: func() models.Invitation {
+				invitation := pendingInvitation(1, "new@example.com", models.RoleUser)
+				invitation.ExpiresAt = time.Now().Add(-time.Minute)
+				return invitation
+			}(),
+			// the token is still valid, so the stored expiry decides
+			token: func(t *testing.T, invitation models.Invitation) string {
+				invitation.ExpiresAt = time.Now().Add(time.Hour)
+				return invitationToken(t, invitation)
+			},
+			password: "a new password",
+			err:      ErrInvalidInvitation,
+		},
+		{
+			name: "revoked invitation",
+			invitation: func() models.Invitation {
+				invitation := pendingInvitation(1, "new@example.com", models.RoleUser)
+				invitation.RevokedAt = &revoked
+				return invitation
+			}(),
+			password: "a new password",
+			err:      ErrInvalidInvitation,
+		},
+		{
+			name:       "token for another email",
+			invitation: pendingInvitation(1, "new@example.com", models.RoleUser),
+			token: func(t *testing.T, invitation models.Invitation) string {
+				invitation.Email = "attacker@example.com"
+				return invitationToken(t, invitation)
+			},
+			password: "a new password",
+			err:      ErrInvalidInvitation,
+		},
+		{
+			name:       "token for another organization",
+			invitation: pendingInvitation(1, "new@example.com", models.RoleUser),
+			token: func(t *testing.T, invitation models.Invitation) string {
+				invitation.OrganizationID = testOrganizationID + 1
+				return invitationToken(t, invitation)
+			},
+			password: "a new password",
+			err:      ErrInvalidInvitation,
+		},
+		{
+			name:       "malformed token",
+			invitation: pendingInvitation(1, "new@example.com", models.RoleUser),
+			token:      func(t *testing.T, invitation models.Invitation) string { return "not-a-token" },
+			password:   "a new password",
+			err:        ErrInvalidInvitation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := newInvitationFixture(t, tt.invitation)
+			token := invitationToken
+			if tt.token != nil {
+				token = tt.token
+			}
+
+			result, err := fixture.service.Accept(context.Background(), AcceptInvitationInput{
+				Token:    token(t, tt.invitation),
+				Password: tt.password,
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Accept = %v, want %v", err, tt.err)
+			}
+
+			stored, findErr := fixture.invitations.FindByID(testContext(), tt.invitation.ID)
+			if findErr != nil {
+				t.Fatalf("FindByID: %v", findErr)
+			}
+			if err != nil {
+				if stored.AcceptedAt != nil {
+					t.Error("a rejected acceptance marked the invitation as accepted")
+				}
+				if _, err := fixture.users.FindByEmail(context.Background(), "new@example.com"); err == nil {
+					t.Error("a rejected acceptance created an account")
+				}
+				return
+			}
+
+			if stored.Status() != models.InvitationAccepted {
+				t.Errorf("invitation is %s, want %s", stored.Status(), models.InvitationAccepted)
+			}
+			user := result.User
+			if user.Email != tt.invitation.Email || !checkPassword(user.Password, tt.password) {
+				t.Errorf("accepted as %s, want %s with the given password", user.Email, tt.invitation.Email)
+			}
+			membership, err := fixture.organizations.FindMember(testContext(), user.ID)
+			if err != nil {
+				t.Fatalf("FindMember: %v", err)
+			}
+			if membership.Role != tt.invitation.Role {
+				t.Errorf("role = %q, want %q", membership.Role, tt.invitation.Role)
+			}
+			if result.Tokens == nil || result.Tokens.OrganizationID != testOrganizationID {
+				t.Errorf("tokens = %+v, want tokens acting in organization %d", result.Tokens, testOrganizationID)
+			}
+		})
+	}
+}
+
+func TestInvitationServiceAcceptOnlyOnce(t *testing.T) {
+	invitation := pendingInvitation(1, "new@example.com", models.RoleUser)
+	fixture := newInvitationFixture(t, invitation)
+	input := AcceptInvitationInput{Token: invitationToken(t, invitation), Password: "a new password"}
+
+	if _, err := fixture.service.Accept(context.Background(), input); err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if _, err := fixture.service.Accept(context.Background(), input); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("second Accept = %v, want %v", err, ErrInvalidInvitation)
+	}
+	if err := fixture.service.Decline(context.Background(), input.Token); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("Decline after Accept = %v, want %v", err, ErrInvalidInvitation)
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"go.uber.org/zap"
+)
+
+var ErrLoginThrottled = errors.New("too many failed sign-in attempts")
+
+// loginBackoffBase is the wait after the first failure past the free ones
+const loginBackoffBase = time.Second
+
+// LoginThrottledError is returned while an address has to wait before the
+// next sign-in attempt. It matches ErrLoginThrottled.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("%s, try again in %s", ErrLoginThrottled, formatWait(e.RetryAfter))
+}
+
+// Is makes errors.Is match ErrLoginThrottled
+func (e *LoginThrottledError) Is(target error) bool {
+	return target == ErrLoginThrottled
+}
+
+// LockoutPolicy configures how failed sign-ins are throttled. The first
+// BackoffAfter failures are free; every further one doubles the wait before
+// the next attempt, and at Threshold failures the account is locked for
+// Duration. Failures are forgotten after Duration without one.
+type LockoutPolicy struct {
+	BackoffAfter int
+	Threshold    int
+	Duration     time.Duration
+}
+
+// LockoutService tracks failed sign-ins per email address to slow down
+// password guessing from many IP addresses
+type LockoutService struct {
+	throttles     repository.LoginThrottleRepository
+	users         repository.UserRepository
+	organizations repository.OrganizationRepository
+	auditService  *AuditService
+	policy        LockoutPolicy
+	logger        *zap.SugaredLogger
+}
+
+// NewLockoutService creates a new lockout service
+func NewLockoutService(
+	throttles repository.LoginThrottleRepository,
+	users repository.UserRepository,
+	organizations repository.OrganizationRepository,
+	auditService *AuditService,
+	policy LockoutPolicy,
+	logger *zap.SugaredLogger,
+) *LockoutService {
+	return &LockoutService{
+		throttles:     throttles,
+		users:         users,
+		organizations: organizations,
+		auditService:  auditService,
+		policy:        policy,
+		logger:        logger,
+	}
+}
+
+// Check returns a *LoginThrottledError when the address is locked or still
+// has to wait after its last failure
+func (s *LockoutService) Check(ctx context.Context, email string) error {
+	throttle, err := s.throttles.Find(ctx, email)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now()
+	if throttle.Locked(now) {
+		return &LoginThrottledError{RetryAfter: throttle.LockedUntil.Sub(now)}
+	}
+	if now.Sub(throttle.LastFailedAt) > s.policy.Duration {
+		return nil
+	}
+	if wait := s.backoff(throttle.FailedAttempts) - now.Sub(throttle.LastFailedAt); wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed sign-in for the address and locks it once
+// the policy's threshold is reached
+func (s *LockoutService) RecordFailure(ctx context.Context, email string) error {
+	now := time.Now()
+	throttle, err := s.throttles.RecordFailure(ctx, email, now, now.Add(-s.policy.Duration))
+	if err != nil {
+		return err
+	}
+	if throttle.FailedAttempts < s.policy.Threshold || throttle.Locked(now) {
+		return nil
+	}
+
+	lockedUntil := now.Add(s.policy.Duration)
+	if err := s.throttles.Lock(ctx, email, lockedUntil); err != nil {
+		return err
+	}
+
+	s.logger.Warnw("Account locked after failed sign-ins", "failed_attempts", throttle.FailedAttempts)
+	s.recordForAccount(ctx, email, nil, models.AuditAccountLocked, map[string]interface{}{
+		"email":           email,
+		"failed_attempts": throttle.FailedAttempts,
+		"locked_until":    lockedUntil.UTC(),
+	})
+	return nil
+}
+
+// RecordSuccess forgets the failures of the address after a completed sign-in
+func (s *LockoutService) RecordSuccess(ctx context.Context, email string) error {
+	return s.throttles.Reset(ctx, email)
+}
+
+// Unlock lifts the lock of a member of the context organization and forgets
+// their failed sign-ins
+func (s *LockoutService) Unlock(ctx context.Context, actorID, userID int) error {
+	membership, err := s.organizations.FindMember(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.throttles.Reset(ctx, membership.User.Email); err != nil {
+		return err
+	}
+
+	s.logger.Infow("Account unlocked", "user_id", userID, "unlocked_by", actorID)
+	s.recordForAccount(ctx, membership.User.Email, &actorID, models.AuditAccountUnlocked, nil)
+	return nil
+}
+
+// recordForAccount records an event about the account with the address in
+// every organization it belongs to, or without an organization when the
+// address is not registered
+func (s *LockoutService) recordForAccount(ctx context.Context, email string, actorID *int, action string, details map[string]interface{}) {
+	event := models.AuditEvent{ActorID: actorID, Action: action, TargetType: "user", Details: details}
+
+	user, err := s.users.FindByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			s.logger.Errorw("Failed to look up locked account", "error", err)
+		}
+		s.auditService.Record(ctx, &event)
+		return
+	}
+
+	memberships, err := s.organizations.ListMembershipsForUser(ctx, user.ID)
+	if err != nil {
+		s.logger.Errorw("Failed to look up memberships of locked account", "user_id", user.ID, "error", err)
+	}
+	event.TargetID = &user.ID
+	if len(memberships) == 0 {
+		s.auditService.Record(ctx, &event)
+		return
+	}
+	for _, membership := range memberships {
+		organizationEvent := event
+		organizationEvent.OrganizationID = &membership.OrganizationID
+		s.auditService.Record(ctx, &organizationEvent)
+	}
+}
+
+// backoff returns the wait after the given number of consecutive failures
+func (s *LockoutService) backoff(failures int) time.Duration {
+	exponent := failures - s.policy.BackoffAfter - 1
+	if exponent < 0 {
+		return 0
+	}
+	wait := time.Duration(float64(loginBackoffBase) * math.Pow(2, float64(exponent)))
+	if wait > s.policy.Duration || wait <= 0 {
+		return s.policy.Duration
+	}
+	return wait
+}
+
+// formatWait describes a wait in whole seconds or minutes, rounding up
+func formatWait(d time.Duration) string {
+	if d > time.Minute {
+		return pluralize(int(math.Ceil(d.Minutes())), "minute")
+	}
+	return pluralize(int(math.Ceil(d.Seconds())), "second")
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+// lockoutFixture holds the LockoutService under test and its repositories
+type lockoutFixture struct {
+	throttles *repotest.LoginThrottles
+	audit     *repotest.Audit
+	service   *LockoutService
+}
+
+// newLockoutFixture returns a LockoutService with testLockoutPolicy for the
+// members of the test organization, holding the given throttles
+func newLockoutFixture(throttles ...models.LoginThrottle) *lockoutFixture {
+	users := newTestUsers()
+	_, organizations := newTestRoles(users)
+	fixture := &lockoutFixture{
+		throttles: repotest.NewLoginThrottles(throttles...),
+		audit:     repotest.NewAudit(),
+	}
+	logger := zap.NewNop().Sugar()
+	fixture.service = NewLockoutService(fixture.throttles, users, organizations, NewAuditService(fixture.audit, logger), testLockoutPolicy, logger)
+	return fixture
+}
+
+// events returns the test organization's audit events with the action
+func (f *lockoutFixture) events(t *testing.T, action string) []models.AuditEvent {
+	t.Helper()
+	events, _, err := f.audit.List(context.Background(), testOrganizationID, repository.AuditFilter{Action: action}, 0, 100)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return events
+}
+
+func TestLockoutServiceCheck(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		until := now.Add(d)
+		return &until
+	}
+	tests := []struct {
+		name     string
+		throttle *models.LoginThrottle
+		wait     time.Duration // the expected RetryAfter, 0 when not throttled
+	}{
+		{name: "no failures"},
+		{name: "free failures", throttle: &models.LoginThrottle{FailedAttempts: 3, LastFailedAt: now}},
+		{name: "first failure past the free ones", throttle: &models.LoginThrottle{FailedAttempts: 4, LastFailedAt: now}, wait: time.Second},
+		{name: "wait doubles", throttle: &models.LoginThrottle{FailedAttempts: 6, LastFailedAt: now}, wait: 4 * time.Second},
+		{name: "wait is over", throttle: &models.LoginThrottle{FailedAttempts: 6, LastFailedAt: now.Add(-5 * time.Second)}},
+		{name: "wait is capped", throttle: &models.LoginThrottle{FailedAttempts: 40, LastFailedAt: now}, wait: testLockoutPolicy.Duration},
+		{name: "locked", throttle: &models.LoginThrottle{FailedAttempts: 10, LastFailedAt: now, LockedUntil: at(time.Minute)}, wait: time.Minute},
+		{name: "lock expired", throttle: &models.LoginThrottle{FailedAttempts: 10, LastFailedAt: now.Add(-time.Hour), LockedUntil: at(-time.Minute)}},
+		{name: "failures forgotten", throttle: &models.LoginThrottle{FailedAttempts: 9, LastFailedAt: now.Add(-testLockoutPolicy.Duration - time.Second)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var throttles []models.LoginThrottle
+			if tt.throttle != nil {
+				tt.throttle.Email = "member@example.com"
+				throttles = append(throttles, *tt.throttle)
+			}
+			f := newLockoutFixture(throttles...)
+
+			err := f.service.Check(context.Background(), "member@example.com")
+			if tt.wait == 0 {
+				if err != nil {
+					t.Fatalf("Check = %v, want nil", err)
+				}
+				return
+			}
+			var throttled *LoginThrottledError
+			if !errors.As(err, &throttled) || !errors.Is(err, ErrLoginThrottled) {
+				t.Fatalf("Check = %v, want a %T", err, throttled)
+			}
+			if throttled.RetryAfter > tt.wait || throttled.RetryAfter < tt.wait-time.Second {
+				t.Errorf("RetryAfter = %s, want about %s", throttled.RetryAfter, tt.wait)
+			}
+		})
+	}
+}
+
+func TestLockoutServiceRecordFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		throttle *models.LoginThrottle
+		failures int
+		locked   bool
+	}{
+		{name: "first failure", failures: 1},
+		{name: "below the threshold", throttle: &models.LoginThrottle{FailedAttempts: 8, LastFailedAt: time.Now()}, failures: 9},
+		{name: "at the threshold", throttle: &models.LoginThrottle{FailedAttempts: 9, LastFailedAt: time.Now()}, failures: 10, locked: true},
+		{
+			name:     "after old failures",
+			throttle: &models.LoginThrottle{FailedAttempts: 9, LastFailedAt: time.Now().Add(-time.Hour)},
+			failures: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var throttles []models.LoginThrottle
+			if tt.throttle != nil {
+				tt.throttle.Email = "member@example.com"
+				throttles = append(throttles, *tt.throttle)
+			}
+			f := newLockoutFixture(throttles...)
+
+			if err := f.service.RecordFailure(context.Background(), "member@example.com"); err != nil {
+				t.Fatalf("RecordFailure: %v", err)
+			}
+			throttle, err := f.throttles.Find(context.Background(), "member@example.com")
+			if err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+			if throttle.FailedAttempts != tt.failures {
+				t.Errorf("failures = %d, want %d", throttle.FailedAttempts, tt.failures)
+			}
+			if locked := throttle.Locked(time.Now()); locked != tt.locked {
+				t.Errorf("locked = %v, want %v", locked, tt.locked)
+			}
+
+			// the lock is recorded in the organizations of the account
+			events := f.events(t, models.AuditAccountLocked)
+			if !tt.locked {
+				if len(events) != 0 {
+					t.Errorf("recorded %d lock events, want none", len(events))
+				}
+				return
+			}
+			if len(events) != 1 || events[0].TargetID == nil || *events[0].TargetID != testMemberID {
+				t.Errorf("lock events = %+v, want one for user %d", events, testMemberID)
+			}
+		})
+	}
+}
+
+func TestLockoutServiceUnlock(t *testing.T) {
+	lockedUntil := time.Now().Add(time.Hour)
+	f := newLockoutFixture(models.LoginThrottle{
+		Email:          "member@example.com",
+		FailedAttempts: 10,
+		LastFailedAt:   time.Now(),
+		LockedUntil:    &lockedUntil,
+	})
+
+	if err := f.service.Unlock(testContext(), testAdminID, testMemberID); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if err := f.service.Check(context.Background(), "member@example.com"); err != nil {
+		t.Errorf("Check after Unlock = %v, want nil", err)
+	}
+	events := f.events(t, models.AuditAccountUnlocked)
+	if len(events) != 1 || events[0].ActorID == nil || *events[0].ActorID != testAdminID {
+		t.Errorf("unlock events = %+v, want one by user %d", events, testAdminID)
+	}
+
+	if err := f.service.Unlock(testContext(), testAdminID, testOutsider.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Unlock of a non-member = %v, want %v", err, repository.ErrNotFound)
+	}
+}
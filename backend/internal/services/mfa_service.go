@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/totp"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("multi-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("multi-factor authentication is not enabled")
+	ErrMFANotEnrolling   = errors.New("no multi-factor enrollment is in progress")
+	ErrInvalidMFACode    = errors.New("invalid authentication code")
+	ErrMFARequired       = errors.New("the organization requires multi-factor authentication")
+)
+
+const (
+	recoveryCodeCount = 10
+	// totpSkew is how many 30 second steps a code may be off to tolerate clock drift
+	totpSkew = 1
+)
+
+// TOTPEnrollment is what an authenticator app needs to be set up
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// MFAStatus describes a user's second factor
+type MFAStatus struct {
+	Enabled                bool
+	RecoveryCodesRemaining int64
+}
+
+// MFAService manages TOTP enrollment and verifies second factor codes
+type MFAService struct {
+	mfa           repository.MFARepository
+	users         repository.UserRepository
+	organizations repository.OrganizationRepository
+	issuer        string
+	logger        *zap.SugaredLogger
+}
+
+// NewMFAService creates a new MFA service. The issuer names the application in authenticator apps.
+func NewMFAService(
+	mfa repository.MFARepository,
+	users repository.UserRepository,
+	organizations repository.OrganizationRepository,
+	issuer string,
+	logger *zap.SugaredLogger,
+) *MFAService {
+	return &MFAService{
+		mfa:           mfa,
+		users:         users,
+		organizations: organizations,
+		issuer:        issuer,
+		logger:        logger,
+	}
+}
+
+// Status reports whether the user has a confirmed authenticator and how many recovery codes are left
+func (s *MFAService) Status(ctx context.Context, userID int) (*MFAStatus, error) {
+	enabled, err := s.Enabled(ctx, userID)
+	if err != nil || !enabled {
+		return &MFAStatus{}, err
+	}
+
+	remaining, err := s.mfa.CountUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAStatus{Enabled: true, RecoveryCodesRemaining: remaining}, nil
+}
+
+// Enabled reports whether the user has a confirmed authenticator
+func (s *MFAService) Enabled(ctx context.Context, userID int) (bool, error) {
+	device, err := s.mfa.FindDevice(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return device.Confirmed(), nil
+}
+
+// BeginEnrollment generates a new TOTP secret for the user. It replaces any
+// enrollment that was started but not confirmed.
+func (s *MFAService) BeginEnrollment(ctx context.Context, userID int) (*TOTPEnrollment, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled, err := s.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfa.SaveDevice(ctx, &models.TOTPDevice{UserID: user.ID, Secret: secret}); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment activates the user's authenticator once they prove it
+// works, and returns a fresh set of recovery codes. The codes are shown once;
+// only their hashes are kept.
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, userID int, code string) ([]string, error) {
+	device, err := s.mfa.FindDevice(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrMFANotEnrolling
+		}
+		return nil, err
+	}
+	if device.Confirmed() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(device.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	now := time.Now()
+	device.ConfirmedAt = &now
+	device.LastUsedStep = step
+	if err := s.mfa.SaveDevice(ctx, device); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("MFA enabled", "user_id", userID)
+	return s.replaceRecoveryCodes(ctx, userID)
+}
+
+// Disable removes the user's authenticator after verifying a code. It is
+// refused while the context organization requires MFA.
+func (s *MFAService) Disable(ctx context.Context, userID int, code string) error {
+	required, err := s.RequiredByOrganization(ctx)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequired
+	}
+
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+	if err := s.mfa.DeleteDevice(ctx, userID); err != nil {
+		return err
+	}
+
+	s.logger.Infow("MFA disabled", "user_id", userID)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after verifying a code
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	return s.replaceRecoveryCodes(ctx, userID)
+}
+
+// Verify checks a TOTP code or an unused recovery code. Every code is
+// accepted at most once.
+func (s *MFAService) Verify(ctx context.Context, userID int, code string) error {
+	device, err := s.mfa.FindDevice(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrMFANotEnabled
+		}
+		return err
+	}
+	if !device.Confirmed() {
+		return ErrMFANotEnabled
+	}
+
+	if step, ok := totp.Validate(device.Secret, code, time.Now(), totpSkew); ok {
+		fresh, err := s.mfa.UseStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := s.mfa.UseRecoveryCode(ctx, userID, utils.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+
+	s.logger.Infow("Recovery code used", "user_id", userID)
+	return nil
+}
+
+// RequiredByOrganization reports whether the context organization requires MFA
+func (s *MFAService) RequiredByOrganization(ctx context.Context) (bool, error) {
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return false, nil
+	}
+
+	organization, err := s.organizations.FindByID(ctx, organizationID)
+	if err != nil {
+		return false, err
+	}
+	return organization.RequireMFA, nil
+}
+
+// replaceRecoveryCodes generates and stores a new set of recovery codes
+func (s *MFAService) replaceRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		token, err := utils.RandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = token[:5] + "-" + token[5:]
+		hashes[i] = utils.HashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	if err := s.mfa.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode makes recovery codes insensitive to case and separators
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/totp"
+	"go.uber.org/zap"
+)
+
+// testSecret is the secret of the RFC 6238 test vectors
+const testSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func newTestMFAService(devices ...models.TOTPDevice) *MFAService {
+	return NewMFAService(repotest.NewMFA(devices...), nil, nil, "CRM", zap.NewNop().Sugar())
+}
+
+// currentCode returns the code of the test secret for the current step. A step
+// boundary passing during a test keeps it within the skew window.
+func currentCode(t *testing.T) string {
+	t.Helper()
+	code, err := totp.Code(testSecret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+	return code
+}
+
+func TestMFAServiceVerifyRejectsReusedStep(t *testing.T) {
+	confirmed := time.Now()
+	service := newTestMFAService(models.TOTPDevice{UserID: 1, Secret: testSecret, ConfirmedAt: &confirmed})
+	code := currentCode(t)
+
+	if err := service.Verify(context.Background(), 1, code); err != nil {
+		t.Fatalf("first Verify: %v", err)
+	}
+	if err := service.Verify(context.Background(), 1, code); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("reused Verify = %v, want %v", err, ErrInvalidMFACode)
+	}
+}
+
+func TestMFAServiceVerifyRejectsOlderStep(t *testing.T) {
+	confirmed := time.Now()
+	step := totp.Step(time.Now())
+	service := newTestMFAService(models.TOTPDevice{UserID: 1, Secret: testSecret, ConfirmedAt: &confirmed, LastUsedStep: step})
+	previous, err := totp.Code(testSecret, step-1)
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+
+	// the previous step is within the skew window but older than the last one used
+	if err := service.Verify(context.Background(), 1, previous); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("Verify = %v, want %v", err, ErrInvalidMFACode)
+	}
+}
+
+func TestMFAServiceConfirmEnrollmentConsumesStep(t *testing.T) {
+	service := newTestMFAService(models.TOTPDevice{UserID: 1, Secret: testSecret})
+	code := currentCode(t)
+
+	codes, err := service.ConfirmEnrollment(context.Background(), 1, code)
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	// the code that confirmed the device cannot also pass a later check
+	if err := service.Verify(context.Background(), 1, code); !errors.Is(err, ErrInvalidMFACode) {
+		t.Fatalf("Verify with the enrollment code = %v, want %v", err, ErrInvalidMFACode)
+	}
+}
+
+func TestMFAServiceVerifyWithoutDevice(t *testing.T) {
+	service := newTestMFAService(models.TOTPDevice{UserID: 2, Secret: testSecret}) // enrollment not confirmed
+	code := currentCode(t)
+
+	for _, userID := range []int{1, 2} {
+		if err := service.Verify(context.Background(), userID, code); !errors.Is(err, ErrMFANotEnabled) {
+			t.Errorf("Verify for user %d = %v, want %v", userID, err, ErrMFANotEnabled)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrLastAdmin is returned when a change would leave an organization without an admin
+	ErrLastAdmin = errors.New("an organization must keep at least one admin")
+	// ErrCannotRemoveMember is returned when the member holds permissions the remover does not
+	ErrCannotRemoveMember = errors.New("cannot remove a member holding permissions you do not")
+)
+
+// OrganizationInput holds the editable fields of an organization. Nil fields are left unchanged.
+type OrganizationInput struct {
+	Name       *string
+	RequireMFA *bool
+}
+
+// OrganizationService manages organizations and their members
+type OrganizationService struct {
+	organizations repository.OrganizationRepository
+	roles         repository.RoleRepository
+	authz         *AuthorizationService
+	mfaService    *MFAService
+	logger        *zap.SugaredLogger
+}
+
+// NewOrganizationService creates a new organization service
+func NewOrganizationService(
+	organizations repository.OrganizationRepository,
+	roles repository.RoleRepository,
+	authz *AuthorizationService,
+	mfaService *MFAService,
+	logger *zap.SugaredLogger,
+) *OrganizationService {
+	return &OrganizationService{
+		organizations: organizations,
+		roles:         roles,
+		authz:         authz,
+		mfaService:    mfaService,
+		logger:        logger,
+	}
+}
+
+// ListForUser returns the user's memberships with their organizations
+func (s *OrganizationService) ListForUser(ctx context.Context, userID int) ([]models.Membership, error) {
+	return s.organizations.ListMembershipsForUser(ctx, userID)
+}
+
+// Current returns the organization of the context
+func (s *OrganizationService) Current(ctx context.Context) (*models.Organization, error) {
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return nil, repository.ErrMissingTenant
+	}
+	return s.organizations.FindByID(ctx, organizationID)
+}
+
+// UpdateCurrent changes the settings of the context organization. The slug is
+// kept on rename so that links to the organization stay valid. Only an admin
+// who uses MFA themselves can make it mandatory, so that they cannot lock
+// themselves out.
+func (s *OrganizationService) UpdateCurrent(ctx context.Context, actorID int, input OrganizationInput) (*models.Organization, error) {
+	organization, err := s.Current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Name != nil {
+		organization.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.RequireMFA != nil {
+		if *input.RequireMFA && !organization.RequireMFA {
+			enabled, err := s.mfaService.Enabled(ctx, actorID)
+			if err != nil {
+				return nil, err
+			}
+			if !enabled {
+				return nil, ErrMFANotEnabled
+			}
+		}
+		organization.RequireMFA = *input.RequireMFA
+	}
+
+	if err := s.organizations.Update(ctx, organization); err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+// ListMembers returns the members of the context organization
+func (s *OrganizationService) ListMembers(ctx context.Context) ([]models.Membership, error) {
+	return s.organizations.ListMembers(ctx)
+}
+
+// RemoveMember removes a user from the context organization on behalf of a
+// member. Like changing their role, removing someone requires holding every
+// permission they hold, and the last admin cannot be removed.
+func (s *OrganizationService) RemoveMember(ctx context.Context, removerID, userID int) error {
+	membership, err := s.organizations.FindMember(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	covers, err := s.authz.HasPermissionsOf(ctx, strconv.Itoa(removerID), strconv.Itoa(userID))
+	if err != nil {
+		return err
+	}
+	if !covers {
+		return ErrCannotRemoveMember
+	}
+
+	if membership.Role == models.RoleAdmin {
+		admins, err := s.roles.CountMembers(ctx, models.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return ErrLastAdmin
+		}
+	}
+
+	if err := s.organizations.RemoveMember(ctx, userID); err != nil {
+		return err
+	}
+	s.authz.invalidate()
+	return nil
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+func TestOrganizationServiceRemoveMember(t *testing.T) {
+	tests := []struct {
+		name    string
+		remover int
+		userID  int
+		err     error
+	}{
+		{"manager removes a member", testManagerID, testMemberID, nil},
+		{"manager removes an admin", testManagerID, testAdminID, ErrCannotRemoveMember},
+		{"member removes a manager", testMemberID, testManagerID, ErrCannotRemoveMember},
+		{"member leaves", testMemberID, testMemberID, nil},
+		{"admin removes a manager", testAdminID, testManagerID, nil},
+		{"last admin leaves", testAdminID, testAdminID, ErrLastAdmin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newTestUsers()
+			roles, organizations := newTestRoles(users)
+			logger := zap.NewNop().Sugar()
+			authz := NewAuthorizationService(roles, organizations, logger)
+			mfaService := NewMFAService(repotest.NewMFA(), users, organizations, "CRM", logger)
+			service := NewOrganizationService(organizations, roles, authz, mfaService, logger)
+
+			// cache the member's permissions, which the removal must drop
+			if ok, err := authz.HasPermissions(testContext(), strconv.Itoa(tt.userID), models.PermissionContactsRead); err != nil || !ok {
+				t.Fatalf("HasPermissions before the removal = %v, %v", ok, err)
+			}
+
+			err := service.RemoveMember(testContext(), tt.remover, tt.userID)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("RemoveMember = %v, want %v", err, tt.err)
+			}
+
+			removed := tt.err == nil
+			if _, err := organizations.FindMember(testContext(), tt.userID); errors.Is(err, repository.ErrNotFound) != removed {
+				t.Errorf("FindMember after RemoveMember = %v", err)
+			}
+			ok, err := authz.HasPermissions(testContext(), strconv.Itoa(tt.userID), models.PermissionContactsRead)
+			if err != nil {
+				t.Fatalf("HasPermissions: %v", err)
+			}
+			if ok == removed {
+				t.Errorf("HasPermissions after RemoveMember = %v, want %v", ok, !removed)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordBytes is the longest password bcrypt can hash. Request
+// validation counts characters, which take up to four bytes each.
+const maxPasswordBytes = 72
+
+// hashPassword hashes a plain-text password with bcrypt, rejecting passwords
+// bcrypt cannot hash with ErrPasswordTooLong
+func hashPassword(password string) (string, error) {
+	if len(password) > maxPasswordBytes {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash returns a hash to check passwords against when there is
+// no user, so that the check takes as long as for a real one
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		hash, err := hashPassword("not-a-real-password")
+		if err == nil {
+			dummyHash = hash
+		}
+	})
+	return dummyHash
+}
+
+// checkPassword reports whether the password matches the bcrypt hash
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// normalizeEmail lowercases and trims an email address for lookups
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		err      error
+	}{
+		{"72 bytes", strings.Repeat("a", 72), nil},
+		{"72 characters of two bytes", strings.Repeat("é", 72), ErrPasswordTooLong},
+		{"36 characters of two bytes", strings.Repeat("é", 36), nil},
+		{"73 bytes", strings.Repeat("a", 73), ErrPasswordTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := hashPassword(tt.password)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("hashPassword = %v, want %v", err, tt.err)
+			}
+			if err == nil && !checkPassword(hash, tt.password) {
+				t.Error("the password does not match its hash")
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidStages = errors.New("stages must have unique names and belong to the pipeline")
+	ErrStageInUse    = errors.New("stage still has deals")
+	ErrPipelineInUse = errors.New("pipeline still has deals")
+)
+
+// StageInput holds a stage of a pipeline to create or replace. Without an ID
+// the stage is new.
+type StageInput struct {
+	ID          int
+	Name        string
+	Probability int
+}
+
+// PipelineInput holds the data of a pipeline to create or replace. The order
+// of the stages is the order deals move through them.
+type PipelineInput struct {
+	Name   string
+	Stages []StageInput
+}
+
+// PipelineService manages the sales pipelines of an organization and their stages
+type PipelineService struct {
+	pipelines  repository.PipelineRepository
+	deals      repository.DealRepository
+	transactor repository.Transactor
+	logger     *zap.SugaredLogger
+}
+
+// NewPipelineService creates a new pipeline service
+func NewPipelineService(
+	pipelines repository.PipelineRepository,
+	deals repository.DealRepository,
+	transactor repository.Transactor,
+	logger *zap.SugaredLogger,
+) *PipelineService {
+	return &PipelineService{
+		pipelines:  pipelines,
+		deals:      deals,
+		transactor: transactor,
+		logger:     logger,
+	}
+}
+
+// Create adds a pipeline with its stages to the context organization
+func (s *PipelineService) Create(ctx context.Context, input PipelineInput) (*models.Pipeline, error) {
+	if err := checkStages(input.Stages); err != nil {
+		return nil, err
+	}
+
+	pipeline := &models.Pipeline{Name: strings.TrimSpace(input.Name)}
+	for i, stage := range input.Stages {
+		if stage.ID != 0 {
+			return nil, ErrInvalidStages
+		}
+		pipeline.Stages = append(pipeline.Stages, models.Stage{
+			Name:        strings.TrimSpace(stage.Name),
+			Position:    i,
+			Probability: stage.Probability,
+		})
+	}
+	if err := s.pipelines.Create(ctx, pipeline); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("Pipeline created", "pipeline_id", pipeline.ID, "organization_id", pipeline.OrganizationID)
+	return s.pipelines.FindByID(ctx, pipeline.ID)
+}
+
+// Get returns a pipeline of the context organization with its stages
+func (s *PipelineService) Get(ctx context.Context, id int) (*models.Pipeline, error) {
+	return s.pipelines.FindByID(ctx, id)
+}
+
+// List returns the pipelines of the context organization with their stages
+func (s *PipelineService) List(ctx context.Context) ([]models.Pipeline, error) {
+	return s.pipelines.List(ctx)
+}
+
+// Update renames a pipeline and replaces its stages. Stages are matched by ID;
+// stages left out are removed, which is refused while they still have deals.
+func (s *PipelineService) Update(ctx context.Context, id int, input PipelineInput) (*models.Pipeline, error) {
+	if err := checkStages(input.Stages); err != nil {
+		return nil, err
+	}
+
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		pipeline, err := s.pipelines.FindByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		existing := make(map[int]models.Stage, len(pipeline.Stages))
+		for _, stage := range pipeline.Stages {
+			existing[stage.ID] = stage
+		}
+		for i, stageInput := range input.Stages {
+			stage := models.Stage{PipelineID: id}
+			if stageInput.ID != 0 {
+				var ok bool
+				if stage, ok = existing[stageInput.ID]; !ok {
+					return ErrInvalidStages
+				}
+				delete(existing, stageInput.ID)
+			}
+			stage.Name = strings.TrimSpace(stageInput.Name)
+			stage.Position = i
+			stage.Probability = stageInput.Probability
+			if err := s.pipelines.SaveStage(ctx, &stage); err != nil {
+				return err
+			}
+		}
+		for stageID := range existing {
+			count, err := s.deals.CountByStage(ctx, stageID)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrStageInUse
+			}
+			if err := s.pipelines.DeleteStage(ctx, stageID); err != nil {
+				return err
+			}
+		}
+
+		pipeline.Name = strings.TrimSpace(input.Name)
+		return s.pipelines.Update(ctx, pipeline)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.pipelines.FindByID(ctx, id)
+}
+
+// Delete removes a pipeline and its stages, which is refused while the
+// pipeline still has deals
+func (s *PipelineService) Delete(ctx context.Context, id int) error {
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		count, err := s.deals.CountByPipeline(ctx, id)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrPipelineInUse
+		}
+		return s.pipelines.Delete(ctx, id)
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.Infow("Pipeline deleted", "pipeline_id", id)
+	return nil
+}
+
+// checkStages verifies that a pipeline has stages with distinct names
+func checkStages(stages []StageInput) error {
+	if len(stages) == 0 {
+		return ErrInvalidStages
+	}
+	names := make(map[string]bool, len(stages))
+	ids := make(map[int]bool, len(stages))
+	for _, stage := range stages {
+		name := strings.ToLower(strings.TrimSpace(stage.Name))
+		if name == "" || names[name] || (stage.ID != 0 && ids[stage.ID]) {
+			return ErrInvalidStages
+		}
+		names[name], ids[stage.ID] = true, true
+	}
+	return nil
+}
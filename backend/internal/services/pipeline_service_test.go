@@ -0,0 +1,169 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+// salesPipeline returns pipeline 1 of the test organization with stages 1,
+// 2 and 3
+func salesPipeline() models.Pipeline {
+	return models.Pipeline{ID: 1, TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID}, Name: "Sales", Stages: []models.Stage{
+		{ID: 1, PipelineID: 1, Name: "Lead", Position: 0, Probability: 10},
+		{ID: 2, PipelineID: 1, Name: "Proposal", Position: 1, Probability: 50},
+		{ID: 3, PipelineID: 1, Name: "Negotiation", Position: 2, Probability: 80},
+	}}
+}
+
+// renewalsPipeline returns pipeline 2 of the test organization with stage 4
+func renewalsPipeline() models.Pipeline {
+	return models.Pipeline{ID: 2, TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID}, Name: "Renewals", Stages: []models.Stage{
+		{ID: 4, PipelineID: 2, Name: "Due"},
+	}}
+}
+
+func stageNames(pipeline *models.Pipeline) []string {
+	names := make([]string, len(pipeline.Stages))
+	for i, stage := range pipeline.Stages {
+		names[i] = stage.Name
+	}
+	return names
+}
+
+// testDeal returns an open deal of the test organization in stage 1 of the
+// sales pipeline
+func testDeal(id int, title string) models.Deal {
+	return models.Deal{
+		ID:          id,
+		TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID},
+		Title:       title,
+		Status:      models.DealOpen,
+		PipelineID:  1,
+		StageID:     1,
+	}
+}
+
+func newTestPipelineService(pipelines *repotest.Pipelines, deals *repotest.Deals) *PipelineService {
+	return NewPipelineService(pipelines, deals, repotest.Transactor{}, zap.NewNop().Sugar())
+}
+
+func TestCheckStages(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages []StageInput
+		valid  bool
+	}{
+		{"distinct names", []StageInput{{Name: "Lead"}, {Name: "Won"}}, true},
+		{"existing stages", []StageInput{{ID: 1, Name: "Lead"}, {ID: 2, Name: "Won"}, {Name: "New"}}, true},
+		{"no stages", nil, false},
+		{"blank name", []StageInput{{Name: "Lead"}, {Name: "  "}}, false},
+		{"names differing in case", []StageInput{{Name: "Lead"}, {Name: " lead"}}, false},
+		{"repeated ID", []StageInput{{ID: 1, Name: "Lead"}, {ID: 1, Name: "Won"}}, false},
+	}
+	for _, tt := range tests {
+		err := checkStages(tt.stages)
+		if tt.valid && err != nil {
+			t.Errorf("%s: checkStages = %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidStages) {
+			t.Errorf("%s: checkStages = %v, want %v", tt.name, err, ErrInvalidStages)
+		}
+	}
+}
+
+func TestPipelineServiceCreate(t *testing.T) {
+	service := newTestPipelineService(repotest.NewPipelines(), repotest.NewDeals(nil))
+
+	pipeline, err := service.Create(testContext(), PipelineInput{
+		Name:   " Sales ",
+		Stages: []StageInput{{Name: " Lead", Probability: 10}, {Name: "Won", Probability: 100}},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if pipeline.Name != "Sales" || !reflect.DeepEqual(stageNames(pipeline), []string{"Lead", "Won"}) {
+		t.Errorf("pipeline = %q %v", pipeline.Name, stageNames(pipeline))
+	}
+	if stage := pipeline.Stages[1]; stage.Position != 1 || stage.Probability != 100 {
+		t.Errorf("second stage = %+v", stage)
+	}
+
+	// new pipelines cannot take over stages of other pipelines
+	_, err = service.Create(testContext(), PipelineInput{Name: "Renewals", Stages: []StageInput{{ID: 1, Name: "Lead"}}})
+	if !errors.Is(err, ErrInvalidStages) {
+		t.Errorf("Create with a stage ID = %v, want %v", err, ErrInvalidStages)
+	}
+}
+
+func TestPipelineServiceUpdate(t *testing.T) {
+	pipelines := repotest.NewPipelines(salesPipeline())
+	service := newTestPipelineService(pipelines, repotest.NewDeals(nil))
+
+	// stage 2 is renamed and moved first, stage 1 kept and stage 3 removed
+	pipeline, err := service.Update(testContext(), 1, PipelineInput{
+		Name: "Enterprise",
+		Stages: []StageInput{
+			{ID: 2, Name: "Proposal sent", Probability: 40},
+			{ID: 1, Name: "Lead", Probability: 10},
+			{Name: "Closing", Probability: 90},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if pipeline.Name != "Enterprise" || !reflect.DeepEqual(stageNames(pipeline), []string{"Proposal sent", "Lead", "Closing"}) {
+		t.Errorf("pipeline = %q %v", pipeline.Name, stageNames(pipeline))
+	}
+	if stage := pipeline.Stages[0]; stage.ID != 2 || stage.Probability != 40 {
+		t.Errorf("first stage = %+v, want stage 2 updated", stage)
+	}
+	if _, err := pipelines.FindStage(testContext(), 3); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("the stage left out was not deleted: %v", err)
+	}
+}
+
+func TestPipelineServiceUpdateRejectsInvalidStages(t *testing.T) {
+	negotiating := testDeal(1, "Big sale")
+	negotiating.StageID = 3
+	tests := []struct {
+		name   string
+		id     int
+		stages []StageInput
+		want   error
+	}{
+		{"stage of another pipeline", 1, []StageInput{{ID: 1, Name: "Lead"}, {ID: 9, Name: "Won"}, {ID: 3, Name: "Negotiation"}}, ErrInvalidStages},
+		{"removed stage with deals", 1, []StageInput{{ID: 1, Name: "Lead"}}, ErrStageInUse},
+		{"missing pipeline", 2, []StageInput{{Name: "Lead"}}, repository.ErrNotFound},
+	}
+	for _, tt := range tests {
+		service := newTestPipelineService(repotest.NewPipelines(salesPipeline()), repotest.NewDeals(nil, negotiating))
+		if _, err := service.Update(testContext(), tt.id, PipelineInput{Name: "Sales", Stages: tt.stages}); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Update = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestPipelineServiceDelete(t *testing.T) {
+	won := testDeal(1, "Big sale")
+	won.Status = models.DealWon
+	service := newTestPipelineService(
+		repotest.NewPipelines(salesPipeline(), renewalsPipeline()),
+		repotest.NewDeals(nil, won),
+	)
+
+	if err := service.Delete(testContext(), 1); !errors.Is(err, ErrPipelineInUse) {
+		t.Errorf("Delete of a pipeline with deals = %v, want %v", err, ErrPipelineInUse)
+	}
+	if err := service.Delete(testContext(), 2); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := service.Get(testContext(), 2); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want %v", err, repository.ErrNotFound)
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+)
+
+// checkOwner verifies that the owner of a CRM record, if any, is an active
+// member of the context organization
+func checkOwner(ctx context.Context, organizations repository.OrganizationRepository, ownerID *int) error {
+	if ownerID == nil {
+		return nil
+	}
+	if _, err := organizations.FindMember(ctx, *ownerID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidOwner
+		}
+		return err
+	}
+	return nil
+}
+
+// checkRecord verifies that a CRM record exists in the context organization
+func checkRecord(
+	ctx context.Context,
+	contacts repository.ContactRepository,
+	companies repository.CompanyRepository,
+	deals repository.DealRepository,
+	recordType string,
+	recordID int,
+) error {
+	var err error
+	switch recordType {
+	case models.RecordContact:
+		_, err = contacts.FindByID(ctx, recordID)
+	case models.RecordCompany:
+		_, err = companies.FindByID(ctx, recordID)
+	case models.RecordDeal:
+		_, err = deals.FindByID(ctx, recordID)
+	default:
+		err = repository.ErrNotFound
+	}
+	return err
+}
+
+// normalizeAddress trims the parts of an address
+func normalizeAddress(address models.Address) models.Address {
+	return models.Address{
+		Street:     strings.TrimSpace(address.Street),
+		City:       strings.TrimSpace(address.City),
+		Region:     strings.TrimSpace(address.Region),
+		PostalCode: strings.TrimSpace(address.PostalCode),
+		Country:    strings.TrimSpace(address.Country),
+	}
+}
+
+// newTaggings returns the taggings for a record's tag names
+func newTaggings(tags []string) []models.Tagging {
+	names := normalizeTags(tags)
+	taggings := make([]models.Tagging, len(names))
+	for i, name := range names {
+		taggings[i] = models.Tagging{Name: name}
+	}
+	return taggings
+}
+
+// normalizeTags trims and lower-cases tag names, dropping empty and repeated ones
+func normalizeTags(tags []string) []string {
+	names := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		name := strings.ToLower(strings.TrimSpace(tag))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/notifier"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// reminderBatchSize bounds how many tasks are loaded at once when sending
+// reminders
+const reminderBatchSize = 100
+
+// ReminderScheduler periodically reminds the assignees of pending tasks that
+// come due, across all organizations. Tasks without a reminder time are
+// reminded a default lead time before they are due. Every task is claimed before its
+// reminder is sent, so several instances of the application can run a
+// scheduler and each reminder still goes out at most once.
+type ReminderScheduler struct {
+	tasks    repository.TaskRepository
+	notifier notifier.Notifier
+	interval time.Duration
+	lead     time.Duration
+	logger   *zap.SugaredLogger
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewReminderScheduler creates a scheduler that looks for due reminders every
+// interval, reminding of tasks without a reminder time lead before they are
+// due
+func NewReminderScheduler(
+	tasks repository.TaskRepository,
+	notify notifier.Notifier,
+	interval time.Duration,
+	lead time.Duration,
+	logger *zap.SugaredLogger,
+) *ReminderScheduler {
+	return &ReminderScheduler{
+		tasks:    tasks,
+		notifier: notify,
+		interval: interval,
+		lead:     lead,
+		logger:   logger,
+	}
+}
+
+// Start runs the scheduler in the background until Stop is called. Starting a
+// running scheduler has no effect.
+func (s *ReminderScheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel, s.done = cancel, make(chan struct{})
+	go s.run(ctx, s.done)
+	s.logger.Infow("Reminder scheduler started", "interval", s.interval, "default_lead", s.lead)
+}
+
+// Stop stops the scheduler and waits for the reminders being sent, or until
+// the context is done
+func (s *ReminderScheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel, s.done = nil, nil
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		s.logger.Info("Reminder scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run sends the due reminders every interval until the context is cancelled
+func (s *ReminderScheduler) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.SendDue(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Errorw("Failed to send task reminders", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDue reminds the assignees of every pending task whose reminder is due
+// and returns the number of reminders sent. A reminder that fails to be
+// delivered is logged and not retried.
+func (s *ReminderScheduler) SendDue(ctx context.Context) (int, error) {
+	ctx = tenant.Unscoped(ctx)
+	sent := 0
+	for ctx.Err() == nil {
+		now := time.Now()
+		tasks, err := s.tasks.ListDueReminders(ctx, now, s.lead, reminderBatchSize)
+		if err != nil {
+			return sent, err
+		}
+
+		for _, task := range tasks {
+			claimed, err := s.tasks.MarkReminded(ctx, task.ID, now)
+			if err != nil {
+				return sent, err
+			}
+			if !claimed {
+				continue // reminded by another instance
+			}
+
+			err = s.notifier.Remind(ctx, notifier.Reminder{
+				OrganizationID: task.OrganizationID,
+				UserID:         task.Assignee.ID,
+				Email:          task.Assignee.Email,
+				TaskID:         task.ID,
+				Title:          task.Title,
+				DueAt:          task.DueAt,
+			})
+			if err != nil {
+				s.logger.Errorw("Failed to send task reminder", "task_id", task.ID, "user_id", task.Assignee.ID, "error", err)
+				continue
+			}
+			sent++
+		}
+
+		if len(tasks) < reminderBatchSize {
+			break
+		}
+	}
+	return sent, ctx.Err()
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/notifier"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// reminderDue is when the tasks of newDueTasks were due
+var reminderDue = time.Date(2025, 10, 20, 9, 0, 0, 0, time.UTC)
+
+// newDueTasks returns tasks of the test organization whose reminders are
+// due, each assigned to the user with the task's ID
+func newDueTasks(count int) *repotest.Tasks {
+	due := reminderDue
+	users := repotest.NewUsers()
+	var tasks []models.Task
+	for id := 1; id <= count; id++ {
+		if err := users.Create(context.Background(), &models.User{Email: fmt.Sprintf("member%d@example.com", id)}); err != nil {
+			panic(err)
+		}
+		task := testTask(id, "Call back")
+		task.AssigneeID, task.DueAt = &id, &due
+		tasks = append(tasks, task)
+	}
+	return repotest.NewTasks(users, tasks...)
+}
+
+// reminderOutbox stands in for the notifier, failing for some tasks
+type reminderOutbox struct {
+	mu        sync.Mutex
+	reminders []notifier.Reminder
+	failing   map[int]bool
+	sent      chan struct{} // signalled for every reminder sent, when set
+}
+
+func (o *reminderOutbox) Remind(ctx context.Context, reminder notifier.Reminder) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.failing[reminder.TaskID] {
+		return errors.New("mailbox unavailable")
+	}
+	o.reminders = append(o.reminders, reminder)
+	if o.sent != nil {
+		o.sent <- struct{}{}
+	}
+	return nil
+}
+
+func TestReminderSchedulerSendDue(t *testing.T) {
+	tasks := newDueTasks(3)
+	other := testTask(4, "Renew contract")
+	other.OrganizationID, other.AssigneeID, other.DueAt = testOtherOrganizationID, ptrInt(1), ptrTime(time.Now().Add(-time.Minute))
+	if err := tasks.Create(tenant.Unscoped(context.Background()), &other); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// task 2 was claimed by another instance
+	if claimed, err := tasks.MarkReminded(testContext(), 2, time.Now()); err != nil || !claimed {
+		t.Fatalf("MarkReminded = %v, %v", claimed, err)
+	}
+	outbox := &reminderOutbox{failing: map[int]bool{3: true}}
+	scheduler := NewReminderScheduler(tasks, outbox, time.Minute, time.Hour, zap.NewNop().Sugar())
+
+	sent, err := scheduler.SendDue(context.Background())
+	if err != nil {
+		t.Fatalf("SendDue: %v", err)
+	}
+	if sent != 2 || len(outbox.reminders) != 2 {
+		t.Fatalf("sent %d reminders %+v, want the ones for tasks 1 and %d", sent, outbox.reminders, other.ID)
+	}
+	want := notifier.Reminder{
+		OrganizationID: testOrganizationID,
+		UserID:         1,
+		Email:          "member1@example.com",
+		TaskID:         1,
+		Title:          "Call back",
+	}
+	got := outbox.reminders[0]
+	if got.DueAt == nil || !got.DueAt.Equal(reminderDue) {
+		t.Errorf("due at %v, want %v", got.DueAt, reminderDue)
+	}
+	if got.DueAt = nil; got != want {
+		t.Errorf("reminder = %+v, want %+v", got, want)
+	}
+	if got := outbox.reminders[1]; got.TaskID != other.ID || got.OrganizationID != testOtherOrganizationID {
+		t.Errorf("reminder = %+v, want the one of the other organization", got)
+	}
+
+	// neither the claimed nor the failed reminder is sent again
+	if sent, err := scheduler.SendDue(context.Background()); err != nil || sent != 0 {
+		t.Errorf("second SendDue = %d, %v, want nothing sent", sent, err)
+	}
+}
+
+func TestReminderSchedulerDefaultLead(t *testing.T) {
+	now := time.Now()
+	// task builds a task of the test organization assigned to user 1
+	task := func(id int, dueAt, remindAt *time.Time) models.Task {
+		task := testTask(id, "Call back")
+		task.AssigneeID, task.DueAt, task.RemindAt = ptrInt(1), dueAt, remindAt
+		return task
+	}
+	users := repotest.NewUsers(models.User{ID: 1, Email: "member1@example.com"})
+	tasks := repotest.NewTasks(users,
+		task(1, ptrTime(now.Add(30*time.Minute)), nil),
+		task(2, ptrTime(now.Add(90*time.Minute)), nil),
+		task(3, ptrTime(now.Add(30*time.Minute)), ptrTime(now.Add(20*time.Minute))),
+		task(4, ptrTime(now.Add(90*time.Minute)), ptrTime(now.Add(-time.Minute))),
+		task(5, nil, nil),
+	)
+	outbox := &reminderOutbox{}
+	scheduler := NewReminderScheduler(tasks, outbox, time.Minute, time.Hour, zap.NewNop().Sugar())
+
+	if _, err := scheduler.SendDue(context.Background()); err != nil {
+		t.Fatalf("SendDue: %v", err)
+	}
+	var reminded []int
+	for _, reminder := range outbox.reminders {
+		reminded = append(reminded, reminder.TaskID)
+	}
+	// task 1 is due within the lead and task 4 has a reminder time passed
+	if !equalIDs(reminded, []int{4, 1}) {
+		t.Errorf("reminded of tasks %v, want [4 1]", reminded)
+	}
+}
+
+func TestReminderSchedulerSendDueInBatches(t *testing.T) {
+	tasks := newDueTasks(reminderBatchSize + 20)
+	outbox := &reminderOutbox{}
+	scheduler := NewReminderScheduler(tasks, outbox, time.Minute, time.Hour, zap.NewNop().Sugar())
+
+	sent, err := scheduler.SendDue(context.Background())
+	if err != nil {
+		t.Fatalf("SendDue: %v", err)
+	}
+	if sent != reminderBatchSize+20 {
+		t.Errorf("sent %d reminders, want %d", sent, reminderBatchSize+20)
+	}
+}
+
+func TestReminderSchedulersSendEachReminderOnce(t *testing.T) {
+	tasks := newDueTasks(50)
+	outbox := &reminderOutbox{}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		scheduler := NewReminderScheduler(tasks, outbox, time.Minute, time.Hour, zap.NewNop().Sugar())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := scheduler.SendDue(context.Background()); err != nil {
+				t.Errorf("SendDue: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	reminded := make(map[int]int)
+	for _, reminder := range outbox.reminders {
+		reminded[reminder.TaskID]++
+	}
+	if len(outbox.reminders) != 50 || len(reminded) != 50 {
+		t.Errorf("sent %d reminders for %d tasks, want one for each of the 50 tasks", len(outbox.reminders), len(reminded))
+	}
+}
+
+func TestReminderSchedulerStartStop(t *testing.T) {
+	tasks := newDueTasks(1)
+	outbox := &reminderOutbox{sent: make(chan struct{}, 1)}
+	scheduler := NewReminderScheduler(tasks, outbox, time.Hour, time.Hour, zap.NewNop().Sugar())
+
+	scheduler.Start()
+	scheduler.Start() // no effect on a running scheduler
+	select {
+	case <-outbox.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reminder was sent after starting the scheduler")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := scheduler.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := scheduler.Stop(ctx); err != nil {
+		t.Errorf("second Stop: %v", err)
+	}
+	task, err := tasks.FindByID(testContext(), 1)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if task.RemindedAt == nil {
+		t.Error("the task sent a reminder is not marked reminded")
+	}
+}
+
+func ptrInt(value int) *int {
+	return &value
+}
@@ -0,0 +1,739 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/scim"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrSCIMInvalidValue = errors.New("invalid attribute value")
+	ErrSCIMMutability   = errors.New("attribute cannot be changed")
+	ErrSCIMNoTarget     = errors.New("operation has no target")
+)
+
+// SCIMUserInput holds the attributes of a SCIM user the CRM keeps. Users are
+// shared between organizations, so DisplayName is only used when the user
+// is created and UserName cannot change.
+type SCIMUserInput struct {
+	UserName    string
+	ExternalID  string
+	DisplayName string
+	Active      *bool // nil leaves the state unchanged; new users are active
+}
+
+// SCIMGroup is a role as a SCIM group, with the members holding it
+type SCIMGroup struct {
+	Role    *models.Role
+	Members []models.Membership
+}
+
+// groupMember is an entry of the members attribute of a group
+type groupMember struct {
+	Value string `json:"value"`
+}
+
+// SCIMService provisions the members of an organization from an identity
+// provider. SCIM users are memberships: creating one adds the user to the
+// organization, creating their account when needed, and deactivating one
+// keeps the membership but revokes its access. SCIM groups are roles; since
+// a member holds exactly one role, adding them to a group moves them out of
+// their previous one, and removing them gives them the user role.
+type SCIMService struct {
+	scim           repository.SCIMRepository
+	users          repository.UserRepository
+	organizations  repository.OrganizationRepository
+	roles          repository.RoleRepository
+	transactor     repository.Transactor
+	authzService   *AuthorizationService
+	sessionService *SessionService
+	apiKeyService  *APIKeyService
+	auditService   *AuditService
+	logger         *zap.SugaredLogger
+}
+
+// NewSCIMService creates a new SCIM provisioning service
+func NewSCIMService(
+	scim repository.SCIMRepository,
+	users repository.UserRepository,
+	organizations repository.OrganizationRepository,
+	roles repository.RoleRepository,
+	transactor repository.Transactor,
+	authzService *AuthorizationService,
+	sessionService *SessionService,
+	apiKeyService *APIKeyService,
+	auditService *AuditService,
+	logger *zap.SugaredLogger,
+) *SCIMService {
+	return &SCIMService{
+		scim:           scim,
+		users:          users,
+		organizations:  organizations,
+		roles:          roles,
+		transactor:     transactor,
+		authzService:   authzService,
+		sessionService: sessionService,
+		apiKeyService:  apiKeyService,
+		auditService:   auditService,
+		logger:         logger,
+	}
+}
+
+// ListUsers returns a page of the users matching the filter, starting at the
+// 1-based index, and the number of matching users
+func (s *SCIMService) ListUsers(ctx context.Context, filter string, startIndex, count int) ([]models.Membership, int64, error) {
+	parsed, err := parseFilter(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.scim.ListUsers(ctx, parsed, startIndex-1, count)
+}
+
+// GetUser returns a user of the context organization
+func (s *SCIMService) GetUser(ctx context.Context, userID int) (*models.Membership, error) {
+	return s.scim.FindUser(ctx, userID)
+}
+
+// CreateUser adds the user with the email address in UserName to the context
+// organization with the user role, creating their account if they have none.
+// Accounts created here have no password; users sign in with single sign-on
+// or set one with a password reset.
+func (s *SCIMService) CreateUser(ctx context.Context, input SCIMUserInput) (*models.Membership, error) {
+	email := normalizeEmail(input.UserName)
+	var membership *models.Membership
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		user, err := s.users.FindByEmail(ctx, email)
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			user = &models.User{Email: email, BuisnessName: strings.TrimSpace(input.DisplayName)}
+			if err := s.users.Create(ctx, user); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case user.ServiceAccount:
+			return ErrEmailTaken
+		}
+
+		membership = &models.Membership{UserID: user.ID, Role: models.RoleUser, ExternalID: input.ExternalID}
+		if input.Active != nil && !*input.Active {
+			now := time.Now()
+			membership.DeactivatedAt = &now
+		}
+		if err := s.organizations.AddMember(ctx, membership); err != nil {
+			if errors.Is(err, repository.ErrDuplicate) {
+				return ErrAlreadyMember
+			}
+			return err
+		}
+		membership.User = user
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("User provisioned by SCIM", "user_id", membership.UserID, "organization_id", membership.OrganizationID)
+	s.record(ctx, models.AuditUserProvisioned, membership)
+	return membership, nil
+}
+
+// ReplaceUser replaces the attributes of a user of the context organization
+func (s *SCIMService) ReplaceUser(ctx context.Context, userID int, input SCIMUserInput) (*models.Membership, error) {
+	var membership *models.Membership
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if membership, err = s.scim.FindUser(ctx, userID); err != nil {
+			return err
+		}
+		return s.updateUser(ctx, membership, input)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// PatchUser applies PATCH operations to a user of the context organization.
+// Operations on attributes the CRM does not keep are ignored.
+func (s *SCIMService) PatchUser(ctx context.Context, userID int, operations []scim.PatchOperation) (*models.Membership, error) {
+	var membership *models.Membership
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if membership, err = s.scim.FindUser(ctx, userID); err != nil {
+			return err
+		}
+
+		input := SCIMUserInput{UserName: membership.User.Email, ExternalID: membership.ExternalID}
+		for _, operation := range operations {
+			if err := patchUser(&input, operation); err != nil {
+				return err
+			}
+		}
+		return s.updateUser(ctx, membership, input)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// DeleteUser removes a user from the context organization, revoking their
+// access to it. Their account is kept.
+func (s *SCIMService) DeleteUser(ctx context.Context, userID int) error {
+	var membership *models.Membership
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if membership, err = s.scim.FindUser(ctx, userID); err != nil {
+			return err
+		}
+		if membership.Active() {
+			if err := s.checkLastAdmin(ctx, membership); err != nil {
+				return err
+			}
+			if err := s.revokeAccess(ctx, membership); err != nil {
+				return err
+			}
+		}
+		return s.organizations.RemoveMember(ctx, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Infow("User deprovisioned by SCIM", "user_id", userID, "organization_id", membership.OrganizationID)
+	s.record(ctx, models.AuditUserDeprovisioned, membership)
+	return nil
+}
+
+// updateUser applies the input to the membership, deactivating or
+// reactivating it when its state changes
+func (s *SCIMService) updateUser(ctx context.Context, membership *models.Membership, input SCIMUserInput) error {
+	if normalizeEmail(input.UserName) != membership.User.Email {
+		return fmt.Errorf("%w: userName", ErrSCIMMutability)
+	}
+	membership.ExternalID = input.ExternalID
+
+	switch {
+	case input.Active == nil || *input.Active == membership.Active():
+		return s.organizations.UpdateMember(ctx, membership)
+	case *input.Active:
+		return s.reactivate(ctx, membership)
+	default:
+		return s.deactivate(ctx, membership)
+	}
+}
+
+// deactivate keeps the member from using the organization and immediately
+// ends their sessions and revokes their API keys in it
+func (s *SCIMService) deactivate(ctx context.Context, membership *models.Membership) error {
+	if err := s.checkLastAdmin(ctx, membership); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	membership.DeactivatedAt = &now
+	if err := s.organizations.UpdateMember(ctx, membership); err != nil {
+		return err
+	}
+	if err := s.revokeAccess(ctx, membership); err != nil {
+		return err
+	}
+
+	s.logger.Infow("User deactivated by SCIM", "user_id", membership.UserID, "organization_id", membership.OrganizationID)
+	s.record(ctx, models.AuditUserDeactivated, membership)
+	return nil
+}
+
+// reactivate restores the member's access with their previous role, or the
+// user role if it has been deleted since. Revoked API keys stay revoked.
+func (s *SCIMService) reactivate(ctx context.Context, membership *models.Membership) error {
+	if _, err := s.roles.FindByName(ctx, membership.Role); err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		membership.Role = models.RoleUser
+	}
+
+	membership.DeactivatedAt = nil
+	if err := s.organizations.UpdateMember(ctx, membership); err != nil {
+		return err
+	}
+	s.authzService.invalidate()
+
+	s.logger.Infow("User reactivated by SCIM", "user_id", membership.UserID, "organization_id", membership.OrganizationID)
+	s.record(ctx, models.AuditUserReactivated, membership)
+	return nil
+}
+
+// revokeAccess ends the member's sessions in the organization, revokes their
+// access tokens and API keys there and drops their cached permissions
+func (s *SCIMService) revokeAccess(ctx context.Context, membership *models.Membership) error {
+	if err := s.apiKeyService.RevokeAllForUser(ctx, membership.UserID); err != nil {
+		return err
+	}
+	if err := s.sessionService.endAllForMember(ctx, membership.UserID, membership.OrganizationID); err != nil {
+		return err
+	}
+	s.authzService.invalidate()
+	return nil
+}
+
+// checkLastAdmin keeps the organization's last active admin from losing access
+func (s *SCIMService) checkLastAdmin(ctx context.Context, membership *models.Membership) error {
+	if membership.Role != models.RoleAdmin || !membership.Active() {
+		return nil
+	}
+	admins, err := s.roles.CountMembers(ctx, models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// patchUser applies a PATCH operation to the user attributes
+func patchUser(input *SCIMUserInput, operation scim.PatchOperation) error {
+	switch operation.Operation() {
+	case "add", "replace":
+		if operation.Path == "" {
+			return eachAttribute(operation.Value, func(path *scim.Path, value json.RawMessage) error {
+				return setUserAttribute(input, path, value)
+			})
+		}
+		path, err := scim.ParsePath(operation.Path)
+		if err != nil {
+			return err
+		}
+		return setUserAttribute(input, path, operation.Value)
+	case "remove":
+		if operation.Path == "" {
+			return ErrSCIMNoTarget
+		}
+		path, err := scim.ParsePath(operation.Path)
+		if err != nil {
+			return err
+		}
+		switch attributeKey(path) {
+		case "externalid":
+			input.ExternalID = ""
+		case "username", "active":
+			return fmt.Errorf("%w: %s is required", ErrSCIMMutability, path.Attribute)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown operation %q", ErrSCIMInvalidValue, operation.Op)
+	}
+}
+
+// setUserAttribute sets a user attribute the CRM keeps and ignores the others
+func setUserAttribute(input *SCIMUserInput, path *scim.Path, value json.RawMessage) error {
+	switch attributeKey(path) {
+	case "username":
+		return unmarshalValue(path, value, &input.UserName)
+	case "externalid":
+		return unmarshalValue(path, value, &input.ExternalID)
+	case "displayname":
+		return unmarshalValue(path, value, &input.DisplayName)
+	case "active":
+		active, ok := scim.Bool(value)
+		if !ok {
+			return fmt.Errorf("%w: active must be a boolean", ErrSCIMInvalidValue)
+		}
+		input.Active = &active
+	}
+	return nil
+}
+
+// ListGroups returns a page of the groups matching the filter, starting at
+// the 1-based index, and the number of matching groups. Members are only
+// loaded when withMembers is set.
+func (s *SCIMService) ListGroups(ctx context.Context, filter string, startIndex, count int, withMembers bool) ([]SCIMGroup, int64, error) {
+	parsed, err := parseFilter(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	roles, total, err := s.scim.ListGroups(ctx, parsed, startIndex-1, count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	groups := make([]SCIMGroup, len(roles))
+	names := make([]string, len(roles))
+	for i := range roles {
+		groups[i].Role = &roles[i]
+		names[i] = roles[i].Name
+	}
+	if !withMembers {
+		return groups, total, nil
+	}
+
+	memberships, err := s.scim.ListGroupMembers(ctx, names)
+	if err != nil {
+		return nil, 0, err
+	}
+	byRole := make(map[string][]models.Membership, len(roles))
+	for _, membership := range memberships {
+		byRole[membership.Role] = append(byRole[membership.Role], membership)
+	}
+	for i := range groups {
+		groups[i].Members = byRole[groups[i].Role.Name]
+	}
+	return groups, total, nil
+}
+
+// GetGroup returns a group with its members
+func (s *SCIMService) GetGroup(ctx context.Context, id int) (*SCIMGroup, error) {
+	role, err := s.roles.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.group(ctx, role)
+}
+
+// CreateGroup creates a custom role without permissions, which admins grant
+// in the CRM, and moves the members into it
+func (s *SCIMService) CreateGroup(ctx context.Context, displayName string, memberIDs []string) (*SCIMGroup, error) {
+	var role *models.Role
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		// the role grants nothing, so there is no one whose permissions limit it
+		if role, err = s.authzService.createRole(ctx, displayName, "", nil); err != nil {
+			return err
+		}
+		for _, id := range memberIDs {
+			if err := s.addMember(ctx, role, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("Group provisioned by SCIM", "role_id", role.ID, "role", role.Name)
+	return s.group(ctx, role)
+}
+
+// ReplaceGroup sets the members of a group. Roles cannot be renamed.
+func (s *SCIMService) ReplaceGroup(ctx context.Context, id int, displayName string, memberIDs []string) (*SCIMGroup, error) {
+	role, err := s.roles.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if displayName != role.Name {
+		return nil, fmt.Errorf("%w: displayName", ErrSCIMMutability)
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.setMembers(ctx, role, memberIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.group(ctx, role)
+}
+
+// PatchGroup applies PATCH operations to the members of a group. Operations
+// on attributes other than displayName and members are ignored.
+func (s *SCIMService) PatchGroup(ctx context.Context, id int, operations []scim.PatchOperation) (*SCIMGroup, error) {
+	role, err := s.roles.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		for _, operation := range operations {
+			op := operation.Operation()
+			if op != "add" && op != "replace" && op != "remove" {
+				return fmt.Errorf("%w: unknown operation %q", ErrSCIMInvalidValue, operation.Op)
+			}
+
+			if operation.Path == "" {
+				if op == "remove" {
+					return ErrSCIMNoTarget
+				}
+				err := eachAttribute(operation.Value, func(path *scim.Path, value json.RawMessage) error {
+					return s.patchGroup(ctx, role, op, path, value)
+				})
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			path, err := scim.ParsePath(operation.Path)
+			if err != nil {
+				return err
+			}
+			if err := s.patchGroup(ctx, role, op, path, operation.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.group(ctx, role)
+}
+
+// patchGroup applies an operation on one attribute of a group
+func (s *SCIMService) patchGroup(ctx context.Context, role *models.Role, op string, path *scim.Path, value json.RawMessage) error {
+	switch attributeKey(path) {
+	case "members":
+	case "displayname":
+		var name string
+		if op == "remove" || json.Unmarshal(value, &name) != nil || name != role.Name {
+			return fmt.Errorf("%w: displayName", ErrSCIMMutability)
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	var memberIDs []string
+	switch {
+	case path.Filter != nil:
+		ids, err := memberFilterIDs(path.Filter)
+		if err != nil {
+			return err
+		}
+		memberIDs = ids
+	case len(value) > 0 && string(value) != "null":
+		var members []groupMember
+		if err := json.Unmarshal(value, &members); err != nil {
+			return fmt.Errorf("%w: members must be a list of members", ErrSCIMInvalidValue)
+		}
+		for _, member := range members {
+			memberIDs = append(memberIDs, member.Value)
+		}
+	case op != "remove":
+		return fmt.Errorf("%w: members requires a value", ErrSCIMInvalidValue)
+	}
+
+	switch {
+	case op == "replace" && path.Filter == nil:
+		return s.setMembers(ctx, role, memberIDs)
+	case op == "remove" && path.Filter == nil && memberIDs == nil:
+		// removing the attribute removes every member
+		return s.setMembers(ctx, role, nil)
+	case op == "remove":
+		for _, id := range memberIDs {
+			if err := s.removeMember(ctx, role, id); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, id := range memberIDs {
+			if err := s.addMember(ctx, role, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteGroup moves the members of a custom role to the user role and deletes it
+func (s *SCIMService) DeleteGroup(ctx context.Context, id int) error {
+	role, err := s.roles.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if role.IsSystem {
+		return ErrSystemRole
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.setMembers(ctx, role, nil); err != nil {
+			return err
+		}
+		return s.authzService.DeleteRole(ctx, id)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.Infow("Group deprovisioned by SCIM", "role_id", role.ID, "role", role.Name)
+	return nil
+}
+
+// group loads the members of a role
+func (s *SCIMService) group(ctx context.Context, role *models.Role) (*SCIMGroup, error) {
+	members, err := s.scim.ListGroupMembers(ctx, []string{role.Name})
+	if err != nil {
+		return nil, err
+	}
+	return &SCIMGroup{Role: role, Members: members}, nil
+}
+
+// setMembers makes the users with the IDs the only members of the role
+func (s *SCIMService) setMembers(ctx context.Context, role *models.Role, memberIDs []string) error {
+	wanted := make(map[string]bool, len(memberIDs))
+	for _, id := range memberIDs {
+		wanted[id] = true
+	}
+
+	current, err := s.scim.ListGroupMembers(ctx, []string{role.Name})
+	if err != nil {
+		return err
+	}
+	for _, membership := range current {
+		if id := strconv.Itoa(membership.UserID); !wanted[id] {
+			if err := s.removeMember(ctx, role, id); err != nil {
+				return err
+			}
+		}
+	}
+	for _, id := range memberIDs {
+		if err := s.addMember(ctx, role, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addMember gives the user with the ID the role
+func (s *SCIMService) addMember(ctx context.Context, role *models.Role, id string) error {
+	membership, err := s.findMember(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("%w: unknown member %q", ErrSCIMInvalidValue, id)
+		}
+		return err
+	}
+	return s.setRole(ctx, membership, role.Name)
+}
+
+// removeMember gives the user with the ID the user role if they hold the role
+func (s *SCIMService) removeMember(ctx context.Context, role *models.Role, id string) error {
+	membership, err := s.findMember(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if membership.Role != role.Name {
+		return nil
+	}
+	return s.setRole(ctx, membership, models.RoleUser)
+}
+
+// findMember returns the membership of the user with the SCIM ID
+func (s *SCIMService) findMember(ctx context.Context, id string) (*models.Membership, error) {
+	userID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, repository.ErrNotFound
+	}
+	return s.scim.FindUser(ctx, userID)
+}
+
+// setRole changes the role of a member. Active members go through the
+// authorization service, which keeps the organization's last admin.
+func (s *SCIMService) setRole(ctx context.Context, membership *models.Membership, roleName string) error {
+	if membership.Role == roleName {
+		return nil
+	}
+	if membership.Active() {
+		_, err := s.authzService.AssignRole(ctx, membership.UserID, roleName)
+		return err
+	}
+	membership.Role = roleName
+	return s.organizations.UpdateMember(ctx, membership)
+}
+
+// record adds a provisioning event about the member to the audit log
+func (s *SCIMService) record(ctx context.Context, action string, membership *models.Membership) {
+	details := map[string]interface{}{"email": membership.User.Email}
+	if tokenID, ok := middleware.SCIMTokenFromContext(ctx); ok {
+		details["scim_token_id"] = tokenID
+	}
+	s.auditService.Record(ctx, &models.AuditEvent{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   &membership.UserID,
+		Details:    details,
+	})
+}
+
+// parseFilter parses an optional filter
+func parseFilter(filter string) (scim.Filter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+	return scim.ParseFilter(filter)
+}
+
+// eachAttribute calls fn for every attribute of the object a PATCH operation
+// without a path sets
+func eachAttribute(value json.RawMessage, fn func(path *scim.Path, value json.RawMessage) error) error {
+	var attributes map[string]json.RawMessage
+	if err := json.Unmarshal(value, &attributes); err != nil {
+		return fmt.Errorf("%w: value must be an object when there is no path", ErrSCIMInvalidValue)
+	}
+	for name, attribute := range attributes {
+		path, err := scim.ParsePath(name)
+		if err != nil {
+			return err
+		}
+		if err := fn(path, attribute); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attributeKey returns the lowercased attribute a path targets
+func attributeKey(path *scim.Path) string {
+	if path.SubAttribute != "" {
+		return strings.ToLower(path.Attribute + "." + path.SubAttribute)
+	}
+	return strings.ToLower(path.Attribute)
+}
+
+// unmarshalValue decodes a string attribute value
+func unmarshalValue(path *scim.Path, value json.RawMessage, dst *string) error {
+	if err := json.Unmarshal(value, dst); err != nil {
+		return fmt.Errorf("%w: %s must be a string", ErrSCIMInvalidValue, path.Attribute)
+	}
+	return nil
+}
+
+// memberFilterIDs returns the user IDs a member filter such as
+// `value eq "2" or value eq "3"` selects
+func memberFilterIDs(filter scim.Filter) ([]string, error) {
+	switch f := filter.(type) {
+	case *scim.AttributeExpression:
+		id, ok := f.Value.(string)
+		if strings.EqualFold(f.Attribute, "value") && f.Operator == scim.OpEqual && ok {
+			return []string{id}, nil
+		}
+	case *scim.LogicalExpression:
+		if f.Operator == "or" {
+			left, err := memberFilterIDs(f.Left)
+			if err != nil {
+				return nil, err
+			}
+			right, err := memberFilterIDs(f.Right)
+			if err != nil {
+				return nil, err
+			}
+			return append(left, right...), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: members can only be selected by value", scim.ErrInvalidPath)
+}
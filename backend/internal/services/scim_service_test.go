@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/scim"
+	"go.uber.org/zap"
+)
+
+// scimFixture holds the SCIMService under test, the authorization service
+// whose cache it must clear and the repositories behind them
+type scimFixture struct {
+	organizations *repotest.Organizations
+	roles         *repotest.Roles
+	sessions      *repotest.Sessions
+	apiKeys       *repotest.APIKeys
+	revocations   *middleware.MemoryRevocationStore
+	audit         *repotest.Audit
+	authzService  *AuthorizationService
+	service       *SCIMService
+}
+
+// newSCIMFixture returns a SCIMService provisioning the test organization.
+// The member has session 1 and an API key in the test organization and
+// session 2 in another one.
+func newSCIMFixture() *scimFixture {
+	users := newTestUsers()
+	roles, organizations := newTestRoles(users)
+	session := func(id, organizationID int) models.Session {
+		return models.Session{
+			ID:             id,
+			UserID:         testMemberID,
+			OrganizationID: organizationID,
+			FamilyID:       "family-" + strconv.Itoa(id),
+			LastActiveAt:   time.Now(),
+			ExpiresAt:      time.Now().Add(time.Hour),
+		}
+	}
+
+	fixture := &scimFixture{
+		organizations: organizations,
+		roles:         roles,
+		sessions:      repotest.NewSessions(session(1, testOrganizationID), session(2, testOtherOrganizationID)),
+		apiKeys: repotest.NewAPIKeys(models.APIKey{
+			ID:          1,
+			TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID},
+			UserID:      testMemberID,
+			KeyHash:     "hash",
+		}),
+		revocations: middleware.NewMemoryRevocationStore(),
+		audit:       repotest.NewAudit(),
+	}
+
+	logger := zap.NewNop().Sugar()
+	jwtConfig := testJWTConfig()
+	jwtConfig.Revocations = fixture.revocations
+	auditService := NewAuditService(fixture.audit, logger)
+	sessionService := NewSessionService(
+		fixture.sessions, repotest.NewRefreshTokens(), organizations, repotest.Transactor{}, auditService, jwtConfig, logger,
+	)
+	fixture.authzService = NewAuthorizationService(roles, organizations, logger)
+	fixture.service = NewSCIMService(
+		repotest.NewSCIM(organizations, roles), users, organizations, roles, repotest.Transactor{},
+		fixture.authzService, sessionService, NewAPIKeyService(fixture.apiKeys, organizations, logger), auditService, logger,
+	)
+	return fixture
+}
+
+// canRead reports whether the user may read contacts, going through the
+// permission cache of the authorization service
+func (f *scimFixture) canRead(t *testing.T, userID int) bool {
+	t.Helper()
+	allowed, err := f.authzService.HasPermissions(testContext(), strconv.Itoa(userID), models.PermissionContactsRead)
+	if err != nil {
+		t.Fatalf("HasPermissions: %v", err)
+	}
+	return allowed
+}
+
+// revoked reports whether the member's session in the organization, its
+// access tokens and the member's API key were revoked, failing when only
+// some of them were
+func (f *scimFixture) revoked(t *testing.T, sessionID int) bool {
+	t.Helper()
+	ctx := context.Background()
+	session, err := f.sessions.FindByID(ctx, sessionID)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	accessRevoked, err := f.revocations.IsRevoked(ctx, &middleware.JWTClaims{UserId: strconv.Itoa(testMemberID), SessionId: strconv.Itoa(sessionID)})
+	if err != nil {
+		t.Fatalf("IsRevoked: %v", err)
+	}
+	if accessRevoked != (session.RevokedAt != nil) {
+		t.Errorf("session %d revoked = %v, its access tokens = %v", sessionID, session.RevokedAt != nil, accessRevoked)
+	}
+	return session.RevokedAt != nil
+}
+
+// events returns the test organization's audit events with the action
+func (f *scimFixture) events(t *testing.T, action string) []models.AuditEvent {
+	t.Helper()
+	events, _, err := f.audit.List(context.Background(), testOrganizationID, repository.AuditFilter{Action: action}, 0, 100)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return events
+}
+
+// setActive returns a PATCH operation setting active
+func setActive(active bool) []scim.PatchOperation {
+	value, _ := json.Marshal(active)
+	return []scim.PatchOperation{{Op: "replace", Path: "active", Value: value}}
+}
+
+func TestSCIMServiceDeactivation(t *testing.T) {
+	tests := []struct {
+		name        string
+		userID      int
+		deactivate  func(f *scimFixture, userID int) error
+		err         error
+		deactivated bool // whether the member loses access
+		event       string
+	}{
+		{
+			name:   "patch active to false",
+			userID: testMemberID,
+			deactivate: func(f *scimFixture, userID int) error {
+				_, err := f.service.PatchUser(testContext(), userID, setActive(false))
+				return err
+			},
+			deactivated: true,
+			event:       models.AuditUserDeactivated,
+		},
+		{
+			name:   "replace with active false",
+			userID: testMemberID,
+			deactivate: func(f *scimFixture, userID int) error {
+				active := false
+				_, err := f.service.ReplaceUser(testContext(), userID, SCIMUserInput{UserName: "member@example.com", Active: &active})
+				return err
+			},
+			deactivated: true,
+			event:       models.AuditUserDeactivated,
+		},
+		{
+			name:   "delete",
+			userID: testMemberID,
+			deactivate: func(f *scimFixture, userID int) error {
+				return f.service.DeleteUser(testContext(), userID)
+			},
+			deactivated: true,
+			event:       models.AuditUserDeprovisioned,
+		},
+		{
+			name:   "patch leaving active unchanged",
+			userID: testMemberID,
+			deactivate: func(f *scimFixture, userID int) error {
+				_, err := f.service.PatchUser(testContext(), userID, setActive(true))
+				return err
+			},
+		},
+		{
+			name:   "last admin",
+			userID: testAdminID,
+			deactivate: func(f *scimFixture, userID int) error {
+				_, err := f.service.PatchUser(testContext(), userID, setActive(false))
+				return err
+			},
+			err: ErrLastAdmin,
+		},
+		{
+			name:   "last admin deleted",
+			userID: testAdminID,
+			deactivate: func(f *scimFixture, userID int) error {
+				return f.service.DeleteUser(testContext(), userID)
+			},
+			err: ErrLastAdmin,
+		},
+		{
+			name:   "not a member",
+			userID: testOutsider.ID,
+			deactivate: func(f *scimFixture, userID int) error {
+				_, err := f.service.PatchUser(testContext(), userID, setActive(false))
+				return err
+			},
+			err: repository.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSCIMFixture()
+			// fill the permission cache, which deactivation must not leave behind
+			readBefore := f.canRead(t, tt.userID)
+
+			if err := tt.deactivate(f, tt.userID); !errors.Is(err, tt.err) {
+				t.Fatalf("deactivate = %v, want %v", err, tt.err)
+			}
+
+			if got, want := f.canRead(t, tt.userID), readBefore && !tt.deactivated; got != want {
+				t.Errorf("can read contacts = %v, want %v", got, want)
+			}
+			if got := f.revoked(t, 1); got != tt.deactivated {
+				t.Errorf("session in the organization revoked = %v, want %v", got, tt.deactivated)
+			}
+			if f.revoked(t, 2) {
+				t.Error("the session in another organization was revoked")
+			}
+			keys, err := f.apiKeys.ListForUser(testContext(), testMemberID)
+			if err != nil {
+				t.Fatalf("ListForUser: %v", err)
+			}
+			if revoked := len(keys) == 0; revoked != tt.deactivated {
+				t.Errorf("API key revoked = %v, want %v", revoked, tt.deactivated)
+			}
+
+			if tt.event == "" {
+				return
+			}
+			if events := f.events(t, tt.event); len(events) != 1 || *events[0].TargetID != tt.userID {
+				t.Errorf("%s events = %+v, want one for user %d", tt.event, events, tt.userID)
+			}
+		})
+	}
+}
+
+func TestSCIMServiceReactivation(t *testing.T) {
+	tests := []struct {
+		name       string
+		deleteRole bool
+		role       string
+	}{
+		{name: "keeps the previous role", role: "manager"},
+		{name: "falls back to the user role", deleteRole: true, role: models.RoleUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSCIMFixture()
+			if _, err := f.service.PatchUser(testContext(), testManagerID, setActive(false)); err != nil {
+				t.Fatalf("deactivate: %v", err)
+			}
+			if f.canRead(t, testManagerID) {
+				t.Fatal("a deactivated member can read contacts")
+			}
+			if tt.deleteRole {
+				role, err := f.roles.FindByName(testContext(), "manager")
+				if err != nil {
+					t.Fatalf("FindByName: %v", err)
+				}
+				if err := f.roles.Delete(testContext(), role.ID); err != nil {
+					t.Fatalf("Delete: %v", err)
+				}
+			}
+
+			membership, err := f.service.PatchUser(testContext(), testManagerID, setActive(true))
+			if err != nil {
+				t.Fatalf("reactivate: %v", err)
+			}
+			if !membership.Active() || membership.Role != tt.role {
+				t.Errorf("membership = %+v, want an active %s", membership, tt.role)
+			}
+			if !f.canRead(t, testManagerID) {
+				t.Error("a reactivated member cannot read contacts")
+			}
+			if events := f.events(t, models.AuditUserReactivated); len(events) != 1 {
+				t.Errorf("reactivation events = %+v, want one", events)
+			}
+		})
+	}
+}
@@ -0,0 +1,433 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/segment"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrSegmentExists  = errors.New("a segment with this name already exists")
+	ErrInvalidSegment = errors.New("segment not found for this type of record")
+)
+
+// segmentCacheTTL bounds how long the members of a segment are reused before
+// its rules are evaluated again. Changing the segment, or tags in bulk, on
+// this instance clears its cached members immediately.
+const segmentCacheTTL = time.Minute
+
+// The cache holds at most maxCachedSegments segments, and the member IDs of
+// those with at most maxCachedMembers members. Listings by larger segments
+// evaluate their rules in the listing query instead.
+const (
+	maxCachedSegments = 500
+	maxCachedMembers  = 5000
+)
+
+// agePattern is the format of ages in segment rules, such as "12h", "30d" or "2w"
+var agePattern = regexp.MustCompile(`^([0-9]{1,5})([hdw])$`)
+
+var ageUnits = map[string]time.Duration{
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// SegmentInput holds the definition of a segment. The record type of a
+// segment cannot change once it is created.
+type SegmentInput struct {
+	RecordType  string
+	Name        string
+	Description string
+	Rules       string
+}
+
+// SegmentMembers counts the records in a segment when its rules were
+// evaluated
+type SegmentMembers struct {
+	Segment     *models.Segment
+	Count       int64
+	EvaluatedAt time.Time
+}
+
+// evaluatedSegment is a segment with its members when its rules were evaluated
+type evaluatedSegment struct {
+	segment   *models.Segment
+	match     *repository.SegmentMatch
+	count     int64
+	expiresAt time.Time
+}
+
+// SegmentService manages saved segments of contacts, companies and deals and
+// evaluates their members
+type SegmentService struct {
+	segments repository.SegmentRepository
+	fields   repository.CustomFieldRepository
+	logger   *zap.SugaredLogger
+
+	mu     sync.Mutex
+	cache  map[int]map[int]evaluatedSegment // keyed by organization and segment ID
+	cached int                              // the number of segments in the cache
+}
+
+// NewSegmentService creates a new segment service
+func NewSegmentService(segments repository.SegmentRepository, fields repository.CustomFieldRepository, logger *zap.SugaredLogger) *SegmentService {
+	return &SegmentService{
+		segments: segments,
+		fields:   fields,
+		logger:   logger,
+		cache:    make(map[int]map[int]evaluatedSegment),
+	}
+}
+
+// Create saves a segment of the context organization after checking its rules
+func (s *SegmentService) Create(ctx context.Context, input SegmentInput) (*models.Segment, error) {
+	segment := &models.Segment{RecordType: input.RecordType}
+	if err := s.apply(ctx, segment, input); err != nil {
+		return nil, err
+	}
+	if err := s.segments.Create(ctx, segment); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, ErrSegmentExists
+		}
+		return nil, err
+	}
+
+	s.logger.Infow("Segment created", "segment_id", segment.ID, "organization_id", segment.OrganizationID, "record_type", segment.RecordType)
+	return segment, nil
+}
+
+// Get returns a segment of the context organization
+func (s *SegmentService) Get(ctx context.Context, id int) (*models.Segment, error) {
+	return s.segments.FindByID(ctx, id)
+}
+
+// List returns the context organization's segments of a record type, or of
+// every type when recordType is empty
+func (s *SegmentService) List(ctx context.Context, recordType string) ([]models.Segment, error) {
+	return s.segments.List(ctx, recordType)
+}
+
+// Update replaces the name, description and rules of a segment
+func (s *SegmentService) Update(ctx context.Context, id int, input SegmentInput) (*models.Segment, error) {
+	segment, err := s.segments.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(ctx, segment, input); err != nil {
+		return nil, err
+	}
+	if err := s.segments.Update(ctx, segment); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, ErrSegmentExists
+		}
+		return nil, err
+	}
+
+	s.forget(ctx, id)
+	return segment, nil
+}
+
+// Delete removes a segment of the context organization
+func (s *SegmentService) Delete(ctx context.Context, id int) error {
+	if err := s.segments.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.forget(ctx, id)
+	s.logger.Infow("Segment deleted", "segment_id", id)
+	return nil
+}
+
+// Members counts the records of a segment of the context organization,
+// evaluating its rules unless they were evaluated recently
+func (s *SegmentService) Members(ctx context.Context, id int) (*SegmentMembers, error) {
+	evaluated, err := s.evaluate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &SegmentMembers{Segment: evaluated.segment, Count: evaluated.count, EvaluatedAt: evaluated.match.Now}, nil
+}
+
+// match returns the condition restricting a listing of records of the given
+// type, or of any type when recordType is empty, to the members of a segment.
+// Segments that do not exist or hold another type of record fail with
+// ErrInvalidSegment.
+func (s *SegmentService) match(ctx context.Context, id int, recordType string) (*repository.SegmentMatch, error) {
+	evaluated, err := s.evaluate(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidSegment
+		}
+		return nil, err
+	}
+	if recordType != "" && evaluated.segment.RecordType != recordType {
+		return nil, ErrInvalidSegment
+	}
+	match := *evaluated.match
+	return &match, nil
+}
+
+// evaluate returns a segment of the context organization with its members,
+// from the cache when they were evaluated recently
+func (s *SegmentService) evaluate(ctx context.Context, id int) (*evaluatedSegment, error) {
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return nil, repository.ErrMissingTenant
+	}
+
+	s.mu.Lock()
+	entry, ok := s.cache[organizationID][id]
+	s.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return &entry, nil
+	}
+
+	segment, err := s.segments.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	rule, err := s.compile(ctx, segment.RecordType, segment.Rules)
+	if err != nil {
+		return nil, err
+	}
+	match := &repository.SegmentMatch{RecordType: segment.RecordType, Rule: *rule, Now: time.Now().UTC()}
+	ids, err := s.segments.Members(ctx, *match, maxCachedMembers+1)
+	if err != nil {
+		return nil, err
+	}
+	entry = evaluatedSegment{segment: segment, match: match, count: int64(len(ids))}
+	if len(ids) <= maxCachedMembers {
+		match.IDs = ids
+	} else if entry.count, err = s.segments.CountMembers(ctx, *match); err != nil {
+		return nil, err
+	}
+	entry.expiresAt = match.Now.Add(segmentCacheTTL)
+
+	s.store(organizationID, id, entry)
+	return &entry, nil
+}
+
+// store caches an evaluated segment, making room for it by dropping the
+// expired segments, or else the one expiring first
+func (s *SegmentService) store(organizationID, id int, entry evaluatedSegment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.cache[organizationID][id]; !ok && s.cached >= maxCachedSegments {
+		now := time.Now()
+		var oldestOrganization, oldestSegment int
+		var oldest time.Time
+		for cachedOrganization, segments := range s.cache {
+			for cachedSegment, cached := range segments {
+				if !cached.expiresAt.After(now) {
+					s.drop(cachedOrganization, cachedSegment)
+				} else if oldest.IsZero() || cached.expiresAt.Before(oldest) {
+					oldestOrganization, oldestSegment, oldest = cachedOrganization, cachedSegment, cached.expiresAt
+				}
+			}
+		}
+		if s.cached >= maxCachedSegments {
+			s.drop(oldestOrganization, oldestSegment)
+		}
+	}
+
+	if s.cache[organizationID] == nil {
+		s.cache[organizationID] = make(map[int]evaluatedSegment)
+	}
+	if _, ok := s.cache[organizationID][id]; !ok {
+		s.cached++
+	}
+	s.cache[organizationID][id] = entry
+}
+
+// drop removes a segment from the cache. The caller holds the lock.
+func (s *SegmentService) drop(organizationID, id int) {
+	if _, ok := s.cache[organizationID][id]; !ok {
+		return
+	}
+	delete(s.cache[organizationID], id)
+	if len(s.cache[organizationID]) == 0 {
+		delete(s.cache, organizationID)
+	}
+	s.cached--
+}
+
+// forget drops the cached members of a segment of the context organization
+func (s *SegmentService) forget(ctx context.Context, id int) {
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	s.drop(organizationID, id)
+	s.mu.Unlock()
+}
+
+// invalidate drops the cached members of every segment of the context
+// organization
+func (s *SegmentService) invalidate(ctx context.Context) {
+	organizationID, ok := tenant.OrganizationID(ctx)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	s.cached -= len(s.cache[organizationID])
+	delete(s.cache, organizationID)
+	s.mu.Unlock()
+}
+
+// apply copies the input onto the segment after checking its rules
+func (s *SegmentService) apply(ctx context.Context, segment *models.Segment, input SegmentInput) error {
+	rules := strings.TrimSpace(input.Rules)
+	if _, err := s.compile(ctx, segment.RecordType, rules); err != nil {
+		return err
+	}
+	segment.Name = strings.TrimSpace(input.Name)
+	segment.Description = strings.TrimSpace(input.Description)
+	segment.Rules = rules
+	return nil
+}
+
+// compile parses the rules of a segment and checks them against the custom
+// fields of its record type
+func (s *SegmentService) compile(ctx context.Context, recordType, rules string) (*repository.SegmentRule, error) {
+	parsed, err := segment.Parse(rules)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := s.fields.List(ctx, recordType)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*models.CustomField, len(fields))
+	for i := range fields {
+		byKey[fields[i].Key] = &fields[i]
+	}
+
+	rule, err := compileRule(parsed, byKey)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// compileRule checks a parsed rule against the fields segments can compare,
+// converting its values
+func compileRule(rule segment.Rule, fields map[string]*models.CustomField) (repository.SegmentRule, error) {
+	switch r := rule.(type) {
+	case *segment.Logical:
+		left, err := compileRule(r.Left, fields)
+		if err != nil {
+			return repository.SegmentRule{}, err
+		}
+		right, err := compileRule(r.Right, fields)
+		if err != nil {
+			return repository.SegmentRule{}, err
+		}
+		return repository.SegmentRule{Operator: r.Operator, Rules: []repository.SegmentRule{left, right}}, nil
+	case *segment.Not:
+		negated, err := compileRule(r.Rule, fields)
+		if err != nil {
+			return repository.SegmentRule{}, err
+		}
+		return repository.SegmentRule{Operator: "not", Rules: []repository.SegmentRule{negated}}, nil
+	case *segment.Condition:
+		condition, err := compileCondition(r, fields)
+		if err != nil {
+			return repository.SegmentRule{}, err
+		}
+		// "!=" is the negation of "=", which also matches records without a value
+		if r.Operator == segment.OpNotEqual {
+			return repository.SegmentRule{Operator: "not", Rules: []repository.SegmentRule{condition}}, nil
+		}
+		return condition, nil
+	default:
+		return repository.SegmentRule{}, fmt.Errorf("%w: unsupported rule", segment.ErrInvalidRules)
+	}
+}
+
+// compileCondition checks a condition and converts its value. Conditions
+// using "!=" are returned with "=", to be negated.
+func compileCondition(condition *segment.Condition, fields map[string]*models.CustomField) (repository.SegmentRule, error) {
+	invalid := func(format string, args ...interface{}) (repository.SegmentRule, error) {
+		return repository.SegmentRule{}, fmt.Errorf("%w: %s %s", segment.ErrInvalidRules, condition.Field, fmt.Sprintf(format, args...))
+	}
+	equality := condition.Operator == segment.OpEqual || condition.Operator == segment.OpNotEqual
+	rule := repository.SegmentRule{Operator: condition.Operator, Field: condition.Field}
+	if equality {
+		rule.Operator = segment.OpEqual
+	}
+
+	if key, ok := strings.CutPrefix(condition.Field, customFieldPrefix); ok {
+		field, ok := fields[key]
+		if !ok {
+			return invalid("is not a custom field")
+		}
+		ops := map[string]string{
+			segment.OpEqual:          repository.CustomFieldEq,
+			segment.OpNotEqual:       repository.CustomFieldEq,
+			segment.OpGreaterOrEqual: repository.CustomFieldGte,
+			segment.OpLessOrEqual:    repository.CustomFieldLte,
+		}
+		op, ok := ops[condition.Operator]
+		switch {
+		case !ok:
+			return invalid("can only be compared with =, !=, >= or <=")
+		case op != repository.CustomFieldEq && field.Type != models.CustomFieldNumber && field.Type != models.CustomFieldDate:
+			return invalid("can only be compared with = or !=")
+		}
+		value, problem := customFieldCondition(field, op, condition.Value)
+		if problem != "" {
+			return invalid("%s", problem)
+		}
+		rule.Custom = &repository.CustomFieldCondition{Key: field.Key, Type: field.Type, Op: op, Value: value}
+		return rule, nil
+	}
+
+	switch condition.Field {
+	case repository.SegmentTag:
+		if !equality {
+			return invalid("can only be compared with = or !=")
+		}
+		names := normalizeTags([]string{condition.Value})
+		if len(names) == 0 {
+			return invalid("must be compared with a tag")
+		}
+		rule.Value = names[0]
+	case repository.SegmentOwner:
+		if !equality {
+			return invalid("can only be compared with = or !=")
+		}
+		if strings.EqualFold(condition.Value, "none") {
+			return rule, nil
+		}
+		id, err := strconv.Atoi(condition.Value)
+		if err != nil || id < 1 {
+			return invalid("must be compared with a user ID or none")
+		}
+		rule.Value = id
+	case repository.SegmentCreatedAt, repository.SegmentUpdatedAt, repository.SegmentLastActivity:
+		if equality {
+			return invalid("can only be compared with <, <=, > or >=")
+		}
+		match := agePattern.FindStringSubmatch(strings.ToLower(condition.Value))
+		if match == nil {
+			return invalid("must be compared with an age such as 12h, 30d or 2w")
+		}
+		count, _ := strconv.Atoi(match[1])
+		rule.Value = time.Duration(count) * ageUnits[match[2]]
+	default:
+		return repository.SegmentRule{}, fmt.Errorf("%w: unknown field %q", segment.ErrInvalidRules, condition.Field)
+	}
+	return rule, nil
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/segment"
+	"go.uber.org/zap"
+)
+
+func newTestSegmentService(segments *repotest.Segments) *SegmentService {
+	return NewSegmentService(segments, repotest.NewCustomFields(testFields()...), zap.NewNop().Sugar())
+}
+
+// testSegment returns a segment of the test organization
+func testSegment(id int, recordType, name, rules string) models.Segment {
+	return models.Segment{ID: id, OrganizationID: testOrganizationID, RecordType: recordType, Name: name, Rules: rules}
+}
+
+// taggedContact returns a contact of the test organization carrying tags
+func taggedContact(id int, firstName string, tags ...string) models.Contact {
+	contact := testContact(id, firstName)
+	for _, tag := range tags {
+		contact.Tags = append(contact.Tags, models.Tagging{RecordType: models.RecordContact, RecordID: id, Name: tag})
+	}
+	return contact
+}
+
+// contactIDs returns the IDs of contacts
+func contactIDs(contacts []models.Contact) []int {
+	ids := make([]int, len(contacts))
+	for i := range contacts {
+		ids[i] = contacts[i].ID
+	}
+	return ids
+}
+
+func TestSegmentServiceCreate(t *testing.T) {
+	service := newTestSegmentService(repotest.NewSegments(repotest.NewContacts(), nil, nil, nil))
+	ctx := testContext()
+
+	created, err := service.Create(ctx, SegmentInput{
+		RecordType:  models.RecordContact,
+		Name:        " VIPs ",
+		Description: " Key accounts ",
+		Rules:       "  tag = vip and cf.tier = gold ",
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.Name != "VIPs" || created.Description != "Key accounts" || created.Rules != "tag = vip and cf.tier = gold" {
+		t.Errorf("segment = %+v", created)
+	}
+
+	_, err = service.Create(ctx, SegmentInput{RecordType: models.RecordContact, Name: "VIPs", Rules: "tag = vip"})
+	if !errors.Is(err, ErrSegmentExists) {
+		t.Errorf("Create of a taken name = %v, want %v", err, ErrSegmentExists)
+	}
+	if _, err := service.Create(ctx, SegmentInput{RecordType: models.RecordDeal, Name: "VIPs", Rules: "tag = vip"}); err != nil {
+		t.Errorf("Create of the name for deals: %v", err)
+	}
+}
+
+func TestSegmentServiceRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		message string
+	}{
+		{"syntax", "tag = vip and", `expected a field, got "end of rules"`},
+		{"unknown field", "email = ada@example.com", `unknown field "email"`},
+		{"unknown custom field", "cf.mood = happy", "cf.mood is not a custom field"},
+		{"custom field of another record type", "cf.region = north", "cf.region is not a custom field"},
+		{"tag ordering", "tag > vip", "tag can only be compared with = or !="},
+		{"blank tag", `tag = " "`, "tag must be compared with a tag"},
+		{"owner ordering", "owner_id < 3", "owner_id can only be compared with = or !="},
+		{"owner by name", "owner_id = ada", "owner_id must be compared with a user ID or none"},
+		{"age equality", "created_at = 30d", "created_at can only be compared with <, <=, > or >="},
+		{"age in months", "last_activity < 3m", "last_activity must be compared with an age such as 12h, 30d or 2w"},
+		{"age too large", "updated_at > 100000d", "updated_at must be compared with an age such as 12h, 30d or 2w"},
+		{"custom field ordering", "cf.score > 5", "cf.score can only be compared with =, !=, >= or <="},
+		{"range on a select", "cf.tier >= gold", "cf.tier can only be compared with = or !="},
+		{"number", "cf.score >= high", "cf.score must be compared with a number"},
+		{"date", "cf.birthday <= tomorrow", "cf.birthday must be compared with a date formatted as YYYY-MM-DD"},
+		{"boolean", "cf.vip = yes", "cf.vip must be compared with true or false"},
+		{"unknown field in a group", "tag = vip or (not owner_id = none and stage = won)", `unknown field "stage"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments := repotest.NewSegments(repotest.NewContacts(), nil, nil, nil)
+			service := newTestSegmentService(segments)
+			_, err := service.Create(testContext(), SegmentInput{RecordType: models.RecordContact, Name: "Segment", Rules: tt.rules})
+			if !errors.Is(err, segment.ErrInvalidRules) {
+				t.Fatalf("Create = %v, want %v", err, segment.ErrInvalidRules)
+			}
+			if want := segment.ErrInvalidRules.Error() + ": " + tt.message; err.Error() != want {
+				t.Errorf("error = %q, want %q", err, want)
+			}
+			if saved, _ := segments.List(testContext(), ""); len(saved) != 0 {
+				t.Errorf("saved %+v", saved)
+			}
+		})
+	}
+}
+
+func TestSegmentServiceCompilesRules(t *testing.T) {
+	tag := repository.SegmentRule{Operator: "=", Field: repository.SegmentTag, Value: "key account"}
+	not := func(rule repository.SegmentRule) repository.SegmentRule {
+		return repository.SegmentRule{Operator: "not", Rules: []repository.SegmentRule{rule}}
+	}
+
+	tests := []struct {
+		name  string
+		rules string
+		rule  repository.SegmentRule
+	}{
+		{"tag names are normalized", `TAG = " Key Account "`, tag},
+		{"!= negates =", `tag != "key account"`, not(tag)},
+		{"owner", "owner_id = 4", repository.SegmentRule{Operator: "=", Field: repository.SegmentOwner, Value: 4}},
+		{"no owner", "owner_id = NONE", repository.SegmentRule{Operator: "=", Field: repository.SegmentOwner}},
+		{"ages", "last_activity < 2w", repository.SegmentRule{Operator: "<", Field: repository.SegmentLastActivity, Value: 14 * 24 * time.Hour}},
+		{"ages in hours", "created_at >= 12H", repository.SegmentRule{Operator: ">=", Field: repository.SegmentCreatedAt, Value: 12 * time.Hour}},
+		{"custom number", "cf.score >= 7.5", repository.SegmentRule{Operator: ">=", Field: "cf.score", Custom: &repository.CustomFieldCondition{
+			Key: "score", Type: models.CustomFieldNumber, Op: repository.CustomFieldGte, Value: 7.5,
+		}}},
+		{"custom date", "cf.birthday <= 2000-01-31", repository.SegmentRule{Operator: "<=", Field: "cf.birthday", Custom: &repository.CustomFieldCondition{
+			Key: "birthday", Type: models.CustomFieldDate, Op: repository.CustomFieldLte, Value: "2000-01-31",
+		}}},
+		{"custom != negates =", "cf.vip != true", not(repository.SegmentRule{Operator: "=", Field: "cf.vip", Custom: &repository.CustomFieldCondition{
+			Key: "vip", Type: models.CustomFieldBoolean, Op: repository.CustomFieldEq, Value: true,
+		}})},
+		{"logical rules", `not tag = "key account" or owner_id = 4 and created_at > 1d`, repository.SegmentRule{Operator: "or", Rules: []repository.SegmentRule{
+			not(tag),
+			{Operator: "and", Rules: []repository.SegmentRule{
+				{Operator: "=", Field: repository.SegmentOwner, Value: 4},
+				{Operator: ">", Field: repository.SegmentCreatedAt, Value: 24 * time.Hour},
+			}},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments := repotest.NewSegments(repotest.NewContacts(), nil, nil, nil,
+				testSegment(1, models.RecordContact, "Segment", tt.rules))
+			service := newTestSegmentService(segments)
+
+			before := time.Now()
+			match, err := service.match(testContext(), 1, models.RecordContact)
+			if err != nil {
+				t.Fatalf("match: %v", err)
+			}
+			if match.RecordType != models.RecordContact || !reflect.DeepEqual(match.Rule, tt.rule) {
+				t.Errorf("matched %+v, want the contacts matching %+v", match, tt.rule)
+			}
+			if match.Now.Before(before.Add(-time.Second)) {
+				t.Errorf("evaluated at %v, want now", match.Now)
+			}
+		})
+	}
+}
+
+func TestSegmentServiceFiltersListings(t *testing.T) {
+	contacts := repotest.NewContacts(
+		taggedContact(1, "Ada", "vip"),
+		taggedContact(2, "Grace", "gold"),
+		taggedContact(3, "Linus", "vip", "gold"),
+	)
+	companies := repotest.NewCompanies(contacts, testCompany(1, "Acme"), testCompany(2, "Globex"))
+	segments := repotest.NewSegments(contacts, companies, nil, nil,
+		testSegment(1, models.RecordContact, "VIPs", "tag = vip"),
+		testSegment(2, models.RecordCompany, "Partners", "tag = partner"),
+	)
+	segmentService := newTestSegmentService(segments)
+	_, organizations := newTestRoles(newTestUsers())
+	contactService := NewContactService(contacts, organizations, repotest.NewCustomFields(), segmentService, zap.NewNop().Sugar())
+	about := func(task models.Task, recordType string, recordID int) models.Task {
+		task.RecordType, task.RecordID = recordType, &recordID
+		return task
+	}
+	tasks := repotest.NewTasks(nil,
+		about(testTask(1, "Call Acme"), models.RecordCompany, 1),
+		about(testTask(2, "Call Globex"), models.RecordCompany, 2),
+		about(testTask(3, "Call Grace"), models.RecordContact, 2),
+	)
+	taskService := NewTaskService(tasks, contacts, companies, repotest.NewDeals(companies), organizations, segmentService, zap.NewNop().Sugar())
+	tags := NewTagService(repotest.NewTags(contacts, companies, nil), contacts, companies, repotest.NewDeals(companies),
+		segmentService, repotest.Transactor{}, zap.NewNop().Sugar())
+	ctx := testContext()
+
+	listed, total, err := contactService.List(ctx, repository.ContactFilter{Segment: 1}, 1, 20)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if ids := contactIDs(listed); total != 2 || !equalIDs(ids, []int{3, 1}) {
+		t.Errorf("listed %v of %d contacts, want [3 1] of 2", ids, total)
+	}
+
+	// changes to the rules apply to the next listing
+	if _, err := segmentService.Update(ctx, 1, SegmentInput{Name: "VIPs", Rules: "tag = gold"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if listed, _, _ := contactService.List(ctx, repository.ContactFilter{Segment: 1}, 1, 20); !equalIDs(contactIDs(listed), []int{3, 2}) {
+		t.Errorf("listed %v, want the gold contacts [3 2]", contactIDs(listed))
+	}
+
+	// tasks take the record type of the segment, and bulk tagging changes
+	// its members
+	if _, err := tags.Change(ctx, models.RecordCompany, []int{2}, []string{"partner"}, nil); err != nil {
+		t.Fatalf("Change: %v", err)
+	}
+	found, _, err := taskService.List(ctx, repository.TaskFilter{Segment: 2}, 1, 20)
+	if err != nil {
+		t.Fatalf("List of tasks: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != 2 {
+		t.Errorf("listed tasks %+v, want the task about Globex", found)
+	}
+
+	for _, filter := range []repository.ContactFilter{{Segment: 2}, {Segment: 9}} {
+		if _, _, err := contactService.List(ctx, filter, 1, 20); !errors.Is(err, ErrInvalidSegment) {
+			t.Errorf("List of segment %d = %v, want %v", filter.Segment, err, ErrInvalidSegment)
+		}
+	}
+	if _, _, err := taskService.List(ctx, repository.TaskFilter{Segment: 2, RecordType: models.RecordDeal}, 1, 20); !errors.Is(err, ErrInvalidSegment) {
+		t.Errorf("List of deal tasks in a company segment = %v, want %v", err, ErrInvalidSegment)
+	}
+	if _, err := segmentService.Members(ctx, 9); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Members of a missing segment = %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func TestSegmentServiceCachesMembers(t *testing.T) {
+	contacts := repotest.NewContacts(taggedContact(1, "Ada", "vip"), taggedContact(2, "Grace"))
+	segments := repotest.NewSegments(contacts, nil, nil, nil, testSegment(1, models.RecordContact, "VIPs", "tag = vip"))
+	service := newTestSegmentService(segments)
+	ctx := testContext()
+
+	members, err := service.Members(ctx, 1)
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	if members.Count != 1 {
+		t.Errorf("count = %d, want 1", members.Count)
+	}
+
+	// tagging a single record leaves the cached members until they expire
+	grace, _ := contacts.FindByID(ctx, 2)
+	grace.Tags = []models.Tagging{{RecordType: models.RecordContact, RecordID: 2, Name: "vip"}}
+	if err := contacts.Update(ctx, grace); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	cached, err := service.Members(ctx, 1)
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	if cached.Count != 1 || !cached.EvaluatedAt.Equal(members.EvaluatedAt) {
+		t.Errorf("members = %+v, want the cached members %+v", cached, members)
+	}
+
+	// other organizations evaluate their own segments
+	other := tenant.WithOrganization(context.Background(), testOtherOrganizationID)
+	if _, err := service.Members(other, 1); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Members in another organization = %v, want %v", err, repository.ErrNotFound)
+	}
+
+	service.invalidate(ctx)
+	if members, _ := service.Members(ctx, 1); members == nil || members.Count != 2 {
+		t.Errorf("members = %+v after invalidation, want 2", members)
+	}
+}
+
+func TestSegmentServiceEvaluatesLargeSegmentsInListings(t *testing.T) {
+	contacts := repotest.NewContacts()
+	ctx := testContext()
+	for i := 0; i <= maxCachedMembers; i++ {
+		contact := taggedContact(0, "Ada", "vip")
+		if err := contacts.Create(ctx, &contact); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	segments := repotest.NewSegments(contacts, nil, nil, nil, testSegment(1, models.RecordContact, "VIPs", "tag = vip"))
+	service := newTestSegmentService(segments)
+	_, organizations := newTestRoles(newTestUsers())
+	contactService := NewContactService(contacts, organizations, repotest.NewCustomFields(), service, zap.NewNop().Sugar())
+
+	members, err := service.Members(ctx, 1)
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	if members.Count != maxCachedMembers+1 {
+		t.Errorf("count = %d, want %d", members.Count, maxCachedMembers+1)
+	}
+
+	// the listing evaluates the rules itself, seeing every change
+	first, _ := contacts.FindByID(ctx, 1)
+	first.Tags = nil
+	if err := contacts.Update(ctx, first); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, total, err := contactService.List(ctx, repository.ContactFilter{Segment: 1}, 1, 20); err != nil || total != maxCachedMembers {
+		t.Errorf("List = %d contacts, %v, want %d", total, err, maxCachedMembers)
+	}
+}
+
+func TestSegmentServiceBoundsTheCache(t *testing.T) {
+	segments := repotest.NewSegments(repotest.NewContacts(), nil, nil, nil)
+	service := newTestSegmentService(segments)
+	ctx := testContext()
+	for i := 0; i <= maxCachedSegments; i++ {
+		segment, err := service.Create(ctx, SegmentInput{RecordType: models.RecordContact, Name: fmt.Sprint("Segment ", i), Rules: "tag = vip"})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := service.Members(ctx, segment.ID); err != nil {
+			t.Fatalf("Members: %v", err)
+		}
+	}
+
+	cached := 0
+	for _, entries := range service.cache {
+		cached += len(entries)
+	}
+	if cached != maxCachedSegments || service.cached != maxCachedSegments {
+		t.Errorf("cached %d segments, counted %d, want %d", cached, service.cached, maxCachedSegments)
+	}
+}
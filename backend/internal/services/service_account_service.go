@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// serviceAccountEmailDomain is used for the addresses of service account
+// users. The .invalid top-level domain can never receive email.
+const serviceAccountEmailDomain = "service-accounts.invalid"
+
+// ServiceAccountInput holds the data required to create a service account
+type ServiceAccountInput struct {
+	Name        string
+	Description string
+	Role        string
+}
+
+// ServiceAccountDetails is a service account with its role in the organization
+type ServiceAccountDetails struct {
+	Account *models.ServiceAccount
+	Role    string
+}
+
+// ServiceAccountService manages the service accounts of an organization and their API keys
+type ServiceAccountService struct {
+	serviceAccounts repository.ServiceAccountRepository
+	users           repository.UserRepository
+	organizations   repository.OrganizationRepository
+	roles           repository.RoleRepository
+	transactor      repository.Transactor
+	apiKeyService   *APIKeyService
+	authz           *AuthorizationService
+	logger          *zap.SugaredLogger
+}
+
+// NewServiceAccountService creates a new service account service
+func NewServiceAccountService(
+	serviceAccounts repository.ServiceAccountRepository,
+	users repository.UserRepository,
+	organizations repository.OrganizationRepository,
+	roles repository.RoleRepository,
+	transactor repository.Transactor,
+	apiKeyService *APIKeyService,
+	authz *AuthorizationService,
+	logger *zap.SugaredLogger,
+) *ServiceAccountService {
+	return &ServiceAccountService{
+		serviceAccounts: serviceAccounts,
+		users:           users,
+		organizations:   organizations,
+		roles:           roles,
+		transactor:      transactor,
+		apiKeyService:   apiKeyService,
+		authz:           authz,
+		logger:          logger,
+	}
+}
+
+// Create adds a service account to the context organization with the given
+// role. As with invitations, the creator must hold every permission of the role.
+func (s *ServiceAccountService) Create(ctx context.Context, creatorID int, input ServiceAccountInput) (*ServiceAccountDetails, error) {
+	role, err := s.roles.FindByName(ctx, strings.TrimSpace(input.Role))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUnknownRole
+		}
+		return nil, err
+	}
+	if err := s.authz.CheckGrantable(ctx, strconv.Itoa(creatorID), role.Permissions); err != nil {
+		return nil, err
+	}
+
+	handle, err := utils.RandomToken(8)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &models.ServiceAccount{
+		Name:        strings.TrimSpace(input.Name),
+		Description: strings.TrimSpace(input.Description),
+		CreatedByID: creatorID,
+	}
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		user := &models.User{
+			Email:          "sa-" + handle + "@" + serviceAccountEmailDomain,
+			ServiceAccount: true,
+		}
+		if err := s.users.Create(ctx, user); err != nil {
+			return err
+		}
+		if err := s.organizations.AddMember(ctx, &models.Membership{UserID: user.ID, Role: role.Name}); err != nil {
+			return err
+		}
+
+		account.UserID = user.ID
+		return s.serviceAccounts.Create(ctx, account)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("Service account created",
+		"service_account_id", account.ID,
+		"organization_id", account.OrganizationID,
+		"created_by", creatorID,
+	)
+	return s.Get(ctx, account.ID)
+}
+
+// List returns the service accounts of the context organization
+func (s *ServiceAccountService) List(ctx context.Context) ([]ServiceAccountDetails, error) {
+	accounts, err := s.serviceAccounts.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	details := make([]ServiceAccountDetails, len(accounts))
+	for i := range accounts {
+		membership, err := s.organizations.FindMember(ctx, accounts[i].UserID)
+		if err != nil {
+			return nil, err
+		}
+		details[i] = ServiceAccountDetails{Account: &accounts[i], Role: membership.Role}
+	}
+	return details, nil
+}
+
+// Get returns a service account of the context organization
+func (s *ServiceAccountService) Get(ctx context.Context, id int) (*ServiceAccountDetails, error) {
+	account, err := s.serviceAccounts.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	membership, err := s.organizations.FindMember(ctx, account.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceAccountDetails{Account: account, Role: membership.Role}, nil
+}
+
+// Delete removes a service account from the context organization and revokes its keys
+func (s *ServiceAccountService) Delete(ctx context.Context, id int) error {
+	account, err := s.serviceAccounts.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.apiKeyService.RevokeAllForUser(ctx, account.UserID); err != nil {
+			return err
+		}
+		if err := s.organizations.RemoveMember(ctx, account.UserID); err != nil {
+			return err
+		}
+		return s.serviceAccounts.Delete(ctx, id)
+	})
+	if err != nil {
+		return err
+	}
+	s.authz.invalidate()
+
+	s.logger.Infow("Service account deleted", "service_account_id", id, "organization_id", account.OrganizationID)
+	return nil
+}
+
+// ListKeys returns the unrevoked API keys of a service account
+func (s *ServiceAccountService) ListKeys(ctx context.Context, id int) ([]models.APIKey, error) {
+	account, err := s.serviceAccounts.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.apiKeyService.List(ctx, account.UserID)
+}
+
+// CreateKey issues an API key acting as the service account
+func (s *ServiceAccountService) CreateKey(ctx context.Context, id, creatorID int, input APIKeyInput) (*CreatedAPIKey, error) {
+	account, err := s.serviceAccounts.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.apiKeyService.Create(ctx, account.UserID, creatorID, input)
+}
+
+// RevokeKey revokes an API key of the service account
+func (s *ServiceAccountService) RevokeKey(ctx context.Context, id, keyID int) error {
+	account, err := s.serviceAccounts.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.apiKeyService.Revoke(ctx, account.UserID, keyID)
+}
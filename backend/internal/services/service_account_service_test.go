@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+// serviceAccountFixture holds the ServiceAccountService under test and its repositories
+type serviceAccountFixture struct {
+	users           *repotest.Users
+	organizations   *repotest.Organizations
+	serviceAccounts *repotest.ServiceAccounts
+	authz           *AuthorizationService
+	apiKeys         *APIKeyService
+	service         *ServiceAccountService
+}
+
+func newServiceAccountFixture() *serviceAccountFixture {
+	logger := zap.NewNop().Sugar()
+	users := newTestUsers()
+	roles, organizations := newTestRoles(users)
+	fixture := &serviceAccountFixture{
+		users:           users,
+		organizations:   organizations,
+		serviceAccounts: repotest.NewServiceAccounts(users),
+		authz:           NewAuthorizationService(roles, organizations, logger),
+		apiKeys:         NewAPIKeyService(repotest.NewAPIKeys(), organizations, logger),
+	}
+	fixture.service = NewServiceAccountService(
+		fixture.serviceAccounts, users, organizations, roles, repotest.Transactor{},
+		fixture.apiKeys, fixture.authz, logger,
+	)
+	return fixture
+}
+
+func TestServiceAccountServiceCreateWithinOwnPermissions(t *testing.T) {
+	tests := []struct {
+		name    string
+		creator int
+		role    string
+		err     error
+	}{
+		{"manager creates a user", testManagerID, models.RoleUser, nil},
+		{"manager creates a manager", testManagerID, "manager", nil},
+		{"manager creates an admin", testManagerID, models.RoleAdmin, ErrPermissionNotHeld},
+		{"admin creates an admin", testAdminID, models.RoleAdmin, nil},
+		{"unknown role", testAdminID, "owner", ErrUnknownRole},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := newServiceAccountFixture()
+
+			details, err := fixture.service.Create(testContext(), tt.creator, ServiceAccountInput{Name: " Zapier ", Role: tt.role})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Create = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if accounts, _ := fixture.serviceAccounts.List(testContext()); len(accounts) != 0 {
+					t.Errorf("created %d service accounts", len(accounts))
+				}
+				return
+			}
+
+			if details.Account.Name != "Zapier" || details.Role != tt.role || details.Account.OrganizationID != testOrganizationID {
+				t.Errorf("service account = %+v with role %q", details.Account, details.Role)
+			}
+			if details.Account.User == nil || !details.Account.User.ServiceAccount {
+				t.Errorf("user = %+v, want a service account user", details.Account.User)
+			}
+		})
+	}
+}
+
+func TestServiceAccountServiceDeleteRevokesAccess(t *testing.T) {
+	fixture := newServiceAccountFixture()
+
+	details, err := fixture.service.Create(testContext(), testAdminID, ServiceAccountInput{Name: "Zapier", Role: models.RoleUser})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	key, err := fixture.service.CreateKey(testContext(), details.Account.ID, testAdminID, APIKeyInput{
+		Name:   "zap",
+		Scopes: []string{models.PermissionContactsRead},
+	})
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	userID := strconv.Itoa(details.Account.UserID)
+	if ok, err := fixture.authz.HasPermissions(testContext(), userID, models.PermissionContactsRead); err != nil || !ok {
+		t.Fatalf("HasPermissions before Delete = %v, %v", ok, err)
+	}
+
+	if err := fixture.service.Delete(testContext(), details.Account.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := fixture.apiKeys.AuthenticateAPIKey(testContext(), key.Secret); !errors.Is(err, middleware.ErrInvalidAPIKey) {
+		t.Errorf("AuthenticateAPIKey after Delete = %v, want %v", err, middleware.ErrInvalidAPIKey)
+	}
+	if _, err := fixture.organizations.FindMember(testContext(), details.Account.UserID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("FindMember after Delete = %v, want %v", err, repository.ErrNotFound)
+	}
+	if ok, err := fixture.authz.HasPermissions(testContext(), userID, models.PermissionContactsRead); err != nil || ok {
+		t.Errorf("HasPermissions after Delete = %v, %v, want false", ok, err)
+	}
+	if _, err := fixture.service.Get(testContext(), details.Account.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want %v", err, repository.ErrNotFound)
+	}
+}
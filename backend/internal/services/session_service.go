@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"go.uber.org/zap"
+)
+
+// SessionService keeps track of where users are signed in and ends sessions
+// on request. A session lives as long as its refresh token family.
+type SessionService struct {
+	sessions      repository.SessionRepository
+	refreshTokens repository.RefreshTokenRepository
+	organizations repository.OrganizationRepository
+	transactor    repository.Transactor
+	auditService  *AuditService
+	jwtConfig     middleware.JWTConfig
+	logger        *zap.SugaredLogger
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(
+	sessions repository.SessionRepository,
+	refreshTokens repository.RefreshTokenRepository,
+	organizations repository.OrganizationRepository,
+	transactor repository.Transactor,
+	auditService *AuditService,
+	jwtConfig middleware.JWTConfig,
+	logger *zap.SugaredLogger,
+) *SessionService {
+	return &SessionService{
+		sessions:      sessions,
+		refreshTokens: refreshTokens,
+		organizations: organizations,
+		transactor:    transactor,
+		auditService:  auditService,
+		jwtConfig:     jwtConfig,
+		logger:        logger,
+	}
+}
+
+// List returns the user's active sessions in every organization
+func (s *SessionService) List(ctx context.Context, userID int) ([]models.Session, error) {
+	return s.sessions.ListActive(ctx, repository.SessionFilter{UserID: userID})
+}
+
+// Revoke signs the user out of one of their sessions
+func (s *SessionService) Revoke(ctx context.Context, userID, sessionID int) error {
+	session, err := s.sessions.FindByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return repository.ErrNotFound
+	}
+
+	if err := s.end(ctx, session); err != nil {
+		return err
+	}
+	s.record(ctx, userID, session)
+	return nil
+}
+
+// ListForMember returns the active sessions of a member of the context
+// organization in that organization
+func (s *SessionService) ListForMember(ctx context.Context, userID int) ([]models.Session, error) {
+	membership, err := s.organizations.FindMember(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.sessions.ListActive(ctx, repository.SessionFilter{
+		UserID:         userID,
+		OrganizationID: membership.OrganizationID,
+	})
+}
+
+// RevokeForMember signs a member of the context organization out of one of
+// their sessions in that organization
+func (s *SessionService) RevokeForMember(ctx context.Context, actorID, userID, sessionID int) error {
+	membership, err := s.organizations.FindMember(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.sessions.FindByID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID || session.OrganizationID != membership.OrganizationID {
+		return repository.ErrNotFound
+	}
+
+	if err := s.end(ctx, session); err != nil {
+		return err
+	}
+	s.logger.Infow("Session revoked by admin", "user_id", userID, "session_id", session.ID, "admin_id", actorID)
+	s.record(ctx, actorID, session)
+	return nil
+}
+
+// start records a new session for a refresh token family issued to the
+// client of the request
+func (s *SessionService) start(ctx context.Context, userID, organizationID int, familyID string, expiresAt time.Time) (*models.Session, error) {
+	client := middleware.ClientFromContext(ctx)
+	now := time.Now()
+	session := &models.Session{
+		UserID:         userID,
+		OrganizationID: organizationID,
+		FamilyID:       familyID,
+		UserAgent:      client.UserAgent,
+		IPAddress:      client.IP,
+		LastActiveAt:   now,
+		ExpiresAt:      expiresAt,
+	}
+	if err := s.sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// touch records activity on the session of a refresh token family when it is
+// refreshed. Families from before sessions were tracked get one.
+func (s *SessionService) touch(ctx context.Context, userID, organizationID int, familyID string, expiresAt time.Time) (*models.Session, error) {
+	session, err := s.sessions.FindByFamily(ctx, familyID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return s.start(ctx, userID, organizationID, familyID, expiresAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := middleware.ClientFromContext(ctx)
+	session.UserAgent = client.UserAgent
+	session.IPAddress = client.IP
+	session.LastActiveAt = time.Now()
+	session.ExpiresAt = expiresAt
+	if err := s.sessions.Update(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// endFamily ends the session of a refresh token family
+func (s *SessionService) endFamily(ctx context.Context, familyID string) error {
+	session, err := s.sessions.FindByFamily(ctx, familyID)
+	if errors.Is(err, repository.ErrNotFound) {
+		// families from before sessions were tracked only have tokens
+		return s.refreshTokens.RevokeFamily(ctx, familyID)
+	}
+	if err != nil {
+		return err
+	}
+	return s.end(ctx, session)
+}
+
+// endAllForUser ends every session of the user in every organization and
+// revokes the access tokens issued to them
+func (s *SessionService) endAllForUser(ctx context.Context, userID int) error {
+	sessions, err := s.sessions.ListActive(ctx, repository.SessionFilter{UserID: userID})
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		if err := s.end(ctx, &sessions[i]); err != nil {
+			return err
+		}
+	}
+	// families from before sessions were tracked only have tokens
+	return s.refreshTokens.RevokeAllForUser(ctx, userID)
+}
+
+// endAllForMember ends every session of the user in the organization and
+// revokes the access tokens issued to them
+func (s *SessionService) endAllForMember(ctx context.Context, userID, organizationID int) error {
+	sessions, err := s.sessions.ListActive(ctx, repository.SessionFilter{
+		UserID:         userID,
+		OrganizationID: organizationID,
+	})
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		if err := s.end(ctx, &sessions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// end revokes the session, its refresh token family and the access tokens
+// issued to it
+func (s *SessionService) end(ctx context.Context, session *models.Session) error {
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.refreshTokens.RevokeFamily(ctx, session.FamilyID); err != nil {
+			return err
+		}
+		return s.sessions.Revoke(ctx, session.ID)
+	})
+	if err != nil || s.jwtConfig.Revocations == nil {
+		return err
+	}
+
+	// access tokens of the session expire at the latest one lifetime from now
+	expiresAt := time.Now().Add(s.jwtConfig.TokenExpiration + s.jwtConfig.Leeway)
+	return s.jwtConfig.Revocations.RevokeSession(ctx, strconv.Itoa(session.ID), expiresAt)
+}
+
+// record adds the revocation of a session to the audit log of its organization
+func (s *SessionService) record(ctx context.Context, actorID int, session *models.Session) {
+	s.auditService.Record(ctx, &models.AuditEvent{
+		OrganizationID: &session.OrganizationID,
+		ActorID:        &actorID,
+		Action:         models.AuditSessionRevoked,
+		TargetType:     "user",
+		TargetID:       &session.UserID,
+		Details: map[string]interface{}{
+			"session_id": session.ID,
+			"ip_address": session.IPAddress,
+			"user_agent": session.UserAgent,
+		},
+	})
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/middleware"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+// testOtherOrganizationID is another organization the test member belongs to
+const testOtherOrganizationID = 4
+
+// sessionFixture holds the SessionService under test, its repositories and
+// the store its access tokens are revoked in
+type sessionFixture struct {
+	sessions      *repotest.Sessions
+	refreshTokens *repotest.RefreshTokens
+	revocations   *middleware.MemoryRevocationStore
+	service       *SessionService
+}
+
+// newSessionFixture returns a SessionService for the members of the test
+// organization. The member has sessions 1 and 2 in the test organization and
+// 3 in another one, session 4 belongs to the admin, and family "legacy" has
+// refresh tokens from before sessions were tracked.
+func newSessionFixture() *sessionFixture {
+	users := newTestUsers()
+	_, organizations := newTestRoles(users)
+	session := func(id, userID, organizationID int) models.Session {
+		return models.Session{
+			ID:             id,
+			UserID:         userID,
+			OrganizationID: organizationID,
+			FamilyID:       "family-" + strconv.Itoa(id),
+			LastActiveAt:   time.Now(),
+			ExpiresAt:      time.Now().Add(time.Hour),
+		}
+	}
+	token := func(userID int, familyID string) models.RefreshToken {
+		return models.RefreshToken{
+			ID:             "token-" + familyID,
+			UserID:         userID,
+			FamilyID:       familyID,
+			OrganizationID: testOrganizationID,
+			ExpiresAt:      time.Now().Add(time.Hour),
+		}
+	}
+
+	fixture := &sessionFixture{
+		sessions: repotest.NewSessions(
+			session(1, testMemberID, testOrganizationID),
+			session(2, testMemberID, testOrganizationID),
+			session(3, testMemberID, testOtherOrganizationID),
+			session(4, testAdminID, testOrganizationID),
+		),
+		refreshTokens: repotest.NewRefreshTokens(
+			token(testMemberID, "family-1"),
+			token(testMemberID, "family-2"),
+			token(testMemberID, "family-3"),
+			token(testAdminID, "family-4"),
+			token(testMemberID, "legacy"),
+		),
+		revocations: middleware.NewMemoryRevocationStore(),
+	}
+
+	logger := zap.NewNop().Sugar()
+	jwtConfig := testJWTConfig()
+	jwtConfig.Revocations = fixture.revocations
+	fixture.service = NewSessionService(
+		fixture.sessions, fixture.refreshTokens, organizations, repotest.Transactor{},
+		NewAuditService(repotest.NewAudit(), logger), jwtConfig, logger,
+	)
+	return fixture
+}
+
+// ended returns the IDs of the sessions that were revoked together with
+// their refresh tokens and access tokens, failing on sessions revoked only
+// in part
+func (f *sessionFixture) ended(t *testing.T) []int {
+	t.Helper()
+	ctx := context.Background()
+	var ended []int
+	for id := 1; id <= 4; id++ {
+		session, err := f.sessions.FindByID(ctx, id)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		token, err := f.refreshTokens.FindByID(ctx, "token-"+session.FamilyID)
+		if err != nil {
+			t.Fatalf("FindByID: %v", err)
+		}
+		accessRevoked, err := f.revocations.IsRevoked(ctx, &middleware.JWTClaims{UserId: strconv.Itoa(session.UserID), SessionId: strconv.Itoa(id)})
+		if err != nil {
+			t.Fatalf("IsRevoked: %v", err)
+		}
+
+		revoked := session.RevokedAt != nil
+		if token.RevokedAt != nil != revoked || accessRevoked != revoked {
+			t.Errorf("session %d revoked = %v, its refresh token = %v, its access tokens = %v",
+				id, revoked, token.RevokedAt != nil, accessRevoked)
+		}
+		if revoked {
+			ended = append(ended, id)
+		}
+	}
+	return ended
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSessionServiceRevoke(t *testing.T) {
+	tests := []struct {
+		name      string
+		userID    int
+		sessionID int
+		err       error
+		ended     []int
+	}{
+		{name: "own session", userID: testMemberID, sessionID: 2, ended: []int{2}},
+		{name: "own session in another organization", userID: testMemberID, sessionID: 3, ended: []int{3}},
+		{name: "session of another user", userID: testMemberID, sessionID: 4, err: repository.ErrNotFound},
+		{name: "unknown session", userID: testMemberID, sessionID: 9, err: repository.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSessionFixture()
+			if err := f.service.Revoke(context.Background(), tt.userID, tt.sessionID); !errors.Is(err, tt.err) {
+				t.Fatalf("Revoke = %v, want %v", err, tt.err)
+			}
+			if ended := f.ended(t); !equalIDs(ended, tt.ended) {
+				t.Errorf("ended sessions %v, want %v", ended, tt.ended)
+			}
+		})
+	}
+}
+
+func TestSessionServiceRevokeForMember(t *testing.T) {
+	tests := []struct {
+		name      string
+		userID    int
+		sessionID int
+		err       error
+		ended     []int
+	}{
+		{name: "session of the member", userID: testMemberID, sessionID: 1, ended: []int{1}},
+		{name: "session in another organization", userID: testMemberID, sessionID: 3, err: repository.ErrNotFound},
+		{name: "session of another member", userID: testMemberID, sessionID: 4, err: repository.ErrNotFound},
+		{name: "not a member", userID: testOutsider.ID, sessionID: 1, err: repository.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSessionFixture()
+			if err := f.service.RevokeForMember(testContext(), testAdminID, tt.userID, tt.sessionID); !errors.Is(err, tt.err) {
+				t.Fatalf("RevokeForMember = %v, want %v", err, tt.err)
+			}
+			if ended := f.ended(t); !equalIDs(ended, tt.ended) {
+				t.Errorf("ended sessions %v, want %v", ended, tt.ended)
+			}
+		})
+	}
+}
+
+func TestSessionServiceEndAllForUser(t *testing.T) {
+	f := newSessionFixture()
+	if err := f.service.endAllForUser(context.Background(), testMemberID); err != nil {
+		t.Fatalf("endAllForUser: %v", err)
+	}
+
+	if ended, want := f.ended(t), []int{1, 2, 3}; !equalIDs(ended, want) {
+		t.Errorf("ended sessions %v, want %v", ended, want)
+	}
+	legacy, err := f.refreshTokens.FindByID(context.Background(), "token-legacy")
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if legacy.RevokedAt == nil {
+		t.Error("the refresh token of a family without a session was not revoked")
+	}
+}
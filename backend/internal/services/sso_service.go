@@ -0,0 +1,382 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/tenant"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/oidc"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownSSOProvider  = errors.New("unknown single sign-on provider")
+	ErrInvalidSSOState     = errors.New("invalid or expired single sign-on state")
+	ErrSSOFailed           = errors.New("single sign-on failed")
+	ErrSSONotAuthorized    = errors.New("your identity provider account is not allowed to sign in")
+	ErrSSOAccountNotLinked = errors.New("an account with this email already exists and the identity provider has not verified the address")
+)
+
+// ssoAttemptTTL bounds how long the user has to sign in at the provider
+const ssoAttemptTTL = 10 * time.Minute
+
+// SSOGroupRole maps an identity provider group to a CRM role
+type SSOGroupRole struct {
+	Group string
+	Role  string
+}
+
+// SSOProvider is an OpenID provider users can sign in with. Users are
+// provisioned into Organization with the role of the first group mapping
+// they match, or DefaultRole. Users matching none cannot sign in when
+// DefaultRole is empty. When AllowedDomains is set, only users with a
+// verified email in one of the domains can sign in.
+type SSOProvider struct {
+	Name           string
+	Client         *oidc.Provider
+	GroupsClaim    string
+	GroupRoles     []SSOGroupRole
+	DefaultRole    string
+	Organization   string // organization slug
+	AllowedDomains []string
+}
+
+// allows reports whether a user with the email may sign in through the provider
+func (p *SSOProvider) allows(email string, verified bool) bool {
+	if len(p.AllowedDomains) == 0 {
+		return true
+	}
+	// an unverified address could name any domain
+	_, domain, ok := strings.Cut(normalizeEmail(email), "@")
+	if !verified || !ok {
+		return false
+	}
+	for _, allowed := range p.AllowedDomains {
+		if strings.EqualFold(domain, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// role returns the CRM role for a user in the given groups, or "" when the
+// user may not sign in
+func (p *SSOProvider) role(groups []string) string {
+	member := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		member[group] = true
+	}
+	for _, mapping := range p.GroupRoles {
+		if member[mapping.Group] {
+			return mapping.Role
+		}
+	}
+	return p.DefaultRole
+}
+
+// SSOAuthorization is a sign-in started at an OpenID provider. The user is
+// sent to URL and comes back to the client with a code and State.
+type SSOAuthorization struct {
+	URL       string
+	State     string
+	ExpiresIn int64 // seconds until the state expires
+}
+
+// SSOService signs users in through OpenID providers with the authorization
+// code flow and PKCE, provisioning their account on first sign-in
+type SSOService struct {
+	names         []string // in configuration order
+	providers     map[string]*SSOProvider
+	sso           repository.SSORepository
+	users         repository.UserRepository
+	organizations repository.OrganizationRepository
+	roles         repository.RoleRepository
+	transactor    repository.Transactor
+	authService   *AuthService
+	authzService  *AuthorizationService
+	logger        *zap.SugaredLogger
+}
+
+// NewSSOService creates a new single sign-on service for the providers
+func NewSSOService(
+	providers []*SSOProvider,
+	sso repository.SSORepository,
+	users repository.UserRepository,
+	organizations repository.OrganizationRepository,
+	roles repository.RoleRepository,
+	transactor repository.Transactor,
+	authService *AuthService,
+	authzService *AuthorizationService,
+	logger *zap.SugaredLogger,
+) *SSOService {
+	names := make([]string, 0, len(providers))
+	byName := make(map[string]*SSOProvider, len(providers))
+	for _, provider := range providers {
+		names = append(names, provider.Name)
+		byName[provider.Name] = provider
+	}
+
+	return &SSOService{
+		names:         names,
+		providers:     byName,
+		sso:           sso,
+		users:         users,
+		organizations: organizations,
+		roles:         roles,
+		transactor:    transactor,
+		authService:   authService,
+		authzService:  authzService,
+		logger:        logger,
+	}
+}
+
+// Providers returns the names of the configured providers
+func (s *SSOService) Providers() []string {
+	return s.names
+}
+
+// Authorize starts a sign-in at the provider. The nonce and PKCE verifier are
+// kept server-side, so the state is all the client has to carry.
+func (s *SSOService) Authorize(ctx context.Context, providerName string) (*SSOAuthorization, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownSSOProvider
+	}
+
+	state, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := oidc.GenerateVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := provider.Client.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		s.logger.Errorw("SSO provider unavailable", "provider", provider.Name, "error", err)
+		return nil, fmt.Errorf("%w: provider unavailable", ErrSSOFailed)
+	}
+
+	if err := s.sso.DeleteExpiredAttempts(ctx, time.Now()); err != nil {
+		s.logger.Warnw("Failed to delete expired SSO attempts", "error", err)
+	}
+	if err := s.sso.CreateAttempt(ctx, &models.SSOLoginAttempt{
+		Provider:     provider.Name,
+		StateHash:    utils.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(ssoAttemptTTL),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &SSOAuthorization{
+		URL:       authURL,
+		State:     state,
+		ExpiresIn: int64(ssoAttemptTTL.Seconds()),
+	}, nil
+}
+
+// Callback completes a sign-in with the code and state the provider
+// redirected back with. Users are matched by their identity at the provider,
+// then by verified email; unknown users get an account. Their role in the
+// provider's organization follows their groups on every sign-in.
+func (s *SSOService) Callback(ctx context.Context, providerName, code, state string) (*AuthResult, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownSSOProvider
+	}
+
+	attempt, err := s.consumeAttempt(ctx, provider.Name, state)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := provider.Client.Exchange(ctx, code, attempt.CodeVerifier)
+	if err != nil {
+		s.logger.Warnw("SSO code exchange failed", "provider", provider.Name, "error", err)
+		return nil, ErrSSOFailed
+	}
+	idToken, err := provider.Client.VerifyIDToken(ctx, token.IDToken, attempt.Nonce)
+	if err != nil {
+		s.logger.Warnw("SSO ID token rejected", "provider", provider.Name, "error", err)
+		return nil, ErrSSOFailed
+	}
+
+	if !provider.allows(idToken.Email, idToken.EmailVerified) {
+		s.logger.Infow("SSO sign-in denied, email domain not allowed", "provider", provider.Name, "subject", idToken.Subject)
+		return nil, ErrSSONotAuthorized
+	}
+	role := provider.role(idToken.Strings(provider.GroupsClaim))
+	if role == "" {
+		s.logger.Infow("SSO sign-in denied, no group mapped to a role", "provider", provider.Name, "subject", idToken.Subject)
+		return nil, ErrSSONotAuthorized
+	}
+
+	// a missing organization or role is a configuration error, not a missing resource
+	organization, err := s.organizations.FindBySlug(ctx, provider.Organization)
+	if err != nil {
+		return nil, fmt.Errorf("organization %q of SSO provider %q: %v", provider.Organization, provider.Name, err)
+	}
+	orgCtx := tenant.WithOrganization(ctx, organization.ID)
+	if _, err := s.roles.FindByName(orgCtx, role); err != nil {
+		return nil, fmt.Errorf("role %q of SSO provider %q: %v", role, provider.Name, err)
+	}
+
+	var user *models.User
+	err = s.transactor.WithinTransaction(orgCtx, func(ctx context.Context) error {
+		var err error
+		if user, err = s.provisionUser(ctx, provider, idToken); err != nil {
+			return err
+		}
+		return s.syncMembership(ctx, user.ID, role)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("SSO sign-in",
+		"provider", provider.Name,
+		"user_id", user.ID,
+		"organization_id", organization.ID,
+	)
+	// MFA at the identity provider is not visible here, so users with a
+	// CRM authenticator still pass its challenge
+	return s.authService.signIn(ctx, user, organization.ID, false)
+}
+
+// consumeAttempt marks the sign-in attempt with the state as used
+func (s *SSOService) consumeAttempt(ctx context.Context, providerName, state string) (*models.SSOLoginAttempt, error) {
+	attempt, err := s.sso.FindAttempt(ctx, utils.HashToken(state))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidSSOState
+		}
+		return nil, err
+	}
+	if !attempt.Usable() || attempt.Provider != providerName {
+		return nil, ErrInvalidSSOState
+	}
+
+	used, err := s.sso.UseAttempt(ctx, attempt.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrInvalidSSOState
+	}
+	return attempt, nil
+}
+
+// provisionUser finds the user signing in, linking or creating their account
+// on their first sign-in with the provider
+func (s *SSOService) provisionUser(ctx context.Context, provider *SSOProvider, idToken *oidc.IDToken) (*models.User, error) {
+	email := normalizeEmail(idToken.Email)
+
+	identity, err := s.sso.FindIdentity(ctx, provider.Name, idToken.Subject)
+	switch {
+	case err == nil:
+		user, err := s.users.FindByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if email != "" && identity.Email != email {
+			identity.Email = email
+			if err := s.sso.SaveIdentity(ctx, identity); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, err
+	}
+
+	if email == "" {
+		return nil, fmt.Errorf("%w: the identity provider did not share an email address", ErrSSOFailed)
+	}
+
+	now := time.Now()
+	user, err := s.users.FindByEmail(ctx, email)
+	switch {
+	case err == nil:
+		// anyone can claim an address at some providers, so only a verified
+		// one may take over an existing account
+		if !idToken.EmailVerified {
+			return nil, ErrSSOAccountNotLinked
+		}
+		if user.ServiceAccount {
+			return nil, ErrSSONotAuthorized
+		}
+		if !user.EmailVerified() {
+			user.EmailVerifiedAt = &now
+			if err := s.users.Update(ctx, user); err != nil {
+				return nil, err
+			}
+		}
+	case errors.Is(err, repository.ErrNotFound):
+		// the account has no password; the user can set one with a password reset
+		user = &models.User{Email: email}
+		if idToken.EmailVerified {
+			user.EmailVerifiedAt = &now
+		}
+		if err := s.users.Create(ctx, user); err != nil {
+			return nil, err
+		}
+		s.logger.Infow("User provisioned by SSO", "provider", provider.Name, "user_id", user.ID)
+	default:
+		return nil, err
+	}
+
+	if err := s.sso.SaveIdentity(ctx, &models.UserIdentity{
+		UserID:   user.ID,
+		Provider: provider.Name,
+		Subject:  idToken.Subject,
+		Email:    email,
+	}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// syncMembership adds the user to the context organization with the role, or
+// updates their role to match their groups at the provider
+func (s *SSOService) syncMembership(ctx context.Context, userID int, role string) error {
+	membership, err := s.organizations.FindMember(ctx, userID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		err = s.organizations.AddMember(ctx, &models.Membership{UserID: userID, Role: role})
+		if errors.Is(err, repository.ErrDuplicate) {
+			// the membership exists but was deactivated by provisioning
+			return ErrSSONotAuthorized
+		}
+		return err
+	case err != nil:
+		return err
+	case membership.Role == role:
+		return nil
+	}
+
+	_, err = s.authzService.AssignRole(ctx, userID, role)
+	if errors.Is(err, ErrLastAdmin) {
+		// the organization must keep an administrator; the role is synced
+		// once someone else is one
+		s.logger.Warnw("SSO role change would remove the last admin, keeping role",
+			"user_id", userID,
+			"role", membership.Role,
+			"mapped_role", role,
+		)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/oidc"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/oidc/oidctest"
+	"go.uber.org/zap"
+)
+
+// testSSOProvider is the name of the provider the SSO tests sign in with
+const testSSOProvider = "test"
+
+// ssoFixture holds the SSOService under test, the mock provider behind it
+// and its repositories
+type ssoFixture struct {
+	mock          *oidctest.Provider
+	users         *repotest.Users
+	organizations *repotest.Organizations
+	sso           *repotest.SSO
+	service       *SSOService
+}
+
+// newSSOFixture returns an SSOService provisioning users into the test
+// organization. configure adjusts the provider, which maps the crm-admins
+// group to admin and sales to user.
+func newSSOFixture(t *testing.T, configure func(*SSOProvider)) *ssoFixture {
+	t.Helper()
+	mock := oidctest.NewProvider(t)
+	provider := &SSOProvider{
+		Name: testSSOProvider,
+		Client: oidc.NewProvider(oidc.Config{
+			Issuer:       mock.Issuer(),
+			ClientID:     oidctest.ClientID,
+			ClientSecret: oidctest.ClientSecret,
+			RedirectURL:  oidctest.RedirectURL,
+		}),
+		GroupsClaim: "groups",
+		GroupRoles: []SSOGroupRole{
+			{Group: "crm-admins", Role: models.RoleAdmin},
+			{Group: "sales", Role: models.RoleUser},
+		},
+		Organization: "organization-3",
+	}
+	if configure != nil {
+		configure(provider)
+	}
+
+	users := newTestUsers()
+	roles, organizations := newTestRoles(users)
+	fixture := &ssoFixture{
+		mock:          mock,
+		users:         users,
+		organizations: organizations,
+		sso:           repotest.NewSSO(),
+	}
+
+	logger := zap.NewNop().Sugar()
+	mfaService := NewMFAService(repotest.NewMFA(), users, organizations, "CRM", logger)
+	lockoutService := newTestLockoutService(repotest.NewLoginThrottles(), users, organizations)
+	refreshTokens := repotest.NewRefreshTokens()
+	sessionService := newTestSessionService(repotest.NewSessions(), refreshTokens, organizations)
+	authService := NewAuthService(users, organizations, refreshTokens, repotest.Transactor{}, mfaService, lockoutService, sessionService, testJWTConfig(), logger)
+	fixture.service = NewSSOService(
+		[]*SSOProvider{provider}, fixture.sso, users, organizations, roles, repotest.Transactor{},
+		authService, NewAuthorizationService(roles, organizations, logger), logger,
+	)
+	return fixture
+}
+
+// signIn runs a sign-in at the mock provider, which puts the claims into the ID token
+func (f *ssoFixture) signIn(t *testing.T, claims jwt.MapClaims) (*AuthResult, error) {
+	t.Helper()
+	ctx := context.Background()
+	authorization, err := f.service.Authorize(ctx, testSSOProvider)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	f.mock.Claims = claims
+	code, state := f.mock.Login(t, authorization.URL)
+	return f.service.Callback(ctx, testSSOProvider, code, state)
+}
+
+// role returns the user's role in the test organization
+func (f *ssoFixture) role(t *testing.T, userID int) string {
+	t.Helper()
+	membership, err := f.organizations.FindMember(testContext(), userID)
+	if err != nil {
+		t.Fatalf("FindMember: %v", err)
+	}
+	return membership.Role
+}
+
+func TestSSOServiceCallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*SSOProvider)
+		claims    jwt.MapClaims
+		err       error
+		userID    int // 0 for a new account
+		role      string
+	}{
+		{
+			name:   "new user gets the role of their group",
+			claims: jwt.MapClaims{"email": "jane@example.com", "groups": []string{"sales"}},
+			role:   models.RoleUser,
+		},
+		{
+			name:   "first matching mapping wins",
+			claims: jwt.MapClaims{"email": "jane@example.com", "groups": []string{"sales", "crm-admins"}},
+			role:   models.RoleAdmin,
+		},
+		{
+			name:      "default role without a mapped group",
+			configure: func(p *SSOProvider) { p.DefaultRole = models.RoleUser },
+			claims:    jwt.MapClaims{"email": "jane@example.com", "groups": []string{"support"}},
+			role:      models.RoleUser,
+		},
+		{
+			name:   "no mapped group and no default role",
+			claims: jwt.MapClaims{"email": "jane@example.com", "groups": []string{"support"}},
+			err:    ErrSSONotAuthorized,
+		},
+		{
+			name:   "no groups claim",
+			claims: jwt.MapClaims{"email": "jane@example.com"},
+			err:    ErrSSONotAuthorized,
+		},
+		{
+			name:   "existing user linked by verified email",
+			claims: jwt.MapClaims{"email": "Member@Example.com", "groups": []string{"crm-admins"}},
+			userID: testMemberID,
+			role:   models.RoleAdmin,
+		},
+		{
+			name:   "existing user with an unverified email",
+			claims: jwt.MapClaims{"email": "member@example.com", "email_verified": false, "groups": []string{"sales"}},
+			err:    ErrSSOAccountNotLinked,
+		},
+		{
+			name:   "last admin keeps their role",
+			claims: jwt.MapClaims{"email": "admin@example.com", "groups": []string{"sales"}},
+			userID: testAdminID,
+			role:   models.RoleAdmin,
+		},
+		{
+			name:   "missing email",
+			claims: jwt.MapClaims{"email": "", "groups": []string{"sales"}},
+			err:    ErrSSOFailed,
+		},
+		{
+			name:      "allowed domain in another case",
+			configure: func(p *SSOProvider) { p.AllowedDomains = []string{"Example.COM"} },
+			claims:    jwt.MapClaims{"email": "jane@example.com", "groups": []string{"sales"}},
+			role:      models.RoleUser,
+		},
+		{
+			name:      "domain not allowed",
+			configure: func(p *SSOProvider) { p.AllowedDomains = []string{"acme.com"} },
+			claims:    jwt.MapClaims{"email": "jane@example.com", "groups": []string{"sales"}},
+			err:       ErrSSONotAuthorized,
+		},
+		{
+			name:      "subdomain of an allowed domain",
+			configure: func(p *SSOProvider) { p.AllowedDomains = []string{"example.com"} },
+			claims:    jwt.MapClaims{"email": "jane@mail.example.com", "groups": []string{"sales"}},
+			err:       ErrSSONotAuthorized,
+		},
+		{
+			name:      "unverified email in an allowed domain",
+			configure: func(p *SSOProvider) { p.AllowedDomains = []string{"example.com"} },
+			claims:    jwt.MapClaims{"email": "jane@example.com", "email_verified": false, "groups": []string{"sales"}},
+			err:       ErrSSONotAuthorized,
+		},
+		{
+			name:      "missing email with allowed domains",
+			configure: func(p *SSOProvider) { p.AllowedDomains = []string{"example.com"} },
+			claims:    jwt.MapClaims{"email": "", "groups": []string{"sales"}},
+			err:       ErrSSONotAuthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSSOFixture(t, tt.configure)
+			result, err := f.signIn(t, tt.claims)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Callback = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if _, err := f.users.FindByEmail(context.Background(), "jane@example.com"); err == nil {
+					t.Error("a refused sign-in provisioned an account")
+				}
+				return
+			}
+
+			if result.Tokens == nil {
+				t.Fatal("no tokens issued")
+			}
+			user := result.User
+			if tt.userID != 0 && user.ID != tt.userID {
+				t.Errorf("signed in as user %d, want %d", user.ID, tt.userID)
+			}
+			if tt.userID == 0 && (user.Password != "" || !user.EmailVerified()) {
+				t.Errorf("provisioned %+v, want a verified account without a password", user)
+			}
+			if got := f.role(t, user.ID); got != tt.role {
+				t.Errorf("role = %q, want %q", got, tt.role)
+			}
+			identity, err := f.sso.FindIdentity(context.Background(), testSSOProvider, "user-123")
+			if err != nil || identity.UserID != user.ID {
+				t.Errorf("identity = %+v, %v, want one linked to user %d", identity, err, user.ID)
+			}
+		})
+	}
+}
+
+func TestSSOServiceCallbackFollowsIdentity(t *testing.T) {
+	f := newSSOFixture(t, nil)
+	first, err := f.signIn(t, jwt.MapClaims{"email": "jane@example.com", "groups": []string{"crm-admins"}})
+	if err != nil {
+		t.Fatalf("first sign-in: %v", err)
+	}
+
+	// the subject, not the email, identifies the user, and the role follows
+	// the groups on every sign-in
+	second, err := f.signIn(t, jwt.MapClaims{"email": "jane.doe@example.com", "groups": []string{"sales"}})
+	if err != nil {
+		t.Fatalf("second sign-in: %v", err)
+	}
+	if second.User.ID != first.User.ID {
+		t.Errorf("signed in as user %d, want %d", second.User.ID, first.User.ID)
+	}
+	if got := f.role(t, second.User.ID); got != models.RoleUser {
+		t.Errorf("role = %q, want %q", got, models.RoleUser)
+	}
+	identity, err := f.sso.FindIdentity(context.Background(), testSSOProvider, "user-123")
+	if err != nil || identity.Email != "jane.doe@example.com" {
+		t.Errorf("identity = %+v, %v, want the new email", identity, err)
+	}
+}
+
+func TestSSOServiceCallbackRejectsState(t *testing.T) {
+	claims := jwt.MapClaims{"groups": []string{"sales"}}
+	tests := []struct {
+		name     string
+		callback func(f *ssoFixture, code, state string) (*AuthResult, error)
+		err      error
+	}{
+		{
+			name: "state used twice",
+			callback: func(f *ssoFixture, code, state string) (*AuthResult, error) {
+				if _, err := f.service.Callback(context.Background(), testSSOProvider, code, state); err != nil {
+					return nil, err
+				}
+				return f.service.Callback(context.Background(), testSSOProvider, code, state)
+			},
+			err: ErrInvalidSSOState,
+		},
+		{
+			name: "unknown state",
+			callback: func(f *ssoFixture, code, state string) (*AuthResult, error) {
+				return f.service.Callback(context.Background(), testSSOProvider, code, state+"x")
+			},
+			err: ErrInvalidSSOState,
+		},
+		{
+			name: "unknown provider",
+			callback: func(f *ssoFixture, code, state string) (*AuthResult, error) {
+				return f.service.Callback(context.Background(), "other", code, state)
+			},
+			err: ErrUnknownSSOProvider,
+		},
+		{
+			name: "code of another sign-in",
+			callback: func(f *ssoFixture, code, state string) (*AuthResult, error) {
+				return f.service.Callback(context.Background(), testSSOProvider, code+"x", state)
+			},
+			err: ErrSSOFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSSOFixture(t, nil)
+			authorization, err := f.service.Authorize(context.Background(), testSSOProvider)
+			if err != nil {
+				t.Fatalf("Authorize: %v", err)
+			}
+			f.mock.Claims = claims
+			code, state := f.mock.Login(t, authorization.URL)
+
+			if _, err := tt.callback(f, code, state); !errors.Is(err, tt.err) {
+				t.Fatalf("Callback = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"go.uber.org/zap"
+)
+
+var ErrNoTagChanges = errors.New("at least one tag must be added or removed")
+
+// TagChanges counts the tags added to and removed from records in bulk
+type TagChanges struct {
+	Added   int64
+	Removed int64
+}
+
+// TagService lists tags and changes the tags of many records at once
+type TagService struct {
+	tags       repository.TagRepository
+	contacts   repository.ContactRepository
+	companies  repository.CompanyRepository
+	deals      repository.DealRepository
+	segments   *SegmentService
+	transactor repository.Transactor
+	logger     *zap.SugaredLogger
+}
+
+// NewTagService creates a new tag service
+func NewTagService(
+	tags repository.TagRepository,
+	contacts repository.ContactRepository,
+	companies repository.CompanyRepository,
+	deals repository.DealRepository,
+	segments *SegmentService,
+	transactor repository.Transactor,
+	logger *zap.SugaredLogger,
+) *TagService {
+	return &TagService{
+		tags:       tags,
+		contacts:   contacts,
+		companies:  companies,
+		deals:      deals,
+		segments:   segments,
+		transactor: transactor,
+		logger:     logger,
+	}
+}
+
+// List returns the context organization's tags on records of a type, or of
+// every type when recordType is empty, with the number of records carrying them
+func (s *TagService) List(ctx context.Context, recordType string) ([]repository.TagCount, error) {
+	return s.tags.List(ctx, recordType)
+}
+
+// Change adds tags to and removes tags from records of a type of the context
+// organization. Tags both added and removed are added. Every record must
+// exist, or nothing changes.
+func (s *TagService) Change(ctx context.Context, recordType string, recordIDs []int, add, remove []string) (*TagChanges, error) {
+	add, remove = normalizeTags(add), normalizeTags(remove)
+	if len(add) == 0 && len(remove) == 0 {
+		return nil, ErrNoTagChanges
+	}
+
+	ids := uniqueIDs(recordIDs)
+	if err := s.checkRecords(ctx, recordType, ids); err != nil {
+		return nil, err
+	}
+
+	changes := &TagChanges{}
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if changes.Removed, err = s.tags.Remove(ctx, recordType, ids, remove); err != nil {
+			return err
+		}
+		changes.Added, err = s.tags.Add(ctx, recordType, ids, add)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.segments.invalidate(ctx)
+
+	s.logger.Infow("Tags changed", "record_type", recordType, "records", len(ids), "added", changes.Added, "removed", changes.Removed)
+	return changes, nil
+}
+
+// checkRecords verifies that every record exists in the context organization
+func (s *TagService) checkRecords(ctx context.Context, recordType string, ids []int) error {
+	var count int64
+	var err error
+	switch recordType {
+	case models.RecordContact:
+		count, err = s.contacts.CountByIDs(ctx, ids)
+	case models.RecordCompany:
+		count, err = s.companies.CountByIDs(ctx, ids)
+	case models.RecordDeal:
+		count, err = s.deals.CountByIDs(ctx, ids)
+	default:
+		return ErrInvalidRecord
+	}
+	if err != nil {
+		return err
+	}
+	if count != int64(len(ids)) {
+		return ErrInvalidRecord
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+func newTestTagService() (*TagService, *repotest.Tags) {
+	contacts := repotest.NewContacts(taggedContact(1, "Ada", "lead"), taggedContact(2, "Grace", "lead", "vip"))
+	tags := repotest.NewTags(contacts, nil, nil)
+	segments := newTestSegmentService(repotest.NewSegments(contacts, nil, nil, nil))
+	companies := repotest.NewCompanies(contacts)
+	service := NewTagService(tags, contacts, companies, repotest.NewDeals(companies), segments, repotest.Transactor{}, zap.NewNop().Sugar())
+	return service, tags
+}
+
+func TestTagServiceChange(t *testing.T) {
+	service, tags := newTestTagService()
+	ctx := testContext()
+
+	changes, err := service.Change(ctx, models.RecordContact, []int{2, 1, 2},
+		[]string{" VIP ", "vip", "Partner", ""}, []string{"Lead", " "})
+	if err != nil {
+		t.Fatalf("Change: %v", err)
+	}
+	if changes.Added != 3 || changes.Removed != 2 {
+		t.Errorf("changes = %+v, want 3 added and 2 removed", changes)
+	}
+	counts, err := tags.List(ctx, models.RecordContact)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	want := []repository.TagCount{{Name: "partner", Count: 2}, {Name: "vip", Count: 2}}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("tags = %+v, want %+v", counts, want)
+	}
+}
+
+func TestTagServiceChangeRejectsInvalidChanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordType string
+		recordIDs  []int
+		add        []string
+		want       error
+	}{
+		{"no tags", models.RecordContact, []int{1}, nil, ErrNoTagChanges},
+		{"blank tags", models.RecordContact, []int{1}, []string{" ", ""}, ErrNoTagChanges},
+		{"missing record", models.RecordContact, []int{1, 9}, []string{"vip"}, ErrInvalidRecord},
+		{"record of another type", models.RecordCompany, []int{1}, []string{"vip"}, ErrInvalidRecord},
+		{"unknown record type", "task", []int{1}, []string{"vip"}, ErrInvalidRecord},
+	}
+	want := []repository.TagCount{{Name: "lead", Count: 2}, {Name: "vip", Count: 1}}
+	for _, tt := range tests {
+		service, tags := newTestTagService()
+		if _, err := service.Change(testContext(), tt.recordType, tt.recordIDs, tt.add, nil); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Change = %v, want %v", tt.name, err, tt.want)
+		}
+		if counts, _ := tags.List(testContext(), ""); !reflect.DeepEqual(counts, want) {
+			t.Errorf("%s: tags = %+v, want them unchanged", tt.name, counts)
+		}
+	}
+}
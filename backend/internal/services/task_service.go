@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/listquery"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidAssignee = errors.New("assignee must be a member of the organization")
+	ErrInvalidReminder = errors.New("reminder time must not be after the due date")
+)
+
+// Views of the tasks assigned to a user. They cover pending tasks with a due
+// date and do not overlap: overdue tasks were due before now, today's are due
+// from now until midnight and upcoming ones after that.
+const (
+	TaskViewOverdue  = "overdue"
+	TaskViewToday    = "today"
+	TaskViewUpcoming = "upcoming"
+)
+
+// TaskInput holds the data of a task to create or replace. A task can be
+// about a CRM record, named by RecordType and RecordID.
+type TaskInput struct {
+	Title       string
+	Description string
+	AssigneeID  *int
+	DueAt       *time.Time
+	RemindAt    *time.Time
+	Priority    string
+	Status      string
+	RecordType  string
+	RecordID    *int
+}
+
+// TaskService manages the tasks of an organization and the views members
+// have of the tasks assigned to them
+type TaskService struct {
+	tasks         repository.TaskRepository
+	contacts      repository.ContactRepository
+	companies     repository.CompanyRepository
+	deals         repository.DealRepository
+	organizations repository.OrganizationRepository
+	segments      *SegmentService
+	logger        *zap.SugaredLogger
+}
+
+// NewTaskService creates a new task service
+func NewTaskService(
+	tasks repository.TaskRepository,
+	contacts repository.ContactRepository,
+	companies repository.CompanyRepository,
+	deals repository.DealRepository,
+	organizations repository.OrganizationRepository,
+	segments *SegmentService,
+	logger *zap.SugaredLogger,
+) *TaskService {
+	return &TaskService{
+		tasks:         tasks,
+		contacts:      contacts,
+		companies:     companies,
+		deals:         deals,
+		organizations: organizations,
+		segments:      segments,
+		logger:        logger,
+	}
+}
+
+// Create adds a task to the context organization. Without an assignee the
+// task is assigned to its creator.
+func (s *TaskService) Create(ctx context.Context, creatorID int, input TaskInput) (*models.Task, error) {
+	if input.AssigneeID == nil {
+		input.AssigneeID = &creatorID
+	}
+
+	task := &models.Task{CreatedByID: &creatorID}
+	if err := s.apply(ctx, task, input); err != nil {
+		return nil, err
+	}
+	if err := s.tasks.Create(ctx, task); err != nil {
+		return nil, err
+	}
+
+	s.logger.Infow("Task created", "task_id", task.ID, "organization_id", task.OrganizationID, "created_by", creatorID)
+	return s.tasks.FindByID(ctx, task.ID)
+}
+
+// Get returns a task of the context organization
+func (s *TaskService) Get(ctx context.Context, id int) (*models.Task, error) {
+	return s.tasks.FindByID(ctx, id)
+}
+
+// List returns a page of the context organization's tasks and the number of
+// matching tasks
+func (s *TaskService) List(ctx context.Context, filter repository.TaskFilter, page, pageSize int) ([]models.Task, int64, error) {
+	if filter.Segment != 0 {
+		var err error
+		if filter.InSegment, err = s.segments.match(ctx, filter.Segment, filter.RecordType); err != nil {
+			return nil, 0, err
+		}
+	}
+	return s.tasks.List(ctx, filter, (page-1)*pageSize, pageSize)
+}
+
+// Mine returns a page of a view of the pending tasks assigned to a user,
+// soonest due first, and the number of tasks in the view. Days start at
+// midnight in the given location.
+func (s *TaskService) Mine(ctx context.Context, userID int, view string, loc *time.Location, page, pageSize int) ([]models.Task, int64, error) {
+	now := time.Now().UTC()
+	year, month, day := now.In(loc).Date()
+	tomorrow := time.Date(year, month, day+1, 0, 0, 0, 0, loc).UTC()
+
+	filter := repository.TaskFilter{AssigneeID: userID, Pending: true, Filters: repository.TaskFields.Sorted(listquery.Sort{Field: "due_at"})}
+	switch view {
+	case TaskViewOverdue:
+		filter.DueBefore = &now
+	case TaskViewToday:
+		filter.DueFrom, filter.DueBefore = &now, &tomorrow
+	default:
+		filter.DueFrom = &tomorrow
+	}
+	return s.tasks.List(ctx, filter, (page-1)*pageSize, pageSize)
+}
+
+// Update replaces the details of a task of the context organization, keeping
+// its creator. Changing when the task is due or should be reminded of sends
+// the reminder again.
+func (s *TaskService) Update(ctx context.Context, id int, input TaskInput) (*models.Task, error) {
+	task, err := s.tasks.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(ctx, task, input); err != nil {
+		return nil, err
+	}
+	if err := s.tasks.Update(ctx, task); err != nil {
+		return nil, err
+	}
+	return s.tasks.FindByID(ctx, id)
+}
+
+// Delete removes a task of the context organization
+func (s *TaskService) Delete(ctx context.Context, id int) error {
+	if err := s.tasks.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.logger.Infow("Task deleted", "task_id", id)
+	return nil
+}
+
+// apply copies the input onto the task after checking its times, the assignee
+// and the record the task is about
+func (s *TaskService) apply(ctx context.Context, task *models.Task, input TaskInput) error {
+	if input.RemindAt != nil && input.DueAt != nil && input.RemindAt.After(*input.DueAt) {
+		return ErrInvalidReminder
+	}
+	if err := checkOwner(ctx, s.organizations, input.AssigneeID); err != nil {
+		if errors.Is(err, ErrInvalidOwner) {
+			return ErrInvalidAssignee
+		}
+		return err
+	}
+	if input.RecordType != "" {
+		if input.RecordID == nil {
+			return ErrInvalidRecord
+		}
+		if err := checkRecord(ctx, s.contacts, s.companies, s.deals, input.RecordType, *input.RecordID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrInvalidRecord
+			}
+			return err
+		}
+	} else {
+		input.RecordID = nil
+	}
+
+	if !sameTime(task.DueAt, input.DueAt) || !sameTime(task.RemindAt, input.RemindAt) {
+		task.RemindedAt = nil
+	}
+	if input.Priority == "" {
+		input.Priority = models.TaskMedium
+	}
+	if input.Status == "" {
+		input.Status = models.TaskOpen
+	}
+	switch {
+	case input.Status != models.TaskDone:
+		task.CompletedAt = nil
+	case task.Status != models.TaskDone || task.CompletedAt == nil:
+		now := time.Now()
+		task.CompletedAt = &now
+	}
+
+	task.Title = strings.TrimSpace(input.Title)
+	task.Description = strings.TrimSpace(input.Description)
+	task.AssigneeID = input.AssigneeID
+	task.Assignee = nil
+	task.CreatedBy = nil
+	task.DueAt = input.DueAt
+	task.RemindAt = input.RemindAt
+	task.Priority = input.Priority
+	task.Status = input.Status
+	task.RecordType = input.RecordType
+	task.RecordID = input.RecordID
+	return nil
+}
+
+// sameTime reports whether two optional times are both unset or equal
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
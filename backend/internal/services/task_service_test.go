@@ -0,0 +1,211 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/models"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/internal/repository/repotest"
+	"go.uber.org/zap"
+)
+
+// testTask returns an open task of the test organization
+func testTask(id int, title string) models.Task {
+	return models.Task{
+		ID:          id,
+		TenantOwned: models.TenantOwned{OrganizationID: testOrganizationID},
+		Title:       title,
+		Priority:    models.TaskMedium,
+		Status:      models.TaskOpen,
+	}
+}
+
+// newTestTaskService returns a TaskService over the tasks, assigned to the
+// members of the test organization, which can be about contact 1 and
+// company 1
+func newTestTaskService(tasks *repotest.Tasks) *TaskService {
+	_, organizations := newTestRoles(newTestUsers())
+	contacts := repotest.NewContacts(testContact(1, "Ada"))
+	companies := repotest.NewCompanies(contacts, testCompany(1, "Acme"))
+	return NewTaskService(tasks, contacts, companies, repotest.NewDeals(companies), organizations, nil, zap.NewNop().Sugar())
+}
+
+func TestTaskServiceCreateDefaults(t *testing.T) {
+	service := newTestTaskService(repotest.NewTasks(newTestUsers()))
+
+	task, err := service.Create(testContext(), testManagerID, TaskInput{Title: " Call back ", Description: "About pricing "})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if task.Title != "Call back" || task.Description != "About pricing" {
+		t.Errorf("task = %+v", task)
+	}
+	if task.AssigneeID == nil || *task.AssigneeID != testManagerID || task.CreatedByID == nil || *task.CreatedByID != testManagerID {
+		t.Errorf("assignee = %v, creator = %v, want the creator for both", task.AssigneeID, task.CreatedByID)
+	}
+	if task.Priority != models.TaskMedium || task.Status != models.TaskOpen || task.CompletedAt != nil {
+		t.Errorf("priority %q, status %q, completed at %v, want a medium open task", task.Priority, task.Status, task.CompletedAt)
+	}
+
+	record := 1
+	task, err = service.Create(testContext(), testAdminID, TaskInput{Title: "Send quote", RecordID: &record})
+	if err != nil {
+		t.Fatalf("Create with a record ID only: %v", err)
+	}
+	if task.RecordType != "" || task.RecordID != nil {
+		t.Errorf("record = %q %v, want a record ID without a type dropped", task.RecordType, task.RecordID)
+	}
+}
+
+func TestTaskServiceRejectsInvalidReferences(t *testing.T) {
+	outsider, missing, first := testOutsider.ID, 9, 1
+	due := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		input TaskInput
+		want  error
+	}{
+		{"assignee outside the organization", TaskInput{AssigneeID: &outsider}, ErrInvalidAssignee},
+		{"record type without an ID", TaskInput{RecordType: models.RecordContact}, ErrInvalidRecord},
+		{"missing contact", TaskInput{RecordType: models.RecordContact, RecordID: &missing}, ErrInvalidRecord},
+		{"missing deal", TaskInput{RecordType: models.RecordDeal, RecordID: &first}, ErrInvalidRecord},
+		{"reminder after the due date", TaskInput{DueAt: &due, RemindAt: ptrTime(due.Add(time.Minute))}, ErrInvalidReminder},
+	}
+	for _, tt := range tests {
+		tasks := repotest.NewTasks(newTestUsers())
+		service := newTestTaskService(tasks)
+		tt.input.Title = "Task"
+		if _, err := service.Create(testContext(), testAdminID, tt.input); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Create = %v, want %v", tt.name, err, tt.want)
+		}
+		if _, total, err := tasks.List(testContext(), repository.TaskFilter{}, 0, 10); err != nil || total != 0 {
+			t.Errorf("%s: List = %d, %v, want the task not saved", tt.name, total, err)
+		}
+	}
+}
+
+func TestTaskServiceUpdateTracksCompletion(t *testing.T) {
+	assignee := testMemberID
+	seeded := testTask(1, "Call")
+	seeded.AssigneeID, seeded.Priority = &assignee, models.TaskHigh
+	service := newTestTaskService(repotest.NewTasks(newTestUsers(), seeded))
+	ctx := testContext()
+	input := TaskInput{Title: "Call", AssigneeID: &assignee, Priority: models.TaskHigh, Status: models.TaskDone}
+
+	task, err := service.Update(ctx, 1, input)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if task.CompletedAt == nil {
+		t.Fatal("the done task has no completion time")
+	}
+	completed := *task.CompletedAt
+
+	// saving a done task again keeps when it was completed
+	if task, err = service.Update(ctx, 1, input); err != nil {
+		t.Fatalf("second Update: %v", err)
+	}
+	if task.CompletedAt == nil || !task.CompletedAt.Equal(completed) {
+		t.Errorf("completed at %v, want %v", task.CompletedAt, completed)
+	}
+
+	input.Status = models.TaskInProgress
+	if task, err = service.Update(ctx, 1, input); err != nil {
+		t.Fatalf("Update to in progress: %v", err)
+	}
+	if task.CompletedAt != nil {
+		t.Errorf("completed at %v, want it cleared once the task is reopened", task.CompletedAt)
+	}
+
+	if _, err := service.Update(ctx, 2, input); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Update of a missing task = %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func TestTaskServiceUpdateResetsReminder(t *testing.T) {
+	due := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	remind := due.Add(-time.Hour)
+	later := due.Add(24 * time.Hour)
+
+	tests := []struct {
+		name          string
+		dueAt         *time.Time
+		remindAt      *time.Time
+		keepsReminder bool
+	}{
+		{"same times", &due, &remind, true},
+		{"same times in another zone", ptrTime(due.In(time.FixedZone("UTC+7", 7*3600))), &remind, true},
+		{"later due date", &later, &remind, false},
+		{"earlier reminder", &due, ptrTime(remind.Add(-time.Hour)), false},
+		{"reminder cleared", &due, nil, false},
+		{"due date cleared", nil, &remind, false},
+	}
+	for _, tt := range tests {
+		reminded := remind.Add(time.Minute)
+		seeded := testTask(1, "Call")
+		seeded.DueAt, seeded.RemindAt, seeded.RemindedAt = &due, &remind, &reminded
+		service := newTestTaskService(repotest.NewTasks(newTestUsers(), seeded))
+
+		task, err := service.Update(testContext(), 1, TaskInput{Title: "Call", DueAt: tt.dueAt, RemindAt: tt.remindAt})
+		if err != nil {
+			t.Fatalf("%s: Update: %v", tt.name, err)
+		}
+		if kept := task.RemindedAt != nil; kept != tt.keepsReminder {
+			t.Errorf("%s: reminded at %v, want kept %v", tt.name, task.RemindedAt, tt.keepsReminder)
+		}
+	}
+}
+
+func TestTaskServiceMineViews(t *testing.T) {
+	loc := time.FixedZone("UTC+7", 7*3600)
+	now := time.Now()
+	year, month, day := now.In(loc).Date()
+	tomorrow := time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+
+	// task builds a task due at a time, assigned to the manager unless told
+	// otherwise
+	task := func(id int, dueAt *time.Time, status string, assigneeID int) models.Task {
+		task := testTask(id, "Call")
+		task.DueAt, task.Status, task.AssigneeID = dueAt, status, &assigneeID
+		return task
+	}
+	tasks := repotest.NewTasks(newTestUsers(),
+		task(1, ptrTime(now.Add(-time.Hour)), models.TaskOpen, testManagerID),
+		task(2, ptrTime(now.Add(-48*time.Hour)), models.TaskInProgress, testManagerID),
+		task(3, ptrTime(now.Add(tomorrow.Sub(now)/2)), models.TaskOpen, testManagerID),
+		task(4, ptrTime(tomorrow.Add(48*time.Hour)), models.TaskOpen, testManagerID),
+		task(5, ptrTime(tomorrow), models.TaskOpen, testManagerID),
+		task(6, ptrTime(now.Add(-time.Hour)), models.TaskDone, testManagerID),
+		task(7, ptrTime(now.Add(-time.Hour)), models.TaskOpen, testMemberID),
+		task(8, nil, models.TaskOpen, testManagerID),
+	)
+	service := newTestTaskService(tasks)
+
+	tests := []struct {
+		view string
+		want []int
+	}{
+		{TaskViewOverdue, []int{2, 1}},
+		{TaskViewToday, []int{3}},
+		{TaskViewUpcoming, []int{5, 4}},
+	}
+	for _, tt := range tests {
+		found, total, err := service.Mine(testContext(), testManagerID, tt.view, loc, 1, 10)
+		if err != nil {
+			t.Fatalf("%s: Mine: %v", tt.view, err)
+		}
+		var ids []int
+		for _, task := range found {
+			ids = append(ids, task.ID)
+		}
+		if !equalIDs(ids, tt.want) || total != int64(len(tt.want)) {
+			t.Errorf("%s: tasks %v of %d, want %v soonest due first", tt.view, ids, total, tt.want)
+		}
+	}
+}
+
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,35 @@
+// Package tenant carries the active organization through a request context so
+// that the repository layer can scope every query to it.
+package tenant
+
+import "context"
+
+type contextKey int
+
+const (
+	organizationKey contextKey = iota
+	unscopedKey
+)
+
+// WithOrganization returns a context scoped to the given organization
+func WithOrganization(ctx context.Context, organizationID int) context.Context {
+	return context.WithValue(ctx, organizationKey, organizationID)
+}
+
+// OrganizationID returns the organization the context is scoped to
+func OrganizationID(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(organizationKey).(int)
+	return id, ok && id > 0
+}
+
+// Unscoped returns a context that deliberately reads across organizations.
+// It is meant for system flows such as login, never for request handlers.
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey, true)
+}
+
+// IsUnscoped reports whether tenant scoping was disabled for the context
+func IsUnscoped(ctx context.Context) bool {
+	unscoped, _ := ctx.Value(unscopedKey).(bool)
+	return unscoped
+}
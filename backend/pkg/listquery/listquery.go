@@ -0,0 +1,380 @@
+// Package listquery parses the filter and sort parameters of list endpoints,
+// such as `filter[amount][gte]=1000&filter[stage.name][in]=a,b&sort=-created_at`,
+// into GORM clauses.
+//
+// Clients only name fields; a Schema maps those names to columns, so column
+// names in the SQL never come from the request and values are always bound as
+// parameters. Filters are written filter[field]=value for equality or
+// filter[field][op]=value with one of the operators below, and are all
+// required to match. Sorts are a comma-separated list of fields, each prefixed
+// with "-" for descending order.
+package listquery
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Filter operators
+const (
+	OpEqual          = "eq"
+	OpNotEqual       = "ne"
+	OpGreater        = "gt"
+	OpGreaterOrEqual = "gte"
+	OpLess           = "lt"
+	OpLessOrEqual    = "lte"
+	OpIn             = "in"   // comma-separated values
+	OpLike           = "like" // case-insensitive substring match of text
+	OpNull           = "null" // "true" for no value, "false" for any value
+)
+
+// comparisons maps the operators comparing with one value to SQL
+var comparisons = map[string]string{
+	OpEqual:          "=",
+	OpNotEqual:       "<>",
+	OpGreater:        ">",
+	OpGreaterOrEqual: ">=",
+	OpLess:           "<",
+	OpLessOrEqual:    "<=",
+}
+
+// maxInValues bounds the number of values of an "in" filter
+const maxInValues = 100
+
+// Type is the type of a field's values, deciding how they are parsed and
+// which operators apply
+type Type int
+
+const (
+	String Type = iota // text, filtered with eq, ne, in, like and null
+	Int                // whole numbers, also compared with ranges
+	Number             // decimal numbers, also compared with ranges
+	Bool               // true or false, filtered with eq, ne and null
+	Time               // RFC 3339 times, or dates meaning midnight UTC
+	Date               // YYYY-MM-DD calendar dates
+)
+
+// Field is a field clients may filter or sort on
+type Field struct {
+	// Column is the qualified column holding the field, such as
+	// "deals.amount". It is written into the SQL as is.
+	Column string
+	Type   Type
+	// Sortable allows sorting by the field
+	Sortable bool
+	// Through is set on fields of related records to a correlated subquery
+	// selecting those records, such as
+	// "SELECT 1 FROM companies WHERE companies.id = deals.company_id". The
+	// field's filters then match records with a related record matching
+	// them. Fields of related records cannot be sortable.
+	Through string
+}
+
+// Schema lists the fields of a list endpoint by the names clients use, with
+// dots naming the fields of related records such as "company.name"
+type Schema struct {
+	Fields map[string]Field
+}
+
+// Condition is a filter on a field. Value is of the field's type: a string,
+// int64, float64, bool or time.Time, or a slice of them for "in", or a bool
+// for "null".
+type Condition struct {
+	Field    string
+	Operator string
+	Value    interface{}
+}
+
+// Sort orders by a field
+type Sort struct {
+	Field      string
+	Descending bool
+}
+
+// Query is a parsed query of a list endpoint. A nil Query changes nothing.
+type Query struct {
+	schema     *Schema
+	Conditions []Condition
+	Sorts      []Sort
+}
+
+// Error is returned for invalid parameters. Fields maps each invalid
+// parameter, as written, to what is wrong with it.
+type Error struct {
+	Fields map[string]string
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	params := make([]string, 0, len(e.Fields))
+	for param := range e.Fields {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	for i, param := range params {
+		params[i] = param + ": " + e.Fields[param]
+	}
+	return "invalid query: " + strings.Join(params, "; ")
+}
+
+// Parse parses the filter[...] and sort parameters, ignoring the others. An
+// empty sort leaves the order to the endpoint.
+func (s *Schema) Parse(values url.Values) (*Query, error) {
+	query := &Query{schema: s}
+	errs := map[string]string{}
+	for param, raw := range values {
+		rest, ok := strings.CutPrefix(param, "filter[")
+		if !ok {
+			continue
+		}
+		name, op, err := splitFilter(rest)
+		if err != "" {
+			errs[param] = err
+			continue
+		}
+		field, ok := s.Fields[name]
+		if !ok {
+			errs[param] = fmt.Sprintf("unknown field %q", name)
+			continue
+		}
+		for _, text := range raw {
+			value, err := parseValue(field.Type, op, text)
+			if err != "" {
+				errs[param] = err
+				break
+			}
+			query.Conditions = append(query.Conditions, Condition{Field: name, Operator: op, Value: value})
+		}
+	}
+
+	// parameters come in no particular order, while queries should not vary
+	sort.SliceStable(query.Conditions, func(i, j int) bool {
+		a, b := query.Conditions[i], query.Conditions[j]
+		if a.Field != b.Field {
+			return a.Field < b.Field
+		}
+		return a.Operator < b.Operator
+	})
+
+	if text := strings.Join(values["sort"], ","); text != "" {
+		sorts, err := s.parseSort(text)
+		if err != "" {
+			errs["sort"] = err
+		}
+		query.Sorts = sorts
+	}
+	if len(errs) > 0 {
+		return nil, &Error{Fields: errs}
+	}
+	return query, nil
+}
+
+// Sorted returns a query without conditions ordering by sortable fields of
+// the schema, for endpoints choosing the order themselves. It panics on a
+// field that cannot be sorted by.
+func (s *Schema) Sorted(sorts ...Sort) *Query {
+	for _, sort := range sorts {
+		if field, ok := s.Fields[sort.Field]; !ok || !field.Sortable {
+			panic(fmt.Sprintf("listquery: cannot sort by %q", sort.Field))
+		}
+	}
+	return &Query{schema: s, Sorts: sorts}
+}
+
+// splitFilter splits what follows "filter[" into the field name and the
+// operator, defaulting to equality
+func splitFilter(rest string) (name, op, err string) {
+	name, rest, ok := strings.Cut(rest, "]")
+	if !ok || name == "" || strings.Contains(name, "[") {
+		return "", "", "malformed filter"
+	}
+	if rest == "" {
+		return name, OpEqual, ""
+	}
+	op = strings.TrimSuffix(strings.TrimPrefix(rest, "["), "]")
+	if len(op) != len(rest)-2 || op == "" || strings.ContainsAny(op, "[]") {
+		return "", "", "malformed filter"
+	}
+	return name, op, ""
+}
+
+// parseValue parses the text of a filter on a field of a type
+func parseValue(fieldType Type, op, text string) (interface{}, string) {
+	switch op {
+	case OpNull:
+		null, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, "must be true or false"
+		}
+		return null, ""
+	case OpLike:
+		if fieldType != String {
+			return nil, "like only applies to text"
+		}
+		if text == "" {
+			return nil, "must not be empty"
+		}
+		return text, ""
+	case OpIn:
+		texts := strings.Split(text, ",")
+		if len(texts) > maxInValues {
+			return nil, fmt.Sprintf("must have at most %d values", maxInValues)
+		}
+		values := make([]interface{}, len(texts))
+		for i, text := range texts {
+			value, err := parseScalar(fieldType, strings.TrimSpace(text))
+			if err != "" {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, ""
+	case OpEqual, OpNotEqual:
+		return parseScalar(fieldType, text)
+	case OpGreater, OpGreaterOrEqual, OpLess, OpLessOrEqual:
+		if fieldType == String || fieldType == Bool {
+			return nil, fmt.Sprintf("%s only applies to numbers and times", op)
+		}
+		return parseScalar(fieldType, text)
+	default:
+		return nil, fmt.Sprintf("unknown operator %q", op)
+	}
+}
+
+// parseScalar parses a single value of a type
+func parseScalar(fieldType Type, text string) (interface{}, string) {
+	switch fieldType {
+	case Int:
+		value, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, "must be a whole number"
+		}
+		return value, ""
+	case Number:
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, "must be a number"
+		}
+		return value, ""
+	case Bool:
+		value, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, "must be true or false"
+		}
+		return value, ""
+	case Time:
+		if value, err := time.Parse(time.RFC3339, text); err == nil {
+			return value, ""
+		}
+		if value, err := time.Parse(time.DateOnly, text); err == nil {
+			return value, ""
+		}
+		return nil, "must be an RFC 3339 time or a YYYY-MM-DD date"
+	case Date:
+		value, err := time.Parse(time.DateOnly, text)
+		if err != nil {
+			return nil, "must be a YYYY-MM-DD date"
+		}
+		return value, ""
+	default:
+		return text, ""
+	}
+}
+
+// parseSort parses a comma-separated list of sortable fields
+func (s *Schema) parseSort(text string) ([]Sort, string) {
+	var sorts []Sort
+	seen := map[string]bool{}
+	for _, name := range strings.Split(text, ",") {
+		name = strings.TrimSpace(name)
+		descending := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		if field, ok := s.Fields[name]; !ok || !field.Sortable {
+			return nil, fmt.Sprintf("cannot sort by %q", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			sorts = append(sorts, Sort{Field: name, Descending: descending})
+		}
+	}
+	return sorts, ""
+}
+
+// Where adds the query's conditions to a statement
+func (q *Query) Where(db *gorm.DB) *gorm.DB {
+	if q == nil {
+		return db
+	}
+	for _, condition := range q.Conditions {
+		db = db.Where(q.expression(condition))
+	}
+	return db
+}
+
+// Order adds the query's sorts to a statement
+func (q *Query) Order(db *gorm.DB) *gorm.DB {
+	columns := q.Columns()
+	if len(columns) == 0 {
+		return db
+	}
+	return db.Order(clause.OrderBy{Columns: columns})
+}
+
+// Columns returns the ORDER BY columns of the query's sorts, for endpoints
+// mixing them with orders of their own
+func (q *Query) Columns() []clause.OrderByColumn {
+	if q == nil || len(q.Sorts) == 0 {
+		return nil
+	}
+	columns := make([]clause.OrderByColumn, len(q.Sorts))
+	for i, sort := range q.Sorts {
+		columns[i] = clause.OrderByColumn{
+			Column: clause.Column{Name: q.schema.Fields[sort.Field].Column, Raw: true},
+			Desc:   sort.Descending,
+		}
+	}
+	return columns
+}
+
+// expression translates a condition into SQL on the field's column
+func (q *Query) expression(condition Condition) clause.Expression {
+	field := q.schema.Fields[condition.Field]
+	column := field.Column
+
+	var expr clause.Expr
+	switch condition.Operator {
+	case OpNull:
+		if null, _ := condition.Value.(bool); null {
+			expr = clause.Expr{SQL: column + " IS NULL"}
+		} else {
+			expr = clause.Expr{SQL: column + " IS NOT NULL"}
+		}
+	case OpLike:
+		text, _ := condition.Value.(string)
+		expr = clause.Expr{
+			SQL:  "LOWER(" + column + `) LIKE ? ESCAPE '\'`,
+			Vars: []interface{}{"%" + escapeLike(strings.ToLower(text)) + "%"},
+		}
+	case OpIn:
+		expr = clause.Expr{SQL: column + " IN ?", Vars: []interface{}{condition.Value}}
+	default:
+		expr = clause.Expr{SQL: column + " " + comparisons[condition.Operator] + " ?", Vars: []interface{}{condition.Value}}
+	}
+
+	if field.Through != "" {
+		expr.SQL = "EXISTS (" + field.Through + " AND " + expr.SQL + ")"
+	}
+	return expr
+}
+
+// escapeLike escapes the LIKE wildcards in a value, to be used with ESCAPE '\'
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
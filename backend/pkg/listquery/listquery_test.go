@@ -0,0 +1,258 @@
+package listquery
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// deals is the schema of the tests, with a field of related records
+var deals = &Schema{Fields: map[string]Field{
+	"title":      {Column: "deals.title", Type: String, Sortable: true},
+	"amount":     {Column: "deals.amount", Type: Number, Sortable: true},
+	"stage_id":   {Column: "deals.stage_id", Type: Int},
+	"won":        {Column: "deals.won", Type: Bool},
+	"created_at": {Column: "deals.created_at", Type: Time, Sortable: true},
+	"close_date": {Column: "deals.close_date", Type: Date},
+	"company.name": {Column: "companies.name", Type: String,
+		Through: "SELECT 1 FROM companies WHERE companies.id = deals.company_id"},
+}}
+
+func TestSplitFilter(t *testing.T) {
+	tests := []struct {
+		rest     string
+		name, op string
+	}{
+		{"amount]", "amount", OpEqual},
+		{"amount][gte]", "amount", OpGreaterOrEqual},
+		{"company.name][like]", "company.name", OpLike},
+	}
+	for _, tt := range tests {
+		name, op, err := splitFilter(tt.rest)
+		if name != tt.name || op != tt.op || err != "" {
+			t.Errorf("splitFilter(%q) = %q, %q, %q, want %q, %q", tt.rest, name, op, err, tt.name, tt.op)
+		}
+	}
+
+	for _, rest := range []string{"", "]", "][gte]", "amount", "amount[gte]", "amount][", "amount][]", "amount]gte", "amount][gte", "amount]x[gte]", "amount][gte]x", "amount][gte][lt]"} {
+		if name, op, err := splitFilter(rest); err != "malformed filter" {
+			t.Errorf("splitFilter(%q) = %q, %q, %q, want a malformed filter", rest, name, op, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	values, _ := url.ParseQuery("filter[title]=Renewal&filter[amount][gte]=1000.5&filter[stage_id][in]=1, 2&" +
+		"filter[won][ne]=true&filter[created_at][lt]=2026-10-17T12:00:00Z&filter[close_date][gte]=2026-01-31&" +
+		"filter[created_at][gte]=2026-10-01&filter[company.name][null]=false&sort=-amount,title,-amount&page=2&q=acme")
+	query, err := deals.Parse(values)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	wantConditions := []Condition{
+		{Field: "amount", Operator: OpGreaterOrEqual, Value: 1000.5},
+		{Field: "close_date", Operator: OpGreaterOrEqual, Value: time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{Field: "company.name", Operator: OpNull, Value: false},
+		{Field: "stage_id", Operator: OpIn, Value: []interface{}{int64(1), int64(2)}},
+		{Field: "title", Operator: OpEqual, Value: "Renewal"},
+		{Field: "won", Operator: OpNotEqual, Value: true},
+	}
+	var conditions []Condition
+	var times []Condition
+	for _, condition := range query.Conditions {
+		if condition.Field == "created_at" {
+			times = append(times, condition)
+		} else {
+			conditions = append(conditions, condition)
+		}
+	}
+	if !reflect.DeepEqual(conditions, wantConditions) {
+		t.Errorf("conditions = %+v, want %+v", conditions, wantConditions)
+	}
+	// times are RFC 3339 times or dates meaning midnight UTC
+	wantTimes := map[string]time.Time{
+		OpLess:           time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+		OpGreaterOrEqual: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if len(times) != 2 {
+		t.Fatalf("created_at conditions = %+v, want 2", times)
+	}
+	for _, condition := range times {
+		if value, _ := condition.Value.(time.Time); !value.Equal(wantTimes[condition.Operator]) {
+			t.Errorf("created_at %s %v, want %v", condition.Operator, condition.Value, wantTimes[condition.Operator])
+		}
+	}
+
+	// repeated fields are sorted by once
+	wantSorts := []Sort{{Field: "amount", Descending: true}, {Field: "title"}}
+	if !reflect.DeepEqual(query.Sorts, wantSorts) {
+		t.Errorf("sorts = %+v, want %+v", query.Sorts, wantSorts)
+	}
+
+	// an empty sort leaves the order to the endpoint
+	query, err = deals.Parse(url.Values{"sort": {""}})
+	if err != nil || len(query.Sorts) != 0 || len(query.Conditions) != 0 {
+		t.Errorf("Parse of an empty sort = %+v, %v", query, err)
+	}
+}
+
+func TestParseRejectsInvalidParameters(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		fields map[string]string
+	}{
+		{"malformed filter", "filter[amount][gte=1", map[string]string{"filter[amount][gte": "malformed filter"}},
+		{"unclosed filter", "filter[amount=1", map[string]string{"filter[amount": "malformed filter"}},
+		{"operator without a field", "filter[][gte]=1", map[string]string{"filter[][gte]": "malformed filter"}},
+		{"nested operators", "filter[amount][gte][lt]=1", map[string]string{"filter[amount][gte][lt]": "malformed filter"}},
+		{"unknown field", "filter[password]=x", map[string]string{"filter[password]": `unknown field "password"`}},
+		{"unknown field of a related record", "filter[company.domain][like]=x", map[string]string{"filter[company.domain][like]": `unknown field "company.domain"`}},
+		{"unknown operator", "filter[amount][between]=1", map[string]string{"filter[amount][between]": `unknown operator "between"`}},
+		{"range on text", "filter[title][gt]=a", map[string]string{"filter[title][gt]": "gt only applies to numbers and times"}},
+		{"range on a boolean", "filter[won][lte]=true", map[string]string{"filter[won][lte]": "lte only applies to numbers and times"}},
+		{"like on a number", "filter[amount][like]=1", map[string]string{"filter[amount][like]": "like only applies to text"}},
+		{"empty like", "filter[title][like]=", map[string]string{"filter[title][like]": "must not be empty"}},
+		{"null without a boolean", "filter[title][null]=yes", map[string]string{"filter[title][null]": "must be true or false"}},
+		{"whole number", "filter[stage_id]=1.5", map[string]string{"filter[stage_id]": "must be a whole number"}},
+		{"number", "filter[amount][lt]=lots", map[string]string{"filter[amount][lt]": "must be a number"}},
+		{"boolean", "filter[won]=yes", map[string]string{"filter[won]": "must be true or false"}},
+		{"time", "filter[created_at][gt]=yesterday", map[string]string{"filter[created_at][gt]": "must be an RFC 3339 time or a YYYY-MM-DD date"}},
+		{"date", "filter[close_date]=2026-10-17T12:00:00Z", map[string]string{"filter[close_date]": "must be a YYYY-MM-DD date"}},
+		{"invalid value in a list", "filter[stage_id][in]=1,two", map[string]string{"filter[stage_id][in]": "must be a whole number"}},
+		{"invalid repeated value", "filter[amount][gte]=1&filter[amount][gte]=x", map[string]string{"filter[amount][gte]": "must be a number"}},
+		{"unknown sort", "sort=password", map[string]string{"sort": `cannot sort by "password"`}},
+		{"unsortable field", "sort=title,-stage_id", map[string]string{"sort": `cannot sort by "stage_id"`}},
+		{"sort by a related record", "sort=company.name", map[string]string{"sort": `cannot sort by "company.name"`}},
+		{"every invalid parameter", "filter[won]=yes&filter[title]=ok&filter[size]=large&sort=-size", map[string]string{
+			"filter[won]":  "must be true or false",
+			"filter[size]": `unknown field "size"`,
+			"sort":         `cannot sort by "size"`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery: %v", err)
+			}
+			query, err := deals.Parse(values)
+			invalid, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("Parse = %+v, %v, want an *Error", query, err)
+			}
+			if !reflect.DeepEqual(invalid.Fields, tt.fields) {
+				t.Errorf("fields = %v, want %v", invalid.Fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestParseLimitsInValues(t *testing.T) {
+	ids := strings.TrimSuffix(strings.Repeat("7,", maxInValues), ",")
+	query, err := deals.Parse(url.Values{"filter[stage_id][in]": {ids}})
+	if err != nil {
+		t.Fatalf("Parse of %d values: %v", maxInValues, err)
+	}
+	if values := query.Conditions[0].Value.([]interface{}); len(values) != maxInValues {
+		t.Errorf("parsed %d values, want %d", len(values), maxInValues)
+	}
+
+	_, err = deals.Parse(url.Values{"filter[stage_id][in]": {ids + ",8"}})
+	want := map[string]string{"filter[stage_id][in]": "must have at most 100 values"}
+	if invalid, ok := err.(*Error); !ok || !reflect.DeepEqual(invalid.Fields, want) {
+		t.Errorf("Parse of %d values = %v, want %v", maxInValues+1, err, want)
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &Error{Fields: map[string]string{"sort": "cannot sort by \"x\"", "filter[a]": "must be a number"}}
+	if want := `invalid query: filter[a]: must be a number; sort: cannot sort by "x"`; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+// dryRun returns a database building statements without running them
+func dryRun(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("open dry-run database: %v", err)
+	}
+	return db
+}
+
+func TestQuerySQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		sql   string
+		vars  []interface{}
+	}{
+		{"no parameters", "",
+			`SELECT * FROM "deals"`, nil},
+		{"comparisons", "filter[amount][gt]=10&filter[title][ne]=Renewal&filter[won]=false",
+			`SELECT * FROM "deals" WHERE deals.amount > $1 AND deals.title <> $2 AND deals.won = $3`,
+			[]interface{}{10.0, "Renewal", false}},
+		{"in", "filter[stage_id][in]=3,4",
+			`SELECT * FROM "deals" WHERE deals.stage_id IN ($1,$2)`, []interface{}{int64(3), int64(4)}},
+		{"null", "filter[close_date][null]=true&filter[title][null]=false",
+			`SELECT * FROM "deals" WHERE deals.close_date IS NULL AND deals.title IS NOT NULL`, nil},
+		{"like escapes its wildcards", "filter[title][like]=50%25_Off%5CDeal",
+			`SELECT * FROM "deals" WHERE LOWER(deals.title) LIKE $1 ESCAPE '\'`, []interface{}{`%50\%\_off\\deal%`}},
+		{"related records", "filter[company.name][like]=acme&filter[company.name][ne]=Acme Ltd",
+			`SELECT * FROM "deals" WHERE (EXISTS (SELECT 1 FROM companies WHERE companies.id = deals.company_id AND LOWER(companies.name) LIKE $1 ESCAPE '\')) ` +
+				`AND (EXISTS (SELECT 1 FROM companies WHERE companies.id = deals.company_id AND companies.name <> $2))`,
+			[]interface{}{"%acme%", "Acme Ltd"}},
+		{"sorts", "sort=-created_at,title",
+			`SELECT * FROM "deals" ORDER BY deals.created_at DESC,deals.title`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery: %v", err)
+			}
+			query, err := deals.Parse(values)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			var rows []map[string]interface{}
+			statement := query.Order(query.Where(dryRun(t).Table("deals"))).Find(&rows).Statement
+			if sql := statement.SQL.String(); sql != tt.sql {
+				t.Errorf("sql = %s, want %s", sql, tt.sql)
+			}
+			if len(statement.Vars) != len(tt.vars) || len(tt.vars) > 0 && !reflect.DeepEqual(statement.Vars, tt.vars) {
+				t.Errorf("vars = %#v, want %#v", statement.Vars, tt.vars)
+			}
+		})
+	}
+
+	// a nil query changes nothing
+	var query *Query
+	var rows []map[string]interface{}
+	if sql := query.Order(query.Where(dryRun(t).Table("deals"))).Find(&rows).Statement.SQL.String(); sql != `SELECT * FROM "deals"` {
+		t.Errorf("sql of a nil query = %s", sql)
+	}
+}
+
+func TestSorted(t *testing.T) {
+	query := deals.Sorted(Sort{Field: "amount", Descending: true})
+	var rows []map[string]interface{}
+	if sql := query.Order(query.Where(dryRun(t).Table("deals"))).Find(&rows).Statement.SQL.String(); sql != `SELECT * FROM "deals" ORDER BY deals.amount DESC` {
+		t.Errorf("sql = %s", sql)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Sorted by a field that is not sortable did not panic")
+		}
+	}()
+	deals.Sorted(Sort{Field: "stage_id"})
+}
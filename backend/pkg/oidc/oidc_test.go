@@ -0,0 +1,159 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vilaphongdouangmala/lightweight-crm/backend/pkg/oidc/oidctest"
+)
+
+func newMockProvider(t *testing.T) (*oidctest.Provider, Config) {
+	t.Helper()
+	mock := oidctest.NewProvider(t)
+	return mock, Config{
+		Issuer:       mock.Issuer(),
+		ClientID:     oidctest.ClientID,
+		ClientSecret: oidctest.ClientSecret,
+		RedirectURL:  oidctest.RedirectURL,
+		Scopes:       []string{"email", "profile"},
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	mock, config := newMockProvider(t)
+	mock.Claims = jwt.MapClaims{"groups": []string{"crm-admins", "staff"}, "name": "Jane Doe"}
+	provider := NewProvider(config)
+	ctx := context.Background()
+
+	verifier, err := GenerateVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, _ := url.Parse(authURL)
+	if got := parsed.Query().Get("scope"); got != "openid email profile" {
+		t.Errorf("scope = %q", got)
+	}
+	if got := parsed.Query().Get("code_challenge"); got != CodeChallenge(verifier) || got == verifier {
+		t.Errorf("code_challenge = %q", got)
+	}
+
+	code, state := mock.Login(t, authURL)
+	if state != "state-1" {
+		t.Errorf("state = %q", state)
+	}
+
+	token, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err := provider.VerifyIDToken(ctx, token.IDToken, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if idToken.Subject != "user-123" || idToken.Email != "jane@example.com" || !idToken.EmailVerified || idToken.Name != "Jane Doe" {
+		t.Errorf("unexpected claims %+v", idToken)
+	}
+	if groups := idToken.Strings("groups"); len(groups) != 2 || groups[0] != "crm-admins" {
+		t.Errorf("groups = %v", groups)
+	}
+}
+
+func TestExchangeRequiresMatchingVerifier(t *testing.T) {
+	mock, config := newMockProvider(t)
+	provider := NewProvider(config)
+	ctx := context.Background()
+
+	verifier, _ := GenerateVerifier()
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := mock.Login(t, authURL)
+
+	other, _ := GenerateVerifier()
+	if _, err := provider.Exchange(ctx, code, other); err == nil {
+		t.Fatal("expected exchange with a different verifier to fail")
+	}
+}
+
+func TestVerifyIDTokenRejectsInvalidTokens(t *testing.T) {
+	mock, config := newMockProvider(t)
+	provider := NewProvider(config)
+	ctx := context.Background()
+
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": mock.Issuer(), "aud": oidctest.ClientID, "sub": "x", "nonce": "n",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(oidctest.ClientSecret))
+
+	forged := oidctest.NewProvider(t)
+	forged.KID = mock.KID
+
+	tests := []struct {
+		name  string
+		token string
+		nonce string
+		want  error
+	}{
+		{"wrong nonce", mock.IDToken(jwt.MapClaims{"nonce": "n"}), "other", ErrNonceMismatch},
+		{"missing nonce", mock.IDToken(nil), "n", ErrNonceMismatch},
+		{"wrong audience", mock.IDToken(jwt.MapClaims{"nonce": "n", "aud": "someone-else"}), "n", ErrInvalidIDToken},
+		{"wrong issuer", mock.IDToken(jwt.MapClaims{"nonce": "n", "iss": "https://evil.example"}), "n", ErrInvalidIDToken},
+		{"expired", mock.IDToken(jwt.MapClaims{"nonce": "n", "exp": time.Now().Add(-time.Hour).Unix()}), "n", ErrInvalidIDToken},
+		{"missing subject", mock.IDToken(jwt.MapClaims{"nonce": "n", "sub": ""}), "n", ErrInvalidIDToken},
+		{"signed with the client secret", hmacToken, "n", ErrInvalidIDToken},
+		{"signed with another key", forged.IDToken(jwt.MapClaims{"nonce": "n", "iss": mock.Issuer()}), "n", ErrInvalidIDToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(ctx, tt.token, tt.nonce)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenFetchesRotatedKeys(t *testing.T) {
+	mock, config := newMockProvider(t)
+	provider := NewProvider(config)
+	ctx := context.Background()
+
+	if _, err := provider.VerifyIDToken(ctx, mock.IDToken(jwt.MapClaims{"nonce": "n"}), "n"); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.Key = oidctest.GenerateKey(t)
+	mock.KID = "key-2"
+	rotated := mock.IDToken(jwt.MapClaims{"nonce": "n"})
+
+	// keys are not fetched again right away
+	if _, err := provider.VerifyIDToken(ctx, rotated, "n"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidIDToken)
+	}
+
+	provider.keysFetchedAt = time.Now().Add(-keyRefreshInterval)
+	if _, err := provider.VerifyIDToken(ctx, rotated, "n"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiscoveryRejectsMismatchedIssuer(t *testing.T) {
+	mock, config := newMockProvider(t)
+	config.Issuer = strings.Replace(mock.Issuer(), "127.0.0.1", "localhost", 1)
+
+	if _, err := NewProvider(config).Discover(context.Background()); err == nil {
+		t.Fatal("expected discovery to fail")
+	}
+}
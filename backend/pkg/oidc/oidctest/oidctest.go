@@ -0,0 +1,196 @@
+// Package oidctest provides a mock OpenID provider for tests of relying
+// parties. It issues codes without asking anyone to sign in and signs ID
+// tokens with a key of its own.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The client registered with every mock provider
+const (
+	ClientID     = "crm"
+	ClientSecret = "s3cret"
+	RedirectURL  = "http://localhost:3000/sso/callback"
+)
+
+// Provider is a minimal OpenID provider. Its ID tokens are for the subject
+// "user-123" with the verified email jane@example.com unless Claims says
+// otherwise.
+type Provider struct {
+	Key    *rsa.PrivateKey
+	KID    string
+	Claims jwt.MapClaims // extra claims put into every ID token
+
+	t      *testing.T
+	server *httptest.Server
+
+	mu    sync.Mutex
+	codes map[string]url.Values // authorization request by code
+}
+
+// NewProvider starts a provider that is stopped when the test ends
+func NewProvider(t *testing.T) *Provider {
+	t.Helper()
+	p := &Provider{t: t, codes: make(map[string]url.Values), KID: "key-1"}
+	p.Key = GenerateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": p.KID,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(p.Key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.Key.E)).Bytes()),
+		}}})
+	})
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// Issuer returns the issuer URL of the provider
+func (p *Provider) Issuer() string {
+	return p.server.URL
+}
+
+// authorize redirects straight back to the client with a code
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != ClientID || query.Get("redirect_uri") != RedirectURL {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+
+	code := "code-" + query.Get("state")
+	p.mu.Lock()
+	p.codes[code] = query
+	p.mu.Unlock()
+
+	redirect := RedirectURL + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// token exchanges a code for an ID token, checking the client and the PKCE verifier
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, _ := r.BasicAuth()
+	if clientID != ClientID || secret != ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	request, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	p.mu.Unlock()
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if request.Get("code_challenge_method") != "S256" ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != request.Get("code_challenge") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     p.IDToken(jwt.MapClaims{"nonce": request.Get("nonce")}),
+	})
+}
+
+// IDToken signs an ID token with the provider key. The given claims take
+// precedence over Claims and the defaults.
+func (p *Provider) IDToken(claims jwt.MapClaims) string {
+	now := time.Now()
+	all := jwt.MapClaims{
+		"iss":            p.server.URL,
+		"aud":            ClientID,
+		"sub":            "user-123",
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+	for k, v := range p.Claims {
+		all[k] = v
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, all)
+	token.Header["kid"] = p.KID
+	signed, err := token.SignedString(p.Key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return signed
+}
+
+// Login runs the browser part of the flow and returns the code and state
+// the provider redirected back with
+func (p *Provider) Login(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+// GenerateKey returns a new RSA signing key
+func GenerateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,379 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid filter")
+	ErrInvalidPath   = errors.New("invalid path")
+)
+
+// Comparison operators of attribute expressions
+const (
+	OpEqual          = "eq"
+	OpNotEqual       = "ne"
+	OpContains       = "co"
+	OpStartsWith     = "sw"
+	OpEndsWith       = "ew"
+	OpPresent        = "pr"
+	OpGreaterThan    = "gt"
+	OpGreaterOrEqual = "ge"
+	OpLessThan       = "lt"
+	OpLessOrEqual    = "le"
+)
+
+var comparisonOperators = map[string]bool{
+	OpEqual: true, OpNotEqual: true, OpContains: true, OpStartsWith: true, OpEndsWith: true,
+	OpGreaterThan: true, OpGreaterOrEqual: true, OpLessThan: true, OpLessOrEqual: true,
+}
+
+// Filter is a parsed filter expression: an *AttributeExpression, a
+// *LogicalExpression or a *NotExpression
+type Filter interface {
+	filter()
+}
+
+// AttributeExpression compares an attribute with a value. Attribute is the
+// attribute path as written, without a schema URN prefix; sub-attributes are
+// joined with a dot ("emails.value"). Value is a string, float64, bool or
+// nil, and is nil for the "pr" operator.
+type AttributeExpression struct {
+	Attribute string
+	Operator  string
+	Value     interface{}
+}
+
+// LogicalExpression combines two filters with "and" or "or"
+type LogicalExpression struct {
+	Operator string
+	Left     Filter
+	Right    Filter
+}
+
+// NotExpression negates a filter
+type NotExpression struct {
+	Filter Filter
+}
+
+func (*AttributeExpression) filter() {}
+func (*LogicalExpression) filter()   {}
+func (*NotExpression) filter()       {}
+
+// Path is a parsed PATCH path such as `active`, `name.givenName` or
+// `members[value eq "2"]`. Filter is nil when the path has no value filter;
+// its attributes are relative to Attribute.
+type Path struct {
+	Attribute    string
+	SubAttribute string
+	Filter       Filter
+}
+
+// ParseFilter parses a filter as defined in RFC 7644 section 3.4.2.2.
+// Operators and attribute names are case-insensitive; operators are returned
+// in lower case. Value paths such as `emails[type eq "work"]` are expanded
+// into expressions on the sub-attributes.
+func ParseFilter(input string) (Filter, error) {
+	p, err := newParser(input, ErrInvalidFilter)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	return filter, nil
+}
+
+// ParsePath parses the path of a PATCH operation as defined in RFC 7644
+// section 3.5.2
+func ParsePath(input string) (*Path, error) {
+	p, err := newParser(input, ErrInvalidPath)
+	if err != nil {
+		return nil, err
+	}
+	if p.done() {
+		return nil, p.errorf("empty path")
+	}
+
+	attribute := p.next()
+	if attribute.kind != tokenWord {
+		return nil, p.errorf("expected an attribute, got %q", attribute.text)
+	}
+	path := &Path{Attribute: attributeName(attribute.text)}
+	if i := strings.Index(path.Attribute, "."); i >= 0 {
+		path.Attribute, path.SubAttribute = path.Attribute[:i], path.Attribute[i+1:]
+	}
+
+	if !p.done() && p.peek().kind == tokenOpenBracket {
+		if path.SubAttribute != "" {
+			return nil, p.errorf("unexpected %q", "[")
+		}
+		p.next()
+		if path.Filter, err = p.parseOr(""); err != nil {
+			return nil, err
+		}
+		if token := p.next(); token.kind != tokenCloseBracket {
+			return nil, p.errorf("expected %q", "]")
+		}
+		// a sub-attribute may follow the filter: emails[type eq "work"].value
+		if !p.done() && p.peek().kind == tokenWord && strings.HasPrefix(p.peek().text, ".") {
+			path.SubAttribute = strings.TrimPrefix(p.next().text, ".")
+		}
+	}
+
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	return path, nil
+}
+
+// attributeName strips the schema URN a fully qualified attribute starts with
+func attributeName(name string) string {
+	if strings.HasPrefix(strings.ToLower(name), "urn:") {
+		if i := strings.LastIndex(name, ":"); i >= 0 {
+			return name[i+1:]
+		}
+	}
+	return name
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOpenParen
+	tokenCloseParen
+	tokenOpenBracket
+	tokenCloseBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// parser is a recursive descent parser over the tokens of a filter or path
+type parser struct {
+	input  string
+	tokens []token
+	pos    int
+	err    error // returned for every syntax error
+}
+
+func newParser(input string, err error) (*parser, error) {
+	p := &parser{input: input, err: err}
+	tokens, tokenizeErr := p.tokenize(input)
+	if tokenizeErr != nil {
+		return nil, tokenizeErr
+	}
+	p.tokens = tokens
+	return p, nil
+}
+
+func (p *parser) tokenize(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		switch c := input[i]; c {
+		case ' ', '\t', '\n', '\r':
+			i++
+		case '(':
+			tokens = append(tokens, token{tokenOpenParen, "("})
+			i++
+		case ')':
+			tokens = append(tokens, token{tokenCloseParen, ")"})
+			i++
+		case '[':
+			tokens = append(tokens, token{tokenOpenBracket, "["})
+			i++
+		case ']':
+			tokens = append(tokens, token{tokenCloseBracket, "]"})
+			i++
+		case '"':
+			end := i + 1
+			for ; end < len(input) && input[end] != '"'; end++ {
+				if input[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(input) {
+				return nil, p.errorf("unterminated string")
+			}
+			var value string
+			if err := json.Unmarshal([]byte(input[i:end+1]), &value); err != nil {
+				return nil, p.errorf("invalid string %s", input[i:end+1])
+			}
+			tokens = append(tokens, token{tokenString, value})
+			i = end + 1
+		default:
+			end := i
+			for ; end < len(input) && !strings.ContainsRune(" \t\n\r()[]\"", rune(input[end])); end++ {
+			}
+			tokens = append(tokens, token{tokenWord, input[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{kind: -1, text: "end of input"}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+// keyword reports whether the next token is the keyword and consumes it
+func (p *parser) keyword(keyword string) bool {
+	if token := p.peek(); token.kind == tokenWord && strings.EqualFold(token.text, keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", p.err, fmt.Sprintf(format, args...))
+}
+
+// parseOr parses filters joined with "or". prefix is the attribute of the
+// value path being parsed, if any.
+func (p *parser) parseOr(prefix string) (Filter, error) {
+	left, err := p.parseAnd(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = &LogicalExpression{Operator: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses filters joined with "and", which binds tighter than "or"
+func (p *parser) parseAnd(prefix string) (Filter, error) {
+	left, err := p.parseUnary(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = &LogicalExpression{Operator: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses a negation, a parenthesized filter, a value path or an
+// attribute expression
+func (p *parser) parseUnary(prefix string) (Filter, error) {
+	if p.keyword("not") {
+		if p.peek().kind != tokenOpenParen {
+			return nil, p.errorf("expected %q after not", "(")
+		}
+		filter, err := p.parseUnary(prefix)
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpression{Filter: filter}, nil
+	}
+
+	if p.peek().kind == tokenOpenParen {
+		p.next()
+		filter, err := p.parseOr(prefix)
+		if err != nil {
+			return nil, err
+		}
+		if token := p.next(); token.kind != tokenCloseParen {
+			return nil, p.errorf("expected %q", ")")
+		}
+		return filter, nil
+	}
+
+	attribute := p.next()
+	if attribute.kind != tokenWord {
+		return nil, p.errorf("expected an attribute, got %q", attribute.text)
+	}
+	name := attributeName(attribute.text)
+	if prefix != "" {
+		name = prefix + "." + name
+	}
+
+	if p.peek().kind == tokenOpenBracket {
+		if prefix != "" {
+			return nil, p.errorf("nested value paths are not supported")
+		}
+		p.next()
+		filter, err := p.parseOr(name)
+		if err != nil {
+			return nil, err
+		}
+		if token := p.next(); token.kind != tokenCloseBracket {
+			return nil, p.errorf("expected %q", "]")
+		}
+		return filter, nil
+	}
+
+	operator := p.next()
+	if operator.kind != tokenWord {
+		return nil, p.errorf("expected an operator after %q", attribute.text)
+	}
+	op := strings.ToLower(operator.text)
+	if op == OpPresent {
+		return &AttributeExpression{Attribute: name, Operator: op}, nil
+	}
+	if !comparisonOperators[op] {
+		return nil, p.errorf("unknown operator %q", operator.text)
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return &AttributeExpression{Attribute: name, Operator: op, Value: value}, nil
+}
+
+// parseValue parses a comparison value: a string, number, boolean or null
+func (p *parser) parseValue() (interface{}, error) {
+	token := p.next()
+	switch token.kind {
+	case tokenString:
+		return token.text, nil
+	case tokenWord:
+		switch strings.ToLower(token.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		if number, err := strconv.ParseFloat(token.text, 64); err == nil {
+			return number, nil
+		}
+	}
+	return nil, p.errorf("invalid value %q", token.text)
+}
@@ -0,0 +1,173 @@
+package scim
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func attr(attribute, operator string, value interface{}) *AttributeExpression {
+	return &AttributeExpression{Attribute: attribute, Operator: operator, Value: value}
+}
+
+func and(left, right Filter) *LogicalExpression {
+	return &LogicalExpression{Operator: "and", Left: left, Right: right}
+}
+
+func or(left, right Filter) *LogicalExpression {
+	return &LogicalExpression{Operator: "or", Left: left, Right: right}
+}
+
+func not(filter Filter) *NotExpression {
+	return &NotExpression{Filter: filter}
+}
+
+func TestParseFilter(t *testing.T) {
+	a, b, c := attr("a", OpEqual, "1"), attr("b", OpEqual, "2"), attr("c", OpEqual, "3")
+
+	tests := []struct {
+		name   string
+		input  string
+		filter Filter
+	}{
+		{"eq", `userName eq "bjensen"`, attr("userName", OpEqual, "bjensen")},
+		{"co", `name.familyName co "O'Malley"`, attr("name.familyName", OpContains, "O'Malley")},
+		{"sw", `userName sw "J"`, attr("userName", OpStartsWith, "J")},
+		{"pr", `title pr`, attr("title", OpPresent, nil)},
+		{"operator in upper case", `userName EQ "bjensen"`, attr("userName", OpEqual, "bjensen")},
+		{"schema URN prefix", `urn:ietf:params:scim:schemas:core:2.0:User:userName sw "J"`, attr("userName", OpStartsWith, "J")},
+		{"timestamp", `meta.lastModified gt "2011-05-13T04:42:34Z"`, attr("meta.lastModified", OpGreaterThan, "2011-05-13T04:42:34Z")},
+		{"boolean", `active eq true`, attr("active", OpEqual, true)},
+		{"number", `id eq 5`, attr("id", OpEqual, float64(5))},
+		{"null", `externalId eq null`, attr("externalId", OpEqual, nil)},
+
+		{"and binds tighter than or", `a eq "1" or b eq "2" and c eq "3"`, or(a, and(b, c))},
+		{"and binds tighter than a trailing or", `a eq "1" and b eq "2" or c eq "3"`, or(and(a, b), c)},
+		{"parentheses", `(a eq "1" or b eq "2") and c eq "3"`, and(or(a, b), c)},
+		{"left associative", `a eq "1" and b eq "2" and c eq "3"`, and(and(a, b), c)},
+		{"keywords in upper case", `a eq "1" AND b eq "2" OR c eq "3"`, or(and(a, b), c)},
+		{"not binds tighter than and", `not (a eq "1") and b eq "2"`, and(not(a), b)},
+		{"not of a group", `not (a eq "1" or b eq "2")`, not(or(a, b))},
+
+		{"escaped quotes", `displayName eq "say \"hi\""`, attr("displayName", OpEqual, `say "hi"`)},
+		{"escaped backslash and unicode", `displayName eq "a\\b é"`, attr("displayName", OpEqual, `a\b é`)},
+		{"syntax inside a string", `displayName eq "a) or (b eq ["`, attr("displayName", OpEqual, "a) or (b eq [")},
+
+		{"value path", `emails[type eq "work"]`, attr("emails.type", OpEqual, "work")},
+		{"value path with a logical expression", `emails[type eq "work" and value co "@example.com"]`,
+			and(attr("emails.type", OpEqual, "work"), attr("emails.value", OpContains, "@example.com"))},
+		{"value path joined with an expression", `emails[type eq "work"] or userName eq "x"`,
+			or(attr("emails.type", OpEqual, "work"), attr("userName", OpEqual, "x"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseFilter(tt.input)
+			if err != nil {
+				t.Fatalf("ParseFilter(%s): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(filter, tt.filter) {
+				t.Errorf("ParseFilter(%s) = %s, want %s", tt.input, describe(filter), describe(tt.filter))
+			}
+		})
+	}
+}
+
+func TestParseFilterRejectsMalformedFilters(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ``},
+		{"missing operator", `userName`},
+		{"missing value", `userName eq`},
+		{"unknown operator", `userName like "x"`},
+		{"bare word value", `userName eq bjensen`},
+		{"string attribute", `"userName" eq "x"`},
+		{"trailing tokens", `userName eq "x" "y"`},
+		{"dangling and", `userName eq "x" and`},
+		{"unterminated string", `userName eq "bjensen`},
+		{"string ending in an escape", `userName eq "bjensen\"`},
+		{"invalid escape", `userName eq "\x41"`},
+		{"unclosed parenthesis", `(userName eq "x"`},
+		{"unopened parenthesis", `userName eq "x")`},
+		{"not without parentheses", `not userName eq "x"`},
+		{"unclosed value path", `emails[type eq "work"`},
+		{"nested value path", `emails[type[value eq "1"] eq "2"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseFilter(tt.input)
+			if !errors.Is(err, ErrInvalidFilter) {
+				t.Errorf("ParseFilter(%s) = %s, %v, want %v", tt.input, describe(filter), err, ErrInvalidFilter)
+			}
+		})
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		path  *Path
+	}{
+		{"attribute", `active`, &Path{Attribute: "active"}},
+		{"sub-attribute", `name.givenName`, &Path{Attribute: "name", SubAttribute: "givenName"}},
+		{"schema URN prefix", `urn:ietf:params:scim:schemas:core:2.0:User:active`, &Path{Attribute: "active"}},
+		{"value filter", `members[value eq "2"]`, &Path{Attribute: "members", Filter: attr("value", OpEqual, "2")}},
+		{"value filter with a sub-attribute", `emails[type eq "work"].value`,
+			&Path{Attribute: "emails", SubAttribute: "value", Filter: attr("type", OpEqual, "work")}},
+		{"value filter with a logical expression", `members[value eq "2" or value eq "3"]`,
+			&Path{Attribute: "members", Filter: or(attr("value", OpEqual, "2"), attr("value", OpEqual, "3"))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := ParsePath(tt.input)
+			if err != nil {
+				t.Fatalf("ParsePath(%s): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(path, tt.path) {
+				t.Errorf("ParsePath(%s) = %+v, want %+v", tt.input, path, tt.path)
+			}
+		})
+	}
+}
+
+func TestParsePathRejectsMalformedPaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ``},
+		{"string", `"active"`},
+		{"trailing tokens", `active extra`},
+		{"filter after a sub-attribute", `name.givenName[value eq "x"]`},
+		{"unclosed value filter", `members[value eq "2"`},
+		{"malformed value filter", `members[value eq]`},
+		{"unterminated string", `members[value eq "2]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := ParsePath(tt.input)
+			if !errors.Is(err, ErrInvalidPath) {
+				t.Errorf("ParsePath(%s) = %+v, %v, want %v", tt.input, path, err, ErrInvalidPath)
+			}
+		})
+	}
+}
+
+// describe renders a filter for test failures
+func describe(filter Filter) string {
+	switch f := filter.(type) {
+	case *AttributeExpression:
+		if f.Operator == OpPresent {
+			return f.Attribute + " pr"
+		}
+		return fmt.Sprintf("%s %s %#v", f.Attribute, f.Operator, f.Value)
+	case *LogicalExpression:
+		return "(" + describe(f.Left) + " " + f.Operator + " " + describe(f.Right) + ")"
+	case *NotExpression:
+		return "not (" + describe(f.Filter) + ")"
+	}
+	return "<nil>"
+}
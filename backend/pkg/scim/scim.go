@@ -0,0 +1,144 @@
+// Package scim holds the protocol types of SCIM 2.0 (RFC 7643 and RFC 7644)
+// shared by the provisioning endpoints: schema URNs, list and error
+// responses, PATCH requests and the filter and path grammar.
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of SCIM requests and responses
+const ContentType = "application/scim+json"
+
+// Schema URNs
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+// Error types returned in the scimType of 400 and 409 responses
+const (
+	ErrorInvalidFilter = "invalidFilter"
+	ErrorInvalidPath   = "invalidPath"
+	ErrorInvalidValue  = "invalidValue"
+	ErrorInvalidSyntax = "invalidSyntax"
+	ErrorMutability    = "mutability"
+	ErrorNoTarget      = "noTarget"
+	ErrorUniqueness    = "uniqueness"
+)
+
+// Pagination defaults. Clients can ask for fewer resources per page, but not more.
+const (
+	DefaultCount = 100
+	MaxCount     = 200
+)
+
+// Error is a SCIM error response
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// NewError creates an error response with the HTTP status
+func NewError(status int, scimType, detail string) Error {
+	return Error{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+// ListResponse is a page of resources. StartIndex is 1-based.
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// NewListResponse creates a list response for a page of resources
+func NewListResponse(resources interface{}, itemsPerPage int, total int64, startIndex int) ListResponse {
+	return ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: itemsPerPage,
+		Resources:    resources,
+	}
+}
+
+// Meta is the resource metadata every resource carries
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+// PatchRequest is the body of a PATCH request
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations" binding:"required,min=1,dive"`
+}
+
+// PatchOperation is a single change of a PATCH request. Op is one of "add",
+// "remove" and "replace"; some clients capitalize it, so compare with
+// strings.EqualFold or use Operation.
+type PatchOperation struct {
+	Op    string          `json:"op" binding:"required"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Operation returns the lowercased operation name
+func (o PatchOperation) Operation() string {
+	return strings.ToLower(o.Op)
+}
+
+// Bool parses a boolean attribute value. Some clients send booleans as
+// the strings "True" and "False".
+func Bool(raw json.RawMessage) (bool, bool) {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return false, false
+	}
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		parsed, err := strconv.ParseBool(strings.ToLower(v))
+		return parsed, err == nil
+	default:
+		return false, false
+	}
+}
+
+// Pagination returns the 1-based start index and page size of a list
+// request from its startIndex and count parameters, applying the defaults.
+// Invalid values are treated as missing, as RFC 7644 asks.
+func Pagination(startIndex, count string) (int, int) {
+	start, err := strconv.Atoi(startIndex)
+	if err != nil || start < 1 {
+		start = 1
+	}
+	size, err := strconv.Atoi(count)
+	switch {
+	case err != nil:
+		size = DefaultCount
+	case size < 0:
+		size = 0
+	case size > MaxCount:
+		size = MaxCount
+	}
+	return start, size
+}
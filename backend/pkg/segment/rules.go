@@ -0,0 +1,274 @@
+// Package segment parses the rules that define saved segments of CRM records,
+// such as `tag = vip AND last_activity < 30d`.
+//
+// Rules are conditions comparing a field with a value, combined with "and",
+// "or", "not" and parentheses. Keywords are case-insensitive and "and" binds
+// tighter than "or". Values are bare words, or double-quoted strings when
+// they contain spaces or operators. The package only checks the syntax and
+// the size of rules; which fields, operators and values are valid is up to
+// the caller.
+package segment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidRules = errors.New("invalid segment rules")
+
+// Limits on the size of rules, bounding the queries they compile to
+const (
+	MaxLength     = 2000 // bytes of rules
+	MaxConditions = 50   // conditions in rules
+	MaxDepth      = 10   // nested parentheses and negations
+)
+
+// Comparison operators of conditions
+const (
+	OpEqual          = "="
+	OpNotEqual       = "!="
+	OpLess           = "<"
+	OpLessOrEqual    = "<="
+	OpGreater        = ">"
+	OpGreaterOrEqual = ">="
+)
+
+// Rule is a parsed rule: a *Condition, a *Logical or a *Not
+type Rule interface {
+	rule()
+}
+
+// Condition compares a field with a value, both as written
+type Condition struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// Logical combines two rules with "and" or "or"
+type Logical struct {
+	Operator string
+	Left     Rule
+	Right    Rule
+}
+
+// Not negates a rule
+type Not struct {
+	Rule Rule
+}
+
+func (*Condition) rule() {}
+func (*Logical) rule()   {}
+func (*Not) rule()       {}
+
+// Parse parses segment rules
+func Parse(input string) (Rule, error) {
+	if len(input) > MaxLength {
+		return nil, errorf("rules are longer than %d characters", MaxLength)
+	}
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.done() {
+		return nil, errorf("no rules")
+	}
+	rule, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, errorf("unexpected %q", p.peek().text)
+	}
+	return rule, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOperator
+	tokenOpenParen
+	tokenCloseParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// separators end a bare word
+const separators = " \t\n\r()\"!=<>"
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		switch c := input[i]; c {
+		case ' ', '\t', '\n', '\r':
+			i++
+		case '(':
+			tokens = append(tokens, token{tokenOpenParen, "("})
+			i++
+		case ')':
+			tokens = append(tokens, token{tokenCloseParen, ")"})
+			i++
+		case '=', '!', '<', '>':
+			end := i + 1
+			if end < len(input) && input[end] == '=' && c != '=' {
+				end++
+			}
+			operator := input[i:end]
+			if operator == "!" {
+				return nil, errorf("expected %q", OpNotEqual)
+			}
+			tokens = append(tokens, token{tokenOperator, operator})
+			i = end
+		case '"':
+			end := i + 1
+			for ; end < len(input) && input[end] != '"'; end++ {
+				if input[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(input) {
+				return nil, errorf("unterminated string")
+			}
+			var value string
+			if err := json.Unmarshal([]byte(input[i:end+1]), &value); err != nil {
+				return nil, errorf("invalid string %s", input[i:end+1])
+			}
+			tokens = append(tokens, token{tokenString, value})
+			i = end + 1
+		default:
+			end := i
+			for ; end < len(input) && !strings.ContainsRune(separators, rune(input[end])); end++ {
+			}
+			tokens = append(tokens, token{tokenWord, input[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// parser is a recursive descent parser over the tokens of rules
+type parser struct {
+	tokens     []token
+	pos        int
+	depth      int // of the negations and parentheses being parsed
+	conditions int // parsed so far
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{kind: -1, text: "end of rules"}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+// keyword reports whether the next token is the keyword and consumes it
+func (p *parser) keyword(keyword string) bool {
+	if token := p.peek(); token.kind == tokenWord && strings.EqualFold(token.text, keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRules, fmt.Sprintf(format, args...))
+}
+
+// parseOr parses rules joined with "or"
+func (p *parser) parseOr() (Rule, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Operator: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses rules joined with "and", which binds tighter than "or"
+func (p *parser) parseAnd() (Rule, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Operator: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses a negation, a parenthesized rule or a condition
+func (p *parser) parseUnary() (Rule, error) {
+	if p.keyword("not") {
+		rule, err := p.nest(p.parseUnary)
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Rule: rule}, nil
+	}
+
+	if p.peek().kind == tokenOpenParen {
+		p.next()
+		rule, err := p.nest(p.parseOr)
+		if err != nil {
+			return nil, err
+		}
+		if token := p.next(); token.kind != tokenCloseParen {
+			return nil, errorf("expected %q", ")")
+		}
+		return rule, nil
+	}
+
+	if p.conditions++; p.conditions > MaxConditions {
+		return nil, errorf("rules have more than %d conditions", MaxConditions)
+	}
+	field := p.next()
+	if field.kind != tokenWord {
+		return nil, errorf("expected a field, got %q", field.text)
+	}
+	operator := p.next()
+	if operator.kind != tokenOperator {
+		return nil, errorf("expected an operator after %q", field.text)
+	}
+	value := p.next()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, errorf("expected a value after %q %s", field.text, operator.text)
+	}
+	return &Condition{Field: strings.ToLower(field.text), Operator: operator.text, Value: value.text}, nil
+}
+
+// nest parses a rule nested in a negation or parentheses
+func (p *parser) nest(parse func() (Rule, error)) (Rule, error) {
+	if p.depth++; p.depth > MaxDepth {
+		return nil, errorf("rules are nested deeper than %d levels", MaxDepth)
+	}
+	defer func() { p.depth-- }()
+	return parse()
+}
@@ -0,0 +1,169 @@
+package segment
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func cond(field, operator, value string) *Condition {
+	return &Condition{Field: field, Operator: operator, Value: value}
+}
+
+func and(left, right Rule) *Logical {
+	return &Logical{Operator: "and", Left: left, Right: right}
+}
+
+func or(left, right Rule) *Logical {
+	return &Logical{Operator: "or", Left: left, Right: right}
+}
+
+func not(rule Rule) *Not {
+	return &Not{Rule: rule}
+}
+
+func TestParse(t *testing.T) {
+	a, b, c := cond("a", OpEqual, "1"), cond("b", OpEqual, "2"), cond("c", OpEqual, "3")
+
+	tests := []struct {
+		name  string
+		input string
+		rule  Rule
+	}{
+		{"equal", `tag = vip`, cond("tag", OpEqual, "vip")},
+		{"not equal", `tag != vip`, cond("tag", OpNotEqual, "vip")},
+		{"less", `last_activity < 30d`, cond("last_activity", OpLess, "30d")},
+		{"less or equal", `created_at <= 2w`, cond("created_at", OpLessOrEqual, "2w")},
+		{"greater", `updated_at > 12h`, cond("updated_at", OpGreater, "12h")},
+		{"greater or equal", `cf.score >= 7.5`, cond("cf.score", OpGreaterOrEqual, "7.5")},
+		{"no spaces around operators", `owner_id!=none`, cond("owner_id", OpNotEqual, "none")},
+		{"field names are case-insensitive", `TAG = VIP`, cond("tag", OpEqual, "VIP")},
+		{"custom field key", `cf.renewal_date <= 2026-12-31`, cond("cf.renewal_date", OpLessOrEqual, "2026-12-31")},
+
+		{"quoted value", `tag = "key account"`, cond("tag", OpEqual, "key account")},
+		{"escaped quotes", `cf.nickname = "the \"boss\""`, cond("cf.nickname", OpEqual, `the "boss"`)},
+		{"syntax inside a string", `tag = "a) or (b = c"`, cond("tag", OpEqual, "a) or (b = c")},
+		{"keyword as a quoted value", `tag = "and"`, cond("tag", OpEqual, "and")},
+
+		{"and binds tighter than or", `a = 1 or b = 2 and c = 3`, or(a, and(b, c))},
+		{"and binds tighter than a trailing or", `a = 1 and b = 2 or c = 3`, or(and(a, b), c)},
+		{"parentheses", `(a = 1 or b = 2) and c = 3`, and(or(a, b), c)},
+		{"left associative", `a = 1 and b = 2 and c = 3`, and(and(a, b), c)},
+		{"keywords in any case", `a = 1 AND b = 2 Or c = 3`, or(and(a, b), c)},
+		{"not binds tighter than and", `not a = 1 and b = 2`, and(not(a), b)},
+		{"not of a group", `not (a = 1 or b = 2)`, not(or(a, b))},
+		{"double negation", `not not a = 1`, not(not(a))},
+		{"redundant parentheses", `((a = 1))`, a},
+		{"line breaks", "a = 1\n\tand b = 2", and(a, b)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(rule, tt.rule) {
+				t.Errorf("Parse(%q) = %s, want %s", tt.input, describe(rule), describe(tt.rule))
+			}
+		})
+	}
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		message string
+	}{
+		{"empty", ``, "no rules"},
+		{"blank", "  \n", "no rules"},
+		{"lone bang", `tag ! vip`, `expected "!="`},
+		{"unknown operator", `tag ~ vip`, `expected an operator after "tag"`},
+		{"doubled operator", `tag == vip`, `expected a value after "tag" =`},
+		{"reversed operator", `created_at => 30d`, `expected a value after "created_at" =`},
+		{"missing operator", `tag`, `expected an operator after "tag"`},
+		{"missing value", `tag =`, `expected a value after "tag" =`},
+		{"missing field", `= vip`, `expected a field, got "="`},
+		{"quoted field", `"tag" = vip`, `expected a field, got "tag"`},
+		{"dangling and", `tag = vip and`, `expected a field, got "end of rules"`},
+		{"dangling not", `not`, `expected a field, got "end of rules"`},
+		{"unterminated string", `tag = "vip`, "unterminated string"},
+		{"unterminated escape", `tag = "vip\"`, "unterminated string"},
+		{"invalid escape", `tag = "v\ip"`, `invalid string "v\ip"`},
+		{"unclosed parenthesis", `(tag = vip`, `expected ")"`},
+		{"unopened parenthesis", `tag = vip)`, `unexpected ")"`},
+		{"empty parentheses", `()`, `expected a field, got ")"`},
+		{"missing keyword", `tag = vip owner_id = 1`, `unexpected "owner_id"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.input)
+			if !errors.Is(err, ErrInvalidRules) {
+				t.Fatalf("Parse(%q) = %s, %v, want %v", tt.input, describe(rule), err, ErrInvalidRules)
+			}
+			if want := ErrInvalidRules.Error() + ": " + tt.message; err.Error() != want {
+				t.Errorf("error = %q, want %q", err, want)
+			}
+		})
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	conditions := func(count int) string {
+		return strings.Repeat("tag = vip or ", count-1) + "tag = vip"
+	}
+	nested := func(depth int) string {
+		return strings.Repeat("(", depth) + "tag = vip" + strings.Repeat(")", depth)
+	}
+	negated := func(depth int) string {
+		return strings.Repeat("not ", depth) + "tag = vip"
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		message string // empty when the rules are within the limits
+	}{
+		{"longest rules", `tag = "` + strings.Repeat("a", MaxLength-8) + `"`, ""},
+		{"too long", `tag = "` + strings.Repeat("a", MaxLength-7) + `"`, "rules are longer than 2000 characters"},
+		{"most conditions", conditions(MaxConditions), ""},
+		{"too many conditions", conditions(MaxConditions + 1), "rules have more than 50 conditions"},
+		{"deepest parentheses", nested(MaxDepth), ""},
+		{"parentheses too deep", nested(MaxDepth + 1), "rules are nested deeper than 10 levels"},
+		{"deepest negations", negated(MaxDepth), ""},
+		{"negations too deep", negated(MaxDepth + 1), "rules are nested deeper than 10 levels"},
+		{"deepest negations and parentheses", strings.Repeat("not (", MaxDepth/2) + "tag = vip" + strings.Repeat(")", MaxDepth/2), ""},
+		{"negations and parentheses too deep", strings.Repeat("not (", MaxDepth/2) + "not tag = vip" + strings.Repeat(")", MaxDepth/2),
+			"rules are nested deeper than 10 levels"},
+		{"siblings do not add up", nested(MaxDepth) + " and " + nested(MaxDepth), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			if tt.message == "" {
+				if err != nil {
+					t.Errorf("Parse: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidRules) || err.Error() != ErrInvalidRules.Error()+": "+tt.message {
+				t.Errorf("Parse = %v, want %q", err, tt.message)
+			}
+		})
+	}
+}
+
+// describe formats a rule for test failures
+func describe(rule Rule) string {
+	switch r := rule.(type) {
+	case *Condition:
+		return r.Field + " " + r.Operator + " " + r.Value
+	case *Logical:
+		return "(" + describe(r.Left) + " " + r.Operator + " " + describe(r.Right) + ")"
+	case *Not:
+		return "not " + describe(r.Rule)
+	default:
+		return "<nil>"
+	}
+}
@@ -0,0 +1,147 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the ASCII secret "12345678901234567890" of the RFC 4226 and
+// RFC 6238 test vectors, base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeHOTPVectors(t *testing.T) {
+	// RFC 4226 appendix D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		got, err := Code(rfcSecret, int64(counter))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", counter, err)
+		}
+		if got != code {
+			t.Errorf("Code(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestCodeTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, truncated to six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if got != tt.code {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestCodeAcceptsLowerCaseAndPaddedSecrets(t *testing.T) {
+	for _, secret := range []string{strings.ToLower(rfcSecret), rfcSecret + "===="} {
+		got, err := Code(secret, 1)
+		if err != nil {
+			t.Fatalf("Code(%q): %v", secret, err)
+		}
+		if got != "287082" {
+			t.Errorf("Code(%q) = %s, want 287082", secret, got)
+		}
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	codeAt := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("Code(%d): %v", step, err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name string
+		code string
+		skew int
+		step int64
+		ok   bool
+	}{
+		{"current step", codeAt(current), 1, current, true},
+		{"current step without skew", codeAt(current), 0, current, true},
+		{"surrounding whitespace", " " + codeAt(current) + "\n", 0, current, true},
+		{"previous step within skew", codeAt(current - 1), 1, current - 1, true},
+		{"next step within skew", codeAt(current + 1), 1, current + 1, true},
+		{"previous step without skew", codeAt(current - 1), 0, 0, false},
+		{"next step without skew", codeAt(current + 1), 0, 0, false},
+		{"two steps behind", codeAt(current - 2), 1, 0, false},
+		{"two steps ahead", codeAt(current + 2), 1, 0, false},
+		{"two steps behind with a wider skew", codeAt(current - 2), 2, current - 2, true},
+		{"wrong code", "000000", 1, 0, false},
+		{"too short", codeAt(current)[:5], 1, 0, false},
+		{"too long", codeAt(current) + "0", 1, 0, false},
+		{"empty", "", 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now, tt.skew)
+			if ok != tt.ok || step != tt.step {
+				t.Errorf("Validate = (%d, %v), want (%d, %v)", step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateReturnsTheSameStepForAReplayedCode(t *testing.T) {
+	// callers reject replays by step, so a code used again later in its
+	// window must map to the step it was first accepted for
+	now := time.Unix(1111111111, 0)
+	code, _ := Code(rfcSecret, Step(now))
+
+	first, ok := Validate(rfcSecret, code, now, 1)
+	if !ok {
+		t.Fatal("code rejected")
+	}
+	replayed, ok := Validate(rfcSecret, code, now.Add(Period*time.Second), 1)
+	if !ok {
+		t.Fatal("code rejected within the skew window")
+	}
+	if replayed != first {
+		t.Errorf("replayed step = %d, want %d", replayed, first)
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Lightweight CRM", "ada@example.com", rfcSecret)
+	want := "otpauth://totp/Lightweight%20CRM:ada@example.com?algorithm=SHA1&digits=6&issuer=Lightweight+CRM&period=30&secret=" + rfcSecret
+	if got != want {
+		t.Errorf("URI = %s, want %s", got, want)
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	if _, err := Code(secret, 0); err != nil {
+		t.Errorf("generated secret %q is unusable: %v", secret, err)
+	}
+	if other, _ := GenerateSecret(); other == secret {
+		t.Error("GenerateSecret returned the same secret twice")
+	}
+}
@@ -0,0 +1,35 @@
+package utils
+
+import "strings"
+
+// Slugify converts a name into a lowercase, URL-friendly identifier
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case b.Len() > 0 && !dash:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// UniqueSlug slugifies the name and appends a random suffix, so that slugs
+// stay unique without a lookup
+func UniqueSlug(name string) (string, error) {
+	suffix, err := RandomToken(3)
+	if err != nil {
+		return "", err
+	}
+
+	slug := Slugify(name)
+	if slug == "" {
+		slug = "org"
+	}
+	return slug + "-" + suffix, nil
+}